@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/conformance"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// stderrTailLines はチェック失敗時に表示するサーバー stderr の最大行数です。
+const stderrTailLines = 20
+
+// runCheck は check サブコマンドを実行し、終了コードを返します。
+// 使用例: tumiki-mcp-http check --stdio "npx -y server-filesystem /data"
+func runCheck(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var envVars ArrayFlags
+	stdioCmd := fs.String("stdio", "", "stdio command to check (e.g., 'npx -y server-filesystem /data')")
+	timeout := fs.Duration("timeout", conformance.DefaultTimeout, "timeout for each protocol check")
+	fs.Var(&envVars, "env", "environment variables KEY=VALUE (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cmdParts := parseStdioCommand(*stdioCmd)
+	if len(cmdParts) == 0 {
+		_, _ = fmt.Fprintln(stderr, "Error: --stdio flag is required")
+		_, _ = fmt.Fprintln(stderr, "\nUsage: tumiki-mcp-http check --stdio \"npx -y @modelcontextprotocol/server-filesystem /data\"")
+		return 2
+	}
+
+	envMap := parseKeyValuePairs(envVars)
+	if err := interpolateConfig(cmdParts, envMap); err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	executor := process.NewExecutor(cmdParts[0], cmdParts[1:], envMap, nil)
+	session, err := executor.Start(ctx)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "Error: failed to start %q: %v\n", *stdioCmd, err)
+		return 1
+	}
+
+	_, _ = fmt.Fprintf(stdout, "MCP conformance report: %s\n\n", *stdioCmd)
+	report := conformance.NewChecker(session, *timeout).Run(ctx)
+	_ = session.Close()
+
+	if err := report.Write(stdout); err != nil {
+		return 1
+	}
+	if report.Passed() {
+		return 0
+	}
+
+	if tail := lastLines(session.Stderr(), stderrTailLines); tail != "" {
+		_, _ = fmt.Fprintf(stdout, "\nServer stderr (last %d lines):\n%s\n", stderrTailLines, tail)
+	}
+	return 1
+}
+
+// lastLines は文字列の末尾 n 行を返します。
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mcptest"
+)
+
+func TestMain(m *testing.M) {
+	mcptest.RunIfRequested()
+	os.Exit(m.Run())
+}
+
+func TestRunCheck(t *testing.T) {
+	command, _, env := mcptest.Command(mcptest.ModeCompliant)
+	var envFlags []string
+	for k, v := range env {
+		envFlags = append(envFlags, "--env", k+"="+v)
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name:       "準拠サーバー_終了コード0でレポートを出力する",
+			args:       append([]string{"--stdio", command, "--timeout", "2s"}, envFlags...),
+			wantCode:   0,
+			wantStdout: "Summary: 8 passed, 0 failed",
+		},
+		{
+			name:       "初期化に応答しないサーバー_終了コード1を返す",
+			args:       []string{"--stdio", `sh -c "echo boom >&2"`, "--timeout", "1s"},
+			wantCode:   1,
+			wantStdout: "boom",
+		},
+		{
+			name:       "stdio未指定_終了コード2を返す",
+			args:       []string{},
+			wantCode:   2,
+			wantStderr: "--stdio flag is required",
+		},
+		{
+			name:     "不明なフラグ_終了コード2を返す",
+			args:     []string{"--unknown"},
+			wantCode: 2,
+		},
+		{
+			name:       "存在しないコマンド_終了コード1を返す",
+			args:       []string{"--stdio", "nonexistent-command-12345"},
+			wantCode:   1,
+			wantStderr: "failed to start",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := runCheck(tt.args, &stdout, &stderr)
+
+			if code != tt.wantCode {
+				t.Errorf("runCheck() = %d, want %d (stdout: %s, stderr: %s)", code, tt.wantCode, stdout.String(), stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.wantStdout) {
+				t.Errorf("stdout should contain %q: got %s", tt.wantStdout, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("stderr should contain %q: got %s", tt.wantStderr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		n        int
+		expected string
+	}{
+		{name: "行数が上限以下_全て返す", input: "a\nb\n", n: 3, expected: "a\nb"},
+		{name: "行数が上限超過_末尾のみ返す", input: "a\nb\nc\n", n: 2, expected: "b\nc"},
+		{name: "空文字列_空文字列を返す", input: "", n: 2, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lastLines(tt.input, tt.n); got != tt.expected {
+				t.Errorf("lastLines() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
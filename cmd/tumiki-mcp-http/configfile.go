@@ -0,0 +1,237 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/config"
+)
+
+// configFlag は設定ファイルから設定するフラグと値です。繰り返し指定するフラグは値を複数持ちます。
+type configFlag struct {
+	name   string
+	values []string
+}
+
+// applyConfigSources は --config と --mcp-config の設定ファイルを読み込み、fs のフラグと f に設定します。
+func applyConfigSources(fs *flag.FlagSet, f *cliFlags) error {
+	if f.configFile != "" {
+		cfg, err := config.Load(f.configFile)
+		if err != nil {
+			return err
+		}
+		if err := applyConfigFile(fs, cfg); err != nil {
+			return err
+		}
+	}
+	// mcpServers 形式の設定ファイル（名前付きのサーバーとして追加）
+	if f.mcpConfig != "" {
+		servers, err := config.LoadMCPServers(f.mcpConfig)
+		if err != nil {
+			return err
+		}
+		if err := applyMCPConfig(f, servers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyConfigFile は設定ファイルの値を fs のフラグに設定します。
+// コマンドラインで指定したフラグは設定ファイルより優先し、設定ファイルの値を無視します。
+func applyConfigFile(fs *flag.FlagSet, cfg *config.Config) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	flags, err := configFlags(cfg)
+	if err != nil {
+		return err
+	}
+	for _, f := range flags {
+		if fs.Lookup(f.name) == nil {
+			return fmt.Errorf("config: unknown option %q", f.name)
+		}
+		if explicit[f.name] || f.name == "config" {
+			continue
+		}
+		for _, value := range f.values {
+			if err := fs.Set(f.name, value); err != nil {
+				return fmt.Errorf("config: option %s: %w", f.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configFlags は設定ファイルの値をフラグ名と値に変換します。設定されていない項目は含めません。
+func configFlags(cfg *config.Config) ([]configFlag, error) {
+	var flags []configFlag
+	add := func(name string, values ...string) {
+		if len(values) > 0 {
+			flags = append(flags, configFlag{name: name, values: values})
+		}
+	}
+	addString := func(name, value string) {
+		if value != "" {
+			add(name, value)
+		}
+	}
+	addInt := func(name string, value int) {
+		if value != 0 {
+			add(name, strconv.Itoa(value))
+		}
+	}
+	addDuration := func(name string, value time.Duration) {
+		if value != 0 {
+			add(name, value.String())
+		}
+	}
+	addBool := func(name string, value bool) {
+		if value {
+			add(name, "true")
+		}
+	}
+
+	// サーバー
+	addString("host", cfg.Server.Host)
+	addInt("port", cfg.Server.Port)
+	addInt("grpc-port", cfg.Server.GRPCPort)
+	addInt("tcp-port", cfg.Server.TCPPort)
+	addDuration("read-timeout", cfg.Server.ReadTimeout)
+	addDuration("write-timeout", cfg.Server.WriteTimeout)
+	addString("log-level", cfg.Server.LogLevel)
+
+	// /mcp のサーバー
+	if cfg.Stdio.Command != "" {
+		command, err := commandLine(cfg.Stdio)
+		if err != nil {
+			return nil, fmt.Errorf("config: stdio: %w", err)
+		}
+		add("stdio", command)
+	}
+	add("env", keyValues("", cfg.Stdio.Env)...)
+	add("require-env", cfg.Stdio.RequiredEnv...)
+	add("header-env", keyValues("", cfg.Stdio.HeaderEnv)...)
+	add("header-arg", keyValues("", cfg.Stdio.HeaderArg)...)
+
+	// 名前付きのサーバー
+	var servers, serverEnv, serverRequiredEnv, serverHeaderEnv, serverHeaderArg []string
+	for _, name := range slices.Sorted(maps.Keys(cfg.Servers)) {
+		def := cfg.Servers[name]
+		command, err := commandLine(def)
+		if err != nil {
+			return nil, fmt.Errorf("config: servers.%s: %w", name, err)
+		}
+		servers = append(servers, name+"="+command)
+		serverEnv = append(serverEnv, keyValues(name+":", def.Env)...)
+		for _, key := range def.RequiredEnv {
+			serverRequiredEnv = append(serverRequiredEnv, name+":"+key)
+		}
+		serverHeaderEnv = append(serverHeaderEnv, keyValues(name+":", def.HeaderEnv)...)
+		serverHeaderArg = append(serverHeaderArg, keyValues(name+":", def.HeaderArg)...)
+	}
+	add("server", servers...)
+	add("server-env", serverEnv...)
+	add("server-require-env", serverRequiredEnv...)
+	add("server-header-env", serverHeaderEnv...)
+	add("server-header-arg", serverHeaderArg...)
+
+	// プロセスの調整
+	addDuration("initialize-timeout", cfg.Process.InitializeTimeout)
+	addInt("max-message-size", cfg.Process.MaxMessageSize)
+	addString("stdio-framing", cfg.Process.Framing)
+	addString("backend-compression", cfg.Process.Compression)
+	addInt("pool-size", cfg.Process.PoolSize)
+	addDuration("pool-max-idle", cfg.Process.PoolMaxIdle)
+	addBool("reuse-processes", cfg.Process.ReuseProcesses)
+	addDuration("reuse-ttl", cfg.Process.ReuseTTL)
+	addInt("reuse-max-entries", cfg.Process.ReuseMaxEntries)
+	addBool("shared-process", cfg.Process.SharedProcess)
+
+	// その他のオプション
+	for _, name := range slices.Sorted(maps.Keys(cfg.Options)) {
+		add(name, optionValues(cfg.Options[name])...)
+	}
+	return flags, nil
+}
+
+// applyMCPConfig は mcpServers 形式の設定ファイルのサーバーを --server と --server-env に追加します。
+func applyMCPConfig(f *cliFlags, servers map[string]config.ServerDefinition) error {
+	for _, name := range slices.Sorted(maps.Keys(servers)) {
+		def := servers[name]
+		// mcpServers の command は引数を含まない実行ファイルのパスのため、空白を含む場合はクォートする
+		command, err := quoteArg(def.Command)
+		if err != nil {
+			return fmt.Errorf("mcp config: mcpServers.%s: %w", name, err)
+		}
+		line, err := commandLine(config.ServerDefinition{Command: command, Args: def.Args})
+		if err != nil {
+			return fmt.Errorf("mcp config: mcpServers.%s: %w", name, err)
+		}
+		f.servers = append(f.servers, name+"="+line)
+		f.serverEnvVars = append(f.serverEnvVars, keyValues(name+":", def.Env)...)
+	}
+	return nil
+}
+
+// commandLine は Command に Args を --stdio と同じ形式でクォートして連結します。
+func commandLine(def config.ServerDefinition) (string, error) {
+	parts := []string{def.Command}
+	for _, arg := range def.Args {
+		quoted, err := quoteArg(arg)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, quoted)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// quoteArg は parseStdioCommand で1つの引数として解析されるように arg をクォートします。
+// parseStdioCommand にはエスケープがないため、両方のクォートを含む引数はエラーにします。
+func quoteArg(arg string) (string, error) {
+	switch {
+	case arg != "" && !strings.ContainsAny(arg, ` "'`):
+		return arg, nil
+	case !strings.Contains(arg, `'`):
+		return "'" + arg + "'", nil
+	case !strings.Contains(arg, `"`):
+		return `"` + arg + `"`, nil
+	default:
+		return "", fmt.Errorf("argument %q cannot contain both single and double quotes", arg)
+	}
+}
+
+// keyValues はマップを prefix を付けた "KEY=VALUE" 形式の値に変換します（キーの順）。
+func keyValues(prefix string, m map[string]string) []string {
+	values := make([]string, 0, len(m))
+	for _, key := range slices.Sorted(maps.Keys(m)) {
+		values = append(values, prefix+key+"="+m[key])
+	}
+	return values
+}
+
+// optionValues は Options の値をフラグの値に変換します。リストは要素ごと、マップは "KEY=VALUE" ごとに設定します。
+func optionValues(value any) []string {
+	switch v := value.(type) {
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	case map[string]any:
+		values := make([]string, 0, len(v))
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			values = append(values, key+"="+fmt.Sprint(v[key]))
+		}
+		return values
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/config"
+)
+
+// newConfigFlagSet は設定ファイルのテスト用に main と同じ名前のフラグの一部を定義した FlagSet を作成します。
+func newConfigFlagSet(f *cliFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&f.configFile, "config", "", "")
+	fs.StringVar(&f.stdioCmd, "stdio", "", "")
+	fs.Var(&f.envVars, "env", "")
+	fs.Var(&f.headerEnvMappings, "header-env", "")
+	fs.StringVar(&f.host, "host", "", "")
+	fs.IntVar(&f.port, "port", 8080, "")
+	fs.DurationVar(&f.readTimeout, "read-timeout", 0, "")
+	fs.Var(&f.servers, "server", "")
+	fs.Var(&f.serverRequiredEnv, "server-require-env", "")
+	fs.Var(&f.serverHeaderEnv, "server-header-env", "")
+	fs.IntVar(&f.poolSize, "pool-size", 0, "")
+	fs.BoolVar(&f.metrics, "metrics", false, "")
+	fs.Var(&f.stripHeaders, "strip-header", "")
+	return fs
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	cfg, err := config.Parse([]byte(`
+server:
+  host: 127.0.0.1
+  port: 9090
+  readTimeout: 10s
+stdio:
+  command: my-server --root
+  args: ["/data/my files"]
+  env: {B: "2", A: "1"}
+  headerEnv: {X-Token: TOKEN}
+servers:
+  github:
+    command: npx
+    args: [-y, server-github]
+    requiredEnv: [GITHUB_TOKEN]
+    headerEnv: {X-Github-Token: GITHUB_TOKEN}
+process:
+  poolSize: 2
+options:
+  metrics: true
+  strip-header: [X-Internal-*, X-Debug]
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	var f cliFlags
+	fs := newConfigFlagSet(&f)
+	// コマンドラインで指定したオプションが優先される
+	if err := fs.Parse([]string{"--port", "7070", "--env", "C=3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfigFile(fs, cfg); err != nil {
+		t.Fatalf("applyConfigFile() error = %v", err)
+	}
+
+	if f.host != "127.0.0.1" || f.port != 7070 || f.readTimeout != 10*time.Second {
+		t.Errorf("host, port, readTimeout = %q, %d, %v, want 127.0.0.1, 7070, 10s", f.host, f.port, f.readTimeout)
+	}
+	if want := `my-server --root '/data/my files'`; f.stdioCmd != want {
+		t.Errorf("stdio = %q, want %q", f.stdioCmd, want)
+	}
+	if want := []string{"my-server", "--root", "/data/my files"}; !reflect.DeepEqual(parseStdioCommand(f.stdioCmd), want) {
+		t.Errorf("parsed stdio = %q, want %q", parseStdioCommand(f.stdioCmd), want)
+	}
+	if want := (ArrayFlags{"C=3"}); !reflect.DeepEqual(f.envVars, want) {
+		t.Errorf("env = %v, want %v", f.envVars, want)
+	}
+	if want := (ArrayFlags{"X-Token=TOKEN"}); !reflect.DeepEqual(f.headerEnvMappings, want) {
+		t.Errorf("header-env = %v, want %v", f.headerEnvMappings, want)
+	}
+	if want := (ArrayFlags{"github=npx -y server-github"}); !reflect.DeepEqual(f.servers, want) {
+		t.Errorf("server = %v, want %v", f.servers, want)
+	}
+	if want := (ArrayFlags{"github:GITHUB_TOKEN"}); !reflect.DeepEqual(f.serverRequiredEnv, want) {
+		t.Errorf("server-require-env = %v, want %v", f.serverRequiredEnv, want)
+	}
+	if want := (ArrayFlags{"github:X-Github-Token=GITHUB_TOKEN"}); !reflect.DeepEqual(f.serverHeaderEnv, want) {
+		t.Errorf("server-header-env = %v, want %v", f.serverHeaderEnv, want)
+	}
+	if f.poolSize != 2 || !f.metrics {
+		t.Errorf("pool-size, metrics = %d, %v, want 2, true", f.poolSize, f.metrics)
+	}
+	if want := (ArrayFlags{"X-Internal-*", "X-Debug"}); !reflect.DeepEqual(f.stripHeaders, want) {
+		t.Errorf("strip-header = %v, want %v", f.stripHeaders, want)
+	}
+}
+
+func TestApplyConfigFile_Error(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "未知のオプション_エラー", input: "options:\n  no-such-flag: true\n", wantErr: `unknown option "no-such-flag"`},
+		{name: "不正な値_エラー", input: "options:\n  metrics: maybe\n", wantErr: "option metrics"},
+		{name: "両方のクォートを含む引数_エラー", input: "stdio:\n  command: a\n  args: [\"it's \\\"x\\\"\"]\n", wantErr: "both single and double quotes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.Parse([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			var f cliFlags
+			err = applyConfigFile(newConfigFlagSet(&f), cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("applyConfigFile() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyMCPConfig(t *testing.T) {
+	servers, err := config.ParseMCPServers([]byte(`{"mcpServers": {
+		"github": {"command": "npx", "args": ["-y", "server-github"], "env": {"GITHUB_TOKEN": "ghp_xxx"}},
+		"local": {"command": "/opt/My Tools/server", "args": ["--root", "/data/my files"]}
+	}}`))
+	if err != nil {
+		t.Fatalf("ParseMCPServers() error = %v", err)
+	}
+
+	f := cliFlags{servers: ArrayFlags{"fs=npx -y server-filesystem"}}
+	if err := applyMCPConfig(&f, servers); err != nil {
+		t.Fatalf("applyMCPConfig() error = %v", err)
+	}
+	defs, err := parseServerDefinitions(f)
+	if err != nil {
+		t.Fatalf("parseServerDefinitions() error = %v", err)
+	}
+
+	if def := defs["github"]; def.Command != "npx" || !reflect.DeepEqual(def.Args, []string{"-y", "server-github"}) || def.DefaultEnv["GITHUB_TOKEN"] != "ghp_xxx" {
+		t.Errorf("github = %+v", def)
+	}
+	// 空白を含む実行ファイルのパスは1つの引数として扱う
+	if def := defs["local"]; def.Command != "/opt/My Tools/server" || !reflect.DeepEqual(def.Args, []string{"--root", "/data/my files"}) {
+		t.Errorf("local = %+v", def)
+	}
+	if _, ok := defs["fs"]; !ok {
+		t.Error("servers given by --server are dropped")
+	}
+
+	// --server と同じ名前のサーバーは重複としてエラーにする
+	f = cliFlags{servers: ArrayFlags{"github=other"}}
+	if err := applyMCPConfig(&f, servers); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseServerDefinitions(f); err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("parseServerDefinitions() error = %v, want duplicate error", err)
+	}
+}
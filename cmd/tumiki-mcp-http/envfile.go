@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+)
+
+// loadEnvFiles は --env-file の dotenv ファイルを順に読み込み、環境変数をまとめて返します。
+// 同じ名前の環境変数は後のファイルの値を使います。
+func loadEnvFiles(paths []string) (map[string]string, error) {
+	env := make(map[string]string)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("env file: %w", err)
+		}
+		values, err := parseEnvFile(path, data)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(env, values)
+	}
+	return env, nil
+}
+
+// parseEnvFile は dotenv 形式の data を解析します。name はエラーメッセージに含めるファイル名です。
+//   - 空行と # で始まる行は無視し、先頭の export は取り除く
+//   - クォートしない値は前後の空白と、空白に続く # 以降のコメントを取り除く
+//   - シングルクォートの値はそのまま、ダブルクォートの値は \n・\r・\t・\\・\"・\$ のエスケープを解釈する
+//   - クォートした値は閉じるクォートまで複数行にできる
+//
+// 値はシークレットを含むため、${NAME} などのプレースホルダーは展開しません。
+func parseEnvFile(name string, data []byte) (map[string]string, error) {
+	env := make(map[string]string)
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "export"); ok && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+			line = strings.TrimSpace(rest)
+		}
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", name, lineNo)
+		}
+		if !envNamePattern.MatchString(key) {
+			return nil, fmt.Errorf("%s:%d: %q is not a valid environment variable name", name, lineNo, key)
+		}
+
+		value = strings.TrimLeft(value, " \t")
+		if value == "" || (value[0] != '"' && value[0] != '\'') {
+			env[key] = stripInlineComment(value)
+			continue
+		}
+
+		// 閉じるクォートが見つかるまで次の行を続けて読む
+		quote, body := value[0], value[1:]
+		end := closingQuote(body, quote)
+		for end < 0 {
+			if i+1 >= len(lines) {
+				return nil, fmt.Errorf("%s:%d: unterminated quoted value for %s", name, lineNo, key)
+			}
+			i++
+			body += "\n" + lines[i]
+			end = closingQuote(body, quote)
+		}
+		if rest := strings.TrimSpace(body[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, fmt.Errorf("%s:%d: unexpected characters after the quoted value for %s", name, lineNo, key)
+		}
+		body = body[:end]
+		if quote == '"' {
+			body = unescapeEnvValue(body)
+		}
+		env[key] = body
+	}
+	return env, nil
+}
+
+// closingQuote は s の中の閉じるクォートの位置を返します。見つからない場合は -1 を返します。
+// ダブルクォートではバックスラッシュでエスケープしたクォートを飛ばします。
+func closingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote == '"':
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// unescapeEnvValue はダブルクォートの値のエスケープを解釈します。それ以外のバックスラッシュはそのまま残します。
+func unescapeEnvValue(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '\\', '"', '$':
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// stripInlineComment はクォートしない値から、空白に続く # 以降のコメントと前後の空白を取り除きます。
+// 空白に続かない #（URL のフラグメントなど）は値の一部として残します。
+func stripInlineComment(value string) string {
+	for i := 0; i < len(value); i++ {
+		if value[i] == '#' && (i == 0 || value[i-1] == ' ' || value[i-1] == '\t') {
+			value = value[:i]
+			break
+		}
+	}
+	return strings.TrimSpace(value)
+}
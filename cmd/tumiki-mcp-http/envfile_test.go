@@ -0,0 +1,110 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]string
+	}{
+		{
+			name: "コメントと空行を無視",
+			data: "# comment\n\nA=1\n  # indented comment\nB=2\n",
+			want: map[string]string{"A": "1", "B": "2"},
+		},
+		{
+			name: "export を取り除く",
+			data: "export TOKEN=abc\nexport\tREGION = us-east-1\nexported=1\n",
+			want: map[string]string{"TOKEN": "abc", "REGION": "us-east-1", "exported": "1"},
+		},
+		{
+			name: "クォートしない値のコメント",
+			data: "A=value # comment\nB=https://example.com/#frag\nC=\nD=#only comment\n",
+			want: map[string]string{"A": "value", "B": "https://example.com/#frag", "C": "", "D": ""},
+		},
+		{
+			name: "シングルクォートはそのまま",
+			data: `A='a "b" \n ${HOME} # not a comment'` + "\n",
+			want: map[string]string{"A": `a "b" \n ${HOME} # not a comment`},
+		},
+		{
+			name: "ダブルクォートのエスケープ",
+			data: `A="line1\nline2\t\"q\" \$HOME \\ \x" # comment` + "\n",
+			want: map[string]string{"A": "line1\nline2\t\"q\" $HOME \\ \\x"},
+		},
+		{
+			name: "複数行の値",
+			data: "KEY=\"-----BEGIN KEY-----\nabc\n-----END KEY-----\"\nNEXT=1\n",
+			want: map[string]string{"KEY": "-----BEGIN KEY-----\nabc\n-----END KEY-----", "NEXT": "1"},
+		},
+		{
+			name: "CRLF",
+			data: "A=1\r\nB='2'\r\n",
+			want: map[string]string{"A": "1", "B": "2"},
+		},
+		{
+			name: "後の値を使う",
+			data: "A=1\nA=2\n",
+			want: map[string]string{"A": "2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEnvFile(".env", []byte(tt.data))
+			if err != nil {
+				t.Fatalf("parseEnvFile() error = %v", err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("parseEnvFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEnvFile_エラー(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "区切りなし", data: "A=1\nINVALID\n", want: ".env:2: expected KEY=VALUE"},
+		{name: "不正な名前", data: "1A=1\n", want: `.env:1: "1A" is not a valid environment variable name`},
+		{name: "閉じないクォート", data: "A=\"abc\nB=1\n", want: ".env:1: unterminated quoted value for A"},
+		{name: "クォートの後の文字", data: "A='abc'def\n", want: ".env:1: unexpected characters after the quoted value for A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseEnvFile(".env", []byte(tt.data))
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("parseEnvFile() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadReloadableConfig_EnvFile(t *testing.T) {
+	dir := t.TempDir()
+	base, local := filepath.Join(dir, ".env"), filepath.Join(dir, ".env.local")
+	_ = os.WriteFile(base, []byte("A=base\nB=base\nC='${NOT_EXPANDED}'\n"), 0o600)
+	_ = os.WriteFile(local, []byte("B=local\nD=local\n"), 0o600)
+
+	// 後のファイルが前のファイルを、--env がファイルを上書きする
+	cfg, err := loadReloadableConfig([]string{"--env-file", base, "--env-file", local, "--env", "D=flag"})
+	if err != nil {
+		t.Fatalf("loadReloadableConfig() error = %v", err)
+	}
+	want := map[string]string{"A": "base", "B": "local", "C": "${NOT_EXPANDED}", "D": "flag"}
+	if !maps.Equal(cfg.DefaultEnv, want) {
+		t.Errorf("DefaultEnv = %v, want %v", cfg.DefaultEnv, want)
+	}
+
+	if _, err := loadReloadableConfig([]string{"--env-file", filepath.Join(dir, "missing")}); err == nil {
+		t.Error("loadReloadableConfig() with a missing env file error = nil")
+	}
+}
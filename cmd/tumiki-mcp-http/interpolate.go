@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/proxy"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/templatefunc"
+)
+
+// placeholderPattern は起動時に展開するプレースホルダーです。
+//   - ${NAME}: 環境変数 NAME の値
+//   - {{env "NAME"}}: 環境変数 NAME の値（--stdio でクォートが取り除かれた {{env NAME}} も同じ）
+//   - {{ ... }}: templatefunc の関数と env を使える text/template のアクション（{{headerArgs}} を除く）
+//   - $${: リテラルの "${"（展開しない）
+var placeholderPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\{\{\s*env\s+"?([A-Za-z_][A-Za-z0-9_]*)"?\s*\}\}|\{\{.*?\}\}`)
+
+// interpolateEnv は s のプレースホルダーを lookup で取得した環境変数の値で置き換えます。
+// ${NAME} と {{env "NAME"}} で参照した環境変数が設定されていない場合はエラーを返します。
+// 関数を使うアクションの中では、未設定の環境変数は default で値を補えるよう空文字列になります。
+func interpolateEnv(s string, lookup func(string) (string, bool)) (string, error) {
+	var err error
+	result := placeholderPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+		groups := placeholderPattern.FindStringSubmatch(match)
+		name := groups[1]
+		if name == "" {
+			name = groups[2]
+		}
+		if name == "" {
+			value, execErr := executeTemplate(match, lookup)
+			if execErr != nil && err == nil {
+				err = fmt.Errorf("template %q in %q: %w", match, s, execErr)
+			}
+			return value
+		}
+		value, ok := lookup(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %q referenced in %q is not set", name, s)
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// executeTemplate は1つのアクションを templatefunc の関数と env で評価します。
+// ヘッダー由来の引数の位置を示す {{headerArgs}} はプロキシが置き換えるため、そのまま返します。
+func executeTemplate(action string, lookup func(string) (string, bool)) (string, error) {
+	if action == proxy.HeaderArgsPlaceholder {
+		return action, nil
+	}
+	funcs := templatefunc.FuncMap()
+	funcs["env"] = func(name string) string {
+		value, _ := lookup(name)
+		return value
+	}
+	tmpl, err := template.New("interpolate").Funcs(funcs).Parse(action)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, nil); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// interpolateConfig はコマンド・引数とデフォルト環境変数の値のプレースホルダーを
+// プロキシ自身の環境変数で展開します。ラッパーのシェルスクリプトなしでパスなどを指定するために使用します。
+// デフォルト環境変数の "@/path" の値はファイルから読み込みます。
+func interpolateConfig(cmdParts []string, env map[string]string) error {
+	for i, part := range cmdParts {
+		expanded, err := interpolateEnv(part, os.LookupEnv)
+		if err != nil {
+			return err
+		}
+		cmdParts[i] = expanded
+	}
+	for key, value := range env {
+		expanded, err := interpolateEnv(value, os.LookupEnv)
+		if err != nil {
+			return err
+		}
+		// 展開した後の "@/path" の値はファイルの内容に置き換える
+		if expanded, err = resolveFileValue(key, expanded); err != nil {
+			return err
+		}
+		env[key] = expanded
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInterpolateEnv(t *testing.T) {
+	env := map[string]string{
+		"HOME":     "/home/mcp",
+		"API_BASE": "https://api.example.com",
+		"EMPTY":    "",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "ドル記法_展開される", input: "${HOME}/data", want: "/home/mcp/data"},
+		{name: "テンプレート記法_展開される", input: `{{env "API_BASE"}}/v1`, want: "https://api.example.com/v1"},
+		{name: "テンプレート記法のクォートなし_展開される", input: "{{env HOME}}", want: "/home/mcp"},
+		{name: "テンプレート記法の空白_許容される", input: `{{ env "HOME" }}`, want: "/home/mcp"},
+		{name: "複数のプレースホルダー_全て展開される", input: `--url=${API_BASE}?home={{env "HOME"}}`, want: "--url=https://api.example.com?home=/home/mcp"},
+		{name: "空の環境変数_空文字列に展開される", input: "x${EMPTY}y", want: "xy"},
+		{name: "エスケープ_リテラルのまま", input: "$${HOME}", want: "${HOME}"},
+		{name: "波括弧なしのドル記号_そのまま", input: "$HOME and $1", want: "$HOME and $1"},
+		{name: "プレースホルダーなし_そのまま", input: "/data", want: "/data"},
+		{name: "未設定の環境変数_エラー", input: "${MISSING}", wantErr: true},
+		{name: "テンプレート記法で未設定_エラー", input: `{{env "MISSING"}}`, wantErr: true},
+		{name: "関数_適用される", input: `{{env "API_BASE" | trimPrefix "https://" | upper}}`, want: "API.EXAMPLE.COM"},
+		{name: "関数の中で未設定_defaultで補える", input: `--level={{env "MISSING" | default "info"}}`, want: "--level=info"},
+		{name: "ハッシュ_16進数", input: `{{sha256 (env "HOME")}}`, want: "fbed44eec2b2ba59196d84c09655acc627dec5a58882c00aee58a75195d87bde"},
+		{name: "ヘッダー引数のプレースホルダー_そのまま", input: "{{headerArgs}}", want: "{{headerArgs}}"},
+		{name: "未定義の関数_エラー", input: `{{title "a"}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := interpolateEnv(tt.input, lookup)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("interpolateEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("interpolateEnv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildConfigFromFlags_Interpolation(t *testing.T) {
+	t.Setenv("TUMIKI_TEST_ROOT", "/srv/mcp")
+	t.Setenv("TUMIKI_TEST_API", "https://api.example.com")
+
+	result := buildConfigFromFlags(cliFlags{
+		stdioCmd: `${TUMIKI_TEST_ROOT}/bin/server --data '{{env "TUMIKI_TEST_ROOT"}}/data'`,
+		envVars:  ArrayFlags{"API_BASE=${TUMIKI_TEST_API}/v1"},
+	})
+
+	if result.Command != "/srv/mcp/bin/server" {
+		t.Errorf("Command = %q, want /srv/mcp/bin/server", result.Command)
+	}
+	if want := []string{"--data", "/srv/mcp/data"}; !reflect.DeepEqual(result.Args, want) {
+		t.Errorf("Args = %v, want %v", result.Args, want)
+	}
+	if got := result.DefaultEnv["API_BASE"]; got != "https://api.example.com/v1" {
+		t.Errorf("DefaultEnv[API_BASE] = %q, want https://api.example.com/v1", got)
+	}
+}
@@ -9,10 +9,32 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/apikey"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/cache"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/egress"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/election"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jwtauth"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mapping"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/objectstore"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/plugin"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
 	"github.com/rayven122/tumiki-mcp-http-adapter/internal/proxy"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/ratelimit"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/rewrite"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/sanitize"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/script"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/secrets"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/sessionstore"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/spiffe"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/tokenexchange"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/usage"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/webhook"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/weights"
 )
 
 // ArrayFlags は複数回指定可能なフラグ型です。
@@ -28,29 +50,292 @@ func (a *ArrayFlags) Set(value string) error {
 	return nil
 }
 
+// cliFlags は CLI フラグの値をまとめた構造体です。
+type cliFlags struct {
+	// 設定ファイル
+	configFile  string
+	mcpConfig   string
+	watchConfig bool
+	printConfig bool
+
+	// サーバー設定
+	stdioCmd          string
+	envVars           ArrayFlags
+	envFiles          ArrayFlags
+	requiredEnv       ArrayFlags
+	headerEnvMappings ArrayFlags
+	headerArgMappings ArrayFlags
+	headerDecodings   ArrayFlags
+	headerTemplates   ArrayFlags
+	argOverrides      ArrayFlags
+	argRemovals       ArrayFlags
+	mappingRules      string
+	stripHeaders      ArrayFlags
+	hideCapabilities  ArrayFlags
+	plugins           ArrayFlags
+	scripts           ArrayFlags
+
+	// ディスカバリードキュメント
+	discovery             bool
+	discoveryName         string
+	discoveryDescription  string
+	discoveryContactName  string
+	discoveryContactEmail string
+	discoveryContactURL   string
+
+	launcherPrefetch bool
+
+	wasi        bool
+	wasiMounts  ArrayFlags
+	wasiListens ArrayFlags
+
+	containerRuntime string
+	containerOptions ArrayFlags
+	firecracker      string
+	microVMKernel    string
+	microVMRootFS    string
+	microVMVCPUs     int
+	microVMMemory    int
+	microVMBootArgs  string
+
+	workspace         bool
+	workspaceDir      string
+	workspaceEnv      string
+	workspaceMaxBytes int64
+	secrets           string
+	secretRotation    string
+	secretCacheTTL    time.Duration
+
+	egressProxy      bool
+	egressProxyAllow ArrayFlags
+
+	fileStaging         bool
+	fileStagingDir      string
+	fileStagingTTL      time.Duration
+	fileStagingMaxBytes int64
+
+	scriptMaxSteps  uint64
+	scriptTimeout   time.Duration
+	scriptMaxMemory uint64
+
+	maxHeaderValueBytes int
+	maxInjectedBytes    int
+
+	// ネットワーク設定
+	host         string
+	port         int
+	grpcPort     int
+	tcpPort      int
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	// レスポンス設定
+	maxMessageSize      int
+	maxResponseBytes    int
+	responseLimitPolicy string
+	metaHeaders         ArrayFlags
+	serverMetaHeaders   bool
+	compression         string
+	framing             string
+	blobThreshold       int
+	blobTTL             time.Duration
+
+	downloadThreshold int
+	downloadTTL       time.Duration
+
+	offloadStore     string
+	offloadThreshold int
+
+	// MCP のトランスポート
+	transport string
+	webSocket bool
+
+	// ロングポーリング設定
+	longPoll    bool
+	longPollTTL time.Duration
+
+	// 購読のブリッジ
+	subscriptions   bool
+	subscriptionTTL time.Duration
+	sessions        bool
+	sessionTTL      time.Duration
+	sessionOrdering string
+	sessionMaxCPU   time.Duration
+	sessionMaxCalls int
+	sessionMaxBytes int64
+	initTimeout     time.Duration
+
+	// セッションの失敗時のリクエストごとのプロセスへの切り替え
+	sessionFallbackFailures int
+	sessionFallbackWindow   time.Duration
+	sessionFallbackCooldown time.Duration
+
+	// キープアライブ
+	keepAliveInterval time.Duration
+	keepAliveMethod   string
+
+	// 予備プロセス
+	warmStandby          bool
+	standbyMin           int
+	standbyMax           int
+	standbyScaleInterval time.Duration
+	standbyCacheSize     int
+	poolSize             int
+	poolMaxIdle          time.Duration
+
+	// プロセスの再利用
+	reuseProcesses  bool
+	reuseTTL        time.Duration
+	reuseMaxEntries int
+
+	// 共有プロセス
+	sharedProcess bool
+
+	// 名前付きのサーバー
+	servers           ArrayFlags
+	serverEnvVars     ArrayFlags
+	serverRequiredEnv ArrayFlags
+	serverHeaderEnv   ArrayFlags
+	serverHeaderArg   ArrayFlags
+
+	// メトリクス・管理 API
+	metrics        bool
+	accessLog      bool
+	slowTool       time.Duration
+	requestLabels  ArrayFlags
+	shutdownReport string
+	adminToken     string
+	apiKeyDB       string
+
+	// 署名付きリクエスト
+	requestSigningKey string
+	signatureMaxSkew  time.Duration
+	nonceCacheSize    int
+
+	// SPIFFE によるワークロードの識別
+	spiffe           bool
+	spiffeSocket     string
+	spiffeAllow      ArrayFlags
+	spiffeAdminAllow ArrayFlags
+
+	// 認証チェーン
+	auth              string
+	jwtSecret         string
+	jwtPublicKey      string
+	jwtIssuer         string
+	jwtAudience       string
+	jwtPrincipalClaim string
+	anonymousMethods  ArrayFlags
+
+	// 下流向けのトークンへの交換
+	tokenExchangeURL          string
+	tokenExchangeClientID     string
+	tokenExchangeClientSecret string
+	tokenExchangeAudience     string
+	tokenExchangeResource     string
+	tokenExchangeScopes       ArrayFlags
+	tokenExchangeHeader       string
+
+	// 利用量の集計と出力
+	usage         bool
+	usageExport   string
+	usageWebhook  string
+	usageFormat   string
+	usageInterval time.Duration
+
+	// セッションのイベントの Webhook
+	sessionWebhook       string
+	sessionWebhookSecret string
+	sessionWebhookEvents ArrayFlags
+
+	// MCP レジストリへの登録
+	registryURL      string
+	registryToken    string
+	registryInterval time.Duration
+
+	// インスタンスの重みの公開
+	weightPublish  string
+	weightToken    string
+	weightInterval time.Duration
+	weightMax      int
+
+	// レプリカ間のセッション共有
+	sessionStore string
+	advertiseURL string
+
+	// 単一インスタンスのバックエンド
+	leaderLock    string
+	leaderLockKey string
+	leaderLockTTL time.Duration
+	followerMode  string
+
+	// アフィニティによるレプリカへの振り分け・クラスタモード
+	peers          ArrayFlags
+	affinityHeader string
+	cluster        bool
+	gossipInterval time.Duration
+
+	// レート制限
+	rateLimit          int
+	rateLimitWindow    time.Duration
+	rateLimitStore     string
+	rateLimitKeyHeader string
+
+	// ペイロードの UTF-8 検証・正規化
+	requestPayload  string
+	responsePayload string
+
+	// リクエスト書き換え・レスポンス変換
+	rewriteConfig   string
+	transformConfig string
+
+	// レスポンスのキャッシュ・重複排除
+	cacheConfig     string
+	cacheMaxEntries int
+	idempotencyTTL  time.Duration
+
+	// デバッグ設定
+	traceStdio         bool
+	traceStdioFormat   string
+	traceStdioMaxBytes int
+
+	// ログレベル
+	logLevel string
+}
+
 func main() {
+	// プロセスを外部への接続を制限するネットワーク名前空間で実行する中継
+	egress.RunSandboxIfRequested()
+
+	// サブコマンド
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(runCheck(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	// フラグ定義
-	var (
-		// サーバー設定
-		stdioCmd          = flag.String("stdio", "", "stdio command (e.g., 'npx -y server-filesystem /data')")
-		envVars           ArrayFlags
-		headerEnvMappings ArrayFlags
-		headerArgMappings ArrayFlags
-
-		// ネットワーク設定
-		port = flag.Int("port", 8080, "listen port (default: 8080)")
-
-		// ログレベル
-		logLevel = flag.String("log-level", "info", "log level (debug/info/warn/error)")
-	)
-
-	flag.Var(&envVars, "env", "environment variables KEY=VALUE (repeatable)")
-	flag.Var(&headerEnvMappings, "header-env", "header to env mapping HEADER-NAME=ENV_VAR (repeatable)")
-	flag.Var(&headerArgMappings, "header-arg", "header to arg mapping HEADER-NAME=arg-name (repeatable)")
+	var f cliFlags
+	defineFlags(flag.CommandLine, &f)
 	flag.Parse()
 
+	// 設定ファイル（コマンドラインで指定したオプションが優先）
+	if err := applyConfigSources(flag.CommandLine, &f); err != nil {
+		log.Fatal(err)
+	}
+	if f.printConfig {
+		if err := printConfig(os.Stdout, flag.CommandLine, f); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+	if f.watchConfig && f.configFile == "" && f.mcpConfig == "" {
+		log.Fatal("Error: --watch-config requires --config or --mcp-config")
+	}
+
 	// --stdio が必須
-	if *stdioCmd == "" {
+	if f.stdioCmd == "" {
 		fmt.Println("Error: --stdio flag is required")
 		fmt.Println("\nUsage examples:")
 		fmt.Println("  # Quick start")
@@ -63,52 +348,689 @@ func main() {
 		fmt.Println("    --header-arg \"X-Team-Id=team-id\"")
 		fmt.Println("\n  # Custom host binding (use HOST environment variable)")
 		fmt.Println("  HOST=127.0.0.1 tumiki-mcp-http --stdio \"npx -y server-filesystem /data\"")
+		fmt.Println("\n  # Check MCP protocol conformance of the wrapped server")
+		fmt.Println("  tumiki-mcp-http check --stdio \"npx -y server-filesystem /data\"")
+		fmt.Println("\n  # Validate a config file without starting the server")
+		fmt.Println("  tumiki-mcp-http validate --config tumiki.yaml")
 		os.Exit(1)
 	}
 
 	// 設定を構築
-	cfg := buildConfigFromFlags(
-		*stdioCmd, envVars, headerEnvMappings, headerArgMappings, *port,
-	)
+	cfg := buildConfigFromFlags(f)
 
 	// サーバー起動
-	startServer(cfg, *logLevel)
+	startServer(cfg, f)
 }
 
-func buildConfigFromFlags(
-	stdioCmd string,
-	envVars, headerEnvMappings, headerArgMappings ArrayFlags,
-	port int,
-) *proxy.Config {
+// defineFlags は全てのコマンドラインオプションを fs に定義し、値を f に設定するようにします。
+// 設定の再読み込みでは新しい FlagSet に定義して、コマンドラインと設定ファイルを読み直します。
+func defineFlags(fs *flag.FlagSet, f *cliFlags) {
+	fs.StringVar(&f.configFile, "config", "", "YAML config file; options given on the command line take precedence")
+	fs.StringVar(&f.mcpConfig, "mcp-config", "", "mcpServers JSON config (e.g., claude_desktop_config.json); each server is served under /servers/NAME/mcp")
+	fs.BoolVar(&f.watchConfig, "watch-config", false, "reload env defaults, header mappings and named servers when the config files change (SIGHUP always reloads them)")
+	fs.BoolVar(&f.printConfig, "print-config", false, "print the effective configuration (flags, config files and environment) as YAML with secrets masked, then exit")
+	fs.StringVar(&f.stdioCmd, "stdio", "", "stdio command (e.g., 'npx -y server-filesystem /data')")
+	fs.Var(&f.envVars, "env", "environment variables KEY=VALUE (repeatable)")
+	fs.Var(&f.envFiles, "env-file", "dotenv file of environment variables; --env takes precedence and later files override earlier ones (repeatable)")
+	fs.Var(&f.requiredEnv, "require-env", "environment variable the server needs; refuse to start (or the request) when it is not set (repeatable)")
+	fs.Var(&f.headerEnvMappings, "header-env", "header to env mapping HEADER-NAME=ENV_VAR (repeatable)")
+	fs.Var(&f.headerArgMappings, "header-arg", "header to arg mapping HEADER-NAME=arg-name (repeatable)")
+	fs.Var(&f.argOverrides, "header-arg-override", "replace a static arg with a header value HEADER-NAME=--flag|literal-arg (repeatable)")
+	fs.Var(&f.argRemovals, "header-arg-remove", "remove a static flag when the header is true HEADER-NAME=--flag (repeatable)")
+	fs.Var(&f.plugins, "plugin", "WebAssembly plugin for authentication, header mapping and request/response transforms (can be specified multiple times, applied in order)")
+	fs.Var(&f.scripts, "script", "Starlark script that can veto requests and compute env vars and args (can be specified multiple times, applied in order)")
+	fs.BoolVar(&f.launcherPrefetch, "launcher-prefetch", false, "download the packages of npx, uvx, bunx and deno backends into the launcher cache at startup and on reload")
+	fs.BoolVar(&f.wasi, "wasi", false, "run the stdio command as a WASI module (.wasm) in the embedded runtime instead of a host process")
+	fs.Var(&f.wasiMounts, "wasi-mount", "host directory exposed to the WASI module host[:guest][:ro] (repeatable)")
+	fs.Var(&f.wasiListens, "wasi-listen", "TCP address host:port the WASI module may accept connections on (repeatable)")
+	fs.StringVar(&f.containerRuntime, "runtime", "", "run the stdio command as a container image with this runtime (docker/podman/containerd) or inside a microVM (firecracker)")
+	fs.Var(&f.containerOptions, "runtime-opt", "extra option for the container run command, e.g. --network=none (repeatable)")
+	fs.StringVar(&f.firecracker, "firecracker", "", "firecracker binary for the firecracker runtime (default: firecracker on PATH)")
+	fs.StringVar(&f.microVMKernel, "microvm-kernel", "", "guest kernel image for the firecracker runtime")
+	fs.StringVar(&f.microVMRootFS, "microvm-rootfs", "", "pre-baked guest root filesystem (shared read-only) for the firecracker runtime")
+	fs.IntVar(&f.microVMVCPUs, "microvm-vcpus", process.DefaultMicroVMVCPUs, "vCPUs of each microVM")
+	fs.IntVar(&f.microVMMemory, "microvm-memory", process.DefaultMicroVMMemoryMiB, "memory of each microVM in MiB")
+	fs.StringVar(&f.microVMBootArgs, "microvm-boot-args", "", "extra kernel boot arguments of each microVM")
+	fs.BoolVar(&f.workspace, "workspace", false, "create a scratch directory per request/session, passed via env and the {workspace} arg placeholder, and remove it afterwards")
+	fs.StringVar(&f.workspaceDir, "workspace-dir", "", "directory to create scratch directories in (default: system temp dir)")
+	fs.StringVar(&f.workspaceEnv, "workspace-env", process.DefaultWorkspaceEnv, "environment variable receiving the scratch directory path")
+	fs.Int64Var(&f.workspaceMaxBytes, "workspace-max-bytes", 0, "kill the process when its scratch directory grows beyond this many bytes (0 for no limit)")
+	fs.StringVar(&f.secrets, "secrets", "", "JSON file with dynamic secrets (provider, path, env) issued per process, renewed while it runs and revoked when it exits")
+	fs.StringVar(&f.secretRotation, "secret-rotation", process.RotationReplace, "what to do with persistent processes whose secrets are about to expire: replace (restart with new secrets and replay initialize), close (end the session) or none")
+	fs.DurationVar(&f.secretCacheTTL, "secret-cache-ttl", 0, "re-read vault:, aws-sm:, aws-ssm: and gcp-sm: references without a lease (KV, AWS, Google Cloud) in the background at this interval (0 re-reads them only on config reload)")
+	fs.BoolVar(&f.egressProxy, "egress-proxy", false, "run the stdio processes in a network namespace that can only reach a proxy relaying to hosts in --egress-proxy-allow (Linux only)")
+	fs.Var(&f.egressProxyAllow, "egress-proxy-allow", "host the egress proxy relays to: host, host:port or *.domain (repeatable)")
+	fs.BoolVar(&f.fileStaging, "file-staging", false, "accept file uploads at /mcp/files and pass them to processes referenced by the X-Mcp-Files header")
+	fs.StringVar(&f.fileStagingDir, "file-staging-dir", "", "directory to store uploaded files in (default: system temp dir)")
+	fs.DurationVar(&f.fileStagingTTL, "file-staging-ttl", proxy.DefaultStagedFileTTL, "how long uploaded files are kept")
+	fs.Int64Var(&f.fileStagingMaxBytes, "file-staging-max-bytes", proxy.DefaultStagedFileMaxBytes, "maximum size of an uploaded file in bytes")
+	fs.Uint64Var(&f.scriptMaxSteps, "script-max-steps", script.DefaultMaxSteps, "max execution steps of a script per request")
+	fs.DurationVar(&f.scriptTimeout, "script-timeout", script.DefaultTimeout, "max execution time of a script per request")
+	fs.Uint64Var(&f.scriptMaxMemory, "script-max-memory", 0, "best-effort max heap growth in bytes while a script runs, measured on the whole process so concurrent requests count too (0 to disable)")
+	fs.StringVar(&f.mappingRules, "mapping-rules", "", "JSON file with conditional header mappings (applied only when headers, JWT claims or the path match)")
+	fs.Var(&f.stripHeaders, "strip-header", "strip inbound request headers matching a name or a prefix ending with * (e.g. X-Internal-*) before authentication and mapping (repeatable)")
+	fs.Var(&f.headerDecodings, "header-decode", "decode a mapped header value HEADER-NAME=percent|base64|base64url (repeatable)")
+	fs.Var(&f.headerTemplates, "header-template", "transform a mapped header value before mapping HEADER-NAME='{{.Value | trimPrefix \"Bearer \"}}' (repeatable)")
+	fs.IntVar(&f.maxHeaderValueBytes, "max-header-value-bytes", proxy.DefaultMaxHeaderValueBytes, "max bytes of a single mapped header value (negative for no limit)")
+	fs.IntVar(&f.maxInjectedBytes, "max-injected-bytes", proxy.DefaultMaxInjectedBytes, "max total bytes of env vars and args injected from headers (negative for no limit)")
+	fs.StringVar(&f.host, "host", "", "listen host (default: $HOST or 0.0.0.0)")
+	fs.IntVar(&f.port, "port", 8080, "listen port (default: 8080)")
+	fs.IntVar(&f.grpcPort, "grpc-port", 0, "gRPC listen port (0 disables the gRPC frontend)")
+	fs.IntVar(&f.tcpPort, "tcp-port", 0, "raw TCP listen port for newline-delimited JSON-RPC (0 disables it)")
+	fs.DurationVar(&f.readTimeout, "read-timeout", proxy.ReadTimeout, "max time to read an HTTP request")
+	fs.DurationVar(&f.writeTimeout, "write-timeout", proxy.WriteTimeout, "max time to write an HTTP response (streams clear it)")
+	fs.IntVar(&f.maxMessageSize, "max-message-size", process.DefaultMaxMessageSize, "max bytes of a single JSON-RPC message read from stdout")
+	fs.IntVar(&f.maxResponseBytes, "max-response-bytes", 0, "max bytes of a single message returned to clients after offloading (0 for no limit)")
+	fs.StringVar(&f.responseLimitPolicy, "response-limit-policy", proxy.ResponseLimitError, "what to do with a response over --max-response-bytes: error or truncate (tool results only, falls back to error)")
+	fs.Var(&f.metaHeaders, "meta-header", "return a _meta value of results as a response header X-Mcp-NAME=META_KEY (repeatable)")
+	fs.BoolVar(&f.serverMetaHeaders, "server-meta-headers", false, "return the X-Mcp-* response headers the server sets in the io.tumiki/headers _meta field of results")
+	fs.StringVar(&f.compression, "backend-compression", "", "compress stdio messages exchanged with a backend that supports it (gzip)")
+	fs.StringVar(&f.framing, "stdio-framing", process.FramingNewline, "how stdio messages are delimited: newline, content-length, or auto (probe each server once and cache the result)")
+	fs.IntVar(&f.blobThreshold, "blob-threshold", 0, "offload base64 blobs larger than this many bytes to /mcp/blobs/{id} (0 disables)")
+	fs.DurationVar(&f.blobTTL, "blob-ttl", proxy.DefaultBlobTTL, "how long offloaded blobs stay downloadable")
+	fs.IntVar(&f.downloadThreshold, "download-threshold", 0, "replace resources/read contents larger than this many bytes with a signed /download URL (0 to disable)")
+	fs.Var(&f.requestLabels, "request-label", "label key accepted in the X-Mcp-Labels header and recorded in logs, metrics and usage (repeatable)")
+	fs.DurationVar(&f.downloadTTL, "download-ttl", proxy.DefaultDownloadTTL, "how long signed /download URLs stay valid")
+	fs.StringVar(&f.offloadStore, "offload-store", "", "object storage for exchanging large payloads by reference (e.g., s3://bucket/prefix, gs://bucket/prefix)")
+	fs.IntVar(&f.offloadThreshold, "offload-threshold", proxy.DefaultOffloadThreshold, "offload response blobs larger than this many bytes for clients sending X-Mcp-Offload")
+	fs.StringVar(&f.requestPayload, "request-payload", "off", "UTF-8 handling of request bodies (off/validate/sanitize)")
+	fs.StringVar(&f.responsePayload, "response-payload", "off", "UTF-8 handling of server output (off/validate/sanitize)")
+	fs.StringVar(&f.transport, "transport", proxy.TransportStreamableHTTP, "MCP transport to serve: streamable-http (POST /mcp), sse (legacy GET /sse + POST /messages) or all")
+	fs.BoolVar(&f.webSocket, "websocket", false, "enable the WebSocket transport at /ws relaying newline-delimited JSON-RPC messages with a dedicated stdio process per connection")
+	fs.BoolVar(&f.longPoll, "long-poll", false, "enable the long-polling transport at /mcp/poll")
+	fs.DurationVar(&f.longPollTTL, "long-poll-ttl", proxy.DefaultPollSessionTTL, "how long an idle long-poll session is kept")
+	fs.BoolVar(&f.subscriptions, "subscriptions", false, "serve resources/subscribe on a persistent process and relay its notifications on GET /mcp")
+	fs.DurationVar(&f.subscriptionTTL, "subscription-ttl", proxy.DefaultSubscriptionTTL, "how long a subscription session without an open notification stream is kept")
+	fs.BoolVar(&f.sessions, "sessions", false, "start a persistent process on initialize and route POST /mcp with its Mcp-Session-Id to the same process")
+	fs.DurationVar(&f.sessionTTL, "session-ttl", proxy.DefaultSessionTTL, "how long an initialize session is kept after its last request")
+	fs.StringVar(&f.sessionOrdering, "session-ordering", proxy.SessionOrderingParallel, "order of requests within a session (parallel: send as they arrive / strict: send one at a time after the previous response)")
+	fs.DurationVar(&f.sessionMaxCPU, "session-max-cpu", 0, "terminate a session once its process has used this much CPU time (0 disables; not measured for containers and WASI)")
+	fs.IntVar(&f.sessionMaxCalls, "session-max-calls", 0, "terminate a session once this many requests have been sent to its process (0 disables)")
+	fs.Int64Var(&f.sessionMaxBytes, "session-max-bytes", 0, "terminate a session once this many request and response bytes have passed through it (0 disables)")
+	fs.DurationVar(&f.initTimeout, "initialize-timeout", proxy.DefaultInitializeTimeout, "max time from starting a session process to its initialize response; failures log diagnostics")
+	fs.IntVar(&f.sessionFallbackFailures, "session-fallback-failures", 0, "serve initialize with one-shot processes for a while after this many sessions of a backend fail within --session-fallback-window (0 disables)")
+	fs.DurationVar(&f.sessionFallbackWindow, "session-fallback-window", proxy.DefaultSessionFallbackWindow, "window in which session failures are counted for --session-fallback-failures")
+	fs.DurationVar(&f.sessionFallbackCooldown, "session-fallback-cooldown", proxy.DefaultSessionFallbackCooldown, "how long a backend serves initialize with one-shot processes before sessions are retried")
+	fs.DurationVar(&f.keepAliveInterval, "keep-alive-interval", 0, "interval of keep-alive pings to persistent backends and SSE keep-alive comments to idle streams (0 disables)")
+	fs.StringVar(&f.keepAliveMethod, "keep-alive-method", proxy.DefaultKeepAliveMethod, "JSON-RPC method sent to backends as keep-alive (notifications/* are sent as notifications)")
+	fs.BoolVar(&f.warmStandby, "warm-standby", false, "run requests on pre-started standby processes and fail over to another when a process dies")
+	fs.IntVar(&f.standbyMin, "standby-min", 1, "min number of standby processes kept running")
+	fs.IntVar(&f.standbyMax, "standby-max", 1, "max number of standby processes (scaled by queue depth when greater than --standby-min)")
+	fs.DurationVar(&f.standbyScaleInterval, "standby-scale-interval", process.DefaultScaleInterval, "how often the number of standby processes is adjusted")
+	fs.IntVar(&f.standbyCacheSize, "standby-cache-size", proxy.DefaultStandbyCacheSize, "max number of env/args combinations (derived from header mappings) that keep standby processes")
+	fs.IntVar(&f.poolSize, "pool-size", 0, "keep this many pre-started processes ready for requests (shorthand for --warm-standby with --standby-min and --standby-max set to N)")
+	fs.DurationVar(&f.poolMaxIdle, "pool-max-idle", 0, "restart pre-started processes that have idled longer than this (0 keeps them indefinitely)")
+	fs.BoolVar(&f.reuseProcesses, "reuse-processes", false, "run requests with the same env/args (after header mapping) on a shared long-lived process")
+	fs.DurationVar(&f.reuseTTL, "reuse-ttl", process.DefaultCacheTTL, "how long a reused process is kept after its last request")
+	fs.IntVar(&f.reuseMaxEntries, "reuse-max-entries", process.DefaultCacheMaxEntries, "max number of reused processes (the least recently used one is stopped when exceeded)")
+	fs.BoolVar(&f.sharedProcess, "shared-process", false, "serve all requests concurrently on one long-lived process, rewriting JSON-RPC ids (for stateless servers)")
+	fs.Var(&f.servers, "server", "named server served at /servers/NAME/mcp NAME='command args' (repeatable)")
+	fs.Var(&f.serverEnvVars, "server-env", "environment variable for a named server NAME:KEY=VALUE (repeatable)")
+	fs.Var(&f.serverRequiredEnv, "server-require-env", "environment variable a named server needs NAME:KEY, like --require-env (repeatable)")
+	fs.Var(&f.serverHeaderEnv, "server-header-env", "header to env mapping for a named server NAME:HEADER-NAME=ENV_VAR (repeatable)")
+	fs.Var(&f.serverHeaderArg, "server-header-arg", "header to arg mapping for a named server NAME:HEADER-NAME=arg-name (repeatable)")
+	fs.BoolVar(&f.metrics, "metrics", false, "expose Prometheus metrics at GET /metrics")
+	fs.BoolVar(&f.accessLog, "access-log", false, "log the JSON-RPC method, result and duration of each MCP request")
+	fs.DurationVar(&f.slowTool, "slow-tool-threshold", 0, "log a warning with the tool name for tools/call requests taking at least this long (0 to disable)")
+	fs.StringVar(&f.shutdownReport, "shutdown-report", "", "also write the shutdown report (requests served, sessions closed, processes killed, drain duration, errors) to this file as JSON")
+	fs.StringVar(&f.apiKeyDB, "api-key-db", "", "bbolt database of API keys required on the MCP endpoints (keys are managed via the admin API)")
+	fs.StringVar(&f.requestSigningKey, "request-signing-key", os.Getenv("TUMIKI_REQUEST_SIGNING_KEY"), "shared key requiring HMAC-signed requests with a fresh timestamp and unused nonce on the MCP endpoints (default: $TUMIKI_REQUEST_SIGNING_KEY)")
+	fs.DurationVar(&f.signatureMaxSkew, "signature-max-skew", proxy.DefaultSignatureMaxSkew, "max difference between the signature timestamp and the time a signed request is received")
+	fs.IntVar(&f.nonceCacheSize, "nonce-cache-size", proxy.DefaultNonceCacheSize, "max number of used nonces remembered to reject replayed signed requests")
+	fs.BoolVar(&f.usage, "usage", false, "count calls and bytes per API key, server, method and tool and expose them at GET /admin/usage")
+	fs.StringVar(&f.usageExport, "usage-export", "", "append periodic usage reports to this file (implies --usage)")
+	fs.StringVar(&f.usageWebhook, "usage-webhook", "", "POST periodic usage reports to this URL (implies --usage)")
+	fs.StringVar(&f.usageFormat, "usage-format", usage.FormatJSON, "usage report format (csv/json)")
+	fs.DurationVar(&f.usageInterval, "usage-interval", usage.DefaultExportInterval, "how often usage reports are exported")
+	fs.StringVar(&f.sessionWebhook, "session-webhook", "", "POST session lifecycle events (created/expired/terminated/error) with tenant metadata to this URL")
+	fs.StringVar(&f.sessionWebhookSecret, "session-webhook-secret", os.Getenv("TUMIKI_SESSION_WEBHOOK_SECRET"), "key signing session webhook requests with HMAC-SHA256 (default: $TUMIKI_SESSION_WEBHOOK_SECRET)")
+	fs.Var(&f.sessionWebhookEvents, "session-webhook-event", "session event sent to --session-webhook, e.g. session.created (repeatable, default: all)")
+	fs.StringVar(&f.registryURL, "registry-url", "", "register this adapter's endpoint and servers with an MCP registry at this URL on startup and keep it alive with heartbeats (requires --advertise-url)")
+	fs.StringVar(&f.registryToken, "registry-token", os.Getenv("TUMIKI_REGISTRY_TOKEN"), "bearer token sent to --registry-url (default: $TUMIKI_REGISTRY_TOKEN)")
+	fs.DurationVar(&f.registryInterval, "registry-interval", proxy.DefaultRegistryInterval, "how often heartbeats are sent to --registry-url")
+	fs.StringVar(&f.weightPublish, "weight-publish", "", "publish this instance's health and load-balancing weight, lowered as backend failures rise: https://URL (JSON POST), consul:SERVICE or route53:ZONE_ID/NAME (requires --advertise-url)")
+	fs.StringVar(&f.weightToken, "weight-token", os.Getenv("TUMIKI_WEIGHT_TOKEN"), "bearer token sent to an http(s) --weight-publish URL (default: $TUMIKI_WEIGHT_TOKEN)")
+	fs.DurationVar(&f.weightInterval, "weight-interval", proxy.DefaultWeightInterval, "how often the weight is recalculated from backend failures and republished when it changes")
+	fs.IntVar(&f.weightMax, "weight-max", proxy.DefaultMaxWeight, "weight published while no backend failures are seen")
+	fs.StringVar(&f.adminToken, "admin-token", os.Getenv("TUMIKI_ADMIN_TOKEN"), "bearer token enabling the admin API at /admin/ (default: $TUMIKI_ADMIN_TOKEN)")
+	fs.BoolVar(&f.spiffe, "spiffe", false, "serve all listeners over mTLS with an X.509-SVID fetched from the SPIFFE Workload API")
+	fs.StringVar(&f.spiffeSocket, "spiffe-socket", os.Getenv(spiffe.SocketEnv), "SPIFFE Workload API address, e.g. unix:///run/spire/agent.sock (default: $"+spiffe.SocketEnv+")")
+	fs.Var(&f.spiffeAllow, "spiffe-allow", "SPIFFE ID pattern allowed to call the MCP endpoints, e.g. spiffe://example.org/ns/prod/sa/* (repeatable; default: any ID in the trust bundle)")
+	fs.Var(&f.spiffeAdminAllow, "spiffe-admin-allow", "SPIFFE ID pattern allowed to call the admin API in addition to the admin token (repeatable; default: any ID in the trust bundle)")
+	fs.StringVar(&f.auth, "auth", "", "comma-separated auth methods tried in order on the MCP endpoints: mtls, jwt, apikey (e.g. mtls,jwt,apikey)")
+	fs.StringVar(&f.jwtSecret, "jwt-secret", os.Getenv("TUMIKI_JWT_SECRET"), "shared secret verifying HS256 JWT bearer tokens for --auth jwt (default: $TUMIKI_JWT_SECRET)")
+	fs.StringVar(&f.jwtPublicKey, "jwt-public-key", "", "PEM public key or certificate verifying RS256/ES256 JWT bearer tokens for --auth jwt")
+	fs.StringVar(&f.jwtIssuer, "jwt-issuer", "", "required iss claim of JWT bearer tokens")
+	fs.StringVar(&f.jwtAudience, "jwt-audience", "", "required aud claim of JWT bearer tokens")
+	fs.StringVar(&f.jwtPrincipalClaim, "jwt-principal-claim", jwtauth.DefaultPrincipalClaim, "JWT claim used as the principal")
+	fs.Var(&f.anonymousMethods, "anonymous-method", "JSON-RPC method clients without credentials may call when --api-key-db or --auth is set, e.g. tools/list (repeatable)")
+	fs.StringVar(&f.tokenExchangeURL, "token-exchange-url", "", "OAuth token exchange (RFC 8693) endpoint that swaps the caller's token for a downstream token before it is mapped")
+	fs.StringVar(&f.tokenExchangeClientID, "token-exchange-client-id", "", "client ID used to authenticate to the token exchange endpoint")
+	fs.StringVar(&f.tokenExchangeClientSecret, "token-exchange-client-secret", os.Getenv("TUMIKI_TOKEN_EXCHANGE_CLIENT_SECRET"), "client secret used to authenticate to the token exchange endpoint (default: $TUMIKI_TOKEN_EXCHANGE_CLIENT_SECRET)")
+	fs.StringVar(&f.tokenExchangeAudience, "token-exchange-audience", "", "audience requested for the downstream token")
+	fs.StringVar(&f.tokenExchangeResource, "token-exchange-resource", "", "resource URI requested for the downstream token")
+	fs.Var(&f.tokenExchangeScopes, "token-exchange-scope", "scope requested for the downstream token (repeatable)")
+	fs.StringVar(&f.tokenExchangeHeader, "token-exchange-header", "Authorization", "header carrying the caller's token to exchange")
+	fs.StringVar(&f.sessionStore, "session-store", "", "shared session store for multiple replicas (e.g., redis://host:6379/0)")
+	fs.StringVar(&f.advertiseURL, "advertise-url", "", "base URL other replicas use to reach this one (required with --session-store)")
+	fs.StringVar(&f.leaderLock, "leader-lock", "", "run the backend on a single replica elected via this Redis lock (e.g., redis://host:6379/0)")
+	fs.StringVar(&f.leaderLockKey, "leader-lock-key", election.DefaultRedisKey, "Redis key of the leader lock")
+	fs.DurationVar(&f.leaderLockTTL, "leader-lock-ttl", election.DefaultTTL, "leader lock TTL (renewed every third of it)")
+	fs.StringVar(&f.followerMode, "follower-mode", proxy.FollowerProxy, "how non-leader replicas handle requests (proxy/not-ready)")
+	fs.Var(&f.peers, "peer", "base URL of a replica for affinity routing (repeatable; this replica is always included)")
+	fs.BoolVar(&f.cluster, "cluster", false, "share backend definitions and health with --peer nodes via gossip (requires --advertise-url and --admin-token)")
+	fs.DurationVar(&f.gossipInterval, "gossip-interval", proxy.DefaultGossipInterval, "how often cluster nodes exchange state")
+	fs.StringVar(&f.affinityHeader, "affinity-header", "", "route requests with the same value of this header (e.g., X-Tenant-Id) to the same replica")
+	fs.IntVar(&f.rateLimit, "rate-limit", 0, "max requests per client per window (0 disables rate limiting)")
+	fs.DurationVar(&f.rateLimitWindow, "rate-limit-window", ratelimit.DefaultWindow, "rate limit window")
+	fs.StringVar(&f.rateLimitStore, "rate-limit-store", "", "shared rate limit counters for all replicas (e.g., redis://host:6379/0; default: in-process)")
+	fs.StringVar(&f.rateLimitKeyHeader, "rate-limit-key-header", "", "header identifying the client for rate limiting (default: client IP)")
+	fs.StringVar(&f.rewriteConfig, "rewrite-config", "", "JSON file with request rewrite rules (rename methods, default params, drop fields)")
+	fs.StringVar(&f.transformConfig, "response-transform-config", "", "JSON file with response transforms (delete, truncate, set fields)")
+	fs.Var(&f.hideCapabilities, "hide-capability", "capability to hide from the initialize handshake, e.g. prompts, resources.subscribe or sampling (repeatable)")
+	fs.BoolVar(&f.discovery, "discovery", false, "serve a discovery document describing the servers, transports and auth requirements at GET /.well-known/mcp")
+	fs.StringVar(&f.discoveryName, "discovery-name", "", "name shown in the discovery document (default tumiki-mcp-http)")
+	fs.StringVar(&f.discoveryDescription, "discovery-description", "", "description shown in the discovery document")
+	fs.StringVar(&f.discoveryContactName, "discovery-contact-name", "", "contact name shown in the discovery document")
+	fs.StringVar(&f.discoveryContactEmail, "discovery-contact-email", "", "contact email shown in the discovery document")
+	fs.StringVar(&f.discoveryContactURL, "discovery-contact-url", "", "contact URL shown in the discovery document")
+	fs.StringVar(&f.cacheConfig, "cache-config", "", "JSON file with response cache rules (method, server, ttl, vary, bypassHeader)")
+	fs.IntVar(&f.cacheMaxEntries, "cache-max-entries", cache.DefaultMaxEntries, "max number of cached responses")
+	fs.DurationVar(&f.idempotencyTTL, "idempotency-ttl", proxy.DefaultIdempotencyTTL, "how long responses to Idempotency-Key requests are replayed to retries (negative disables deduplication)")
+	fs.BoolVar(&f.traceStdio, "trace-stdio", false, "log every raw frame written to stdin and read from stdout/stderr")
+	fs.StringVar(&f.traceStdioFormat, "trace-stdio-format", process.TraceFormatJSON, "trace frame format (json/hex)")
+	fs.IntVar(&f.traceStdioMaxBytes, "trace-stdio-max-bytes", process.DefaultTraceMaxBytes, "max bytes logged per traced frame")
+
+	// ログレベル
+	fs.StringVar(&f.logLevel, "log-level", "info", "log level (debug/info/warn/error)")
+}
+
+func buildConfigFromFlags(f cliFlags) *proxy.Config {
 	// stdioコマンドのパース
-	cmdParts := parseStdioCommand(stdioCmd)
+	cmdParts := parseStdioCommand(f.stdioCmd)
 	if len(cmdParts) == 0 {
 		log.Fatal("Error: No command specified")
 	}
 
-	// 環境変数のパース（--envフラグ）
-	envMap, err := parseKeyValuePairs(envVars, "environment variable")
-	if err != nil {
+	// ${NAME} や {{env "NAME"}} をプロキシの環境変数で展開
+	if err := interpolateConfig(cmdParts, nil); err != nil {
 		log.Fatal(err)
 	}
 
-	// ヘッダーマッピングのパース
-	headerEnvMap, err := parseKeyValuePairs(headerEnvMappings, "header-env mapping")
+	// 環境変数・ヘッダーマッピング・名前付きのサーバー（設定の再読み込みで置き換える項目）
+	reloadable, err := reloadableConfig(f)
 	if err != nil {
 		log.Fatal(err)
 	}
-	headerArgMap, err := parseKeyValuePairs(headerArgMappings, "header-arg mapping")
-	if err != nil {
+
+	headerDecoding := parseKeyValuePairs(f.headerDecodings)
+	headerTemplates := parseKeyValuePairs(f.headerTemplates)
+	argOverrides := parseKeyValuePairs(f.argOverrides)
+	argRemovals := parseKeyValuePairs(f.argRemovals)
+	metaHeaders := parseKeyValuePairs(f.metaHeaders)
+
+	if err := process.ValidateCompression(f.compression); err != nil {
+		log.Fatal(err)
+	}
+	if err := process.ValidateFraming(f.framing); err != nil {
+		log.Fatal(err)
+	}
+	if err := process.ValidateRuntime(f.containerRuntime); err != nil {
+		log.Fatal(err)
+	}
+	if err := proxy.ValidateTransport(f.transport); err != nil {
+		log.Fatal(err)
+	}
+	if err := proxy.ValidateSessionOrdering(f.sessionOrdering); err != nil {
 		log.Fatal(err)
 	}
 
 	cfg := &proxy.Config{
-		Port:             port,
+		Host:             f.host,
+		Port:             f.port,
+		GRPCPort:         f.grpcPort,
+		TCPPort:          f.tcpPort,
+		ReadTimeout:      f.readTimeout,
+		WriteTimeout:     f.writeTimeout,
 		Command:          cmdParts[0],
 		Args:             cmdParts[1:],
-		DefaultEnv:       envMap,
-		HeaderEnvMapping: headerEnvMap,
-		HeaderArgMapping: headerArgMap,
+		DefaultEnv:       reloadable.DefaultEnv,
+		RequiredEnv:      f.requiredEnv,
+		HeaderEnvMapping: reloadable.HeaderEnvMapping,
+		HeaderArgMapping: reloadable.HeaderArgMapping,
+		HeaderDecoding:   headerDecoding,
+		HeaderTemplates:  headerTemplates,
+		Servers:          reloadable.Servers,
+		MaxMessageSize:   f.maxMessageSize,
+		Compression:      f.compression,
+		Framing:          f.framing,
+		Runtime:          f.containerRuntime,
+		ContainerOptions: f.containerOptions,
+		MicroVM:          microVMConfig(f),
+
+		EgressProxy:      f.egressProxy,
+		EgressProxyAllow: f.egressProxyAllow,
+
+		BlobThreshold: f.blobThreshold,
+		BlobTTL:       f.blobTTL,
+
+		DownloadThreshold: f.downloadThreshold,
+		DownloadTTL:       f.downloadTTL,
+
+		MaxResponseBytes:    f.maxResponseBytes,
+		ResponseLimitPolicy: f.responseLimitPolicy,
+
+		MetaHeaders:       metaHeaders,
+		ServerMetaHeaders: f.serverMetaHeaders,
+
+		OffloadThreshold: f.offloadThreshold,
+
+		FileStaging:         f.fileStaging,
+		FileStagingDir:      f.fileStagingDir,
+		FileStagingTTL:      f.fileStagingTTL,
+		FileStagingMaxBytes: f.fileStagingMaxBytes,
+
+		Transport: f.transport,
+		WebSocket: f.webSocket,
+
+		LongPoll:          f.longPoll,
+		PollSessionTTL:    f.longPollTTL,
+		Subscriptions:     f.subscriptions,
+		SubscriptionTTL:   f.subscriptionTTL,
+		Sessions:          f.sessions,
+		SessionTTL:        f.sessionTTL,
+		SessionOrdering:   f.sessionOrdering,
+		InitializeTimeout: f.initTimeout,
+		Metrics:           f.metrics,
+		AccessLog:         f.accessLog,
+		SlowToolThreshold: f.slowTool,
+		RequestLabels:     f.requestLabels,
+		AdminToken:        f.adminToken,
+
+		KeepAliveInterval: f.keepAliveInterval,
+		KeepAliveMethod:   f.keepAliveMethod,
+
+		SharedProcess: f.sharedProcess,
+
+		HeaderArgOverride: argOverrides,
+		HeaderArgRemoval:  argRemovals,
+
+		MaxHeaderValueBytes: f.maxHeaderValueBytes,
+		MaxInjectedBytes:    f.maxInjectedBytes,
+
+		IdempotencyTTL: f.idempotencyTTL,
+
+		ShutdownReportPath: f.shutdownReport,
+	}
+
+	if cfg.RequestPayload, err = sanitize.ParsePolicy(f.requestPayload); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.ResponsePayload, err = sanitize.ParsePolicy(f.responsePayload); err != nil {
+		log.Fatal(err)
+	}
+
+	if f.poolSize > 0 {
+		if f.warmStandby {
+			log.Fatal("--pool-size cannot be combined with --warm-standby (use --standby-min and --standby-max instead)")
+		}
+		f.warmStandby = true
+		f.standbyMin, f.standbyMax = f.poolSize, f.poolSize
+	}
+	if f.poolMaxIdle != 0 && !f.warmStandby {
+		log.Fatal("--pool-max-idle requires --pool-size or --warm-standby")
+	}
+	if f.warmStandby {
+		cfg.WarmStandby = &process.StandbyConfig{
+			Min:           f.standbyMin,
+			Max:           f.standbyMax,
+			ScaleInterval: f.standbyScaleInterval,
+			MaxIdle:       f.poolMaxIdle,
+		}
+		if err := process.ValidateStandbyConfig(*cfg.WarmStandby); err != nil {
+			log.Fatal(err)
+		}
+		cfg.StandbyCacheSize = f.standbyCacheSize
+	}
+
+	if f.reuseProcesses {
+		cfg.ProcessReuse = &process.CacheConfig{TTL: f.reuseTTL, MaxEntries: f.reuseMaxEntries}
+		if err := process.ValidateCacheConfig(*cfg.ProcessReuse); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if f.offloadStore != "" {
+		store, err := objectstore.NewS3(f.offloadStore)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.Offload = store
+	}
+
+	if f.sessionStore != "" {
+		if f.advertiseURL == "" {
+			log.Fatal("Error: --advertise-url is required when --session-store is set")
+		}
+		store, err := sessionstore.NewRedis(f.sessionStore)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.SessionStore = store
+		cfg.AdvertiseURL = strings.TrimSuffix(f.advertiseURL, "/")
+	}
+
+	if f.leaderLock != "" {
+		if f.advertiseURL == "" {
+			log.Fatal("Error: --advertise-url is required when --leader-lock is set")
+		}
+		if err := proxy.ValidateFollowerMode(f.followerMode); err != nil {
+			log.Fatal(err)
+		}
+		cfg.AdvertiseURL = strings.TrimSuffix(f.advertiseURL, "/")
+		lock, err := election.NewRedisLock(f.leaderLock, f.leaderLockKey, cfg.AdvertiseURL, f.leaderLockTTL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.LeaderLock = lock
+		cfg.LeaderLockTTL = f.leaderLockTTL
+		cfg.FollowerMode = f.followerMode
+	}
+
+	if f.affinityHeader != "" || f.cluster {
+		if f.advertiseURL == "" {
+			log.Fatal("Error: --advertise-url is required when --affinity-header or --cluster is set")
+		}
+		cfg.AdvertiseURL = strings.TrimSuffix(f.advertiseURL, "/")
+		cfg.AffinityHeader = f.affinityHeader
+		cfg.Peers = []string{cfg.AdvertiseURL}
+		for _, peer := range f.peers {
+			cfg.Peers = append(cfg.Peers, strings.TrimSuffix(peer, "/"))
+		}
+	}
+
+	if f.cluster {
+		if f.adminToken == "" {
+			log.Fatal("Error: --admin-token is required when --cluster is set")
+		}
+		cfg.Cluster = true
+		cfg.GossipInterval = f.gossipInterval
+	}
+
+	if f.apiKeyDB != "" {
+		store, err := apikey.Open(f.apiKeyDB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.APIKeys = store
+	}
+
+	if f.requestSigningKey != "" {
+		cfg.RequestSigningKey = []byte(f.requestSigningKey)
+		cfg.SignatureMaxSkew = f.signatureMaxSkew
+		cfg.NonceCacheSize = f.nonceCacheSize
+	}
+
+	cfg.Usage = f.usage
+	if f.usageExport != "" || f.usageWebhook != "" {
+		cfg.UsageExport = &usage.ExportConfig{
+			Interval:   f.usageInterval,
+			Format:     f.usageFormat,
+			Path:       f.usageExport,
+			WebhookURL: f.usageWebhook,
+		}
+	}
+
+	if f.sessionWebhook != "" {
+		cfg.SessionWebhook = &webhook.Config{
+			URL:    f.sessionWebhook,
+			Secret: []byte(f.sessionWebhookSecret),
+			Events: f.sessionWebhookEvents,
+		}
+	} else if f.sessionWebhookSecret != "" || len(f.sessionWebhookEvents) > 0 {
+		log.Fatal("--session-webhook-secret and --session-webhook-event require --session-webhook")
+	}
+
+	if f.sessionMaxCPU != 0 || f.sessionMaxCalls != 0 || f.sessionMaxBytes != 0 {
+		if !f.sessions && !f.subscriptions {
+			log.Fatal("--session-max-cpu, --session-max-calls and --session-max-bytes require --sessions or --subscriptions")
+		}
+		cfg.SessionBudget = &proxy.SessionBudget{
+			MaxCPU:   f.sessionMaxCPU,
+			MaxCalls: f.sessionMaxCalls,
+			MaxBytes: f.sessionMaxBytes,
+		}
+	}
+
+	if f.sessionFallbackFailures != 0 {
+		if !f.sessions {
+			log.Fatal("Error: --session-fallback-failures requires --sessions")
+		}
+		if f.sessionFallbackFailures < 0 {
+			log.Fatal("Error: --session-fallback-failures must not be negative")
+		}
+		cfg.SessionFallback = &proxy.SessionFallbackConfig{
+			Failures: f.sessionFallbackFailures,
+			Window:   f.sessionFallbackWindow,
+			Cooldown: f.sessionFallbackCooldown,
+		}
+	}
+
+	if f.registryURL != "" {
+		if f.advertiseURL == "" {
+			log.Fatal("Error: --advertise-url is required when --registry-url is set")
+		}
+		cfg.AdvertiseURL = strings.TrimSuffix(f.advertiseURL, "/")
+		cfg.Registry = &proxy.RegistryConfig{
+			URL:      f.registryURL,
+			Token:    f.registryToken,
+			Interval: f.registryInterval,
+		}
+	}
+
+	if f.weightPublish != "" {
+		if f.advertiseURL == "" {
+			log.Fatal("Error: --advertise-url is required when --weight-publish is set")
+		}
+		if f.weightMax <= 0 {
+			log.Fatal("Error: --weight-max must be positive")
+		}
+		publisher, err := weights.New(f.weightPublish, f.weightToken)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.AdvertiseURL = strings.TrimSuffix(f.advertiseURL, "/")
+		cfg.Weights = &proxy.WeightConfig{
+			Publisher: publisher,
+			Interval:  f.weightInterval,
+			MaxWeight: f.weightMax,
+		}
+	}
+
+	if f.rateLimit > 0 {
+		if f.rateLimitStore != "" {
+			limiter, err := ratelimit.NewRedis(f.rateLimitStore, f.rateLimit, f.rateLimitWindow)
+			if err != nil {
+				log.Fatal(err)
+			}
+			cfg.RateLimiter = limiter
+		} else {
+			cfg.RateLimiter = ratelimit.NewMemory(f.rateLimit, f.rateLimitWindow)
+		}
+		cfg.RateLimitKeyHeader = f.rateLimitKeyHeader
+	}
+
+	if f.mappingRules != "" {
+		rules, err := mapping.Load(f.mappingRules, f.jwtSecret != "" || f.jwtPublicKey != "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.MappingRules = rules
+	}
+	cfg.StripHeaders = f.stripHeaders
+
+	for _, path := range f.plugins {
+		p, err := plugin.Load(context.Background(), path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.Plugins = append(cfg.Plugins, p)
+	}
+
+	if f.spiffe {
+		allow, err := spiffe.NewMatcher(f.spiffeAllow)
+		if err != nil {
+			log.Fatal(err)
+		}
+		adminAllow, err := spiffe.NewMatcher(f.spiffeAdminAllow)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), spiffe.DefaultFetchTimeout)
+		source, err := spiffe.NewSource(ctx, f.spiffeSocket, slog.Default())
+		cancel()
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.SPIFFE = source
+		cfg.SPIFFEAllow = allow
+		cfg.SPIFFEAdminAllow = adminAllow
+	} else if len(f.spiffeAllow) > 0 || len(f.spiffeAdminAllow) > 0 {
+		log.Fatal("--spiffe-allow and --spiffe-admin-allow require --spiffe")
+	}
+
+	if f.auth != "" {
+		for _, method := range strings.Split(f.auth, ",") {
+			cfg.AuthMethods = append(cfg.AuthMethods, strings.TrimSpace(method))
+		}
+		if err := proxy.ValidateAuthMethods(cfg.AuthMethods); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if f.jwtSecret != "" || f.jwtPublicKey != "" {
+		if !slices.Contains(cfg.AuthMethods, proxy.AuthJWT) {
+			log.Fatal("--jwt-secret and --jwt-public-key require --auth with jwt")
+		}
+		verifier, err := jwtauth.NewVerifier(jwtauth.Config{
+			Secret:         []byte(f.jwtSecret),
+			PublicKeyFile:  f.jwtPublicKey,
+			Issuer:         f.jwtIssuer,
+			Audience:       f.jwtAudience,
+			PrincipalClaim: f.jwtPrincipalClaim,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.JWT = verifier
+	}
+	cfg.AnonymousMethods = f.anonymousMethods
+
+	if f.tokenExchangeURL != "" {
+		client, err := tokenexchange.New(tokenexchange.Config{
+			Endpoint:     f.tokenExchangeURL,
+			ClientID:     f.tokenExchangeClientID,
+			ClientSecret: f.tokenExchangeClientSecret,
+			Audience:     f.tokenExchangeAudience,
+			Resource:     f.tokenExchangeResource,
+			Scopes:       f.tokenExchangeScopes,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.TokenExchange = client
+		cfg.TokenExchangeHeader = f.tokenExchangeHeader
+	}
+
+	if f.workspace {
+		cfg.Workspace = &process.WorkspaceConfig{Dir: f.workspaceDir, Env: f.workspaceEnv, MaxBytes: f.workspaceMaxBytes}
+	}
+
+	cfg.SecretCacheTTL = f.secretCacheTTL
+	if f.secrets != "" {
+		specs, err := secrets.Load(f.secrets)
+		if err != nil {
+			log.Fatal(err)
+		}
+		manager, err := secrets.NewManager(specs, slog.Default())
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := process.ValidateRotation(f.secretRotation); err != nil {
+			log.Fatal(err)
+		}
+		cfg.Secrets = manager
+		cfg.SecretRotation = f.secretRotation
+	}
+
+	cfg.LauncherPrefetch = f.launcherPrefetch
+	if f.wasi {
+		wasiCfg := process.WASIConfig{Listeners: f.wasiListens}
+		for _, spec := range f.wasiMounts {
+			m, err := process.ParseMount(spec)
+			if err != nil {
+				log.Fatal(err)
+			}
+			wasiCfg.Mounts = append(wasiCfg.Mounts, m)
+		}
+		wasiRuntime, err := process.NewWASIRuntime(context.Background(), wasiCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.WASI = wasiRuntime
+	} else if len(f.wasiMounts) > 0 || len(f.wasiListens) > 0 {
+		log.Fatal("--wasi-mount and --wasi-listen require --wasi")
+	}
+
+	limits := script.Limits{MaxSteps: f.scriptMaxSteps, Timeout: f.scriptTimeout, MaxMemory: f.scriptMaxMemory}
+	for _, path := range f.scripts {
+		sc, err := script.Load(path, limits)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.Scripts = append(cfg.Scripts, sc)
+	}
+
+	if f.rewriteConfig != "" {
+		rules, err := rewrite.Load(f.rewriteConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.RequestRewrites = rules
+	}
+
+	if f.transformConfig != "" {
+		transforms, err := rewrite.LoadResponseTransforms(f.transformConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.ResponseTransforms = transforms
+	}
+	cfg.HideCapabilities = f.hideCapabilities
+	cfg.Discovery = f.discovery
+	cfg.ServerCard = proxy.ServerCard{
+		Name:        f.discoveryName,
+		Description: f.discoveryDescription,
+		Contact: proxy.Contact{
+			Name:  f.discoveryContactName,
+			Email: f.discoveryContactEmail,
+			URL:   f.discoveryContactURL,
+		},
+	}
+
+	if f.cacheConfig != "" {
+		rules, err := cache.Load(f.cacheConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.CacheRules = rules
+		cfg.CacheMaxEntries = f.cacheMaxEntries
+	}
+
+	if f.traceStdio {
+		cfg.Trace = &process.TraceConfig{
+			Format:   f.traceStdioFormat,
+			MaxBytes: f.traceStdioMaxBytes,
+		}
 	}
 
 	return cfg
@@ -155,25 +1077,102 @@ func parseStdioCommand(stdioCmd string) []string {
 	return parts
 }
 
-// parseKeyValuePairs は "KEY=VALUE" 形式の配列をマップに変換します。
-// valueType パラメータはエラーメッセージに使用されます（例: "environment variable", "mapping"）。
-func parseKeyValuePairs(pairs ArrayFlags, valueType string) (map[string]string, error) {
+// parseKeyValuePairs は "KEY=VALUE" 形式の配列をマップに変換します。'=' を含まない値は無視します。
+func parseKeyValuePairs(pairs ArrayFlags) map[string]string {
 	result := make(map[string]string)
 	for _, pair := range pairs {
-		parts := strings.SplitN(pair, "=", 2)
-		if len(parts) == 2 {
-			// 値に '=' が含まれているかチェック
-			if strings.Contains(parts[1], "=") {
-				return nil, fmt.Errorf("%s value cannot contain '=' character: %s\nValue: %s", valueType, pair, parts[1])
+		// 最初の '=' で分割し、残りは URL のクエリや base64 のパディングを含めてそのまま値とする
+		if key, value, ok := strings.Cut(pair, "="); ok {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// parseServerDefinitions は --server と、--server-env・--server-header-env・--server-header-arg の
+// "NAME:KEY=VALUE" 形式の値と --server-require-env の "NAME:KEY" 形式の値から名前付きのサーバーの設定を作成します。
+// コマンドと環境変数の値は --stdio・--env と同じようにプロキシの環境変数で展開します。
+func parseServerDefinitions(f cliFlags) (map[string]proxy.ServerDefinition, error) {
+	if len(f.servers) == 0 && (len(f.serverEnvVars) > 0 || len(f.serverRequiredEnv) > 0 || len(f.serverHeaderEnv) > 0 || len(f.serverHeaderArg) > 0) {
+		return nil, fmt.Errorf("--server-env, --server-require-env, --server-header-env and --server-header-arg require --server")
+	}
+	if len(f.servers) == 0 {
+		return nil, nil
+	}
+	servers := make(map[string]proxy.ServerDefinition, len(f.servers))
+	for _, value := range f.servers {
+		name, command, ok := strings.Cut(value, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid server %q: use NAME='command args'", value)
+		}
+		if err := proxy.ValidateServerName(name); err != nil {
+			return nil, err
+		}
+		if _, ok := servers[name]; ok {
+			return nil, fmt.Errorf("server %s is defined more than once", name)
+		}
+		cmdParts := parseStdioCommand(command)
+		if len(cmdParts) == 0 {
+			return nil, fmt.Errorf("server %s: no command specified", name)
+		}
+		if err := interpolateConfig(cmdParts, nil); err != nil {
+			return nil, err
+		}
+		servers[name] = proxy.ServerDefinition{
+			Command:          cmdParts[0],
+			Args:             cmdParts[1:],
+			DefaultEnv:       map[string]string{},
+			HeaderEnvMapping: map[string]string{},
+			HeaderArgMapping: map[string]string{},
+		}
+	}
+
+	for _, set := range []struct {
+		flag   string
+		values ArrayFlags
+		target func(proxy.ServerDefinition) map[string]string
+	}{
+		{"server-env", f.serverEnvVars, func(d proxy.ServerDefinition) map[string]string { return d.DefaultEnv }},
+		{"server-header-env", f.serverHeaderEnv, func(d proxy.ServerDefinition) map[string]string { return d.HeaderEnvMapping }},
+		{"server-header-arg", f.serverHeaderArg, func(d proxy.ServerDefinition) map[string]string { return d.HeaderArgMapping }},
+	} {
+		for _, value := range set.values {
+			name, pair, _ := strings.Cut(value, ":")
+			key, v, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid --%s %q: use NAME:KEY=VALUE", set.flag, value)
 			}
-			result[parts[0]] = parts[1]
+			def, found := servers[name]
+			if !found {
+				return nil, fmt.Errorf("--%s %q: server %s is not defined by --server", set.flag, value, name)
+			}
+			set.target(def)[key] = v
+		}
+	}
+
+	for _, value := range f.serverRequiredEnv {
+		name, key, ok := strings.Cut(value, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid --server-require-env %q: use NAME:KEY", value)
 		}
+		def, found := servers[name]
+		if !found {
+			return nil, fmt.Errorf("--server-require-env %q: server %s is not defined by --server", value, name)
+		}
+		def.RequiredEnv = append(def.RequiredEnv, key)
+		servers[name] = def
 	}
-	return result, nil
+
+	for _, def := range servers {
+		if err := interpolateConfig(nil, def.DefaultEnv); err != nil {
+			return nil, err
+		}
+	}
+	return servers, nil
 }
 
-func startServer(cfg *proxy.Config, logLevel string) {
-	logger := initLogger(logLevel)
+func startServer(cfg *proxy.Config, f cliFlags) {
+	logger := initLogger(f.logLevel)
 
 	proxyServer, err := proxy.NewServer(cfg, logger)
 	if err != nil {
@@ -191,6 +1190,49 @@ func startServer(cfg *proxy.Config, logLevel string) {
 		}
 	}()
 
+	if cfg.SessionStore != nil {
+		defer func() {
+			if err := cfg.SessionStore.Close(); err != nil {
+				logger.Debug("Failed to close session store", "error", err)
+			}
+		}()
+	}
+
+	if cfg.LeaderLock != nil {
+		defer func() {
+			if err := cfg.LeaderLock.Close(); err != nil {
+				logger.Debug("Failed to close leader lock", "error", err)
+			}
+		}()
+	}
+
+	if cfg.WASI != nil {
+		defer func() {
+			if err := cfg.WASI.Close(context.Background()); err != nil {
+				logger.Debug("Failed to close WASI runtime", "error", err)
+			}
+		}()
+	}
+
+	if cfg.SPIFFE != nil {
+		defer func() {
+			if err := cfg.SPIFFE.Close(); err != nil {
+				logger.Debug("Failed to close SPIFFE Workload API connection", "error", err)
+			}
+		}()
+	}
+
+	if cfg.RateLimiter != nil {
+		defer func() {
+			if err := cfg.RateLimiter.Close(); err != nil {
+				logger.Debug("Failed to close rate limiter", "error", err)
+			}
+		}()
+	}
+
+	// SIGHUP と --watch-config による設定の再読み込み
+	go newConfigReloader(proxyServer, logger, f, os.Args[1:]).run(ctx)
+
 	if err := proxyServer.Start(ctx); err != nil {
 		logger.Error("Server error", "error", err)
 		exitCode = 1
@@ -200,6 +1242,21 @@ func startServer(cfg *proxy.Config, logLevel string) {
 	logger.Info("Server stopped")
 }
 
+// microVMConfig は microVM のフラグから設定を作成します。カーネルとルートファイルシステムのどちらも指定しない場合は nil を返します。
+func microVMConfig(f cliFlags) *process.MicroVMConfig {
+	if f.microVMKernel == "" && f.microVMRootFS == "" {
+		return nil
+	}
+	return &process.MicroVMConfig{
+		Firecracker: f.firecracker,
+		Kernel:      f.microVMKernel,
+		RootFS:      f.microVMRootFS,
+		VCPUs:       f.microVMVCPUs,
+		MemoryMiB:   f.microVMMemory,
+		BootArgs:    f.microVMBootArgs,
+	}
+}
+
 func initLogger(logLevel string) *slog.Logger {
 	var level slog.Level
 	switch strings.ToLower(logLevel) {
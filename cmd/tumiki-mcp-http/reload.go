@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/proxy"
+)
+
+// configWatchInterval は --watch-config で設定ファイルの変更を確認する間隔です。
+const configWatchInterval = 2 * time.Second
+
+// reloadableConfig は --env・--env-file・--header-env・--header-arg・--server などから、
+// 設定の再読み込みで置き換える項目（デフォルト環境変数・ヘッダーマッピング・名前付きのサーバー）の proxy.Config を作成します。
+func reloadableConfig(f cliFlags) (*proxy.Config, error) {
+	envMap := parseKeyValuePairs(f.envVars)
+	// ${NAME} や {{env "NAME"}} をプロキシの環境変数で展開
+	if err := interpolateConfig(nil, envMap); err != nil {
+		return nil, err
+	}
+	// --env-file の値は展開せず、--env で指定した値を優先する
+	if len(f.envFiles) > 0 {
+		fileEnv, err := loadEnvFiles(f.envFiles)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(fileEnv, envMap)
+		envMap = fileEnv
+	}
+	headerEnvMap := parseKeyValuePairs(f.headerEnvMappings)
+	headerArgMap := parseKeyValuePairs(f.headerArgMappings)
+	servers, err := parseServerDefinitions(f)
+	if err != nil {
+		return nil, err
+	}
+	return &proxy.Config{
+		DefaultEnv:       envMap,
+		HeaderEnvMapping: headerEnvMap,
+		HeaderArgMapping: headerArgMap,
+		Servers:          servers,
+	}, nil
+}
+
+// reloadableFlags は再読み込みで値を置き換えるフラグと、読み直す設定ファイルを指定するフラグです。
+// その他のフラグの変更は再起動するまで適用しません。
+var reloadableFlags = map[string]bool{
+	"config":            true,
+	"mcp-config":        true,
+	"watch-config":      true,
+	"env":               true,
+	"env-file":          true,
+	"header-env":        true,
+	"header-arg":        true,
+	"server":            true,
+	"server-env":        true,
+	"server-header-env": true,
+	"server-header-arg": true,
+}
+
+// loadReloadableConfig はコマンドライン引数と設定ファイルを読み直し、再読み込みで置き換える項目の proxy.Config を作成します。
+func loadReloadableConfig(args []string) (*proxy.Config, error) {
+	cfg, _, err := loadReloadConfig(args)
+	return cfg, err
+}
+
+// loadReloadConfig は loadReloadableConfig と同じ proxy.Config と、再読み込みで置き換えないフラグの値（restartFlags）を返します。
+func loadReloadConfig(args []string) (*proxy.Config, map[string]string, error) {
+	fs := flag.NewFlagSet("reload", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var f cliFlags
+	defineFlags(fs, &f)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if err := applyConfigSources(fs, &f); err != nil {
+		return nil, nil, err
+	}
+	cfg, err := reloadableConfig(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, restartFlags(fs), nil
+}
+
+// restartFlags は再読み込みで置き換えないフラグの名前と、コマンドラインと設定ファイルを反映した値を返します。
+func restartFlags(fs *flag.FlagSet) map[string]string {
+	values := make(map[string]string)
+	fs.VisitAll(func(fl *flag.Flag) {
+		if !reloadableFlags[fl.Name] {
+			values[fl.Name] = fl.Value.String()
+		}
+	})
+	return values
+}
+
+// changedFlags は before と after で値が異なるフラグの名前を名前の順に返します。
+func changedFlags(before, after map[string]string) []string {
+	var changed []string
+	for name, value := range after {
+		if before[name] != value {
+			changed = append(changed, name)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// configReloader は SIGHUP と設定ファイルの変更で、サーバーの定義を読み直した設定に置き換えます。
+// HTTP サーバーは止めず、処理中のリクエストは元の定義のまま完了します。
+type configReloader struct {
+	server   *proxy.Server
+	logger   *slog.Logger
+	args     []string      // 起動時のコマンドライン引数
+	files    []string      // 変更を監視する設定ファイル・--env-file・値を読み込むファイル（空で監視しない）
+	interval time.Duration // 設定ファイルの変更を確認する間隔
+	stamps   map[string]string
+	flags    map[string]string // 起動時の再読み込みで置き換えないフラグの値（restartFlags）
+}
+
+// newConfigReloader は configReloader を作成します。
+// --watch-config を指定した場合は設定ファイル・--env-file・"@/path" で値を読み込むファイルの変更を監視します。
+func newConfigReloader(server *proxy.Server, logger *slog.Logger, f cliFlags, args []string) *configReloader {
+	r := &configReloader{server: server, logger: logger, args: args, interval: configWatchInterval}
+	if f.watchConfig {
+		for _, path := range []string{f.configFile, f.mcpConfig} {
+			if path != "" {
+				r.files = append(r.files, path)
+			}
+		}
+		r.files = append(r.files, f.envFiles...)
+		r.files = append(r.files, referencedFiles(f)...)
+	}
+	r.stamps = r.fileStamps()
+	// 起動時と同じ引数と設定ファイルのため、読み込みには失敗しない
+	_, r.flags, _ = loadReloadConfig(args)
+	return r
+}
+
+// run は ctx が終了するまで SIGHUP と設定ファイルの変更を待ち、設定を再読み込みします。
+func (r *configReloader) run(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var tick <-chan time.Time
+	if len(r.files) > 0 {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			r.stamps = r.fileStamps()
+			r.reload("SIGHUP")
+		case <-tick:
+			stamps := r.fileStamps()
+			if !maps.Equal(stamps, r.stamps) {
+				r.stamps = stamps
+				r.reload("config file changed")
+			}
+		}
+	}
+}
+
+// reload は設定を読み直してサーバーの定義を置き換え、変わった項目をログに出力します。
+// 失敗した場合はログに出力し、元の定義を使い続けます。再起動するまで適用しないフラグが変わった場合は警告します。
+func (r *configReloader) reload(reason string) {
+	cfg, flags, err := loadReloadConfig(r.args)
+	if err == nil {
+		_, err = r.server.Reload(cfg)
+	}
+	if err != nil {
+		r.logger.Error("Failed to reload configuration; keeping the current definitions", "reason", reason, "error", err)
+		return
+	}
+	r.logger.Info("Configuration reloaded", "reason", reason)
+	if changed := changedFlags(r.flags, flags); len(changed) > 0 {
+		r.logger.Warn("Configuration changes that require a restart were not applied", "flags", changed)
+	}
+}
+
+// fileStamps は監視する設定ファイルごとの更新時刻と大きさを返します。読み取れないファイルはエラーの内容を記録します。
+func (r *configReloader) fileStamps() map[string]string {
+	stamps := make(map[string]string, len(r.files))
+	for _, path := range r.files {
+		info, err := os.Stat(path)
+		if err != nil {
+			stamps[path] = err.Error()
+			continue
+		}
+		stamps[path] = fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+	}
+	return stamps
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/proxy"
+)
+
+func TestLoadReloadableConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	_ = os.WriteFile(path, []byte(`
+stdio:
+  command: my-server
+  env: {LOG_LEVEL: debug}
+  headerEnv: {X-Token: TOKEN}
+servers:
+  github:
+    command: npx -y server-github
+    env: {GITHUB_HOST: github.com}
+`), 0o600)
+
+	cfg, err := loadReloadableConfig([]string{"--config", path, "--env", "A=1", "--header-arg", "X-Team=team"})
+	if err != nil {
+		t.Fatalf("loadReloadableConfig() error = %v", err)
+	}
+	// コマンドラインで指定したオプションは設定ファイルより優先する
+	if cfg.DefaultEnv["A"] != "1" || cfg.DefaultEnv["LOG_LEVEL"] != "" {
+		t.Errorf("DefaultEnv = %v, want only A=1", cfg.DefaultEnv)
+	}
+	if cfg.HeaderEnvMapping["X-Token"] != "TOKEN" || cfg.HeaderArgMapping["X-Team"] != "team" {
+		t.Errorf("mappings = %v, %v", cfg.HeaderEnvMapping, cfg.HeaderArgMapping)
+	}
+	if def := cfg.Servers["github"]; def.Command != "npx" || def.DefaultEnv["GITHUB_HOST"] != "github.com" {
+		t.Errorf("Servers = %+v", cfg.Servers)
+	}
+
+	_ = os.WriteFile(path, []byte("server:\n  hostname: a\n"), 0o600)
+	if _, err := loadReloadableConfig([]string{"--config", path}); err == nil {
+		t.Error("loadReloadableConfig() of an invalid file error = nil")
+	}
+}
+
+func TestLoadReloadConfig_RestartFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	_ = os.WriteFile(path, []byte("server:\n  port: 8080\nstdio:\n  command: cat\n  env: {A: \"1\"}\n"), 0o600)
+	args := []string{"--config", path, "--read-timeout", "10s"}
+	_, before, err := loadReloadConfig(args)
+	if err != nil {
+		t.Fatalf("loadReloadConfig() error = %v", err)
+	}
+
+	// 再読み込みで置き換える項目の変更は再起動が必要なフラグに含めない
+	_ = os.WriteFile(path, []byte("server:\n  port: 9090\nstdio:\n  command: cat\n  env: {A: \"2\"}\n"), 0o600)
+	_, after, err := loadReloadConfig(args)
+	if err != nil {
+		t.Fatalf("loadReloadConfig() error = %v", err)
+	}
+	if got := changedFlags(before, after); !slices.Equal(got, []string{"port"}) {
+		t.Errorf("changedFlags() = %v, want [port]", got)
+	}
+	if got := changedFlags(before, before); len(got) != 0 {
+		t.Errorf("changedFlags() of the same values = %v, want none", got)
+	}
+}
+
+func TestConfigReloader_WatchConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	_ = os.WriteFile(path, []byte("stdio:\n  command: cat\n"), 0o600)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server, err := proxy.NewServer(&proxy.Config{Command: "cat"}, logger)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	status := func() int {
+		req := httptest.NewRequest("POST", "/servers/echo/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		return w.Code
+	}
+
+	f := cliFlags{configFile: path, watchConfig: true}
+	reloader := newConfigReloader(server, logger, f, []string{"--config", path})
+	reloader.interval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.run(ctx)
+
+	// 不正な設定ファイルは読み込まず、元の定義を使い続ける
+	_ = os.WriteFile(path, []byte("servers:\n  echo: {}\n"), 0o600)
+	time.Sleep(50 * time.Millisecond)
+	if code := status(); code != http.StatusNotFound {
+		t.Fatalf("status after an invalid config = %d, want %d", code, http.StatusNotFound)
+	}
+
+	_ = os.WriteFile(path, []byte("stdio:\n  command: cat\nservers:\n  echo:\n    command: cat\n"), 0o600)
+	deadline := time.Now().Add(2 * time.Second)
+	for status() == http.StatusNotFound {
+		if time.Now().After(deadline) {
+			t.Fatal("the server added to the config file was not served")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// fileValuePrefix はデフォルト環境変数の値をファイルから読み込むことを表す接頭辞です（例: API_KEY=@/run/secrets/api_key）。
+// Docker・Kubernetes のシークレットのマウントを、値をコマンドライン引数に出さずに渡すために使います。
+const fileValuePrefix = "@"
+
+// fileReference は値がファイルの参照（"@" に続く絶対パスか、./・../ で始まる相対パス）の場合に、そのパスを返します。
+// npm のスコープ（"@scope/pkg"）のような値は参照として扱いません。
+func fileReference(value string) (string, bool) {
+	path, ok := strings.CutPrefix(value, fileValuePrefix)
+	if !ok || !(strings.HasPrefix(path, "/") || strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../")) {
+		return "", false
+	}
+	return path, true
+}
+
+// resolveFileValue はファイルの参照の値をファイルの内容に置き換えます。末尾の改行は取り除きます。
+// "@@" で始まる参照は、先頭の "@" を1つ取り除いたリテラルの値として返します（例: "@@/literal" → "@/literal"）。
+func resolveFileValue(key, value string) (string, error) {
+	if literal, ok := strings.CutPrefix(value, fileValuePrefix); ok {
+		if _, ok := fileReference(literal); ok {
+			return literal, nil
+		}
+	}
+	path, ok := fileReference(value)
+	if !ok {
+		return value, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("environment variable %s: %w", key, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// referencedFiles は --env と --server-env で値を読み込むファイルを返します。
+// --watch-config では、シークレットの入れ替えで更新されたファイルを読み直すために監視します。
+func referencedFiles(f cliFlags) []string {
+	var files []string
+	for _, pair := range append(append([]string{}, f.envVars...), f.serverEnvVars...) {
+		_, value, _ := strings.Cut(pair, "=")
+		expanded, err := interpolateEnv(value, os.LookupEnv)
+		if err != nil {
+			continue
+		}
+		if path, ok := fileReference(expanded); ok {
+			files = append(files, path)
+		}
+	}
+	return files
+}
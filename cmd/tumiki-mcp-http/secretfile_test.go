@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestResolveFileValue(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "api_key")
+	if err := os.WriteFile(secret, []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "絶対パス_ファイルの内容", value: "@" + secret, want: "s3cr3t"},
+		{name: "エスケープ_リテラル", value: "@@" + secret, want: "@" + secret},
+		{name: "npmのスコープ_そのまま", value: "@modelcontextprotocol/server-github", want: "@modelcontextprotocol/server-github"},
+		{name: "@のみ_そのまま", value: "@", want: "@"},
+		{name: "通常の値_そのまま", value: "value", want: "value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveFileValue("API_KEY", tt.value)
+			if err != nil {
+				t.Fatalf("resolveFileValue() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveFileValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := resolveFileValue("API_KEY", "@"+filepath.Join(dir, "missing")); err == nil || !strings.Contains(err.Error(), "API_KEY") {
+		t.Errorf("resolveFileValue() of a missing file error = %v, want an error naming the variable", err)
+	}
+}
+
+func TestLoadReloadableConfig_FileValues(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SECRETS_DIR", dir)
+	_ = os.WriteFile(filepath.Join(dir, "api_key"), []byte("from-file\r\n"), 0o600)
+	_ = os.WriteFile(filepath.Join(dir, "slack_token"), []byte("xoxb-file"), 0o600)
+
+	cfg, err := loadReloadableConfig([]string{
+		"--env", "API_KEY=@${SECRETS_DIR}/api_key",
+		"--server", "slack=npx -y server-slack",
+		"--server-env", "slack:SLACK_BOT_TOKEN=@" + filepath.Join(dir, "slack_token"),
+	})
+	if err != nil {
+		t.Fatalf("loadReloadableConfig() error = %v", err)
+	}
+	if got := cfg.DefaultEnv["API_KEY"]; got != "from-file" {
+		t.Errorf("API_KEY = %q, want the file content", got)
+	}
+	if got := cfg.Servers["slack"].DefaultEnv["SLACK_BOT_TOKEN"]; got != "xoxb-file" {
+		t.Errorf("SLACK_BOT_TOKEN = %q, want the file content", got)
+	}
+
+	// シークレットの入れ替えでファイルが更新されると、読み直した値を使う
+	_ = os.WriteFile(filepath.Join(dir, "api_key"), []byte("rotated"), 0o600)
+	if cfg, err = loadReloadableConfig([]string{"--env", "API_KEY=@${SECRETS_DIR}/api_key"}); err != nil || cfg.DefaultEnv["API_KEY"] != "rotated" {
+		t.Errorf("after rotation API_KEY = %q (error %v), want %q", cfg.DefaultEnv["API_KEY"], err, "rotated")
+	}
+}
+
+func TestReferencedFiles(t *testing.T) {
+	t.Setenv("SECRETS_DIR", "/run/secrets")
+	f := cliFlags{
+		envVars:       ArrayFlags{"API_KEY=@${SECRETS_DIR}/api_key", "PKG=@scope/pkg", "PLAIN=value", "BROKEN=@${UNSET_SECRETS_DIR}/x"},
+		serverEnvVars: ArrayFlags{"slack:TOKEN=@./slack_token"},
+	}
+	want := []string{"/run/secrets/api_key", "./slack_token"}
+	if got := referencedFiles(f); !slices.Equal(got, want) {
+		t.Errorf("referencedFiles() = %v, want %v", got, want)
+	}
+}
+
+func TestPrintConfig_FileValues(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "api_key")
+	_ = os.WriteFile(secret, []byte("file-secret"), 0o600)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var f cliFlags
+	defineFlags(fs, &f)
+	if err := fs.Parse([]string{"--stdio", "my-server", "--env", "VALUE=@" + secret, "--env", "LITERAL=@@/literal"}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := printConfig(&buf, fs, f); err != nil {
+		t.Fatalf("printConfig() error = %v", err)
+	}
+	out := buf.String()
+	// ファイルの内容ではなく、読み込み直せる参照のまま出力する
+	if strings.Contains(out, "file-secret") || !strings.Contains(out, "VALUE: '@"+secret+"'") || !strings.Contains(out, "LITERAL: '@@/literal'") {
+		t.Errorf("printConfig() = %s, want the file references", out)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// envNamePattern は環境変数の名前として受け付ける識別子です。
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validator は validate サブコマンドで見つけた問題を集めます。
+type validator struct {
+	problems []string
+}
+
+// addf は問題を1つ追加します。
+func (v *validator) addf(format string, args ...any) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// runValidate は validate サブコマンドを実行し、終了コードを返します。
+// サーバーと同じオプションと設定ファイルを読み込み、起動せずに問題を報告します。問題があれば 1 を返します。
+// 使用例: tumiki-mcp-http validate --config tumiki.yaml
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var f cliFlags
+	defineFlags(fs, &f)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	source := "command-line options"
+	switch {
+	case f.configFile != "":
+		source = f.configFile
+	case f.mcpConfig != "":
+		source = f.mcpConfig
+	}
+	_, _ = fmt.Fprintf(stdout, "Config validation report: %s\n\n", source)
+
+	var v validator
+	if err := applyConfigSources(fs, &f); err != nil {
+		v.addf("%v", err)
+	} else {
+		v.validate(f)
+	}
+
+	for _, problem := range v.problems {
+		_, _ = fmt.Fprintf(stdout, "  [FAIL] %s\n", problem)
+	}
+	if len(v.problems) > 0 {
+		_, _ = fmt.Fprintf(stdout, "\nSummary: %d problems found\n", len(v.problems))
+		return 1
+	}
+	_, _ = fmt.Fprintln(stdout, "  [PASS] no problems found")
+	return 0
+}
+
+// validate は読み込んだオプションのコマンド・ヘッダーマッピング・環境変数の名前を検証します。
+func (v *validator) validate(f cliFlags) {
+	// コンテナ・WASI・microVM ではコマンドがホストの PATH から探されないため確認しない
+	checkPath := f.containerRuntime == "" && !f.wasi
+
+	if f.stdioCmd == "" {
+		v.addf("stdio: no command specified (--stdio or stdio.command)")
+	} else {
+		cmdParts := parseStdioCommand(f.stdioCmd)
+		if err := interpolateConfig(cmdParts, nil); err != nil {
+			v.addf("stdio: %v", err)
+		} else if checkPath && len(cmdParts) > 0 {
+			v.checkCommand("stdio", cmdParts[0])
+		}
+	}
+
+	// 再読み込みと同じ手順で解析し、展開できない環境変数や名前付きのサーバーの誤りを見つける
+	cfg, err := reloadableConfig(f)
+	if err != nil {
+		v.addf("%v", err)
+	} else if checkPath {
+		for _, name := range slices.Sorted(maps.Keys(cfg.Servers)) {
+			v.checkCommand("server "+name, cfg.Servers[name].Command)
+		}
+	}
+
+	v.checkEnvNames("--env", keysOf(f.envVars))
+	v.checkEnvNames("--require-env", f.requiredEnv)
+	v.checkHeaderMapping("--header-env", f.headerEnvMappings, true)
+	v.checkHeaderMapping("--header-arg", f.headerArgMappings, false)
+
+	serverEnv, serverHeaderEnv, serverHeaderArg := byServer(f.serverEnvVars), byServer(f.serverHeaderEnv), byServer(f.serverHeaderArg)
+	for _, name := range slices.Sorted(maps.Keys(serverEnv)) {
+		v.checkEnvNames("--server-env "+name, keysOf(serverEnv[name]))
+	}
+	serverRequiredEnv := byServer(f.serverRequiredEnv)
+	for _, name := range slices.Sorted(maps.Keys(serverRequiredEnv)) {
+		v.checkEnvNames("--server-require-env "+name, serverRequiredEnv[name])
+	}
+	for _, name := range slices.Sorted(maps.Keys(serverHeaderEnv)) {
+		v.checkHeaderMapping("--server-header-env "+name, serverHeaderEnv[name], true)
+	}
+	for _, name := range slices.Sorted(maps.Keys(serverHeaderArg)) {
+		v.checkHeaderMapping("--server-header-arg "+name, serverHeaderArg[name], false)
+	}
+}
+
+// checkCommand はコマンドが PATH（パスを含む場合はそのファイル）に存在し、実行できることを確認します。
+func (v *validator) checkCommand(label, command string) {
+	if _, err := exec.LookPath(command); err != nil {
+		v.addf("%s: command %q not found on PATH", label, command)
+	}
+}
+
+// checkEnvNames は環境変数の名前が識別子として有効であることを確認します。
+func (v *validator) checkEnvNames(label string, names []string) {
+	for _, name := range names {
+		if !envNamePattern.MatchString(name) {
+			v.addf("%s: %q is not a valid environment variable name", label, name)
+		}
+	}
+}
+
+// checkHeaderMapping は同じヘッダー（大文字小文字を区別しない）が2回以上マッピングされていないことを確認します。
+// 後の値で上書きされ、どちらのマッピングが使われるかが分かりにくいためです。
+// envTarget が true の場合は、マッピング先の環境変数の名前も確認します。
+func (v *validator) checkHeaderMapping(label string, pairs []string, envTarget bool) {
+	headers := make(map[string]string)
+	for _, pair := range pairs {
+		header, target, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		key := http.CanonicalHeaderKey(strings.TrimSpace(header))
+		if first, ok := headers[key]; ok {
+			v.addf("%s: header %s is mapped more than once (%q and %q)", label, key, first, pair)
+		} else {
+			headers[key] = pair
+		}
+		if envTarget && !envNamePattern.MatchString(target) {
+			v.addf("%s: %q is not a valid environment variable name", label, target)
+		}
+	}
+}
+
+// keysOf は "KEY=VALUE" 形式の値のキーを返します。
+func keysOf(pairs []string) []string {
+	keys := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// byServer は "NAME:KEY=VALUE" 形式の値をサーバー名ごとの "KEY=VALUE" に分けます。
+func byServer(values []string) map[string][]string {
+	result := make(map[string][]string)
+	for _, value := range values {
+		name, pair, _ := strings.Cut(value, ":")
+		result[name] = append(result[name], pair)
+	}
+	return result
+}
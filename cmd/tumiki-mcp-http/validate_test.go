@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunValidate(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	valid := writeConfig("valid.yaml", `
+stdio:
+  command: cat
+  env: {API_TOKEN: x}
+  headerEnv: {X-Token: TOKEN}
+servers:
+  github:
+    command: sh
+    headerEnv: {X-Github-Token: GITHUB_TOKEN}
+`)
+	invalid := writeConfig("invalid.yaml", `
+stdio:
+  command: nonexistent-command-12345
+  env: {API-TOKEN: x}
+  headerEnv: {X-Token: TOKEN, x-token: OTHER, X-Team: 1TEAM}
+servers:
+  github:
+    command: nonexistent-command-67890
+`)
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout []string
+	}{
+		{
+			name:       "問題のない設定_終了コード0",
+			args:       []string{"--config", valid},
+			wantCode:   0,
+			wantStdout: []string{"Config validation report: " + valid, "[PASS] no problems found"},
+		},
+		{
+			name:     "問題のある設定_全て報告して終了コード1",
+			args:     []string{"--config", invalid},
+			wantCode: 1,
+			wantStdout: []string{
+				`stdio: command "nonexistent-command-12345" not found on PATH`,
+				`server github: command "nonexistent-command-67890" not found on PATH`,
+				`--env: "API-TOKEN" is not a valid environment variable name`,
+				`--header-env: header X-Token is mapped more than once`,
+				`--header-env: "1TEAM" is not a valid environment variable name`,
+				"Summary: 5 problems found",
+			},
+		},
+		{
+			name:       "コマンドラインのオプション_検証する",
+			args:       []string{"--stdio", "cat", "--require-env", "GITHUB TOKEN", "--server", "a=cat", "--server-header-arg", "a:X-Id=id", "--server-header-arg", "a:x-id=other"},
+			wantCode:   1,
+			wantStdout: []string{`--require-env: "GITHUB TOKEN"`, "--server-header-arg a: header X-Id is mapped more than once"},
+		},
+		{
+			name:       "コンテナで実行_PATHを確認しない",
+			args:       []string{"--stdio", "ghcr.io/example/server:latest", "--runtime", "docker"},
+			wantCode:   0,
+			wantStdout: []string{"[PASS]"},
+		},
+		{
+			name:       "stdio未指定_報告する",
+			args:       []string{},
+			wantCode:   1,
+			wantStdout: []string{"stdio: no command specified"},
+		},
+		{
+			name:       "存在しない設定ファイル_報告する",
+			args:       []string{"--config", filepath.Join(dir, "missing.yaml")},
+			wantCode:   1,
+			wantStdout: []string{"missing.yaml"},
+		},
+		{
+			name:     "不明なフラグ_終了コード2",
+			args:     []string{"--unknown"},
+			wantCode: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := runValidate(tt.args, &stdout, &stderr)
+			if code != tt.wantCode {
+				t.Errorf("runValidate() = %d, want %d (stdout: %s, stderr: %s)", code, tt.wantCode, stdout.String(), stderr.String())
+			}
+			for _, want := range tt.wantStdout {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("stdout should contain %q: got %s", want, stdout.String())
+				}
+			}
+		})
+	}
+}
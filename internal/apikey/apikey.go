@@ -0,0 +1,280 @@
+// Package apikey は外部の IdP なしでアダプターを保護するための API キーの保存と検証を提供します。
+//
+// キーは bbolt のファイルに保存し、キー自体は SHA-256 のハッシュだけを保持します。
+// 平文のキーは作成時に一度だけ返します。
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Prefix は発行するキーのプレフィックスです。
+const Prefix = "tmk_"
+
+// secretBytes はキーのランダム部分のバイト数です。
+const secretBytes = 32
+
+var (
+	bucketKeys   = []byte("keys")   // ID → Key の JSON
+	bucketHashes = []byte("hashes") // キーのハッシュ → ID
+)
+
+var (
+	// ErrNotFound は指定した ID のキーがないことを表します。
+	ErrNotFound = errors.New("api key not found")
+	// ErrInvalidKey はキーが存在しないか、失効していることを表します。
+	ErrInvalidKey = errors.New("invalid api key")
+)
+
+// Key は API キーのメタデータです。
+type Key struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name,omitempty"`
+	Tenant    string     `json:"tenant,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+
+	// AllowedServers はキーで利用できるサーバーです（空の場合は全て）。
+	// /mcp ではバックエンドのバージョン、/servers/{name}/mcp ではサーバー名と照合し、public-* のような path.Match のパターンも使えます。
+	AllowedServers []string `json:"allowedServers,omitempty"`
+	// RateLimit はキーごとの1分あたりのリクエスト数の上限です（0 で無制限）。
+	RateLimit int `json:"rateLimit,omitempty"`
+	// Env はキーで認証したリクエストのプロセスに設定する環境変数です（テナントの GITHUB_TOKEN など）。
+	// クライアントがプロバイダーのトークンをヘッダーで送らずに済むよう、キーごとの値をアダプターで保持します。
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// Revoked はキーが失効しているかどうかを返します。
+func (k Key) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// AllowsServer はキーでサーバー（名前付きのサーバーの名前またはバックエンドのバージョン）を利用できるかどうかを返します。
+func (k Key) AllowsServer(name string) bool {
+	return len(k.AllowedServers) == 0 || slices.ContainsFunc(k.AllowedServers, func(pattern string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	})
+}
+
+// ValidateAllowedServers は AllowedServers に指定されたサーバー名とパターンを検証します。
+func ValidateAllowedServers(patterns []string) error {
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return fmt.Errorf("allowed server must not be empty")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid allowed server pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// envNamePattern は環境変数の名前として受け付ける識別子です。
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateEnv は Env の環境変数の名前を検証します。
+func ValidateEnv(env map[string]string) error {
+	for name := range env {
+		if !envNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid environment variable name %q", name)
+		}
+	}
+	return nil
+}
+
+// Store は bbolt のファイルに API キーを保持します。複数のゴルーチンから同時に使用できます。
+type Store struct {
+	db  *bolt.DB
+	now func() time.Time
+}
+
+// Open は path のデータベースを開きます。ファイルがない場合は作成します。
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open api key store: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketKeys, bucketHashes} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("open api key store: %w", err)
+	}
+	return &Store{db: db, now: time.Now}, nil
+}
+
+// Close はデータベースを閉じます。
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Create はメタデータ meta で新しいキーを発行し、平文のキーと保存したメタデータを返します。
+// meta の ID・CreatedAt・RevokedAt は無視します。
+func (s *Store) Create(meta Key) (string, Key, error) {
+	id, err := randomString(9)
+	if err != nil {
+		return "", Key{}, err
+	}
+	secret, err := randomString(secretBytes)
+	if err != nil {
+		return "", Key{}, err
+	}
+	token := Prefix + secret
+
+	key := meta
+	key.ID = id
+	key.CreatedAt = s.now().UTC()
+	key.RevokedAt = nil
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", Key{}, err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketKeys).Put([]byte(id), data); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketHashes).Put(hash(token), []byte(id))
+	})
+	if err != nil {
+		return "", Key{}, fmt.Errorf("store api key: %w", err)
+	}
+	return token, key, nil
+}
+
+// Revoke はキーを失効させ、更新したメタデータを返します。失効済みの場合はそのまま返します。
+func (s *Store) Revoke(id string) (Key, error) {
+	var key Key
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		keys := tx.Bucket(bucketKeys)
+		data := keys.Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		if err := json.Unmarshal(data, &key); err != nil {
+			return err
+		}
+		if key.Revoked() {
+			return nil
+		}
+		now := s.now().UTC()
+		key.RevokedAt = &now
+		data, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		return keys.Put([]byte(id), data)
+	})
+	if err != nil {
+		return Key{}, err
+	}
+	return key, nil
+}
+
+// SetEnv はキーの Env を env に置き換え、更新したメタデータを返します。
+// キーを発行し直さずに、テナントのトークンのローテーションを反映するために使います。
+func (s *Store) SetEnv(id string, env map[string]string) (Key, error) {
+	var key Key
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		keys := tx.Bucket(bucketKeys)
+		data := keys.Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		if err := json.Unmarshal(data, &key); err != nil {
+			return err
+		}
+		key.Env = env
+		data, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		return keys.Put([]byte(id), data)
+	})
+	if err != nil {
+		return Key{}, err
+	}
+	return key, nil
+}
+
+// List は全てのキーのメタデータを作成日時の順に返します。
+func (s *Store) List() ([]Key, error) {
+	keys := []Key{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketKeys).ForEach(func(_, data []byte) error {
+			var key Key
+			if err := json.Unmarshal(data, &key); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(keys, func(a, b Key) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return keys, nil
+}
+
+// Authenticate は平文のキーを検証し、メタデータを返します。
+// キーが存在しないか失効している場合は ErrInvalidKey を返します。
+func (s *Store) Authenticate(token string) (Key, error) {
+	if !strings.HasPrefix(token, Prefix) {
+		return Key{}, ErrInvalidKey
+	}
+	var key Key
+	err := s.db.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket(bucketHashes).Get(hash(token))
+		if id == nil {
+			return ErrInvalidKey
+		}
+		data := tx.Bucket(bucketKeys).Get(id)
+		if data == nil {
+			return ErrInvalidKey
+		}
+		return json.Unmarshal(data, &key)
+	})
+	if err != nil {
+		return Key{}, err
+	}
+	if key.Revoked() {
+		return Key{}, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// hash はキーの SHA-256 ハッシュを16進数で返します。キーは十分なエントロピーを持つためソルトは使用しません。
+func hash(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return []byte(hex.EncodeToString(sum[:]))
+}
+
+// randomString は n バイトの乱数を base64url で返します。
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate api key: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,195 @@
+package apikey
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func openStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.db")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store, path
+}
+
+func TestStore_CreateAndAuthenticate(t *testing.T) {
+	store, _ := openStore(t)
+
+	token, key, err := store.Create(Key{Name: "ci", Tenant: "acme", AllowedServers: []string{"v2"}, RateLimit: 10})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if !strings.HasPrefix(token, Prefix) || key.ID == "" || key.CreatedAt.IsZero() {
+		t.Fatalf("Create() = %q, %+v", token, key)
+	}
+
+	got, err := store.Authenticate(token)
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, key) {
+		t.Errorf("Authenticate() = %+v, want %+v", got, key)
+	}
+
+	for _, invalid := range []string{"", "tmk_unknown", token + "x", strings.TrimPrefix(token, Prefix)} {
+		if _, err := store.Authenticate(invalid); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Authenticate(%q) error = %v, want ErrInvalidKey", invalid, err)
+		}
+	}
+}
+
+func TestStore_Revoke(t *testing.T) {
+	store, _ := openStore(t)
+
+	token, key, err := store.Create(Key{Name: "ci"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	revoked, err := store.Revoke(key.ID)
+	if err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if !revoked.Revoked() {
+		t.Errorf("Revoke() = %+v, want revoked", revoked)
+	}
+	if _, err := store.Authenticate(token); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Authenticate() error = %v, want ErrInvalidKey", err)
+	}
+	if _, err := store.Revoke("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Revoke() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStore_ListPersists(t *testing.T) {
+	store, path := openStore(t)
+
+	_, first, err := store.Create(Key{Name: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, second, err := store.Create(Key{Name: "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer reopened.Close()
+
+	keys, err := reopened.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(keys) != 2 || keys[0].ID != first.ID || keys[1].ID != second.ID {
+		t.Errorf("List() = %+v, want [%s %s]", keys, first.ID, second.ID)
+	}
+	if _, err := reopened.Authenticate(token); err != nil {
+		t.Errorf("Authenticate() after reopen error = %v", err)
+	}
+}
+
+func TestStore_SetEnv(t *testing.T) {
+	store, _ := openStore(t)
+
+	token, key, err := store.Create(Key{Name: "acme", Env: map[string]string{"GITHUB_TOKEN": "ghp_old"}})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	updated, err := store.SetEnv(key.ID, map[string]string{"GITHUB_TOKEN": "ghp_new", "SLACK_TOKEN": "xoxb"})
+	if err != nil {
+		t.Fatalf("SetEnv() error = %v", err)
+	}
+	if updated.Name != "acme" || updated.Env["GITHUB_TOKEN"] != "ghp_new" {
+		t.Errorf("SetEnv() = %+v", updated)
+	}
+
+	// キーを発行し直さずに、認証したリクエストで新しい値を使う
+	got, err := store.Authenticate(token)
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if !reflect.DeepEqual(got.Env, map[string]string{"GITHUB_TOKEN": "ghp_new", "SLACK_TOKEN": "xoxb"}) {
+		t.Errorf("Authenticate().Env = %v", got.Env)
+	}
+
+	if _, err := store.SetEnv("missing", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetEnv(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestKey_AllowsServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		version string
+		want    bool
+	}{
+		{name: "制限なし_全て許可", version: "v1", want: true},
+		{name: "一覧に含まれる_許可", allowed: []string{"v1", "v2"}, version: "v2", want: true},
+		{name: "一覧に含まれない_拒否", allowed: []string{"v1"}, version: "v2", want: false},
+		{name: "パターンに一致_許可", allowed: []string{"public-*"}, version: "public-docs", want: true},
+		{name: "パターンに一致しない_拒否", allowed: []string{"public-*"}, version: "payments", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Key{AllowedServers: tt.allowed}).AllowsServer(tt.version); got != tt.want {
+				t.Errorf("AllowsServer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAllowedServers(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		wantErr  bool
+	}{
+		{name: "名前とパターン_成功", patterns: []string{"default", "public-*"}},
+		{name: "空文字列_エラー", patterns: []string{""}, wantErr: true},
+		{name: "不正なパターン_エラー", patterns: []string{"public-["}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateAllowedServers(tt.patterns); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAllowedServers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{name: "環境変数の名前_成功", env: map[string]string{"GITHUB_TOKEN": "ghp", "_X1": ""}},
+		{name: "空の名前_エラー", env: map[string]string{"": "x"}, wantErr: true},
+		{name: "イコールを含む名前_エラー", env: map[string]string{"A=B": "x"}, wantErr: true},
+		{name: "数字で始まる名前_エラー", env: map[string]string{"1TOKEN": "x"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateEnv(tt.env); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+// Package cache は JSON-RPC のレスポンスを宣言的なルールでキャッシュする機能を提供します。
+//
+// ルールはメソッドとバックエンドのバージョンごとに保持期間・キーに含めるヘッダー・
+// キャッシュを迂回するヘッダーを指定します。tools/list のように結果が変わりにくい
+// 呼び出しのプロセス起動を省略するために使用します。
+package cache
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultMaxEntries はキャッシュに保持するレスポンスのデフォルトの最大数です。
+const DefaultMaxEntries = 1000
+
+// Rule は1件のキャッシュルールです。
+type Rule struct {
+	// Method は対象の JSON-RPC のメソッド名です（必須）。
+	Method string `json:"method"`
+	// Server は対象のバックエンドのバージョンです。空の場合は全てのバージョンが対象です。
+	Server string `json:"server,omitempty"`
+	// TTL はレスポンスを保持する期間です（例: "30s"）。
+	TTL string `json:"ttl"`
+	// Vary はキャッシュのキーに値を含めるヘッダー名です。
+	Vary []string `json:"vary,omitempty"`
+	// BypassHeader はこのヘッダーがあるリクエストでキャッシュを使用せず、結果を保存し直すヘッダー名です。
+	BypassHeader string `json:"bypassHeader,omitempty"`
+
+	ttl time.Duration
+}
+
+// Expiry はレスポンスを保持する期間を返します。
+func (r *Rule) Expiry() time.Duration {
+	return r.ttl
+}
+
+// Bypass はリクエストがキャッシュを迂回するかどうかを返します。
+func (r *Rule) Bypass(header http.Header) bool {
+	return r.BypassHeader != "" && header.Get(r.BypassHeader) != ""
+}
+
+// Rules はキャッシュルールの一覧です。先に一致したルールを使用します。
+type Rules []Rule
+
+// Load は JSON ファイルからキャッシュルールを読み込みます。
+func Load(path string) (Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read cache rules: %w", err)
+	}
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse cache rules %s: %w", path, err)
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Validate はルールの内容を検証し、保持期間の解析とヘッダー名の正規化を行います。
+func (r Rules) Validate() error {
+	for i := range r {
+		rule := &r[i]
+		if rule.Method == "" {
+			return fmt.Errorf("cache rule %d has no method", i)
+		}
+		ttl, err := time.ParseDuration(rule.TTL)
+		if err != nil {
+			return fmt.Errorf("cache rule %d has an invalid ttl: %w", i, err)
+		}
+		if ttl <= 0 {
+			return fmt.Errorf("cache rule %d must have a positive ttl", i)
+		}
+		rule.ttl = ttl
+		for j, name := range rule.Vary {
+			rule.Vary[j] = http.CanonicalHeaderKey(name)
+		}
+		rule.BypassHeader = http.CanonicalHeaderKey(rule.BypassHeader)
+	}
+	return nil
+}
+
+// Match はメソッドとバックエンドのバージョンに一致する最初のルールを返します。なければ nil を返します。
+func (r Rules) Match(method, server string) *Rule {
+	for i := range r {
+		rule := &r[i]
+		if rule.Method == method && (rule.Server == "" || rule.Server == server) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// Entry はキャッシュしたレスポンスです。
+type Entry struct {
+	Method string
+	Server string
+	Body   []byte
+
+	key     string
+	expires time.Time
+}
+
+// Store は有効期限付きのレスポンスを最大件数まで保持し、超えた場合は最も古く使われたものを破棄します。
+// 複数のゴルーチンから同時に使用できます。
+type Store struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]*list.Element
+	lru     *list.List
+	now     func() time.Time
+
+	// OnEvict は件数の上限でエントリを破棄した時に呼び出されます（nil の場合は何もしません）。
+	OnEvict func()
+}
+
+// NewStore は最大 maxEntries 件を保持する Store を作成します（0 以下でデフォルト）。
+func NewStore(maxEntries int) *Store {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	return &Store{
+		max:     maxEntries,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// Get はキーのレスポンスを返します。期限切れの場合は削除して false を返します。
+func (s *Store) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*Entry)
+	if !s.now().Before(entry.expires) {
+		s.remove(elem)
+		return nil, false
+	}
+	s.lru.MoveToFront(elem)
+	return entry.Body, true
+}
+
+// Set はレスポンスを ttl の間保持します。
+func (s *Store) Set(key string, entry Entry, ttl time.Duration) {
+	entry.key = key
+	entry.expires = s.now().Add(ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.entries[key]; ok {
+		elem.Value = &entry
+		s.lru.MoveToFront(elem)
+		return
+	}
+	s.entries[key] = s.lru.PushFront(&entry)
+	for s.lru.Len() > s.max {
+		s.remove(s.lru.Back())
+		if s.OnEvict != nil {
+			s.OnEvict()
+		}
+	}
+}
+
+// Purge は method と server に一致するレスポンスを削除し、削除した件数を返します。
+// 空文字列の条件は全てに一致します。
+func (s *Store) Purge(method, server string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	purged := 0
+	for elem := s.lru.Front(); elem != nil; {
+		next := elem.Next()
+		entry := elem.Value.(*Entry)
+		if (method == "" || entry.Method == method) && (server == "" || entry.Server == server) {
+			s.remove(elem)
+			purged++
+		}
+		elem = next
+	}
+	return purged
+}
+
+// Len は保持しているレスポンスの件数を返します（期限切れで未削除のものを含みます）。
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+func (s *Store) remove(elem *list.Element) {
+	s.lru.Remove(elem)
+	delete(s.entries, elem.Value.(*Entry).key)
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRules_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   Rules
+		wantErr bool
+	}{
+		{name: "正常なルール_成功", rules: Rules{{Method: "tools/list", TTL: "30s"}}},
+		{name: "メソッドなし_エラー", rules: Rules{{TTL: "30s"}}, wantErr: true},
+		{name: "不正なTTL_エラー", rules: Rules{{Method: "tools/list", TTL: "soon"}}, wantErr: true},
+		{name: "TTLが0_エラー", rules: Rules{{Method: "tools/list", TTL: "0s"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rules.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRules_Match(t *testing.T) {
+	rules := Rules{
+		{Method: "tools/list", Server: "v2", TTL: "1m"},
+		{Method: "tools/list", TTL: "10s"},
+	}
+	if err := rules.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		server  string
+		wantTTL time.Duration
+	}{
+		{name: "バージョン指定のルール_優先して一致", method: "tools/list", server: "v2", wantTTL: time.Minute},
+		{name: "他のバージョン_全バージョンのルールに一致", method: "tools/list", server: "v1", wantTTL: 10 * time.Second},
+		{name: "対象外のメソッド_一致しない", method: "tools/call", server: "v1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := rules.Match(tt.method, tt.server)
+			var got time.Duration
+			if rule != nil {
+				got = rule.Expiry()
+			}
+			if got != tt.wantTTL {
+				t.Errorf("Match() ttl = %v, want %v", got, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestRule_Bypass(t *testing.T) {
+	rules := Rules{{Method: "tools/list", TTL: "1m", BypassHeader: "x-no-cache"}}
+	if err := rules.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{}
+	if rules[0].Bypass(header) {
+		t.Error("Bypass() = true without the header")
+	}
+	header.Set("X-No-Cache", "1")
+	if !rules[0].Bypass(header) {
+		t.Error("Bypass() = false with the header")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	if err := os.WriteFile(path, []byte(`[{"method":"tools/list","ttl":"1m","vary":["x-tenant"]}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if rules[0].Vary[0] != "X-Tenant" {
+		t.Errorf("Vary = %v, want canonical header names", rules[0].Vary)
+	}
+}
+
+func TestStore(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewStore(2)
+	s.now = func() time.Time { return now }
+	evicted := 0
+	s.OnEvict = func() { evicted++ }
+
+	s.Set("a", Entry{Method: "tools/list", Server: "v1", Body: []byte("a")}, time.Minute)
+	s.Set("b", Entry{Method: "prompts/list", Server: "v1", Body: []byte("b")}, time.Second)
+	if got, ok := s.Get("a"); !ok || string(got) != "a" {
+		t.Fatalf("Get(a) = %q, %v", got, ok)
+	}
+
+	// 最も古く使われた b を破棄する
+	s.Set("c", Entry{Method: "tools/list", Server: "v2", Body: []byte("c")}, time.Minute)
+	if _, ok := s.Get("b"); ok || evicted != 1 {
+		t.Errorf("Get(b) found = %v, evicted = %d; want b evicted", ok, evicted)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := s.Get("a"); ok {
+		t.Error("Get(a) found an expired entry")
+	}
+
+	s.Set("d", Entry{Method: "tools/list", Server: "v1"}, time.Minute)
+	if got := s.Purge("tools/list", "v2"); got != 1 {
+		t.Errorf("Purge(tools/list, v2) = %d, want 1", got)
+	}
+	if got := s.Purge("", ""); got != 1 || s.Len() != 0 {
+		t.Errorf("Purge(all) = %d, Len() = %d; want 1, 0", got, s.Len())
+	}
+}
@@ -0,0 +1,154 @@
+// Package config は --config で指定する YAML の設定ファイルを読み込みます。
+//
+// 設定ファイルはコマンドラインオプションと同じ設定を、サーバー・stdio コマンド・名前付きのサーバー・
+// プロセスの調整の節に分けて記述します。節にないオプションは Options にフラグ名で指定します。
+// コマンドラインで指定したオプションは設定ファイルより優先されます。
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config は設定ファイル全体です。
+type Config struct {
+	Server  Server                      `yaml:"server,omitempty"`
+	Stdio   ServerDefinition            `yaml:"stdio,omitempty"`   // /mcp で公開するサーバー（--stdio）
+	Servers map[string]ServerDefinition `yaml:"servers,omitempty"` // /servers/{name}/mcp で公開するサーバー（--server）
+	Process Process                     `yaml:"process,omitempty"`
+
+	// Options は節にないコマンドラインオプションをフラグ名で指定します（例: metrics: true）。
+	// 値はスカラー、繰り返し指定するオプションはリスト、KEY=VALUE 形式のオプションはマップで指定します。
+	Options map[string]any `yaml:"options,omitempty"`
+}
+
+// Server は HTTP サーバーの設定です。
+type Server struct {
+	Host         string        `yaml:"host,omitempty"`
+	Port         int           `yaml:"port,omitempty"`
+	GRPCPort     int           `yaml:"grpcPort,omitempty"`
+	TCPPort      int           `yaml:"tcpPort,omitempty"`
+	ReadTimeout  time.Duration `yaml:"readTimeout,omitempty"`
+	WriteTimeout time.Duration `yaml:"writeTimeout,omitempty"`
+	LogLevel     string        `yaml:"logLevel,omitempty"`
+}
+
+// ServerDefinition は1つの stdio サーバーの設定です。
+// Command は --stdio と同じ形式で引数を含められ、Args はその後ろに追加します。
+type ServerDefinition struct {
+	Command     string            `yaml:"command,omitempty"`
+	Args        []string          `yaml:"args,omitempty"`
+	Env         map[string]string `yaml:"env,omitempty"`
+	RequiredEnv []string          `yaml:"requiredEnv,omitempty"`
+	HeaderEnv   map[string]string `yaml:"headerEnv,omitempty"`
+	HeaderArg   map[string]string `yaml:"headerArg,omitempty"`
+}
+
+// Process はプロセスの起動・再利用の調整です。
+type Process struct {
+	InitializeTimeout time.Duration `yaml:"initializeTimeout,omitempty"`
+	MaxMessageSize    int           `yaml:"maxMessageSize,omitempty"`
+	Framing           string        `yaml:"framing,omitempty"`
+	Compression       string        `yaml:"compression,omitempty"`
+	PoolSize          int           `yaml:"poolSize,omitempty"`
+	PoolMaxIdle       time.Duration `yaml:"poolMaxIdle,omitempty"`
+	ReuseProcesses    bool          `yaml:"reuseProcesses,omitempty"`
+	ReuseTTL          time.Duration `yaml:"reuseTTL,omitempty"`
+	ReuseMaxEntries   int           `yaml:"reuseMaxEntries,omitempty"`
+	SharedProcess     bool          `yaml:"sharedProcess,omitempty"`
+}
+
+// Load は YAML の設定ファイルを読み込んで検証します。
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse は YAML の設定を解析して検証します。未知のキーはエラーにします。
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Write は設定を Load で読み込める YAML で w に書き込みます。
+func (c *Config) Write(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// Validate は必須の項目と値の範囲を検証します。
+func (c *Config) Validate() error {
+	if c.Server.Port < 0 || c.Server.GRPCPort < 0 || c.Server.TCPPort < 0 {
+		return fmt.Errorf("server: ports must not be negative")
+	}
+	if c.Stdio.Command == "" && (len(c.Stdio.Args) > 0 || len(c.Stdio.Env) > 0 || len(c.Stdio.HeaderEnv) > 0 || len(c.Stdio.HeaderArg) > 0) {
+		return fmt.Errorf("stdio: command is required")
+	}
+	for name, def := range c.Servers {
+		if def.Command == "" {
+			return fmt.Errorf("servers.%s: command is required", name)
+		}
+	}
+	for name, value := range c.Options {
+		if err := validateOption(value); err != nil {
+			return fmt.Errorf("options.%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// validateOption はオプションの値がスカラー・スカラーのリスト・スカラーのマップのいずれかであることを検証します。
+func validateOption(value any) error {
+	switch v := value.(type) {
+	case []any:
+		for _, item := range v {
+			if !isScalar(item) {
+				return fmt.Errorf("list items must be scalars")
+			}
+		}
+	case map[string]any:
+		for _, item := range v {
+			if !isScalar(item) {
+				return fmt.Errorf("map values must be scalars")
+			}
+		}
+	default:
+		if !isScalar(v) {
+			return fmt.Errorf("unsupported value %v", v)
+		}
+	}
+	return nil
+}
+
+func isScalar(value any) bool {
+	switch value.(type) {
+	case string, bool, int, int64, uint64, float64:
+		return true
+	}
+	return false
+}
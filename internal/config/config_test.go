@@ -0,0 +1,139 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const exampleConfig = `
+server:
+  host: 127.0.0.1
+  port: 9090
+  readTimeout: 10s
+stdio:
+  command: npx -y server-filesystem
+  args: [/data]
+  env:
+    LOG_LEVEL: debug
+  headerEnv:
+    X-Token: TOKEN
+servers:
+  github:
+    command: npx
+    args: [-y, "@modelcontextprotocol/server-github"]
+    headerEnv:
+      X-Github-Token: GITHUB_TOKEN
+process:
+  poolSize: 2
+  poolMaxIdle: 10m
+options:
+  metrics: true
+  strip-header: [X-Internal-*, X-Debug]
+  cache-max-entries: 100
+`
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(exampleConfig))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := &Config{
+		Server: Server{Host: "127.0.0.1", Port: 9090, ReadTimeout: 10 * time.Second},
+		Stdio: ServerDefinition{
+			Command:   "npx -y server-filesystem",
+			Args:      []string{"/data"},
+			Env:       map[string]string{"LOG_LEVEL": "debug"},
+			HeaderEnv: map[string]string{"X-Token": "TOKEN"},
+		},
+		Servers: map[string]ServerDefinition{
+			"github": {
+				Command:   "npx",
+				Args:      []string{"-y", "@modelcontextprotocol/server-github"},
+				HeaderEnv: map[string]string{"X-Github-Token": "GITHUB_TOKEN"},
+			},
+		},
+		Process: Process{PoolSize: 2, PoolMaxIdle: 10 * time.Minute},
+		Options: map[string]any{
+			"metrics":           true,
+			"strip-header":      []any{"X-Internal-*", "X-Debug"},
+			"cache-max-entries": 100,
+		},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("Parse() = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestParse_Error(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "未知のキー_エラー", input: "server:\n  hostname: a\n", wantErr: "field hostname not found"},
+		{name: "不正な期間_エラー", input: "server:\n  readTimeout: soon\n", wantErr: "into time.Duration"},
+		{name: "コマンドのないサーバー_エラー", input: "servers:\n  github:\n    args: [a]\n", wantErr: "servers.github: command is required"},
+		{name: "コマンドのない stdio_エラー", input: "stdio:\n  env: {A: b}\n", wantErr: "stdio: command is required"},
+		{name: "入れ子のオプション_エラー", input: "options:\n  env: [{A: b}]\n", wantErr: "options.env"},
+		{name: "負のポート_エラー", input: "server:\n  port: -1\n", wantErr: "must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	_ = os.WriteFile(path, []byte(exampleConfig), 0o600)
+
+	if cfg, err := Load(path); err != nil || cfg.Server.Port != 9090 {
+		t.Errorf("Load() = %+v, %v, want port 9090", cfg, err)
+	}
+	if _, err := Load(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("Load() of a missing file error = nil")
+	}
+
+	// 空のファイルは全て未設定
+	empty := filepath.Join(dir, "empty.yaml")
+	_ = os.WriteFile(empty, nil, 0o600)
+	if cfg, err := Load(empty); err != nil || !reflect.DeepEqual(cfg, &Config{}) {
+		t.Errorf("Load() of an empty file = %+v, %v", cfg, err)
+	}
+}
+
+func TestConfig_Write_読み込み直せる(t *testing.T) {
+	want := &Config{
+		Server:  Server{Port: 9090, ReadTimeout: 10 * time.Second},
+		Stdio:   ServerDefinition{Command: "my-server", Args: []string{"/data"}, HeaderEnv: map[string]string{"X-Token": "TOKEN"}},
+		Servers: map[string]ServerDefinition{"github": {Command: "npx", Env: map[string]string{"A": "1"}}},
+		Process: Process{PoolSize: 2},
+		Options: map[string]any{"metrics": true, "strip-header": []any{"X-Debug"}},
+	}
+	var buf bytes.Buffer
+	if err := want.Write(&buf); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "readTimeout: 10s") {
+		t.Errorf("Write() should encode durations as strings: %s", buf.String())
+	}
+	got, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Parse() error = %v (yaml: %s)", err, buf.String())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse(Write()) = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// mcpServersFile は Claude Desktop や Cursor などが使う mcpServers 形式の JSON の設定ファイルです。
+// mcpServers 以外のキーはクライアント自身の設定のため無視します。
+type mcpServersFile struct {
+	MCPServers map[string]mcpServer `json:"mcpServers"`
+}
+
+// mcpServer は mcpServers の1つのサーバーです。
+type mcpServer struct {
+	Command  string            `json:"command"`
+	Args     []string          `json:"args"`
+	Env      map[string]string `json:"env"`
+	URL      string            `json:"url"`
+	Disabled bool              `json:"disabled"`
+}
+
+// LoadMCPServers は mcpServers 形式の JSON の設定ファイルを読み込み、名前付きのサーバーの設定に変換します。
+func LoadMCPServers(path string) (map[string]ServerDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read mcp config: %w", err)
+	}
+	servers, err := ParseMCPServers(data)
+	if err != nil {
+		return nil, fmt.Errorf("mcp config %s: %w", path, err)
+	}
+	return servers, nil
+}
+
+// ParseMCPServers は mcpServers 形式の JSON を名前付きのサーバーの設定に変換します。
+// disabled のサーバーは含めず、command のない（url で接続する）サーバーはエラーにします。
+func ParseMCPServers(data []byte) (map[string]ServerDefinition, error) {
+	var file mcpServersFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.MCPServers == nil {
+		return nil, fmt.Errorf("mcpServers is not defined")
+	}
+
+	servers := make(map[string]ServerDefinition, len(file.MCPServers))
+	for name, server := range file.MCPServers {
+		if server.Disabled {
+			continue
+		}
+		if server.Command == "" {
+			if server.URL != "" {
+				return nil, fmt.Errorf("mcpServers.%s: remote servers (url) are not supported; only stdio servers with a command can be served", name)
+			}
+			return nil, fmt.Errorf("mcpServers.%s: command is required", name)
+		}
+		servers[name] = ServerDefinition{Command: server.Command, Args: server.Args, Env: server.Env}
+	}
+	return servers, nil
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const exampleMCPServers = `{
+  "globalShortcut": "Ctrl+Space",
+  "mcpServers": {
+    "filesystem": {
+      "command": "npx",
+      "args": ["-y", "@modelcontextprotocol/server-filesystem", "/Users/me/Desktop"]
+    },
+    "github": {
+      "command": "npx",
+      "args": ["-y", "@modelcontextprotocol/server-github"],
+      "env": {"GITHUB_PERSONAL_ACCESS_TOKEN": "ghp_xxx"}
+    },
+    "old": {"command": "old-server", "disabled": true}
+  }
+}`
+
+func TestParseMCPServers(t *testing.T) {
+	servers, err := ParseMCPServers([]byte(exampleMCPServers))
+	if err != nil {
+		t.Fatalf("ParseMCPServers() error = %v", err)
+	}
+	want := map[string]ServerDefinition{
+		"filesystem": {Command: "npx", Args: []string{"-y", "@modelcontextprotocol/server-filesystem", "/Users/me/Desktop"}},
+		"github": {
+			Command: "npx",
+			Args:    []string{"-y", "@modelcontextprotocol/server-github"},
+			Env:     map[string]string{"GITHUB_PERSONAL_ACCESS_TOKEN": "ghp_xxx"},
+		},
+	}
+	if !reflect.DeepEqual(servers, want) {
+		t.Errorf("ParseMCPServers() = %+v, want %+v", servers, want)
+	}
+}
+
+func TestParseMCPServers_Error(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "不正なJSON_エラー", input: `{"mcpServers":`, wantErr: "unexpected end"},
+		{name: "mcpServersがない_エラー", input: `{"servers":{}}`, wantErr: "mcpServers is not defined"},
+		{name: "URLのサーバー_エラー", input: `{"mcpServers":{"remote":{"url":"https://example.com/mcp"}}}`, wantErr: "remote servers (url) are not supported"},
+		{name: "コマンドのないサーバー_エラー", input: `{"mcpServers":{"a":{"args":["x"]}}}`, wantErr: "mcpServers.a: command is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseMCPServers([]byte(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseMCPServers() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadMCPServers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "claude_desktop_config.json")
+	_ = os.WriteFile(path, []byte(exampleMCPServers), 0o600)
+
+	if servers, err := LoadMCPServers(path); err != nil || len(servers) != 2 {
+		t.Errorf("LoadMCPServers() = %+v, %v, want 2 servers", servers, err)
+	}
+	if _, err := LoadMCPServers(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("LoadMCPServers() of a missing file error = nil")
+	}
+}
@@ -0,0 +1,291 @@
+// Package conformance は stdio MCP サーバーが MCP プロトコルに準拠しているかを検査します。
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+)
+
+// ProtocolVersion は initialize で要求する MCP プロトコルバージョンです。
+const ProtocolVersion = "2025-06-18"
+
+// KnownProtocolVersions は既知の MCP プロトコルバージョンです。
+var KnownProtocolVersions = []string{"2024-11-05", "2025-03-26", "2025-06-18"}
+
+// DefaultTimeout は各チェックでレスポンスを待つデフォルトの時間です。
+const DefaultTimeout = 10 * time.Second
+
+// notificationWindow は「レスポンスが返らないこと」を確認するために待つ時間です。
+const notificationWindow = 500 * time.Millisecond
+
+// Conn は検査対象のサーバーとの接続です（process.Session が実装します）。
+type Conn interface {
+	Send(msg []byte) error
+	Receive(ctx context.Context) ([]byte, error)
+	Exited() <-chan struct{}
+}
+
+// Checker は1つの接続に対して一連の準拠チェックを実行します。
+type Checker struct {
+	conn    Conn
+	timeout time.Duration
+	nextID  int
+	report  *Report
+}
+
+// NewChecker は新しい Checker を作成します。timeout が 0 以下の場合は DefaultTimeout を使用します。
+func NewChecker(conn Conn, timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{conn: conn, timeout: timeout, report: &Report{}}
+}
+
+// initializeResult は initialize レスポンスのうち検査に使うフィールドです。
+type initializeResult struct {
+	ProtocolVersion string                     `json:"protocolVersion"`
+	Capabilities    map[string]json.RawMessage `json:"capabilities"`
+	ServerInfo      struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"serverInfo"`
+}
+
+// Run は全てのチェックを実行し、レポートを返します。
+func (c *Checker) Run(ctx context.Context) *Report {
+	initResult, ok := c.checkInitialize(ctx)
+	if !ok {
+		for _, name := range []string{
+			"protocol version", "initialized notification", "ping",
+			"tools/list", "resources/list", "prompts/list",
+			"unknown method", "unknown notification", "parse error",
+		} {
+			c.report.add(name, StatusSkip, "initialize failed")
+		}
+		return c.report
+	}
+
+	if slices.Contains(KnownProtocolVersions, initResult.ProtocolVersion) {
+		c.report.add("protocol version", StatusPass, initResult.ProtocolVersion)
+	} else {
+		c.report.add("protocol version", StatusWarn, fmt.Sprintf("unknown protocol version %q", initResult.ProtocolVersion))
+	}
+
+	c.checkSilentNotification(ctx, "initialized notification", "notifications/initialized")
+	c.checkPing(ctx)
+	c.checkList(ctx, initResult.Capabilities, "tools", "tools/list")
+	c.checkList(ctx, initResult.Capabilities, "resources", "resources/list")
+	c.checkList(ctx, initResult.Capabilities, "prompts", "prompts/list")
+	c.checkUnknownMethod(ctx)
+	c.checkSilentNotification(ctx, "unknown notification", "notifications/tumiki/unknown")
+	c.checkParseError(ctx)
+
+	return c.report
+}
+
+func (c *Checker) checkInitialize(ctx context.Context) (*initializeResult, bool) {
+	const name = "initialize handshake"
+	resp, err := c.call(ctx, "initialize", map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "tumiki-mcp-http-check", "version": "0"},
+	})
+	if err != nil {
+		c.report.add(name, StatusFail, err.Error())
+		return nil, false
+	}
+	if resp.Error != nil {
+		c.report.add(name, StatusFail, resp.Error.Error())
+		return nil, false
+	}
+	if resp.JSONRPC != jsonrpc.Version {
+		c.report.add(name, StatusFail, fmt.Sprintf("jsonrpc field is %q, want %q", resp.JSONRPC, jsonrpc.Version))
+		return nil, false
+	}
+
+	var result initializeResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		c.report.add(name, StatusFail, fmt.Sprintf("invalid initialize result: %v", err))
+		return nil, false
+	}
+	switch {
+	case result.ProtocolVersion == "":
+		c.report.add(name, StatusFail, "result.protocolVersion is missing")
+		return nil, false
+	case result.Capabilities == nil:
+		c.report.add(name, StatusFail, "result.capabilities is missing")
+		return nil, false
+	case result.ServerInfo.Name == "":
+		c.report.add(name, StatusFail, "result.serverInfo.name is missing")
+		return nil, false
+	}
+
+	c.report.add(name, StatusPass, fmt.Sprintf("server %q %s", result.ServerInfo.Name, result.ServerInfo.Version))
+	return &result, true
+}
+
+func (c *Checker) checkPing(ctx context.Context) {
+	resp, err := c.call(ctx, "ping", nil)
+	switch {
+	case err != nil:
+		c.report.add("ping", StatusFail, err.Error())
+	case resp.Error != nil:
+		c.report.add("ping", StatusFail, resp.Error.Error())
+	default:
+		c.report.add("ping", StatusPass, "")
+	}
+}
+
+func (c *Checker) checkList(ctx context.Context, capabilities map[string]json.RawMessage, capability, method string) {
+	if _, ok := capabilities[capability]; !ok {
+		c.report.add(method, StatusSkip, fmt.Sprintf("capability %q not advertised", capability))
+		return
+	}
+
+	resp, err := c.call(ctx, method, map[string]any{})
+	if err != nil {
+		c.report.add(method, StatusFail, err.Error())
+		return
+	}
+	if resp.Error != nil {
+		c.report.add(method, StatusFail, fmt.Sprintf("capability %q advertised but %s", capability, resp.Error.Error()))
+		return
+	}
+
+	var result map[string]json.RawMessage
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		c.report.add(method, StatusFail, fmt.Sprintf("invalid result: %v", err))
+		return
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(result[capability], &items); err != nil {
+		c.report.add(method, StatusFail, fmt.Sprintf("result.%s is not an array", capability))
+		return
+	}
+	c.report.add(method, StatusPass, fmt.Sprintf("%d %s", len(items), capability))
+}
+
+func (c *Checker) checkUnknownMethod(ctx context.Context) {
+	const name = "unknown method"
+	resp, err := c.call(ctx, "tumiki/unknown-method", nil)
+	switch {
+	case err != nil:
+		c.report.add(name, StatusFail, err.Error())
+	case resp.Error == nil:
+		c.report.add(name, StatusFail, "expected an error response but got a result")
+	case resp.Error.Code != jsonrpc.CodeMethodNotFound:
+		c.report.add(name, StatusWarn, fmt.Sprintf("error code %d, want %d", resp.Error.Code, jsonrpc.CodeMethodNotFound))
+	default:
+		c.report.add(name, StatusPass, "")
+	}
+}
+
+// checkSilentNotification は通知に対してレスポンスが返らないことを確認します。
+func (c *Checker) checkSilentNotification(ctx context.Context, name, method string) {
+	msg, err := jsonrpc.NewNotification(method, nil)
+	if err != nil {
+		c.report.add(name, StatusFail, err.Error())
+		return
+	}
+	if err := c.conn.Send(msg); err != nil {
+		c.report.add(name, StatusFail, err.Error())
+		return
+	}
+
+	resp, err := c.receiveResponse(ctx, notificationWindow)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		c.report.add(name, StatusPass, "")
+	case err != nil:
+		c.report.add(name, StatusFail, err.Error())
+	default:
+		c.report.add(name, StatusFail, fmt.Sprintf("server responded to a notification (id %s)", resp.ID))
+	}
+}
+
+func (c *Checker) checkParseError(ctx context.Context) {
+	const name = "parse error"
+	if err := c.conn.Send([]byte(`{"jsonrpc":"2.0","id":`)); err != nil {
+		c.report.add(name, StatusFail, err.Error())
+		return
+	}
+
+	resp, err := c.receiveResponse(ctx, c.timeout)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.report.add(name, StatusFail, "server exited on malformed input")
+	case errors.Is(err, context.DeadlineExceeded):
+		c.report.add(name, StatusWarn, "no error response for malformed input")
+	case err != nil:
+		c.report.add(name, StatusFail, err.Error())
+	case resp.Error == nil:
+		c.report.add(name, StatusFail, "expected an error response but got a result")
+	case resp.Error.Code != jsonrpc.CodeParseError:
+		c.report.add(name, StatusWarn, fmt.Sprintf("error code %d, want %d", resp.Error.Code, jsonrpc.CodeParseError))
+	default:
+		c.report.add(name, StatusPass, "")
+	}
+}
+
+// call はリクエストを送信し、同じ ID のレスポンスを待ちます。
+func (c *Checker) call(ctx context.Context, method string, params any) (*jsonrpc.Message, error) {
+	c.nextID++
+	id := c.nextID
+	req, err := jsonrpc.NewRequest(id, method, params)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.conn.Send(req); err != nil {
+		return nil, err
+	}
+
+	wantID := json.RawMessage(fmt.Sprint(id))
+	for {
+		resp, err := c.receiveResponse(ctx, c.timeout)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return nil, fmt.Errorf("no response to %s within %s", method, c.timeout)
+			}
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("server exited before responding to %s", method)
+			}
+			return nil, err
+		}
+		if jsonrpc.SameID(resp.ID, wantID) {
+			return resp, nil
+		}
+	}
+}
+
+// receiveResponse はレスポンスを1件受信するまで待ちます。
+// サーバーからの通知は無視し、サーバーからのリクエストには method not found を返します。
+func (c *Checker) receiveResponse(ctx context.Context, timeout time.Duration) (*jsonrpc.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		data, err := c.conn.Receive(ctx)
+		if err != nil {
+			return nil, err
+		}
+		msg, err := jsonrpc.Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("server wrote invalid JSON to stdout: %q", data)
+		}
+		switch {
+		case msg.IsResponse() || (msg.Method == "" && msg.Error != nil):
+			return msg, nil
+		case msg.IsRequest():
+			if err := c.conn.Send(jsonrpc.NewErrorResponse(msg.ID, jsonrpc.CodeMethodNotFound, "not supported by checker")); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
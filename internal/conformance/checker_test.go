@@ -0,0 +1,131 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mcptest"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+func TestMain(m *testing.M) {
+	mcptest.RunIfRequested()
+	os.Exit(m.Run())
+}
+
+func runChecker(t *testing.T, command string, args []string, env map[string]string) *Report {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	session, err := process.NewExecutor(command, args, env, nil).Start(ctx)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() { _ = session.Close() }()
+
+	return NewChecker(session, 2*time.Second).Run(ctx)
+}
+
+func statuses(r *Report) map[string]Status {
+	result := make(map[string]Status)
+	for _, res := range r.Results {
+		result[res.Name] = res.Status
+	}
+	return result
+}
+
+func TestChecker_Run(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		expected map[string]Status
+		passed   bool
+	}{
+		{
+			name: "準拠サーバー_全てのチェックが成功する",
+			mode: mcptest.ModeCompliant,
+			expected: map[string]Status{
+				"initialize handshake":     StatusPass,
+				"protocol version":         StatusPass,
+				"initialized notification": StatusPass,
+				"ping":                     StatusPass,
+				"tools/list":               StatusPass,
+				"resources/list":           StatusSkip,
+				"prompts/list":             StatusSkip,
+				"unknown method":           StatusPass,
+				"unknown notification":     StatusPass,
+				"parse error":              StatusPass,
+			},
+			passed: true,
+		},
+		{
+			name: "非準拠サーバー_違反が失敗として報告される",
+			mode: mcptest.ModeNonCompliant,
+			expected: map[string]Status{
+				"initialize handshake":     StatusPass,
+				"initialized notification": StatusFail,
+				"unknown method":           StatusFail,
+				"parse error":              StatusFail,
+			},
+			passed: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command, args, env := mcptest.Command(tt.mode)
+			report := runChecker(t, command, args, env)
+
+			got := statuses(report)
+			for name, want := range tt.expected {
+				if got[name] != want {
+					t.Errorf("%s = %s, want %s (report: %+v)", name, got[name], want, report.Results)
+				}
+			}
+			if report.Passed() != tt.passed {
+				t.Errorf("Passed() = %v, want %v", report.Passed(), tt.passed)
+			}
+		})
+	}
+}
+
+func TestChecker_Run_NonMCPProcess(t *testing.T) {
+	report := runChecker(t, "sh", []string{"-c", "echo not-json; exit 0"}, map[string]string{})
+
+	got := statuses(report)
+	if got["initialize handshake"] != StatusFail {
+		t.Errorf("initialize handshake = %s, want FAIL", got["initialize handshake"])
+	}
+	if report.Count(StatusSkip) != len(report.Results)-1 {
+		t.Errorf("expected all other checks to be skipped: %+v", report.Results)
+	}
+}
+
+func TestReport_Write(t *testing.T) {
+	report := &Report{}
+	report.add("ping", StatusPass, "")
+	report.add("tools/list", StatusFail, "boom")
+	report.add("prompts/list", StatusSkip, "not advertised")
+
+	var buf bytes.Buffer
+	if err := report.Write(&buf); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"[PASS] ping\n",
+		"[FAIL] tools/list - boom",
+		"[SKIP] prompts/list - not advertised",
+		"Summary: 1 passed, 1 failed, 0 warnings, 1 skipped",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output should contain %q: got %s", want, out)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package conformance
+
+import (
+	"fmt"
+	"io"
+)
+
+// Status はチェック結果の種別です。
+type Status string
+
+// チェック結果の種別
+const (
+	StatusPass Status = "PASS"
+	StatusFail Status = "FAIL"
+	StatusWarn Status = "WARN"
+	StatusSkip Status = "SKIP"
+)
+
+// Result は1つのチェック結果です。
+type Result struct {
+	Name   string
+	Status Status
+	Detail string
+}
+
+// Report はチェック結果の一覧です。
+type Report struct {
+	Results []Result
+}
+
+func (r *Report) add(name string, status Status, detail string) {
+	r.Results = append(r.Results, Result{Name: name, Status: status, Detail: detail})
+}
+
+// Count は指定された種別の結果数を返します。
+func (r *Report) Count(status Status) int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Passed は失敗したチェックがないかどうかを返します。
+func (r *Report) Passed() bool {
+	return r.Count(StatusFail) == 0
+}
+
+// Write はレポートを人間が読める形式で書き出します。
+func (r *Report) Write(w io.Writer) error {
+	for _, res := range r.Results {
+		line := fmt.Sprintf("  [%s] %s", res.Status, res.Name)
+		if res.Detail != "" {
+			line += " - " + res.Detail
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "\nSummary: %d passed, %d failed, %d warnings, %d skipped\n",
+		r.Count(StatusPass), r.Count(StatusFail), r.Count(StatusWarn), r.Count(StatusSkip))
+	return err
+}
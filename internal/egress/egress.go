@@ -0,0 +1,362 @@
+// Package egress は stdio プロセスの外部への接続を、許可リストのホストにだけ中継する
+// HTTP のフォワードプロキシと、プロセスがプロキシ以外に接続できないネットワーク名前空間を提供します。
+//
+// プロキシは Unix ソケットで待ち受け、Sandbox で起動したプロセスには名前空間の中の SandboxAddr から中継します。
+// 名前空間にはループバックしかないため、プロキシの設定（HTTP_PROXY・HTTPS_PROXY）を無視する接続は失敗します。
+// 名前解決もプロキシで行うため、プロセスに DNS を使わせる必要はありません。
+package egress
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dialTimeout は接続先への接続のタイムアウトです。
+const dialTimeout = 10 * time.Second
+
+// ErrInvalidPattern は許可するホストの指定が不正であることを表します。
+var ErrInvalidPattern = errors.New("invalid egress host pattern")
+
+// Policy はプロセスが接続できるホストの許可リストです。空の Policy は全ての接続を拒否します。
+type Policy []pattern
+
+// pattern は許可する1つのホストです。
+type pattern struct {
+	host     string // 小文字にしたホスト名・IP アドレス
+	wildcard bool   // host のサブドメインを許可する（"*.example.com"）
+	port     string // 許可するポート（空文字列で全て）
+}
+
+// ParsePolicy は "host"・"host:port"・"*.domain"・"*.domain:port" の形式の許可リストを解析します。
+// "*.example.com" は example.com 自体を含まないサブドメインに一致します。IPv6 アドレスは "[::1]:443" のように指定します。
+func ParsePolicy(patterns []string) (Policy, error) {
+	policy := make(Policy, 0, len(patterns))
+	for _, raw := range patterns {
+		p, err := parsePattern(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, err
+		}
+		policy = append(policy, p)
+	}
+	return policy, nil
+}
+
+func parsePattern(raw string) (pattern, error) {
+	host, port := raw, ""
+	if h, p, err := net.SplitHostPort(raw); err == nil {
+		host, port = h, p
+	} else if strings.HasPrefix(raw, "[") && strings.HasSuffix(raw, "]") {
+		host = raw[1 : len(raw)-1]
+	}
+
+	var p pattern
+	if rest, ok := strings.CutPrefix(host, "*."); ok {
+		p.wildcard = true
+		host = rest
+	}
+	p.host = normalizeHost(host)
+	p.port = port
+	if p.host == "" || strings.ContainsAny(p.host, "*/ ") {
+		return pattern{}, fmt.Errorf("%w: %q", ErrInvalidPattern, raw)
+	}
+	if port != "" && !isPort(port) {
+		return pattern{}, fmt.Errorf("%w: %q has an invalid port", ErrInvalidPattern, raw)
+	}
+	return p, nil
+}
+
+// Allows は host（"host:port" 形式）への接続を許可するかを返します。
+func (p Policy) Allows(hostport string) bool {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return false
+	}
+	host = normalizeHost(host)
+	for _, pat := range p {
+		if pat.port != "" && pat.port != port {
+			continue
+		}
+		if pat.wildcard {
+			if strings.HasSuffix(host, "."+pat.host) {
+				return true
+			}
+		} else if host == pat.host {
+			return true
+		}
+	}
+	return false
+}
+
+// String は許可リストを ParsePolicy で解析できる形式で返します。
+func (p Policy) String() string {
+	parts := make([]string, len(p))
+	for i, pat := range p {
+		host := pat.host
+		if pat.wildcard {
+			host = "*." + host
+		}
+		if pat.port != "" {
+			host = net.JoinHostPort(host, pat.port)
+		}
+		parts[i] = host
+	}
+	return strings.Join(parts, ",")
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func isPort(s string) bool {
+	if len(s) == 0 || len(s) > 5 {
+		return false
+	}
+	n := 0
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n > 0 && n <= 65535
+}
+
+// Proxy は許可リストごとに認証情報を発行し、その許可リストで接続を制限するフォワードプロキシです。
+// HTTP は絶対 URL のリクエストを、HTTPS などは CONNECT のトンネルを中継します。
+type Proxy struct {
+	dir       string // Unix ソケットを作成した一時ディレクトリ
+	listener  net.Listener
+	server    *http.Server
+	transport *http.Transport
+	logger    *slog.Logger
+	onResult  func(server string, allowed bool)
+
+	mu       sync.RWMutex
+	policies map[string]*registration // 認証情報のパスワード→許可リスト
+	names    map[string]string        // 名前→パスワード
+}
+
+// registration は Register で登録した許可リストです。
+type registration struct {
+	name   string
+	policy Policy
+}
+
+// Listen は一時ディレクトリの Unix ソケットで待ち受けるプロキシを起動します。
+// onResult は中継・拒否のたびに登録した名前とともに呼び出します（nil で何もしない）。
+func Listen(logger *slog.Logger, onResult func(server string, allowed bool)) (*Proxy, error) {
+	dir, err := os.MkdirTemp("", "tumiki-egress-")
+	if err != nil {
+		return nil, fmt.Errorf("egress proxy listen: %w", err)
+	}
+	listener, err := net.Listen("unix", filepath.Join(dir, "proxy.sock"))
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("egress proxy listen: %w", err)
+	}
+	if onResult == nil {
+		onResult = func(string, bool) {}
+	}
+	p := &Proxy{
+		dir:      dir,
+		listener: listener,
+		logger:   logger,
+		onResult: onResult,
+		transport: &http.Transport{
+			// 中継先への接続にはプロキシの環境変数を使わない
+			Proxy:       nil,
+			DialContext: (&net.Dialer{Timeout: dialTimeout}).DialContext,
+		},
+		policies: make(map[string]*registration),
+		names:    make(map[string]string),
+	}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: dialTimeout}
+	go func() { _ = p.server.Serve(listener) }()
+	return p, nil
+}
+
+// Register は name の許可リストを登録し、プロセスの HTTP_PROXY・HTTPS_PROXY に設定するプロキシの URL（名前空間の中の SandboxAddr）を返します。
+// 同じ name を再び登録した場合は許可リストを置き換え、同じ URL を返します。
+func (p *Proxy) Register(name string, policy Policy) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	secret, ok := p.names[name]
+	if !ok {
+		buf := make([]byte, 16)
+		_, _ = rand.Read(buf)
+		secret = hex.EncodeToString(buf)
+		p.names[name] = secret
+	}
+	p.policies[secret] = &registration{name: name, policy: policy}
+
+	u := url.URL{Scheme: "http", User: url.UserPassword(name, secret), Host: SandboxAddr}
+	return u.String()
+}
+
+// SocketPath はプロキシが待ち受けている Unix ソケットのパスを返します。
+func (p *Proxy) SocketPath() string {
+	return p.listener.Addr().String()
+}
+
+// Close はプロキシを停止し、中継中の接続を閉じて Unix ソケットを削除します。
+func (p *Proxy) Close() error {
+	p.transport.CloseIdleConnections()
+	err := p.server.Close()
+	if rmErr := os.RemoveAll(p.dir); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// ServeHTTP は認証情報から許可リストを決め、許可したホストへのリクエストだけを中継します。
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reg := p.authenticate(r)
+	if reg == nil {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="tumiki-egress"`)
+		http.Error(w, "Proxy authentication required", http.StatusProxyAuthRequired)
+		return
+	}
+
+	target := r.Host
+	if r.Method != http.MethodConnect {
+		if !r.URL.IsAbs() {
+			http.Error(w, "Absolute URL required", http.StatusBadRequest)
+			return
+		}
+		target = r.URL.Host
+		if r.URL.Port() == "" {
+			target = net.JoinHostPort(r.URL.Hostname(), defaultPort(r.URL.Scheme))
+		}
+	}
+
+	if !reg.policy.Allows(target) {
+		p.onResult(reg.name, false)
+		p.logger.Warn("Egress denied", "server", reg.name, "host", target, "method", r.Method)
+		http.Error(w, fmt.Sprintf("Egress to %s is not allowed", target), http.StatusForbidden)
+		return
+	}
+	p.onResult(reg.name, true)
+	p.logger.Debug("Egress allowed", "server", reg.name, "host", target, "method", r.Method)
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r, target)
+		return
+	}
+	p.forward(w, r)
+}
+
+// authenticate は Proxy-Authorization の Basic 認証から登録した許可リストを返します。
+func (p *Proxy) authenticate(r *http.Request) *registration {
+	scheme, encoded, ok := strings.Cut(r.Header.Get("Proxy-Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil
+	}
+	name, secret, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	reg := p.policies[secret]
+	if reg == nil || reg.name != name {
+		return nil
+	}
+	return reg
+}
+
+// tunnel は CONNECT のトンネルを target との間で中継します。
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request, target string) {
+	upstream, err := net.DialTimeout("tcp", target, dialTimeout)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Connect to %s failed", target), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		_ = upstream.Close()
+		http.Error(w, "Tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		_ = upstream.Close()
+		return
+	}
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		_ = upstream.Close()
+		_ = client.Close()
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		// Hijack の前に読み込まれたデータも含めて転送する
+		_, _ = io.Copy(upstream, buffered)
+		closeWrite(upstream)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(client, upstream)
+		closeWrite(client)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+	_ = upstream.Close()
+	_ = client.Close()
+}
+
+// forward は絶対 URL の HTTP リクエストを中継します。
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request) {
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Header.Del("Proxy-Authorization")
+	out.Header.Del("Proxy-Connection")
+
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Request to %s failed", r.URL.Host), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+// closeWrite は書き込み側だけを閉じ、相手に送信の終わりを伝えます。
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = c.CloseWrite()
+		return
+	}
+	_ = conn.Close()
+}
+
+func defaultPort(scheme string) string {
+	if scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
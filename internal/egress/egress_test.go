@@ -0,0 +1,246 @@
+package egress
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     string
+		wantErr  bool
+	}{
+		{name: "ホスト_小文字にする", patterns: []string{"API.GitHub.com."}, want: "api.github.com"},
+		{name: "ポート付き", patterns: []string{"api.github.com:443"}, want: "api.github.com:443"},
+		{name: "ワイルドカード", patterns: []string{"*.example.com", "*.example.org:8443"}, want: "*.example.com,*.example.org:8443"},
+		{name: "IPv6", patterns: []string{"[::1]:8080", "[::1]"}, want: "[::1]:8080,::1"},
+		{name: "空_全て拒否", patterns: nil, want: ""},
+		{name: "空文字列_エラー", patterns: []string{""}, wantErr: true},
+		{name: "途中のワイルドカード_エラー", patterns: []string{"api.*.com"}, wantErr: true},
+		{name: "不正なポート_エラー", patterns: []string{"example.com:http"}, wantErr: true},
+		{name: "範囲外のポート_エラー", patterns: []string{"example.com:70000"}, wantErr: true},
+		{name: "URL_エラー", patterns: []string{"https://example.com/"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := ParsePolicy(tt.patterns)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidPattern) {
+					t.Errorf("ParsePolicy() error = %v, want ErrInvalidPattern", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePolicy() error = %v", err)
+			}
+			if got := policy.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy_Allows(t *testing.T) {
+	policy, err := ParsePolicy([]string{"api.github.com:443", "*.example.com", "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		want   bool
+	}{
+		{name: "ホストとポートが一致_許可", target: "api.github.com:443", want: true},
+		{name: "大文字_許可", target: "API.GITHUB.COM:443", want: true},
+		{name: "ポートが異なる_拒否", target: "api.github.com:80", want: false},
+		{name: "サブドメイン_許可", target: "a.b.example.com:80", want: true},
+		{name: "ワイルドカードのドメイン自体_拒否", target: "example.com:443", want: false},
+		{name: "接尾辞だけ一致_拒否", target: "evilexample.com:443", want: false},
+		{name: "IPアドレス_許可", target: "10.0.0.1:5432", want: true},
+		{name: "一覧にないホスト_拒否", target: "attacker.test:443", want: false},
+		{name: "ポートなし_拒否", target: "api.github.com", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Allows(tt.target); got != tt.want {
+				t.Errorf("Allows(%q) = %v, want %v", tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+// recordedResult は onResult で受け取った中継・拒否の結果です。
+type recordedResult struct {
+	server  string
+	allowed bool
+}
+
+// dialProxy はプロキシの URL のアドレスに関わらず、プロキシの Unix ソケットに接続します。
+func dialProxy(proxy *Proxy) func(ctx context.Context, _, _ string) (net.Conn, error) {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", proxy.SocketPath())
+	}
+}
+
+// newTestProxy は upstream への接続だけを "test" の許可リストで許可したプロキシと、その URL を返します。
+func newTestProxy(t *testing.T, upstream string) (*Proxy, *url.URL, func() []recordedResult) {
+	t.Helper()
+	var mu sync.Mutex
+	var results []recordedResult
+	proxy, err := Listen(slog.Default(), func(server string, allowed bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, recordedResult{server, allowed})
+	})
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { _ = proxy.Close() })
+
+	policy, err := ParsePolicy([]string{upstream})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyURL, err := url.Parse(proxy.Register("test", policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proxy, proxyURL, func() []recordedResult {
+		mu.Lock()
+		defer mu.Unlock()
+		return results
+	}
+}
+
+func TestProxy_HTTP(t *testing.T) {
+	allowed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "" {
+			t.Error("Proxy-Authorization was forwarded upstream")
+		}
+		_, _ = io.WriteString(w, "hello")
+	}))
+	defer allowed.Close()
+	denied := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		t.Error("request to a denied host reached upstream")
+	}))
+	defer denied.Close()
+
+	proxy, proxyURL, results := newTestProxy(t, strings.TrimPrefix(allowed.URL, "http://"))
+
+	tests := []struct {
+		name       string
+		proxyURL   *url.URL
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "許可したホスト_中継", proxyURL: proxyURL, target: allowed.URL, wantStatus: http.StatusOK, wantBody: "hello"},
+		{name: "許可していないホスト_403", proxyURL: proxyURL, target: denied.URL, wantStatus: http.StatusForbidden},
+		{name: "認証情報なし_407", proxyURL: &url.URL{Scheme: "http", Host: proxyURL.Host}, target: allowed.URL, wantStatus: http.StatusProxyAuthRequired},
+		{name: "不正なパスワード_407", proxyURL: &url.URL{Scheme: "http", User: url.UserPassword("test", "wrong"), Host: proxyURL.Host}, target: allowed.URL, wantStatus: http.StatusProxyAuthRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(tt.proxyURL), DialContext: dialProxy(proxy)}}
+			resp, err := client.Get(tt.target)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body: %s)", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantBody != "" && string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+
+	want := []recordedResult{{"test", true}, {"test", false}}
+	if got := results(); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("results = %+v, want %+v", got, want)
+	}
+}
+
+func TestProxy_Connect(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "secure")
+	}))
+	defer upstream.Close()
+	other := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer other.Close()
+
+	proxy, proxyURL, _ := newTestProxy(t, strings.TrimPrefix(upstream.URL, "https://"))
+	transport := upstream.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	transport.DialContext = dialProxy(proxy)
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "secure" {
+		t.Errorf("response = %d %q, want 200 secure", resp.StatusCode, body)
+	}
+
+	// CONNECT が拒否された場合、クライアントはトンネルを確立できない
+	if _, err := client.Get(other.URL); err == nil || !strings.Contains(err.Error(), "Forbidden") {
+		t.Errorf("Get(denied) error = %v, want Forbidden", err)
+	}
+}
+
+func TestProxy_RegisterReplacesPolicy(t *testing.T) {
+	proxy, err := Listen(slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = proxy.Close() }()
+
+	first := proxy.Register("v1", Policy{})
+	if u, _ := url.Parse(first); u.Host != SandboxAddr {
+		t.Errorf("Register() = %q, want the sandbox address", first)
+	}
+	policy, _ := ParsePolicy([]string{"example.com"})
+	second := proxy.Register("v1", policy)
+	other := proxy.Register("v2", policy)
+
+	if first != second {
+		t.Errorf("Register() for the same name = %q, then %q, want the same URL", first, second)
+	}
+	if first == other {
+		t.Error("Register() for different names returned the same URL")
+	}
+}
+
+func TestProxy_CloseRemovesSocket(t *testing.T) {
+	proxy, err := Listen(slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := proxy.SocketPath()
+	if err := proxy.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := net.Dial("unix", socket); err == nil {
+		t.Error("the proxy socket is still reachable after Close()")
+	}
+}
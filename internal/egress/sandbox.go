@@ -0,0 +1,8 @@
+package egress
+
+// SandboxAddr はネットワーク名前空間の中でプロキシに接続するアドレスです。
+// 名前空間の中にはこのアドレスしかないため、ホストのポートと衝突しません。
+const SandboxAddr = "127.0.0.1:3128"
+
+// sandboxSocketEnv は自身を名前空間の中の中継として起動したことと、プロキシの Unix ソケットのパスを表す環境変数です。
+const sandboxSocketEnv = "TUMIKI_EGRESS_SANDBOX_SOCKET"
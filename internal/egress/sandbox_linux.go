@@ -0,0 +1,190 @@
+//go:build linux
+
+package egress
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandboxFailed は名前空間の中の中継を準備できなかった場合の終了コードです。
+const sandboxFailed = 125
+
+// Sandbox は cmd を新しいユーザー・ネットワーク名前空間の中で実行するよう書き換えます。
+// 名前空間にはループバックしかなく、SandboxAddr への接続だけを socket のプロキシに中継するため、
+// プロセスはプロキシの設定を無視しても外部に接続できません。
+//
+// 名前空間の中では自身の実行ファイルを中継として起動し、中継が cmd のコマンドを実行します。
+// 実行ファイルの main で RunSandboxIfRequested を呼び出してください。
+func Sandbox(cmd *exec.Cmd, socket string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("egress sandbox: %w", err)
+	}
+	if cmd.Env == nil {
+		cmd.Env = cmd.Environ()
+	}
+	cmd.Env = append(cmd.Env, sandboxSocketEnv+"="+socket)
+	// 中継は解決済みのパスで、元の argv[0] のまま実行する
+	cmd.Args = append([]string{self, cmd.Path}, cmd.Args...)
+	cmd.Path = self
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// root でもユーザー名前空間を作成し、ホストのネットワーク名前空間に戻る権限を持たせない
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+	cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+	// root 以外のユーザーでも中継がループバックを有効にできるようにする（コマンドには引き継がない）
+	cmd.SysProcAttr.AmbientCaps = []uintptr{unix.CAP_NET_ADMIN}
+	return nil
+}
+
+// CheckSandbox はこの環境でネットワーク名前空間を作成して中継を起動できるかを確認します。
+// ユーザー名前空間が無効な環境（sysctl や seccomp で禁止されたコンテナなど）ではエラーを返します。
+func CheckSandbox(socket string) error {
+	cmd := &exec.Cmd{}
+	if err := Sandbox(cmd, socket); err != nil {
+		return err
+	}
+	// コマンドを指定しない中継は準備だけして終了する
+	cmd.Args = cmd.Args[:1]
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("egress proxy requires user and network namespaces: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// RunSandboxIfRequested は Sandbox で名前空間の中の中継として起動された場合に中継として動作し、コマンドの終了コードで終了します。
+func RunSandboxIfRequested() {
+	socket := os.Getenv(sandboxSocketEnv)
+	if socket == "" {
+		return
+	}
+	os.Exit(runSandbox(socket, os.Args[1:]))
+}
+
+// runSandbox はループバックを有効にして SandboxAddr を socket に中継し、argv（パス・argv[0]・引数）のコマンドを実行します。
+func runSandbox(socket string, argv []string) int {
+	if err := loopbackUp(); err != nil {
+		fmt.Fprintf(os.Stderr, "egress sandbox: %v\n", err)
+		return sandboxFailed
+	}
+	listener, err := net.Listen("tcp", SandboxAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "egress sandbox: %v\n", err)
+		return sandboxFailed
+	}
+	go relay(listener, socket)
+	if len(argv) < 2 {
+		return 0
+	}
+
+	cmd := &exec.Cmd{
+		Path:   argv[0],
+		Args:   argv[1:],
+		Env:    slices.DeleteFunc(os.Environ(), func(kv string) bool { return strings.HasPrefix(kv, sandboxSocketEnv+"=") }),
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		// 中継が強制終了された場合もコマンドを名前空間に残さない
+		SysProcAttr: &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL},
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGQUIT)
+
+	// ケーパビリティはスレッドごとのため、コマンドを起動するスレッドでループバックの設定に使ったケーパビリティを外す
+	runtime.LockOSThread()
+	err = unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0)
+	if err == nil {
+		err = cmd.Start()
+	}
+	runtime.UnlockOSThread()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "egress sandbox: %v\n", err)
+		return 127
+	}
+	go func() {
+		for sig := range signals {
+			_ = cmd.Process.Signal(sig)
+		}
+	}()
+
+	err = cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		return 127
+	}
+	return 0
+}
+
+// loopbackUp は名前空間のループバックのインターフェースを有効にします。
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("loopback: %w", err)
+	}
+	defer func() { _ = unix.Close(fd) }()
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return fmt.Errorf("loopback: %w", err)
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return fmt.Errorf("loopback: %w", err)
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	if err := unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr); err != nil {
+		return fmt.Errorf("loopback: %w", err)
+	}
+	return nil
+}
+
+// relay は listener で受け付けた接続を socket のプロキシに中継します。
+func relay(listener net.Listener, socket string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer func() { _ = conn.Close() }()
+			upstream, err := net.Dial("unix", socket)
+			if err != nil {
+				return
+			}
+			defer func() { _ = upstream.Close() }()
+			done := make(chan struct{}, 2)
+			go func() {
+				_, _ = io.Copy(upstream, conn)
+				closeWrite(upstream)
+				done <- struct{}{}
+			}()
+			go func() {
+				_, _ = io.Copy(conn, upstream)
+				closeWrite(conn)
+				done <- struct{}{}
+			}()
+			<-done
+			<-done
+		}()
+	}
+}
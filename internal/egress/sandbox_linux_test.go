@@ -0,0 +1,111 @@
+//go:build linux
+
+package egress
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sandboxClientEnv はテストバイナリを名前空間の中のクライアントとして起動する環境変数で、値は接続先の URL です。
+const sandboxClientEnv = "EGRESS_TEST_CLIENT"
+
+func TestMain(m *testing.M) {
+	RunSandboxIfRequested()
+	if target := os.Getenv(sandboxClientEnv); target != "" {
+		runSandboxClient(target)
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// runSandboxClient は HTTP_PROXY のプロキシ経由と直接の接続で target に接続し、結果を出力します。
+func runSandboxClient(target string) {
+	proxyURL, _ := url.Parse(os.Getenv("HTTP_PROXY"))
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 5 * time.Second}
+	if resp, err := client.Get(target); err != nil {
+		fmt.Printf("proxy: %v\n", err)
+	} else {
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		fmt.Printf("proxy: %d %s\n", resp.StatusCode, body)
+	}
+
+	u, _ := url.Parse(target)
+	if conn, err := net.DialTimeout("tcp", u.Host, 2*time.Second); err != nil {
+		fmt.Println("direct: failed")
+	} else {
+		_ = conn.Close()
+		fmt.Println("direct: connected")
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	}))
+	defer upstream.Close()
+
+	proxy, err := Listen(slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = proxy.Close() }()
+	if err := CheckSandbox(proxy.SocketPath()); err != nil {
+		t.Skipf("namespaces are not available: %v", err)
+	}
+	policy, _ := ParsePolicy([]string{strings.TrimPrefix(upstream.URL, "http://")})
+	proxyURL := proxy.Register("test", policy)
+
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(self)
+	cmd.Env = append(os.Environ(), sandboxClientEnv+"="+upstream.URL, "HTTP_PROXY="+proxyURL)
+	if err := Sandbox(cmd, proxy.SocketPath()); err != nil {
+		t.Fatal(err)
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("sandboxed command error = %v: %s", err, output)
+	}
+
+	// プロキシ経由の接続だけが届き、プロキシを迂回する直接の接続は失敗する
+	if got := string(output); !strings.Contains(got, "proxy: 200 hello") || !strings.Contains(got, "direct: failed") {
+		t.Errorf("output = %q, want the proxied response and a failed direct connection", got)
+	}
+}
+
+func TestSandbox_ExitCode(t *testing.T) {
+	proxy, err := Listen(slog.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = proxy.Close() }()
+	if err := CheckSandbox(proxy.SocketPath()); err != nil {
+		t.Skipf("namespaces are not available: %v", err)
+	}
+
+	// 中継はコマンドの終了コードで終了する
+	cmd := exec.Command("sh", "-c", "exit 3")
+	if err := Sandbox(cmd, proxy.SocketPath()); err != nil {
+		t.Fatal(err)
+	}
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("Run() error = %v, want exit status 3", err)
+	}
+}
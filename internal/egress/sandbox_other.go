@@ -0,0 +1,24 @@
+//go:build !linux
+
+package egress
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// errSandboxUnsupported はネットワーク名前空間のない OS でプロセスの接続を制限できないことを表すエラーです。
+var errSandboxUnsupported = errors.New("egress proxy requires Linux network namespaces")
+
+// Sandbox はネットワーク名前空間のない OS では常にエラーを返します。
+func Sandbox(*exec.Cmd, string) error {
+	return errSandboxUnsupported
+}
+
+// CheckSandbox はネットワーク名前空間のない OS では常にエラーを返します。
+func CheckSandbox(string) error {
+	return errSandboxUnsupported
+}
+
+// RunSandboxIfRequested はネットワーク名前空間のない OS では何もしません。
+func RunSandboxIfRequested() {}
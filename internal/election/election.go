@@ -0,0 +1,146 @@
+// Package election は単一インスタンスでしか動かせないバックエンドのために、
+// レプリカの中から1台だけをリーダーとして選出する機能を提供します。
+//
+// ロックを保持している間だけリーダーとなり、ロックの有効期限の 1/3 ごとに更新します。
+// 更新に失敗した場合は、2台が同時にリーダーとなることを避けるため直ちにリーダーを降ります。
+package election
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultTTL はロックのデフォルトの有効期限です。
+const DefaultTTL = 15 * time.Second
+
+// Lock はリーダーを決めるための排他ロックです。
+type Lock interface {
+	// TryAcquire はロックの取得または保持中のロックの更新を試み、保持しているかどうかを返します。
+	TryAcquire(ctx context.Context) (bool, error)
+	// Holder は現在ロックを保持している ID を返します。誰も保持していない場合は false を返します。
+	Holder(ctx context.Context) (string, bool, error)
+	// Release は自分が保持している場合のみロックを解放します。
+	Release(ctx context.Context) error
+	// Close はロックの保存先への接続を閉じます。
+	Close() error
+}
+
+// Election はロックを使ってリーダーを選出し、現在のリーダーを追跡します。
+type Election struct {
+	lock     Lock
+	id       string
+	interval time.Duration
+	logger   *slog.Logger
+
+	// OnChange はこのレプリカがリーダーになった時と降りた時に呼ばれます（nil で無効）。
+	// Run を呼ぶ前に設定してください。
+	OnChange func(isLeader bool)
+
+	mu       sync.RWMutex
+	isLeader bool
+	leader   string
+}
+
+// New は id（他のレプリカから到達できるこのレプリカのベース URL）で立候補する Election を作成します。
+func New(lock Lock, id string, ttl time.Duration, logger *slog.Logger) *Election {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Election{
+		lock:     lock,
+		id:       id,
+		interval: ttl / 3,
+		logger:   logger,
+	}
+}
+
+// IsLeader はこのレプリカがリーダーかどうかを返します。
+func (e *Election) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.isLeader
+}
+
+// Leader は現在のリーダーの ID を返します。分からない場合は空文字列を返します。
+func (e *Election) Leader() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leader
+}
+
+// Run は ctx が終了するまでロックの取得と更新を繰り返し、終了時にロックを解放します。
+func (e *Election) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		e.tick(ctx)
+
+		select {
+		case <-ctx.Done():
+			e.resign()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick はロックの取得または更新を1回試み、リーダーの状態を更新します。
+func (e *Election) tick(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, e.interval)
+	defer cancel()
+
+	acquired, err := e.lock.TryAcquire(ctx)
+	if err != nil {
+		e.logger.Warn("Leader lock unavailable", "error", err)
+		e.set(false, "")
+		return
+	}
+	if acquired {
+		e.set(true, e.id)
+		return
+	}
+
+	holder, ok, err := e.lock.Holder(ctx)
+	if err != nil || !ok {
+		// 解放直後などでリーダーが分からない場合は次の取得を待つ
+		holder = ""
+	}
+	e.set(false, holder)
+}
+
+// resign はロックを解放してリーダーを降ります。
+func (e *Election) resign() {
+	if !e.IsLeader() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), e.interval)
+	defer cancel()
+	if err := e.lock.Release(ctx); err != nil {
+		e.logger.Warn("Failed to release leader lock", "error", err)
+	}
+	e.set(false, "")
+}
+
+// set はリーダーの状態を更新し、このレプリカのリーダー状態が変わった場合は OnChange を呼びます。
+func (e *Election) set(isLeader bool, leader string) {
+	e.mu.Lock()
+	changed := e.isLeader != isLeader
+	e.isLeader = isLeader
+	e.leader = leader
+	e.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if isLeader {
+		e.logger.Info("Became leader", "id", e.id)
+	} else {
+		e.logger.Info("Stepped down from leader", "id", e.id)
+	}
+	if e.OnChange != nil {
+		e.OnChange(isLeader)
+	}
+}
@@ -0,0 +1,141 @@
+package election
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLock は保持者を直接操作できる Lock です。
+type fakeLock struct {
+	id string
+
+	mu       sync.Mutex
+	holder   string
+	err      error
+	released bool
+}
+
+func (l *fakeLock) TryAcquire(context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return false, l.err
+	}
+	if l.holder == "" {
+		l.holder = l.id
+	}
+	return l.holder == l.id, nil
+}
+
+func (l *fakeLock) Holder(context.Context) (string, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.holder, l.holder != "", nil
+}
+
+func (l *fakeLock) Release(context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holder == l.id {
+		l.holder = ""
+	}
+	l.released = true
+	return nil
+}
+
+func (l *fakeLock) Close() error {
+	return nil
+}
+
+func (l *fakeLock) setHolder(holder string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.holder = holder
+	l.err = err
+}
+
+func newTestElection(lock Lock, id string) *Election {
+	return New(lock, id, 30*time.Millisecond, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestElection_Tick(t *testing.T) {
+	ctx := context.Background()
+	lock := &fakeLock{id: "http://a"}
+	e := newTestElection(lock, "http://a")
+
+	var changes []bool
+	e.OnChange = func(isLeader bool) { changes = append(changes, isLeader) }
+
+	tests := []struct {
+		name       string
+		holder     string
+		err        error
+		wantLeader bool
+		wantHolder string
+	}{
+		{name: "空いているロック_リーダーになる", wantLeader: true, wantHolder: "http://a"},
+		{name: "保持を継続_リーダーのまま", holder: "http://a", wantLeader: true, wantHolder: "http://a"},
+		{name: "他のレプリカが保持_フォロワー", holder: "http://b", wantHolder: "http://b"},
+		{name: "ロックに接続できない_リーダーを降りる", holder: "http://a", err: errors.New("unavailable")},
+		{name: "再取得_リーダーに戻る", holder: "http://a", wantLeader: true, wantHolder: "http://a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lock.setHolder(tt.holder, tt.err)
+			e.tick(ctx)
+			if e.IsLeader() != tt.wantLeader || e.Leader() != tt.wantHolder {
+				t.Errorf("IsLeader() = %v, Leader() = %q, want %v, %q", e.IsLeader(), e.Leader(), tt.wantLeader, tt.wantHolder)
+			}
+		})
+	}
+
+	want := []bool{true, false, true}
+	if len(changes) != len(want) {
+		t.Fatalf("OnChange calls = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("OnChange calls = %v, want %v", changes, want)
+		}
+	}
+}
+
+func TestElection_Run(t *testing.T) {
+	lock := &fakeLock{id: "http://a"}
+	e := newTestElection(lock, "http://a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !e.IsLeader() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !e.IsLeader() {
+		t.Fatal("should become leader")
+	}
+
+	// 停止時にはロックを解放してリーダーを降りる
+	cancel()
+	<-done
+	if e.IsLeader() || !lock.released {
+		t.Errorf("IsLeader() = %v, released = %v, want resigned", e.IsLeader(), lock.released)
+	}
+}
+
+func TestNew_DefaultTTL(t *testing.T) {
+	e := New(&fakeLock{}, "http://a", 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if e.interval != DefaultTTL/3 {
+		t.Errorf("interval = %v, want %v", e.interval, DefaultTTL/3)
+	}
+}
@@ -0,0 +1,73 @@
+package election
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/redis"
+)
+
+// DefaultRedisKey はリーダーロックのデフォルトのキーです。
+const DefaultRedisKey = "tumiki:leader"
+
+// 自分が保持している場合のみ有効期限を延長・削除するスクリプト
+const (
+	renewScript   = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`
+	releaseScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+)
+
+// RedisLock は SET NX と有効期限で実装した Lock です。
+type RedisLock struct {
+	client *redis.Client
+	key    string
+	id     string
+	ttl    time.Duration
+}
+
+// NewRedisLock は redis://[user:password@]host[:port][/db] 形式の URL から RedisLock を作成します。
+// key を共有するレプリカのうち1台だけが ttl の間ロックを保持できます。
+func NewRedisLock(rawURL, key, id string, ttl time.Duration) (*RedisLock, error) {
+	client, err := redis.NewClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		key = DefaultRedisKey
+	}
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &RedisLock{client: client, key: key, id: id, ttl: ttl}, nil
+}
+
+// TryAcquire は空いていればロックを取得し、自分が保持していれば有効期限を延長します。
+func (l *RedisLock) TryAcquire(ctx context.Context) (bool, error) {
+	ttl := strconv.FormatInt(l.ttl.Milliseconds(), 10)
+	if _, ok, err := l.client.Do(ctx, "SET", l.key, l.id, "NX", "PX", ttl); err != nil || ok {
+		return ok, err
+	}
+
+	reply, _, err := l.client.Do(ctx, "EVAL", renewScript, "1", l.key, l.id, ttl)
+	if err != nil {
+		return false, err
+	}
+	return string(reply) == "1", nil
+}
+
+// Holder は現在ロックを保持している ID を返します。
+func (l *RedisLock) Holder(ctx context.Context) (string, bool, error) {
+	reply, ok, err := l.client.Do(ctx, "GET", l.key)
+	return string(reply), ok, err
+}
+
+// Release は自分が保持している場合のみロックを削除します。
+func (l *RedisLock) Release(ctx context.Context) error {
+	_, _, err := l.client.Do(ctx, "EVAL", releaseScript, "1", l.key, l.id)
+	return err
+}
+
+// Close は Redis への接続を閉じます。
+func (l *RedisLock) Close() error {
+	return l.client.Close()
+}
@@ -0,0 +1,99 @@
+package election
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/redistest"
+)
+
+// startFakeRedis は renewScript と releaseScript を解釈するフェイク Redis を起動します。
+func startFakeRedis(t *testing.T) *redistest.Server {
+	t.Helper()
+	fake := redistest.Start(t, "")
+	fake.Handle("EVAL", func(data map[string]string, args []string) string {
+		// args: EVAL script numkeys key id [ttl]
+		if data[args[3]] != args[4] {
+			return ":0\r\n"
+		}
+		if args[1] == releaseScript {
+			delete(data, args[3])
+		}
+		return ":1\r\n"
+	})
+	return fake
+}
+
+func TestRedisLock(t *testing.T) {
+	fake := startFakeRedis(t)
+	ctx := context.Background()
+
+	a, err := NewRedisLock("redis://"+fake.Addr(), "", "http://a", 15*time.Second)
+	if err != nil {
+		t.Fatalf("NewRedisLock() error = %v", err)
+	}
+	t.Cleanup(func() { _ = a.Close() })
+	b, err := NewRedisLock("redis://"+fake.Addr(), "", "http://b", 15*time.Second)
+	if err != nil {
+		t.Fatalf("NewRedisLock() error = %v", err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+
+	if ok, err := a.TryAcquire(ctx); !ok || err != nil {
+		t.Fatalf("a.TryAcquire() = %v, %v, want acquired", ok, err)
+	}
+	if ok, err := b.TryAcquire(ctx); ok || err != nil {
+		t.Fatalf("b.TryAcquire() = %v, %v, want not acquired", ok, err)
+	}
+	// 保持中の取得は有効期限の延長になる
+	if ok, err := a.TryAcquire(ctx); !ok || err != nil {
+		t.Fatalf("a.TryAcquire() renew = %v, %v, want acquired", ok, err)
+	}
+	if holder, ok, err := b.Holder(ctx); holder != "http://a" || !ok || err != nil {
+		t.Errorf("Holder() = %q, %v, %v, want http://a", holder, ok, err)
+	}
+
+	// 保持していないレプリカの解放は無視される
+	if err := b.Release(ctx); err != nil {
+		t.Fatalf("b.Release() error = %v", err)
+	}
+	if holder, _, _ := b.Holder(ctx); holder != "http://a" {
+		t.Errorf("Holder() after foreign release = %q, want http://a", holder)
+	}
+
+	if err := a.Release(ctx); err != nil {
+		t.Fatalf("a.Release() error = %v", err)
+	}
+	if _, ok, _ := b.Holder(ctx); ok {
+		t.Error("lock should be free after release")
+	}
+	if ok, _ := b.TryAcquire(ctx); !ok {
+		t.Error("b should acquire the released lock")
+	}
+
+	if !strings.Contains(strings.Join(fake.Commands(), "\n"), "SET tumiki:leader http://a NX PX 15000") {
+		t.Errorf("commands = %q, want SET NX PX", fake.Commands())
+	}
+}
+
+func TestRedisLock_Errors(t *testing.T) {
+	if _, err := NewRedisLock("memcached://localhost", "", "http://a", 0); err == nil {
+		t.Error("NewRedisLock() with unsupported scheme expected error but got none")
+	}
+
+	// EVAL に対応していないサーバーでは更新に失敗する
+	fake := redistest.Start(t, "")
+	fake.Set("custom", "http://b")
+	l, err := NewRedisLock("redis://"+fake.Addr(), "custom", "http://a", 0)
+	if err != nil {
+		t.Fatalf("NewRedisLock() error = %v", err)
+	}
+	if l.ttl != DefaultTTL {
+		t.Errorf("ttl = %v, want %v", l.ttl, DefaultTTL)
+	}
+	if _, err := l.TryAcquire(context.Background()); err == nil {
+		t.Error("TryAcquire() expected error but got none")
+	}
+}
@@ -0,0 +1,265 @@
+// Package gcpauth は Google Cloud の API を呼び出すための OAuth 2.0 のアクセストークンを取得します。
+// 必要なのはアクセストークンだけなので、Google のクライアントライブラリを使わずにトークンのエンドポイントを直接呼び出します。
+package gcpauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CloudPlatformScope は Google Cloud の全ての API を呼び出せるスコープです。
+	CloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+	// defaultTokenURL はサービスアカウントのキーに token_uri がない場合のトークンのエンドポイントです。
+	defaultTokenURL = "https://oauth2.googleapis.com/token"
+
+	// defaultMetadataHost は GCE・GKE のメタデータサーバーです。GCE_METADATA_HOST で変更できます。
+	defaultMetadataHost = "metadata.google.internal"
+
+	// refreshBefore はアクセストークンの期限のこの時間前に取得し直します。
+	refreshBefore = 5 * time.Minute
+
+	// sourceTimeout は ctx に期限がない場合のアクセストークンの取得のタイムアウトです。
+	sourceTimeout = 10 * time.Second
+)
+
+// Token はアクセストークンとその期限です。
+type Token struct {
+	AccessToken string
+	Expiry      time.Time
+}
+
+// Source はアクセストークンを返します。期限の前に取得し直します。複数の goroutine から同時に使用できます。
+//
+// 認証情報は Google のクライアントライブラリと同じ順に探します。
+//
+//  1. GOOGLE_APPLICATION_CREDENTIALS のキーファイル（サービスアカウントのキー、gcloud auth application-default login のユーザー）
+//  2. GCE・GKE のメタデータサーバー（GKE の Workload Identity で Pod に割り当てたサービスアカウント）
+type Source struct {
+	fetch func(ctx context.Context) (Token, error)
+	now   func() time.Time
+	mu    sync.Mutex
+	token Token
+}
+
+// SourceFromEnv は環境変数から認証情報の取得方法を選び、scope のアクセストークンを返す Source を作成します。
+// キーファイルが読み取れない場合と、対応していない種類の場合はエラーを返します。
+func SourceFromEnv(scope string) (*Source, error) {
+	client := &http.Client{}
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read GOOGLE_APPLICATION_CREDENTIALS: %w", err)
+		}
+		return sourceFromKey(client, data, scope)
+	}
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = defaultMetadataHost
+	}
+	endpoint := "http://" + host + "/computeMetadata/v1/instance/service-accounts/default/token"
+	return newSource(func(ctx context.Context) (Token, error) {
+		return metadataToken(ctx, client, endpoint)
+	}), nil
+}
+
+func newSource(fetch func(ctx context.Context) (Token, error)) *Source {
+	return &Source{fetch: fetch, now: time.Now}
+}
+
+// StaticSource は常に accessToken を返す Source を作成します。
+func StaticSource(accessToken string) *Source {
+	return &Source{token: Token{AccessToken: accessToken}, now: time.Now}
+}
+
+// Token は有効なアクセストークンを返します。期限が近いものは取得し直します。
+func (s *Source) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token.AccessToken != "" && (s.fetch == nil || s.token.Expiry.IsZero() || s.now().Before(s.token.Expiry.Add(-refreshBefore))) {
+		return s.token.AccessToken, nil
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sourceTimeout)
+		defer cancel()
+	}
+	token, err := s.fetch(ctx)
+	if err != nil {
+		return "", fmt.Errorf("get Google Cloud access token: %w", err)
+	}
+	s.token = token
+	return token.AccessToken, nil
+}
+
+// credentialsFile は GOOGLE_APPLICATION_CREDENTIALS のキーファイルです。
+type credentialsFile struct {
+	Type string `json:"type"`
+
+	// サービスアカウントのキー（"service_account"）
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+
+	// gcloud auth application-default login のユーザー（"authorized_user"）
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// sourceFromKey はキーファイルの種類に応じてアクセストークンを取得する Source を作成します。
+func sourceFromKey(client *http.Client, data []byte, scope string) (*Source, error) {
+	var key credentialsFile
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("parse GOOGLE_APPLICATION_CREDENTIALS: %w", err)
+	}
+	tokenURL := key.TokenURI
+	if tokenURL == "" {
+		tokenURL = defaultTokenURL
+	}
+	switch key.Type {
+	case "service_account":
+		signer, err := parsePrivateKey(key.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("parse service account private key: %w", err)
+		}
+		return newSource(func(ctx context.Context) (Token, error) {
+			assertion, err := signAssertion(signer, key.PrivateKeyID, key.ClientEmail, scope, tokenURL, time.Now())
+			if err != nil {
+				return Token{}, err
+			}
+			return exchangeToken(ctx, client, tokenURL, url.Values{
+				"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+				"assertion":  {assertion},
+			})
+		}), nil
+	case "authorized_user":
+		return newSource(func(ctx context.Context) (Token, error) {
+			return exchangeToken(ctx, client, tokenURL, url.Values{
+				"grant_type":    {"refresh_token"},
+				"client_id":     {key.ClientID},
+				"client_secret": {key.ClientSecret},
+				"refresh_token": {key.RefreshToken},
+			})
+		}), nil
+	default:
+		return nil, fmt.Errorf("unsupported credentials type %q in GOOGLE_APPLICATION_CREDENTIALS: use a service account key or authorized user credentials", key.Type)
+	}
+}
+
+// parsePrivateKey はサービスアカウントのキーの PEM の RSA 秘密鍵を読み取ります。
+func parsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		// 古いキーは PKCS #1 の形式
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// signAssertion はアクセストークンと交換する、サービスアカウントが署名した JWT（RS256）を作成します。
+func signAssertion(key *rsa.PrivateKey, keyID, email, scope, audience string, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iss":   email,
+		"scope": scope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// tokenResponse はトークンのエンドポイントとメタデータサーバーのレスポンスです。
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// token は取得した時刻からの期限を計算した Token を返します。
+func (r tokenResponse) token(now time.Time) (Token, error) {
+	if r.AccessToken == "" {
+		return Token{}, errors.New("response has no access_token")
+	}
+	return Token{AccessToken: r.AccessToken, Expiry: now.Add(time.Duration(r.ExpiresIn) * time.Second)}, nil
+}
+
+// exchangeToken はトークンのエンドポイントに form を POST し、アクセストークンを取得します。
+func exchangeToken(ctx context.Context, client *http.Client, tokenURL string, form url.Values) (Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doTokenRequest(client, req)
+}
+
+// metadataToken はメタデータサーバーからインスタンス（GKE では Pod）のサービスアカウントのアクセストークンを取得します。
+func metadataToken(ctx context.Context, client *http.Client, endpoint string) (Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	token, err := doTokenRequest(client, req)
+	if err != nil {
+		return Token{}, fmt.Errorf("metadata server: %w (set GOOGLE_APPLICATION_CREDENTIALS outside Google Cloud)", err)
+	}
+	return token, nil
+}
+
+func doTokenRequest(client *http.Client, req *http.Request) (Token, error) {
+	issued := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return Token{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return Token{}, fmt.Errorf("token endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var body tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Token{}, fmt.Errorf("decode token response: %w", err)
+	}
+	return body.token(issued)
+}
@@ -0,0 +1,192 @@
+package gcpauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCredentials は key をキーファイルに書き込み、GOOGLE_APPLICATION_CREDENTIALS に設定します。
+func writeCredentials(t *testing.T, key map[string]string) {
+	t.Helper()
+	data, _ := json.Marshal(key)
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+}
+
+func TestSourceFromEnv_メタデータサーバー(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		calls++
+		_, _ = w.Write([]byte(`{"access_token":"ya29.metadata","expires_in":3599,"token_type":"Bearer"}`))
+	}))
+	defer server.Close()
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+
+	source, err := SourceFromEnv(CloudPlatformScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		token, err := source.Token(context.Background())
+		if err != nil {
+			t.Fatalf("Token() error = %v", err)
+		}
+		if token != "ya29.metadata" {
+			t.Errorf("Token() = %q", token)
+		}
+	}
+	// 期限まで時間があるトークンは取得し直さない
+	if calls != 1 {
+		t.Errorf("metadata server calls = %d, want 1", calls)
+	}
+
+	// 期限が近づいたら取得し直す
+	source.now = func() time.Time { return time.Now().Add(time.Hour - refreshBefore/2) }
+	if _, err := source.Token(context.Background()); err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("metadata server calls = %d, want 2 after nearing the expiry", calls)
+	}
+}
+
+func TestSourceFromEnv_サービスアカウント(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	var tokenURL string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// サービスアカウントの鍵で署名した JWT を受け取る
+		parts := strings.Split(r.Form.Get("assertion"), ".")
+		if len(parts) != 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var claims map[string]any
+		_ = json.Unmarshal(payload, &claims)
+		if claims["iss"] != "mcp@project.iam.gserviceaccount.com" || claims["scope"] != CloudPlatformScope || claims["aud"] != tokenURL {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"ya29.sa","expires_in":3600}`))
+	}))
+	defer server.Close()
+	tokenURL = server.URL + "/token"
+	writeCredentials(t, map[string]string{
+		"type":           "service_account",
+		"client_email":   "mcp@project.iam.gserviceaccount.com",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"private_key_id": "key-1",
+		"token_uri":      tokenURL,
+	})
+
+	source, err := SourceFromEnv(CloudPlatformScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if token != "ya29.sa" {
+		t.Errorf("Token() = %q", token)
+	}
+}
+
+func TestSourceFromEnv_ユーザーの認証情報(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("refresh_token") != "1//refresh" || r.Form.Get("client_id") != "client" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"ya29.user","expires_in":3600}`))
+	}))
+	defer server.Close()
+	writeCredentials(t, map[string]string{
+		"type":          "authorized_user",
+		"client_id":     "client",
+		"client_secret": "secret",
+		"refresh_token": "1//refresh",
+		"token_uri":     server.URL,
+	})
+
+	source, err := SourceFromEnv(CloudPlatformScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := source.Token(context.Background()); err != nil || token != "ya29.user" {
+		t.Errorf("Token() = %q, %v", token, err)
+	}
+}
+
+func TestSourceFromEnv_Error(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     map[string]string
+		wantErr string
+	}{
+		{name: "対応していない種類_エラー", key: map[string]string{"type": "external_account"}, wantErr: "unsupported credentials type"},
+		{name: "不正な秘密鍵_エラー", key: map[string]string{"type": "service_account", "private_key": "invalid"}, wantErr: "private key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeCredentials(t, tt.key)
+			_, err := SourceFromEnv(CloudPlatformScope)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("SourceFromEnv() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("キーファイルがない_エラー", func(t *testing.T) {
+		t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", filepath.Join(t.TempDir(), "missing.json"))
+		if _, err := SourceFromEnv(CloudPlatformScope); err == nil {
+			t.Error("SourceFromEnv() error = nil, want an error for a missing key file")
+		}
+	})
+}
+
+func TestStaticSource(t *testing.T) {
+	token, err := StaticSource("static").Token(context.Background())
+	if err != nil || token != "static" {
+		t.Errorf("Token() = %q, %v", token, err)
+	}
+}
@@ -0,0 +1,63 @@
+// Package hashring はキーをノードに割り当てるコンシステントハッシュを提供します。
+//
+// ノードが増減しても大部分のキーの割り当てが変わらないため、
+// バックエンドのキャッシュを温かいまま保つためのリクエストの振り分けに使用します。
+package hashring
+
+import (
+	"hash/crc32"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// DefaultVirtualNodes は1ノードあたりの仮想ノード数のデフォルト値です。
+const DefaultVirtualNodes = 128
+
+// Ring はノードを仮想ノードとしてハッシュ空間に配置したリングです。作成後は変更できません。
+type Ring struct {
+	hashes []uint32
+	owners map[uint32]string
+}
+
+// New は nodes を virtualNodes 個ずつ配置した Ring を作成します。
+// 重複したノードは1つとして扱い、virtualNodes が 0 以下の場合は DefaultVirtualNodes を使用します。
+func New(nodes []string, virtualNodes int) *Ring {
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+
+	// 指定順に依存しないよう、ハッシュの衝突時は辞書順で先のノードを優先する
+	nodes = slices.Compact(slices.Sorted(slices.Values(nodes)))
+
+	r := &Ring{owners: make(map[uint32]string, len(nodes)*virtualNodes)}
+	for _, node := range nodes {
+		for i := range virtualNodes {
+			h := hash(node + "#" + strconv.Itoa(i))
+			if _, exists := r.owners[h]; exists {
+				continue
+			}
+			r.owners[h] = node
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	slices.Sort(r.hashes)
+	return r
+}
+
+// Get はキーを担当するノードを返します。ノードがない場合は空文字列を返します。
+func (r *Ring) Get(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	h := hash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]]
+}
+
+func hash(s string) uint32 {
+	return crc32.ChecksumIEEE([]byte(s))
+}
@@ -0,0 +1,49 @@
+package hashring
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRing_Get(t *testing.T) {
+	nodes := []string{"http://a", "http://b", "http://c"}
+	r := New(nodes, 0)
+
+	// 同じキーは常に同じノードに割り当てられ、ノードの指定順にも依存しない
+	reordered := New([]string{"http://c", "http://a", "http://b", "http://a"}, 0)
+	counts := map[string]int{}
+	for i := range 3000 {
+		key := fmt.Sprintf("tenant-%d", i)
+		node := r.Get(key)
+		if node != r.Get(key) || node != reordered.Get(key) {
+			t.Fatalf("Get(%q) is not stable", key)
+		}
+		counts[node]++
+	}
+
+	// どのノードにも偏りなく割り当てられる
+	for _, node := range nodes {
+		if counts[node] < 600 {
+			t.Errorf("node %s got %d of 3000 keys, want a fair share", node, counts[node])
+		}
+	}
+}
+
+func TestRing_RemoveNode(t *testing.T) {
+	before := New([]string{"http://a", "http://b", "http://c"}, 0)
+	after := New([]string{"http://a", "http://b"}, 0)
+
+	// 削除されたノード以外が担当していたキーは移動しない
+	for i := range 1000 {
+		key := fmt.Sprintf("session-%d", i)
+		if owner := before.Get(key); owner != "http://c" && after.Get(key) != owner {
+			t.Errorf("key %q moved from %s to %s", key, owner, after.Get(key))
+		}
+	}
+}
+
+func TestRing_Empty(t *testing.T) {
+	if got := New(nil, 4).Get("key"); got != "" {
+		t.Errorf("Get() on empty ring = %q, want empty", got)
+	}
+}
@@ -0,0 +1,117 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// IDMap はクライアントが送ったリクエストの ID を一意な内部 ID に書き換え、レスポンスの ID を元に戻します。
+// 複数のクライアントが同じ ID（数値の 1 と文字列の "1" を含む）を同時に使っても、1つの送信先で区別できます。
+// 内部 ID は 1 から順に増える数値で、ID ごとに値（レスポンスを待つチャネルなど）を記録できます。
+type IDMap[V any] struct {
+	mu      sync.Mutex
+	next    uint64
+	entries map[string]idEntry[V]
+}
+
+// idEntry は内部 ID に対応する元の ID と記録した値です。
+type idEntry[V any] struct {
+	id    json.RawMessage
+	value V
+}
+
+// NewIDMap は空の IDMap を作成します。
+func NewIDMap[V any]() *IDMap[V] {
+	return &IDMap[V]{entries: make(map[string]idEntry[V])}
+}
+
+// Assign はリクエストの ID を新しい内部 ID に書き換えたメッセージと内部 ID を返し、元の ID と value を記録します。
+// ID を持たないメッセージ（通知）はエラーにします。
+func (m *IDMap[V]) Assign(msg []byte, value V) ([]byte, json.RawMessage, error) {
+	fields, err := decodeFields(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	id := fields["id"]
+	if !(&Message{ID: id}).HasID() {
+		return nil, nil, fmt.Errorf("assign json-rpc id: message has no id")
+	}
+
+	m.mu.Lock()
+	m.next++
+	key := strconv.FormatUint(m.next, 10)
+	m.entries[key] = idEntry[V]{id: id, value: value}
+	m.mu.Unlock()
+
+	fields["id"] = json.RawMessage(key)
+	rewritten, err := json.Marshal(fields)
+	if err != nil {
+		m.Release(json.RawMessage(key))
+		return nil, nil, err
+	}
+	return rewritten, json.RawMessage(key), nil
+}
+
+// Restore はレスポンスの内部 ID を元の ID に戻したメッセージと記録した値を返し、対応を削除します。
+// 記録していない ID の場合は false を返します。
+func (m *IDMap[V]) Restore(msg []byte) ([]byte, V, bool) {
+	var zero V
+	fields, err := decodeFields(msg)
+	if err != nil {
+		return nil, zero, false
+	}
+	key := string(bytes.TrimSpace(fields["id"]))
+
+	m.mu.Lock()
+	entry, ok := m.entries[key]
+	delete(m.entries, key)
+	m.mu.Unlock()
+	if !ok {
+		return nil, zero, false
+	}
+
+	fields["id"] = entry.id
+	restored, err := json.Marshal(fields)
+	if err != nil {
+		return nil, zero, false
+	}
+	return restored, entry.value, true
+}
+
+// Release はレスポンスを待たなくなった内部 ID の対応を削除します。
+func (m *IDMap[V]) Release(key json.RawMessage) {
+	m.mu.Lock()
+	delete(m.entries, string(bytes.TrimSpace(key)))
+	m.mu.Unlock()
+}
+
+// Len はレスポンスを待っている内部 ID の数を返します。
+func (m *IDMap[V]) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+// WithID はメッセージの ID を id に置き換えます。その他のフィールドはそのまま残します。
+func WithID(msg []byte, id json.RawMessage) ([]byte, error) {
+	fields, err := decodeFields(msg)
+	if err != nil {
+		return nil, err
+	}
+	fields["id"] = id
+	return json.Marshal(fields)
+}
+
+func decodeFields(msg []byte) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &fields); err != nil {
+		return nil, fmt.Errorf("parse json-rpc message: %w", err)
+	}
+	if fields == nil {
+		return nil, fmt.Errorf("parse json-rpc message: not an object")
+	}
+	return fields, nil
+}
@@ -0,0 +1,167 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestIDMap_AssignRestore(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "数値のID_元に戻る", input: `{"jsonrpc":"2.0","id":1,"method":"ping"}`, want: `1`},
+		{name: "文字列のID_元に戻る", input: `{"jsonrpc":"2.0","id":"1","method":"ping"}`, want: `"1"`},
+		{name: "小数のID_表記のまま戻る", input: `{"jsonrpc":"2.0","id":1.50,"method":"ping"}`, want: `1.50`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := NewIDMap[string]()
+			request, key, err := ids.Assign([]byte(tt.input), "value")
+			if err != nil {
+				t.Fatalf("Assign() error = %v", err)
+			}
+			msg, _ := Parse(request)
+			if !SameID(msg.ID, key) || msg.Method != "ping" {
+				t.Errorf("Assign() = %s, want id %s", request, key)
+			}
+
+			response := fmt.Sprintf(`{"jsonrpc":"2.0","id": %s ,"result":{}}`, key)
+			restored, value, ok := ids.Restore([]byte(response))
+			if !ok || value != "value" {
+				t.Fatalf("Restore() = %s, %q, %v", restored, value, ok)
+			}
+			msg, _ = Parse(restored)
+			if string(msg.ID) != tt.want || string(msg.Result) != `{}` {
+				t.Errorf("Restore() = %s, want id %s", restored, tt.want)
+			}
+			if ids.Len() != 0 {
+				t.Errorf("Len() after Restore = %d, want 0", ids.Len())
+			}
+		})
+	}
+}
+
+func TestIDMap_同じIDの衝突_区別される(t *testing.T) {
+	ids := NewIDMap[int]()
+	inputs := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"a"}`,
+		`{"jsonrpc":"2.0","id":"1","method":"b"}`,
+		`{"jsonrpc":"2.0","id":1,"method":"c"}`,
+	}
+	keys := make([]json.RawMessage, len(inputs))
+	for i, input := range inputs {
+		_, key, err := ids.Assign([]byte(input), i)
+		if err != nil {
+			t.Fatalf("Assign() error = %v", err)
+		}
+		for _, prev := range keys[:i] {
+			if SameID(prev, key) {
+				t.Fatalf("Assign() reused internal id %s", key)
+			}
+		}
+		keys[i] = key
+	}
+
+	// 送った順と異なる順で届いても、それぞれ元の ID と値に戻る
+	for _, i := range []int{2, 0, 1} {
+		restored, value, ok := ids.Restore([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":null}`, keys[i])))
+		msg, _ := Parse(restored)
+		wantID, _ := Parse([]byte(inputs[i]))
+		if !ok || value != i || !SameID(msg.ID, wantID.ID) {
+			t.Errorf("Restore(%s) = %s, %d, %v, want id %s and value %d", keys[i], restored, value, ok, wantID.ID, i)
+		}
+	}
+}
+
+func TestIDMap_並行実行_内部IDが一意(t *testing.T) {
+	ids := NewIDMap[struct{}]()
+	const n = 100
+	keys := make(chan string, n)
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, key, err := ids.Assign([]byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`), struct{}{})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			keys <- string(key)
+		}()
+	}
+	wg.Wait()
+	close(keys)
+
+	seen := make(map[string]bool)
+	for key := range keys {
+		if seen[key] {
+			t.Errorf("Assign() reused internal id %s", key)
+		}
+		seen[key] = true
+	}
+	if ids.Len() != n {
+		t.Errorf("Len() = %d, want %d", ids.Len(), n)
+	}
+}
+
+func TestIDMap_Error(t *testing.T) {
+	ids := NewIDMap[int]()
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "通知_エラー", input: `{"jsonrpc":"2.0","method":"notifications/initialized"}`},
+		{name: "nullのID_エラー", input: `{"jsonrpc":"2.0","id":null,"method":"ping"}`},
+		{name: "不正なJSON_エラー", input: `{"jsonrpc":`},
+		{name: "配列_エラー", input: `[{"jsonrpc":"2.0","id":1,"method":"ping"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ids.Assign([]byte(tt.input), 0); err == nil {
+				t.Error("Assign() error = nil")
+			}
+		})
+	}
+	if ids.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", ids.Len())
+	}
+}
+
+func TestIDMap_未知のIDとRelease_戻さない(t *testing.T) {
+	ids := NewIDMap[int]()
+	if _, _, ok := ids.Restore([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`)); ok {
+		t.Error("Restore() of an unknown id ok = true")
+	}
+
+	_, key, err := ids.Assign([]byte(`{"jsonrpc":"2.0","id":"a","method":"ping"}`), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids.Release(key)
+	// 待つのをやめた後に遅れて届くレスポンスは破棄する
+	if _, _, ok := ids.Restore([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":{}}`, key))); ok {
+		t.Error("Restore() after Release ok = true")
+	}
+	// 文字列の内部 ID は数値の内部 ID と区別する
+	_, key, _ = ids.Assign([]byte(`{"jsonrpc":"2.0","id":"a","method":"ping"}`), 2)
+	if _, _, ok := ids.Restore([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":"%s","result":{}}`, key))); ok {
+		t.Error("Restore() of a string id ok = true")
+	}
+}
+
+func TestWithID(t *testing.T) {
+	got, err := WithID([]byte(`{"jsonrpc":"2.0","id":1,"result":{"a":1}}`), json.RawMessage(`"x"`))
+	if err != nil {
+		t.Fatalf("WithID() error = %v", err)
+	}
+	msg, _ := Parse(got)
+	if string(msg.ID) != `"x"` || string(msg.Result) != `{"a":1}` {
+		t.Errorf("WithID() = %s", got)
+	}
+}
@@ -0,0 +1,128 @@
+// Package jsonrpc は MCP で使用される JSON-RPC 2.0 メッセージの最小限の表現を提供します。
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Version は JSON-RPC のバージョン文字列です。
+const Version = "2.0"
+
+// JSON-RPC 標準エラーコード
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Message は JSON-RPC のリクエスト・通知・レスポンスのいずれかを表します。
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error は JSON-RPC のエラーオブジェクトです。
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
+// Parse は1行分の JSON-RPC メッセージをパースします。
+func Parse(data []byte) (*Message, error) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("parse json-rpc message: %w", err)
+	}
+	return &msg, nil
+}
+
+// HasID は ID を持つ（通知ではない）メッセージかどうかを返します。
+func (m *Message) HasID() bool {
+	return len(m.ID) > 0 && !bytes.Equal(m.ID, []byte("null"))
+}
+
+// IsRequest はリクエスト（メソッドと ID を持つ）かどうかを返します。
+func (m *Message) IsRequest() bool {
+	return m.Method != "" && m.HasID()
+}
+
+// IsNotification は通知（メソッドを持ち ID を持たない）かどうかを返します。
+func (m *Message) IsNotification() bool {
+	return m.Method != "" && !m.HasID()
+}
+
+// IsResponse はレスポンス（メソッドを持たず ID を持つ）かどうかを返します。
+func (m *Message) IsResponse() bool {
+	return m.Method == "" && m.HasID()
+}
+
+// SameID は2つの ID が同一かどうかを比較します。
+// 数値の 1 と文字列の "1" は異なる ID として扱います。
+func SameID(a, b json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(a), bytes.TrimSpace(b))
+}
+
+// NewRequest はリクエストメッセージを JSON にエンコードします。
+func NewRequest(id any, method string, params any) ([]byte, error) {
+	return encode(id, method, params)
+}
+
+// NewNotification は通知メッセージを JSON にエンコードします。
+func NewNotification(method string, params any) ([]byte, error) {
+	return encode(nil, method, params)
+}
+
+// NewErrorResponse はエラーレスポンスを JSON にエンコードします。
+func NewErrorResponse(id json.RawMessage, code int, message string) []byte {
+	return NewErrorResponseWithData(id, code, message, nil)
+}
+
+// NewErrorResponseWithData はエラーの詳細を data に含めたエラーレスポンスを JSON にエンコードします。
+// data は有効な JSON でなければなりません。
+func NewErrorResponseWithData(id json.RawMessage, code int, message string, data json.RawMessage) []byte {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	// フィールドは全て JSON エンコード可能なためエラーは発生しない
+	encoded, _ := json.Marshal(struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Error   Error           `json:"error"`
+	}{
+		JSONRPC: Version,
+		ID:      id,
+		Error:   Error{Code: code, Message: message, Data: data},
+	})
+	return encoded
+}
+
+func encode(id any, method string, params any) ([]byte, error) {
+	msg := map[string]any{
+		"jsonrpc": Version,
+		"method":  method,
+	}
+	if id != nil {
+		msg["id"] = id
+	}
+	if params != nil {
+		msg["params"] = params
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("encode json-rpc message: %w", err)
+	}
+	return data, nil
+}
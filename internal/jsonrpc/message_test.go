@@ -0,0 +1,133 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name             string
+		input            string
+		wantRequest      bool
+		wantNotification bool
+		wantResponse     bool
+		wantError        bool
+	}{
+		{name: "リクエスト_リクエストと判定される", input: `{"jsonrpc":"2.0","id":1,"method":"ping"}`, wantRequest: true},
+		{name: "文字列IDのリクエスト_リクエストと判定される", input: `{"jsonrpc":"2.0","id":"a","method":"ping"}`, wantRequest: true},
+		{name: "通知_通知と判定される", input: `{"jsonrpc":"2.0","method":"notifications/initialized"}`, wantNotification: true},
+		{name: "IDがnullの通知_通知と判定される", input: `{"jsonrpc":"2.0","id":null,"method":"x"}`, wantNotification: true},
+		{name: "成功レスポンス_レスポンスと判定される", input: `{"jsonrpc":"2.0","id":1,"result":{}}`, wantResponse: true},
+		{name: "エラーレスポンス_レスポンスと判定される", input: `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"x"}}`, wantResponse: true},
+		{name: "不正なJSON_エラーを返す", input: `{"jsonrpc":`, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := Parse([]byte(tt.input))
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("Parse() expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() unexpected error: %v", err)
+			}
+			if msg.IsRequest() != tt.wantRequest {
+				t.Errorf("IsRequest() = %v, want %v", msg.IsRequest(), tt.wantRequest)
+			}
+			if msg.IsNotification() != tt.wantNotification {
+				t.Errorf("IsNotification() = %v, want %v", msg.IsNotification(), tt.wantNotification)
+			}
+			if msg.IsResponse() != tt.wantResponse {
+				t.Errorf("IsResponse() = %v, want %v", msg.IsResponse(), tt.wantResponse)
+			}
+		})
+	}
+}
+
+func TestSameID(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		expected bool
+	}{
+		{name: "同じ数値_一致する", a: "1", b: "1", expected: true},
+		{name: "前後の空白_無視される", a: " 1", b: "1 ", expected: true},
+		{name: "数値と文字列_一致しない", a: "1", b: `"1"`, expected: false},
+		{name: "異なる文字列_一致しない", a: `"a"`, b: `"b"`, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SameID(json.RawMessage(tt.a), json.RawMessage(tt.b)); got != tt.expected {
+				t.Errorf("SameID(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewRequestAndNotification(t *testing.T) {
+	req, err := NewRequest(1, "tools/list", map[string]any{})
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	if string(req) != `{"id":1,"jsonrpc":"2.0","method":"tools/list","params":{}}` {
+		t.Errorf("NewRequest() = %s", req)
+	}
+
+	notif, err := NewNotification("notifications/initialized", nil)
+	if err != nil {
+		t.Fatalf("NewNotification() error = %v", err)
+	}
+	if string(notif) != `{"jsonrpc":"2.0","method":"notifications/initialized"}` {
+		t.Errorf("NewNotification() = %s", notif)
+	}
+
+	if _, err := NewRequest(1, "x", func() {}); err == nil {
+		t.Error("NewRequest() with unencodable params expected error but got none")
+	}
+}
+
+func TestNewErrorResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       json.RawMessage
+		expected string
+	}{
+		{
+			name:     "IDあり_IDが設定される",
+			id:       json.RawMessage(`"abc"`),
+			expected: `{"jsonrpc":"2.0","id":"abc","error":{"code":-32601,"message":"not found"}}`,
+		},
+		{
+			name:     "IDなし_nullが設定される",
+			id:       nil,
+			expected: `{"jsonrpc":"2.0","id":null,"error":{"code":-32601,"message":"not found"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(NewErrorResponse(tt.id, CodeMethodNotFound, "not found")); got != tt.expected {
+				t.Errorf("NewErrorResponse() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewErrorResponseWithData(t *testing.T) {
+	got := string(NewErrorResponseWithData(json.RawMessage(`1`), CodeInternalError, "failed", json.RawMessage(`{"stderr":"boom"}`)))
+	if want := `{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"failed","data":{"stderr":"boom"}}}`; got != want {
+		t.Errorf("NewErrorResponseWithData() = %s, want %s", got, want)
+	}
+}
+
+func TestError_Error(t *testing.T) {
+	err := &Error{Code: CodeParseError, Message: "parse error"}
+	if err.Error() != "json-rpc error -32700: parse error" {
+		t.Errorf("Error() = %s", err.Error())
+	}
+}
@@ -0,0 +1,266 @@
+// Package jwtauth は Authorization ヘッダーの Bearer トークンを JWT として検証し、
+// クライアントを識別するプリンシパルを取り出す機能を提供します。
+//
+// 署名は共有鍵の HS256 と、公開鍵の RS256・ES256 に対応します。
+// 鍵は起動時に渡したものだけを使い、トークンのヘッダーで鍵や "none" を指定させません。
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultPrincipalClaim はプリンシパルとして使うデフォルトのクレームです。
+const DefaultPrincipalClaim = "sub"
+
+// DefaultLeeway は exp・nbf の検証で許容する時計のずれのデフォルト値です。
+const DefaultLeeway = 30 * time.Second
+
+var (
+	// ErrInvalidToken はトークンの形式・署名・有効期間・発行者・audience のいずれかが不正であることを表します。
+	ErrInvalidToken = errors.New("invalid JWT")
+	// ErrNoKey は検証に使う鍵が設定されていないことを表します。
+	ErrNoKey = errors.New("JWT verification requires a secret or a public key")
+)
+
+// Config は JWT の検証の設定です。
+type Config struct {
+	// Secret は HS256 の共有鍵です。
+	Secret []byte
+	// PublicKeyFile は RS256・ES256 の検証に使う PEM 形式の公開鍵（または証明書）のファイルです。
+	PublicKeyFile string
+	// Issuer を指定した場合は iss が一致するトークンだけを受け付けます。
+	Issuer string
+	// Audience を指定した場合は aud に含むトークンだけを受け付けます。
+	Audience string
+	// PrincipalClaim はプリンシパルとして使うクレームです（空文字列で DefaultPrincipalClaim）。
+	PrincipalClaim string
+	// Leeway は exp・nbf の検証で許容する時計のずれです（0 で DefaultLeeway）。
+	Leeway time.Duration
+}
+
+// Verifier は設定した鍵で JWT を検証します。
+type Verifier struct {
+	cfg       Config
+	publicKey crypto.PublicKey
+	now       func() time.Time
+}
+
+// Claims は検証したトークンのクレームです。
+type Claims map[string]any
+
+// NewVerifier は cfg で JWT を検証する Verifier を作成します。
+func NewVerifier(cfg Config) (*Verifier, error) {
+	if cfg.PrincipalClaim == "" {
+		cfg.PrincipalClaim = DefaultPrincipalClaim
+	}
+	if cfg.Leeway == 0 {
+		cfg.Leeway = DefaultLeeway
+	}
+	v := &Verifier{cfg: cfg, now: time.Now}
+	if cfg.PublicKeyFile != "" {
+		key, err := loadPublicKey(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		v.publicKey = key
+	}
+	if len(cfg.Secret) == 0 && v.publicKey == nil {
+		return nil, ErrNoKey
+	}
+	return v, nil
+}
+
+// loadPublicKey は PEM 形式の公開鍵または証明書から RSA・ECDSA の公開鍵を読み込みます。
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read JWT public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("JWT public key %s: no PEM block", path)
+	}
+	var key any
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("JWT public key %s: %w", path, err)
+		}
+		key = cert.PublicKey
+	case "RSA PUBLIC KEY":
+		if key, err = x509.ParsePKCS1PublicKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("JWT public key %s: %w", path, err)
+		}
+	default:
+		if key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("JWT public key %s: %w", path, err)
+		}
+	}
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("JWT public key %s: unsupported key type %T", path, key)
+	}
+}
+
+// Verify はトークンの署名・有効期間・発行者・audience を検証し、クレームを返します。
+func (v *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	if err := v.verifySignature(header.Alg, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Principal は検証したクレームから PrincipalClaim の値を返します。文字列でない場合は空文字列を返します。
+func (v *Verifier) Principal(claims Claims) string {
+	principal, _ := claims[v.cfg.PrincipalClaim].(string)
+	return principal
+}
+
+// claimsContextKey は検証したクレームを保存するコンテキストのキーです。
+type claimsContextKey struct{}
+
+// NewContext は検証したクレームを保存したコンテキストを返します。
+func NewContext(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// FromContext は NewContext で保存したクレームを返します。JWT で認証していない場合は nil を返します。
+func FromContext(ctx context.Context) Claims {
+	claims, _ := ctx.Value(claimsContextKey{}).(Claims)
+	return claims
+}
+
+func decodeSegment(segment string, out any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: malformed segment", ErrInvalidToken)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%w: malformed segment", ErrInvalidToken)
+	}
+	return nil
+}
+
+// verifySignature は設定した鍵の種類に対応するアルゴリズムの署名だけを受け付けます。
+func (v *Verifier) verifySignature(alg, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch alg {
+	case "HS256":
+		if len(v.cfg.Secret) == 0 {
+			break
+		}
+		mac := hmac.New(sha256.New, v.cfg.Secret)
+		mac.Write([]byte(signed))
+		if hmac.Equal(mac.Sum(nil), signature) {
+			return nil
+		}
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+	case "RS256":
+		key, ok := v.publicKey.(*rsa.PublicKey)
+		if !ok {
+			break
+		}
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+	case "ES256":
+		key, ok := v.publicKey.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			break
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if ecdsa.Verify(key, digest[:], r, s) {
+			return nil
+		}
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+	}
+	return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+}
+
+// validateClaims は exp・nbf・iss・aud を検証します。
+func (v *Verifier) validateClaims(claims Claims) error {
+	now := v.now()
+	if exp, ok := numericDate(claims["exp"]); ok && !now.Before(exp.Add(v.cfg.Leeway)) {
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(v.cfg.Leeway).Before(nbf) {
+		return fmt.Errorf("%w: token not yet valid", ErrInvalidToken)
+	}
+	if v.cfg.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+			return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+		}
+	}
+	if v.cfg.Audience != "" && !slices.Contains(audiences(claims["aud"]), v.cfg.Audience) {
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	return nil
+}
+
+func numericDate(v any) (time.Time, bool) {
+	n, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(n), 0), true
+}
+
+// audiences は aud クレーム（文字列または文字列の配列）を配列で返します。
+func audiences(v any) []string {
+	switch aud := v.(type) {
+	case string:
+		return []string{aud}
+	case []any:
+		values := make([]string, 0, len(aud))
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("test-secret")
+
+// sign は alg で署名した JWT を返します。key は HS256 では共有鍵、RS256・ES256 では秘密鍵です。
+func sign(t *testing.T, alg string, key any, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "RS256":
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	case "none":
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// writePublicKey は公開鍵を PEM 形式でファイルに書き込み、そのパスを返します。
+func writePublicKey(t *testing.T, key any) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	valid := map[string]any{"sub": "alice", "iss": "https://issuer.test", "aud": "mcp", "exp": now.Add(time.Hour).Unix()}
+	with := func(key string, value any) map[string]any {
+		claims := map[string]any{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	verifier, err := NewVerifier(Config{Secret: testSecret, Issuer: "https://issuer.test", Audience: "mcp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier.now = func() time.Time { return now }
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "有効なトークン_受け付ける", token: sign(t, "HS256", testSecret, valid)},
+		{name: "audが配列_受け付ける", token: sign(t, "HS256", testSecret, with("aud", []string{"other", "mcp"}))},
+		{name: "期限切れ直後_猶予内で受け付ける", token: sign(t, "HS256", testSecret, with("exp", now.Add(-10*time.Second).Unix()))},
+		{name: "期限切れ_エラー", token: sign(t, "HS256", testSecret, with("exp", now.Add(-time.Minute).Unix())), wantErr: true},
+		{name: "有効になる前_エラー", token: sign(t, "HS256", testSecret, with("nbf", now.Add(time.Minute).Unix())), wantErr: true},
+		{name: "発行者が異なる_エラー", token: sign(t, "HS256", testSecret, with("iss", "https://other.test")), wantErr: true},
+		{name: "audienceが異なる_エラー", token: sign(t, "HS256", testSecret, with("aud", "other")), wantErr: true},
+		{name: "audienceなし_エラー", token: sign(t, "HS256", testSecret, with("aud", nil)), wantErr: true},
+		{name: "異なる鍵で署名_エラー", token: sign(t, "HS256", []byte("other"), valid), wantErr: true},
+		{name: "algがnone_エラー", token: sign(t, "none", nil, valid), wantErr: true},
+		{name: "公開鍵のアルゴリズム_エラー", token: sign(t, "RS256", mustRSAKey(t), valid), wantErr: true},
+		{name: "形式が不正_エラー", token: "not-a-jwt", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(tt.token)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("Verify() error = %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if got := verifier.Principal(claims); got != "alice" {
+				t.Errorf("Principal() = %q, want alice", got)
+			}
+		})
+	}
+}
+
+func mustRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestVerifier_PublicKey(t *testing.T) {
+	rsaKey := mustRSAKey(t)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := map[string]any{"sub": "svc", "client_id": "agent"}
+
+	tests := []struct {
+		name    string
+		public  any
+		alg     string
+		signer  any
+		wantErr bool
+	}{
+		{name: "RS256_受け付ける", public: &rsaKey.PublicKey, alg: "RS256", signer: rsaKey},
+		{name: "ES256_受け付ける", public: &ecKey.PublicKey, alg: "ES256", signer: ecKey},
+		{name: "別の鍵で署名_エラー", public: &rsaKey.PublicKey, alg: "RS256", signer: mustRSAKey(t), wantErr: true},
+		{name: "鍵と異なるアルゴリズム_エラー", public: &rsaKey.PublicKey, alg: "ES256", signer: ecKey, wantErr: true},
+		{name: "公開鍵を共有鍵としたHS256_エラー", public: &rsaKey.PublicKey, alg: "HS256", signer: []byte("guess"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := NewVerifier(Config{PublicKeyFile: writePublicKey(t, tt.public), PrincipalClaim: "client_id"})
+			if err != nil {
+				t.Fatalf("NewVerifier() error = %v", err)
+			}
+			verified, err := verifier.Verify(sign(t, tt.alg, tt.signer, claims))
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("Verify() error = %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if got := verifier.Principal(verified); got != "agent" {
+				t.Errorf("Principal() = %q, want agent", got)
+			}
+		})
+	}
+}
+
+func TestNewVerifier_Errors(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(notPEM, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "鍵なし_エラー", cfg: Config{Issuer: "https://issuer.test"}},
+		{name: "存在しないファイル_エラー", cfg: Config{PublicKeyFile: filepath.Join(t.TempDir(), "missing.pem")}},
+		{name: "PEMでない_エラー", cfg: Config{PublicKeyFile: notPEM}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewVerifier(tt.cfg); err == nil {
+				t.Error("NewVerifier() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != nil {
+		t.Errorf("FromContext() without claims = %v, want nil", got)
+	}
+	claims := Claims{"sub": "alice"}
+	if got := FromContext(NewContext(context.Background(), claims)); got["sub"] != "alice" {
+		t.Errorf("FromContext() = %v, want %v", got, claims)
+	}
+}
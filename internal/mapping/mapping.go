@@ -0,0 +1,184 @@
+// Package mapping は条件付きのヘッダーマッピングを提供します。
+//
+// 通常のヘッダーマッピングはヘッダーがあれば常に適用されますが、Rule は他のヘッダーの値、
+// JWT のクレーム、リクエストのパスが条件を満たす場合にのみ適用されます
+// （例: スタッフとして認証されたリクエストの X-Debug だけを DEBUG_MODE に渡す）。
+package mapping
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Rule は1件の条件付きマッピングです。Env と Arg のどちらか一方を指定します。
+type Rule struct {
+	// Header は値を取り出すヘッダー名です。
+	Header string `json:"header"`
+	// Env は値を渡す環境変数名です。
+	Env string `json:"env,omitempty"`
+	// Arg は値を渡す引数名です（書き方は --header-arg と同じで、空文字列は位置引数）。
+	Arg *string `json:"arg,omitempty"`
+	// When はマッピングを適用する条件です。全ての条件を満たす場合のみ適用します。
+	When Condition `json:"when"`
+}
+
+// Condition はマッピングを適用する条件です。
+type Condition struct {
+	// Headers はヘッダー名 → 値です。値が空文字列の場合はヘッダーがあることだけを条件にします。
+	Headers map[string]string `json:"headers,omitempty"`
+	// Claims は認証で検証した JWT のクレーム → 値です。JWT で認証していないリクエストには一致しません。
+	// クレーム名はドット区切りで入れ子のクレームを指定でき、配列のクレームは値を含む場合に一致します。
+	Claims map[string]string `json:"claims,omitempty"`
+	// Path はリクエストのパス（gRPC ではメソッド名）に一致する正規表現です。
+	Path string `json:"path,omitempty"`
+
+	path *regexp.Regexp
+}
+
+// Rules は条件付きマッピングの一覧です。
+type Rules []Rule
+
+// errClaimsWithoutJWT は JWT を検証しない設定でクレームの条件を指定したことを表すエラーです。
+var errClaimsWithoutJWT = errors.New("claims conditions require JWT authentication")
+
+// Request は条件の評価に使うリクエストの情報です。
+type Request struct {
+	Header http.Header
+	Path   string
+	Claims map[string]any // 認証で検証した JWT のクレーム（JWT で認証していない場合は nil）
+}
+
+// Match は条件を満たしたマッピングと、マッピングするヘッダーの値です。
+type Match struct {
+	Rule  *Rule
+	Value string
+}
+
+// Load は JSON ファイルから条件付きマッピングを読み込みます。jwt は Validate と同じです。
+func Load(path string, jwt bool) (Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read mapping rules: %w", err)
+	}
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse mapping rules %s: %w", path, err)
+	}
+	if err := rules.Validate(jwt); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Validate はルールの内容を検証し、ヘッダー名の正規化と正規表現のコンパイルを行います。
+// jwt は JWT の検証を設定しているかどうかで、設定していない場合はクレームの条件をエラーにします。
+func (r Rules) Validate(jwt bool) error {
+	for i := range r {
+		rule := &r[i]
+		if rule.Header == "" {
+			return fmt.Errorf("mapping rule %d has no header", i)
+		}
+		if (rule.Env == "") == (rule.Arg == nil) {
+			return fmt.Errorf("mapping rule %d must have exactly one of env or arg", i)
+		}
+		rule.Header = http.CanonicalHeaderKey(rule.Header)
+		if len(rule.When.Claims) > 0 && !jwt {
+			return fmt.Errorf("mapping rule %d: %w", i, errClaimsWithoutJWT)
+		}
+
+		if len(rule.When.Headers) > 0 {
+			headers := make(map[string]string, len(rule.When.Headers))
+			for name, value := range rule.When.Headers {
+				headers[http.CanonicalHeaderKey(name)] = value
+			}
+			rule.When.Headers = headers
+		}
+		if rule.When.Path != "" {
+			re, err := regexp.Compile(rule.When.Path)
+			if err != nil {
+				return fmt.Errorf("mapping rule %d has an invalid path pattern: %w", i, err)
+			}
+			rule.When.path = re
+		}
+	}
+	return nil
+}
+
+// Match は条件を満たし、ヘッダーに値があるマッピングを順に返します。
+func (r Rules) Match(req Request) []Match {
+	if len(r) == 0 {
+		return nil
+	}
+
+	var matches []Match
+	for i := range r {
+		rule := &r[i]
+		value := req.Header.Get(rule.Header)
+		if value == "" {
+			continue
+		}
+		if !rule.When.matches(req) {
+			continue
+		}
+		matches = append(matches, Match{Rule: rule, Value: value})
+	}
+	return matches
+}
+
+// matches はリクエストが全ての条件を満たすかどうかを返します。
+func (c *Condition) matches(req Request) bool {
+	for name, want := range c.Headers {
+		values := req.Header.Values(name)
+		if len(values) == 0 || (want != "" && !slices.Contains(values, want)) {
+			return false
+		}
+	}
+	for name, want := range c.Claims {
+		if !claimEquals(lookupClaim(req.Claims, name), want) {
+			return false
+		}
+	}
+	if c.path != nil && !c.path.MatchString(req.Path) {
+		return false
+	}
+	return true
+}
+
+// lookupClaim はドット区切りの名前で入れ子のクレームを取り出します。
+func lookupClaim(claims map[string]any, name string) any {
+	var current any = claims
+	for _, key := range strings.Split(name, ".") {
+		obj, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		if current, ok = obj[key]; !ok {
+			return nil
+		}
+	}
+	return current
+}
+
+// claimEquals はクレームの値が want と一致するかどうかを返します。配列の場合はいずれかの要素と比較します。
+func claimEquals(claim any, want string) bool {
+	switch v := claim.(type) {
+	case nil:
+		return false
+	case string:
+		return v == want
+	case []any:
+		return slices.ContainsFunc(v, func(elem any) bool { return claimEquals(elem, want) })
+	case map[string]any:
+		return false
+	default:
+		// 数値・真偽値は JSON の表記で比較する
+		data, err := json.Marshal(v)
+		return err == nil && string(data) == want
+	}
+}
@@ -0,0 +1,178 @@
+package mapping
+
+import (
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// bearer はペイロードが payload の署名なし JWT を Authorization ヘッダーの値として返します。
+func bearer(payload string) string {
+	enc := base64.RawURLEncoding
+	return "Bearer " + enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString([]byte(payload)) + ".sig"
+}
+
+func ptr(s string) *string { return &s }
+
+func TestRules_Match(t *testing.T) {
+	tests := []struct {
+		name   string
+		when   Condition
+		header http.Header
+		claims map[string]any
+		path   string
+		want   bool
+	}{
+		{
+			name:   "条件なし_ヘッダーがあれば適用",
+			header: http.Header{"X-Debug": {"1"}},
+			want:   true,
+		},
+		{
+			name:   "値のヘッダーなし_適用しない",
+			header: http.Header{"X-Role": {"staff"}},
+			when:   Condition{Headers: map[string]string{"X-Role": "staff"}},
+			want:   false,
+		},
+		{
+			name:   "ヘッダーの値が一致_適用",
+			header: http.Header{"X-Debug": {"1"}, "X-Role": {"staff"}},
+			when:   Condition{Headers: map[string]string{"x-role": "staff"}},
+			want:   true,
+		},
+		{
+			name:   "ヘッダーの値が不一致_適用しない",
+			header: http.Header{"X-Debug": {"1"}, "X-Role": {"guest"}},
+			when:   Condition{Headers: map[string]string{"X-Role": "staff"}},
+			want:   false,
+		},
+		{
+			name:   "ヘッダーの存在のみ_適用",
+			header: http.Header{"X-Debug": {"1"}, "X-Staff": {"anything"}},
+			when:   Condition{Headers: map[string]string{"X-Staff": ""}},
+			want:   true,
+		},
+		{
+			name:   "クレームが一致_適用",
+			header: http.Header{"X-Debug": {"1"}},
+			claims: map[string]any{"role": "staff"},
+			when:   Condition{Claims: map[string]string{"role": "staff"}},
+			want:   true,
+		},
+		{
+			name:   "入れ子の配列クレームが値を含む_適用",
+			header: http.Header{"X-Debug": {"1"}},
+			claims: map[string]any{"realm_access": map[string]any{"roles": []any{"user", "staff"}}},
+			when:   Condition{Claims: map[string]string{"realm_access.roles": "staff"}},
+			want:   true,
+		},
+		{
+			name:   "真偽値のクレーム_JSONの表記で比較",
+			header: http.Header{"X-Debug": {"1"}},
+			claims: map[string]any{"staff": true},
+			when:   Condition{Claims: map[string]string{"staff": "true"}},
+			want:   true,
+		},
+		{
+			name:   "クレームが不一致_適用しない",
+			header: http.Header{"X-Debug": {"1"}},
+			claims: map[string]any{"role": "user"},
+			when:   Condition{Claims: map[string]string{"role": "staff"}},
+			want:   false,
+		},
+		{
+			name:   "JWTで認証していない_適用しない",
+			header: http.Header{"X-Debug": {"1"}},
+			when:   Condition{Claims: map[string]string{"role": "staff"}},
+			want:   false,
+		},
+		{
+			name:   "検証していないトークンのクレーム_適用しない",
+			header: http.Header{"X-Debug": {"1"}, "Authorization": {bearer(`{"role":"staff"}`)}},
+			when:   Condition{Claims: map[string]string{"role": "staff"}},
+			want:   false,
+		},
+		{
+			name:   "パスが一致_適用",
+			header: http.Header{"X-Debug": {"1"}},
+			path:   "/mcp/poll",
+			when:   Condition{Path: "^/mcp/poll$"},
+			want:   true,
+		},
+		{
+			name:   "パスが不一致_適用しない",
+			header: http.Header{"X-Debug": {"1"}},
+			path:   "/mcp",
+			when:   Condition{Path: "^/mcp/poll$"},
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := Rules{{Header: "x-debug", Env: "DEBUG_MODE", When: tt.when}}
+			if err := rules.Validate(true); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			matches := rules.Match(Request{Header: tt.header, Path: tt.path, Claims: tt.claims})
+			if got := len(matches) == 1; got != tt.want {
+				t.Fatalf("Match() = %+v, want match %v", matches, tt.want)
+			}
+			if tt.want && matches[0].Value != tt.header.Get("X-Debug") {
+				t.Errorf("Match() value = %q, want %q", matches[0].Value, tt.header.Get("X-Debug"))
+			}
+		})
+	}
+}
+
+func TestRules_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   Rules
+		jwt     bool
+		wantErr bool
+	}{
+		{name: "環境変数へのマッピング_有効", rules: Rules{{Header: "X-A", Env: "A"}}},
+		{name: "位置引数へのマッピング_有効", rules: Rules{{Header: "X-A", Arg: ptr("")}}},
+		{name: "ヘッダーなし_エラー", rules: Rules{{Env: "A"}}, wantErr: true},
+		{name: "envとargの両方_エラー", rules: Rules{{Header: "X-A", Env: "A", Arg: ptr("a")}}, wantErr: true},
+		{name: "envとargのどちらもなし_エラー", rules: Rules{{Header: "X-A"}}, wantErr: true},
+		{name: "不正な正規表現_エラー", rules: Rules{{Header: "X-A", Env: "A", When: Condition{Path: "("}}}, wantErr: true},
+		{name: "JWTの検証ありでクレームの条件_有効", rules: Rules{{Header: "X-A", Env: "A", When: Condition{Claims: map[string]string{"role": "staff"}}}}, jwt: true},
+		{name: "JWTの検証なしでクレームの条件_エラー", rules: Rules{{Header: "X-A", Env: "A", When: Condition{Claims: map[string]string{"role": "staff"}}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rules.Validate(tt.jwt); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping.json")
+	data := `[{"header":"X-Debug","env":"DEBUG_MODE","when":{"claims":{"role":"staff"}}}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path, false); err == nil {
+		t.Error("Load() without JWT error = nil, want an error for the claims condition")
+	}
+	rules, err := Load(path, true)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(rules) != 1 || rules[0].Env != "DEBUG_MODE" || rules[0].When.Claims["role"] != "staff" {
+		t.Errorf("Load() = %+v", rules)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json"), true); err == nil {
+		t.Error("Load() expected error for a missing file")
+	}
+}
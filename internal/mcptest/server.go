@@ -0,0 +1,168 @@
+// Package mcptest はテスト用の stdio MCP サーバーを提供します。
+//
+// テストバイナリ自身をフェイクサーバーとして起動するため、各パッケージの TestMain で
+// RunIfRequested を呼び出してください。
+package mcptest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"strconv"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+)
+
+// modeEnv はフェイクサーバーの動作モードを指定する環境変数名です。
+const modeEnv = "MCPTEST_SERVER_MODE"
+
+// フェイクサーバーの動作モード
+const (
+	ModeCompliant     = "compliant"      // MCP に準拠した応答を返す
+	ModeNonCompliant  = "noncompliant"   // 通知に応答する等、仕様に反した応答を返す
+	ModeContentLength = "content-length" // ModeCompliant と同じ応答を、改行区切りではなく Content-Length ヘッダーを付けて読み書きする
+)
+
+// RunIfRequested は環境変数でモードが指定されている場合にフェイクサーバーとして動作し、終了します。
+func RunIfRequested() {
+	mode := os.Getenv(modeEnv)
+	if mode == "" {
+		return
+	}
+	Serve(mode, os.Stdin, os.Stdout)
+	os.Exit(0)
+}
+
+// Command はフェイクサーバーを起動するためのコマンド・引数・環境変数を返します。
+func Command(mode string) (command string, args []string, env map[string]string) {
+	return os.Args[0], []string{}, map[string]string{modeEnv: mode}
+}
+
+// Serve は r から改行区切り（ModeContentLength では Content-Length ヘッダー付き）の JSON-RPC メッセージを読み取り、w に応答します。
+func Serve(mode string, r io.Reader, w io.Writer) {
+	read, writeRaw := newlineFraming(r, w)
+	if mode == ModeContentLength {
+		read, writeRaw = contentLengthFraming(r, w)
+	}
+	write := func(v any) {
+		data, _ := json.Marshal(v)
+		writeRaw(data)
+	}
+	result := func(id json.RawMessage, v any) {
+		write(map[string]any{"jsonrpc": jsonrpc.Version, "id": id, "result": v})
+	}
+
+	for {
+		line, ok := read()
+		if !ok {
+			return
+		}
+		msg, err := jsonrpc.Parse(line)
+		if err != nil {
+			if mode == ModeNonCompliant {
+				return
+			}
+			writeRaw(jsonrpc.NewErrorResponse(nil, jsonrpc.CodeParseError, "parse error"))
+			continue
+		}
+
+		if msg.IsNotification() {
+			if mode == ModeNonCompliant {
+				result(json.RawMessage("0"), map[string]any{})
+			}
+			continue
+		}
+
+		switch msg.Method {
+		case "initialize":
+			var params struct {
+				ProtocolVersion string `json:"protocolVersion"`
+			}
+			_ = json.Unmarshal(msg.Params, &params)
+			result(msg.ID, map[string]any{
+				"protocolVersion": params.ProtocolVersion,
+				"capabilities":    map[string]any{"tools": map[string]any{}},
+				"serverInfo":      map[string]any{"name": "fake", "version": "1.0.0"},
+			})
+		case "ping":
+			result(msg.ID, map[string]any{})
+		case "tools/list":
+			result(msg.ID, map[string]any{"tools": []any{
+				map[string]any{"name": "echo", "inputSchema": map[string]any{"type": "object"}},
+			}})
+		case "tools/call":
+			var params struct {
+				Arguments struct {
+					Text string `json:"text"`
+				} `json:"arguments"`
+			}
+			_ = json.Unmarshal(msg.Params, &params)
+			// レスポンスの前に通知を1件送信する
+			write(map[string]any{"jsonrpc": jsonrpc.Version, "method": "notifications/message",
+				"params": map[string]any{"level": "info", "data": "calling echo"}})
+			result(msg.ID, map[string]any{"content": []any{
+				map[string]any{"type": "text", "text": params.Arguments.Text},
+			}})
+		case "resources/subscribe":
+			var params struct {
+				URI string `json:"uri"`
+			}
+			_ = json.Unmarshal(msg.Params, &params)
+			// 購読した直後にリソースが更新されたことを通知する
+			result(msg.ID, map[string]any{})
+			write(map[string]any{"jsonrpc": jsonrpc.Version, "method": "notifications/resources/updated",
+				"params": map[string]any{"uri": params.URI}})
+		case "resources/unsubscribe":
+			result(msg.ID, map[string]any{})
+		default:
+			if mode == ModeNonCompliant {
+				result(msg.ID, map[string]any{})
+				continue
+			}
+			writeRaw(jsonrpc.NewErrorResponse(msg.ID, jsonrpc.CodeMethodNotFound, "method not found"))
+		}
+	}
+}
+
+// newlineFraming は1行に1メッセージを読み書きする関数を返します。
+func newlineFraming(r io.Reader, w io.Writer) (read func() ([]byte, bool), write func([]byte)) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	read = func() ([]byte, bool) {
+		if !scanner.Scan() {
+			return nil, false
+		}
+		return scanner.Bytes(), true
+	}
+	write = func(data []byte) {
+		_, _ = fmt.Fprintf(w, "%s\n", data)
+	}
+	return read, write
+}
+
+// contentLengthFraming は Content-Length ヘッダーを付けたメッセージを読み書きする関数を返します。
+func contentLengthFraming(r io.Reader, w io.Writer) (read func() ([]byte, bool), write func([]byte)) {
+	reader := textproto.NewReader(bufio.NewReader(r))
+	read = func() ([]byte, bool) {
+		header, err := reader.ReadMIMEHeader()
+		if err != nil {
+			return nil, false
+		}
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil || length < 0 {
+			return nil, false
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader.R, body); err != nil {
+			return nil, false
+		}
+		return body, true
+	}
+	write = func(data []byte) {
+		_, _ = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	}
+	return read, write
+}
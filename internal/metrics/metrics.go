@@ -0,0 +1,213 @@
+// Package metrics は Prometheus のテキスト形式で公開できる最小限のメトリクスを提供します。
+//
+// 外部ライブラリに依存せず、カウンターとゲージのみを扱います。
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// labelSeparator はラベル値を連結してシリーズのキーにする際の区切り文字です。
+const labelSeparator = "\xff"
+
+// Registry はメトリクスを登録順に保持し、まとめて出力します。
+type Registry struct {
+	mu      sync.Mutex
+	metrics []*metric
+	names   map[string]bool
+}
+
+// NewRegistry は空の Registry を作成します。
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// metric は同じ名前を持つシリーズの集まりです。
+type metric struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+
+	mu     sync.Mutex
+	series map[string]*series
+	fn     func() float64
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+}
+
+// register はメトリクスを登録します。同じ名前を2回登録した場合は panic します。
+func (r *Registry) register(name, help, kind string, labelNames []string) *metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: duplicate metric %q", name))
+	}
+	r.names[name] = true
+
+	m := &metric{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		series:     make(map[string]*series),
+	}
+	r.metrics = append(r.metrics, m)
+	return m
+}
+
+// add はラベル値に対応するシリーズに v を加算します。set が true の場合は v で置き換えます。
+func (m *metric) add(v float64, set bool, labelValues []string) {
+	if len(labelValues) != len(m.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", m.name, len(m.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, labelSeparator)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labelValues: slices.Clone(labelValues)}
+		m.series[key] = s
+	}
+	if set {
+		s.value = v
+	} else {
+		s.value += v
+	}
+}
+
+// Counter は増加のみするメトリクスです。
+type Counter struct {
+	m *metric
+}
+
+// Counter はカウンターを登録します。labelNames を指定した場合は値の更新時に同じ数のラベル値が必要です。
+func (r *Registry) Counter(name, help string, labelNames ...string) *Counter {
+	return &Counter{m: r.register(name, help, "counter", labelNames)}
+}
+
+// Inc はカウンターを1増やします。
+func (c *Counter) Inc(labelValues ...string) {
+	c.m.add(1, false, labelValues)
+}
+
+// Add はカウンターに v を加算します。負の値は無視します。
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.m.add(v, false, labelValues)
+}
+
+// Gauge は増減するメトリクスです。
+type Gauge struct {
+	m *metric
+}
+
+// Gauge はゲージを登録します。
+func (r *Registry) Gauge(name, help string, labelNames ...string) *Gauge {
+	return &Gauge{m: r.register(name, help, "gauge", labelNames)}
+}
+
+// Set はゲージの値を設定します。
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.m.add(v, true, labelValues)
+}
+
+// Add はゲージに v を加算します（負の値で減算）。
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.m.add(v, false, labelValues)
+}
+
+// GaugeFunc は出力のたびに fn を呼んで値を取得するラベルなしのゲージを登録します。
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	m := r.register(name, help, "gauge", nil)
+	m.fn = fn
+}
+
+// CounterFunc は出力のたびに fn を呼んで累計値を取得するラベルなしのカウンターを登録します。
+func (r *Registry) CounterFunc(name, help string, fn func() float64) {
+	m := r.register(name, help, "counter", nil)
+	m.fn = fn
+}
+
+// WriteText は全メトリクスを Prometheus のテキスト形式で w に書き込みます。
+// シリーズはラベル値の順に並べ、出力を安定させます。
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := slices.Clone(r.metrics)
+	r.mu.Unlock()
+
+	var b strings.Builder
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", m.name, m.kind)
+
+		if m.fn != nil {
+			fmt.Fprintf(&b, "%s %s\n", m.name, formatValue(m.fn()))
+			continue
+		}
+
+		m.mu.Lock()
+		keys := make([]string, 0, len(m.series))
+		for k := range m.series {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			s := m.series[k]
+			fmt.Fprintf(&b, "%s%s %s\n", m.name, formatLabels(m.labelNames, s.labelValues), formatValue(s.value))
+		}
+		m.mu.Unlock()
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP は全メトリクスをテキスト形式で返します。
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.WriteText(w)
+}
+
+// formatLabels はラベルを {name="value",...} 形式に整形します。
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabelValue(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeLabelValue はラベル値のバックスラッシュ・ダブルクォート・改行をエスケープします。
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// formatValue は値を Prometheus のテキスト形式で整形します。
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("test_requests_total", "Total requests.", "method")
+	size := r.Gauge("test_size", "Current size.")
+	r.GaugeFunc("test_idle", "Idle processes.", func() float64 { return 3 })
+	r.CounterFunc("test_queued_total", "Queued requests.", func() float64 { return 7 })
+
+	requests.Inc("tools/call")
+	requests.Add(2, "ping")
+	requests.Add(-1, "ping")
+	size.Set(5)
+	size.Add(-2)
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+
+	want := `# HELP test_requests_total Total requests.
+# TYPE test_requests_total counter
+test_requests_total{method="ping"} 2
+test_requests_total{method="tools/call"} 1
+# HELP test_size Current size.
+# TYPE test_size gauge
+test_size 3
+# HELP test_idle Idle processes.
+# TYPE test_idle gauge
+test_idle 3
+# HELP test_queued_total Queued requests.
+# TYPE test_queued_total counter
+test_queued_total 7
+`
+	if got := b.String(); got != want {
+		t.Errorf("WriteText() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRegistry_DuplicateName(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("test_total", "Total.")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a duplicate name should panic")
+		}
+	}()
+	r.Gauge("test_total", "Total.")
+}
+
+func TestCounter_LabelCountMismatch(t *testing.T) {
+	c := NewRegistry().Counter("test_total", "Total.", "method")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("wrong number of label values should panic")
+		}
+	}()
+	c.Inc()
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("test_total", "Total.").Inc()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "test_total 1\n") {
+		t.Errorf("body = %s, want test_total 1", w.Body.String())
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		got      string
+		expected string
+	}{
+		{name: "ラベルのエスケープ", got: formatLabels([]string{"a"}, []string{"x\"y\\z\n"}), expected: `{a="x\"y\\z\n"}`},
+		{name: "複数ラベル", got: formatLabels([]string{"a", "b"}, []string{"1", "2"}), expected: `{a="1",b="2"}`},
+		{name: "ラベルなし", got: formatLabels(nil, nil), expected: ""},
+		{name: "小数", got: formatValue(0.25), expected: "0.25"},
+		{name: "正の無限大", got: formatValue(math.Inf(1)), expected: "+Inf"},
+		{name: "NaN", got: formatValue(math.NaN()), expected: "NaN"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("got %q, want %q", tt.got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,466 @@
+// Package mux は1つの起動し続けるプロセスで、複数のクライアントの JSON-RPC リクエストを同時に処理します。
+// リクエストの ID をプロセスごとに一意な値に書き換えて送り、プロセスが出力したレスポンスを元の ID に戻して
+// 送ったリクエストに返します。レスポンス以外のメッセージ（通知）は購読しているクライアント全てに配信します。
+package mux
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// 共有プロセスの設定のデフォルト値
+const (
+	DefaultProtocolVersion   = "2025-06-18"     // プロセスの初期化に使うプロトコルのバージョン
+	DefaultInitializeTimeout = 30 * time.Second // プロセスの initialize のレスポンスを待つ時間
+)
+
+// subscriberBuffer は購読者ごとに配信を待つ通知の最大数です。超えた分は破棄します。
+const subscriberBuffer = 64
+
+var (
+	// ErrClosed は Close 後の Mux で実行しようとした場合のエラーです。
+	ErrClosed = errors.New("shared process closed")
+	// ErrProcessExited はレスポンスを返す前にプロセスが終了したことを表します。
+	ErrProcessExited = errors.New("shared process exited before responding")
+)
+
+// StartFunc は共有するプロセスを起動します。プロセスが終了した後の次のリクエストで再び呼び出します。
+type StartFunc func(ctx context.Context) (*process.Session, error)
+
+// Config は共有プロセスの設定です。
+type Config struct {
+	ProtocolVersion   string        // プロセスの初期化に使うプロトコルのバージョン（空文字列でデフォルト）
+	InitializeTimeout time.Duration // プロセスの initialize のレスポンスを待つ時間（0 でデフォルト）
+}
+
+// Stats は Mux の状態と累計値です。
+type Stats struct {
+	Processes   int   // 動いているプロセスの数（切り替え前のプロセスを含む）
+	InFlight    int   // プロセスの応答を待っているリクエストの数
+	Subscribers int   // 通知を購読しているクライアントの数
+	Requests    int64 // 共有プロセスで実行したリクエストの累計
+	Starts      int64 // プロセスを起動した回数の累計
+}
+
+// Mux は1つの起動し続けるプロセスを全てのリクエストで共有します。
+// プロセスは最初のリクエストで起動して初期化し、終了した場合は次のリクエストで起動し直します。
+// クライアントの initialize には初期化の結果を返し、notifications/initialized はプロセスに送りません。
+// プロセスからのリクエスト（sampling/createMessage など）は応答するクライアントを決められないため、エラーを返します。
+type Mux struct {
+	start  StartFunc
+	cfg    Config
+	logger *slog.Logger
+
+	mu          sync.Mutex
+	current     *child          // 新しいリクエストを送るプロセス（nil で次のリクエストで起動する）
+	starting    chan struct{}   // 起動中のプロセスの初期化の完了（nil で起動中でない）
+	children    map[*child]bool // 動いている全てのプロセス
+	subscribers map[chan []byte]bool
+	closed      bool
+	requests    int64
+	starts      int64
+}
+
+// child は Mux が起動した1つのプロセスです。
+type child struct {
+	session *process.Session
+	init    json.RawMessage             // initialize の result
+	done    chan struct{}               // プロセスの出力を読み終えた
+	pending *jsonrpc.IDMap[chan []byte] // 書き換えた ID ごとのレスポンスを待つリクエスト
+
+	// 以下は Mux.mu で保護する
+	refs     int  // 実行中のリクエストの数
+	draining bool // 切り替え前のプロセス（実行中のリクエストが終わると終了させる）
+}
+
+// New は Mux を作成します。プロセスは最初のリクエストで起動します。
+func New(start StartFunc, cfg Config, logger *slog.Logger) *Mux {
+	if cfg.ProtocolVersion == "" {
+		cfg.ProtocolVersion = DefaultProtocolVersion
+	}
+	if cfg.InitializeTimeout <= 0 {
+		cfg.InitializeTimeout = DefaultInitializeTimeout
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Mux{
+		start:       start,
+		cfg:         cfg,
+		logger:      logger,
+		children:    make(map[*child]bool),
+		subscribers: make(map[chan []byte]bool),
+	}
+}
+
+// Call はメッセージを共有プロセスに送ります。リクエストの場合は ID を書き換えて送り、元の ID に戻したレスポンスを返します。
+// 通知は送るだけで nil を返し、クライアントからのレスポンスは送らずに破棄します。
+// ctx が終了した場合はプロセスに notifications/cancelled を送り、遅れて届くレスポンスは破棄します。
+func (m *Mux) Call(ctx context.Context, input []byte) ([]byte, error) {
+	msg, err := jsonrpc.Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	// プロセスは Mux が初期化済みのため、クライアントの初期化は送らない
+	if msg.Method == "notifications/initialized" || msg.IsResponse() {
+		return nil, nil
+	}
+
+	c, err := m.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.release(c)
+
+	if !msg.IsRequest() {
+		return nil, c.session.Send(input)
+	}
+	m.mu.Lock()
+	m.requests++
+	m.mu.Unlock()
+	if msg.Method == "initialize" {
+		return json.Marshal(struct {
+			JSONRPC string          `json:"jsonrpc"`
+			ID      json.RawMessage `json:"id"`
+			Result  json.RawMessage `json:"result"`
+		}{JSONRPC: jsonrpc.Version, ID: msg.ID, Result: c.init})
+	}
+	return m.roundTrip(ctx, c, input)
+}
+
+// acquire は新しいリクエストを送るプロセスを実行中として取り出します。なければ起動して初期化します。
+func (m *Mux) acquire(ctx context.Context) (*child, error) {
+	for {
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return nil, ErrClosed
+		}
+		if c := m.current; c != nil {
+			c.refs++
+			m.mu.Unlock()
+			return c, nil
+		}
+		if wait := m.starting; wait != nil {
+			// 他のリクエストが起動しているプロセスの初期化を待つ
+			m.mu.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		starting := make(chan struct{})
+		m.starting = starting
+		m.mu.Unlock()
+
+		c, err := m.launch()
+
+		m.mu.Lock()
+		m.starting = nil
+		close(starting)
+		if err != nil {
+			m.mu.Unlock()
+			return nil, err
+		}
+		if m.closed {
+			m.mu.Unlock()
+			_ = c.close()
+			return nil, ErrClosed
+		}
+		m.current = c
+		m.children[c] = true
+		m.starts++
+		c.refs++
+		m.mu.Unlock()
+		return c, nil
+	}
+}
+
+// release はリクエストの終了を記録し、切り替え前のプロセスは最後のリクエストの終了後に終了させます。
+func (m *Mux) release(c *child) {
+	m.mu.Lock()
+	c.refs--
+	closing := c.draining && c.refs == 0 && m.children[c]
+	if closing {
+		delete(m.children, c)
+	}
+	m.mu.Unlock()
+
+	if closing {
+		go c.close()
+	}
+}
+
+// launch はプロセスを起動し、initialize のレスポンスを受け取ってから notifications/initialized を送ります。
+func (m *Mux) launch() (*child, error) {
+	// プロセスはリクエストより長く生存するため、リクエストの ctx には紐付けない
+	session, err := m.start(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	c := &child{session: session, done: make(chan struct{}), pending: jsonrpc.NewIDMap[chan []byte]()}
+	go m.dispatch(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.InitializeTimeout)
+	defer cancel()
+	if err := m.initialize(ctx, c); err != nil {
+		_ = c.close()
+		return nil, fmt.Errorf("initialize shared process: %w", err)
+	}
+	m.logger.Info("Started shared process")
+	return c, nil
+}
+
+// initialize はプロセスに initialize を送り、result を記録して notifications/initialized を送ります。
+func (m *Mux) initialize(ctx context.Context, c *child) error {
+	request, err := jsonrpc.NewRequest(0, "initialize", map[string]any{
+		"protocolVersion": m.cfg.ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "tumiki-mcp-http", "version": "0"},
+	})
+	if err != nil {
+		return err
+	}
+	response, err := m.roundTrip(ctx, c, request)
+	if err != nil {
+		return err
+	}
+	msg, err := jsonrpc.Parse(response)
+	if err != nil {
+		return err
+	}
+	if msg.Error != nil {
+		return msg.Error
+	}
+	c.init = msg.Result
+
+	initialized, err := jsonrpc.NewNotification("notifications/initialized", nil)
+	if err != nil {
+		return err
+	}
+	return c.session.Send(initialized)
+}
+
+// roundTrip はリクエストの ID をプロセスごとに一意な値に書き換えて送り、元の ID に戻したレスポンスを返します。
+func (m *Mux) roundTrip(ctx context.Context, c *child, input []byte) ([]byte, error) {
+	response := make(chan []byte, 1)
+	request, key, err := c.pending.Assign(input, response)
+	if err != nil {
+		return nil, err
+	}
+	defer c.pending.Release(key)
+
+	if err := c.session.Send(request); err != nil {
+		return nil, err
+	}
+	select {
+	case msg := <-response:
+		return msg, nil
+	case <-c.done:
+		// 終了する直前に出力したレスポンスを優先する
+		select {
+		case msg := <-response:
+			return msg, nil
+		default:
+		}
+		return nil, c.exitErr()
+	case <-ctx.Done():
+		m.cancel(c, key, ctx.Err())
+		return nil, ctx.Err()
+	}
+}
+
+// cancel は待つのをやめたリクエストの notifications/cancelled をプロセスに送ります。
+func (m *Mux) cancel(c *child, key json.RawMessage, reason error) {
+	cancelled, err := jsonrpc.NewNotification("notifications/cancelled", map[string]any{
+		"requestId": key,
+		"reason":    reason.Error(),
+	})
+	if err != nil {
+		return
+	}
+	if err := c.session.Send(cancelled); err != nil {
+		m.logger.Debug("Failed to send cancellation to shared process", "error", err)
+	}
+}
+
+// dispatch はプロセスの出力を読み取り、レスポンスを待っているリクエストに、通知を購読者に渡します。
+func (m *Mux) dispatch(c *child) {
+	defer close(c.done)
+	for {
+		msg, err := c.session.Receive(context.Background())
+		if err != nil {
+			m.exited(c, err)
+			return
+		}
+		parsed, err := jsonrpc.Parse(msg)
+		switch {
+		case err != nil:
+			m.logger.Debug("Discarding invalid message from shared process", "error", err)
+		case parsed.IsResponse():
+			if !c.respond(msg) {
+				m.logger.Debug("Discarding response for a cancelled request", "id", string(parsed.ID))
+			}
+		case parsed.IsRequest():
+			// 応答するクライアントを決められないため、プロセスを待たせないようすぐにエラーを返す
+			reply := jsonrpc.NewErrorResponse(parsed.ID, jsonrpc.CodeMethodNotFound, "requests from the server are not supported by the shared process")
+			if err := c.session.Send(reply); err != nil {
+				m.logger.Debug("Failed to reject request from shared process", "method", parsed.Method, "error", err)
+			}
+		default:
+			m.broadcast(msg)
+		}
+	}
+}
+
+// exited は終了したプロセスを取り除き、次のリクエストで起動し直すようにします。
+func (m *Mux) exited(c *child, err error) {
+	m.mu.Lock()
+	if m.current == c {
+		m.current = nil
+	}
+	stopping := m.closed || c.draining
+	delete(m.children, c)
+	m.mu.Unlock()
+
+	if !stopping {
+		if errors.Is(err, io.EOF) {
+			err = c.session.Err()
+		}
+		m.logger.Warn("Shared process exited", "error", err, "stderr", c.session.Stderr())
+	}
+	// 自ら終了したプロセスの後始末をする（Close は2回目以降何もしない）
+	_ = c.session.Close()
+}
+
+// broadcast は通知を全ての購読者に配信します。配信を待つ通知があふれた購読者には送りません。
+func (m *Mux) broadcast(msg []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ch := range m.subscribers {
+		select {
+		case ch <- msg:
+		default:
+			m.logger.Warn("Dropped notification for a slow shared process subscriber")
+		}
+	}
+}
+
+// Subscribe はプロセスの通知を受け取るチャネルと、購読をやめる関数を返します。
+// チャネルは購読をやめるか Mux を閉じると閉じられます。
+func (m *Mux) Subscribe() (<-chan []byte, func()) {
+	ch := make(chan []byte, subscriberBuffer)
+	m.mu.Lock()
+	if m.closed {
+		close(ch)
+	} else {
+		m.subscribers[ch] = true
+	}
+	m.mu.Unlock()
+
+	return ch, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.subscribers[ch] {
+			delete(m.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Stats は現在の状態と累計値を返します。
+func (m *Mux) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := Stats{
+		Processes:   len(m.children),
+		Subscribers: len(m.subscribers),
+		Requests:    m.requests,
+		Starts:      m.starts,
+	}
+	for c := range m.children {
+		stats.InFlight += c.refs
+	}
+	return stats
+}
+
+// Drain は以降のリクエストを新しく起動するプロセスで実行します。
+// 切り替え前のプロセスは実行中のリクエストがなければすぐに、あればリクエストの終了後に終了させます。
+func (m *Mux) Drain() {
+	m.mu.Lock()
+	c := m.current
+	m.current = nil
+	closing := false
+	if c != nil {
+		c.draining = true
+		closing = c.refs == 0
+		if closing {
+			delete(m.children, c)
+		}
+	}
+	m.mu.Unlock()
+
+	if closing {
+		go c.close()
+	}
+}
+
+// Close は全てのプロセスを終了させ、購読を終了して以降の実行を拒否します。
+func (m *Mux) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	m.current = nil
+	children := m.children
+	m.children = make(map[*child]bool)
+	for ch := range m.subscribers {
+		close(ch)
+	}
+	m.subscribers = make(map[chan []byte]bool)
+	m.mu.Unlock()
+
+	var errs []error
+	for c := range children {
+		errs = append(errs, c.close())
+	}
+	return errors.Join(errs...)
+}
+
+// respond はレスポンスを元の ID に戻し、待っているリクエストに渡します。待っているリクエストがなければ false を返します。
+func (c *child) respond(msg []byte) bool {
+	restored, response, ok := c.pending.Restore(msg)
+	if !ok {
+		return false
+	}
+	response <- restored
+	return true
+}
+
+// exitErr はプロセスの終了の原因を含めた ErrProcessExited を返します。
+func (c *child) exitErr() error {
+	if err := c.session.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrProcessExited, err)
+	}
+	return ErrProcessExited
+}
+
+// close はプロセスを終了させ、出力を読み終えるまで待ちます。
+func (c *child) close() error {
+	err := c.session.Close()
+	<-c.done
+	return err
+}
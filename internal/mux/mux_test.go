@@ -0,0 +1,246 @@
+package mux
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// testServer はリクエストのメソッド名を result に入れて返すスクリプトです。
+//   - hold は次のリクエストに応答した後に応答する（応答の順序を入れ替える）
+//   - ask はクライアントに sampling/createMessage を送り、エラーが返ってきた場合は "rejected" を返す
+//   - exit は応答せずに終了する
+//   - notifications/test を受け取ると notifications/message を出力する
+const testServer = `held=""
+respond() { printf '%s\n' "$1" | sed 's/,"method":\("[^"]*"\).*/,"result":\1}/'; }
+while read line; do
+  case "$line" in
+  *'"method":"notifications/test"'*) echo '{"jsonrpc":"2.0","method":"notifications/message","params":{"data":"test"}}'; continue ;;
+  *'"method":"notifications/'*) continue ;;
+  *'"method":"hold"'*) held="$line"; continue ;;
+  *'"method":"exit"'*) exit 1 ;;
+  *'"method":"ask"'*)
+    echo '{"jsonrpc":"2.0","id":"s1","method":"sampling/createMessage"}'
+    read reply
+    case "$reply" in *-32601*) printf '%s\n' "$line" | sed 's/,"method".*/,"result":"rejected"}/' ;; *) respond "$line" ;; esac
+    continue ;;
+  esac
+  respond "$line"
+  if [ -n "$held" ]; then respond "$held"; held=""; fi
+done`
+
+// newTestMux はテスト用のスクリプトを共有する Mux を作成します。
+func newTestMux(t *testing.T) *Mux {
+	t.Helper()
+	executor := process.NewExecutor("sh", []string{"-c", testServer}, nil, nil)
+	m := New(executor.Start, Config{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() { _ = m.Close() })
+	return m
+}
+
+// call はリクエストを実行し、レスポンスの ID と result を返します。
+func call(t *testing.T, ctx context.Context, m *Mux, request string) (string, string) {
+	t.Helper()
+	response, err := m.Call(ctx, []byte(request))
+	if err != nil {
+		t.Fatalf("Call(%s) error = %v", request, err)
+	}
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Result string          `json:"result"`
+	}
+	if err := json.Unmarshal(response, &msg); err != nil {
+		t.Fatalf("Call(%s) = %s: %v", request, response, err)
+	}
+	return string(msg.ID), msg.Result
+}
+
+func TestMux_Call(t *testing.T) {
+	m := newTestMux(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// initialize には Mux がプロセスを初期化した結果を返す
+	if id, result := call(t, ctx, m, `{"jsonrpc":"2.0","id":"init","method":"initialize","params":{}}`); id != `"init"` || result != "initialize" {
+		t.Errorf("initialize = %s %q, want the client id and the result of the process", id, result)
+	}
+
+	// 同じ ID の同時のリクエストも、プロセスが応答した順序に関わらず送ったリクエストに返す
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		if id, result := call(t, ctx, m, `{"jsonrpc":"2.0","id":1,"method":"hold"}`); id != "1" || result != "hold" {
+			t.Errorf("hold = %s %q, want 1 \"hold\"", id, result)
+		}
+	})
+	waitInFlight(t, m, 1)
+	if id, result := call(t, ctx, m, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`); id != "1" || result != "tools/list" {
+		t.Errorf("tools/list = %s %q, want 1 \"tools/list\"", id, result)
+	}
+	wg.Wait()
+
+	// 通知は送るだけで、クライアントの notifications/initialized はプロセスに送らない
+	for _, notification := range []string{`{"jsonrpc":"2.0","method":"notifications/initialized"}`, `{"jsonrpc":"2.0","method":"notifications/progress"}`} {
+		if response, err := m.Call(ctx, []byte(notification)); err != nil || response != nil {
+			t.Errorf("Call(%s) = %s, %v, want nil", notification, response, err)
+		}
+	}
+
+	if stats := m.Stats(); stats.Starts != 1 || stats.Requests != 3 || stats.Processes != 1 || stats.InFlight != 0 {
+		t.Errorf("Stats() = %+v, want 1 start, 3 requests and 1 idle process", stats)
+	}
+}
+
+// waitInFlight は応答を待っているリクエストが want 個になるまで待ちます。
+func waitInFlight(t *testing.T, m *Mux, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Stats().InFlight != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("InFlight = %d, want %d", m.Stats().InFlight, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMux_Subscribe(t *testing.T) {
+	m := newTestMux(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	notifications, unsubscribe := m.Subscribe()
+	if _, err := m.Call(ctx, []byte(`{"jsonrpc":"2.0","method":"notifications/test"}`)); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	select {
+	case msg := <-notifications:
+		if want := `{"jsonrpc":"2.0","method":"notifications/message","params":{"data":"test"}}`; string(msg) != want {
+			t.Errorf("notification = %s, want %s", msg, want)
+		}
+	case <-ctx.Done():
+		t.Fatal("notification was not delivered")
+	}
+
+	unsubscribe()
+	if _, ok := <-notifications; ok {
+		t.Error("channel is open after unsubscribing")
+	}
+	if got := m.Stats().Subscribers; got != 0 {
+		t.Errorf("Subscribers = %d, want 0", got)
+	}
+}
+
+func TestMux_RejectServerRequest(t *testing.T) {
+	m := newTestMux(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// プロセスからのリクエストにはエラーを返し、プロセスを待たせない
+	if _, result := call(t, ctx, m, `{"jsonrpc":"2.0","id":1,"method":"ask"}`); result != "rejected" {
+		t.Errorf("result = %q, want the server request to be rejected", result)
+	}
+}
+
+func TestMux_Cancel(t *testing.T) {
+	m := newTestMux(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	held, cancelHeld := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelHeld()
+	if _, err := m.Call(held, []byte(`{"jsonrpc":"2.0","id":1,"method":"hold"}`)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Call() error = %v, want DeadlineExceeded", err)
+	}
+
+	// 待つのをやめたリクエストのレスポンスは他のリクエストに渡さない
+	if id, result := call(t, ctx, m, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`); id != "1" || result != "tools/list" {
+		t.Errorf("tools/list = %s %q, want 1 \"tools/list\"", id, result)
+	}
+}
+
+func TestMux_Restart(t *testing.T) {
+	m := newTestMux(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := m.Call(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"exit"}`)); !errors.Is(err, ErrProcessExited) {
+		t.Fatalf("Call() error = %v, want ErrProcessExited", err)
+	}
+
+	// 終了したプロセスは次のリクエストで起動し直す
+	if _, result := call(t, ctx, m, `{"jsonrpc":"2.0","id":2,"method":"ping"}`); result != "ping" {
+		t.Errorf("result = %q, want \"ping\"", result)
+	}
+	if got := m.Stats().Starts; got != 2 {
+		t.Errorf("Starts = %d, want 2", got)
+	}
+}
+
+func TestMux_Drain(t *testing.T) {
+	m := newTestMux(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		if _, result := call(t, ctx, m, `{"jsonrpc":"2.0","id":1,"method":"hold"}`); result != "hold" {
+			t.Errorf("result = %q, want \"hold\"", result)
+		}
+	})
+	waitInFlight(t, m, 1)
+
+	// 切り替え前のプロセスに送ったリクエストには切り替え前のプロセスが応答する
+	m.Drain()
+	if _, err := m.Call(ctx, []byte(`{"jsonrpc":"2.0","id":2,"method":"ping"}`)); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if stats := m.Stats(); stats.Starts != 2 || stats.Processes != 2 {
+		t.Errorf("Stats() = %+v, want 2 starts and 2 processes", stats)
+	}
+
+	// hold を応答させ、切り替え前のプロセスを終了させる
+	m.mu.Lock()
+	var previous *child
+	for c := range m.children {
+		if c != m.current {
+			previous = c
+		}
+	}
+	m.mu.Unlock()
+	if err := previous.session.Send([]byte(`{"jsonrpc":"2.0","id":3,"method":"ping"}`)); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	wg.Wait()
+	select {
+	case <-previous.done:
+	case <-ctx.Done():
+		t.Fatal("drained process did not exit")
+	}
+	if got := m.Stats().Processes; got != 1 {
+		t.Errorf("Processes = %d, want 1", got)
+	}
+}
+
+func TestMux_Close(t *testing.T) {
+	m := newTestMux(t)
+	notifications, _ := m.Subscribe()
+	if _, err := m.Call(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if _, ok := <-notifications; ok {
+		t.Error("subscription is open after Close")
+	}
+	if _, err := m.Call(context.Background(), []byte(`{"jsonrpc":"2.0","id":2,"method":"ping"}`)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Call() after Close error = %v, want ErrClosed", err)
+	}
+}
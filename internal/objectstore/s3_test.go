@@ -0,0 +1,140 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 はパス形式の PUT と GET だけに応答する S3 互換サーバーです。
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = data
+	case http.MethodGet:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	}
+}
+
+func newTestS3(t *testing.T, rawURL string) (*S3, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret")
+	store, err := NewS3(rawURL + "?endpoint=" + server.URL)
+	if err != nil {
+		t.Fatalf("NewS3() error = %v", err)
+	}
+	return store, fake
+}
+
+func TestS3_PutGet(t *testing.T) {
+	store, fake := newTestS3(t, "s3://payloads/tumiki")
+	ctx := context.Background()
+
+	ref, err := store.Put(ctx, "abc", []byte("large payload"), "application/json")
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if ref != "s3://payloads/tumiki/abc" {
+		t.Errorf("ref = %q", ref)
+	}
+	if _, ok := fake.objects["/payloads/tumiki/abc"]; !ok {
+		t.Errorf("object not stored with a path-style URL: %v", fake.objects)
+	}
+
+	data, err := store.Get(ctx, ref, 0)
+	if err != nil || string(data) != "large payload" {
+		t.Errorf("Get() = %q, %v", data, err)
+	}
+
+	tests := []struct {
+		name     string
+		ref      string
+		maxBytes int64
+		wantErr  error
+	}{
+		{name: "存在しないオブジェクト_ErrNotFound", ref: "s3://payloads/tumiki/missing", wantErr: ErrNotFound},
+		{name: "別のバケット_ErrInvalidRef", ref: "s3://other/tumiki/abc", wantErr: ErrInvalidRef},
+		{name: "プレフィックスの外_ErrInvalidRef", ref: "s3://payloads/secrets/abc", wantErr: ErrInvalidRef},
+		{name: "パスの移動_ErrInvalidRef", ref: "s3://payloads/tumiki/../secrets/abc", wantErr: ErrInvalidRef},
+		{name: "上限を超えるサイズ_エラー", ref: ref, maxBytes: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := store.Get(ctx, tt.ref, tt.maxBytes)
+			if err == nil {
+				t.Fatal("Get() error = nil")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Get() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewS3(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("GCS_HMAC_ACCESS_ID", "")
+	t.Setenv("GCS_HMAC_SECRET", "")
+
+	tests := []struct {
+		name       string
+		url        string
+		wantErr    bool
+		wantRegion string
+		wantHosted bool
+	}{
+		{name: "s3_仮想ホスト形式", url: "s3://bucket/prefix?region=ap-northeast-1", wantRegion: "ap-northeast-1", wantHosted: true},
+		{name: "s3でリージョン省略_us-east-1", url: "s3://bucket", wantRegion: "us-east-1", wantHosted: true},
+		{name: "endpoint指定_パス形式", url: "s3://bucket?endpoint=http://localhost:9000", wantRegion: "us-east-1"},
+		{name: "不正なendpoint_エラー", url: "s3://bucket?endpoint=localhost", wantErr: true},
+		{name: "gsで認証情報なし_エラー", url: "gs://bucket", wantErr: true},
+		{name: "未対応のスキーム_エラー", url: "ftp://bucket", wantErr: true},
+		{name: "バケットなし_エラー", url: "s3:///prefix", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewS3(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewS3() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			opts := store.client.Options()
+			if opts.Region != tt.wantRegion || opts.UsePathStyle == tt.wantHosted {
+				t.Errorf("region = %q, path style = %v", opts.Region, opts.UsePathStyle)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Package objectstore は大きなペイロードをプロキシの外に退避するためのオブジェクトストレージを提供します。
+//
+// 退避したオブジェクトは "s3://bucket/key" のような参照で表し、
+// 参照を理解するクライアントとプロキシの間で JSON-RPC メッセージの代わりに受け渡します。
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound は参照先のオブジェクトが存在しないことを表します。
+var ErrNotFound = errors.New("object not found")
+
+// ErrInvalidRef はストアが扱えない参照であることを表します。
+var ErrInvalidRef = errors.New("invalid object reference")
+
+// Store はオブジェクトを保存し、参照から取得するストレージです。
+type Store interface {
+	// Put は data を name のオブジェクトとして保存し、その参照を返します。
+	Put(ctx context.Context, name string, data []byte, contentType string) (string, error)
+	// Get は参照先のオブジェクトを取得します。maxBytes を超える場合はエラーを返します。
+	Get(ctx context.Context, ref string, maxBytes int64) ([]byte, error)
+}
+
+// memoryScheme は Memory が返す参照のスキームです。
+const memoryScheme = "mem://"
+
+// Memory はプロセス内でオブジェクトを保持する Store です。テストで使用します。
+type Memory struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// NewMemory は空の Memory を作成します。
+func NewMemory() *Memory {
+	return &Memory{objects: make(map[string][]byte)}
+}
+
+// Put はオブジェクトを保存し、mem://name の参照を返します。
+func (m *Memory) Put(_ context.Context, name string, data []byte, _ string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[name] = append([]byte(nil), data...)
+	return memoryScheme + name, nil
+}
+
+// Get は mem:// の参照先のオブジェクトを返します。
+func (m *Memory) Get(_ context.Context, ref string, maxBytes int64) ([]byte, error) {
+	name, ok := strings.CutPrefix(ref, memoryScheme)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRef, ref)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, ref)
+	}
+	if maxBytes > 0 && int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("object %s is larger than %d bytes", ref, maxBytes)
+	}
+	return append([]byte(nil), data...), nil
+}
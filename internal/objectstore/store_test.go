@@ -0,0 +1,29 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	ref, err := m.Put(ctx, "a", []byte("data"), "")
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if data, err := m.Get(ctx, ref, 0); err != nil || string(data) != "data" {
+		t.Errorf("Get() = %q, %v", data, err)
+	}
+	if _, err := m.Get(ctx, "mem://missing", 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(missing) error = %v, want ErrNotFound", err)
+	}
+	if _, err := m.Get(ctx, "s3://bucket/a", 0); !errors.Is(err, ErrInvalidRef) {
+		t.Errorf("Get(s3) error = %v, want ErrInvalidRef", err)
+	}
+	if _, err := m.Get(ctx, ref, 2); err == nil {
+		t.Error("Get() larger than maxBytes error = nil")
+	}
+}
@@ -0,0 +1,318 @@
+// Package plugin は WebAssembly モジュールでリクエスト処理を拡張するプラグインの実行環境を提供します。
+//
+// プラグインは wazero で実行され、アダプターを再ビルドせずに認証やヘッダーの変換、
+// リクエスト・レスポンスの書き換えなどの独自の処理を追加できます。
+//
+// # ABI
+//
+// モジュールは次の関数をエクスポートします（フックは必要なものだけ）。
+//
+//   - tumiki_alloc(size: i32) -> i32: 入力を書き込むメモリを確保してアドレスを返す（必須）
+//   - tumiki_free(ptr: i32, size: i32): tumiki_alloc で確保したメモリや出力を解放する（任意）
+//   - tumiki_<hook>(ptr: i32, size: i32) -> i64: 入力を受け取り、出力のアドレスを上位32ビット、
+//     長さを下位32ビットに詰めて返す
+//
+// フックの入出力は次のとおりです。出力の長さが 0 の場合は何も変更しません。
+//
+//   - tumiki_authenticate: AuthRequest の JSON を受け取り、AuthResult の JSON を返す
+//   - tumiki_map_headers: HeaderRequest の JSON を受け取り、HeaderChanges の JSON を返す
+//   - tumiki_transform_request: JSON-RPC リクエストを受け取り、書き換えたリクエストを返す
+//   - tumiki_transform_response: JSON-RPC レスポンスを受け取り、書き換えたレスポンスを返す
+//
+// WASI（wasi_snapshot_preview1）を利用でき、リアクター形式のモジュールは _initialize で初期化します。
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// フックとしてエクスポートする関数名です。
+const (
+	HookAuthenticate      = "tumiki_authenticate"
+	HookMapHeaders        = "tumiki_map_headers"
+	HookTransformRequest  = "tumiki_transform_request"
+	HookTransformResponse = "tumiki_transform_response"
+
+	allocFunc = "tumiki_alloc"
+	freeFunc  = "tumiki_free"
+)
+
+// hooks はプラグインが実装できるフックの一覧です。
+var hooks = []string{HookAuthenticate, HookMapHeaders, HookTransformRequest, HookTransformResponse}
+
+// AuthRequest は tumiki_authenticate に渡すリクエストの情報です。
+type AuthRequest struct {
+	Method  string      `json:"method"`
+	Path    string      `json:"path"`
+	Headers http.Header `json:"headers"`
+}
+
+// AuthResult は tumiki_authenticate の結果です。
+type AuthResult struct {
+	Allow   bool   `json:"allow"`
+	Status  int    `json:"status,omitempty"`  // 拒否する場合のステータスコード（0 で 401）
+	Message string `json:"message,omitempty"` // 拒否する場合のエラーメッセージ
+}
+
+// HeaderRequest は tumiki_map_headers に渡すリクエストの情報です。
+type HeaderRequest struct {
+	Path    string      `json:"path"`
+	Headers http.Header `json:"headers"`
+}
+
+// HeaderChanges は tumiki_map_headers が返すヘッダーの変更です。
+// 変更後のヘッダーにヘッダーマッピングが適用されます。
+type HeaderChanges struct {
+	Set    map[string]string `json:"set,omitempty"`
+	Delete []string          `json:"delete,omitempty"`
+}
+
+// Apply はヘッダーの変更を適用したヘッダーを返します。元のヘッダーは変更しません。
+func (c HeaderChanges) Apply(header http.Header) http.Header {
+	header = header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	for _, name := range c.Delete {
+		header.Del(name)
+	}
+	for name, value := range c.Set {
+		header.Set(name, value)
+	}
+	return header
+}
+
+// Plugin は読み込んだ WebAssembly モジュールです。
+// 呼び出しごとにインスタンスを貸し出すため、複数のゴルーチンから同時に使用できます。
+type Plugin struct {
+	name     string
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	config   wazero.ModuleConfig
+	hooks    map[string]bool
+	idle     chan api.Module
+}
+
+// Load は path の WebAssembly モジュールをコンパイルし、エクスポートされたフックを調べます。
+func Load(ctx context.Context, path string) (*Plugin, error) {
+	wasm, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read plugin: %w", err)
+	}
+
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		_ = r.Close(ctx)
+		return nil, fmt.Errorf("instantiate WASI: %w", err)
+	}
+	compiled, err := r.CompileModule(ctx, wasm)
+	if err != nil {
+		_ = r.Close(ctx)
+		return nil, fmt.Errorf("compile plugin %s: %w", path, err)
+	}
+
+	exports := compiled.ExportedFunctions()
+	if _, ok := exports[allocFunc]; !ok {
+		_ = r.Close(ctx)
+		return nil, fmt.Errorf("plugin %s does not export %s", path, allocFunc)
+	}
+	p := &Plugin{
+		name:     filepath.Base(path),
+		runtime:  r,
+		compiled: compiled,
+		config:   wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"),
+		hooks:    make(map[string]bool),
+		idle:     make(chan api.Module, runtime.GOMAXPROCS(0)),
+	}
+	for _, hook := range hooks {
+		if _, ok := exports[hook]; ok {
+			p.hooks[hook] = true
+		}
+	}
+	if len(p.hooks) == 0 {
+		_ = r.Close(ctx)
+		return nil, fmt.Errorf("plugin %s exports no hooks", path)
+	}
+
+	// 読み込み時に初期化できることを確かめる
+	mod, err := p.acquire(ctx)
+	if err != nil {
+		_ = r.Close(ctx)
+		return nil, err
+	}
+	p.release(ctx, mod)
+	return p, nil
+}
+
+// Name はプラグインのファイル名を返します。
+func (p *Plugin) Name() string {
+	return p.name
+}
+
+// Has はプラグインがフックを実装しているかどうかを返します。
+func (p *Plugin) Has(hook string) bool {
+	return p.hooks[hook]
+}
+
+// Close はプラグインの全てのインスタンスを終了します。
+func (p *Plugin) Close(ctx context.Context) error {
+	return p.runtime.Close(ctx)
+}
+
+// Authenticate は tumiki_authenticate を呼び出します。フックがない場合は許可します。
+func (p *Plugin) Authenticate(ctx context.Context, req AuthRequest) (AuthResult, error) {
+	if !p.Has(HookAuthenticate) {
+		return AuthResult{Allow: true}, nil
+	}
+	var result AuthResult
+	if err := p.callJSON(ctx, HookAuthenticate, req, &result); err != nil {
+		return AuthResult{}, err
+	}
+	return result, nil
+}
+
+// MapHeaders は tumiki_map_headers を呼び出します。フックがない場合は何も変更しません。
+func (p *Plugin) MapHeaders(ctx context.Context, req HeaderRequest) (HeaderChanges, error) {
+	var changes HeaderChanges
+	if !p.Has(HookMapHeaders) {
+		return changes, nil
+	}
+	if err := p.callJSON(ctx, HookMapHeaders, req, &changes); err != nil {
+		return HeaderChanges{}, err
+	}
+	return changes, nil
+}
+
+// TransformRequest は tumiki_transform_request を呼び出します。
+// フックがない場合や出力が空の場合はメッセージをそのまま返します。
+func (p *Plugin) TransformRequest(ctx context.Context, msg []byte) ([]byte, error) {
+	return p.transform(ctx, HookTransformRequest, msg)
+}
+
+// TransformResponse は tumiki_transform_response を呼び出します。
+// フックがない場合や出力が空の場合はメッセージをそのまま返します。
+func (p *Plugin) TransformResponse(ctx context.Context, msg []byte) ([]byte, error) {
+	return p.transform(ctx, HookTransformResponse, msg)
+}
+
+func (p *Plugin) transform(ctx context.Context, hook string, msg []byte) ([]byte, error) {
+	if !p.Has(hook) {
+		return msg, nil
+	}
+	out, err := p.call(ctx, hook, msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return msg, nil
+	}
+	return out, nil
+}
+
+// callJSON は in を JSON として渡し、出力を out に読み込みます。出力が空の場合は out を変更しません。
+func (p *Plugin) callJSON(ctx context.Context, hook string, in, out any) error {
+	input, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	output, err := p.call(ctx, hook, input)
+	if err != nil {
+		return err
+	}
+	if len(output) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(output, out); err != nil {
+		return fmt.Errorf("plugin %s: invalid %s output: %w", p.name, hook, err)
+	}
+	return nil
+}
+
+// call はインスタンスのメモリに input を書き込んでフックを呼び出し、出力のコピーを返します。
+func (p *Plugin) call(ctx context.Context, hook string, input []byte) ([]byte, error) {
+	mod, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := p.invoke(ctx, mod, hook, input)
+	if err != nil {
+		// トラップしたインスタンスは状態が壊れている可能性があるため再利用しない
+		_ = mod.Close(ctx)
+		return nil, fmt.Errorf("plugin %s: %s: %w", p.name, hook, err)
+	}
+	p.release(ctx, mod)
+	return output, nil
+}
+
+func (p *Plugin) invoke(ctx context.Context, mod api.Module, hook string, input []byte) ([]byte, error) {
+	results, err := mod.ExportedFunction(allocFunc).Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, fmt.Errorf("allocate input: %w", err)
+	}
+	inPtr := uint32(results[0])
+	if !mod.Memory().Write(inPtr, input) {
+		return nil, errors.New("input out of memory range")
+	}
+
+	results, err = mod.ExportedFunction(hook).Call(ctx, uint64(inPtr), uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	free := mod.ExportedFunction(freeFunc)
+	if free != nil {
+		if _, err := free.Call(ctx, uint64(inPtr), uint64(len(input))); err != nil {
+			return nil, fmt.Errorf("free input: %w", err)
+		}
+	}
+
+	outPtr, outLen := uint32(results[0]>>32), uint32(results[0])
+	if outLen == 0 {
+		return nil, nil
+	}
+	view, ok := mod.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, errors.New("output out of memory range")
+	}
+	output := append([]byte(nil), view...)
+	if free != nil {
+		if _, err := free.Call(ctx, uint64(outPtr), uint64(outLen)); err != nil {
+			return nil, fmt.Errorf("free output: %w", err)
+		}
+	}
+	return output, nil
+}
+
+// acquire は待機中のインスタンスを返します。なければ新しく作成します。
+func (p *Plugin) acquire(ctx context.Context) (api.Module, error) {
+	select {
+	case mod := <-p.idle:
+		return mod, nil
+	default:
+	}
+	mod, err := p.runtime.InstantiateModule(ctx, p.compiled, p.config)
+	if err != nil {
+		return nil, fmt.Errorf("instantiate plugin %s: %w", p.name, err)
+	}
+	return mod, nil
+}
+
+// release はインスタンスを待機中に戻します。待機中のインスタンスが上限に達している場合は終了します。
+func (p *Plugin) release(ctx context.Context, mod api.Module) {
+	select {
+	case p.idle <- mod:
+	default:
+		_ = mod.Close(ctx)
+	}
+}
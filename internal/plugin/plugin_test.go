@@ -0,0 +1,192 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+var (
+	exampleOnce sync.Once
+	exampleDir  string
+	examplePath string
+	exampleErr  error
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if exampleDir != "" {
+		_ = os.RemoveAll(exampleDir)
+	}
+	os.Exit(code)
+}
+
+// buildExample は testdata/example を wasip1 向けにビルドし、WebAssembly モジュールのパスを返します。
+func buildExample(t *testing.T) string {
+	t.Helper()
+	exampleOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "tumiki-plugin")
+		if err != nil {
+			exampleErr = err
+			return
+		}
+		exampleDir = dir
+		examplePath = filepath.Join(dir, "example.wasm")
+		cmd := exec.Command(filepath.Join(runtime.GOROOT(), "bin", "go"), "build", "-buildmode=c-shared", "-o", examplePath, ".")
+		cmd.Dir = filepath.Join("testdata", "example")
+		cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			exampleErr = err
+			examplePath = string(out)
+		}
+	})
+	if exampleErr != nil {
+		t.Fatalf("build example plugin: %v\n%s", exampleErr, examplePath)
+	}
+	return examplePath
+}
+
+// loadExample はテスト用のプラグインを読み込みます。
+func loadExample(t *testing.T) *Plugin {
+	t.Helper()
+	p, err := Load(context.Background(), buildExample(t))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	t.Cleanup(func() { _ = p.Close(context.Background()) })
+	return p
+}
+
+func TestPlugin_Authenticate(t *testing.T) {
+	p := loadExample(t)
+
+	tests := []struct {
+		name  string
+		token string
+		want  AuthResult
+	}{
+		{name: "許可されたトークン_許可", token: "Bearer good", want: AuthResult{Allow: true}},
+		{name: "その他のトークン_拒否", token: "Bearer bad", want: AuthResult{Status: 403, Message: "forbidden by plugin"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Authenticate(context.Background(), AuthRequest{
+				Method:  "POST",
+				Path:    "/mcp",
+				Headers: http.Header{"Authorization": {tt.token}},
+			})
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Authenticate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlugin_MapHeaders(t *testing.T) {
+	p := loadExample(t)
+
+	header := http.Header{"Authorization": {"Bearer good"}, "X-Other": {"1"}}
+	changes, err := p.MapHeaders(context.Background(), HeaderRequest{Path: "/mcp", Headers: header})
+	if err != nil {
+		t.Fatalf("MapHeaders() error = %v", err)
+	}
+	got := changes.Apply(header)
+	want := http.Header{"X-Tenant": {"acme"}, "X-Other": {"1"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("headers = %v, want %v", got, want)
+	}
+	if header.Get("Authorization") == "" {
+		t.Error("Apply() modified the original header")
+	}
+
+	// 出力が空の場合は変更しない
+	changes, err = p.MapHeaders(context.Background(), HeaderRequest{Headers: http.Header{}})
+	if err != nil || len(changes.Set) != 0 || len(changes.Delete) != 0 {
+		t.Errorf("MapHeaders() = %+v, %v, want no changes", changes, err)
+	}
+}
+
+func TestPlugin_Transform(t *testing.T) {
+	p := loadExample(t)
+
+	tests := []struct {
+		name      string
+		transform func(context.Context, []byte) ([]byte, error)
+		in        string
+		want      string
+	}{
+		{name: "リクエスト_書き換える", transform: p.TransformRequest, in: `{"method":"hello"}`, want: `{"method":"ping"}`},
+		{name: "リクエストの出力なし_そのまま", transform: p.TransformRequest, in: `{"method":"tools/list"}`, want: `{"method":"tools/list"}`},
+		{name: "レスポンス_書き換える", transform: p.TransformResponse, in: `{"result":"secret"}`, want: `{"result":"******"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.transform(context.Background(), []byte(tt.in))
+			if err != nil {
+				t.Fatalf("transform error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("transform = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlugin_Concurrent(t *testing.T) {
+	p := loadExample(t)
+
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Go(func() {
+			for range 20 {
+				got, err := p.TransformResponse(context.Background(), []byte(`{"result":"secret"}`))
+				if err != nil || string(got) != `{"result":"******"}` {
+					t.Errorf("TransformResponse() = %s, %v", got, err)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func TestLoad_Errors(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.wasm")
+	if err := os.WriteFile(invalid, []byte("not wasm"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// 関数をエクスポートしない最小のモジュール（マジックナンバーとバージョンのみ）
+	empty := filepath.Join(dir, "empty.wasm")
+	if err := os.WriteFile(empty, []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "存在しないファイル_エラー", path: filepath.Join(dir, "missing.wasm")},
+		{name: "WebAssemblyでない_エラー", path: invalid},
+		{name: "tumiki_allocなし_エラー", path: empty},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(context.Background(), tt.path); err == nil {
+				t.Error("Load() expected error but got none")
+			}
+		})
+	}
+}
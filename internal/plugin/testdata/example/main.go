@@ -0,0 +1,91 @@
+// example はテスト用のプラグインです。
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o example.wasm .
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"unsafe"
+)
+
+// buffers はホストが解放するまで GC されないよう確保したメモリを保持します。
+var buffers = map[uint32][]byte{}
+
+//go:wasmexport tumiki_alloc
+func alloc(size uint32) uint32 {
+	buf := make([]byte, max(size, 1))
+	ptr := uint32(uintptr(unsafe.Pointer(&buf[0])))
+	buffers[ptr] = buf
+	return ptr
+}
+
+//go:wasmexport tumiki_free
+func free(ptr, _ uint32) {
+	delete(buffers, ptr)
+}
+
+func input(ptr, size uint32) []byte {
+	return buffers[ptr][:size]
+}
+
+func output(b []byte) uint64 {
+	if len(b) == 0 {
+		return 0
+	}
+	ptr := alloc(uint32(len(b)))
+	copy(buffers[ptr], b)
+	return uint64(ptr)<<32 | uint64(len(b))
+}
+
+// authenticate は "Bearer good" のトークンだけを許可します。
+//
+//go:wasmexport tumiki_authenticate
+func authenticate(ptr, size uint32) uint64 {
+	var req struct {
+		Headers map[string][]string `json:"headers"`
+	}
+	if err := json.Unmarshal(input(ptr, size), &req); err != nil {
+		panic(err)
+	}
+	if v := req.Headers["Authorization"]; len(v) > 0 && v[0] == "Bearer good" {
+		return output([]byte(`{"allow":true}`))
+	}
+	return output([]byte(`{"allow":false,"status":403,"message":"forbidden by plugin"}`))
+}
+
+// mapHeaders はトークンからテナントのヘッダーを作り、トークン自体は削除します。
+//
+//go:wasmexport tumiki_map_headers
+func mapHeaders(ptr, size uint32) uint64 {
+	var req struct {
+		Headers map[string][]string `json:"headers"`
+	}
+	if err := json.Unmarshal(input(ptr, size), &req); err != nil {
+		panic(err)
+	}
+	if len(req.Headers["Authorization"]) == 0 {
+		return 0
+	}
+	return output([]byte(`{"set":{"X-Tenant":"acme"},"delete":["Authorization"]}`))
+}
+
+// transformRequest はメソッド名 "hello" を "ping" に書き換えます。
+//
+//go:wasmexport tumiki_transform_request
+func transformRequest(ptr, size uint32) uint64 {
+	msg := input(ptr, size)
+	if !bytes.Contains(msg, []byte(`"hello"`)) {
+		return 0
+	}
+	return output(bytes.ReplaceAll(msg, []byte(`"hello"`), []byte(`"ping"`)))
+}
+
+// transformResponse は "secret" を伏せ字にします。
+//
+//go:wasmexport tumiki_transform_response
+func transformResponse(ptr, size uint32) uint64 {
+	return output(bytes.ReplaceAll(input(ptr, size), []byte("secret"), []byte("******")))
+}
+
+func main() {}
@@ -0,0 +1,374 @@
+package process
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+)
+
+// プロセスの再利用の設定のデフォルト値
+const (
+	DefaultCacheTTL        = 5 * time.Minute // 最後に使ってからプロセスを保持するデフォルトの期間
+	DefaultCacheMaxEntries = 16              // 保持するプロセスのデフォルトの最大数
+)
+
+// ErrCacheClosed は Close 後の Cache で実行しようとした場合のエラーです。
+var ErrCacheClosed = errors.New("process cache closed")
+
+// CacheConfig は Cache が起動し続けるプロセスを保持する期間と数の設定です。
+type CacheConfig struct {
+	TTL        time.Duration // 最後に使ってからプロセスを保持する期間（0 でデフォルト）
+	MaxEntries int           // 保持するプロセスの最大数（0 でデフォルト）
+}
+
+// CacheStats は Cache の状態と累計値です。
+type CacheStats struct {
+	Processes int   // 保持しているプロセスの数
+	Hits      int64 // 起動済みのプロセスを再利用した実行の累計
+	Misses    int64 // 新しくプロセスを起動した実行の累計
+	Evictions int64 // 期限切れか上限を超えたため終了させたプロセスの累計
+}
+
+// ValidateCacheConfig はプロセスの再利用の設定を検証します。
+func ValidateCacheConfig(cfg CacheConfig) error {
+	if cfg.TTL < 0 {
+		return fmt.Errorf("process cache ttl must not be negative: %s", cfg.TTL)
+	}
+	if cfg.MaxEntries < 0 {
+		return fmt.Errorf("process cache max entries must not be negative: %d", cfg.MaxEntries)
+	}
+	return nil
+}
+
+// Cache はコマンド・引数・環境変数が同じ Executor のリクエストを、起動し続ける1つのプロセスで実行します。
+// プロセスは組み合わせのハッシュをキーに保持し、TTL の間使われなかったものと、
+// MaxEntries を超えた場合に最も長く使われていないものを終了させます。
+// 1つのプロセスへのリクエストは ID の衝突を避けるため1つずつ順に実行します。
+type Cache struct {
+	cfg CacheConfig
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*list.Element
+	lru       *list.List // 先頭ほど最近使われた cachedProcess
+	closed    bool
+	hits      int64
+	misses    int64
+	evictions int64
+
+	workers group // 期限切れのプロセスを終了させる goroutine
+	stop    chan struct{}
+}
+
+// cachedProcess は Cache が保持する1つの起動し続けるプロセスです。
+type cachedProcess struct {
+	key      string
+	executor *Executor
+
+	// 以下は Cache.mu で保護する
+	refs     int       // 実行中のリクエストの数
+	lastUsed time.Time // 最後にリクエストを終えた時刻
+	removed  bool      // キャッシュから取り除かれた（実行中のリクエストが終わると終了させる）
+
+	run     sync.Mutex // プロセスとのやり取りを1リクエストずつに制限する
+	session *Session   // 最初のリクエストで起動する（run と refs > 0 の間だけ書き換える）
+}
+
+// NewCache は Cache を作成し、期限切れのプロセスを終了させる goroutine を起動します。
+func NewCache(cfg CacheConfig) (*Cache, error) {
+	if err := ValidateCacheConfig(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = DefaultCacheTTL
+	}
+	if cfg.MaxEntries == 0 {
+		cfg.MaxEntries = DefaultCacheMaxEntries
+	}
+	c := &Cache{
+		cfg:     cfg,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		stop:    make(chan struct{}),
+	}
+	c.workers.Go(func() error { c.expire(); return nil })
+	return c, nil
+}
+
+// Execute は e と同じコマンド・引数・環境変数で起動済みのプロセスに input を送り、同じ ID のレスポンスを返します。
+// プロセスがなければ起動し、レスポンスより前に出力された通知などは読み飛ばします。
+// input がリクエストでない場合は共有のプロセスに送らず、e.Execute で実行します。
+// 実行に失敗したプロセスは、遅れて届くレスポンスを次のリクエストが受け取らないよう終了させます。
+func (c *Cache) Execute(ctx context.Context, e *Executor, input []byte) ([]byte, error) {
+	msg, err := jsonrpc.Parse(input)
+	if err != nil || !msg.IsRequest() {
+		return e.Execute(ctx, input)
+	}
+
+	entry, err := c.acquire(e)
+	if err != nil {
+		return nil, err
+	}
+	defer c.release(entry)
+
+	entry.run.Lock()
+	defer entry.run.Unlock()
+	response, err := entry.exchange(ctx, input, msg.ID)
+	if err != nil {
+		c.remove(entry, false)
+	}
+	return response, err
+}
+
+// acquire は e のキーのプロセスを実行中として取り出します。なければ登録します。
+func (c *Cache) acquire(e *Executor) (*cachedProcess, error) {
+	key := e.fingerprint()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrCacheClosed
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(elem)
+		entry := elem.Value.(*cachedProcess)
+		entry.refs++
+		c.hits++
+		return entry, nil
+	}
+
+	c.misses++
+	entry := &cachedProcess{key: key, executor: e, refs: 1, lastUsed: c.now()}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.cfg.MaxEntries {
+		if evicted := c.lru.Back().Value.(*cachedProcess); c.removeLocked(evicted, true) {
+			spawn(evicted.close)
+		}
+	}
+	return entry, nil
+}
+
+// release はリクエストの終了を記録し、取り除かれたプロセスは最後のリクエストの終了後に終了させます。
+func (c *Cache) release(entry *cachedProcess) {
+	c.mu.Lock()
+	entry.refs--
+	entry.lastUsed = c.now()
+	closing := entry.removed && entry.refs == 0
+	c.mu.Unlock()
+
+	if closing {
+		spawn(entry.close)
+	}
+}
+
+// remove はプロセスをキャッシュから取り除き、実行中のリクエストがなければ終了させます。
+func (c *Cache) remove(entry *cachedProcess, evicted bool) {
+	c.mu.Lock()
+	closing := c.removeLocked(entry, evicted)
+	c.mu.Unlock()
+
+	if closing {
+		spawn(entry.close)
+	}
+}
+
+// removeLocked はプロセスをキャッシュから取り除き、すぐに終了させてよいかどうかを返します。
+// 実行中のリクエストがあるプロセスは release で終了させます。c.mu を保持した状態で呼び出してください。
+func (c *Cache) removeLocked(entry *cachedProcess, evicted bool) bool {
+	if entry.removed {
+		return false
+	}
+	entry.removed = true
+	if elem, ok := c.entries[entry.key]; ok {
+		c.lru.Remove(elem)
+		delete(c.entries, entry.key)
+	}
+	if evicted {
+		c.evictions++
+	}
+	return entry.refs == 0
+}
+
+// expire は TTL の半分の間隔で、TTL の間使われなかったプロセスを終了させます。
+func (c *Cache) expire() {
+	ticker := time.NewTicker(max(c.cfg.TTL/2, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.evictExpired(c.now())
+		}
+	}
+}
+
+// evictExpired は now の時点で TTL の間使われていない、実行中でないプロセスを終了させます。
+func (c *Cache) evictExpired(now time.Time) {
+	c.mu.Lock()
+	var expired []*cachedProcess
+	for elem := c.lru.Front(); elem != nil; {
+		entry := elem.Value.(*cachedProcess)
+		elem = elem.Next()
+		if entry.refs == 0 && now.Sub(entry.lastUsed) >= c.cfg.TTL && c.removeLocked(entry, true) {
+			expired = append(expired, entry)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, entry := range expired {
+		entry.close()
+	}
+}
+
+// Stats は現在の状態と累計値を返します。
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Processes: c.lru.Len(),
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
+
+// Drain は全てのプロセスをキャッシュから取り除きます。
+// 実行中でないプロセスはすぐに、実行中のプロセスはリクエストの終了後に終了させ、以降のリクエストは新しく起動したプロセスで実行します。
+func (c *Cache) Drain() {
+	for _, entry := range c.removeAll() {
+		spawn(entry.close)
+	}
+}
+
+// DrainLabel は WithLabel で label を設定した Executor のプロセスだけをキャッシュから取り除きます。
+// 実行中でないプロセスはすぐに、実行中のプロセスはリクエストの終了後に終了させます。
+func (c *Cache) DrainLabel(label string) {
+	c.mu.Lock()
+	var idle []*cachedProcess
+	for elem := c.lru.Front(); elem != nil; {
+		entry := elem.Value.(*cachedProcess)
+		elem = elem.Next()
+		if entry.executor.label == label && c.removeLocked(entry, false) {
+			idle = append(idle, entry)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, entry := range idle {
+		spawn(entry.close)
+	}
+}
+
+// Close は全てのプロセスを終了させ、以降の実行を拒否します。実行中のプロセスはリクエストの終了後に終了させます。
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	idle := c.removeAll()
+	close(c.stop)
+	_ = c.workers.Wait()
+
+	var errs []error
+	for _, entry := range idle {
+		errs = append(errs, entry.closeSession())
+	}
+	return errors.Join(errs...)
+}
+
+// removeAll は全てのプロセスをキャッシュから取り除き、実行中でないものを返します。
+func (c *Cache) removeAll() []*cachedProcess {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var idle []*cachedProcess
+	for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*cachedProcess)
+		entry.removed = true
+		if entry.refs == 0 {
+			idle = append(idle, entry)
+		}
+	}
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	return idle
+}
+
+// exchange はプロセスを必要なら起動し、input を送って id のレスポンスを待ちます。entry.run を保持した状態で呼び出してください。
+func (entry *cachedProcess) exchange(ctx context.Context, input []byte, id []byte) ([]byte, error) {
+	if entry.session != nil && !entry.session.alive() {
+		// リクエストの間に終了したプロセスは起動し直す
+		_ = entry.session.Close()
+		entry.session = nil
+	}
+	if entry.session == nil {
+		// プロセスはリクエストより長く生存するため、リクエストの ctx には紐付けない
+		session, err := entry.executor.Start(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		entry.session = session
+	}
+
+	if err := entry.session.Send(input); err != nil {
+		return nil, err
+	}
+	for {
+		msg, err := entry.session.Receive(ctx)
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("process exited before responding: %w", err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if parsed, err := jsonrpc.Parse(msg); err == nil && parsed.IsResponse() && jsonrpc.SameID(parsed.ID, id) {
+			return msg, nil
+		}
+	}
+}
+
+// close はプロセスを終了させ、失敗した場合はログに記録します。
+func (entry *cachedProcess) close() {
+	if err := entry.closeSession(); err != nil && entry.executor.logger != nil {
+		entry.executor.logger.Debug("Failed to close cached process", "error", err)
+	}
+}
+
+// closeSession は起動済みのプロセスを終了させます。
+func (entry *cachedProcess) closeSession() error {
+	if entry.session == nil {
+		return nil
+	}
+	return entry.session.Close()
+}
+
+// fingerprint はコマンド・引数・環境変数の組み合わせを識別するキーを返します。
+// 環境変数に含まれる秘密情報をそのままキーとして保持しないようハッシュ化します。
+func (e *Executor) fingerprint() string {
+	h := sha256.New()
+	h.Write([]byte(e.command + "\x00"))
+	for _, arg := range e.args {
+		h.Write([]byte(arg + "\x00"))
+	}
+	h.Write([]byte("\x00"))
+	for _, k := range slices.Sorted(maps.Keys(e.env)) {
+		h.Write([]byte(k + "=" + e.env[k] + "\x00"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
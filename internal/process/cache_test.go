@@ -0,0 +1,188 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// pidServer はリクエストごとに通知を1つ出力してから、result にプロセスの PID を入れたレスポンスを返すスクリプトです。
+const pidServer = `while read line; do
+echo '{"jsonrpc":"2.0","method":"notifications/message"}'
+printf '%s\n' "$line" | sed "s/\"method\":\"[^\"]*\"/\"result\":$$/"
+done`
+
+// newTestCache はテスト用の Cache を作成します。
+func newTestCache(t *testing.T, cfg CacheConfig) *Cache {
+	t.Helper()
+	cache, err := NewCache(cfg)
+	if err != nil {
+		t.Fatalf("NewCache() error = %v", err)
+	}
+	t.Cleanup(func() { _ = cache.Close() })
+	return cache
+}
+
+// executeForPID は id のリクエストを実行し、レスポンスの PID を返します。
+func executeForPID(t *testing.T, cache *Cache, e *Executor, id int) int {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := cache.Execute(ctx, e, fmt.Appendf(nil, `{"jsonrpc":"2.0","id":%d,"method":"tools/list"}`, id))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	var msg struct {
+		ID     int `json:"id"`
+		Result int `json:"result"`
+	}
+	if err := json.Unmarshal(response, &msg); err != nil {
+		t.Fatalf("response = %s, want a response with the pid: %v", response, err)
+	}
+	if msg.ID != id {
+		t.Errorf("response id = %d, want %d", msg.ID, id)
+	}
+	return msg.Result
+}
+
+func TestCache_Execute(t *testing.T) {
+	cache := newTestCache(t, CacheConfig{})
+	executor := func(env map[string]string) *Executor {
+		return NewExecutor("sh", []string{"-c", pidServer}, env, nil)
+	}
+
+	// 同じコマンド・引数・環境変数のリクエストは同じプロセスで実行する
+	first := executeForPID(t, cache, executor(map[string]string{"TOKEN": "a"}), 1)
+	if got := executeForPID(t, cache, executor(map[string]string{"TOKEN": "a"}), 2); got != first {
+		t.Errorf("pid = %d, want the reused process %d", got, first)
+	}
+
+	// 環境変数が異なるリクエストは別のプロセスで実行する
+	if got := executeForPID(t, cache, executor(map[string]string{"TOKEN": "b"}), 3); got == first {
+		t.Errorf("pid = %d, want another process for a different env", got)
+	}
+
+	want := CacheStats{Processes: 2, Hits: 1, Misses: 2}
+	if got := cache.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCache_Execute_Notification(t *testing.T) {
+	cache := newTestCache(t, CacheConfig{})
+
+	// リクエストでない入力は共有のプロセスに送らない
+	got, err := cache.Execute(context.Background(), NewExecutor("cat", nil, nil, nil), []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if string(got) != `{"jsonrpc":"2.0","method":"notifications/initialized"}` {
+		t.Errorf("Execute() = %s, want the echo", got)
+	}
+	if got := cache.Stats(); got.Processes != 0 {
+		t.Errorf("Processes = %d, want 0", got.Processes)
+	}
+}
+
+func TestCache_Evict(t *testing.T) {
+	cache := newTestCache(t, CacheConfig{TTL: time.Hour, MaxEntries: 1})
+	a := NewExecutor("sh", []string{"-c", pidServer, "a"}, nil, nil)
+	b := NewExecutor("sh", []string{"-c", pidServer, "b"}, nil, nil)
+
+	// 上限を超えると最も長く使われていないプロセスを終了させる
+	first := executeForPID(t, cache, a, 1)
+	executeForPID(t, cache, b, 2)
+	if got := executeForPID(t, cache, a, 3); got == first {
+		t.Errorf("pid = %d, want a new process after eviction", got)
+	}
+	if got := cache.Stats(); got.Processes != 1 || got.Evictions != 2 {
+		t.Errorf("Stats() = %+v, want 1 process and 2 evictions", got)
+	}
+
+	// TTL の間使われなかったプロセスを終了させる
+	cache.evictExpired(time.Now())
+	if got := cache.Stats().Processes; got != 1 {
+		t.Errorf("Processes = %d before TTL, want 1", got)
+	}
+	cache.evictExpired(time.Now().Add(time.Hour))
+	if got := cache.Stats(); got.Processes != 0 || got.Evictions != 3 {
+		t.Errorf("Stats() = %+v, want no processes and 3 evictions", got)
+	}
+}
+
+func TestCache_Restart(t *testing.T) {
+	cache := newTestCache(t, CacheConfig{})
+	// 1つのリクエストに応答すると終了するプロセス
+	executor := NewExecutor("sh", []string{"-c", `read line; printf '%s\n' "$line" | sed "s/\"method\":\"[^\"]*\"/\"result\":$$/"`}, nil, nil)
+
+	first := executeForPID(t, cache, executor, 1)
+	cache.mu.Lock()
+	session := cache.lru.Front().Value.(*cachedProcess).session
+	cache.mu.Unlock()
+	select {
+	case <-session.Exited():
+	case <-time.After(5 * time.Second):
+		t.Fatal("process did not exit")
+	}
+
+	// 終了したプロセスは次のリクエストで起動し直す
+	if got := executeForPID(t, cache, executor, 2); got == first {
+		t.Errorf("pid = %d, want a restarted process", got)
+	}
+}
+
+func TestCache_DrainLabel(t *testing.T) {
+	cache := newTestCache(t, CacheConfig{})
+	a := NewExecutor("sh", []string{"-c", pidServer, "a"}, nil, nil, WithLabel("default"))
+	b := NewExecutor("sh", []string{"-c", pidServer, "b"}, nil, nil, WithLabel("github"))
+	firstA := executeForPID(t, cache, a, 1)
+	firstB := executeForPID(t, cache, b, 2)
+
+	// 同じラベルのプロセスだけを終了させ、他のプロセスは再利用し続ける
+	cache.DrainLabel("github")
+	if got := cache.Stats().Processes; got != 1 {
+		t.Errorf("Processes = %d, want 1", got)
+	}
+	if got := executeForPID(t, cache, a, 3); got != firstA {
+		t.Errorf("pid of default = %d, want the reused process %d", got, firstA)
+	}
+	if got := executeForPID(t, cache, b, 4); got == firstB {
+		t.Errorf("pid of github = %d, want a new process after DrainLabel", got)
+	}
+}
+
+func TestCache_Close(t *testing.T) {
+	cache := newTestCache(t, CacheConfig{})
+	executor := NewExecutor("sh", []string{"-c", pidServer}, nil, nil)
+	executeForPID(t, cache, executor, 1)
+
+	if err := cache.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if _, err := cache.Execute(context.Background(), executor, []byte(`{"jsonrpc":"2.0","id":2,"method":"ping"}`)); !errors.Is(err, ErrCacheClosed) {
+		t.Errorf("Execute() after Close error = %v, want ErrCacheClosed", err)
+	}
+}
+
+func TestValidateCacheConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     CacheConfig
+		wantErr bool
+	}{
+		{name: "デフォルト", cfg: CacheConfig{}},
+		{name: "期間と最大数", cfg: CacheConfig{TTL: time.Minute, MaxEntries: 4}},
+		{name: "期間が負_エラー", cfg: CacheConfig{TTL: -time.Second}, wantErr: true},
+		{name: "最大数が負_エラー", cfg: CacheConfig{MaxEntries: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateCacheConfig(tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCacheConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
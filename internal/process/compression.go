@@ -0,0 +1,82 @@
+package process
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+)
+
+// CompressionGzip は各メッセージを gzip 圧縮して base64 エンコードした1行として送受信する形式です。
+const CompressionGzip = "gzip"
+
+// CompressionEnv は子プロセスに有効な圧縮形式を伝える環境変数です。
+// 対応するサーバーはこの値を見て圧縮フレームを読み書きします。
+const CompressionEnv = "MCP_STDIO_COMPRESSION"
+
+// ValidateCompression は圧縮形式の名前が対応しているものかを検証します。空文字列は無効化を表します。
+func ValidateCompression(name string) error {
+	switch name {
+	case "", CompressionGzip:
+		return nil
+	default:
+		return fmt.Errorf("unsupported stdio compression %q (supported: %s)", name, CompressionGzip)
+	}
+}
+
+// WithCompression は stdio で送受信するメッセージの圧縮を有効にします。
+// stdin へは常に圧縮して書き込み、stdout からは圧縮フレームと平文の JSON の両方を受け付けます。
+func WithCompression(name string) Option {
+	return func(e *Executor) {
+		e.compression = name
+	}
+}
+
+// encodeMessage は stdin に書き込むメッセージを圧縮フレームに変換します。
+func (e *Executor) encodeMessage(msg []byte) ([]byte, error) {
+	if e.compression == "" {
+		return msg, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(msg); err != nil {
+		return nil, fmt.Errorf("compress message: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("compress message: %w", err)
+	}
+
+	frame := make([]byte, base64.StdEncoding.EncodedLen(buf.Len()))
+	base64.StdEncoding.Encode(frame, buf.Bytes())
+	return frame, nil
+}
+
+// decodeMessage は stdout から読み取った1行を JSON-RPC メッセージに戻します。
+// 平文の JSON（'{' または '[' で始まる行）はそのまま返します。
+// 展開後のサイズが最大メッセージサイズを超える場合はエラーを返します。
+func (e *Executor) decodeMessage(line []byte) ([]byte, error) {
+	if e.compression == "" || len(line) == 0 || line[0] == '{' || line[0] == '[' {
+		return line, nil
+	}
+
+	compressed := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+	n, err := base64.StdEncoding.Decode(compressed, line)
+	if err != nil {
+		return nil, fmt.Errorf("decode compressed frame: %w", err)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(compressed[:n]))
+	if err != nil {
+		return nil, fmt.Errorf("decompress frame: %w", err)
+	}
+	msg, err := io.ReadAll(io.LimitReader(zr, int64(e.maxMessageSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("decompress frame: %w", err)
+	}
+	if len(msg) > e.maxMessageSize {
+		return nil, fmt.Errorf("decompress frame: message exceeds max size of %d bytes", e.maxMessageSize)
+	}
+	return msg, nil
+}
@@ -0,0 +1,165 @@
+package process
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateCompression(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{name: "空文字列_無効化として許可", input: "", wantErr: false},
+		{name: "gzip_許可", input: "gzip", wantErr: false},
+		{name: "未対応の形式_エラー", input: "zstd", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateCompression(tt.input); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCompression() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func gzipFrame(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return []byte(base64.StdEncoding.EncodeToString(buf.Bytes()))
+}
+
+func TestExecutor_DecodeMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression string
+		line        []byte
+		want        string
+		wantErr     string
+	}{
+		{name: "圧縮無効_そのまま返す", compression: "", line: []byte("H4sI"), want: "H4sI"},
+		{name: "平文のオブジェクト_そのまま返す", compression: CompressionGzip, line: []byte(`{"id":1}`), want: `{"id":1}`},
+		{name: "平文のバッチ_そのまま返す", compression: CompressionGzip, line: []byte(`[{"id":1}]`), want: `[{"id":1}]`},
+		{name: "圧縮フレーム_展開する", compression: CompressionGzip, line: gzipFrame(t, `{"id":1}`), want: `{"id":1}`},
+		{name: "不正なbase64_エラー", compression: CompressionGzip, line: []byte("!!!"), wantErr: "decode compressed frame"},
+		{name: "gzipでないデータ_エラー", compression: CompressionGzip, line: []byte(base64.StdEncoding.EncodeToString([]byte("plain"))), wantErr: "decompress frame"},
+		{name: "展開後に最大サイズ超過_エラー", compression: CompressionGzip, line: gzipFrame(t, strings.Repeat("a", 64)), wantErr: "exceeds max size of 32 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewExecutor("cat", nil, nil, nil, WithCompression(tt.compression), WithMaxMessageSize(32))
+			got, err := e.decodeMessage(tt.line)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("decodeMessage() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeMessage() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("decodeMessage() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecutor_EncodeMessage(t *testing.T) {
+	e := NewExecutor("cat", nil, nil, nil, WithCompression(CompressionGzip))
+
+	frame, err := e.encodeMessage([]byte(`{"id":1}`))
+	if err != nil {
+		t.Fatalf("encodeMessage() error = %v", err)
+	}
+	// 圧縮フレームは改行を含まない1行になる
+	if bytes.ContainsAny(frame, "\n{") {
+		t.Errorf("encodeMessage() = %s, want a single base64 line", frame)
+	}
+	got, err := e.decodeMessage(frame)
+	if err != nil || string(got) != `{"id":1}` {
+		t.Errorf("decodeMessage(encodeMessage()) = %s, %v", got, err)
+	}
+}
+
+func TestExecutor_Compression(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	input := []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+
+	t.Run("Execute_圧縮フレームを往復できる", func(t *testing.T) {
+		// 受け取ったフレームをそのまま返すサーバー
+		e := NewExecutor("sh", []string{"-c", `read line; echo "$line"`}, map[string]string{}, nil, WithCompression(CompressionGzip))
+		got, err := e.Execute(ctx, input)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		if !bytes.Equal(got, input) {
+			t.Errorf("Execute() = %s, want %s", got, input)
+		}
+	})
+
+	t.Run("Execute_環境変数で圧縮形式を通知する", func(t *testing.T) {
+		e := NewExecutor("sh", []string{"-c", `read line; echo "{\"compression\":\"$MCP_STDIO_COMPRESSION\"}"`}, map[string]string{}, nil, WithCompression(CompressionGzip))
+		got, err := e.Execute(ctx, input)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		if string(got) != `{"compression":"gzip"}` {
+			t.Errorf("Execute() = %s", got)
+		}
+	})
+
+	t.Run("Stream_不正なフレームはエラー", func(t *testing.T) {
+		e := NewExecutor("sh", []string{"-c", `read line; echo "!!!"`}, map[string]string{}, nil, WithCompression(CompressionGzip))
+		err := e.Stream(ctx, input, func([]byte) error { return nil })
+		if err == nil || !strings.Contains(err.Error(), "decode compressed frame") {
+			t.Errorf("Stream() error = %v, want decode error", err)
+		}
+	})
+
+	t.Run("Session_圧縮フレームを往復できる", func(t *testing.T) {
+		e := NewExecutor("cat", []string{}, map[string]string{}, nil, WithCompression(CompressionGzip))
+		session, err := e.Start(ctx)
+		if err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		defer func() { _ = session.Close() }()
+
+		if err := session.Send(input); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		got, err := session.Receive(ctx)
+		if err != nil || !bytes.Equal(got, input) {
+			t.Errorf("Receive() = %s, %v, want %s", got, err, input)
+		}
+	})
+
+	t.Run("Session_不正なフレームは読み取りエラー", func(t *testing.T) {
+		e := NewExecutor("sh", []string{"-c", `echo "!!!"`}, map[string]string{}, nil, WithCompression(CompressionGzip))
+		session, err := e.Start(ctx)
+		if err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		defer func() { _ = session.Close() }()
+
+		if _, err := session.Receive(ctx); err == nil || !strings.Contains(err.Error(), "decode compressed frame") {
+			t.Errorf("Receive() error = %v, want decode error", err)
+		}
+	})
+}
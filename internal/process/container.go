@@ -0,0 +1,91 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// コマンドをコンテナイメージとして実行するコンテナランタイムです。
+const (
+	RuntimeDocker     = "docker"
+	RuntimePodman     = "podman"
+	RuntimeContainerd = "containerd"
+)
+
+// containerCLIs はコンテナランタイムごとに `run` を実行する CLI です。
+// containerd は Docker 互換の nerdctl を使います（rootless の containerd にも対応）。
+var containerCLIs = map[string]string{
+	RuntimeDocker:     "docker",
+	RuntimePodman:     "podman",
+	RuntimeContainerd: "nerdctl",
+}
+
+// ValidateRuntime はコンテナランタイムまたは RuntimeFirecracker の名前を検証します。空文字列はホストのプロセスを表します。
+func ValidateRuntime(name string) error {
+	if _, ok := containerCLIs[name]; name != "" && name != RuntimeFirecracker && !ok {
+		return fmt.Errorf("unsupported runtime %q (want %s, %s, %s or %s)", name, RuntimeDocker, RuntimePodman, RuntimeContainerd, RuntimeFirecracker)
+	}
+	return nil
+}
+
+// containerCommand はコンテナランタイムの CLI で実行するコマンドです。
+type containerCommand struct {
+	execCommand
+}
+
+// CPUTime はコンテナのプロセスではなく CLI の CPU 時間しか計測できないため、常に false を返します。
+func (c containerCommand) CPUTime() (time.Duration, bool) {
+	return 0, false
+}
+
+// WithContainer はコマンドをコンテナイメージとして runtime で実行します。
+// options は `run` に追加するオプション（--network=none など）で、イメージ名の前に渡します。
+// runtime が空文字列の場合は何もしません。
+func WithContainer(runtime string, options ...string) Option {
+	return func(e *Executor) {
+		if runtime != "" {
+			e.container = &containerConfig{cli: containerCLIs[runtime], options: options}
+		}
+	}
+}
+
+// containerConfig はコンテナでの実行設定です。
+type containerConfig struct {
+	cli     string
+	options []string
+}
+
+// containerArgs はコマンドのイメージを stdin を開いたまま使い捨てのコンテナで実行する `run` の引数を返します。
+// 環境変数は値を引数に含めず CLI の環境変数として渡し、--env NAME でコンテナに引き継ぎます。
+func (e *Executor) containerArgs() []string {
+	env := e.envSlice()
+	names := make([]string, 0, len(env))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	args := []string{"run", "--rm", "-i"}
+	for _, name := range names {
+		args = append(args, "--env", name)
+	}
+	if e.workspaceDir != "" {
+		args = append(args, "--volume", e.workspaceDir+":"+e.workspaceDir)
+	}
+	args = append(args, e.container.options...)
+	args = append(args, e.command)
+	return append(args, e.args...)
+}
+
+// interrupt は CLI に割り込みシグナルを送ります。
+// CLI を強制終了するとコンテナが残るため、まずシグナルをコンテナに転送させて終了を促します。
+func interrupt(cmd *exec.Cmd) func() error {
+	return func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+}
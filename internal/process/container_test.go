@@ -0,0 +1,85 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeContainerCLI は受け取った引数と TOKEN 環境変数を JSON-RPC のレスポンスとして返す CLI を PATH に置きます。
+func fakeContainerCLI(t *testing.T, name string) {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\nread line\nprintf '{\"jsonrpc\":\"2.0\",\"id\":1,\"result\":{\"args\":\"%s\",\"token\":\"%s\"}}\\n' \"$*\" \"$TOKEN\"\n"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestExecutor_Container(t *testing.T) {
+	tests := []struct {
+		name    string
+		runtime string
+		cli     string
+	}{
+		{name: "Podman_podmanで実行", runtime: RuntimePodman, cli: "podman"},
+		{name: "containerd_nerdctlで実行", runtime: RuntimeContainerd, cli: "nerdctl"},
+		{name: "Docker_dockerで実行", runtime: RuntimeDocker, cli: "docker"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeContainerCLI(t, tt.cli)
+			e := NewExecutor("example/server:1", []string{"--flag"}, map[string]string{"TOKEN": "secret"}, slog.Default(),
+				WithContainer(tt.runtime, "--network=none"))
+
+			response, err := e.Execute(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			var got struct {
+				Result struct {
+					Args  string `json:"args"`
+					Token string `json:"token"`
+				} `json:"result"`
+			}
+			if err := json.Unmarshal(response, &got); err != nil {
+				t.Fatalf("response %s: %v", response, err)
+			}
+			// 環境変数の値は引数に含めず、CLI の環境変数として渡す
+			if want := "run --rm -i --env TOKEN --network=none example/server:1 --flag"; got.Result.Args != want {
+				t.Errorf("args = %q, want %q", got.Result.Args, want)
+			}
+			if got.Result.Token != "secret" {
+				t.Errorf("TOKEN = %q, want %q", got.Result.Token, "secret")
+			}
+		})
+	}
+}
+
+func TestValidateRuntime(t *testing.T) {
+	tests := []struct {
+		name    string
+		runtime string
+		wantErr bool
+	}{
+		{name: "空文字列_ホストのプロセス", runtime: ""},
+		{name: "podman_有効", runtime: RuntimePodman},
+		{name: "containerd_有効", runtime: RuntimeContainerd},
+		{name: "docker_有効", runtime: RuntimeDocker},
+		{name: "firecracker_有効", runtime: RuntimeFirecracker},
+		{name: "未対応のランタイム_エラー", runtime: "lxc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateRuntime(tt.runtime); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRuntime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package process
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks は /proc/<pid>/stat の CPU 時間の単位（USER_HZ）です。Linux では全てのアーキテクチャで 100 です。
+const clockTicks = 100
+
+// procCPUTime は /proc/<pid>/stat から、プロセスと終了を待ち終えた子プロセスが使った CPU 時間（ユーザーとシステムの合計）を返します。
+// /proc のない OS や、既に終了を待ち終えたプロセスでは false を返します。
+func procCPUTime(pid int) (time.Duration, bool) {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return 0, false
+	}
+	// コマンド名は空白や括弧を含むことがあるため、最後の ')' より後ろを解析する
+	i := strings.LastIndexByte(string(data), ')')
+	if i < 0 {
+		return 0, false
+	}
+	// ')' の後は3番目の state から始まり、utime・stime・cutime・cstime は14〜17番目
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 15 {
+		return 0, false
+	}
+	var ticks int64
+	for _, field := range fields[11:15] {
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		ticks += n
+	}
+	return time.Duration(ticks) * time.Second / clockTicks, true
+}
+
+// CPUTime はセッションで実行中のプロセスが使った CPU 時間を返します。
+// ホストで直接実行するプロセス（Linux のみ）と microVM で計測でき、コンテナと WASI のモジュールでは false を返します。
+// シークレットの入れ替えでプロセスを切り替えた場合は、新しいプロセスの CPU 時間です。
+func (s *Session) CPUTime() (time.Duration, bool) {
+	s.writeMu.Lock()
+	p := s.current
+	s.writeMu.Unlock()
+	if p == nil {
+		return 0, false
+	}
+	return p.cmd.CPUTime()
+}
@@ -0,0 +1,53 @@
+package process
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestProcCPUTime(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("/proc is only available on Linux")
+	}
+	if _, ok := procCPUTime(os.Getpid()); !ok {
+		t.Error("procCPUTime(self) ok = false")
+	}
+	if _, ok := procCPUTime(-1); ok {
+		t.Error("procCPUTime(-1) ok = true")
+	}
+}
+
+func TestSession_CPUTime_使った分だけ増える(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("/proc is only available on Linux")
+	}
+	// CPU を使い続けてから stdin を読み続ける
+	executor := NewExecutor("sh", []string{"-c", "i=0; while [ $i -lt 300000 ]; do i=$((i+1)); done; cat"}, map[string]string{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	session, err := executor.Start(ctx)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() { _ = session.Close() }()
+
+	for {
+		used, ok := session.CPUTime()
+		if !ok {
+			t.Fatal("CPUTime() ok = false")
+		}
+		if used > 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("CPUTime() did not increase")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package process
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// diagnosticsStderrLines は診断情報に含める stderr の末尾の最大行数です。
+const diagnosticsStderrLines = 20
+
+// Diagnostics は初期化に失敗したセッションのプロセスを調べるための情報です。
+// 環境変数は値を含めず名前だけを持ちます。
+type Diagnostics struct {
+	Command     string        // 起動したコマンド
+	StartedAt   time.Time     // プロセスを起動した時刻
+	Elapsed     time.Duration // 起動から診断情報を取得するまでの時間
+	StdoutBytes int64         // stdout から受け取ったバイト数
+	StderrTail  []string      // stderr の最後の行（最大 diagnosticsStderrLines 行）
+	EnvKeys     []string      // プロセスに設定した環境変数の名前（ソート済み）
+	Exited      bool          // プロセスが既に終了しているか
+	ExitError   string        // プロセスの終了の原因（終了していないか正常終了の場合は空文字列）
+}
+
+// Diagnostics は現在のプロセスの診断情報を返します。
+func (s *Session) Diagnostics() Diagnostics {
+	d := Diagnostics{
+		Command:     s.command,
+		StartedAt:   s.startedAt,
+		Elapsed:     time.Since(s.startedAt),
+		StdoutBytes: s.stdoutBytes.Load(),
+		StderrTail:  lastLines(s.Stderr(), diagnosticsStderrLines),
+		EnvKeys:     s.envKeys,
+	}
+	select {
+	case <-s.exited:
+		d.Exited = true
+		if s.waitErr != nil {
+			d.ExitError = s.waitErr.Error()
+		}
+	default:
+	}
+	return d
+}
+
+// Diagnostics はプロセスを起動する前から分かる診断情報（コマンドと環境変数の名前）を返します。
+// プロセスを起動できなかった場合に使います。
+func (e *Executor) Diagnostics() Diagnostics {
+	return Diagnostics{Command: e.command, EnvKeys: e.envKeys()}
+}
+
+// envKeys は envSlice で設定する環境変数の名前をソートして返します。
+func (e *Executor) envKeys() []string {
+	env := e.envSlice()
+	keys := make([]string, 0, len(env))
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// lastLines は s の空行を除いた最後の n 行を返します。
+func lastLines(s string, n int) []string {
+	var lines []string
+	for line := range strings.SplitSeq(s, "\n") {
+		if line = strings.TrimRight(line, "\r"); strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// countingWriter は書き込んだバイト数を数える io.Writer です。
+type countingWriter struct {
+	w     io.Writer
+	count *atomic.Int64
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.count.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,34 @@
+package process
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLastLines(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		n    int
+		want []string
+	}{
+		{name: "空文字列_なし", s: "", n: 3, want: nil},
+		{name: "空行とCRLF_除いて返す", s: "a\r\n\n  \nb\n", n: 3, want: []string{"a", "b"}},
+		{name: "上限を超える_末尾のみ", s: "a\nb\nc\nd", n: 2, want: []string{"c", "d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lastLines(tt.s, tt.n); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lastLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecutor_DiagnosticsEnvKeys(t *testing.T) {
+	executor := NewExecutor("server", nil, map[string]string{"B": "secret", "A": "1"}, nil, WithCompression(CompressionGzip))
+	got := executor.Diagnostics()
+	if got.Command != "server" || !reflect.DeepEqual(got.EnvKeys, []string{"A", "B", CompressionEnv}) {
+		t.Errorf("Diagnostics() = %+v, want sorted env keys without values", got)
+	}
+}
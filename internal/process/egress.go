@@ -0,0 +1,53 @@
+package process
+
+import (
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/egress"
+)
+
+// egressProxyEnv はプロセスに接続先を制限するプロキシを設定する環境変数です。
+// 実装によって大文字・小文字のどちらを読むかが異なるため両方を設定します。
+var egressProxyEnv = []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "http_proxy", "https_proxy", "all_proxy"}
+
+// WithEgressProxy はプロセスの外部への接続を proxyURL のプロキシ経由にします。
+// 許可しないホストへの接続をプロキシが拒否できるよう、NO_PROXY は空にしてプロキシを迂回させません。
+// プロセスはプロキシの Unix ソケット socket にしか接続できないネットワーク名前空間で実行するため、
+// プロキシの設定を無視した接続もできません。proxyURL が空文字列の場合は何もしません。
+func WithEgressProxy(proxyURL, socket string) Option {
+	return func(e *Executor) {
+		e.egressProxy = proxyURL
+		e.egressSocket = socket
+	}
+}
+
+// sandbox は cmd をプロキシにしか接続できないネットワーク名前空間で実行するよう書き換えます。
+func (e *Executor) sandbox(cmd *exec.Cmd) error {
+	if e.egressProxy == "" {
+		return nil
+	}
+	if err := egress.Sandbox(cmd, e.egressSocket); err != nil {
+		return fmt.Errorf("egress proxy: %w", err)
+	}
+	return nil
+}
+
+// isProxyEnv は name がプロキシの設定に使われる環境変数かを返します。
+func isProxyEnv(name string) bool {
+	return slices.Contains(egressProxyEnv, name) || strings.EqualFold(name, "NO_PROXY")
+}
+
+// egressEnv は egressProxy を設定する環境変数を返します。
+func (e *Executor) egressEnv() []string {
+	if e.egressProxy == "" {
+		return nil
+	}
+	env := make([]string, 0, len(egressProxyEnv)+2)
+	for _, name := range egressProxyEnv {
+		env = append(env, name+"="+e.egressProxy)
+	}
+	return append(env, "NO_PROXY=", "no_proxy=")
+}
@@ -5,113 +5,398 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os/exec"
-	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/secrets"
 )
 
+// WaitDelay はプロセス終了後に stdio パイプのクローズを待つ最大時間です。
+const WaitDelay = 2 * time.Second
+
+// DefaultMaxMessageSize は stdout から読み取る1メッセージの最大サイズのデフォルト値です。
+// base64 エンコードされた画像やファイルを含むレスポンスを扱えるよう大きめに設定しています。
+const DefaultMaxMessageSize = 64 * 1024 * 1024
+
+// initialScanBuffer は stdout 読み取りバッファの初期サイズです。
+const initialScanBuffer = 64 * 1024
+
 // Executor は stdio ベースの MCP サーバープロセスを実行します。
 type Executor struct {
 	command string
 	args    []string
 	env     map[string]string
 	logger  *slog.Logger
+	tracer  *tracer
+
+	maxMessageSize int
+	compression    string
+	wasi           *WASIRuntime
+	container      *containerConfig
+	microVM        *MicroVMConfig
+	workspace      *WorkspaceConfig
+	workspaceDir   string // 作成した作業ディレクトリ（コンテナと WASI モジュールに公開する）
+	secrets        *secrets.Manager
+	rotation       string // 起動し続けるプロセスのシークレットの期限が近づいた時の扱い
+	egressProxy    string // 外部への接続を制限するプロキシの URL（空文字列で制限しない）
+	egressSocket   string // 外部への接続を制限するプロキシの Unix ソケットのパス
+
+	framing      string        // stdin に書き込むメッセージの区切り方（空文字列で FramingNewline）
+	framingCache *FramingCache // FramingAuto で判定した区切り方のキャッシュ
+	framingKey   string        // framingCache でサーバーを識別するキー
+
+	label string // Cache.DrainLabel でまとめて終了させるためのラベル（空文字列でラベルなし）
+
+	processGroup bool      // プロセスグループで起動し、終了時に子孫のプロセスもまとめて終了させる
+	launcher     *Launcher // npx・uvx などのランチャーの設定（nil でランチャーではない）
+}
+
+// command は起動する MCP サーバーです。OS のプロセスと WASI モジュールを同じように扱います。
+type command interface {
+	StdinPipe() (io.WriteCloser, error)
+	StdoutPipe() (io.ReadCloser, error)
+	SetStdout(w io.Writer)
+	SetStderr(w io.Writer)
+	Start() error
+	Wait() error
+	Terminate() error
+	Kill() error
+	CPUTime() (time.Duration, bool) // 実行中のプロセスが使った CPU 時間（計測できない場合は false）
+}
+
+// execCommand は OS のプロセスを command として実行します。
+type execCommand struct {
+	*exec.Cmd
+}
+
+func (c execCommand) SetStdout(w io.Writer) { c.Stdout = w }
+
+func (c execCommand) SetStderr(w io.Writer) { c.Stderr = w }
+
+func (c execCommand) Terminate() error { return c.Process.Signal(syscall.SIGTERM) }
+
+func (c execCommand) Kill() error { return c.Process.Kill() }
+
+// groupCommand はプロセスグループで起動した OS のプロセスです。
+// npx・uvx などのランチャーは MCP サーバーを子孫のプロセスとして起動するため、シグナルをグループ全体に送り、
+// ランチャーの終了後に残った子孫のプロセスも終了させます。
+type groupCommand struct {
+	execCommand
+}
+
+func (c groupCommand) Terminate() error { return signalGroup(c.Process, syscall.SIGTERM) }
+
+func (c groupCommand) Kill() error { return signalGroup(c.Process, syscall.SIGKILL) }
+
+func (c groupCommand) Wait() error {
+	err := c.Cmd.Wait()
+	_ = signalGroup(c.Process, syscall.SIGKILL)
+	return err
+}
+
+func (c execCommand) CPUTime() (time.Duration, bool) {
+	if c.Process == nil {
+		return 0, false
+	}
+	return procCPUTime(c.Process.Pid)
+}
+
+// Option は Executor の追加設定です。
+type Option func(*Executor)
+
+// WithTrace は stdin/stdout/stderr のフレームトレースを有効にします。
+func WithTrace(cfg TraceConfig) Option {
+	return func(e *Executor) {
+		e.tracer = newTracer(cfg, e.logger, e.env)
+	}
+}
+
+// WithMaxMessageSize は stdout から読み取る1メッセージの最大サイズを設定します。
+// 0 以下の場合は DefaultMaxMessageSize を使用します。
+func WithMaxMessageSize(size int) Option {
+	return func(e *Executor) {
+		if size > 0 {
+			e.maxMessageSize = size
+		}
+	}
+}
+
+// WithProcessGroup はプロセスを新しいプロセスグループで起動し、終了・強制終了・キャンセルを子孫のプロセスにも適用します。
+// プロセスグループのない OS では何もしません。コンテナ・WASI・microVM では使いません。
+func WithProcessGroup() Option {
+	return func(e *Executor) {
+		e.processGroup = true
+	}
+}
+
+// WithLauncher は npx・uvx などのランチャーで起動するプロセスに、ランチャーの環境変数を設定してプロセスグループで起動します。
+// 環境変数はヘッダーなどで指定した値を上書きしません。
+func WithLauncher(l *Launcher) Option {
+	return func(e *Executor) {
+		e.launcher = l
+		e.processGroup = true
+	}
+}
+
+// WithLabel はプロセスのまとまり（バックエンドのバージョンなど）を表すラベルを設定します。
+// Cache.DrainLabel で同じラベルの Executor のプロセスだけを終了させるために使います。
+func WithLabel(label string) Option {
+	return func(e *Executor) {
+		e.label = label
+	}
 }
 
 // NewExecutor は指定されたコマンド、引数、環境変数、ロガーで新しい Executor を作成します。
-func NewExecutor(command string, args []string, env map[string]string, logger *slog.Logger) *Executor {
-	return &Executor{
+func NewExecutor(command string, args []string, env map[string]string, logger *slog.Logger, opts ...Option) *Executor {
+	e := &Executor{
 		command: command,
 		args:    args,
 		env:     env,
 		logger:  logger,
+
+		maxMessageSize: DefaultMaxMessageSize,
+	}
+	for _, opt := range opts {
+		opt(e)
 	}
+	return e
 }
 
 // Execute は指定された入力で stdio プロセスを実行し、レスポンスを返します。
+// 入力がリクエストの場合、レスポンスより前に出力された通知（ログや進捗）は読み飛ばします。
 func (e *Executor) Execute(ctx context.Context, input []byte) ([]byte, error) {
-	// 1. コマンド準備
-	cmd := exec.CommandContext(ctx, e.command, e.args...)
+	skipNotifications := false
+	if msg, err := jsonrpc.Parse(input); err == nil && msg.IsRequest() {
+		skipNotifications = true
+	}
 
-	// 2. 環境変数設定
-	cmd.Env = append(cmd.Environ(), e.envSlice()...)
+	var response []byte
+	err := e.run(ctx, input, e.framingFor(ctx), func(scanner *messageScanner) error {
+		for scanner.Scan() {
+			if partial := scanner.partial(scanner.Bytes()); partial != nil {
+				return partial
+			}
+			msg, err := e.decodeMessage(scanner.Bytes())
+			if err != nil {
+				return err
+			}
+			if skipNotifications {
+				if parsed, err := jsonrpc.Parse(msg); err == nil && parsed.IsNotification() {
+					continue
+				}
+			}
+			response = msg
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Stream は指定された入力で stdio プロセスを実行し、stdout に出力された
+// JSON-RPC メッセージ（通知を含む）を1件ずつ emit に渡します。
+// 入力がリクエストの場合は同じ ID のレスポンスを受け取った時点で、
+// それ以外の場合は stdout が閉じられた時点で終了します。
+func (e *Executor) Stream(ctx context.Context, input []byte, emit func(msg []byte) error) error {
+	var reqID json.RawMessage
+	if msg, err := jsonrpc.Parse(input); err == nil && msg.HasID() {
+		reqID = msg.ID
+	}
+
+	return e.run(ctx, input, e.framingFor(ctx), func(scanner *messageScanner) error {
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			if partial := scanner.partial(line); partial != nil {
+				return partial
+			}
+			line, err := e.decodeMessage(line)
+			if err != nil {
+				return err
+			}
+			if err := emit(line); err != nil {
+				return err
+			}
+			if reqID == nil {
+				continue
+			}
+			if msg, err := jsonrpc.Parse(line); err == nil && msg.IsResponse() && jsonrpc.SameID(msg.ID, reqID) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
 
-	// 3. stdin/stdout パイプ
+// run はプロセスを起動して input を framing で区切って stdin に書き込み、read で stdout を読み取った後に終了を待ちます。
+// read が PartialMessageError を返した場合は、プロセスを終了させてから stderr の内容を設定します。
+func (e *Executor) run(ctx context.Context, input []byte, framing string, read func(scanner *messageScanner) error) error {
+	// 1. コマンド準備（環境変数を含む）
+	cmd, err := e.newCommand(ctx)
+	if err != nil {
+		return err
+	}
+
+	// 2. stdin/stdout パイプ
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
-		return nil, fmt.Errorf("stdin pipe: %w", err)
+		return fmt.Errorf("stdin pipe: %w", err)
 	}
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return nil, fmt.Errorf("stdout pipe: %w", err)
+		return fmt.Errorf("stdout pipe: %w", err)
+	}
+
+	// stderr は exec パッケージのコピー goroutine 経由でバッファに書き込む。
+	// Wait がコピー完了を待つため、読み取り前にパイプが閉じられて出力が欠けることがない。
+	var stderrBuf bytes.Buffer
+	var stderr io.Writer = &stderrBuf
+
+	// トレース有効時はフレーム単位でログ出力するラッパーを挟む
+	if e.tracer != nil {
+		stdin = e.tracer.writer("stdin", stdin)
+		stdout = e.tracer.reader("stdout", stdout)
+		stderr = e.tracer.writer("stderr", stderr)
 	}
 
-	stderr, err := cmd.StderrPipe()
+	cmd.SetStderr(stderr)
+
+	input, err = e.encodeMessage(input)
 	if err != nil {
-		return nil, fmt.Errorf("stderr pipe: %w", err)
+		return err
 	}
 
-	// 4. プロセス起動
+	// 3. プロセス起動
 	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("process start: %w", err)
+		return fmt.Errorf("process start: %w", err)
 	}
 
-	// 5. stderr を非同期で読み取り
-	var stderrBuf bytes.Buffer
-	var stderrWg sync.WaitGroup
-	stderrWg.Add(1)
-	go func() {
-		defer stderrWg.Done()
-		if _, err := io.Copy(&stderrBuf, stderr); err != nil && e.logger != nil {
-			e.logger.Debug("Failed to copy stderr", "error", err)
-		}
-	}()
-
-	// 6. stdin に JSON-RPC メッセージ送信
-	if _, err := stdin.Write(input); err != nil {
-		return nil, fmt.Errorf("write to stdin: %w", err)
+	// 起動後にエラーで中断する場合もプロセスを終了させて回収する
+	abort := func(err error) error {
+		_ = cmd.Kill()
+		_ = cmd.Wait()
+		return err
 	}
-	if _, err := stdin.Write([]byte("\n")); err != nil {
-		return nil, fmt.Errorf("write newline to stdin: %w", err)
+
+	// 4. stdin に JSON-RPC メッセージ送信
+	if _, err := stdin.Write(frameMessage(input, framing)); err != nil {
+		return abort(fmt.Errorf("write to stdin: %w", err))
 	}
 	if err := stdin.Close(); err != nil && e.logger != nil {
 		e.logger.Debug("Failed to close stdin", "error", err)
 	}
 
-	// 7. stdout から JSON-RPC レスポンス読み取り
-	var response []byte
-	scanner := bufio.NewScanner(stdout)
-	if scanner.Scan() {
-		response = scanner.Bytes()
+	// 5. stdout から JSON-RPC メッセージ読み取り
+	scanner := e.newScanner(stdout)
+	if err := read(scanner); err != nil {
+		err = abort(err)
+		var partial *PartialMessageError
+		if errors.As(err, &partial) {
+			partial.Stderr = stderrBuf.String()
+		}
+		return err
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("read from stdout: %w", err)
+		return abort(e.readError(err))
 	}
 
-	// 8. プロセス終了待機
+	// 6. プロセス終了待機（stderr のコピー完了も待つ）
 	waitErr := cmd.Wait()
 
-	// 9. stderrの読み取り完了を待つ
-	stderrWg.Wait()
-
 	if waitErr != nil {
 		if e.logger != nil {
 			e.logger.Error("Process failed", "stderr", stderrBuf.String())
 		}
-		return nil, fmt.Errorf("process wait: %w", waitErr)
+		return fmt.Errorf("process wait: %w", waitErr)
 	}
 
-	return response, nil
+	return nil
+}
+
+// newCommand はコマンドと環境変数を設定した command を作成します。
+// microVM が設定されている場合は microVM 内のコマンドとして、コンテナランタイムが設定されている場合は
+// コマンドをイメージ名として、WASI ランタイムが設定されている場合は WASI モジュールのパスとして扱います。
+// 動的シークレットを設定している場合はシークレットを発行してから、
+// 作業ディレクトリを設定している場合は作業ディレクトリを作成してからコマンドを作成します。
+func (e *Executor) newCommand(ctx context.Context) (command, error) {
+	// セッションがリースの期限を監視できるよう、シークレットを最も外側の command にする
+	if e.secrets != nil {
+		return e.newSecretsCommand(ctx)
+	}
+	if e.workspace != nil {
+		return e.newWorkspaceCommand(ctx)
+	}
+	if e.microVM != nil {
+		return e.newMicroVMCommand(ctx), nil
+	}
+	if e.container == nil && e.wasi != nil {
+		return e.wasi.command(ctx, e.command, e.args, e.envSlice(), e.workspaceDir), nil
+	}
+	name, args := e.command, e.args
+	if e.container != nil {
+		name, args = e.container.cli, e.containerArgs()
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(cmd.Environ(), e.envSlice()...)
+	if e.container != nil {
+		cmd.Cancel = interrupt(cmd)
+	}
+	// 孫プロセスが stdio を保持し続けても Wait がブロックし続けないようにする
+	cmd.WaitDelay = WaitDelay
+	if e.container != nil {
+		return containerCommand{execCommand{cmd}}, nil
+	}
+	if e.processGroup {
+		setProcessGroup(cmd)
+	}
+	if err := e.sandbox(cmd); err != nil {
+		return nil, err
+	}
+	if e.processGroup {
+		return groupCommand{execCommand{cmd}}, nil
+	}
+	return execCommand{cmd}, nil
+}
+
+// readError は stdout 読み取りエラーを原因が分かるエラーに変換します。
+func (e *Executor) readError(err error) error {
+	if errors.Is(err, bufio.ErrTooLong) {
+		return fmt.Errorf("read from stdout: message exceeds max size of %d bytes: %w", e.maxMessageSize, err)
+	}
+	return fmt.Errorf("read from stdout: %w", err)
 }
 
 func (e *Executor) envSlice() []string {
-	env := make([]string, 0, len(e.env))
+	env := make([]string, 0, len(e.env)+1)
+	if e.launcher != nil {
+		// 後に追加した同名の環境変数が優先されるため、設定した値を上書きしない
+		for k, v := range e.launcher.Env {
+			env = append(env, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
 	for k, v := range e.env {
+		// ヘッダー由来の値で接続先を制限するプロキシを迂回させない
+		if e.egressProxy != "" && isProxyEnv(k) {
+			continue
+		}
 		env = append(env, fmt.Sprintf("%s=%s", k, v))
 	}
-	return env
+	if e.compression != "" {
+		env = append(env, fmt.Sprintf("%s=%s", CompressionEnv, e.compression))
+	}
+	return append(env, e.egressEnv()...)
 }
@@ -2,8 +2,10 @@ package process
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -61,6 +63,19 @@ func TestExecutor_Execute(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:        "レスポンス前の通知_読み飛ばす",
+			command:     "sh",
+			args:        []string{"-c", `read line; echo '{"jsonrpc":"2.0","method":"notifications/message"}'; echo '{"jsonrpc":"2.0","id":1,"result":{}}'`},
+			env:         map[string]string{},
+			input:       []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call"}`),
+			expectError: false,
+			validate: func(t *testing.T, output []byte) {
+				if string(output) != `{"jsonrpc":"2.0","id":1,"result":{}}` {
+					t.Errorf("Output should be the response: got %s", output)
+				}
+			},
+		},
 		{
 			name:        "存在しないコマンド",
 			command:     "nonexistent-command-12345",
@@ -211,3 +226,111 @@ func TestNewExecutor(t *testing.T) {
 		t.Error("logger not properly set")
 	}
 }
+
+func TestExecutor_Stream(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		input    string
+		expected []string
+	}{
+		{
+			name:     "通知とレスポンス_両方が順に渡される",
+			script:   `read line; echo '{"jsonrpc":"2.0","method":"notifications/message"}'; echo '{"jsonrpc":"2.0","id":1,"result":{}}'`,
+			input:    `{"jsonrpc":"2.0","id":1,"method":"tools/call"}`,
+			expected: []string{`{"jsonrpc":"2.0","method":"notifications/message"}`, `{"jsonrpc":"2.0","id":1,"result":{}}`},
+		},
+		{
+			name:     "レスポンス後の出力_読み取られない",
+			script:   `read line; echo '{"jsonrpc":"2.0","id":"a","result":{}}'; echo '{"jsonrpc":"2.0","method":"late"}'`,
+			input:    `{"jsonrpc":"2.0","id":"a","method":"ping"}`,
+			expected: []string{`{"jsonrpc":"2.0","id":"a","result":{}}`},
+		},
+		{
+			name:     "異なるIDのレスポンスと空行_スキップせず最後まで読み取る",
+			script:   `read line; echo '{"jsonrpc":"2.0","id":2,"result":{}}'; echo; echo '{"jsonrpc":"2.0","id":1,"result":{}}'`,
+			input:    `{"jsonrpc":"2.0","id":1,"method":"ping"}`,
+			expected: []string{`{"jsonrpc":"2.0","id":2,"result":{}}`, `{"jsonrpc":"2.0","id":1,"result":{}}`},
+		},
+		{
+			name:     "通知の入力_EOFまで全て読み取る",
+			script:   `read line; echo one; echo two`,
+			input:    `{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+			expected: []string{"one", "two"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := NewExecutor("sh", []string{"-c", tt.script}, map[string]string{}, nil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			var got []string
+			err := executor.Stream(ctx, []byte(tt.input), func(msg []byte) error {
+				got = append(got, string(msg))
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Stream() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Stream() messages = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExecutor_Stream_EmitError(t *testing.T) {
+	executor := NewExecutor("sh", []string{"-c", "read line; echo one; sleep 10"}, map[string]string{}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	wantErr := errors.New("client gone")
+	start := time.Now()
+	err := executor.Stream(ctx, []byte(`{}`), func([]byte) error { return wantErr })
+	if !errors.Is(err, wantErr) {
+		t.Errorf("Stream() error = %v, want %v", err, wantErr)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second+WaitDelay {
+		t.Errorf("Stream() should abort the process quickly, took %v", elapsed)
+	}
+}
+
+func TestExecutor_MaxMessageSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		wantError bool
+	}{
+		{name: "上限を超えるメッセージ_エラーを返す", size: 16, wantError: true},
+		{name: "上限以内のメッセージ_読み取れる", size: 1024, wantError: false},
+		{name: "0以下の上限_デフォルトが使われる", size: 0, wantError: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := NewExecutor("sh", []string{"-c", "read line; printf '%0100d\\n' 0"},
+				map[string]string{}, nil, WithMaxMessageSize(tt.size))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			output, err := executor.Execute(ctx, []byte("{}"))
+			if tt.wantError {
+				if err == nil || !strings.Contains(err.Error(), "exceeds max size") {
+					t.Errorf("Execute() error = %v, want max size error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() unexpected error: %v", err)
+			}
+			if len(output) != 100 {
+				t.Errorf("output length = %d, want 100", len(output))
+			}
+		})
+	}
+}
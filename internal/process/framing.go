@@ -0,0 +1,229 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+)
+
+// stdio で送受信するメッセージの区切り方です。
+const (
+	FramingNewline       = "newline"        // 1行に1メッセージ（MCP の stdio トランスポート）
+	FramingContentLength = "content-length" // LSP と同じ Content-Length ヘッダーを付けたメッセージ
+	FramingAuto          = "auto"           // 最初のやり取りの前にサーバーごとに判定し、結果をキャッシュする
+)
+
+// FramingProbeTimeout は区切り方の判定で、1つの区切り方についてサーバーの応答を待つ最大時間です。
+const FramingProbeTimeout = 10 * time.Second
+
+// contentLengthHeader は Content-Length で区切ったメッセージのヘッダー名です。
+const contentLengthHeader = "Content-Length"
+
+// framingProbeID は区切り方の判定で送る initialize の ID です。
+const framingProbeID = "tumiki-framing-probe"
+
+// errProbeResponded は判定のプロセスが応答したため読み取りを打ち切ることを表します。
+var errProbeResponded = errors.New("framing probe responded")
+
+// ValidateFraming は区切り方の名前が対応しているものかを検証します。空文字列は FramingNewline を表します。
+func ValidateFraming(name string) error {
+	switch name {
+	case "", FramingNewline, FramingContentLength, FramingAuto:
+		return nil
+	default:
+		return fmt.Errorf("unsupported stdio framing %q (supported: %s, %s, %s)", name, FramingNewline, FramingContentLength, FramingAuto)
+	}
+}
+
+// FramingCache は FramingAuto で判定したサーバーごとの区切り方を保持します。
+// 同じサーバーの判定は同時に要求されても1回だけ行います。
+type FramingCache struct {
+	mu      sync.Mutex
+	entries map[string]*framingEntry
+}
+
+type framingEntry struct {
+	once    sync.Once
+	framing string
+}
+
+// NewFramingCache は空の FramingCache を作成します。
+func NewFramingCache() *FramingCache {
+	return &FramingCache{entries: make(map[string]*framingEntry)}
+}
+
+// Get は判定済みのサーバーの区切り方を返します。
+func (c *FramingCache) Get(key string) (string, bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+	// 判定中の場合は終わるまで待つ
+	entry.once.Do(func() {})
+	return entry.framing, entry.framing != ""
+}
+
+// resolve は key のサーバーの区切り方を返します。未判定の場合は probe で判定して記録します。
+func (c *FramingCache) resolve(key string, probe func() string) string {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &framingEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+	entry.once.Do(func() { entry.framing = probe() })
+	return entry.framing
+}
+
+// WithFraming は stdin に書き込むメッセージの区切り方を設定します。
+// FramingAuto の場合は key のサーバーの区切り方を cache から取得し、未判定であれば最初のやり取りの前に判定します。
+// FramingNewline 以外では、stdout からは改行区切りと Content-Length の両方を受け付けます。
+func WithFraming(framing string, cache *FramingCache, key string) Option {
+	return func(e *Executor) {
+		e.framing = framing
+		e.framingCache = cache
+		e.framingKey = key
+	}
+}
+
+// framingFor は stdin に書き込むメッセージの区切り方を返します。
+func (e *Executor) framingFor(ctx context.Context) string {
+	switch e.framing {
+	case FramingContentLength:
+		return FramingContentLength
+	case FramingAuto:
+		if e.framingCache == nil {
+			return e.probeFraming(ctx)
+		}
+		return e.framingCache.resolve(e.framingKey, func() string { return e.probeFraming(ctx) })
+	default:
+		return FramingNewline
+	}
+}
+
+// probeFraming は改行区切り、Content-Length の順に判定用のプロセスへ initialize を送り、応答した区切り方を返します。
+// どちらにも応答しない場合は FramingNewline を返します。
+func (e *Executor) probeFraming(ctx context.Context) string {
+	// 最初のリクエストが取り消されても判定の結果は他のリクエストで使うため、取り消しを引き継がない
+	ctx = context.WithoutCancel(ctx)
+	for _, framing := range []string{FramingNewline, FramingContentLength} {
+		if e.probe(ctx, framing) {
+			if e.logger != nil {
+				e.logger.Info("Detected stdio framing", "command", e.command, "framing", framing)
+			}
+			return framing
+		}
+	}
+	if e.logger != nil {
+		e.logger.Warn("Could not detect stdio framing, falling back to newline", "command", e.command)
+	}
+	return FramingNewline
+}
+
+// probe は framing で区切った initialize を新しいプロセスに送り、FramingProbeTimeout 以内に応答があったかどうかを返します。
+func (e *Executor) probe(ctx context.Context, framing string) bool {
+	ctx, cancel := context.WithTimeout(ctx, FramingProbeTimeout)
+	defer cancel()
+
+	request, err := jsonrpc.NewRequest(framingProbeID, "initialize", map[string]any{
+		"protocolVersion": "2025-06-18",
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "tumiki-mcp-http", "version": "0"},
+	})
+	if err != nil {
+		return false
+	}
+	err = e.run(ctx, request, framing, func(scanner *messageScanner) error {
+		for scanner.Scan() {
+			msg, err := e.decodeMessage(bytes.TrimSpace(scanner.Bytes()))
+			if err != nil {
+				continue
+			}
+			if parsed, err := jsonrpc.Parse(msg); err == nil && parsed.IsResponse() {
+				return errProbeResponded
+			}
+		}
+		return nil
+	})
+	return errors.Is(err, errProbeResponded)
+}
+
+// frameMessage は framing に従ってメッセージに区切りを付けます。
+func frameMessage(msg []byte, framing string) []byte {
+	if framing == FramingContentLength {
+		header := fmt.Sprintf("%s: %d\r\n\r\n", contentLengthHeader, len(msg))
+		frame := make([]byte, 0, len(header)+len(msg))
+		frame = append(frame, header...)
+		return append(frame, msg...)
+	}
+	frame := make([]byte, 0, len(msg)+1)
+	frame = append(frame, msg...)
+	return append(frame, '\n')
+}
+
+// splitContentLength は data が Content-Length のヘッダーで始まる場合にメッセージを1つ切り出します。
+// ヘッダーで始まらない場合は ok に false を返します。ヘッダーかどうか判断できない場合や本文が揃っていない場合は、
+// stdout の終わりでなければ続きを待ち、終わりであれば途中までを unterminated として返します。
+func splitContentLength(data []byte, atEOF bool) (advance int, token []byte, ok, unterminated bool, err error) {
+	prefix := []byte(contentLengthHeader[:len("Content-")])
+	if len(data) < len(prefix) {
+		if !bytes.EqualFold(data, prefix[:len(data)]) || atEOF || len(data) == 0 {
+			return 0, nil, false, false, nil
+		}
+		return 0, nil, true, false, nil
+	}
+	if !bytes.EqualFold(data[:len(prefix)], prefix) {
+		return 0, nil, false, false, nil
+	}
+
+	headerEnd, sep := bytes.Index(data, []byte("\r\n\r\n")), 4
+	if i := bytes.Index(data, []byte("\n\n")); i >= 0 && (headerEnd < 0 || i < headerEnd) {
+		headerEnd, sep = i, 2
+	}
+	if headerEnd < 0 {
+		if atEOF {
+			return len(data), data, true, true, nil
+		}
+		return 0, nil, true, false, nil
+	}
+
+	length := -1
+	for line := range bytes.SplitSeq(data[:headerEnd], []byte("\n")) {
+		name, value, found := bytes.Cut(bytes.TrimSpace(line), []byte(":"))
+		if found && bytes.EqualFold(bytes.TrimSpace(name), []byte(contentLengthHeader)) {
+			if length, err = strconv.Atoi(string(bytes.TrimSpace(value))); err != nil || length < 0 {
+				return 0, nil, true, false, fmt.Errorf("invalid %s header %q", contentLengthHeader, value)
+			}
+		}
+	}
+	if length < 0 {
+		return 0, nil, true, false, fmt.Errorf("missing %s header", contentLengthHeader)
+	}
+
+	start := headerEnd + sep
+	if len(data) < start+length {
+		if atEOF {
+			return len(data), data[start:], true, true, nil
+		}
+		return 0, nil, true, false, nil
+	}
+	body := data[start : start+length]
+	// 改行区切りのフロントエンドでもそのまま返せるよう、整形された JSON は1行にする
+	if bytes.ContainsAny(body, "\r\n") {
+		var compacted bytes.Buffer
+		if json.Compact(&compacted, body) == nil {
+			body = compacted.Bytes()
+		}
+	}
+	return start + length, body, true, false, nil
+}
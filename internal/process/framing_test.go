@@ -0,0 +1,119 @@
+package process
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSplitContentLength(t *testing.T) {
+	tests := []struct {
+		name             string
+		data             string
+		atEOF            bool
+		wantOK           bool
+		wantAdvance      int
+		wantToken        string
+		wantUnterminated bool
+		wantErr          bool
+	}{
+		{name: "改行区切り_対象外", data: `{"id":1}` + "\n", wantOK: false},
+		{name: "メッセージ1件_切り出す", data: "Content-Length: 8\r\n\r\n{\"id\":1}Content-Length", wantOK: true, wantAdvance: 29, wantToken: `{"id":1}`},
+		{name: "LFのみの区切り_切り出す", data: "content-length: 8\n\n{\"id\":1}", wantOK: true, wantAdvance: 27, wantToken: `{"id":1}`},
+		{name: "他のヘッダー付き_切り出す", data: "Content-Type: application/json\r\nContent-Length: 8\r\n\r\n{\"id\":1}", wantOK: true, wantAdvance: 61, wantToken: `{"id":1}`},
+		{name: "整形されたJSON_1行にする", data: "Content-Length: 13\r\n\r\n{\n  \"id\": 1\n}", wantOK: true, wantAdvance: 35, wantToken: `{"id":1}`},
+		{name: "ヘッダーの途中_続きを待つ", data: "Cont", wantOK: true},
+		{name: "本文の途中_続きを待つ", data: "Content-Length: 8\r\n\r\n{\"id\"", wantOK: true},
+		{name: "本文の途中で終了_途中まで", data: "Content-Length: 8\r\n\r\n{\"id\"", atEOF: true, wantOK: true, wantAdvance: 26, wantToken: `{"id"`, wantUnterminated: true},
+		{name: "長さが不正_エラー", data: "Content-Length: abc\r\n\r\n{}", wantOK: true, wantErr: true},
+		{name: "長さがない_エラー", data: "Content-Type: application/json\r\n\r\n{}", wantOK: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			advance, token, ok, unterminated, err := splitContentLength([]byte(tt.data), tt.atEOF)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitContentLength() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ok != tt.wantOK || advance != tt.wantAdvance || string(token) != tt.wantToken || unterminated != tt.wantUnterminated {
+				t.Errorf("splitContentLength() = (%d, %q, %v, %v), want (%d, %q, %v, %v)",
+					advance, token, ok, unterminated, tt.wantAdvance, tt.wantToken, tt.wantOK, tt.wantUnterminated)
+			}
+		})
+	}
+}
+
+func TestExecutor_FramingAuto(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{
+			name:   "改行区切りのサーバー_newline",
+			script: `read line; echo '{"jsonrpc":"2.0","id":1,"result":{}}'`,
+			want:   FramingNewline,
+		},
+		{
+			// 改行区切りで送ったメッセージには応答せずに終了する
+			name: "Content-Lengthのサーバー_content-length",
+			script: `read line; case "$line" in Content-Length*)
+  printf 'Content-Length: 36\r\n\r\n{"jsonrpc":"2.0","id":1,"result":{}}' ;;
+esac`,
+			want: FramingContentLength,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewFramingCache()
+			executor := NewExecutor("sh", []string{"-c", tt.script}, nil, slog.Default(), WithFraming(FramingAuto, cache, "server"))
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			got, err := executor.Execute(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if string(got) != `{"jsonrpc":"2.0","id":1,"result":{}}` {
+				t.Errorf("Execute() = %s", got)
+			}
+			if framing, ok := cache.Get("server"); !ok || framing != tt.want {
+				t.Errorf("cached framing = %q, want %q", framing, tt.want)
+			}
+		})
+	}
+}
+
+func TestSession_ContentLength(t *testing.T) {
+	// Content-Length で受け取ったメッセージの本文を Content-Length で送り返す
+	script := `while IFS= read -r line; do
+  len=${line#Content-Length: }; len=${len%?}
+  read -r blank
+  body=$(dd bs=1 count="$len" 2>/dev/null)
+  printf 'Content-Length: %s\r\n\r\n%s' "$len" "$body"
+done`
+	executor := NewExecutor("sh", []string{"-c", script}, nil, slog.Default(), WithFraming(FramingContentLength, nil, ""))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := executor.Start(ctx)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() { _ = session.Close() }()
+
+	for _, msg := range []string{`{"id":1}`, `{"id":2}`} {
+		if err := session.Send([]byte(msg)); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		got, err := session.Receive(ctx)
+		if err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		if string(got) != msg {
+			t.Errorf("Receive() = %s, want %s", got, msg)
+		}
+	}
+}
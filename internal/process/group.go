@@ -0,0 +1,49 @@
+package process
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// liveGoroutines はこのパッケージが起動し、まだ終了していない goroutine の数です。
+var liveGoroutines atomic.Int64
+
+// Goroutines はプロセスの管理のために起動し、まだ終了していない goroutine の数を返します。
+// 起動し続けるセッションやストリーミングで goroutine が漏れていないかの監視に使います。
+func Goroutines() int64 {
+	return liveGoroutines.Load()
+}
+
+// group は関連する goroutine をまとめて起動し、全ての終了を待つための errgroup 相当の型です。
+// 最初に返されたエラーを Wait で返します。ゼロ値で使えます。
+type group struct {
+	wg   sync.WaitGroup
+	once sync.Once
+	err  error
+}
+
+// Go は f を Goroutines の数に含めて新しい goroutine で実行します。
+func (g *group) Go(f func() error) {
+	g.wg.Add(1)
+	spawn(func() {
+		defer g.wg.Done()
+		if err := f(); err != nil {
+			g.once.Do(func() { g.err = err })
+		}
+	})
+}
+
+// Wait は Go で起動した全ての goroutine の終了を待ち、最初に返されたエラーを返します。
+func (g *group) Wait() error {
+	g.wg.Wait()
+	return g.err
+}
+
+// spawn は終了を待つ必要のない f を Goroutines の数に含めて新しい goroutine で実行します。
+func spawn(f func()) {
+	liveGoroutines.Add(1)
+	go func() {
+		defer liveGoroutines.Add(-1)
+		f()
+	}()
+}
@@ -0,0 +1,101 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// goroutineLeakTimeout はテストの終了後に goroutine の終了を待つ最大時間です。
+const goroutineLeakTimeout = 5 * time.Second
+
+// checkGoroutineLeaks は Goroutines が 0 になるまで timeout まで待ち、
+// 残っている場合は全ての goroutine のスタックを含むエラーを返します。
+func checkGoroutineLeaks(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for Goroutines() != 0 {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			n := runtime.Stack(buf, true)
+			return fmt.Errorf("goroutine leak: %d process goroutines still running after tests\n%s", Goroutines(), buf[:n])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestGroup(t *testing.T) {
+	errFirst := errors.New("first")
+	errSecond := errors.New("second")
+
+	tests := []struct {
+		name  string
+		funcs []func(release <-chan struct{}) error
+		want  error
+	}{
+		{
+			name: "全て成功_nil",
+			funcs: []func(<-chan struct{}) error{
+				func(<-chan struct{}) error { return nil },
+				func(<-chan struct{}) error { return nil },
+			},
+			want: nil,
+		},
+		{
+			name: "エラー_最初のエラーを返す",
+			funcs: []func(<-chan struct{}) error{
+				func(<-chan struct{}) error { return errFirst },
+				func(release <-chan struct{}) error { <-release; return errSecond },
+			},
+			want: errFirst,
+		},
+		{
+			name:  "goroutineなし_nil",
+			funcs: nil,
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var g group
+			release := make(chan struct{})
+			for _, f := range tt.funcs {
+				g.Go(func() error { return f(release) })
+			}
+			// 最初のエラーを返す goroutine が先に終わるまで待ってから残りを終わらせる
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+
+			if err := g.Wait(); !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("Wait() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoroutines_TracksSpawned(t *testing.T) {
+	before := Goroutines()
+	release := make(chan struct{})
+	done := make(chan struct{})
+	spawn(func() {
+		<-release
+		close(done)
+	})
+
+	if got := Goroutines(); got != before+1 {
+		t.Errorf("Goroutines() while running = %d, want %d", got, before+1)
+	}
+	close(release)
+	<-done
+
+	deadline := time.Now().Add(time.Second)
+	for Goroutines() != before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := Goroutines(); got != before {
+		t.Errorf("Goroutines() after exit = %d, want %d", got, before)
+	}
+}
@@ -0,0 +1,240 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPrefetchTimeout はランチャーのパッケージの取得を待つデフォルトの最大時間です。
+const DefaultPrefetchTimeout = 5 * time.Minute
+
+// ランチャーの名前です。
+const (
+	LauncherNPX  = "npx"
+	LauncherUVX  = "uvx"
+	LauncherBunx = "bunx"
+	LauncherDeno = "deno"
+)
+
+// Launcher は npx・uvx・bunx・deno のように、パッケージを取得してから MCP サーバーを子孫のプロセスとして起動するコマンドです。
+// ランチャーごとに、サーバーを起動せずにパッケージをランチャーのキャッシュに取得するコマンドと、
+// 起動のたびにレジストリへの問い合わせを減らす環境変数を持ちます。
+type Launcher struct {
+	Name     string            // ランチャーの名前（LauncherNPX など）
+	Package  string            // 起動するパッケージ（"@modelcontextprotocol/server-github"・"mcp-server-fetch"・"jsr:@scope/server" など）
+	Prefetch []string          // パッケージをキャッシュに取得するコマンドと引数（サーバーは起動しない）
+	Env      map[string]string // 起動するプロセスに設定する環境変数
+
+	once        sync.Once
+	prefetchErr error
+}
+
+// launcherProfile はランチャーの引数の解釈の仕方です。
+type launcherProfile struct {
+	valueFlags map[string]bool // 値を次の引数で受け取るオプション
+	env        map[string]string
+	// prefetch はランチャーのオプション（パッケージより前の引数）とパッケージから、パッケージを取得するコマンドと引数を返します
+	prefetch func(command string, flags []string, pkg string) (string, []string)
+}
+
+// denoValueFlags は deno run の値を次の引数で受け取るオプションです。
+var denoValueFlags = map[string]bool{"--config": true, "-c": true, "--import-map": true, "--lock": true, "--cert": true, "--location": true, "--env-file": true}
+
+// launcherProfiles はランチャーのコマンド名ごとの引数の解釈の仕方です。
+var launcherProfiles = map[string]launcherProfile{
+	LauncherNPX: {
+		valueFlags: map[string]bool{"-p": true, "--package": true, "-c": true, "--call": true, "-w": true, "--workspace": true},
+		// 取得済みのパッケージはレジストリに問い合わせずに使う（キャッシュにない場合は取得する）
+		env: map[string]string{"npm_config_prefer_offline": "true", "npm_config_update_notifier": "false", "npm_config_fund": "false"},
+		prefetch: func(command string, flags []string, pkg string) (string, []string) {
+			// npx と同じ場所の npm でパッケージをキャッシュに取得する
+			return siblingCommand(command, "npm"), []string{"cache", "add", pkg}
+		},
+	},
+	LauncherUVX: {
+		valueFlags: map[string]bool{
+			"--from": true, "--with": true, "--with-editable": true, "--with-requirements": true,
+			"--python": true, "-p": true, "--index": true, "--index-url": true, "--extra-index-url": true,
+			"--default-index": true, "--constraints": true, "-c": true, "--overrides": true, "--cache-dir": true,
+		},
+		prefetch: func(command string, flags []string, pkg string) (string, []string) {
+			// 同じオプションでツールの環境を作成してキャッシュし、サーバーの代わりに環境の Python を実行する
+			args := append([]string{}, flags...)
+			if !hasFlag(flags, "--from") {
+				args = append(args, "--from", pkg)
+			}
+			return command, append(args, "python", "-c", "")
+		},
+	},
+	LauncherBunx: {
+		valueFlags: map[string]bool{"-p": true, "--package": true},
+		prefetch: func(command string, flags []string, pkg string) (string, []string) {
+			// パッケージをキャッシュに取得し、サーバーの代わりに bun のバージョンを表示する
+			return command, append(append([]string{}, flags...), "--package", pkg, "bun", "--version")
+		},
+	},
+	LauncherDeno: {
+		valueFlags: denoValueFlags,
+		env:        map[string]string{"DENO_NO_UPDATE_CHECK": "1", "DENO_NO_PROMPT": "1"},
+		prefetch: func(command string, flags []string, pkg string) (string, []string) {
+			// 権限などの実行時のオプションは取得に使わない
+			var args []string
+			for i := 0; i < len(flags); i++ {
+				name, _, _ := strings.Cut(flags[i], "=")
+				switch name {
+				case "--config", "-c", "--import-map", "--lock", "--cert", "--no-lock", "--node-modules-dir", "--vendor":
+					args = append(args, flags[i])
+					if !strings.Contains(flags[i], "=") && denoValueFlags[name] && i+1 < len(flags) {
+						i++
+						args = append(args, flags[i])
+					}
+				}
+			}
+			return command, append(append([]string{"cache"}, args...), pkg)
+		},
+	},
+}
+
+// DetectLauncher はコマンドがランチャーの場合に Launcher を返します。ランチャーでない場合と、パッケージを特定できない場合は nil を返します。
+// コマンド名はパスと Windows の拡張子（.cmd・.exe）を除いて比べます。
+func DetectLauncher(command string, args []string) *Launcher {
+	name := strings.ToLower(filepath.Base(command))
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".cmd"), ".exe")
+	profile, ok := launcherProfiles[name]
+	if !ok {
+		return nil
+	}
+	if name == LauncherDeno {
+		// deno はサブコマンド run（または省略）でパッケージを実行する
+		if len(args) > 0 && args[0] == "run" {
+			args = args[1:]
+		}
+	}
+	flags, pkg := splitLauncherArgs(args, profile.valueFlags)
+	if name == LauncherNPX || name == LauncherBunx {
+		// --package で指定したパッケージはコマンド名より優先する
+		if value, ok := flagValue(flags, "--package", "-p"); ok {
+			pkg = value
+		}
+	}
+	if name == LauncherUVX {
+		if value, ok := flagValue(flags, "--from"); ok {
+			pkg = value
+		}
+	}
+	if pkg == "" {
+		return nil
+	}
+	prefetchCommand, prefetchArgs := profile.prefetch(command, flags, pkg)
+	return &Launcher{
+		Name:     name,
+		Package:  pkg,
+		Prefetch: append([]string{prefetchCommand}, prefetchArgs...),
+		Env:      profile.env,
+	}
+}
+
+// splitLauncherArgs は最初の位置引数（パッケージ）より前のオプションと、パッケージを返します。
+func splitLauncherArgs(args []string, valueFlags map[string]bool) (flags []string, pkg string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			if i+1 < len(args) {
+				return flags, args[i+1]
+			}
+			return flags, ""
+		}
+		if !strings.HasPrefix(arg, "-") {
+			return flags, arg
+		}
+		flags = append(flags, arg)
+		if !strings.Contains(arg, "=") && valueFlags[arg] && i+1 < len(args) {
+			i++
+			flags = append(flags, args[i])
+		}
+	}
+	return flags, ""
+}
+
+// flagValue はオプションの値を返します（"--name value" と "--name=value" の両方）。
+func flagValue(flags []string, names ...string) (string, bool) {
+	for i, flag := range flags {
+		for _, name := range names {
+			if value, ok := strings.CutPrefix(flag, name+"="); ok {
+				return value, true
+			}
+			if flag == name && i+1 < len(flags) {
+				return flags[i+1], true
+			}
+		}
+	}
+	return "", false
+}
+
+// hasFlag はオプションを指定しているかを返します。
+func hasFlag(flags []string, name string) bool {
+	_, ok := flagValue(flags, name)
+	return ok
+}
+
+// siblingCommand は command がパスの場合に同じディレクトリの name を返し、コマンド名だけの場合は name を返します。
+func siblingCommand(command, name string) string {
+	if dir := filepath.Dir(command); dir != "." && strings.ContainsRune(command, filepath.Separator) {
+		return filepath.Join(dir, name)
+	}
+	return name
+}
+
+// PrefetchPackage はサーバーを起動せずにパッケージをランチャーのキャッシュに取得します。
+// 2回目以降の呼び出しは最初の結果を返します。取得のプロセスもプロセスグループで起動し、ctx の終了時は子孫のプロセスもまとめて終了させます。
+func (l *Launcher) PrefetchPackage(ctx context.Context) error {
+	l.once.Do(func() {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, DefaultPrefetchTimeout)
+			defer cancel()
+		}
+		cmd := exec.CommandContext(ctx, l.Prefetch[0], l.Prefetch[1:]...)
+		cmd.Env = cmd.Environ()
+		for k, v := range l.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+		cmd.WaitDelay = WaitDelay
+		setProcessGroup(cmd)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			l.prefetchErr = fmt.Errorf("prefetch %s package %s: %w: %s", l.Name, l.Package, err, strings.Join(lastLines(string(output), 5), "\n"))
+		}
+	})
+	return l.prefetchErr
+}
+
+// Launchers はコマンドと引数の組み合わせごとに Launcher を保持し、パッケージの取得を組み合わせごとに1度だけ行います。
+// 複数の goroutine から同時に使用できます。
+type Launchers struct {
+	mu        sync.Mutex
+	launchers map[string]*Launcher // ランチャーでないコマンドは nil
+}
+
+// NewLaunchers は Launchers を作成します。
+func NewLaunchers() *Launchers {
+	return &Launchers{launchers: make(map[string]*Launcher)}
+}
+
+// Get はコマンドと引数の Launcher を返します。ランチャーでない場合は nil を返します。
+func (ls *Launchers) Get(command string, args []string) *Launcher {
+	key := command + "\x00" + strings.Join(args, "\x00")
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	l, ok := ls.launchers[key]
+	if !ok {
+		l = DetectLauncher(command, args)
+		ls.launchers[key] = l
+	}
+	return l
+}
@@ -0,0 +1,174 @@
+package process
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDetectLauncher(t *testing.T) {
+	tests := []struct {
+		name         string
+		command      string
+		args         []string
+		wantName     string
+		wantPackage  string
+		wantPrefetch []string
+	}{
+		{
+			name:         "npx_パッケージ",
+			command:      "npx",
+			args:         []string{"-y", "@modelcontextprotocol/server-github"},
+			wantName:     LauncherNPX,
+			wantPackage:  "@modelcontextprotocol/server-github",
+			wantPrefetch: []string{"npm", "cache", "add", "@modelcontextprotocol/server-github"},
+		},
+		{
+			name:         "npx_パスのnpmで取得",
+			command:      "/opt/node/bin/npx",
+			args:         []string{"--yes", "--package=@scope/server@1.2.0", "server", "--stdio"},
+			wantName:     LauncherNPX,
+			wantPackage:  "@scope/server@1.2.0",
+			wantPrefetch: []string{"/opt/node/bin/npm", "cache", "add", "@scope/server@1.2.0"},
+		},
+		{
+			name:         "uvx_パッケージ",
+			command:      "uvx",
+			args:         []string{"--python", "3.12", "mcp-server-fetch", "--ignore-robots-txt"},
+			wantName:     LauncherUVX,
+			wantPackage:  "mcp-server-fetch",
+			wantPrefetch: []string{"uvx", "--python", "3.12", "--from", "mcp-server-fetch", "python", "-c", ""},
+		},
+		{
+			name:         "uvx_fromの指定",
+			command:      "uvx",
+			args:         []string{"--from", "git+https://github.com/org/server", "server"},
+			wantName:     LauncherUVX,
+			wantPackage:  "git+https://github.com/org/server",
+			wantPrefetch: []string{"uvx", "--from", "git+https://github.com/org/server", "python", "-c", ""},
+		},
+		{
+			name:         "bunx_Windowsの拡張子",
+			command:      `bunx.exe`,
+			args:         []string{"@scope/server"},
+			wantName:     LauncherBunx,
+			wantPackage:  "@scope/server",
+			wantPrefetch: []string{"bunx.exe", "--package", "@scope/server", "bun", "--version"},
+		},
+		{
+			name:         "deno_取得に使うオプションだけを渡す",
+			command:      "deno",
+			args:         []string{"run", "--allow-net", "--config", "deno.json", "--lock=deno.lock", "jsr:@scope/server", "--port", "1"},
+			wantName:     LauncherDeno,
+			wantPackage:  "jsr:@scope/server",
+			wantPrefetch: []string{"deno", "cache", "--config", "deno.json", "--lock=deno.lock", "jsr:@scope/server"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := DetectLauncher(tt.command, tt.args)
+			if l == nil {
+				t.Fatal("DetectLauncher() = nil, want a launcher")
+			}
+			if l.Name != tt.wantName || l.Package != tt.wantPackage {
+				t.Errorf("DetectLauncher() = %s %s, want %s %s", l.Name, l.Package, tt.wantName, tt.wantPackage)
+			}
+			if !slices.Equal(l.Prefetch, tt.wantPrefetch) {
+				t.Errorf("Prefetch = %q, want %q", l.Prefetch, tt.wantPrefetch)
+			}
+		})
+	}
+}
+
+func TestDetectLauncher_ランチャーでない(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+	}{
+		{name: "ランチャー以外のコマンド_nil", command: "node", args: []string{"server.js"}},
+		{name: "パッケージの指定がない_nil", command: "npx", args: []string{"-y"}},
+		{name: "denoのrun以外のサブコマンド_nil", command: "deno", args: []string{"--version"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if l := DetectLauncher(tt.command, tt.args); l != nil {
+				t.Errorf("DetectLauncher() = %+v, want nil", l)
+			}
+		})
+	}
+}
+
+// writeScript は dir に実行可能なシェルスクリプトを作成します。
+func writeScript(t *testing.T, dir, name, script string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLauncher_PrefetchPackage(t *testing.T) {
+	dir := t.TempDir()
+	record := filepath.Join(dir, "record")
+	// npm は引数とランチャーの環境変数を記録する
+	writeScript(t, dir, "npm", `echo "$* $npm_config_prefer_offline" >> `+record+"\n")
+	npx := filepath.Join(dir, "npx")
+
+	l := NewLaunchers().Get(npx, []string{"-y", "@scope/server"})
+	for range 2 {
+		if err := l.PrefetchPackage(context.Background()); err != nil {
+			t.Fatalf("PrefetchPackage() error = %v", err)
+		}
+	}
+	data, err := os.ReadFile(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2回目の呼び出しでは取得し直さない
+	if got := string(data); got != "cache add @scope/server true\n" {
+		t.Errorf("npm invocations = %q, want a single cache add", got)
+	}
+}
+
+func TestLauncher_PrefetchPackage_Error(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "deno", "echo 'error: JSR package not found' >&2\nexit 1\n")
+
+	l := DetectLauncher(filepath.Join(dir, "deno"), []string{"run", "jsr:@scope/missing"})
+	err := l.PrefetchPackage(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "JSR package not found") {
+		t.Errorf("PrefetchPackage() error = %v, want the launcher output", err)
+	}
+}
+
+func TestLaunchers_Get(t *testing.T) {
+	launchers := NewLaunchers()
+	args := []string{"mcp-server-fetch"}
+	if launchers.Get("uvx", args) != launchers.Get("uvx", args) {
+		t.Error("Get() returned different launchers for the same command")
+	}
+	if launchers.Get("uvx", args) == launchers.Get("uvx", []string{"mcp-server-time"}) {
+		t.Error("Get() returned the same launcher for different packages")
+	}
+	if launchers.Get("python", args) != nil {
+		t.Error("Get() returned a launcher for a non-launcher command")
+	}
+}
+
+func TestExecutor_envSlice_Launcher(t *testing.T) {
+	e := NewExecutor("npx", []string{"@scope/server"}, map[string]string{"npm_config_prefer_offline": "false"}, nil,
+		WithLauncher(DetectLauncher("npx", []string{"@scope/server"})))
+	env := e.envSlice()
+	// 後に指定した値が優先されるため、ヘッダーなどで指定した値が最後に来る
+	if got := slices.Index(env, "npm_config_prefer_offline=false"); got < slices.Index(env, "npm_config_prefer_offline=true") {
+		t.Errorf("envSlice() = %q, want the configured value after the launcher default", env)
+	}
+	if !slices.Contains(env, "npm_config_update_notifier=false") {
+		t.Errorf("envSlice() = %q, want the launcher env", env)
+	}
+}
@@ -0,0 +1,296 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// RuntimeFirecracker はコマンドを Firecracker の microVM 内で実行するランタイムです。
+const RuntimeFirecracker = "firecracker"
+
+// microVM のデフォルトの設定です。
+const (
+	DefaultMicroVMVCPUs     = 1
+	DefaultMicroVMMemoryMiB = 256
+)
+
+// microVMBootArgs はカーネルの起動引数です。シリアルコンソールはゲストのログ（stderr）だけに使い、
+// カーネルのログがコンソールに出力されないようにし、ゲストの終了で VM を停止します。
+const microVMBootArgs = "console=ttyS0 reboot=k panic=1 pci=off quiet loglevel=0"
+
+// vsock の設定です。ゲストの init はホスト（CID 2）の microVMVsockPort に接続し、
+// 最初の1行で実行するコマンドを受け取った後、同じ接続をコマンドの stdin・stdout とします。
+const (
+	microVMGuestCID  = 3
+	microVMVsockPort = 1024
+)
+
+// MicroVMConfig は Firecracker の microVM の設定です。
+// RootFS はコマンドを実行する init を含む事前に作成したイメージで、読み取り専用で共有します。
+type MicroVMConfig struct {
+	Firecracker string // firecracker の実行ファイル（空文字列で PATH から探す）
+	Kernel      string // ゲストのカーネルイメージ（必須）
+	RootFS      string // ゲストのルートファイルシステム（必須）
+	VCPUs       int    // 0 でデフォルト
+	MemoryMiB   int    // 0 でデフォルト
+	BootArgs    string // 追加するカーネルの起動引数
+}
+
+// Validate は必須の項目を検証します。
+func (c *MicroVMConfig) Validate() error {
+	if c.Kernel == "" || c.RootFS == "" {
+		return errors.New("microVM kernel and rootfs are required")
+	}
+	for _, path := range []string{c.Kernel, c.RootFS} {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("microVM: %w", err)
+		}
+	}
+	return nil
+}
+
+// WithMicroVM はコマンドを cfg の Firecracker の microVM 内で実行します。
+// cfg が nil の場合は起動時にエラーになります。
+func WithMicroVM(cfg *MicroVMConfig) Option {
+	return func(e *Executor) {
+		if cfg == nil {
+			cfg = &MicroVMConfig{}
+		}
+		e.microVM = cfg
+	}
+}
+
+// microVMSpec はゲストの init が実行するコマンドです。
+type microVMSpec struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Env     map[string]string `json:"env"`
+}
+
+// microVMSpecLine はゲストに vsock で送る、実行するコマンドの JSON（改行で終わる1行）を返します。
+// 環境変数にはトークンなどを含むため、カーネルの起動引数や設定ファイルには書き込みません。
+func (e *Executor) microVMSpecLine() ([]byte, error) {
+	env := make(map[string]string)
+	for _, kv := range e.envSlice() {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+	spec, err := json.Marshal(microVMSpec{Command: e.command, Args: e.args, Env: env})
+	if err != nil {
+		return nil, err
+	}
+	return append(spec, '\n'), nil
+}
+
+// microVMConfigFile は Firecracker の --config-file の内容を返します。udsPath は vsock のホスト側の Unix ソケットです。
+func (e *Executor) microVMConfigFile(udsPath string) ([]byte, error) {
+	cfg := e.microVM
+	bootArgs := microVMBootArgs
+	if cfg.BootArgs != "" {
+		bootArgs += " " + cfg.BootArgs
+	}
+
+	vcpus, memory := cfg.VCPUs, cfg.MemoryMiB
+	if vcpus <= 0 {
+		vcpus = DefaultMicroVMVCPUs
+	}
+	if memory <= 0 {
+		memory = DefaultMicroVMMemoryMiB
+	}
+	return json.Marshal(map[string]any{
+		"boot-source": map[string]any{
+			"kernel_image_path": cfg.Kernel,
+			"boot_args":         bootArgs,
+		},
+		"drives": []map[string]any{{
+			"drive_id":       "rootfs",
+			"path_on_host":   cfg.RootFS,
+			"is_root_device": true,
+			"is_read_only":   true,
+		}},
+		"machine-config": map[string]any{
+			"vcpu_count":   vcpus,
+			"mem_size_mib": memory,
+		},
+		"vsock": map[string]any{
+			"guest_cid": microVMGuestCID,
+			"uds_path":  udsPath,
+		},
+	})
+}
+
+// microVMCommand は Firecracker を起動し、ゲストからの vsock の接続をコマンドの stdio として中継する command です。
+// Firecracker はゲストがホストのポート P に接続すると、vsock の Unix ソケットのパスに "_P" を付けたソケットに接続します。
+type microVMCommand struct {
+	execCommand
+	dir      string // 設定ファイルと vsock のソケットを置く、本人のみがアクセスできるディレクトリ
+	udsPath  string
+	spec     []byte
+	listener net.Listener
+
+	stdin   io.Reader
+	stdout  io.Writer
+	stdinR  *io.PipeReader // StdinPipe の読み取り側（終了後に閉じて書き込みを失敗させる）
+	stdoutR *io.PipeReader // StdoutPipe の読み取り側
+	stdoutW *io.PipeWriter // StdoutPipe の書き込み側（中継の終了後に閉じて読み取りを終了させる）
+
+	exited  chan struct{} // Firecracker の終了で閉じる
+	relayed chan struct{} // vsock の中継の終了で閉じる
+	err     error
+}
+
+// newMicroVMCommand は設定ファイルを作成し、Firecracker のコマンドを作成します。
+// vsock のソケットに他のユーザーが接続できないよう、本人のみがアクセスできるディレクトリに作成します。
+func (e *Executor) newMicroVMCommand(ctx context.Context) command {
+	firecracker := e.microVM.Firecracker
+	if firecracker == "" {
+		firecracker = RuntimeFirecracker
+	}
+	cmd := exec.CommandContext(ctx, firecracker)
+	cmd.WaitDelay = WaitDelay
+	c := &microVMCommand{execCommand: execCommand{cmd}}
+
+	if err := e.microVM.Validate(); err != nil {
+		cmd.Err = err
+		return c
+	}
+	spec, err := e.microVMSpecLine()
+	if err != nil {
+		cmd.Err = err
+		return c
+	}
+	c.spec = spec
+	dir, err := os.MkdirTemp("", "tumiki-microvm")
+	if err != nil {
+		cmd.Err = err
+		return c
+	}
+	c.dir = dir
+	c.udsPath = filepath.Join(dir, "vsock.sock")
+	config, err := e.microVMConfigFile(c.udsPath)
+	if err != nil {
+		cmd.Err = err
+		return c
+	}
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, config, 0o600); err != nil {
+		cmd.Err = err
+		return c
+	}
+	cmd.Args = append(cmd.Args, "--no-api", "--config-file", path)
+	return c
+}
+
+func (c *microVMCommand) StdinPipe() (io.WriteCloser, error) {
+	pr, pw := io.Pipe()
+	c.stdin, c.stdinR = pr, pr
+	return pw, nil
+}
+
+func (c *microVMCommand) StdoutPipe() (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	c.stdout, c.stdoutR, c.stdoutW = pw, pr, pw
+	return pr, nil
+}
+
+func (c *microVMCommand) SetStdout(w io.Writer) { c.stdout = w }
+
+// SetStderr は Firecracker の出力とシリアルコンソール（ゲストのログと stderr）を w に書き込みます。
+func (c *microVMCommand) SetStderr(w io.Writer) {
+	c.Stdout = w
+	c.Stderr = w
+}
+
+func (c *microVMCommand) Start() error {
+	if c.Cmd.Err != nil {
+		c.cleanup()
+		return c.Cmd.Err
+	}
+	listener, err := net.Listen("unix", c.udsPath+"_"+strconv.Itoa(microVMVsockPort))
+	if err != nil {
+		c.cleanup()
+		return fmt.Errorf("microVM vsock: %w", err)
+	}
+	c.listener = listener
+	if err := c.Cmd.Start(); err != nil {
+		_ = listener.Close()
+		c.cleanup()
+		return err
+	}
+
+	c.exited = make(chan struct{})
+	c.relayed = make(chan struct{})
+	spawn(func() {
+		c.err = c.Cmd.Wait()
+		close(c.exited)
+		// ゲストが接続せずに終了した場合も Accept と stdin への書き込みを終わらせる
+		_ = listener.Close()
+		if c.stdinR != nil {
+			_ = c.stdinR.CloseWithError(io.ErrClosedPipe)
+		}
+	})
+	spawn(func() {
+		defer close(c.relayed)
+		c.relay()
+	})
+	return nil
+}
+
+// relay はゲストからの接続を待ち、実行するコマンドを送った後に接続とコマンドの stdio を中継します。
+func (c *microVMCommand) relay() {
+	defer func() {
+		if c.stdoutW != nil {
+			_ = c.stdoutW.Close()
+		}
+	}()
+	conn, err := c.listener.Accept()
+	if err != nil {
+		return
+	}
+	_ = c.listener.Close()
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.Write(c.spec); err != nil {
+		return
+	}
+	if c.stdin != nil {
+		spawn(func() {
+			_, _ = io.Copy(conn, c.stdin)
+			// stdin を閉じたことをゲストに伝える
+			if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+				_ = cw.CloseWrite()
+			}
+		})
+	}
+	stdout := c.stdout
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	_, _ = io.Copy(stdout, conn)
+}
+
+func (c *microVMCommand) Wait() error {
+	// exec.Cmd と同様に、読み取りを終えた stdout を閉じて中継がブロックし続けないようにする
+	if c.stdoutR != nil {
+		_ = c.stdoutR.CloseWithError(io.ErrClosedPipe)
+	}
+	<-c.exited
+	<-c.relayed
+	c.cleanup()
+	return c.err
+}
+
+func (c *microVMCommand) cleanup() {
+	if c.dir != "" {
+		_ = os.RemoveAll(c.dir)
+	}
+}
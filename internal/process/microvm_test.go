@@ -0,0 +1,191 @@
+package process
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeFirecrackerEnv はテストバイナリをフェイクの firecracker として動かすための環境変数です。
+// 値が "guest" の場合はゲストの init と同じように vsock で接続し、受け取ったコマンドを結果として返します。
+// "crash" の場合はゲストが接続する前に終了します。
+const fakeFirecrackerEnv = "TUMIKI_FAKE_FIRECRACKER"
+
+// runFakeFirecrackerIfRequested は fakeFirecrackerEnv が指定されている場合にフェイクの firecracker として動作し、終了します。
+// 設定ファイルのパスと内容を $CONFIG_OUT に書き込みます。
+func runFakeFirecrackerIfRequested() {
+	mode := os.Getenv(fakeFirecrackerEnv)
+	if mode == "" {
+		return
+	}
+	if err := fakeFirecracker(mode, os.Args[len(os.Args)-1]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func fakeFirecracker(mode, configPath string) error {
+	config, err := os.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(os.Getenv("CONFIG_OUT"), []byte(configPath+"\n"+string(config)), 0o600); err != nil {
+		return err
+	}
+	// シリアルコンソールへのゲストのログ
+	fmt.Println("guest booted")
+	if mode == "crash" {
+		return fmt.Errorf("kernel panic")
+	}
+
+	var cfg struct {
+		Vsock struct {
+			UDSPath string `json:"uds_path"`
+		} `json:"vsock"`
+	}
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return err
+	}
+	conn, err := net.Dial("unix", cfg.Vsock.UDSPath+"_"+strconv.Itoa(microVMVsockPort))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	spec, err := r.ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+	if _, err := r.ReadBytes('\n'); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(conn, `{"jsonrpc":"2.0","id":1,"result":%s}`+"\n", strings.TrimSpace(string(spec)))
+	return err
+}
+
+// newMicroVMConfig はカーネル・ルートファイルシステムのダミーと、フェイクの firecracker を設定した MicroVMConfig を作成します。
+// firecracker が受け取った設定ファイルのパスと内容は返したファイルに書き込まれます。
+func newMicroVMConfig(t *testing.T, mode string) (*MicroVMConfig, string) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &MicroVMConfig{
+		Firecracker: os.Args[0],
+		Kernel:      filepath.Join(dir, "vmlinux"),
+		RootFS:      filepath.Join(dir, "rootfs.ext4"),
+	}
+	for _, path := range []string{cfg.Kernel, cfg.RootFS} {
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := filepath.Join(dir, "config-out")
+	t.Setenv(fakeFirecrackerEnv, mode)
+	t.Setenv("CONFIG_OUT", out)
+	return cfg, out
+}
+
+func TestExecutor_MicroVM(t *testing.T) {
+	cfg, out := newMicroVMConfig(t, "guest")
+	e := NewExecutor("/usr/bin/server", []string{"--stdio"}, map[string]string{"TOKEN": "secret"}, slog.Default(), WithMicroVM(cfg))
+
+	response, err := e.Execute(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	var got struct {
+		Result microVMSpec `json:"result"`
+	}
+	if err := json.Unmarshal(response, &got); err != nil {
+		t.Fatalf("response %s: %v", response, err)
+	}
+	want := microVMSpec{Command: "/usr/bin/server", Args: []string{"--stdio"}, Env: map[string]string{"TOKEN": "secret"}}
+	if !reflect.DeepEqual(got.Result, want) {
+		t.Errorf("spec = %+v, want %+v", got.Result, want)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, config, _ := strings.Cut(string(data), "\n")
+	// 環境変数は vsock でだけ渡し、設定ファイル（カーネルの起動引数を含む）には書き込まない
+	if strings.Contains(config, "secret") {
+		t.Errorf("config file contains the environment: %s", config)
+	}
+	// 設定ファイルと vsock のソケットは終了後に削除する
+	if _, err := os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+		t.Errorf("config directory %s still exists (err = %v)", filepath.Dir(path), err)
+	}
+}
+
+func TestExecutor_MicroVM_ゲストが接続せずに終了_エラー(t *testing.T) {
+	cfg, _ := newMicroVMConfig(t, "crash")
+	e := NewExecutor("/usr/bin/server", nil, nil, slog.Default(), WithMicroVM(cfg))
+
+	if _, err := e.Execute(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)); err == nil {
+		t.Error("Execute() expected error but got none")
+	}
+}
+
+func TestExecutor_microVMConfigFile(t *testing.T) {
+	cfg, _ := newMicroVMConfig(t, "guest")
+	cfg.MemoryMiB = 512
+	cfg.BootArgs = "random.trust_cpu=on"
+	e := NewExecutor("server", nil, map[string]string{"TOKEN": "secret"}, slog.Default(), WithMicroVM(cfg))
+
+	data, err := e.microVMConfigFile("/run/tumiki/vsock.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		BootSource struct {
+			KernelImagePath string `json:"kernel_image_path"`
+			BootArgs        string `json:"boot_args"`
+		} `json:"boot-source"`
+		Drives []struct {
+			PathOnHost   string `json:"path_on_host"`
+			IsRootDevice bool   `json:"is_root_device"`
+			IsReadOnly   bool   `json:"is_read_only"`
+		} `json:"drives"`
+		MachineConfig struct {
+			VCPUCount  int `json:"vcpu_count"`
+			MemSizeMiB int `json:"mem_size_mib"`
+		} `json:"machine-config"`
+		Vsock struct {
+			GuestCID int    `json:"guest_cid"`
+			UDSPath  string `json:"uds_path"`
+		} `json:"vsock"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.BootSource.KernelImagePath != cfg.Kernel || got.BootSource.BootArgs != microVMBootArgs+" random.trust_cpu=on" {
+		t.Errorf("boot-source = %+v", got.BootSource)
+	}
+	if len(got.Drives) != 1 || got.Drives[0].PathOnHost != cfg.RootFS || !got.Drives[0].IsRootDevice || !got.Drives[0].IsReadOnly {
+		t.Errorf("drives = %+v, want the rootfs as a read-only root device", got.Drives)
+	}
+	if got.MachineConfig.VCPUCount != DefaultMicroVMVCPUs || got.MachineConfig.MemSizeMiB != 512 {
+		t.Errorf("machine-config = %+v", got.MachineConfig)
+	}
+	if got.Vsock.GuestCID != microVMGuestCID || got.Vsock.UDSPath != "/run/tumiki/vsock.sock" {
+		t.Errorf("vsock = %+v", got.Vsock)
+	}
+}
+
+func TestExecutor_MicroVM_NotConfigured(t *testing.T) {
+	e := NewExecutor("server", nil, nil, slog.Default(), WithMicroVM(nil))
+	if _, err := e.Execute(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)); err == nil || !strings.Contains(err.Error(), "kernel and rootfs are required") {
+		t.Errorf("Execute() error = %v, want a configuration error", err)
+	}
+}
@@ -0,0 +1,56 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// PartialMessageError はプロセスが JSON-RPC メッセージを途中まで書き込んだまま stdout を閉じたことを表します。
+// 改行で終わらず JSON としても完結していない最後の出力を、切れたメッセージとみなします。
+type PartialMessageError struct {
+	Partial []byte // 読み取れた途中までの出力
+	Stderr  string // プロセスが stderr に出力した内容
+}
+
+func (e *PartialMessageError) Error() string {
+	return fmt.Sprintf("process closed stdout after writing a partial message (%d bytes)", len(e.Partial))
+}
+
+// messageScanner は stdout をメッセージ単位で読み取り、最後のメッセージが区切りで終わっていたかどうかを記録する Scanner です。
+type messageScanner struct {
+	*bufio.Scanner
+	unterminated bool // 直前に読み取ったメッセージが区切りで終わらずに stdout の終わりに達した
+}
+
+// newScanner は最大メッセージサイズを考慮した行単位の Scanner を作成します。
+// 区切り方が FramingNewline 以外の場合は、Content-Length のヘッダーで始まるメッセージも切り出します。
+func (e *Executor) newScanner(r io.Reader) *messageScanner {
+	s := &messageScanner{Scanner: bufio.NewScanner(r)}
+	s.Buffer(make([]byte, 0, min(initialScanBuffer, e.maxMessageSize)), e.maxMessageSize)
+	headers := e.framing != "" && e.framing != FramingNewline
+	s.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if headers {
+			advance, token, ok, unterminated, err := splitContentLength(data, atEOF)
+			if ok || err != nil {
+				s.unterminated = unterminated
+				return advance, token, err
+			}
+		}
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		s.unterminated = atEOF && token != nil && bytes.IndexByte(data, '\n') < 0
+		return advance, token, err
+	})
+	return s
+}
+
+// partial は読み取った行が途中で切れたメッセージであれば PartialMessageError を返します。
+// stderr はプロセスの終了後に呼び出し側で設定します。
+func (s *messageScanner) partial(line []byte) *PartialMessageError {
+	if !s.unterminated || json.Valid(line) {
+		return nil
+	}
+	return &PartialMessageError{Partial: bytes.Clone(line)}
+}
@@ -0,0 +1,80 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecutor_PartialMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		script      string
+		wantPartial string // 空の場合は途中で切れたメッセージとして扱わない
+		wantStderr  string
+	}{
+		{
+			name:        "途中で終了_PartialMessageError",
+			script:      `read line; echo 'crashed' >&2; printf '{"jsonrpc":"2.0","id":1,"res'`,
+			wantPartial: `{"jsonrpc":"2.0","id":1,"res`,
+			wantStderr:  "crashed",
+		},
+		{
+			name:   "改行なしの完結したメッセージ_成功",
+			script: `read line; printf '{"jsonrpc":"2.0","id":1,"result":{}}'`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := NewExecutor("sh", []string{"-c", tt.script}, nil, slog.Default())
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			runs := map[string]func() error{
+				"Execute": func() error {
+					_, err := executor.Execute(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+					return err
+				},
+				"Stream": func() error {
+					return executor.Stream(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`), func([]byte) error { return nil })
+				},
+				"Session": func() error {
+					session, err := executor.Start(ctx)
+					if err != nil {
+						return err
+					}
+					defer func() { _ = session.Close() }()
+					if err := session.Send([]byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)); err != nil {
+						return err
+					}
+					for {
+						if _, err := session.Receive(ctx); err != nil {
+							return err
+						}
+					}
+				},
+			}
+			for mode, run := range runs {
+				err := run()
+				var partial *PartialMessageError
+				if tt.wantPartial == "" {
+					if errors.As(err, &partial) {
+						t.Errorf("%s: error = %v, want no partial message error", mode, err)
+					}
+					continue
+				}
+				if !errors.As(err, &partial) {
+					t.Errorf("%s: error = %v, want PartialMessageError", mode, err)
+					continue
+				}
+				if string(partial.Partial) != tt.wantPartial || !strings.Contains(partial.Stderr, tt.wantStderr) {
+					t.Errorf("%s: partial = %q, stderr = %q, want %q and %q", mode, partial.Partial, partial.Stderr, tt.wantPartial, tt.wantStderr)
+				}
+			}
+		})
+	}
+}
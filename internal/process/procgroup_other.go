@@ -0,0 +1,20 @@
+//go:build !unix
+
+package process
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup はプロセスグループのない OS では何もしません。
+func setProcessGroup(*exec.Cmd) {}
+
+// signalGroup はプロセスグループのない OS では、プロセスだけに sig を送ります（SIGKILL は強制終了）。
+func signalGroup(p *os.Process, sig syscall.Signal) error {
+	if sig == syscall.SIGKILL {
+		return p.Kill()
+	}
+	return p.Signal(sig)
+}
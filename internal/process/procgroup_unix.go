@@ -0,0 +1,30 @@
+//go:build unix
+
+package process
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup はプロセスを新しいプロセスグループで起動し、ctx のキャンセル時にグループ全体を強制終了させます。
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return signalGroup(cmd.Process, syscall.SIGKILL)
+	}
+}
+
+// signalGroup はプロセスを先頭とするプロセスグループの全てのプロセスに sig を送ります。
+// グループのプロセスが全て終了している場合は os.ErrProcessDone を返します。
+func signalGroup(p *os.Process, sig syscall.Signal) error {
+	if err := syscall.Kill(-p.Pid, sig); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return os.ErrProcessDone
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+//go:build unix
+
+package process
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// processAlive は pid のプロセスが動いているかを返します。終了して回収を待っているプロセスは動いていないとみなします。
+func processAlive(pid int) bool {
+	if err := syscall.Kill(pid, 0); err != nil {
+		return false
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return true
+	}
+	_, state, _ := strings.Cut(string(stat), ") ")
+	return !strings.HasPrefix(state, "Z")
+}
+
+func TestExecutor_ProcessGroup_キャンセルで子孫のプロセスも終了(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	// ランチャーと同じように、サーバーを子のプロセスとして起動して終了を待つ
+	script := "sleep 30 & echo $! > " + pidFile + "; wait"
+	executor := NewExecutor("sh", []string{"-c", script}, nil, nil, WithProcessGroup())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_, _ = executor.Execute(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+		close(done)
+	}()
+
+	var pid int
+	deadline := time.Now().Add(5 * time.Second)
+	for pid == 0 && time.Now().Before(deadline) {
+		if data, err := os.ReadFile(pidFile); err == nil && strings.HasSuffix(string(data), "\n") {
+			pid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pid == 0 {
+		t.Fatal("child process did not start")
+	}
+	cancel()
+	<-done
+
+	deadline = time.Now().Add(5 * time.Second)
+	for processAlive(pid) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if processAlive(pid) {
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+		t.Errorf("child process %d is still running after cancel", pid)
+	}
+}
@@ -0,0 +1,235 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+)
+
+// 動的シークレットの期限が近づいたセッションの扱いです。
+const (
+	RotationReplace = "replace" // 新しいシークレットでプロセスを起動して初期化をやり直し、セッションを続けたまま切り替える
+	RotationClose   = "close"   // セッションを終了し、クライアントに新しいセッションを始めさせる
+	RotationNone    = "none"    // 何もしない（期限が切れたシークレットを使い続ける）
+)
+
+// 入れ替えの設定です。
+const (
+	rotationTimeout       = 30 * time.Second // 入れ替えるプロセスの initialize のレスポンスを待つ最大時間
+	rotationRetryInterval = 5 * time.Second  // 入れ替えに失敗した場合に再試行するまでの間隔
+)
+
+// rotationRequestID は入れ替えたプロセスに送り直す initialize の ID です。クライアントの ID と衝突しないよう文字列にしています。
+var rotationRequestID = json.RawMessage(`"tumiki-rotation"`)
+
+// errSessionEnded は入れ替えの途中でセッションが終了したことを表します。
+var errSessionEnded = errors.New("session ended")
+
+// ValidateRotation は入れ替えの方式の名前が対応しているものかを検証します。空文字列は RotationNone と同じです。
+func ValidateRotation(name string) error {
+	switch name {
+	case "", RotationReplace, RotationClose, RotationNone:
+		return nil
+	default:
+		return fmt.Errorf("unsupported secret rotation %q (supported: %s, %s, %s)", name, RotationReplace, RotationClose, RotationNone)
+	}
+}
+
+// WithSecretRotation は起動し続けるプロセスの動的シークレットの期限が近づいた時の扱いを設定します。
+// WithSecrets と組み合わせて使用します。1回のリクエストで終了するプロセスには影響しません。
+func WithSecretRotation(strategy string) Option {
+	return func(e *Executor) {
+		e.rotation = strategy
+	}
+}
+
+// recordHandshake はクライアントが送った initialize と notifications/initialized を記録します。writeMu を保持して呼び出します。
+func (s *Session) recordHandshake(msg []byte) {
+	if len(s.handshake) >= 2 || !bytes.Contains(msg, []byte("initialize")) {
+		return
+	}
+	parsed, err := jsonrpc.Parse(msg)
+	if err != nil {
+		return
+	}
+	if (parsed.Method == "initialize" && len(s.handshake) == 0) || (parsed.Method == "notifications/initialized" && len(s.handshake) == 1) {
+		s.handshake = append(s.handshake, bytes.Clone(msg))
+	}
+}
+
+// watchRotation はプロセスに渡した動的シークレットの期限が近づくと、設定した方式でセッションを続けます。
+func (s *Session) watchRotation(ctx context.Context, e *Executor, p *sessionProcess) {
+	cmd, ok := p.cmd.(*secretsCommand)
+	if !ok || (e.rotation != RotationReplace && e.rotation != RotationClose) {
+		return
+	}
+	s.tasks.Go(func() error {
+		select {
+		case <-cmd.leases.Expiring():
+		case <-p.exited:
+			return nil
+		case <-s.closing:
+			return nil
+		}
+		if e.rotation == RotationClose {
+			s.log(slog.LevelInfo, "Closing session before its secrets expire")
+			_ = s.Close()
+			return nil
+		}
+		for {
+			err := s.replace(ctx, e, p)
+			if err == nil || errors.Is(err, errSessionEnded) {
+				return nil
+			}
+			s.log(slog.LevelWarn, "Failed to rotate session secrets", "error", err)
+			select {
+			case <-time.After(rotationRetryInterval):
+			case <-p.exited:
+				return nil
+			case <-s.closing:
+				return nil
+			}
+		}
+	})
+}
+
+// replace は新しいシークレットでプロセスを起動し、記録した初期化を送り直してから old と入れ替えます。
+// old は stdin を閉じ、処理中のリクエストに応答して終了するまで stdout を読み続けます。
+func (s *Session) replace(ctx context.Context, e *Executor, old *sessionProcess) error {
+	next, scanner, stdout, err := s.startProcess(ctx, e)
+	if err != nil {
+		return err
+	}
+	abort := func(err error) error {
+		_ = next.cmd.Kill()
+		<-next.exited
+		return err
+	}
+
+	s.writeMu.Lock()
+	handshake := slices.Clone(s.handshake)
+	s.writeMu.Unlock()
+	if err := s.initialize(next, scanner, handshake); err != nil {
+		return abort(err)
+	}
+
+	s.writeMu.Lock()
+	ended := s.inputClosed
+	select {
+	case <-old.exited:
+		ended = true
+	default:
+	}
+	if ended {
+		s.writeMu.Unlock()
+		return abort(errSessionEnded)
+	}
+	s.current = next
+	s.readers.Go(func() error { return s.readLoop(scanner, stdout) })
+	_ = old.stdin.Close()
+	s.writeMu.Unlock()
+	s.log(slog.LevelInfo, "Rotated session secrets")
+
+	// セッションを閉じる時は、処理中のリクエストが残っている古いプロセスも終了させる
+	s.tasks.Go(func() error {
+		select {
+		case <-old.exited:
+		case <-s.closing:
+			select {
+			case <-old.exited:
+			case <-time.After(WaitDelay):
+				_ = old.cmd.Kill()
+			}
+		}
+		return nil
+	})
+	s.watchRotation(ctx, e, next)
+	return nil
+}
+
+// initialize は記録した initialize を ID を置き換えて送り、レスポンスを受け取ってから notifications/initialized を送ります。
+// 初期化前に入れ替える場合は何も送りません。
+func (s *Session) initialize(p *sessionProcess, scanner *messageScanner, handshake [][]byte) error {
+	for _, msg := range handshake {
+		parsed, err := jsonrpc.Parse(msg)
+		if err != nil {
+			return err
+		}
+		if parsed.IsRequest() {
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(msg, &fields); err != nil {
+				return err
+			}
+			fields["id"] = rotationRequestID
+			if msg, err = json.Marshal(fields); err != nil {
+				return err
+			}
+		}
+		encoded, err := s.encode(msg)
+		if err != nil {
+			return err
+		}
+		if _, err := p.stdin.Write(frameMessage(encoded, s.framing)); err != nil {
+			return fmt.Errorf("write to stdin: %w", err)
+		}
+		if parsed.IsRequest() {
+			if err := s.awaitResponse(scanner); err != nil {
+				return fmt.Errorf("initialize rotated process: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// awaitResponse は送り直した initialize のレスポンスを読み取ります。それまでの通知などは破棄します。
+func (s *Session) awaitResponse(scanner *messageScanner) error {
+	result := make(chan error, 1)
+	s.tasks.Go(func() error {
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			decoded, err := s.decode(bytes.Clone(line))
+			if err != nil {
+				result <- err
+				return nil
+			}
+			msg, err := jsonrpc.Parse(decoded)
+			if err != nil || !msg.IsResponse() || !jsonrpc.SameID(msg.ID, rotationRequestID) {
+				continue
+			}
+			if msg.Error != nil {
+				result <- msg.Error
+			} else {
+				result <- nil
+			}
+			return nil
+		}
+		if err := scanner.Err(); err != nil {
+			result <- s.newError(err)
+			return nil
+		}
+		result <- errors.New("process exited before responding")
+		return nil
+	})
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(rotationTimeout):
+		return errors.New("timed out waiting for initialize response")
+	}
+}
+
+func (s *Session) log(level slog.Level, msg string, args ...any) {
+	if s.logger != nil {
+		s.logger.Log(context.Background(), level, msg, args...)
+	}
+}
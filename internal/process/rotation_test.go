@@ -0,0 +1,113 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rotationServer は initialize と whoami に DB_USER で応答し、notifications/initialized を受け取ったかを返す MCP サーバーです。
+const rotationServer = `while read -r line; do
+  id=$(printf '%s' "$line" | sed -n 's/.*"id":\([^,}]*\).*/\1/p')
+  case "$line" in
+    *'"method":"initialize"'*) echo "{\"jsonrpc\":\"2.0\",\"id\":$id,\"result\":{\"user\":\"$DB_USER\"}}" ;;
+    *'"method":"notifications/initialized"'*) initialized=yes ;;
+    *'"method":"whoami"'*) echo "{\"jsonrpc\":\"2.0\",\"id\":$id,\"result\":{\"user\":\"$DB_USER\",\"initialized\":\"$initialized\"}}" ;;
+  esac
+done`
+
+// call はリクエストを送り、レスポンスを返します。
+func call(t *testing.T, session *Session, id int, method string) string {
+	t.Helper()
+	if err := session.Send([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":%q,"params":{}}`, id, method))); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := session.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	return string(msg)
+}
+
+func TestSession_SecretRotationReplace(t *testing.T) {
+	vault := &fakeVault{duration: 1, nonRenewable: true}
+	e := NewExecutor("sh", []string{"-c", rotationServer}, nil, slog.Default(),
+		WithSecrets(newSecretsManager(t, vault)), WithSecretRotation(RotationReplace))
+
+	session, err := e.Start(context.Background())
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() { _ = session.Close() }()
+
+	if got := call(t, session, 1, "initialize"); !strings.Contains(got, `"user":"user-1"`) {
+		t.Fatalf("initialize response = %s", got)
+	}
+	if err := session.Send([]byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 有効期間の 2/3 を過ぎると新しいシークレットのプロセスに切り替わり、初期化済みの状態でセッションが続く
+	deadline := time.Now().Add(5 * time.Second)
+	for id := 2; ; id++ {
+		got := call(t, session, id, "whoami")
+		if !strings.Contains(got, fmt.Sprintf(`"id":%d`, id)) {
+			t.Fatalf("whoami response = %s, want id %d (the replayed initialize must not reach the client)", got, id)
+		}
+		if strings.Contains(got, `"user":"user-2","initialized":"yes"`) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("session was not rotated: last response = %s", got)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// 入れ替えた古いプロセスのリースは終了後に失効させる
+	for !slices.Contains(vault.revokedLeases(), "lease-1") {
+		if time.Now().After(deadline) {
+			t.Fatalf("revoked = %v, want lease-1", vault.revokedLeases())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-session.Exited():
+		t.Fatal("session exited after rotation")
+	default:
+	}
+}
+
+func TestSession_SecretRotationClose(t *testing.T) {
+	vault := &fakeVault{duration: 1, nonRenewable: true}
+	e := NewExecutor("cat", nil, nil, slog.Default(), WithSecrets(newSecretsManager(t, vault)), WithSecretRotation(RotationClose))
+
+	session, err := e.Start(context.Background())
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	select {
+	case <-session.Exited():
+	case <-time.After(5 * time.Second):
+		t.Fatal("session was not closed before its secrets expired")
+	}
+	if got := vault.revokedLeases(); fmt.Sprint(got) != "[lease-1]" {
+		t.Errorf("revoked = %v, want [lease-1]", got)
+	}
+}
+
+func TestValidateRotation(t *testing.T) {
+	for _, name := range []string{"", RotationReplace, RotationClose, RotationNone} {
+		if err := ValidateRotation(name); err != nil {
+			t.Errorf("ValidateRotation(%q) error = %v", name, err)
+		}
+	}
+	if err := ValidateRotation("restart"); err == nil {
+		t.Error(`ValidateRotation("restart") expected error but got none`)
+	}
+}
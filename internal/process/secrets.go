@@ -0,0 +1,68 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/secrets"
+)
+
+// WithSecrets はプロセスを起動するたびに動的シークレットを発行して環境変数で渡し、
+// プロセスが動いている間はリースを更新し、終了後に失効させます。
+// 1回のリクエストで終了するプロセスではリクエストごと、起動し続けるプロセスではセッションごとの認証情報になります。
+func WithSecrets(manager *secrets.Manager) Option {
+	return func(e *Executor) {
+		e.secrets = manager
+	}
+}
+
+// secretsCommand は終了後にシークレットのリースを失効させる command です。
+type secretsCommand struct {
+	command
+	leases *secrets.Leases
+	logger *slog.Logger
+}
+
+// newSecretsCommand はシークレットを発行し、環境変数に設定したコマンドを作成します。
+func (e *Executor) newSecretsCommand(ctx context.Context) (command, error) {
+	leases, err := e.secrets.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("acquire secrets: %w", err)
+	}
+
+	inner := *e
+	inner.secrets = nil
+	inner.env = make(map[string]string, len(e.env)+len(leases.Env()))
+	for k, v := range e.env {
+		inner.env[k] = v
+	}
+	for k, v := range leases.Env() {
+		inner.env[k] = v
+	}
+
+	cmd, err := inner.newCommand(ctx)
+	if err != nil {
+		_ = leases.Release()
+		return nil, err
+	}
+	return &secretsCommand{command: cmd, leases: leases, logger: e.logger}, nil
+}
+
+func (c *secretsCommand) Start() error {
+	if err := c.command.Start(); err != nil {
+		_ = c.leases.Release()
+		return err
+	}
+	return nil
+}
+
+// Wait はプロセスの終了を待ってからリースを失効させます。
+// 失効に失敗してもプロセスの結果には影響しないため、ログに出力するだけにします（リースは有効期間の経過で失効します）。
+func (c *secretsCommand) Wait() error {
+	err := c.command.Wait()
+	if releaseErr := c.leases.Release(); releaseErr != nil && c.logger != nil {
+		c.logger.Warn("Failed to revoke secrets", "error", releaseErr)
+	}
+	return err
+}
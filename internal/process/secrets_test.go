@@ -0,0 +1,128 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/secrets"
+)
+
+// fakeVault はデータベースの認証情報を発行ごとに異なるユーザー名で返し、失効したリースを記録する Vault です。
+type fakeVault struct {
+	duration     int  // リースの有効期間の秒数（0 で 3600）
+	nonRenewable bool // 更新できないリースを発行する
+
+	mu      sync.Mutex
+	issued  int
+	revoked []string
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	switch r.URL.Path {
+	case "/v1/database/creds/readonly":
+		v.issued++
+		duration := v.duration
+		if duration == 0 {
+			duration = 3600
+		}
+		_, _ = fmt.Fprintf(w, `{"lease_id":"lease-%d","lease_duration":%d,"renewable":%t,"data":{"username":"user-%d","password":"pw"}}`,
+			v.issued, duration, !v.nonRenewable, v.issued)
+	case "/v1/sys/leases/revoke":
+		var body struct {
+			LeaseID string `json:"lease_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		v.revoked = append(v.revoked, body.LeaseID)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (v *fakeVault) revokedLeases() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return append([]string(nil), v.revoked...)
+}
+
+func newSecretsManager(t *testing.T, vault *fakeVault) *secrets.Manager {
+	t.Helper()
+	server := httptest.NewServer(vault)
+	t.Cleanup(server.Close)
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+	manager, err := secrets.NewManager([]secrets.Spec{
+		{Path: "database/creds/readonly", Env: map[string]string{"username": "DB_USER", "password": "DB_PASSWORD"}},
+	}, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manager
+}
+
+func TestExecutor_Secrets(t *testing.T) {
+	vault := &fakeVault{}
+	e := NewExecutor("sh", []string{"-c", `read line; echo "{\"jsonrpc\":\"2.0\",\"id\":1,\"result\":{\"user\":\"$DB_USER\",\"password\":\"$DB_PASSWORD\"}}"`},
+		nil, slog.Default(), WithSecrets(newSecretsManager(t, vault)))
+
+	for i := 1; i <= 2; i++ {
+		response, err := e.Execute(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		if want := fmt.Sprintf(`"user":"user-%d","password":"pw"`, i); !strings.Contains(string(response), want) {
+			t.Errorf("response = %s, want %s", response, want)
+		}
+	}
+	// 終了したプロセスのリースは失効させる
+	if got := vault.revokedLeases(); fmt.Sprint(got) != "[lease-1 lease-2]" {
+		t.Errorf("revoked = %v, want [lease-1 lease-2]", got)
+	}
+}
+
+func TestExecutor_SecretsPerSession(t *testing.T) {
+	vault := &fakeVault{}
+	e := NewExecutor("cat", nil, nil, slog.Default(), WithSecrets(newSecretsManager(t, vault)))
+
+	session, err := e.Start(context.Background())
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if got := vault.revokedLeases(); len(got) != 0 {
+		t.Errorf("revoked = %v while the session runs, want none", got)
+	}
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+	<-session.Exited()
+	if got := vault.revokedLeases(); fmt.Sprint(got) != "[lease-1]" {
+		t.Errorf("revoked = %v after Close, want [lease-1]", got)
+	}
+}
+
+func TestExecutor_SecretsIssueFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+	}))
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+	manager, err := secrets.NewManager([]secrets.Spec{{Path: "database/creds/readonly", Env: map[string]string{"username": "DB_USER"}}}, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewExecutor("cat", nil, nil, slog.Default(), WithSecrets(manager))
+	if _, err := e.Execute(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)); err == nil || !strings.Contains(err.Error(), "acquire secrets") {
+		t.Errorf("Execute() error = %v, want acquire secrets error", err)
+	}
+}
@@ -0,0 +1,346 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sessionMessageBuffer は stdout から読み取ったメッセージを保持するチャネルの容量です。
+const sessionMessageBuffer = 64
+
+// Session は起動し続ける stdio プロセスとの双方向の接続です。
+// stdin への書き込みと stdout からの行単位の読み取りを個別に行えます。
+// 動的シークレットの入れ替えが有効な場合は、セッションを続けたまま新しいプロセスに切り替わることがあります。
+type Session struct {
+	stderr   *lockedBuffer
+	messages chan []byte
+	exited   chan struct{}
+	closing  chan struct{}
+	logger   *slog.Logger
+
+	writeMu     sync.Mutex
+	current     *sessionProcess // stdin に書き込むプロセス（writeMu で保護）
+	inputClosed bool            // CloseInput・Close の後は入れ替えない（writeMu で保護）
+	handshake   [][]byte        // 入れ替えたプロセスに送り直す initialize と notifications/initialized（writeMu で保護）
+
+	closeOnce sync.Once
+	killed    atomic.Bool // Close・Terminate で WaitDelay 以内に終了せず強制終了した
+	waitErr   error
+	readers   group  // プロセスの stdout を読み取る goroutine（最初のエラーが読み取りのエラー）
+	readErr   error  // readers の最初のエラー（messages を閉じる前に設定する）
+	tasks     group  // プロセスの監視とシークレットの入れ替えの goroutine
+	framing   string // stdin に書き込むメッセージの区切り方
+
+	// 初期化に失敗した場合の診断情報
+	command     string
+	startedAt   time.Time
+	envKeys     []string
+	stdoutBytes atomic.Int64
+
+	newError func(error) error
+	encode   func([]byte) ([]byte, error)
+	decode   func([]byte) ([]byte, error)
+}
+
+// sessionProcess はセッションで起動した1つのプロセスです。
+type sessionProcess struct {
+	cmd     command
+	stdin   io.WriteCloser
+	exited  chan struct{}
+	waitErr error
+}
+
+// Start は stdio プロセスを起動し、Session を返します。
+// プロセスは ctx がキャンセルされるか Close が呼ばれるまで起動し続けます。
+func (e *Executor) Start(ctx context.Context) (*Session, error) {
+	s := &Session{
+		stderr:   &lockedBuffer{},
+		messages: make(chan []byte, sessionMessageBuffer),
+		exited:   make(chan struct{}),
+		closing:  make(chan struct{}),
+		logger:   e.logger,
+		framing:  e.framingFor(ctx),
+		command:  e.command,
+		envKeys:  e.envKeys(),
+		newError: e.readError,
+		encode:   e.encodeMessage,
+		decode:   e.decodeMessage,
+	}
+	s.startedAt = time.Now()
+	p, scanner, stdout, err := s.startProcess(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	s.current = p
+	s.readers.Go(func() error { return s.readLoop(scanner, stdout) })
+	s.tasks.Go(s.supervise)
+	s.watchRotation(ctx, e, p)
+	return s, nil
+}
+
+// startProcess はプロセスを起動し、stdout を読み取る Scanner と元の Reader を返します。
+func (s *Session) startProcess(ctx context.Context, e *Executor) (*sessionProcess, *messageScanner, io.Reader, error) {
+	cmd, err := e.newCommand(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("stdin pipe: %w", err)
+	}
+
+	// stdout は io.Pipe 経由で受け取り、Wait 完了後に書き込み側を閉じて読み取りを終了させる
+	pr, pw := io.Pipe()
+	var stdout io.Writer = countingWriter{w: pw, count: &s.stdoutBytes}
+	var stderr io.Writer = s.stderr
+	if e.tracer != nil {
+		stdin = e.tracer.writer("stdin", stdin)
+		stdout = e.tracer.writer("stdout", stdout)
+		stderr = e.tracer.writer("stderr", stderr)
+	}
+	cmd.SetStdout(stdout)
+	cmd.SetStderr(stderr)
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, nil, fmt.Errorf("process start: %w", err)
+	}
+
+	p := &sessionProcess{cmd: cmd, stdin: stdin, exited: make(chan struct{})}
+	s.tasks.Go(func() error {
+		p.waitErr = cmd.Wait()
+		_ = pw.Close()
+		close(p.exited)
+		return nil
+	})
+	return p, e.newScanner(pr), pr, nil
+}
+
+// supervise は stdin に書き込んでいるプロセスが終了するとセッションを終了させ、
+// 全てのプロセスの stdout を読み終えた後に最初の読み取りエラーを記録してメッセージのチャネルを閉じます。
+func (s *Session) supervise() error {
+	for {
+		s.writeMu.Lock()
+		p := s.current
+		s.writeMu.Unlock()
+		<-p.exited
+
+		s.writeMu.Lock()
+		done := s.current == p
+		if done {
+			s.waitErr = p.waitErr
+		}
+		s.writeMu.Unlock()
+		if done {
+			break
+		}
+	}
+	close(s.exited)
+	s.readErr = s.readers.Wait()
+	close(s.messages)
+	return nil
+}
+
+// readLoop は stdout から読み取ったメッセージを messages に渡し、読み取りを止めた原因を返します。
+// stdout の終わりまで読み取った場合は nil を返します。
+func (s *Session) readLoop(scanner *messageScanner, r io.Reader) (err error) {
+	// 読み取りを止めた後もプロセスが書き込みでブロックしないよう残りを破棄する
+	defer func() { _, _ = io.Copy(io.Discard, r) }()
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		// stdout が閉じられるのはプロセスの終了後のため、stderr も出力し終えている
+		if partial := scanner.partial(line); partial != nil {
+			partial.Stderr = s.Stderr()
+			return partial
+		}
+		// 読み取りバッファは次の Scan で上書きされるためコピーしてから展開する
+		msg, err := s.decode(bytes.Clone(line))
+		if err != nil {
+			return err
+		}
+		select {
+		case s.messages <- msg:
+		case <-s.closing:
+			// 受信側がいなくなったため以降のメッセージは破棄する
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return s.newError(err)
+	}
+	return nil
+}
+
+// closedErr は messages が閉じられた後に、読み取りを終えた原因を返します。
+func (s *Session) closedErr() error {
+	if s.readErr != nil {
+		return s.readErr
+	}
+	return io.EOF
+}
+
+// Send は1メッセージを区切りを付けて stdin に書き込みます。
+func (s *Session) Send(msg []byte) error {
+	encoded, err := s.encode(msg)
+	if err != nil {
+		return err
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.recordHandshake(msg)
+
+	if _, err := s.current.stdin.Write(frameMessage(encoded, s.framing)); err != nil {
+		return fmt.Errorf("write to stdin: %w", err)
+	}
+	return nil
+}
+
+// CloseInput は stdin を閉じ、これ以上メッセージを送らないことをプロセスに伝えます。
+// プロセスが出力済みのメッセージは引き続き Receive で読み取れます。
+func (s *Session) CloseInput() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.inputClosed = true
+	return s.current.stdin.Close()
+}
+
+// Receive は stdout から次の1メッセージを読み取ります。
+// プロセスの stdout が閉じられた場合は io.EOF を、読み取りに失敗した場合はその原因を返します。
+func (s *Session) Receive(ctx context.Context) ([]byte, error) {
+	select {
+	case msg, ok := <-s.messages:
+		if !ok {
+			return nil, s.closedErr()
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// TryReceive は読み取り済みのメッセージがあれば待たずに返します。
+// メッセージがない場合は nil, nil を返し、stdout が閉じられた後は Receive と同じエラーを返します。
+func (s *Session) TryReceive() ([]byte, error) {
+	select {
+	case msg, ok := <-s.messages:
+		if !ok {
+			return nil, s.closedErr()
+		}
+		return msg, nil
+	default:
+		return nil, nil
+	}
+}
+
+// alive はプロセスが終了しておらず、stdout も閉じられていないかどうかを返します。
+// 前のリクエストの後に出力された通知などは読み捨てます。
+func (s *Session) alive() bool {
+	select {
+	case <-s.Exited():
+		return false
+	default:
+	}
+	for {
+		msg, err := s.TryReceive()
+		if err != nil {
+			return false
+		}
+		if msg == nil {
+			return true
+		}
+	}
+}
+
+// Exited はプロセス終了時にクローズされるチャネルを返します。
+func (s *Session) Exited() <-chan struct{} {
+	return s.exited
+}
+
+// Err はプロセス終了後に Wait の結果を返します。終了前は nil を返します。
+func (s *Session) Err() error {
+	select {
+	case <-s.exited:
+		return s.waitErr
+	default:
+		return nil
+	}
+}
+
+// Stderr はこれまでにプロセスが stderr に出力した内容を返します。
+func (s *Session) Stderr() string {
+	return s.stderr.String()
+}
+
+// Close は stdin を閉じてプロセスの終了を待ちます。
+// WaitDelay 以内に終了しない場合はプロセスを強制終了します。
+func (s *Session) Close() error {
+	return s.shutdown(false)
+}
+
+// Terminate は stdin を閉じてプロセスに SIGTERM を送り、終了を待ちます。
+// クライアントがセッションを明示的に終了した場合に使います。WaitDelay 以内に終了しない場合はプロセスを強制終了します。
+func (s *Session) Terminate() error {
+	return s.shutdown(true)
+}
+
+// Killed は Close か Terminate で WaitDelay 以内に終了しなかったため、プロセスを強制終了したかどうかを返します。
+func (s *Session) Killed() bool {
+	return s.killed.Load()
+}
+
+// shutdown は Close と Terminate の共通処理です。2回目以降の呼び出しは何もしません。
+func (s *Session) shutdown(terminate bool) error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.closing)
+		s.writeMu.Lock()
+		s.inputClosed = true
+		p := s.current
+		_ = p.stdin.Close()
+		s.writeMu.Unlock()
+		if terminate {
+			if termErr := p.cmd.Terminate(); termErr != nil && !errors.Is(termErr, os.ErrProcessDone) {
+				err = fmt.Errorf("process terminate: %w", termErr)
+			}
+		}
+		select {
+		case <-s.exited:
+		case <-time.After(WaitDelay):
+			s.killed.Store(true)
+			if killErr := p.cmd.Kill(); killErr != nil {
+				err = fmt.Errorf("process kill: %w", killErr)
+			}
+			<-s.exited
+		}
+	})
+	return err
+}
+
+// lockedBuffer は並行書き込み・読み取りが可能な bytes.Buffer です。
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
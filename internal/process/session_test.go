@@ -0,0 +1,238 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSession_SendReceive(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	executor := NewExecutor("cat", []string{}, map[string]string{}, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := executor.Start(ctx)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() { _ = session.Close() }()
+
+	// 複数メッセージを同一プロセスでやり取りできることを検証
+	for _, msg := range []string{`{"id":1}`, `{"id":2}`} {
+		if err := session.Send([]byte(msg)); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		got, err := session.Receive(ctx)
+		if err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		if string(got) != msg {
+			t.Errorf("Receive() = %s, want %s", got, msg)
+		}
+	}
+}
+
+func TestSession_ReceiveAfterExit(t *testing.T) {
+	executor := NewExecutor("sh", []string{"-c", "echo done; echo oops >&2"}, map[string]string{}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := executor.Start(ctx)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	if got, err := session.Receive(ctx); err != nil || string(got) != "done" {
+		t.Fatalf("Receive() = %s, %v, want done", got, err)
+	}
+	if _, err := session.Receive(ctx); !errors.Is(err, io.EOF) {
+		t.Errorf("Receive() error = %v, want io.EOF", err)
+	}
+
+	<-session.Exited()
+	if session.Err() != nil {
+		t.Errorf("Err() = %v, want nil", session.Err())
+	}
+	if !strings.Contains(session.Stderr(), "oops") {
+		t.Errorf("Stderr() = %q, want to contain oops", session.Stderr())
+	}
+}
+
+func TestSession_CloseInput(t *testing.T) {
+	executor := NewExecutor("cat", []string{}, map[string]string{}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := executor.Start(ctx)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() { _ = session.Close() }()
+
+	if err := session.Send([]byte(`{"id":1}`)); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if err := session.CloseInput(); err != nil {
+		t.Fatalf("CloseInput() error = %v", err)
+	}
+
+	// stdin を閉じた後も出力済みのメッセージを読み取れ、その後 EOF になる
+	if got, err := session.Receive(ctx); err != nil || string(got) != `{"id":1}` {
+		t.Fatalf("Receive() = %s, %v, want {\"id\":1}", got, err)
+	}
+	if _, err := session.Receive(ctx); !errors.Is(err, io.EOF) {
+		t.Errorf("Receive() error = %v, want io.EOF", err)
+	}
+	if err := session.Send([]byte(`{"id":2}`)); err == nil {
+		t.Error("Send() after CloseInput error = nil, want error")
+	}
+}
+
+func TestSession_TryReceive(t *testing.T) {
+	executor := NewExecutor("sh", []string{"-c", "read line; echo \"$line\""}, map[string]string{}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := executor.Start(ctx)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() { _ = session.Close() }()
+
+	// 出力前は待たずに nil を返す
+	if got, err := session.TryReceive(); got != nil || err != nil {
+		t.Fatalf("TryReceive() = %s, %v, want nil, nil", got, err)
+	}
+
+	if err := session.Send([]byte(`{"id":1}`)); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	// 読み取り goroutine に追いつくまで繰り返し、メッセージの後に EOF を返すことを検証
+	tryReceive := func() ([]byte, error) {
+		for ctx.Err() == nil {
+			if msg, err := session.TryReceive(); msg != nil || err != nil {
+				return msg, err
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return nil, ctx.Err()
+	}
+	if got, err := tryReceive(); err != nil || string(got) != `{"id":1}` {
+		t.Fatalf("TryReceive() = %s, %v, want {\"id\":1}", got, err)
+	}
+	if _, err := tryReceive(); !errors.Is(err, io.EOF) {
+		t.Errorf("TryReceive() error = %v, want io.EOF", err)
+	}
+}
+
+func TestSession_ReceiveTimeout(t *testing.T) {
+	executor := NewExecutor("cat", []string{}, map[string]string{}, nil)
+
+	session, err := executor.Start(context.Background())
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() { _ = session.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := session.Receive(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Receive() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestSession_Close_KillsHungProcess(t *testing.T) {
+	// stdin を閉じても終了しないプロセス（孫プロセスがパイプを保持するため最大 2*WaitDelay かかる）
+	executor := NewExecutor("sh", []string{"-c", "trap '' TERM; sleep 30"}, map[string]string{}, nil)
+
+	session, err := executor.Start(context.Background())
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	start := time.Now()
+	if err := session.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*WaitDelay+time.Second {
+		t.Errorf("Close() took %v", elapsed)
+	}
+	if !session.Killed() {
+		t.Error("Killed() = false, want true for a process that ignored stdin close")
+	}
+
+	// 2回目の Close は何もしない
+	if err := session.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
+
+func TestSession_Terminate(t *testing.T) {
+	// stdin を閉じても終了せず、SIGTERM を受け取ると後始末を出力して終了するプロセス
+	executor := NewExecutor("sh", []string{"-c", "trap 'echo cleaned up >&2; exit 0' TERM; echo ready; while :; do sleep 0.05; done"}, map[string]string{}, nil)
+
+	session, err := executor.Start(context.Background())
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	// trap を設定し終えてからシグナルを送る
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := session.Receive(ctx); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+
+	start := time.Now()
+	if err := session.Terminate(); err != nil {
+		t.Errorf("Terminate() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= WaitDelay {
+		t.Errorf("Terminate() took %v, want the process to exit on SIGTERM", elapsed)
+	}
+	if session.Killed() {
+		t.Error("Killed() = true, want false for a process that exited on SIGTERM")
+	}
+	if !strings.Contains(session.Stderr(), "cleaned up") {
+		t.Errorf("stderr = %q, want the SIGTERM handler output", session.Stderr())
+	}
+
+	// 終了後の Close は何もしない
+	if err := session.Close(); err != nil {
+		t.Errorf("Close() after Terminate() error = %v", err)
+	}
+}
+
+func TestExecutor_Start_NonexistentCommand(t *testing.T) {
+	executor := NewExecutor("nonexistent-command-12345", []string{}, map[string]string{}, nil)
+	if _, err := executor.Start(context.Background()); err == nil {
+		t.Error("Start() expected error but got none")
+	}
+}
+
+func TestSession_MaxMessageSize(t *testing.T) {
+	executor := NewExecutor("sh", []string{"-c", "printf '%0100d\\n' 0"}, map[string]string{}, nil, WithMaxMessageSize(16))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := executor.Start(ctx)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() { _ = session.Close() }()
+
+	if _, err := session.Receive(ctx); err == nil || !strings.Contains(err.Error(), "exceeds max size") {
+		t.Errorf("Receive() error = %v, want max size error", err)
+	}
+}
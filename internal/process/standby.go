@@ -0,0 +1,441 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultScaleInterval は予備プロセスの数を見直すデフォルトの間隔です。
+const DefaultScaleInterval = 10 * time.Second
+
+// ErrStandbyClosed は Close 後の Standby で実行しようとした場合のエラーです。
+var ErrStandbyClosed = errors.New("standby closed")
+
+// StandbyConfig は Standby が保持する予備プロセスの数の設定です。
+// Max が Min より大きい場合は、予備プロセスを待ったリクエストの数と待ち時間に応じて
+// ScaleInterval ごとに Min から Max の間で予備プロセスの数を増減します。
+type StandbyConfig struct {
+	Min           int           // 常に保持する予備プロセスの数
+	Max           int           // 保持する予備プロセスの最大数
+	ScaleInterval time.Duration // 予備プロセスの数を見直す間隔（0 でデフォルト）
+	MaxIdle       time.Duration // 待機したままこれを過ぎた予備プロセスを終了させて起動し直す（0 で無制限）
+
+	// OnScale は予備プロセスの目標数を変更した時に呼ばれます（nil で無効）。
+	OnScale func(ScaleDecision)
+}
+
+// ScaleDecision は予備プロセスの目標数の変更とその根拠です。
+type ScaleDecision struct {
+	From       int           // 変更前の目標数
+	To         int           // 変更後の目標数
+	QueueDepth int           // 直前の間隔で予備プロセスを待ったリクエストの最大数
+	MaxWait    time.Duration // 直前の間隔で予備プロセスを待った最長時間
+}
+
+// StandbyStats は Standby の現在の状態と累計値です。
+type StandbyStats struct {
+	Size      int           // 予備プロセスの目標数
+	Idle      int           // 起動済みで待機中の予備プロセスの数
+	Waiting   int           // 予備プロセスの起動を待っているリクエストの数
+	Queued    int64         // 予備プロセスを待ったリクエストの累計
+	QueueWait time.Duration // 予備プロセスを待った時間の累計
+	Recycled  int64         // MaxIdle を過ぎて起動し直した予備プロセスの累計
+}
+
+// ValidateStandbyConfig は予備プロセスの数の設定を検証します。
+func ValidateStandbyConfig(cfg StandbyConfig) error {
+	if cfg.Min < 0 {
+		return fmt.Errorf("standby min must not be negative: %d", cfg.Min)
+	}
+	if cfg.Max < 1 || cfg.Max < cfg.Min {
+		return fmt.Errorf("standby max must be at least 1 and not less than min: min=%d max=%d", cfg.Min, cfg.Max)
+	}
+	if cfg.ScaleInterval < 0 {
+		return fmt.Errorf("standby scale interval must not be negative: %s", cfg.ScaleInterval)
+	}
+	if cfg.MaxIdle < 0 {
+		return fmt.Errorf("standby max idle must not be negative: %s", cfg.MaxIdle)
+	}
+	return nil
+}
+
+// standbyResult は起動した予備プロセスまたは起動の失敗を待っているリクエストに渡します。
+type standbyResult struct {
+	session *Session
+	err     error
+}
+
+// idleProcess は待機中の予備プロセスと待機を始めた時刻です。
+type idleProcess struct {
+	session *Session
+	since   time.Time
+}
+
+// Standby は起動済みの予備プロセスを保持し、リクエストを起動待ちなしで実行します。
+// 予備プロセスを使うたびに次の予備プロセスをバックグラウンドで起動し、
+// 予備プロセスがない場合は次に起動したものを待ち行列の順に受け取ります。
+// 実行中のプロセスが応答せずに終了した場合は、retry が指定されていれば別の予備プロセスで再実行します。
+// MaxIdle を指定した場合は、長く待機した予備プロセスを新しいものに入れ替えます。
+type Standby struct {
+	executor *Executor
+	cfg      StandbyConfig
+
+	mu       sync.Mutex
+	size     int
+	idle     []idleProcess
+	starting int
+	waiters  []chan standbyResult
+	closed   bool
+
+	// ScaleInterval ごとにリセットする観測値
+	peakWaiting int
+	maxWait     time.Duration
+	minIdle     int
+
+	queued    int64
+	queueWait time.Duration
+	recycled  int64
+
+	workers group // autoscale・recycle と予備プロセスの起動の goroutine
+	stop    chan struct{}
+}
+
+// NewStandby は executor の設定で予備プロセスを起動し続ける Standby を作成します。
+func NewStandby(executor *Executor, cfg StandbyConfig) (*Standby, error) {
+	if err := ValidateStandbyConfig(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.ScaleInterval == 0 {
+		cfg.ScaleInterval = DefaultScaleInterval
+	}
+
+	s := &Standby{
+		executor: executor,
+		cfg:      cfg,
+		size:     cfg.Min,
+		stop:     make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	s.fillLocked()
+	s.mu.Unlock()
+
+	if cfg.Max > cfg.Min {
+		s.workers.Go(func() error { s.autoscale(); return nil })
+	}
+	if cfg.MaxIdle > 0 {
+		s.workers.Go(func() error { s.recycle(); return nil })
+	}
+	return s, nil
+}
+
+// Execute は予備プロセスで input を実行し、最初のレスポンスを返します。
+// Executor.Execute と同じくプロセスが正常に終了するまで待ちます。
+// retry が true の場合、プロセスが失敗すると1度だけ別の予備プロセスで再実行します。
+// 副作用のあるリクエストを2回実行しないよう、retry は安全に再実行できる場合だけ指定してください。
+func (s *Standby) Execute(ctx context.Context, input []byte, retry bool) ([]byte, error) {
+	response, err := s.executeOnce(ctx, input)
+	if err == nil || !retry || ctx.Err() != nil || errors.Is(err, ErrStandbyClosed) {
+		return response, err
+	}
+	if s.executor.logger != nil {
+		s.executor.logger.Warn("Process failed, failing over to standby", "error", err)
+	}
+	return s.executeOnce(ctx, input)
+}
+
+// executeOnce は予備プロセスを1つ取り出して input を実行します。
+func (s *Standby) executeOnce(ctx context.Context, input []byte) ([]byte, error) {
+	session, err := s.take(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := session.Close(); err != nil && s.executor.logger != nil {
+			s.executor.logger.Debug("Failed to close standby process", "error", err)
+		}
+	}()
+
+	if err := session.Send(input); err != nil {
+		return nil, err
+	}
+	if err := session.CloseInput(); err != nil && s.executor.logger != nil {
+		s.executor.logger.Debug("Failed to close stdin", "error", err)
+	}
+
+	response, err := session.Receive(ctx)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	select {
+	case <-session.Exited():
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if err := session.Err(); err != nil {
+		if s.executor.logger != nil {
+			s.executor.logger.Error("Process failed", "stderr", session.Stderr())
+		}
+		return nil, fmt.Errorf("process wait: %w", err)
+	}
+	return response, nil
+}
+
+// take は待機中の予備プロセスを取り出し、代わりの予備プロセスの起動を始めます。
+// 待機中の予備プロセスがない場合は、次に起動したものを受け取るまで待ちます。
+func (s *Standby) take(ctx context.Context) (*Session, error) {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return nil, ErrStandbyClosed
+		}
+		if len(s.idle) == 0 {
+			break
+		}
+		session := s.idle[0].session
+		s.idle = s.idle[1:]
+		s.minIdle = min(s.minIdle, len(s.idle))
+		s.fillLocked()
+		s.mu.Unlock()
+
+		select {
+		case <-session.Exited():
+			if s.executor.logger != nil {
+				s.executor.logger.Warn("Standby process exited while idle", "error", session.Err(), "stderr", session.Stderr())
+			}
+			_ = session.Close()
+		default:
+			return session, nil
+		}
+	}
+
+	// 待ち行列に並び、起動中の予備プロセスを受け取る
+	ch := make(chan standbyResult, 1)
+	s.waiters = append(s.waiters, ch)
+	s.peakWaiting = max(s.peakWaiting, len(s.waiters))
+	s.minIdle = 0
+	s.fillLocked()
+	s.mu.Unlock()
+
+	start := time.Now()
+	select {
+	case result, ok := <-ch:
+		s.observeWait(time.Since(start))
+		if !ok {
+			return nil, ErrStandbyClosed
+		}
+		return result.session, result.err
+	case <-ctx.Done():
+		s.mu.Lock()
+		i := slices.Index(s.waiters, ch)
+		if i >= 0 {
+			s.waiters = slices.Delete(s.waiters, i, i+1)
+		}
+		s.mu.Unlock()
+		if i < 0 {
+			// 取り消しと同時に渡された予備プロセスは次のリクエストのために戻す
+			if result, ok := <-ch; ok && result.session != nil {
+				s.put(result.session)
+			}
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// observeWait は予備プロセスを待った時間を記録します。
+func (s *Standby) observeWait(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxWait = max(s.maxWait, d)
+	s.queued++
+	s.queueWait += d
+}
+
+// fillLocked は待機中・起動中の予備プロセスが目標数と待ち行列の長さに足りるまで起動を始めます。
+// s.mu を保持した状態で呼び出してください。
+func (s *Standby) fillLocked() {
+	if s.closed {
+		return
+	}
+	for need := s.size + len(s.waiters) - len(s.idle) - s.starting; need > 0; need-- {
+		s.starting++
+		s.workers.Go(func() error { s.startOne(); return nil })
+	}
+}
+
+// startOne は予備プロセスを1つ起動し、待っているリクエストに渡すか待機させます。
+func (s *Standby) startOne() {
+	// 予備プロセスは Close で終了させるため、リクエストの ctx には紐付けない
+	session, err := s.executor.Start(context.Background())
+
+	s.mu.Lock()
+	s.starting--
+	if err != nil {
+		if s.executor.logger != nil {
+			s.executor.logger.Warn("Failed to start standby process", "error", err)
+		}
+		// 起動できない場合は再試行を繰り返さず、待っているリクエストに失敗を伝える
+		if len(s.waiters) > 0 {
+			ch := s.waiters[0]
+			s.waiters = s.waiters[1:]
+			ch <- standbyResult{err: err}
+		}
+		s.mu.Unlock()
+		return
+	}
+	if !s.closed && len(s.waiters) > 0 {
+		ch := s.waiters[0]
+		s.waiters = s.waiters[1:]
+		ch <- standbyResult{session: session}
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+	s.put(session)
+}
+
+// put は予備プロセスを待機させます。目標数を超える場合や Close 後は終了させます。
+func (s *Standby) put(session *Session) {
+	s.mu.Lock()
+	if !s.closed && len(s.idle) < s.size {
+		s.idle = append(s.idle, idleProcess{session: session, since: time.Now()})
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+	_ = session.Close()
+}
+
+// autoscale は ScaleInterval ごとに予備プロセスの数を見直します。
+func (s *Standby) autoscale() {
+	ticker := time.NewTicker(s.cfg.ScaleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.scale()
+		}
+	}
+}
+
+// scale は直前の間隔の観測値から予備プロセスの目標数を決めます。
+// 予備プロセスを待ったリクエストがあれば待った数だけ増やし、
+// 待機中の予備プロセスが一度も使い切られなかった場合は1つ減らします。
+func (s *Standby) scale() {
+	s.mu.Lock()
+	decision := ScaleDecision{From: s.size, QueueDepth: s.peakWaiting, MaxWait: s.maxWait}
+	switch {
+	case s.peakWaiting > 0:
+		s.size = min(s.cfg.Max, s.size+s.peakWaiting)
+	case s.minIdle > 0 && s.size > s.cfg.Min:
+		s.size--
+	}
+	decision.To = s.size
+
+	var surplus []idleProcess
+	if len(s.idle) > s.size {
+		surplus = slices.Clone(s.idle[s.size:])
+		s.idle = slices.Delete(s.idle, s.size, len(s.idle))
+	}
+	s.fillLocked()
+
+	s.peakWaiting = len(s.waiters)
+	s.maxWait = 0
+	s.minIdle = len(s.idle)
+	s.mu.Unlock()
+
+	for _, p := range surplus {
+		_ = p.session.Close()
+	}
+	if decision.From != decision.To && s.cfg.OnScale != nil {
+		s.cfg.OnScale(decision)
+	}
+}
+
+// recycle は MaxIdle の半分の間隔で、MaxIdle を過ぎて待機している予備プロセスを入れ替えます。
+func (s *Standby) recycle() {
+	ticker := time.NewTicker(max(s.cfg.MaxIdle/2, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.recycleExpired(time.Now())
+		}
+	}
+}
+
+// recycleExpired は now の時点で MaxIdle を過ぎて待機している予備プロセスを終了させ、代わりの起動を始めます。
+func (s *Standby) recycleExpired(now time.Time) {
+	s.mu.Lock()
+	var expired []idleProcess
+	s.idle = slices.DeleteFunc(s.idle, func(p idleProcess) bool {
+		if now.Sub(p.since) < s.cfg.MaxIdle {
+			return false
+		}
+		expired = append(expired, p)
+		return true
+	})
+	s.recycled += int64(len(expired))
+	s.fillLocked()
+	s.mu.Unlock()
+
+	for _, p := range expired {
+		_ = p.session.Close()
+	}
+	if len(expired) > 0 && s.executor.logger != nil {
+		s.executor.logger.Debug("Recycled idle standby processes", "count", len(expired))
+	}
+}
+
+// Stats は現在の状態と累計値を返します。
+func (s *Standby) Stats() StandbyStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return StandbyStats{
+		Size:      s.size,
+		Idle:      len(s.idle),
+		Waiting:   len(s.waiters),
+		Queued:    s.queued,
+		QueueWait: s.queueWait,
+		Recycled:  s.recycled,
+	}
+}
+
+// Close は予備プロセスを終了させ、以降の実行を拒否します。
+func (s *Standby) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	idle := s.idle
+	s.idle = nil
+	for _, ch := range s.waiters {
+		close(ch)
+	}
+	s.waiters = nil
+	s.mu.Unlock()
+
+	close(s.stop)
+	_ = s.workers.Wait()
+
+	var errs []error
+	for _, p := range idle {
+		errs = append(errs, p.session.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,231 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestStandby はテスト用の Standby を作成します。
+func newTestStandby(t *testing.T, command string, env map[string]string, cfg StandbyConfig, args ...string) *Standby {
+	t.Helper()
+	standby, err := NewStandby(NewExecutor(command, args, env, nil), cfg)
+	if err != nil {
+		t.Fatalf("NewStandby() error = %v", err)
+	}
+	return standby
+}
+
+func TestStandby_Execute(t *testing.T) {
+	standby := newTestStandby(t, "cat", nil, StandbyConfig{Min: 1, Max: 1})
+	defer func() { _ = standby.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 予備プロセスは1回ごとに入れ替わり、続けて実行できる
+	for _, msg := range []string{`{"id":1}`, `{"id":2}`} {
+		got, err := standby.Execute(ctx, []byte(msg), false)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		if string(got) != msg {
+			t.Errorf("Execute() = %s, want %s", got, msg)
+		}
+	}
+}
+
+func TestStandby_Failover(t *testing.T) {
+	// 最初に入力を受け取ったプロセスだけが応答せずに異常終了する
+	script := `read line; if mkdir "$MARKER" 2>/dev/null; then exit 1; fi; echo "$line"`
+
+	tests := []struct {
+		name    string
+		retry   bool
+		wantErr bool
+	}{
+		{name: "再実行可能_予備プロセスで成功", retry: true},
+		{name: "再実行不可_エラー", retry: false, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"MARKER": t.TempDir() + "/failed"}
+			standby := newTestStandby(t, "sh", env, StandbyConfig{Min: 1, Max: 1}, "-c", script)
+			defer func() { _ = standby.Close() }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			got, err := standby.Execute(ctx, []byte(`{"id":1}`), tt.retry)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Execute() = %s, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if string(got) != `{"id":1}` {
+				t.Errorf("Execute() = %s, want %s", got, `{"id":1}`)
+			}
+		})
+	}
+}
+
+func TestStandby_Closed(t *testing.T) {
+	standby := newTestStandby(t, "cat", nil, StandbyConfig{Min: 1, Max: 1})
+	if err := standby.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if _, err := standby.Execute(context.Background(), []byte(`{"id":1}`), true); !errors.Is(err, ErrStandbyClosed) {
+		t.Errorf("Execute() error = %v, want ErrStandbyClosed", err)
+	}
+}
+
+func TestStandby_Scale(t *testing.T) {
+	var mu sync.Mutex
+	var decisions []ScaleDecision
+	standby := newTestStandby(t, "cat", nil, StandbyConfig{
+		Min:           0,
+		Max:           2,
+		ScaleInterval: time.Hour,
+		OnScale: func(d ScaleDecision) {
+			mu.Lock()
+			defer mu.Unlock()
+			decisions = append(decisions, d)
+		},
+	})
+	defer func() { _ = standby.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 予備プロセスがないためリクエストは起動を待ち、待ち行列の長さだけ増やす
+	if _, err := standby.Execute(ctx, []byte(`{"id":1}`), false); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if stats := standby.Stats(); stats.Queued != 1 {
+		t.Errorf("Queued = %d, want 1", stats.Queued)
+	}
+	standby.scale()
+	if stats := standby.Stats(); stats.Size != 1 {
+		t.Fatalf("Size = %d, want 1 after a queued request", stats.Size)
+	}
+
+	// 使われない予備プロセスが残り続けると最小数まで減らす
+	for standby.Stats().Idle != 1 {
+		if ctx.Err() != nil {
+			t.Fatal("standby process did not become idle")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	standby.scale()
+	standby.scale()
+	if stats := standby.Stats(); stats.Size != 0 || stats.Idle != 0 {
+		t.Errorf("stats = %+v, want size 0 and no idle process", stats)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []ScaleDecision{{From: 0, To: 1, QueueDepth: 1}, {From: 1, To: 0}}
+	if len(decisions) != len(want) {
+		t.Fatalf("decisions = %+v, want %+v", decisions, want)
+	}
+	for i, d := range decisions {
+		if d.From != want[i].From || d.To != want[i].To || d.QueueDepth != want[i].QueueDepth {
+			t.Errorf("decisions[%d] = %+v, want %+v", i, d, want[i])
+		}
+	}
+}
+
+func TestStandby_StartFailure(t *testing.T) {
+	standby := newTestStandby(t, "/nonexistent/command", nil, StandbyConfig{Min: 1, Max: 1})
+	defer func() { _ = standby.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 起動できない場合は待ち続けずにエラーを返す
+	if _, err := standby.Execute(ctx, []byte(`{"id":1}`), true); err == nil || ctx.Err() != nil {
+		t.Errorf("Execute() error = %v, want a start error", err)
+	}
+}
+
+// waitIdle は待機中の予備プロセスが want 個になるまで待ちます。
+func waitIdle(t *testing.T, standby *Standby, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for standby.Stats().Idle != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("Idle = %d, want %d", standby.Stats().Idle, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStandby_RecycleIdle(t *testing.T) {
+	standby := newTestStandby(t, "cat", nil, StandbyConfig{Min: 2, Max: 2, MaxIdle: time.Hour})
+	defer func() { _ = standby.Close() }()
+	waitIdle(t, standby, 2)
+
+	standby.mu.Lock()
+	before := []*Session{standby.idle[0].session, standby.idle[1].session}
+	standby.mu.Unlock()
+
+	// MaxIdle を過ぎていない予備プロセスはそのまま
+	standby.recycleExpired(time.Now())
+	if got := standby.Stats().Recycled; got != 0 {
+		t.Errorf("Recycled = %d before MaxIdle, want 0", got)
+	}
+
+	// MaxIdle を過ぎた予備プロセスを終了させ、新しいものを起動する
+	standby.recycleExpired(time.Now().Add(time.Hour))
+	if got := standby.Stats().Recycled; got != 2 {
+		t.Errorf("Recycled = %d, want 2", got)
+	}
+	for _, session := range before {
+		select {
+		case <-session.Exited():
+		case <-time.After(5 * time.Second):
+			t.Fatal("recycled process did not exit")
+		}
+	}
+	waitIdle(t, standby, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if got, err := standby.Execute(ctx, []byte(`{"id":1}`), false); err != nil || string(got) != `{"id":1}` {
+		t.Errorf("Execute() = %s, %v, want the echo", got, err)
+	}
+}
+
+func TestValidateStandbyConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     StandbyConfig
+		wantErr bool
+	}{
+		{name: "固定数", cfg: StandbyConfig{Min: 1, Max: 1}},
+		{name: "0から増減", cfg: StandbyConfig{Min: 0, Max: 4}},
+		{name: "最小数が負_エラー", cfg: StandbyConfig{Min: -1, Max: 1}, wantErr: true},
+		{name: "最大数が0_エラー", cfg: StandbyConfig{Min: 0, Max: 0}, wantErr: true},
+		{name: "最大数が最小数未満_エラー", cfg: StandbyConfig{Min: 3, Max: 2}, wantErr: true},
+		{name: "間隔が負_エラー", cfg: StandbyConfig{Min: 1, Max: 2, ScaleInterval: -time.Second}, wantErr: true},
+		{name: "待機時間の上限", cfg: StandbyConfig{Min: 1, Max: 1, MaxIdle: time.Minute}},
+		{name: "待機時間の上限が負_エラー", cfg: StandbyConfig{Min: 1, Max: 1, MaxIdle: -time.Second}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateStandbyConfig(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateStandbyConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+// wasi はテスト用の WASI モジュールとして動作する MCP サーバーです。
+// リクエストごとに環境変数・引数と /data/hello.txt の内容を返します。
+//
+//	GOOS=wasip1 GOARCH=wasm go build -o wasi.wasm .
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+)
+
+func main() {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			continue
+		}
+		result := map[string]any{
+			"greeting": os.Getenv("GREETING"),
+			"home":     os.Getenv("HOME"),
+			"args":     os.Args[1:],
+		}
+		if data, err := os.ReadFile("/data/hello.txt"); err == nil {
+			result["file"] = string(data)
+		}
+		result["writable"] = os.WriteFile("/data/out.txt", []byte("x"), 0o644) == nil
+		_ = json.NewEncoder(os.Stdout).Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}
+}
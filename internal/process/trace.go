@@ -0,0 +1,178 @@
+package process
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+)
+
+// トレース出力形式
+const (
+	TraceFormatJSON = "json" // 文字列としてそのまま出力
+	TraceFormatHex  = "hex"  // 16進ダンプとして出力
+)
+
+// DefaultTraceMaxBytes は1フレームあたりに出力する最大バイト数のデフォルト値です。
+const DefaultTraceMaxBytes = 4096
+
+// redactMinLength より短い値はマスク対象にしない（"1" などの誤マスク防止）
+const redactMinLength = 4
+
+// maxTracePending はレスポンスのフレームにメソッド名を付けるために覚えておくリクエストの最大数です。
+const maxTracePending = 1024
+
+// TraceConfig は stdio フレームトレースの設定です。
+type TraceConfig struct {
+	Format   string // 出力形式（json/hex）
+	MaxBytes int    // 1フレームあたりの最大出力バイト数（0 以下でデフォルト）
+}
+
+// tracer は stdin/stdout/stderr を流れるフレームをログに出力します。
+type tracer struct {
+	cfg     TraceConfig
+	logger  *slog.Logger
+	secrets [][]byte
+
+	mu      sync.Mutex
+	pending map[string]string // 応答を待っているリクエストの ID からメソッド名
+}
+
+func newTracer(cfg TraceConfig, logger *slog.Logger, env map[string]string) *tracer {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultTraceMaxBytes
+	}
+	if cfg.Format != TraceFormatHex {
+		cfg.Format = TraceFormatJSON
+	}
+
+	// 子プロセスへ渡す環境変数の値はトークン等を含みうるためマスクする
+	secrets := make([][]byte, 0, len(env))
+	for _, v := range env {
+		if len(v) >= redactMinLength {
+			secrets = append(secrets, []byte(v))
+		}
+	}
+
+	return &tracer{cfg: cfg, logger: logger, secrets: secrets, pending: make(map[string]string)}
+}
+
+// frame は1回の読み書きを1フレームとしてログに出力します。
+func (t *tracer) frame(stream string, p []byte) {
+	if t.logger == nil || len(p) == 0 {
+		return
+	}
+
+	data := t.redact(p)
+	truncated := false
+	if len(data) > t.cfg.MaxBytes {
+		data = data[:t.cfg.MaxBytes]
+		truncated = true
+	}
+
+	var rendered string
+	if t.cfg.Format == TraceFormatHex {
+		rendered = hex.EncodeToString(data)
+	} else {
+		rendered = string(data)
+	}
+
+	attrs := []any{
+		"stream", stream,
+		"size", len(p),
+		"truncated", truncated,
+		"format", t.cfg.Format,
+		"data", rendered,
+	}
+	if stream != "stderr" {
+		if method := t.method(p); method != "" {
+			attrs = append(attrs, "method", method)
+		}
+	}
+	t.logger.Info("stdio frame", attrs...)
+}
+
+// method はフレームに含まれる最初の JSON-RPC メッセージのメソッド名を返します。
+// レスポンスには対応するリクエストのメソッド名を返します。行の途中で分かれたフレームなど、解析できない場合は空文字列を返します。
+func (t *tracer) method(p []byte) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	method := ""
+	for line := range bytes.SplitSeq(p, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		msg, err := jsonrpc.Parse(line)
+		if err != nil {
+			continue
+		}
+		name := msg.Method
+		switch {
+		case msg.IsRequest():
+			if len(t.pending) < maxTracePending {
+				t.pending[string(msg.ID)] = msg.Method
+			}
+		case msg.IsResponse():
+			name = t.pending[string(msg.ID)]
+			delete(t.pending, string(msg.ID))
+		}
+		if method == "" {
+			method = name
+		}
+	}
+	return method
+}
+
+func (t *tracer) redact(p []byte) []byte {
+	data := p
+	for _, secret := range t.secrets {
+		if bytes.Contains(data, secret) {
+			data = bytes.ReplaceAll(data, secret, []byte("[REDACTED]"))
+		}
+	}
+	return data
+}
+
+func (t *tracer) writer(stream string, w io.Writer) io.WriteCloser {
+	return &traceWriter{w: w, tracer: t, stream: stream}
+}
+
+func (t *tracer) reader(stream string, r io.ReadCloser) io.ReadCloser {
+	return &traceReader{ReadCloser: r, tracer: t, stream: stream}
+}
+
+type traceWriter struct {
+	w      io.Writer
+	tracer *tracer
+	stream string
+}
+
+func (w *traceWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.tracer.frame(w.stream, p[:n])
+	return n, err
+}
+
+// Close は元の Writer が io.Closer を実装している場合のみクローズします。
+func (w *traceWriter) Close() error {
+	if c, ok := w.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+type traceReader struct {
+	io.ReadCloser
+	tracer *tracer
+	stream string
+}
+
+func (r *traceReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.tracer.frame(r.stream, p[:n])
+	return n, err
+}
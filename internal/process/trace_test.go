@@ -0,0 +1,159 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// traceLogs はトレースログを JSON としてパースして返します。
+func traceLogs(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var logs []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log line: %s", line)
+		}
+		if entry["msg"] == "stdio frame" {
+			logs = append(logs, entry)
+		}
+	}
+	return logs
+}
+
+func TestTracer_Frame(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           TraceConfig
+		env           map[string]string
+		input         string
+		wantData      string
+		wantTruncated bool
+	}{
+		{
+			name:     "JSON形式_そのまま出力される",
+			cfg:      TraceConfig{Format: TraceFormatJSON},
+			input:    `{"jsonrpc":"2.0"}`,
+			wantData: `{"jsonrpc":"2.0"}`,
+		},
+		{
+			name:     "HEX形式_16進で出力される",
+			cfg:      TraceConfig{Format: TraceFormatHex},
+			input:    "ab",
+			wantData: "6162",
+		},
+		{
+			name:          "最大バイト数超過_切り詰められる",
+			cfg:           TraceConfig{Format: TraceFormatJSON, MaxBytes: 3},
+			input:         "abcdef",
+			wantData:      "abc",
+			wantTruncated: true,
+		},
+		{
+			name:     "環境変数の値を含むフレーム_マスクされる",
+			cfg:      TraceConfig{},
+			env:      map[string]string{"TOKEN": "xoxp-secret", "SHORT": "1"},
+			input:    "token=xoxp-secret id=1",
+			wantData: "token=[REDACTED] id=1",
+		},
+		{
+			name:     "不明な形式_JSON形式として扱われる",
+			cfg:      TraceConfig{Format: "unknown"},
+			input:    "abc",
+			wantData: "abc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+			tr := newTracer(tt.cfg, logger, tt.env)
+			tr.frame("stdout", []byte(tt.input))
+
+			logs := traceLogs(t, &buf)
+			if len(logs) != 1 {
+				t.Fatalf("log count = %d, want 1", len(logs))
+			}
+			if logs[0]["data"] != tt.wantData {
+				t.Errorf("data = %v, want %v", logs[0]["data"], tt.wantData)
+			}
+			if logs[0]["truncated"] != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", logs[0]["truncated"], tt.wantTruncated)
+			}
+			if logs[0]["size"] != float64(len(tt.input)) {
+				t.Errorf("size = %v, want %d", logs[0]["size"], len(tt.input))
+			}
+		})
+	}
+}
+
+func TestTracer_Frame_EmptyOrNilLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	newTracer(TraceConfig{}, logger, nil).frame("stdin", nil)
+	newTracer(TraceConfig{}, nil, nil).frame("stdin", []byte("data"))
+
+	if buf.Len() != 0 {
+		t.Errorf("expected no logs, got %s", buf.String())
+	}
+}
+
+func TestExecutor_Execute_WithTrace(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	executor := NewExecutor("sh", []string{"-c", "read line && echo \"$line\" && echo err >&2"},
+		map[string]string{}, logger, WithTrace(TraceConfig{}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := executor.Execute(ctx, []byte("hello")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	streams := make(map[string]bool)
+	for _, entry := range traceLogs(t, &buf) {
+		streams[entry["stream"].(string)] = true
+	}
+	for _, stream := range []string{"stdin", "stdout", "stderr"} {
+		if !streams[stream] {
+			t.Errorf("stream %s was not traced (logs: %s)", stream, buf.String())
+		}
+	}
+}
+
+func TestTracer_FrameMethod(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	tr := newTracer(TraceConfig{}, logger, nil)
+
+	tr.frame("stdin", []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{}}`+"\n"))
+	tr.frame("stdin", []byte(`{"jsonrpc":"2.0","method":"notifications/cancelled"}`+"\n"))
+	tr.frame("stdout", []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`+"\n"))
+	tr.frame("stdout", []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`+"\n"))
+	tr.frame("stdout", []byte(`{"jsonrpc":`))
+
+	// レスポンスにはリクエストのメソッド名を付け、対応するリクエストがない・解析できないフレームには付けない
+	want := []any{"tools/call", "notifications/cancelled", "tools/call", nil, nil}
+	logs := traceLogs(t, &buf)
+	if len(logs) != len(want) {
+		t.Fatalf("log count = %d, want %d", len(logs), len(want))
+	}
+	for i, entry := range logs {
+		if entry["method"] != want[i] {
+			t.Errorf("frame %d method = %v, want %v", i, entry["method"], want[i])
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package process
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/experimental/sock"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// Mount は WASI モジュールに公開するホストのディレクトリです。
+type Mount struct {
+	HostPath  string
+	GuestPath string
+	ReadOnly  bool
+}
+
+// ParseMount は "host[:guest][:ro]" 形式のマウント指定を解析します。
+// guest を省略した場合はホストと同じパスに公開します。
+func ParseMount(s string) (Mount, error) {
+	parts := strings.Split(s, ":")
+	var m Mount
+	if n := len(parts); n > 1 && parts[n-1] == "ro" {
+		m.ReadOnly = true
+		parts = parts[:n-1]
+	}
+	if len(parts) > 2 || parts[0] == "" {
+		return Mount{}, fmt.Errorf("invalid WASI mount %q: want host[:guest][:ro]", s)
+	}
+	m.HostPath = parts[0]
+	m.GuestPath = parts[0]
+	if len(parts) == 2 && parts[1] != "" {
+		m.GuestPath = parts[1]
+	}
+	if !strings.HasPrefix(m.GuestPath, "/") {
+		return Mount{}, fmt.Errorf("invalid WASI mount %q: guest path must be absolute", s)
+	}
+	info, err := os.Stat(m.HostPath)
+	if err != nil {
+		return Mount{}, fmt.Errorf("WASI mount: %w", err)
+	}
+	if !info.IsDir() {
+		return Mount{}, fmt.Errorf("WASI mount %s is not a directory", m.HostPath)
+	}
+	return m, nil
+}
+
+// WASIConfig は WASI モジュールに与える権限です。
+// 指定しないファイルシステムとネットワークにはアクセスできません。
+type WASIConfig struct {
+	Mounts []Mount // 公開するディレクトリ
+	// Listeners はモジュールが sock_accept で接続を受け付ける TCP のアドレス（"host:port"）です。
+	// WASI preview1 には外部への接続がないため、モジュールから外部には接続できません。
+	Listeners []string
+}
+
+// WASIRuntime は MCP サーバーを WASI モジュールとして実行する組み込みランタイムです。
+// コンパイル済みのモジュールをパスごとに保持し、複数の Executor から同時に使用できます。
+type WASIRuntime struct {
+	runtime   wazero.Runtime
+	fs        wazero.FSConfig
+	listeners []tcpListener
+
+	mu      sync.Mutex
+	modules map[string]compiledModule
+}
+
+// tcpListener はモジュールが接続を受け付ける TCP のアドレスです。
+type tcpListener struct {
+	host string
+	port int
+}
+
+// compiledModule はコンパイル済みのモジュールと、コンパイル時のファイルの更新時刻です。
+type compiledModule struct {
+	module  wazero.CompiledModule
+	modTime time.Time
+}
+
+// NewWASIRuntime は cfg の権限で WASI モジュールを実行するランタイムを作成します。
+func NewWASIRuntime(ctx context.Context, cfg WASIConfig) (*WASIRuntime, error) {
+	fsConfig := wazero.NewFSConfig()
+	for _, m := range cfg.Mounts {
+		if m.ReadOnly {
+			fsConfig = fsConfig.WithReadOnlyDirMount(m.HostPath, m.GuestPath)
+		} else {
+			fsConfig = fsConfig.WithDirMount(m.HostPath, m.GuestPath)
+		}
+	}
+	var listeners []tcpListener
+	for _, addr := range cfg.Listeners {
+		host, portStr, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WASI listener %q: %w", addr, err)
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port < 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid WASI listener %q: invalid port", addr)
+		}
+		listeners = append(listeners, tcpListener{host: host, port: port})
+	}
+
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		_ = r.Close(ctx)
+		return nil, fmt.Errorf("instantiate WASI: %w", err)
+	}
+	return &WASIRuntime{
+		runtime:   r,
+		fs:        fsConfig,
+		listeners: listeners,
+		modules:   make(map[string]compiledModule),
+	}, nil
+}
+
+// Close は実行中の全てのモジュールを終了し、ランタイムを破棄します。
+func (r *WASIRuntime) Close(ctx context.Context) error {
+	return r.runtime.Close(ctx)
+}
+
+// compile は path のモジュールをコンパイルします。ファイルが更新されていなければ前回の結果を使います。
+func (r *WASIRuntime) compile(ctx context.Context, path string) (wazero.CompiledModule, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("WASI module: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cached, ok := r.modules[path]; ok {
+		if cached.modTime.Equal(info.ModTime()) {
+			return cached.module, nil
+		}
+		_ = cached.module.Close(ctx)
+		delete(r.modules, path)
+	}
+	wasm, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read WASI module: %w", err)
+	}
+	module, err := r.runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		return nil, fmt.Errorf("compile WASI module %s: %w", path, err)
+	}
+	r.modules[path] = compiledModule{module: module, modTime: info.ModTime()}
+	return module, nil
+}
+
+// WithWASI はコマンドを r で WASI モジュールとして実行します。コマンドはモジュールのパスです。
+// 環境変数はホストから引き継がず、Executor に渡したものだけを設定します。
+func WithWASI(r *WASIRuntime) Option {
+	return func(e *Executor) {
+		e.wasi = r
+	}
+}
+
+// wasiCommand は WASI モジュールのインスタンスを command として実行します。
+type wasiCommand struct {
+	runtime *WASIRuntime
+	ctx     context.Context
+	cancel  context.CancelFunc
+	path    string
+	args    []string
+	env     []string
+	mount   string // 同じパスに公開する作業ディレクトリ
+
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+	stdinR  *io.PipeReader // StdinPipe の読み取り側（終了後に閉じて書き込みを失敗させる）
+	stdoutR *io.PipeReader // StdoutPipe の読み取り側
+	stdoutW *io.PipeWriter // StdoutPipe の書き込み側（終了後に閉じて読み取りを終了させる）
+
+	done chan struct{}
+	err  error
+}
+
+func (r *WASIRuntime) command(ctx context.Context, path string, args, env []string, mount string) *wasiCommand {
+	ctx, cancel := context.WithCancel(ctx)
+	return &wasiCommand{runtime: r, ctx: ctx, cancel: cancel, path: path, args: args, env: env, mount: mount}
+}
+
+func (c *wasiCommand) StdinPipe() (io.WriteCloser, error) {
+	pr, pw := io.Pipe()
+	c.stdin, c.stdinR = pr, pr
+	return pw, nil
+}
+
+func (c *wasiCommand) StdoutPipe() (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	c.stdout, c.stdoutR, c.stdoutW = pw, pr, pw
+	return pr, nil
+}
+
+func (c *wasiCommand) SetStdout(w io.Writer) { c.stdout = w }
+
+func (c *wasiCommand) SetStderr(w io.Writer) { c.stderr = w }
+
+func (c *wasiCommand) Start() error {
+	compiled, err := c.runtime.compile(c.ctx, c.path)
+	if err != nil {
+		c.cancel()
+		return err
+	}
+
+	fsConfig := c.runtime.fs
+	if c.mount != "" {
+		fsConfig = fsConfig.WithDirMount(c.mount, c.mount)
+	}
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(append([]string{filepath.Base(c.path)}, c.args...)...).
+		WithFSConfig(fsConfig).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithSysNanosleep().
+		WithRandSource(rand.Reader)
+	for _, kv := range c.env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			config = config.WithEnv(k, v)
+		}
+	}
+	if c.stdin != nil {
+		config = config.WithStdin(c.stdin)
+	}
+	if c.stdout != nil {
+		config = config.WithStdout(c.stdout)
+	}
+	if c.stderr != nil {
+		config = config.WithStderr(c.stderr)
+	}
+
+	ctx := c.ctx
+	if len(c.runtime.listeners) > 0 {
+		sockConfig := sock.NewConfig()
+		for _, l := range c.runtime.listeners {
+			sockConfig = sockConfig.WithTCPListener(l.host, l.port)
+		}
+		ctx = sock.WithConfig(ctx, sockConfig)
+	}
+
+	c.done = make(chan struct{})
+	spawn(func() {
+		defer close(c.done)
+		mod, err := c.runtime.runtime.InstantiateModule(ctx, compiled, config)
+		if mod != nil {
+			_ = mod.Close(context.WithoutCancel(ctx))
+		}
+		c.err = exitError(err)
+		c.cancel()
+		// 終了後は stdin への書き込みを失敗させ、stdout の読み取りを終了させる
+		if c.stdinR != nil {
+			_ = c.stdinR.CloseWithError(io.ErrClosedPipe)
+		}
+		if c.stdoutW != nil {
+			_ = c.stdoutW.Close()
+		}
+	})
+	return nil
+}
+
+func (c *wasiCommand) Wait() error {
+	// exec.Cmd と同様に、読み取りを終えた stdout を閉じてモジュールの書き込みがブロックし続けないようにする
+	if c.stdoutR != nil {
+		_ = c.stdoutR.CloseWithError(io.ErrClosedPipe)
+	}
+	<-c.done
+	return c.err
+}
+
+// Terminate はシグナルを受け取れないモジュールを Kill と同じく停止させます。
+func (c *wasiCommand) Terminate() error {
+	return c.Kill()
+}
+
+func (c *wasiCommand) Kill() error {
+	c.cancel()
+	return nil
+}
+
+// CPUTime はアダプターのプロセス内で実行するモジュールの CPU 時間を区別できないため、常に false を返します。
+func (c *wasiCommand) CPUTime() (time.Duration, bool) {
+	return 0, false
+}
+
+// exitError はモジュールの実行結果を終了コードが分かるエラーに変換します。終了コード 0 は成功です。
+func exitError(err error) error {
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) {
+		if exitErr.ExitCode() == 0 {
+			return nil
+		}
+		return fmt.Errorf("WASI module exited with code %d", exitErr.ExitCode())
+	}
+	return err
+}
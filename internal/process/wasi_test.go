@@ -0,0 +1,209 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	wasiOnce sync.Once
+	wasiDir  string
+	wasiPath string
+	wasiErr  error
+)
+
+func TestMain(m *testing.M) {
+	runFakeFirecrackerIfRequested()
+	code := m.Run()
+	if code == 0 {
+		if err := checkGoroutineLeaks(goroutineLeakTimeout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+		}
+	}
+	if wasiDir != "" {
+		_ = os.RemoveAll(wasiDir)
+	}
+	os.Exit(code)
+}
+
+// buildWASI は testdata/wasi を wasip1 向けにビルドし、WebAssembly モジュールのパスを返します。
+func buildWASI(t *testing.T) string {
+	t.Helper()
+	wasiOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "tumiki-wasi")
+		if err != nil {
+			wasiErr = err
+			return
+		}
+		wasiDir = dir
+		wasiPath = filepath.Join(dir, "wasi.wasm")
+		cmd := exec.Command(filepath.Join(runtime.GOROOT(), "bin", "go"), "build", "-o", wasiPath, ".")
+		cmd.Dir = filepath.Join("testdata", "wasi")
+		cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			wasiErr = err
+			wasiPath = string(out)
+		}
+	})
+	if wasiErr != nil {
+		t.Fatalf("build WASI module: %v\n%s", wasiErr, wasiPath)
+	}
+	return wasiPath
+}
+
+// newWASIRuntime は hello.txt を置いたディレクトリを /data に公開するランタイムを作成します。
+func newWASIRuntime(t *testing.T, readOnly bool) (*WASIRuntime, string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewWASIRuntime(context.Background(), WASIConfig{Mounts: []Mount{{HostPath: dir, GuestPath: "/data", ReadOnly: readOnly}}})
+	if err != nil {
+		t.Fatalf("NewWASIRuntime() error = %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close(context.Background()) })
+	return r, dir
+}
+
+type wasiResult struct {
+	Result struct {
+		Greeting string   `json:"greeting"`
+		Home     string   `json:"home"`
+		Args     []string `json:"args"`
+		File     string   `json:"file"`
+		Writable bool     `json:"writable"`
+	} `json:"result"`
+}
+
+func TestExecutor_WASI_Execute(t *testing.T) {
+	path := buildWASI(t)
+	t.Setenv("HOME", "/root")
+
+	tests := []struct {
+		name     string
+		readOnly bool
+		wantFile bool
+	}{
+		{name: "読み取り専用のマウント_読み取りのみ可能", readOnly: true},
+		{name: "書き込み可能なマウント_書き込める", wantFile: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, dir := newWASIRuntime(t, tt.readOnly)
+			e := NewExecutor(path, []string{"--mode", "test"}, map[string]string{"GREETING": "hi"}, slog.Default(), WithWASI(r))
+
+			response, err := e.Execute(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			var got wasiResult
+			if err := json.Unmarshal(response, &got); err != nil {
+				t.Fatalf("response %s: %v", response, err)
+			}
+			if got.Result.Greeting != "hi" || got.Result.File != "hello" || !reflect.DeepEqual(got.Result.Args, []string{"--mode", "test"}) {
+				t.Errorf("result = %+v, want the configured env, args and mounted file", got.Result)
+			}
+			// ホストの環境変数は引き継がない
+			if got.Result.Home != "" {
+				t.Errorf("HOME = %q, want empty", got.Result.Home)
+			}
+			if got.Result.Writable != tt.wantFile {
+				t.Errorf("writable = %v, want %v", got.Result.Writable, tt.wantFile)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "out.txt")); (err == nil) != tt.wantFile {
+				t.Errorf("out.txt exists = %v, want %v", err == nil, tt.wantFile)
+			}
+		})
+	}
+}
+
+func TestExecutor_WASI_Session(t *testing.T) {
+	r, _ := newWASIRuntime(t, true)
+	e := NewExecutor(buildWASI(t), nil, nil, slog.Default(), WithWASI(r))
+
+	session, err := e.Start(context.Background())
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, id := range []string{"1", "2"} {
+		if err := session.Send([]byte(`{"jsonrpc":"2.0","id":` + id + `,"method":"ping"}`)); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		msg, err := session.Receive(ctx)
+		if err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		var got struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if err := json.Unmarshal(msg, &got); err != nil || string(got.ID) != id {
+			t.Errorf("response = %s, want id %s", msg, id)
+		}
+	}
+
+	if err := session.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if err := session.Err(); err != nil {
+		t.Errorf("Err() = %v, want a clean exit after stdin is closed", err)
+	}
+}
+
+func TestExecutor_WASI_ModuleNotFound(t *testing.T) {
+	r, _ := newWASIRuntime(t, true)
+	e := NewExecutor(filepath.Join(t.TempDir(), "missing.wasm"), nil, nil, slog.Default(), WithWASI(r))
+	if _, err := e.Execute(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)); err == nil {
+		t.Error("Execute() expected error for a missing module")
+	}
+}
+
+func TestParseMount(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		spec    string
+		want    Mount
+		wantErr bool
+	}{
+		{name: "ホストのみ_同じパスに公開", spec: dir, want: Mount{HostPath: dir, GuestPath: dir}},
+		{name: "ゲストのパスを指定_そのパスに公開", spec: dir + ":/data", want: Mount{HostPath: dir, GuestPath: "/data"}},
+		{name: "読み取り専用", spec: dir + ":/data:ro", want: Mount{HostPath: dir, GuestPath: "/data", ReadOnly: true}},
+		{name: "ホストのみで読み取り専用", spec: dir + ":ro", want: Mount{HostPath: dir, GuestPath: dir, ReadOnly: true}},
+		{name: "相対パスのゲスト_エラー", spec: dir + ":data", wantErr: true},
+		{name: "存在しないディレクトリ_エラー", spec: filepath.Join(dir, "missing") + ":/data", wantErr: true},
+		{name: "ファイル_エラー", spec: file + ":/data", wantErr: true},
+		{name: "要素が多すぎる_エラー", spec: dir + ":/a:/b:ro", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMount(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseMount() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultWorkspaceEnv は作業ディレクトリのパスを渡す環境変数のデフォルトの名前です。
+const DefaultWorkspaceEnv = "MCP_WORKSPACE"
+
+// WorkspacePlaceholder は引数の中で作業ディレクトリのパスに置き換える文字列です。
+const WorkspacePlaceholder = "{workspace}"
+
+// workspaceCheckInterval は作業ディレクトリの使用量を確認する間隔です。
+const workspaceCheckInterval = 500 * time.Millisecond
+
+// ErrWorkspaceQuota は作業ディレクトリの使用量が上限を超えたためプロセスを終了したことを表します。
+var ErrWorkspaceQuota = errors.New("workspace quota exceeded")
+
+// WorkspaceConfig はプロセスごとに作成する一時的な作業ディレクトリの設定です。
+type WorkspaceConfig struct {
+	Dir      string // 作業ディレクトリを作成するディレクトリ（空文字列で os.TempDir）
+	Env      string // パスを渡す環境変数（空文字列で DefaultWorkspaceEnv）
+	MaxBytes int64  // 使用量の上限（0 以下で無制限）
+}
+
+// WithWorkspace はプロセスごとに作業ディレクトリを作成し、プロセスの終了後に削除します。
+// パスは環境変数と、引数の WorkspacePlaceholder で渡します。
+// 1回のリクエストで終了するプロセスではリクエストごと、起動し続けるプロセスではセッションごとのディレクトリになります。
+func WithWorkspace(cfg WorkspaceConfig) Option {
+	return func(e *Executor) {
+		e.workspace = &cfg
+	}
+}
+
+// workspaceCommand は作業ディレクトリの使用量を監視し、終了後に作業ディレクトリを削除する command です。
+type workspaceCommand struct {
+	command
+	dir      string
+	maxBytes int64
+
+	stop     chan struct{}
+	exceeded atomic.Bool
+}
+
+// newWorkspaceCommand は作業ディレクトリを作成し、そのパスを環境変数と引数に設定したコマンドを作成します。
+func (e *Executor) newWorkspaceCommand(ctx context.Context) (command, error) {
+	cfg := e.workspace
+	dir, err := os.MkdirTemp(cfg.Dir, "tumiki-workspace")
+	if err != nil {
+		return nil, fmt.Errorf("create workspace: %w", err)
+	}
+
+	envName := cfg.Env
+	if envName == "" {
+		envName = DefaultWorkspaceEnv
+	}
+	inner := *e
+	inner.workspace = nil
+	inner.workspaceDir = dir
+	inner.env = make(map[string]string, len(e.env)+1)
+	for k, v := range e.env {
+		inner.env[k] = v
+	}
+	inner.env[envName] = dir
+	inner.args = make([]string, len(e.args))
+	for i, arg := range e.args {
+		inner.args[i] = strings.ReplaceAll(arg, WorkspacePlaceholder, dir)
+	}
+
+	cmd, err := inner.newCommand(ctx)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	return &workspaceCommand{
+		command:  cmd,
+		dir:      dir,
+		maxBytes: cfg.MaxBytes,
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+func (c *workspaceCommand) Start() error {
+	if err := c.command.Start(); err != nil {
+		_ = os.RemoveAll(c.dir)
+		return err
+	}
+	if c.maxBytes > 0 {
+		spawn(c.watch)
+	}
+	return nil
+}
+
+func (c *workspaceCommand) Wait() error {
+	err := c.command.Wait()
+	close(c.stop)
+	if removeErr := os.RemoveAll(c.dir); removeErr != nil && err == nil {
+		err = fmt.Errorf("remove workspace: %w", removeErr)
+	}
+	if c.exceeded.Load() {
+		return fmt.Errorf("%w: more than %d bytes in %s", ErrWorkspaceQuota, c.maxBytes, c.dir)
+	}
+	return err
+}
+
+// watch は作業ディレクトリの使用量が上限を超えた時点でプロセスを強制終了します。
+func (c *workspaceCommand) watch() {
+	ticker := time.NewTicker(workspaceCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+		if dirSize(c.dir) > c.maxBytes {
+			c.exceeded.Store(true)
+			_ = c.command.Kill()
+			return
+		}
+	}
+}
+
+// dirSize は dir 以下の通常ファイルの合計サイズを返します。読み取れないファイルは数えません。
+func dirSize(dir string) int64 {
+	var size int64
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,73 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecutor_Workspace(t *testing.T) {
+	parent := t.TempDir()
+	e := NewExecutor("sh", []string{"-c", `read line; echo data > "$MCP_WORKSPACE/file"; echo "{\"jsonrpc\":\"2.0\",\"id\":1,\"result\":{\"env\":\"$MCP_WORKSPACE\",\"arg\":\"$0\",\"file\":\"$(cat "$MCP_WORKSPACE/file")\"}}"`, "--dir={workspace}"},
+		nil, slog.Default(), WithWorkspace(WorkspaceConfig{Dir: parent}))
+
+	response, err := e.Execute(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	got := string(response)
+	if !strings.Contains(got, `"env":"`+parent) || !strings.Contains(got, `"arg":"--dir=`+parent) || !strings.Contains(got, `"file":"data"`) {
+		t.Errorf("response = %s, want the workspace path in env and args", got)
+	}
+
+	// 終了後は作業ディレクトリを削除する
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("workspace parent has %d entries after the run, want 0", len(entries))
+	}
+}
+
+func TestExecutor_WorkspaceQuota(t *testing.T) {
+	parent := t.TempDir()
+	e := NewExecutor("sh", []string{"-c", `head -c 4096 /dev/zero > "$SCRATCH/big"; exec sleep 5`}, nil, slog.Default(),
+		WithWorkspace(WorkspaceConfig{Dir: parent, Env: "SCRATCH", MaxBytes: 1024}))
+
+	start := time.Now()
+	_, err := e.Execute(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	if !errors.Is(err, ErrWorkspaceQuota) {
+		t.Fatalf("Execute() error = %v, want %v", err, ErrWorkspaceQuota)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("Execute() took %v, want the process killed when the quota is exceeded", elapsed)
+	}
+	if entries, _ := os.ReadDir(parent); len(entries) != 0 {
+		t.Errorf("workspace parent has %d entries after the run, want 0", len(entries))
+	}
+}
+
+func TestExecutor_WorkspacePerSession(t *testing.T) {
+	parent := t.TempDir()
+	e := NewExecutor("cat", nil, nil, slog.Default(), WithWorkspace(WorkspaceConfig{Dir: parent}))
+
+	session, err := e.Start(context.Background())
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if entries, _ := os.ReadDir(parent); len(entries) != 1 {
+		t.Errorf("workspace parent has %d entries while the session runs, want 1", len(entries))
+	}
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+	<-session.Exited()
+	if entries, _ := os.ReadDir(parent); len(entries) != 0 {
+		t.Errorf("workspace parent has %d entries after Close, want 0", len(entries))
+	}
+}
@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// adminPathPrefix は管理 API のパスのプレフィックスです。
+// 管理 API はレプリカ間の転送やレート制限の対象にせず、リクエストを受けたレプリカで処理します。
+const adminPathPrefix = "/admin/"
+
+// newAdminHandler は管理 API のハンドラーを作成します。
+func (s *Server) newAdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/backends", s.handleListBackends)
+	mux.HandleFunc("PUT /admin/backends/{version}", s.handleRegisterBackend)
+	mux.HandleFunc("POST /admin/backends/{version}/activate", s.handleActivateBackend)
+	mux.HandleFunc("POST /admin/backends/rollback", s.handleRollbackBackend)
+	if s.cfg.APIKeys != nil {
+		mux.HandleFunc("GET /admin/keys", s.handleListAPIKeys)
+		mux.HandleFunc("POST /admin/keys", s.handleCreateAPIKey)
+		mux.HandleFunc("DELETE /admin/keys/{id}", s.handleRevokeAPIKey)
+		mux.HandleFunc("PUT /admin/keys/{id}/env", s.handleSetAPIKeyEnv)
+	}
+	if s.usage != nil {
+		mux.HandleFunc("GET /admin/usage", s.handleUsage)
+	}
+	if s.cache != nil {
+		mux.HandleFunc("DELETE /admin/cache", s.handlePurgeCache)
+	}
+	if s.gossip != nil {
+		mux.HandleFunc("POST "+gossipPath, s.handleGossip)
+		mux.HandleFunc("GET /admin/cluster", s.handleClusterStatus)
+	}
+	return s.adminAuth(mux)
+}
+
+// adminAuth は Authorization ヘッダーの Bearer トークンを検証します。
+func (s *Server) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// backendStatus は管理 API が返すバックエンドの一覧です。
+type backendStatus struct {
+	Active   string               `json:"active"`
+	Previous string               `json:"previous,omitempty"`
+	Backends []backendWithSession `json:"backends"`
+}
+
+// backendWithSession はコマンドと、そのバージョンで起動したまま残っているセッションの数です。
+type backendWithSession struct {
+	Backend
+	Sessions int `json:"sessions"`
+}
+
+func (s *Server) handleListBackends(w http.ResponseWriter, _ *http.Request) {
+	s.writeBackendStatus(w)
+}
+
+func (s *Server) handleRegisterBackend(w http.ResponseWriter, r *http.Request) {
+	var backend Backend
+	if err := json.NewDecoder(r.Body).Decode(&backend); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	backend.Version = r.PathValue("version")
+	if backend.Runtime == process.RuntimeFirecracker && s.cfg.MicroVM == nil {
+		http.Error(w, errMicroVMNotConfigured.Error(), http.StatusBadRequest)
+		return
+	}
+	if backend.EgressProxyAllow != nil && s.egress == nil {
+		http.Error(w, errEgressNotEnabled.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.egress != nil {
+		if err := validateEgressRuntime(backend.Runtime); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := s.backends.register(backend); err != nil {
+		if errors.Is(err, errBackendActive) {
+			http.Error(w, "Cannot replace the active backend version", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.logger.Info("Registered backend", "version", backend.Version, "command", backend.Command)
+	s.prefetchLaunchers(context.Background(), []Backend{backend})
+	s.writeBackendStatus(w)
+}
+
+func (s *Server) handleActivateBackend(w http.ResponseWriter, r *http.Request) {
+	version := r.PathValue("version")
+	switched, err := s.backends.activate(version)
+	if err != nil {
+		http.Error(w, "Backend version not found", http.StatusNotFound)
+		return
+	}
+	if switched {
+		s.logger.Info("Switched backend", "version", version)
+		s.drainBackend()
+	}
+	s.writeBackendStatus(w)
+}
+
+func (s *Server) handleRollbackBackend(w http.ResponseWriter, _ *http.Request) {
+	version, err := s.backends.rollback()
+	if err != nil {
+		http.Error(w, "No previous backend version to roll back to", http.StatusConflict)
+		return
+	}
+	s.logger.Info("Rolled back backend", "version", version)
+	s.drainBackend()
+	s.writeBackendStatus(w)
+}
+
+// drainBackend は切り替え前のバージョンの予備プロセス・再利用しているプロセス・共有プロセスを終了させます。
+// 処理中のリクエストとロングポーリングのセッションは切り替え前のプロセスのまま完了を待ちます。
+func (s *Server) drainBackend() {
+	if s.standby != nil {
+		s.standby.drain()
+	}
+	if s.reuse != nil {
+		s.reuse.Drain()
+	}
+	if s.shared != nil {
+		s.shared.Drain()
+	}
+}
+
+// writeBackendStatus は登録済みのバックエンドとバージョンごとのセッション数を返します。
+func (s *Server) writeBackendStatus(w http.ResponseWriter) {
+	active, previous, list := s.backends.snapshot()
+
+	var sessions map[string]int
+	if s.polls != nil {
+		sessions = s.polls.countByVersion()
+	}
+
+	status := backendStatus{Active: active, Previous: previous}
+	for _, backend := range list {
+		status.Backends = append(status.Backends, backendWithSession{Backend: backend, Sessions: sessions[backend.Version]})
+	}
+	s.writeJSON(w, status)
+}
+
+// writeJSON は v を JSON として返します。
+func (s *Server) writeJSON(w http.ResponseWriter, v any) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		s.logger.Error("Response processing failed", "error", err)
+		http.Error(w, "Response processing failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(response); err != nil {
+		s.logger.Debug("Failed to write response", "error", err)
+	}
+}
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+const testAdminToken = "secret"
+
+// newAdminServer は管理 API とロングポーリングを有効にした Server を作成します。
+func newAdminServer(t *testing.T, command string, args []string) *Server {
+	t.Helper()
+	server, err := NewServer(&Config{
+		Command:          command,
+		Args:             args,
+		DefaultEnv:       map[string]string{},
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+		LongPoll:         true,
+		AdminToken:       testAdminToken,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	server.polls.wait = 500 * time.Millisecond
+	t.Cleanup(server.polls.close)
+	return server
+}
+
+func adminRequest(t *testing.T, server *Server, method, path, body string) (*httptest.ResponseRecorder, backendStatus) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	var status backendStatus
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+			t.Fatalf("response is not a backend status: %s", w.Body.String())
+		}
+	}
+	return w, status
+}
+
+// mcpResult は POST /mcp のレスポンスボディを返します。
+func mcpResult(t *testing.T, server *Server) string {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /mcp status = %d, want %d (body: %s)", w.Code, http.StatusOK, w.Body.String())
+	}
+	return w.Body.String()
+}
+
+func TestAdmin_BlueGreenSwap(t *testing.T) {
+	blue := `read line; echo '{"jsonrpc":"2.0","id":1,"result":{"version":"blue"}}'`
+	green := `read line; echo '{"jsonrpc":"2.0","id":1,"result":{"version":"green"}}'`
+	server := newAdminServer(t, "sh", []string{"-c", blue})
+
+	// 切り替え前に作成したセッションは古いバージョンのプロセスのまま残る
+	w := pollPost(t, server, "", `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("poll POST status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+
+	body, _ := json.Marshal(Backend{Command: "sh", Args: []string{"-c", green}})
+	if w, _ := adminRequest(t, server, "PUT", "/admin/backends/green", string(body)); w.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d, want %d (body: %s)", w.Code, http.StatusOK, w.Body.String())
+	}
+	// 登録しただけでは切り替わらない
+	if got := mcpResult(t, server); !strings.Contains(got, "blue") {
+		t.Errorf("response before activation = %s, want blue", got)
+	}
+
+	w, status := adminRequest(t, server, "POST", "/admin/backends/green/activate", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("activate status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if status.Active != "green" || status.Previous != DefaultBackendVersion {
+		t.Errorf("status = %+v, want green active and default previous", status)
+	}
+	if len(status.Backends) != 2 || status.Backends[0].Version != DefaultBackendVersion || status.Backends[0].Sessions != 1 {
+		t.Errorf("backends = %+v, want the default version to keep its session", status.Backends)
+	}
+	if got := mcpResult(t, server); !strings.Contains(got, "green") {
+		t.Errorf("response after activation = %s, want green", got)
+	}
+
+	// 有効なバージョンは置き換えられない
+	if w, _ := adminRequest(t, server, "PUT", "/admin/backends/green", string(body)); w.Code != http.StatusConflict {
+		t.Errorf("PUT active status = %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	// ロールバックで直前のバージョンに戻る
+	w, status = adminRequest(t, server, "POST", "/admin/backends/rollback", "")
+	if w.Code != http.StatusOK || status.Active != DefaultBackendVersion || status.Previous != "green" {
+		t.Fatalf("rollback = %d %+v, want default active", w.Code, status)
+	}
+	if got := mcpResult(t, server); !strings.Contains(got, "blue") {
+		t.Errorf("response after rollback = %s, want blue", got)
+	}
+}
+
+func TestAdmin_ContainerBackend(t *testing.T) {
+	// 受け取った引数を返す podman を PATH に置く
+	dir := t.TempDir()
+	script := "#!/bin/sh\nread line\nprintf '{\"jsonrpc\":\"2.0\",\"id\":1,\"result\":{\"args\":\"%s\"}}\\n' \"$*\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "podman"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	server := newAdminServer(t, "sh", []string{"-c", `read line; echo '{"jsonrpc":"2.0","id":1,"result":{}}'`})
+
+	body, _ := json.Marshal(Backend{Command: "example/server:2", Args: []string{"--stdio"}, Runtime: process.RuntimePodman})
+	if w, _ := adminRequest(t, server, "PUT", "/admin/backends/v2", string(body)); w.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d, want %d (body: %s)", w.Code, http.StatusOK, w.Body.String())
+	}
+	if w, _ := adminRequest(t, server, "POST", "/admin/backends/v2/activate", ""); w.Code != http.StatusOK {
+		t.Fatalf("activate status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := mcpResult(t, server); !strings.Contains(got, `"args":"run --rm -i example/server:2 --stdio"`) {
+		t.Errorf("POST /mcp = %s, want the image run by podman", got)
+	}
+}
+
+func TestAdmin_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		token  string
+		want   int
+	}{
+		{name: "トークンなし_401", method: "GET", path: "/admin/backends", want: http.StatusUnauthorized},
+		{name: "トークン不一致_401", method: "GET", path: "/admin/backends", token: "wrong", want: http.StatusUnauthorized},
+		{name: "未登録のバージョンを有効化_404", method: "POST", path: "/admin/backends/unknown/activate", token: testAdminToken, want: http.StatusNotFound},
+		{name: "ロールバック先がない_409", method: "POST", path: "/admin/backends/rollback", token: testAdminToken, want: http.StatusConflict},
+		{name: "コマンドなし_400", method: "PUT", path: "/admin/backends/v2", body: `{"args":["x"]}`, token: testAdminToken, want: http.StatusBadRequest},
+		{name: "不正なJSON_400", method: "PUT", path: "/admin/backends/v2", body: `{`, token: testAdminToken, want: http.StatusBadRequest},
+		{name: "microVMの設定なしでfirecracker_400", method: "PUT", path: "/admin/backends/v2", body: `{"command":"/usr/bin/server","runtime":"firecracker"}`, token: testAdminToken, want: http.StatusBadRequest},
+		{name: "未対応のコンテナランタイム_400", method: "PUT", path: "/admin/backends/v2", body: `{"command":"image","runtime":"lxc"}`, token: testAdminToken, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newAdminServer(t, "cat", []string{})
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (body: %s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdmin_Disabled(t *testing.T) {
+	server := newPollServer(t, "cat", []string{}, map[string]string{})
+
+	req := httptest.NewRequest("GET", "/admin/backends", nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// affinity はアフィニティキーのヘッダーが同じリクエストを、コンシステントハッシュで決まる1台のレプリカに集めるミドルウェアです。
+// キーを持たないリクエストや、別のレプリカから転送済みのリクエストはこのレプリカで処理します。
+func (s *Server) affinity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(s.cfg.AffinityHeader)
+		if key == "" || r.Header.Get(headerForwardedBy) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		owner := s.ring.Get(key)
+		if owner == s.cfg.AdvertiseURL {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		target, err := url.Parse(owner)
+		if err != nil {
+			s.logger.Error("Invalid peer URL", "peer", owner, "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.logger.Debug("Forwarding request to affinity owner", "owner", owner)
+		s.proxyTo(w, r, target)
+	})
+}
@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/apikey"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mcptest"
+)
+
+func newAffinityServer(t *testing.T, peers []string) *Server {
+	t.Helper()
+	command, args, env := mcptest.Command(mcptest.ModeCompliant)
+	server, err := NewServer(&Config{
+		Command:          command,
+		Args:             args,
+		DefaultEnv:       env,
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+		AdvertiseURL:     "http://self",
+		Peers:            peers,
+		AffinityHeader:   "X-Tenant-Id",
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	return server
+}
+
+// keyOwnedBy は owner に割り当てられるアフィニティキーを探します。
+func keyOwnedBy(t *testing.T, server *Server, owner string) string {
+	t.Helper()
+	for i := range 1000 {
+		key := fmt.Sprintf("tenant-%d", i)
+		if server.ring.Get(key) == owner {
+			return key
+		}
+	}
+	t.Fatalf("no key is owned by %s", owner)
+	return ""
+}
+
+func TestAffinity(t *testing.T) {
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `{"from":"peer"}`)
+	}))
+	t.Cleanup(peer.Close)
+
+	server := newAffinityServer(t, []string{"http://self", peer.URL})
+
+	tests := []struct {
+		name      string
+		key       string
+		forwarded bool
+		wantBody  string
+	}{
+		{name: "キーなし_ローカルで実行", wantBody: `"result"`},
+		{name: "自分が担当するキー_ローカルで実行", key: keyOwnedBy(t, server, "http://self"), wantBody: `"result"`},
+		{name: "他のレプリカが担当するキー_転送", key: keyOwnedBy(t, server, peer.URL), wantBody: `{"from":"peer"}`},
+		{name: "転送済みのリクエスト_ローカルで実行", key: keyOwnedBy(t, server, peer.URL), forwarded: true, wantBody: `"result"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.key != "" {
+				req.Header.Set("X-Tenant-Id", tt.key)
+			}
+			if tt.forwarded {
+				req.Header.Set(headerForwardedBy, peer.URL)
+			}
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("response = %d %s, want %s", w.Code, w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAffinity_InvalidPeer(t *testing.T) {
+	server := newAffinityServer(t, []string{"http://self", "http://[::1"})
+
+	// 転送先の URL が不正な場合はローカルで処理する
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant-Id", keyOwnedBy(t, server, "http://[::1"))
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestAffinity_ForwardsClientCredentials(t *testing.T) {
+	received := make(chan http.Header, 1)
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+		_, _ = io.WriteString(w, `{"from":"peer"}`)
+	}))
+	t.Cleanup(peer.Close)
+
+	store, err := apikey.Open(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatalf("apikey.Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	token, _, err := store.Create(apikey.Key{Name: "ci", Tenant: "acme", Env: map[string]string{"GITHUB_TOKEN": "ghp_secret"}})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	server, err := NewServer(&Config{
+		Command:        "cat",
+		AdvertiseURL:   "http://self",
+		Peers:          []string{"http://self", peer.URL},
+		AffinityHeader: "X-Tenant-Id",
+		APIKeys:        store,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant-Id", keyOwnedBy(t, server, peer.URL))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(headerServer, "spoofed")
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d (body: %s)", w.Code, w.Body.String())
+	}
+
+	// 転送先で認証し直せるようクライアントの認証情報を送り、このレプリカの内部ヘッダーは送らない
+	header := <-received
+	if got := header.Get("Authorization"); got != "Bearer "+token {
+		t.Errorf("forwarded Authorization = %q, want the client's API key", got)
+	}
+	for _, name := range []string{headerAPIKeyEnv, headerAPIKeyID, headerTenant, headerAuthMethod, headerServer} {
+		if got := header.Get(name); got != "" {
+			t.Errorf("forwarded %s = %q, want it stripped", name, got)
+		}
+	}
+	if got := header.Get(headerForwardedBy); got != "http://self" {
+		t.Errorf("forwarded %s = %q, want http://self", headerForwardedBy, got)
+	}
+}
+
+func TestNewServer_AffinityRequiresSelfInPeers(t *testing.T) {
+	_, err := NewServer(&Config{
+		Command:        "cat",
+		AdvertiseURL:   "http://self",
+		Peers:          []string{"http://other"},
+		AffinityHeader: "X-Tenant-Id",
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err == nil {
+		t.Error("NewServer() without self in peers expected error but got none")
+	}
+}
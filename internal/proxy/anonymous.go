@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+)
+
+// authAnonymous は認証情報なしで AnonymousMethods のメソッドだけを呼び出したリクエストの認証方式です。
+const authAnonymous = "anonymous"
+
+// validateAnonymousMethods は匿名で呼び出せるメソッドが認証と組み合わせて設定されていることを確かめます。
+func validateAnonymousMethods(cfg *Config) error {
+	if len(cfg.AnonymousMethods) == 0 {
+		return nil
+	}
+	if cfg.APIKeys == nil && len(cfg.AuthMethods) == 0 {
+		return errors.New("anonymous methods require API keys or auth methods")
+	}
+	if slices.Contains(cfg.AnonymousMethods, "") {
+		return errors.New("anonymous method must not be empty")
+	}
+	return nil
+}
+
+// admitAnonymous は認証情報のないリクエストを、POST のボディの全ての JSON-RPC メッセージが AnonymousMethods のメソッドの場合だけ受け付けます。
+// 受け付けた場合は内部ヘッダーを設定した r を返します。ボディは読み取って next に渡し直します。
+func (s *Server) admitAnonymous(r *http.Request) (*http.Request, bool) {
+	if len(s.cfg.AnonymousMethods) == 0 || r.Method != http.MethodPost {
+		return r, false
+	}
+	body, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil || !s.anonymousBody(body) {
+		return r, false
+	}
+
+	r = r.Clone(r.Context())
+	for _, name := range []string{headerAPIKeyID, headerTenant, headerAPIKeyEnv, headerPrincipal} {
+		r.Header.Del(name)
+	}
+	r.Header.Set(headerAuthMethod, authAnonymous)
+	return r, true
+}
+
+// anonymousBody はボディの全てのメッセージ（バッチの場合は全ての要素）が匿名で呼び出せるメソッドかどうかを返します。
+func (s *Server) anonymousBody(body []byte) bool {
+	messages := []json.RawMessage{body}
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &messages); err != nil || len(messages) == 0 {
+			return false
+		}
+	}
+	for _, raw := range messages {
+		msg, err := jsonrpc.Parse(raw)
+		if err != nil || msg.Method == "" || !slices.Contains(s.cfg.AnonymousMethods, msg.Method) {
+			return false
+		}
+	}
+	return true
+}
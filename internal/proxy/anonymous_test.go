@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/apikey"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jwtauth"
+)
+
+// newAnonymousServer は tools/list と resources/list を匿名で呼び出せる Server と、作成した API キーを返します。
+// プロセスは内部ヘッダーから渡した認証方式とキーの ID を出力します。
+func newAnonymousServer(t *testing.T, authMethods []string) (*Server, string) {
+	t.Helper()
+	store, err := apikey.Open(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatalf("apikey.Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	token, _, err := store.Create(apikey.Key{Name: "ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{
+		Command:          "sh",
+		Args:             []string{"-c", `read line; printf '{"auth":"%s","key":"%s"}\n' "$AUTH" "$KEY_ID"`, "sh"},
+		DefaultEnv:       map[string]string{},
+		HeaderEnvMapping: map[string]string{headerAuthMethod: "AUTH", headerAPIKeyID: "KEY_ID"},
+		APIKeys:          store,
+		AuthMethods:      authMethods,
+		AnonymousMethods: []string{"tools/list", "resources/list"},
+	}
+	if len(authMethods) > 0 {
+		if cfg.JWT, err = jwtauth.NewVerifier(jwtauth.Config{Secret: testJWTSecret}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server, err := NewServer(cfg, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	return server, token
+}
+
+func TestAnonymousMethods(t *testing.T) {
+	for _, mode := range []struct {
+		name        string
+		authMethods []string
+	}{
+		{name: "APIキー"},
+		{name: "認証チェーン", authMethods: []string{AuthJWT, AuthAPIKey}},
+	} {
+		server, key := newAnonymousServer(t, mode.authMethods)
+
+		tests := []struct {
+			name       string
+			body       string
+			header     http.Header
+			wantStatus int
+			wantBody   string
+		}{
+			{
+				name:       "認証なしのtools/list_匿名で受け付ける",
+				body:       `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+				wantStatus: http.StatusOK,
+				wantBody:   `"auth":"anonymous","key":""`,
+			},
+			{
+				name:       "キーのIDを偽装_削除して匿名で受け付ける",
+				body:       `{"jsonrpc":"2.0","id":1,"method":"resources/list"}`,
+				header:     http.Header{headerAPIKeyID: {"spoofed"}, headerAuthMethod: {AuthAPIKey}},
+				wantStatus: http.StatusOK,
+				wantBody:   `"auth":"anonymous","key":""`,
+			},
+			{
+				name:       "認証なしのtools/call_401",
+				body:       `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"delete"}}`,
+				wantStatus: http.StatusUnauthorized,
+			},
+			{
+				name:       "許可していないメソッドを含むバッチ_401",
+				body:       `[{"jsonrpc":"2.0","id":1,"method":"tools/list"},{"jsonrpc":"2.0","id":2,"method":"tools/call"}]`,
+				wantStatus: http.StatusUnauthorized,
+			},
+			{
+				name:       "不正なキー_匿名にせず401",
+				body:       `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+				header:     http.Header{headerAPIKey: {apikey.Prefix + "unknown"}},
+				wantStatus: http.StatusUnauthorized,
+			},
+			{
+				name:       "キーあり_キーで認証",
+				body:       `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"delete"}}`,
+				header:     http.Header{headerAPIKey: {key}},
+				wantStatus: http.StatusOK,
+				wantBody:   `"auth":"apikey"`,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(mode.name+"/"+tt.name, func(t *testing.T) {
+				w := postMCP(server, tt.body, tt.header)
+				if w.Code != tt.wantStatus {
+					t.Fatalf("status = %d, want %d (body: %s)", w.Code, tt.wantStatus, w.Body.String())
+				}
+				if !strings.Contains(w.Body.String(), tt.wantBody) {
+					t.Errorf("body = %s, want %s", w.Body.String(), tt.wantBody)
+				}
+			})
+		}
+	}
+}
+
+func TestNewServer_AnonymousMethods(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "未指定", cfg: Config{Command: "cat"}},
+		{name: "認証なし_エラー", cfg: Config{Command: "cat", AnonymousMethods: []string{"tools/list"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewServer(&tt.cfg, slog.Default())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewServer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
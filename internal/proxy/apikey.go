@@ -0,0 +1,278 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/apikey"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/ratelimit"
+)
+
+// API キーの認証で使うヘッダーです。
+const (
+	headerAPIKey = "X-Api-Key" // API キー（Authorization: Bearer でも指定できる）
+
+	// 認証したキーの情報をマッピングに渡す内部ヘッダーです。クライアントが送った同名のヘッダーは上書きします。
+	headerTenant   = "X-Tumiki-Tenant"
+	headerAPIKeyID = "X-Tumiki-Key-Id"
+
+	// headerAPIKeyEnv は認証したキーの環境変数（JSON）をプロセスの設定に渡す内部ヘッダーです。
+	headerAPIKeyEnv = "X-Tumiki-Key-Env"
+)
+
+// keyLimiters は API キーごとのレート制限のカウンタです。
+type keyLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]*ratelimit.Memory
+}
+
+// get はキーの上限で数える Limiter を返します。なければ作成します。
+func (l *keyLimiters) get(key apikey.Key) *ratelimit.Memory {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limiters == nil {
+		l.limiters = make(map[string]*ratelimit.Memory)
+	}
+	limiter, ok := l.limiters[key.ID]
+	if !ok {
+		limiter = ratelimit.NewMemory(key.RateLimit, ratelimit.DefaultWindow)
+		l.limiters[key.ID] = limiter
+	}
+	return limiter
+}
+
+// apiKeyAuth は X-Api-Key ヘッダーまたは Authorization ヘッダーの Bearer トークンの API キーを検証します。
+// 認証したキーのテナントと ID を内部ヘッダーに設定し、キー自体はプロセスに渡さないよう削除します。
+// キーのないリクエストは匿名で呼び出せるメソッドだけの場合に受け付けます。
+func (s *Server) apiKeyAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, fromBearer := apiKeyToken(r.Header)
+		if token == "" {
+			if anonymous, ok := s.admitAnonymous(r); ok {
+				next.ServeHTTP(w, anonymous)
+				return
+			}
+		}
+		key, ok := s.admitAPIKey(w, r, token)
+		if !ok {
+			return
+		}
+		r = r.Clone(r.Context())
+		setAPIKeyHeaders(r.Header, key, fromBearer)
+		r.Header.Set(headerAuthMethod, AuthAPIKey)
+		r.Header.Set(headerPrincipal, key.ID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiKeyToken は X-Api-Key ヘッダー、または apikey.Prefix で始まる Bearer トークンの API キーを返します。
+// fromBearer は Authorization ヘッダーから取り出したかどうかです。
+func apiKeyToken(header http.Header) (token string, fromBearer bool) {
+	if token := header.Get(headerAPIKey); token != "" {
+		return token, false
+	}
+	if bearer, ok := strings.CutPrefix(header.Get("Authorization"), "Bearer "); ok && strings.HasPrefix(bearer, apikey.Prefix) {
+		return bearer, true
+	}
+	return "", false
+}
+
+// admitAPIKey は API キーを検証し、キーの利用できるサーバーとレート制限を確認します。
+// 受け付けない場合はエラーのレスポンスを書き込んで false を返します。
+func (s *Server) admitAPIKey(w http.ResponseWriter, r *http.Request, token string) (apikey.Key, bool) {
+	key, err := s.cfg.APIKeys.Authenticate(token)
+	if err != nil {
+		if !errors.Is(err, apikey.ErrInvalidKey) {
+			s.logger.Error("API key lookup failed", "error", err)
+			http.Error(w, "Authentication failed", http.StatusInternalServerError)
+			return apikey.Key{}, false
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="mcp"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return apikey.Key{}, false
+	}
+
+	if !key.AllowsServer(s.requestedServer(r)) {
+		http.Error(w, "API key is not allowed to use this server", http.StatusForbidden)
+		return apikey.Key{}, false
+	}
+
+	if key.RateLimit > 0 {
+		decision, err := s.keyLimiters.get(key).Allow(r.Context(), key.ID)
+		if err != nil {
+			s.logger.Warn("Rate limiter unavailable", "error", err)
+		} else {
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(decision.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+			if !decision.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				return apikey.Key{}, false
+			}
+		}
+	}
+	return key, true
+}
+
+// requestedServer はキーの利用できるサーバーと照合する、リクエストの送り先のサーバーを返します。
+// ルーティングより前に照合するため、/servers/{name}/mcp ではパスのサーバー名、それ以外では有効なバックエンドのバージョンを返します。
+func (s *Server) requestedServer(r *http.Request) string {
+	if name, ok := serverNameFromPath(r.URL.Path); ok {
+		return name
+	}
+	return s.backends.current().Version
+}
+
+// setAPIKeyHeaders は認証したキーの ID・テナント・環境変数を内部ヘッダーに設定し、キー自体を削除します。
+func setAPIKeyHeaders(header http.Header, key apikey.Key, fromBearer bool) {
+	header.Del(headerAPIKey)
+	if fromBearer {
+		header.Del("Authorization")
+	}
+	header.Set(headerAPIKeyID, key.ID)
+	header.Del(headerTenant)
+	if key.Tenant != "" {
+		header.Set(headerTenant, key.Tenant)
+	}
+	header.Del(headerAPIKeyEnv)
+	if len(key.Env) > 0 {
+		// 文字列の map のため失敗しない
+		data, _ := json.Marshal(key.Env)
+		header.Set(headerAPIKeyEnv, string(data))
+	}
+}
+
+// apiKeyEnvFromHeader は headerAPIKeyEnv から認証したキーの環境変数を取り出します。
+// API キーを使用しない場合は、クライアントが送った同名のヘッダーを無視します。
+func (s *Server) apiKeyEnvFromHeader(header http.Header) map[string]string {
+	value := header.Get(headerAPIKeyEnv)
+	if s.cfg.APIKeys == nil || value == "" {
+		return nil
+	}
+	var env map[string]string
+	// setAPIKeyHeaders が設定した値のため失敗しない
+	_ = json.Unmarshal([]byte(value), &env)
+	return env
+}
+
+// apiKeyRequest は POST /admin/keys のリクエストボディです。
+type apiKeyRequest struct {
+	Name           string            `json:"name"`
+	Tenant         string            `json:"tenant"`
+	AllowedServers []string          `json:"allowedServers"`
+	RateLimit      int               `json:"rateLimit"`
+	Env            map[string]string `json:"env"`
+}
+
+// apiKeyView は管理 API で返すキーのメタデータです。環境変数はトークンを含むため名前だけを返します。
+type apiKeyView struct {
+	apikey.Key
+	Env []string `json:"env,omitempty"` // apikey.Key の Env を隠す
+}
+
+// newAPIKeyView は key の環境変数の値を除いた apiKeyView を返します。
+func newAPIKeyView(key apikey.Key) apiKeyView {
+	return apiKeyView{Key: key, Env: slices.Sorted(maps.Keys(key.Env))}
+}
+
+// createdAPIKey は POST /admin/keys のレスポンスです。平文のキーはこの時だけ返します。
+type createdAPIKey struct {
+	apiKeyView
+	Token string `json:"key"`
+}
+
+func (s *Server) handleListAPIKeys(w http.ResponseWriter, _ *http.Request) {
+	keys, err := s.cfg.APIKeys.List()
+	if err != nil {
+		s.logger.Error("API key lookup failed", "error", err)
+		http.Error(w, "API key lookup failed", http.StatusInternalServerError)
+		return
+	}
+	views := make([]apiKeyView, 0, len(keys))
+	for _, key := range keys {
+		views = append(views, newAPIKeyView(key))
+	}
+	s.writeJSON(w, views)
+}
+
+func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.RateLimit < 0 {
+		http.Error(w, "rateLimit must not be negative", http.StatusBadRequest)
+		return
+	}
+	if err := apikey.ValidateAllowedServers(req.AllowedServers); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := apikey.ValidateEnv(req.Env); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, key, err := s.cfg.APIKeys.Create(apikey.Key{
+		Name:           req.Name,
+		Tenant:         req.Tenant,
+		AllowedServers: req.AllowedServers,
+		RateLimit:      req.RateLimit,
+		Env:            req.Env,
+	})
+	if err != nil {
+		s.logger.Error("API key creation failed", "error", err)
+		http.Error(w, "API key creation failed", http.StatusInternalServerError)
+		return
+	}
+	s.logger.Info("Created API key", "id", key.ID, "name", key.Name, "tenant", key.Tenant)
+	s.writeJSON(w, createdAPIKey{apiKeyView: newAPIKeyView(key), Token: token})
+}
+
+func (s *Server) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	key, err := s.cfg.APIKeys.Revoke(r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, apikey.ErrNotFound) {
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		}
+		s.logger.Error("API key revocation failed", "error", err)
+		http.Error(w, "API key revocation failed", http.StatusInternalServerError)
+		return
+	}
+	s.logger.Info("Revoked API key", "id", key.ID)
+	s.writeJSON(w, newAPIKeyView(key))
+}
+
+// handleSetAPIKeyEnv はキーの環境変数を置き換えます。ボディは環境変数の名前と値の JSON オブジェクトです（{} で全て削除）。
+func (s *Server) handleSetAPIKeyEnv(w http.ResponseWriter, r *http.Request) {
+	var env map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&env); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if err := apikey.ValidateEnv(env); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key, err := s.cfg.APIKeys.SetEnv(r.PathValue("id"), env)
+	if err != nil {
+		if errors.Is(err, apikey.ErrNotFound) {
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		}
+		s.logger.Error("API key update failed", "error", err)
+		http.Error(w, "API key update failed", http.StatusInternalServerError)
+		return
+	}
+	s.logger.Info("Updated API key environment", "id", key.ID, "env", slices.Sorted(maps.Keys(env)))
+	s.writeJSON(w, newAPIKeyView(key))
+}
@@ -0,0 +1,332 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/apikey"
+)
+
+func newAPIKeyServer(t *testing.T) *Server {
+	t.Helper()
+	store, err := apikey.Open(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatalf("apikey.Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", `read line; printf '{"tenant":"%s","key":"%s"}\n' "$TENANT" "$API_KEY"`, "sh"},
+		DefaultEnv:       map[string]string{},
+		HeaderEnvMapping: map[string]string{headerTenant: "TENANT", headerAPIKey: "API_KEY"},
+		AdminToken:       testAdminToken,
+		APIKeys:          store,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	return server
+}
+
+// keyAdminRequest は API キーの管理 API にリクエストを送り、レスポンスを返します。
+func keyAdminRequest(t *testing.T, server *Server, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	return w
+}
+
+// createKey は管理 API でキーを作成し、平文のキーと ID を返します。
+func createKey(t *testing.T, server *Server, body string) (string, string) {
+	t.Helper()
+	w := keyAdminRequest(t, server, "POST", "/admin/keys", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /admin/keys status = %d (body: %s)", w.Code, w.Body.String())
+	}
+	var created struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	return created.Key, created.ID
+}
+
+// mcpRequest は headers を付けて POST /mcp を送り、レスポンスを返します。
+func mcpRequest(server *Server, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	server := newAPIKeyServer(t)
+	token, _ := createKey(t, server, `{"name":"ci","tenant":"acme"}`)
+	other, _ := createKey(t, server, `{"name":"other","allowedServers":["v2"]}`)
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "X-Api-Keyで認証_テナントを渡しキーは渡さない",
+			headers:    map[string]string{headerAPIKey: token},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"tenant":"acme","key":""}`,
+		},
+		{
+			name:       "Bearerで認証_テナントを渡す",
+			headers:    map[string]string{"Authorization": "Bearer " + token},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"tenant":"acme","key":""}`,
+		},
+		{
+			name:       "テナントを偽装_キーのテナントで上書き",
+			headers:    map[string]string{headerAPIKey: token, headerTenant: "evil"},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"tenant":"acme","key":""}`,
+		},
+		{
+			name:       "キーなし_401",
+			headers:    map[string]string{},
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   "Unauthorized",
+		},
+		{
+			name:       "不正なキー_401",
+			headers:    map[string]string{headerAPIKey: apikey.Prefix + "invalid"},
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   "Unauthorized",
+		},
+		{
+			name:       "許可されていないバックエンド_403",
+			headers:    map[string]string{headerAPIKey: other},
+			wantStatus: http.StatusForbidden,
+			wantBody:   "API key is not allowed to use this server",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := mcpRequest(server, tt.headers)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d (body: %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.wantBody {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAPIKeyAuth_RevokeAndList(t *testing.T) {
+	server := newAPIKeyServer(t)
+	token, id := createKey(t, server, `{"name":"ci"}`)
+
+	w := keyAdminRequest(t, server, "GET", "/admin/keys", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), id) || strings.Contains(w.Body.String(), token) {
+		t.Fatalf("GET /admin/keys = %d %s, want the key metadata without the key", w.Code, w.Body.String())
+	}
+
+	if w := keyAdminRequest(t, server, "DELETE", "/admin/keys/"+id, ""); w.Code != http.StatusOK {
+		t.Fatalf("DELETE /admin/keys status = %d (body: %s)", w.Code, w.Body.String())
+	}
+	if w := mcpRequest(server, map[string]string{headerAPIKey: token}); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := keyAdminRequest(t, server, "DELETE", "/admin/keys/missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("DELETE unknown key status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestAPIKeyAuth_RateLimit(t *testing.T) {
+	server := newAPIKeyServer(t)
+	token, _ := createKey(t, server, `{"name":"ci","rateLimit":1}`)
+
+	if w := mcpRequest(server, map[string]string{headerAPIKey: token}); w.Code != http.StatusOK {
+		t.Fatalf("first request status = %d, want %d", w.Code, http.StatusOK)
+	}
+	w := mcpRequest(server, map[string]string{headerAPIKey: token})
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After header is missing")
+	}
+}
+
+func TestNewServer_APIKeysWithGRPC(t *testing.T) {
+	store, err := apikey.Open(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	_, err = NewServer(&Config{Command: "cat", GRPCPort: 9090, APIKeys: store}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err == nil {
+		t.Error("NewServer() expected error but got none")
+	}
+}
+
+func TestAPIKeyAuth_AllowedServers(t *testing.T) {
+	store, err := apikey.Open(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatalf("apikey.Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	echo := ServerDefinition{Command: "sh", Args: []string{"-c", `read line; echo '{"jsonrpc":"2.0","id":1,"result":{}}'`, "sh"}}
+	server, err := NewServer(&Config{
+		Command:    echo.Command,
+		Args:       echo.Args,
+		AdminToken: testAdminToken,
+		APIKeys:    store,
+		Servers:    map[string]ServerDefinition{"public-docs": echo, "payments": echo},
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	public, _ := createKey(t, server, `{"name":"public","allowedServers":["public-*"]}`)
+	payments, _ := createKey(t, server, `{"name":"payments","allowedServers":["payments","default"]}`)
+
+	tests := []struct {
+		name       string
+		token      string
+		path       string
+		wantStatus int
+	}{
+		{name: "パターンに一致するサーバー_許可", token: public, path: "/servers/public-docs/mcp", wantStatus: http.StatusOK},
+		{name: "パターンに一致しないサーバー_403", token: public, path: "/servers/payments/mcp", wantStatus: http.StatusForbidden},
+		{name: "パターンに一致しない/mcp_403", token: public, path: "/mcp", wantStatus: http.StatusForbidden},
+		{name: "名前で許可したサーバー_許可", token: payments, path: "/servers/payments/mcp", wantStatus: http.StatusOK},
+		{name: "バージョンで許可した/mcp_許可", token: payments, path: "/mcp", wantStatus: http.StatusOK},
+		{name: "許可していないサーバー_ルーティング前に403", token: payments, path: "/servers/unknown/mcp", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(headerAPIKey, tt.token)
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d (body: %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+
+	if w := keyAdminRequest(t, server, "POST", "/admin/keys", `{"allowedServers":["public-["]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("POST /admin/keys with an invalid pattern status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAPIKeyAuth_Env(t *testing.T) {
+	store, err := apikey.Open(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatalf("apikey.Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", `read line; printf '{"token":"%s"}\n' "$GITHUB_TOKEN"`, "sh"},
+		DefaultEnv:       map[string]string{"GITHUB_TOKEN": "default"},
+		HeaderEnvMapping: map[string]string{"X-Github-Token": "GITHUB_TOKEN"},
+		AdminToken:       testAdminToken,
+		APIKeys:          store,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	acme, id := createKey(t, server, `{"name":"acme","env":{"GITHUB_TOKEN":"ghp_acme"}}`)
+	plain, _ := createKey(t, server, `{"name":"plain"}`)
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		wantBody string
+	}{
+		{
+			name:     "キーの環境変数_プロセスに渡す",
+			headers:  map[string]string{headerAPIKey: acme},
+			wantBody: `{"token":"ghp_acme"}`,
+		},
+		{
+			name:     "ヘッダーマッピング_キーの環境変数を優先",
+			headers:  map[string]string{headerAPIKey: acme, "X-Github-Token": "ghp_client"},
+			wantBody: `{"token":"ghp_acme"}`,
+		},
+		{
+			name:     "環境変数のないキーで内部ヘッダーを偽装_無視",
+			headers:  map[string]string{headerAPIKey: plain, headerAPIKeyEnv: `{"GITHUB_TOKEN":"ghp_evil"}`},
+			wantBody: `{"token":"default"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := mcpRequest(server, tt.headers)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Status = %d (body: %s)", w.Code, w.Body.String())
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.wantBody {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+
+	// 管理 API は環境変数の名前だけを返す
+	w := keyAdminRequest(t, server, "GET", "/admin/keys", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"env":["GITHUB_TOKEN"]`) || strings.Contains(w.Body.String(), "ghp_acme") {
+		t.Fatalf("GET /admin/keys = %d %s, want the env names without the values", w.Code, w.Body.String())
+	}
+
+	// キーを発行し直さずにトークンを入れ替える
+	w = keyAdminRequest(t, server, "PUT", "/admin/keys/"+id+"/env", `{"GITHUB_TOKEN":"ghp_rotated"}`)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "ghp_rotated") {
+		t.Fatalf("PUT /admin/keys/{id}/env = %d %s", w.Code, w.Body.String())
+	}
+	if got := strings.TrimSpace(mcpRequest(server, map[string]string{headerAPIKey: acme}).Body.String()); got != `{"token":"ghp_rotated"}` {
+		t.Errorf("body after rotation = %s", got)
+	}
+
+	for _, tt := range []struct {
+		method, path, body string
+		wantStatus         int
+	}{
+		{method: "POST", path: "/admin/keys", body: `{"env":{"A=B":"x"}}`, wantStatus: http.StatusBadRequest},
+		{method: "PUT", path: "/admin/keys/" + id + "/env", body: `{"1TOKEN":"x"}`, wantStatus: http.StatusBadRequest},
+		{method: "PUT", path: "/admin/keys/missing/env", body: `{}`, wantStatus: http.StatusNotFound},
+	} {
+		if w := keyAdminRequest(t, server, tt.method, tt.path, tt.body); w.Code != tt.wantStatus {
+			t.Errorf("%s %s status = %d, want %d", tt.method, tt.path, w.Code, tt.wantStatus)
+		}
+	}
+}
+
+func TestServer_apiKeyEnvFromHeader_APIキーなし(t *testing.T) {
+	server, err := NewServer(&Config{Command: "cat"}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{headerAPIKeyEnv: {`{"GITHUB_TOKEN":"ghp_evil"}`}}
+	// API キーを使用しない場合はクライアントが送った内部ヘッダーを使わない
+	if env := server.apiKeyEnvFromHeader(header); env != nil {
+		t.Errorf("apiKeyEnvFromHeader() = %v, want nil", env)
+	}
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// overrideArgs は静的な引数をヘッダーの値で置き換え・削除した引数を返します。元のスライスは変更しません。
+//
+// overrides はヘッダー名 → 置き換える対象です。対象が "-" で始まる場合はフラグとみなし、
+// "--root /data" の値と "--root=/data" の値を置き換えます。それ以外の場合は対象と一致する引数そのもの
+// （位置引数など）を置き換えます。
+//
+// removals はヘッダー名 → 削除するフラグです。ヘッダーの値が真（"true"、"1" など）の場合に、
+// フラグと "--flag=value" 形式の引数を削除します。
+func overrideArgs(static []string, headers http.Header, overrides, removals map[string]string) []string {
+	args := slices.Clone(static)
+
+	// ヘッダー名の順に適用し、同じヘッダーからは常に同じ引数列を作る
+	for _, headerName := range slices.Sorted(maps.Keys(overrides)) {
+		value := headerValue(headers, headerName)
+		if value == "" {
+			continue
+		}
+		target := overrides[headerName]
+		for i := 0; i < len(args); i++ {
+			switch {
+			case !strings.HasPrefix(target, "-"):
+				if args[i] == target {
+					args[i] = value
+				}
+			case args[i] == target && i+1 < len(args):
+				args[i+1] = value
+				i++
+			case strings.HasPrefix(args[i], target+"="):
+				args[i] = target + "=" + value
+			}
+		}
+	}
+
+	for _, headerName := range slices.Sorted(maps.Keys(removals)) {
+		if remove, err := strconv.ParseBool(headerValue(headers, headerName)); err != nil || !remove {
+			continue
+		}
+		flag := removals[headerName]
+		args = slices.DeleteFunc(args, func(arg string) bool {
+			return arg == flag || strings.HasPrefix(arg, flag+"=")
+		})
+	}
+	return args
+}
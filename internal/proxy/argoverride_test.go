@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestOverrideArgs(t *testing.T) {
+	static := []string{"-y", "server-filesystem", "--root", "/srv", "--mode=ro", "--read-only", "/data"}
+	overrides := map[string]string{
+		"X-Data-Dir": "/data",
+		"X-Root":     "--root",
+		"X-Mode":     "--mode",
+	}
+	removals := map[string]string{
+		"X-Writable": "--read-only",
+		"X-No-Mode":  "--mode",
+	}
+
+	tests := []struct {
+		name    string
+		headers http.Header
+		want    []string
+	}{
+		{
+			name:    "ヘッダーなし_静的な引数のまま",
+			headers: http.Header{},
+			want:    static,
+		},
+		{
+			name:    "位置引数の置き換え_一致する引数を置き換える",
+			headers: http.Header{"X-Data-Dir": {"/tenants/a"}},
+			want:    []string{"-y", "server-filesystem", "--root", "/srv", "--mode=ro", "--read-only", "/tenants/a"},
+		},
+		{
+			name:    "フラグの値の置き換え_空白区切りと=区切りの両方",
+			headers: http.Header{"X-Root": {"/tenants/a"}, "X-Mode": {"rw"}},
+			want:    []string{"-y", "server-filesystem", "--root", "/tenants/a", "--mode=rw", "--read-only", "/data"},
+		},
+		{
+			name:    "フラグの削除_値が真の場合に削除",
+			headers: http.Header{"X-Writable": {"true"}, "X-No-Mode": {"1"}},
+			want:    []string{"-y", "server-filesystem", "--root", "/srv", "/data"},
+		},
+		{
+			name:    "フラグの削除_値が偽の場合はそのまま",
+			headers: http.Header{"X-Writable": {"false"}, "X-No-Mode": {"yes-please"}},
+			want:    static,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := overrideArgs(static, tt.headers, overrides, removals)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("overrideArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if want := []string{"-y", "server-filesystem", "--root", "/srv", "--mode=ro", "--read-only", "/data"}; !reflect.DeepEqual(static, want) {
+		t.Errorf("overrideArgs() modified static args: %v", static)
+	}
+}
+
+func TestProcessConfig_OverrideAndAppend(t *testing.T) {
+	server, err := NewServer(&Config{
+		Command:           "server",
+		Args:              []string{"--verbose", HeaderArgsPlaceholder, "/data"},
+		HeaderArgMapping:  map[string]string{"X-Team-Id": "team-id"},
+		HeaderArgOverride: map[string]string{"x-data-dir": "/data"},
+		HeaderArgRemoval:  map[string]string{"X-QUIET": "--verbose"},
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	_, _, args := server.processConfig(http.Header{
+		"X-Team-Id":  {"T123"},
+		"X-Data-Dir": {"/tenants/a"},
+		"X-Quiet":    {"true"},
+	})
+	want := []string{"--team-id", "T123", "/tenants/a"}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/apikey"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jwtauth"
+)
+
+// 認証チェーンで使える認証方式です。
+const (
+	AuthMTLS   = "mtls"   // SPIFFE の SVID によるクライアント証明書
+	AuthJWT    = "jwt"    // Authorization ヘッダーの Bearer トークンの JWT
+	AuthAPIKey = "apikey" // X-Api-Key ヘッダーまたは Bearer トークンの API キー
+)
+
+// 認証した方式とプリンシパルをマッピングに渡す内部ヘッダーです。クライアントが送った同名のヘッダーは上書きします。
+const (
+	headerAuthMethod = "X-Tumiki-Auth-Method"
+	headerPrincipal  = "X-Tumiki-Principal"
+)
+
+// authOutcome は1つの認証方式の結果です。
+type authOutcome int
+
+const (
+	authAbsent   authOutcome = iota // この方式の認証情報がない（次の方式を試す）
+	authAccepted                    // 認証した
+	authRejected                    // 認証情報が不正（レスポンスを書き込み済みで、次の方式は試さない）
+)
+
+// ValidateAuthMethods は認証チェーンの方式の一覧を検証します。
+func ValidateAuthMethods(methods []string) error {
+	for i, method := range methods {
+		switch method {
+		case AuthMTLS, AuthJWT, AuthAPIKey:
+		default:
+			return fmt.Errorf("unsupported auth method %q (want %s, %s or %s)", method, AuthMTLS, AuthJWT, AuthAPIKey)
+		}
+		if slices.Contains(methods[:i], method) {
+			return fmt.Errorf("duplicate auth method %q", method)
+		}
+	}
+	return nil
+}
+
+// validateAuthConfig は認証チェーンの各方式に必要な設定があることを確かめます。
+func validateAuthConfig(cfg *Config) error {
+	if err := ValidateAuthMethods(cfg.AuthMethods); err != nil {
+		return err
+	}
+	if cfg.JWT != nil && !slices.Contains(cfg.AuthMethods, AuthJWT) {
+		return errors.New("a JWT verifier requires the jwt auth method")
+	}
+	if len(cfg.AuthMethods) == 0 {
+		return nil
+	}
+	if cfg.GRPCPort > 0 || cfg.TCPPort > 0 {
+		// gRPC と TCP のフロントエンドは認証チェーンを評価しないため併用できない
+		return errors.New("auth methods cannot be combined with the gRPC or TCP frontends")
+	}
+	for _, method := range cfg.AuthMethods {
+		switch {
+		case method == AuthMTLS && cfg.SPIFFE == nil:
+			return errors.New("the mtls auth method requires SPIFFE")
+		case method == AuthJWT && cfg.JWT == nil:
+			return errors.New("the jwt auth method requires a JWT secret or public key")
+		case method == AuthAPIKey && cfg.APIKeys == nil:
+			return errors.New("the apikey auth method requires an API key store")
+		}
+	}
+	return nil
+}
+
+// authMethods は MCP エンドポイントで受け付ける認証方式を返します。
+// 認証チェーンを指定しない場合は API キーのストアがあれば AuthAPIKey だけを返します。
+func (s *Server) authMethods() []string {
+	if len(s.cfg.AuthMethods) > 0 {
+		return s.cfg.AuthMethods
+	}
+	if s.cfg.APIKeys != nil {
+		return []string{AuthAPIKey}
+	}
+	return nil
+}
+
+// optionalClientCert は認証チェーンで mTLS 以外の方式も受け付けるため、クライアント証明書を任意にするかを返します。
+func (s *Server) optionalClientCert() bool {
+	return slices.Contains(s.cfg.AuthMethods, AuthMTLS)
+}
+
+// authChain は methods の順に認証方式を試し、最初に認証情報があった方式で認証します。
+// 認証情報が不正な場合は後の方式を試さずに拒否し、どの方式の認証情報もない場合は匿名で呼び出せるメソッドだけのリクエストを除いて 401 を返します。
+// 認証した方式とプリンシパル（SPIFFE ID・JWT のクレーム・API キーの ID）を内部ヘッダーに設定します。
+func (s *Server) authChain(next http.Handler, methods []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.Clone(r.Context())
+		// 認証しなかった方式の内部ヘッダーも偽装できないよう削除する
+		for _, name := range []string{headerAuthMethod, headerPrincipal, headerAPIKeyID, headerTenant, headerAPIKeyEnv} {
+			r.Header.Del(name)
+		}
+		if slices.Contains(methods, AuthMTLS) {
+			r.Header.Del(headerSPIFFEID)
+		}
+
+		for _, method := range methods {
+			var principal string
+			var outcome authOutcome
+			switch method {
+			case AuthMTLS:
+				principal, outcome = s.authenticateMTLS(w, r)
+			case AuthJWT:
+				principal, outcome = s.authenticateJWT(w, r)
+			case AuthAPIKey:
+				principal, outcome = s.authenticateAPIKey(w, r)
+			}
+			switch outcome {
+			case authAbsent:
+				continue
+			case authRejected:
+				return
+			}
+			r.Header.Set(headerAuthMethod, method)
+			r.Header.Set(headerPrincipal, principal)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if anonymous, ok := s.admitAnonymous(r); ok {
+			next.ServeHTTP(w, anonymous)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="mcp"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// authenticateMTLS はクライアント証明書の SPIFFE ID を SPIFFEAllow で認可します。
+func (s *Server) authenticateMTLS(w http.ResponseWriter, r *http.Request) (string, authOutcome) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return "", authAbsent
+	}
+	id, err := s.authorizeSPIFFE(r.TLS, s.cfg.SPIFFEAllow)
+	if err != nil {
+		s.logger.Warn("SPIFFE authorization failed", "spiffe_id", id, "path", r.URL.Path)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return "", authRejected
+	}
+	r.Header.Set(headerSPIFFEID, id)
+	return id, authAccepted
+}
+
+// authenticateJWT は API キーでない Bearer トークンを JWT として検証し、クレームを r のコンテキストに保存します。
+// マッピングで下流に渡せるよう、Authorization ヘッダーは削除しません。
+func (s *Server) authenticateJWT(w http.ResponseWriter, r *http.Request) (string, authOutcome) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" || strings.HasPrefix(token, apikey.Prefix) {
+		return "", authAbsent
+	}
+	claims, err := s.cfg.JWT.Verify(token)
+	if err != nil {
+		s.logger.Warn("JWT verification failed", "error", err, "path", r.URL.Path)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="mcp", error="invalid_token"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", authRejected
+	}
+	principal := s.cfg.JWT.Principal(claims)
+	if principal == "" {
+		s.logger.Warn("JWT has no principal claim", "path", r.URL.Path)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="mcp", error="invalid_token"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", authRejected
+	}
+	// r は認証チェーンで複製したリクエストのため、そのまま置き換える
+	*r = *r.WithContext(jwtauth.NewContext(r.Context(), claims))
+	return principal, authAccepted
+}
+
+// authenticateAPIKey は API キーを検証し、キーの ID とテナントを内部ヘッダーに設定します。
+func (s *Server) authenticateAPIKey(w http.ResponseWriter, r *http.Request) (string, authOutcome) {
+	token, fromBearer := apiKeyToken(r.Header)
+	if token == "" {
+		return "", authAbsent
+	}
+	key, ok := s.admitAPIKey(w, r, token)
+	if !ok {
+		return "", authRejected
+	}
+	setAPIKeyHeaders(r.Header, key, fromBearer)
+	return key.ID, authAccepted
+}
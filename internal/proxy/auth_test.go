@@ -0,0 +1,235 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/apikey"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jwtauth"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/spiffe"
+)
+
+var testJWTSecret = []byte("jwt-secret")
+
+// hs256Token は secret で HS256 の署名をした JWT を返します。
+func hs256Token(t *testing.T, secret []byte, claims map[string]any) string {
+	t.Helper()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newAuthChainServer は JWT と API キーの認証を設定した Server と、作成した API キーを返します。
+func newAuthChainServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	store, err := apikey.Open(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatalf("apikey.Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	token, _, err := store.Create(apikey.Key{Name: "ci", Tenant: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := jwtauth.NewVerifier(jwtauth.Config{Secret: testJWTSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	allow, err := spiffe.NewMatcher([]string{"spiffe://example.org/ns/prod/sa/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewServer(&Config{
+		Command:     "cat",
+		APIKeys:     store,
+		JWT:         verifier,
+		AuthMethods: []string{AuthJWT, AuthAPIKey},
+		SPIFFEAllow: allow,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	return server, token
+}
+
+func TestAuthChain(t *testing.T) {
+	server, key := newAuthChainServer(t)
+	var got http.Header
+	handler := server.authChain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}), []string{AuthMTLS, AuthJWT, AuthAPIKey})
+
+	validJWT := "Bearer " + hs256Token(t, testJWTSecret, map[string]any{"sub": "alice"})
+
+	tests := []struct {
+		name          string
+		state         *tls.ConnectionState
+		header        http.Header
+		wantStatus    int
+		wantMethod    string
+		wantPrincipal string
+		wantTenant    string
+		wantAuthz     bool
+	}{
+		{
+			name:          "SVID_mtlsで認証",
+			state:         peerState(t, "spiffe://example.org/ns/prod/sa/agent"),
+			header:        http.Header{"Authorization": {validJWT}},
+			wantStatus:    http.StatusOK,
+			wantMethod:    AuthMTLS,
+			wantPrincipal: "spiffe://example.org/ns/prod/sa/agent",
+			wantAuthz:     true,
+		},
+		{
+			name:       "許可されていないSVID_後の方式を試さず403",
+			state:      peerState(t, "spiffe://example.org/ns/dev/sa/agent"),
+			header:     http.Header{headerAPIKey: {key}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:          "証明書なしのJWT_jwtで認証しAuthorizationを残す",
+			header:        http.Header{"Authorization": {validJWT}},
+			wantStatus:    http.StatusOK,
+			wantMethod:    AuthJWT,
+			wantPrincipal: "alice",
+			wantAuthz:     true,
+		},
+		{
+			name:       "不正なJWT_後の方式を試さず401",
+			header:     http.Header{"Authorization": {"Bearer " + hs256Token(t, []byte("other"), map[string]any{"sub": "alice"})}, headerAPIKey: {key}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "プリンシパルのないJWT_401",
+			header:     http.Header{"Authorization": {"Bearer " + hs256Token(t, testJWTSecret, map[string]any{"scope": "read"})}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "BearerのAPIキー_apikeyで認証",
+			header:     http.Header{"Authorization": {"Bearer " + key}},
+			wantStatus: http.StatusOK,
+			wantMethod: AuthAPIKey,
+			wantTenant: "acme",
+		},
+		{
+			name:       "不正なAPIキー_401",
+			header:     http.Header{headerAPIKey: {apikey.Prefix + "unknown"}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "認証情報なし_401",
+			header:     http.Header{headerPrincipal: {"admin"}, headerAuthMethod: {AuthMTLS}},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			req := httptest.NewRequest("POST", "/mcp", nil)
+			req.TLS = tt.state
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if tt.wantStatus == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+					t.Error("WWW-Authenticate is not set")
+				}
+				return
+			}
+			if method := got.Get(headerAuthMethod); method != tt.wantMethod {
+				t.Errorf("%s = %q, want %q", headerAuthMethod, method, tt.wantMethod)
+			}
+			principal := got.Get(headerPrincipal)
+			if tt.wantMethod == AuthAPIKey {
+				// API キーのプリンシパルはキーの ID
+				if principal == "" || principal != got.Get(headerAPIKeyID) {
+					t.Errorf("%s = %q, want the key ID %q", headerPrincipal, principal, got.Get(headerAPIKeyID))
+				}
+			} else if principal != tt.wantPrincipal {
+				t.Errorf("%s = %q, want %q", headerPrincipal, principal, tt.wantPrincipal)
+			}
+			if tenant := got.Get(headerTenant); tenant != tt.wantTenant {
+				t.Errorf("%s = %q, want %q", headerTenant, tenant, tt.wantTenant)
+			}
+			if authz := got.Get("Authorization") != ""; authz != tt.wantAuthz {
+				t.Errorf("Authorization forwarded = %v, want %v", authz, tt.wantAuthz)
+			}
+		})
+	}
+}
+
+func TestAuthChain_Handler(t *testing.T) {
+	server, key := newAuthChainServer(t)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{name: "JWT_200", header: http.Header{"Authorization": {"Bearer " + hs256Token(t, testJWTSecret, map[string]any{"sub": "alice"})}}, want: http.StatusOK},
+		{name: "APIキー_200", header: http.Header{headerAPIKey: {key}}, want: http.StatusOK},
+		{name: "認証情報なし_401", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := postMCP(server, `{"jsonrpc":"2.0","id":1,"method":"ping"}`, tt.header); w.Code != tt.want {
+				t.Errorf("status = %d, want %d (body: %s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestNewServer_AuthMethods(t *testing.T) {
+	verifier, err := jwtauth.NewVerifier(jwtauth.Config{Secret: testJWTSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "未指定_従来の認証", cfg: Config{Command: "cat"}},
+		{name: "jwt_Verifierあり", cfg: Config{Command: "cat", AuthMethods: []string{AuthJWT}, JWT: verifier}},
+		{name: "不明な方式_エラー", cfg: Config{Command: "cat", AuthMethods: []string{"oauth"}}, wantErr: true},
+		{name: "重複_エラー", cfg: Config{Command: "cat", AuthMethods: []string{AuthJWT, AuthJWT}, JWT: verifier}, wantErr: true},
+		{name: "jwtのVerifierなし_エラー", cfg: Config{Command: "cat", AuthMethods: []string{AuthJWT}}, wantErr: true},
+		{name: "Verifierのみでjwtなし_エラー", cfg: Config{Command: "cat", JWT: verifier}, wantErr: true},
+		{name: "mtlsのSPIFFEなし_エラー", cfg: Config{Command: "cat", AuthMethods: []string{AuthMTLS}}, wantErr: true},
+		{name: "apikeyのストアなし_エラー", cfg: Config{Command: "cat", AuthMethods: []string{AuthAPIKey}}, wantErr: true},
+		{name: "gRPCと併用_エラー", cfg: Config{Command: "cat", AuthMethods: []string{AuthJWT}, JWT: verifier, GRPCPort: 9090}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewServer(&tt.cfg, slog.Default())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewServer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/egress"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// DefaultBackendVersion は起動時に指定したコマンドのバージョン名です。
+const DefaultBackendVersion = "default"
+
+var (
+	errBackendNotFound = errors.New("backend version not found")
+	errBackendActive   = errors.New("backend version is active")
+	errNoPrevious      = errors.New("no previous backend version to roll back to")
+
+	errMicroVMNotConfigured = errors.New("firecracker runtime requires a microVM configuration")
+)
+
+// Backend はバージョン名を付けた stdio コマンドです。
+// Runtime を指定した場合は Command をコンテナイメージとしてそのコンテナランタイムで実行します。
+type Backend struct {
+	Version string   `json:"version"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	Runtime string   `json:"runtime,omitempty"`
+
+	// EgressProxyAllow は EgressProxy のプロキシがこのバージョンのプロセスの接続を中継するホストです（nil で --egress-proxy-allow）。
+	EgressProxyAllow []string `json:"egressProxyAllow,omitempty"`
+}
+
+// validate は必須の項目とコンテナランタイムを検証します。
+func (b *Backend) validate() error {
+	if b.Version == "" || b.Command == "" {
+		return fmt.Errorf("version and command are required")
+	}
+	if _, err := egress.ParsePolicy(b.EgressProxyAllow); err != nil {
+		return err
+	}
+	return process.ValidateRuntime(b.Runtime)
+}
+
+// identity はランタイムとコマンドを合わせた、起動するプロセスの識別子です。
+func (b *Backend) identity() string {
+	if b.Runtime == "" {
+		return b.Command
+	}
+	return b.Runtime + "://" + b.Command
+}
+
+// backends は登録済みのコマンドと、新しいプロセスの起動に使うバージョンを管理します。
+// 切り替えは新しく起動するプロセスにのみ適用し、起動済みのプロセスはそのまま終了を待ちます。
+type backends struct {
+	mu       sync.RWMutex
+	versions map[string]*Backend
+	active   string
+	previous string
+
+	// クラスタ内で変更の前後を決めるための論理時刻と、最後に変更したノード
+	node     string
+	revision uint64
+	origin   string
+}
+
+// backendState はクラスタ内で共有するバックエンドの設定です。
+type backendState struct {
+	Revision uint64    `json:"revision"`
+	Origin   string    `json:"origin,omitempty"`
+	Active   string    `json:"active"`
+	Previous string    `json:"previous,omitempty"`
+	Versions []Backend `json:"versions"`
+}
+
+// newBackends は initial を有効なバージョンとする backends を作成します。
+func newBackends(initial Backend) *backends {
+	return &backends{
+		versions: map[string]*Backend{initial.Version: &initial},
+		active:   initial.Version,
+	}
+}
+
+// current は新しいプロセスの起動に使うコマンドを返します。
+func (b *backends) current() *Backend {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.versions[b.active]
+}
+
+// register はコマンドを登録します。有効なバージョンは置き換えられません。
+func (b *backends) register(backend Backend) error {
+	if err := backend.validate(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if backend.Version == b.active {
+		return errBackendActive
+	}
+	backend.Args = slices.Clone(backend.Args)
+	backend.EgressProxyAllow = slices.Clone(backend.EgressProxyAllow)
+	b.versions[backend.Version] = &backend
+	b.changed()
+	return nil
+}
+
+// activate は version を有効にし、それまで有効だったバージョンをロールバック先として記録します。
+// 切り替えた場合は true を返します。
+func (b *backends) activate(version string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.versions[version]; !ok {
+		return false, errBackendNotFound
+	}
+	if version == b.active {
+		return false, nil
+	}
+	b.previous, b.active = b.active, version
+	b.changed()
+	return true, nil
+}
+
+// rollback は直前に有効だったバージョンに戻します。
+func (b *backends) rollback() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.previous == "" {
+		return "", errNoPrevious
+	}
+	b.previous, b.active = b.active, b.previous
+	b.changed()
+	return b.active, nil
+}
+
+// changed は変更を記録します。b.mu を保持した状態で呼び出してください。
+func (b *backends) changed() {
+	b.revision++
+	b.origin = b.node
+}
+
+// state はクラスタ内で共有する現在の設定を返します。
+func (b *backends) state() backendState {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return backendState{Revision: b.revision, Origin: b.origin, Active: b.active, Previous: b.previous, Versions: b.listLocked()}
+}
+
+// merge は他のノードの設定の方が新しい場合に置き換え、起動するコマンドが変わったかを返します。
+// 論理時刻が同じ場合は変更したノードの URL で決め、全ノードが同じ設定に収束するようにします。
+func (b *backends) merge(remote backendState) (bool, error) {
+	versions := make(map[string]*Backend, len(remote.Versions))
+	for _, backend := range remote.Versions {
+		if err := backend.validate(); err != nil {
+			return false, fmt.Errorf("invalid backend in cluster state: %q: %w", backend.Version, err)
+		}
+		versions[backend.Version] = &backend
+	}
+	if _, ok := versions[remote.Active]; !ok {
+		return false, fmt.Errorf("active backend %q is not defined in cluster state", remote.Active)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if remote.Revision < b.revision || (remote.Revision == b.revision && remote.Origin <= b.origin) {
+		return false, nil
+	}
+	current, next := b.versions[b.active], versions[remote.Active]
+	activeChanged := current.identity() != next.identity() || !slices.Equal(current.Args, next.Args)
+	b.versions = versions
+	b.active = remote.Active
+	b.previous = remote.Previous
+	b.revision = remote.Revision
+	b.origin = remote.Origin
+	return activeChanged, nil
+}
+
+// snapshot は登録済みのコマンドをバージョン名の順に返します。
+func (b *backends) snapshot() (active, previous string, list []Backend) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.active, b.previous, b.listLocked()
+}
+
+// listLocked は登録済みのコマンドをバージョン名の順に返します。b.mu を保持した状態で呼び出してください。
+func (b *backends) listLocked() []Backend {
+	list := make([]Backend, 0, len(b.versions))
+	for _, backend := range b.versions {
+		list = append(list, *backend)
+	}
+	slices.SortFunc(list, func(x, y Backend) int {
+		return strings.Compare(x.Version, y.Version)
+	})
+	return list
+}
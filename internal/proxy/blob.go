@@ -0,0 +1,235 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultBlobTTL はオフロードしたバイナリを保持するデフォルトの期間です。
+const DefaultBlobTTL = 10 * time.Minute
+
+// blobMetaKey はオフロード先の情報を格納する _meta のキーです。
+const blobMetaKey = "io.tumiki/download"
+
+// blobPathPrefix はオフロードしたバイナリのダウンロードエンドポイントです。
+const blobPathPrefix = "/mcp/blobs/"
+
+// blobEntry はオフロードした1件のバイナリです。
+type blobEntry struct {
+	path      string
+	mimeType  string
+	filename  string // Content-Disposition で返すファイル名（空文字列で返さない）
+	size      int64
+	expiresAt time.Time
+}
+
+// blobStore はレスポンスから切り出した大きなバイナリを一時ファイルとして保持します。
+type blobStore struct {
+	dir       string
+	threshold int
+	ttl       time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*blobEntry
+}
+
+func newBlobStore(threshold int, ttl time.Duration) (*blobStore, error) {
+	dir, err := os.MkdirTemp("", "tumiki-mcp-blobs-")
+	if err != nil {
+		return nil, fmt.Errorf("create blob directory: %w", err)
+	}
+	if ttl <= 0 {
+		ttl = DefaultBlobTTL
+	}
+	return &blobStore{
+		dir:       dir,
+		threshold: threshold,
+		ttl:       ttl,
+		now:       time.Now,
+		entries:   make(map[string]*blobEntry),
+	}, nil
+}
+
+// put はバイナリを一時ファイルに保存し、ダウンロード用の ID を返します。
+func (b *blobStore) put(data []byte, mimeType string) (string, error) {
+	b.evictExpired()
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate blob id: %w", err)
+	}
+	id := hex.EncodeToString(buf)
+
+	path := filepath.Join(b.dir, id)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", fmt.Errorf("write blob: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries[id] = &blobEntry{
+		path:      path,
+		mimeType:  mimeType,
+		size:      int64(len(data)),
+		expiresAt: b.now().Add(b.ttl),
+	}
+	return id, nil
+}
+
+func (b *blobStore) get(id string) (*blobEntry, bool) {
+	b.evictExpired()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry, ok := b.entries[id]
+	return entry, ok
+}
+
+func (b *blobStore) evictExpired() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	for id, entry := range b.entries {
+		if now.After(entry.expiresAt) {
+			_ = os.Remove(entry.path)
+			delete(b.entries, id)
+		}
+	}
+}
+
+// close は保持している全てのバイナリを削除します。
+func (b *blobStore) close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = make(map[string]*blobEntry)
+	return os.RemoveAll(b.dir)
+}
+
+// offload は JSON-RPC メッセージ中のしきい値を超える base64 データを一時ファイルに切り出し、
+// 元のフィールドを空にして _meta にダウンロード URL を追加します。
+// 対象は resources/read の contents[].blob と、image/audio コンテンツの data です。
+// 切り出し対象がない場合は元のメッセージをそのまま返します。
+func (b *blobStore) offload(msg []byte) ([]byte, error) {
+	if len(msg) <= b.threshold {
+		return msg, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(msg))
+	decoder.UseNumber()
+	var root any
+	if err := decoder.Decode(&root); err != nil {
+		// JSON でない出力はそのまま返す
+		return msg, nil
+	}
+
+	changed, err := b.walk(root)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return msg, nil
+	}
+	return json.Marshal(root)
+}
+
+func (b *blobStore) walk(node any) (bool, error) {
+	changed := false
+	switch v := node.(type) {
+	case map[string]any:
+		offloaded, err := b.offloadObject(v)
+		if err != nil {
+			return false, err
+		}
+		changed = offloaded
+		for _, child := range v {
+			c, err := b.walk(child)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || c
+		}
+	case []any:
+		for _, child := range v {
+			c, err := b.walk(child)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || c
+		}
+	}
+	return changed, nil
+}
+
+func (b *blobStore) offloadObject(obj map[string]any) (bool, error) {
+	field := ""
+	switch {
+	case obj["blob"] != nil:
+		field = "blob"
+	case obj["type"] == "image" || obj["type"] == "audio":
+		field = "data"
+	default:
+		return false, nil
+	}
+
+	encoded, ok := obj[field].(string)
+	if !ok || len(encoded) <= b.threshold {
+		return false, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		// base64 でないデータは切り出さない
+		return false, nil
+	}
+
+	mimeType, _ := obj["mimeType"].(string)
+	id, err := b.put(data, mimeType)
+	if err != nil {
+		return false, err
+	}
+
+	obj[field] = ""
+	meta, ok := obj["_meta"].(map[string]any)
+	if !ok {
+		meta = make(map[string]any)
+		obj["_meta"] = meta
+	}
+	meta[blobMetaKey] = map[string]any{
+		"url":  blobPathPrefix + id,
+		"size": len(data),
+	}
+	return true, nil
+}
+
+// handleBlob はオフロードしたバイナリを Range リクエスト対応で返却します。
+func (b *blobStore) handleBlob(w http.ResponseWriter, r *http.Request) {
+	entry, ok := b.get(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(entry.path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	if entry.mimeType != "" {
+		w.Header().Set("Content-Type", entry.mimeType)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	// ファイル全体をメモリに載せずにストリーミングする
+	http.ServeContent(w, r, "", time.Time{}, f)
+}
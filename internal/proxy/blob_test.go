@@ -0,0 +1,239 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestBlobStore(t *testing.T, threshold int) *blobStore {
+	t.Helper()
+	store, err := newBlobStore(threshold, time.Minute)
+	if err != nil {
+		t.Fatalf("newBlobStore() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.close() })
+	return store
+}
+
+// downloadMeta はオフロード後のオブジェクトから _meta のダウンロード情報を取り出します。
+func downloadMeta(t *testing.T, obj map[string]any) map[string]any {
+	t.Helper()
+	meta, ok := obj["_meta"].(map[string]any)
+	if !ok {
+		t.Fatalf("_meta not found in %v", obj)
+	}
+	download, ok := meta[blobMetaKey].(map[string]any)
+	if !ok {
+		t.Fatalf("%s not found in %v", blobMetaKey, meta)
+	}
+	return download
+}
+
+func TestBlobStore_Offload(t *testing.T) {
+	large := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", 100)))
+	small := base64.StdEncoding.EncodeToString([]byte("x"))
+
+	tests := []struct {
+		name        string
+		msg         string
+		wantChanged bool
+	}{
+		{
+			name:        "しきい値を超えるresourceのblob_オフロードされる",
+			msg:         `{"jsonrpc":"2.0","id":1,"result":{"contents":[{"uri":"file:///a.png","mimeType":"image/png","blob":"` + large + `"}]}}`,
+			wantChanged: true,
+		},
+		{
+			name:        "しきい値を超えるimageコンテンツ_オフロードされる",
+			msg:         `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"image","mimeType":"image/png","data":"` + large + `"}]}}`,
+			wantChanged: true,
+		},
+		{
+			name:        "しきい値以下のblob_そのまま返す",
+			msg:         `{"jsonrpc":"2.0","id":1,"result":{"contents":[{"uri":"file:///a","blob":"` + small + `"}],"pad":"` + strings.Repeat("p", 200) + `"}}`,
+			wantChanged: false,
+		},
+		{
+			name:        "テキストコンテンツ_そのまま返す",
+			msg:         `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"` + strings.Repeat("t", 200) + `"}]}}`,
+			wantChanged: false,
+		},
+		{
+			name:        "base64でないblob_そのまま返す",
+			msg:         `{"jsonrpc":"2.0","id":1,"result":{"contents":[{"uri":"file:///a","blob":"` + strings.Repeat("!", 200) + `"}]}}`,
+			wantChanged: false,
+		},
+		{
+			name:        "JSONでない出力_そのまま返す",
+			msg:         strings.Repeat("not json ", 20),
+			wantChanged: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestBlobStore(t, 64)
+
+			got, err := store.offload([]byte(tt.msg))
+			if err != nil {
+				t.Fatalf("offload() error = %v", err)
+			}
+
+			changed := string(got) != tt.msg
+			if changed != tt.wantChanged {
+				t.Errorf("offload() changed = %v, want %v (got: %s)", changed, tt.wantChanged, got)
+			}
+			if len(store.entries) != map[bool]int{true: 1, false: 0}[tt.wantChanged] {
+				t.Errorf("stored entries = %d", len(store.entries))
+			}
+		})
+	}
+}
+
+func TestBlobStore_HandleBlob(t *testing.T) {
+	store := newTestBlobStore(t, 8)
+	payload := []byte("0123456789abcdef")
+	msg := `{"result":{"contents":[{"uri":"file:///a.bin","mimeType":"application/x-test","blob":"` +
+		base64.StdEncoding.EncodeToString(payload) + `"}]}}`
+
+	got, err := store.offload([]byte(msg))
+	if err != nil {
+		t.Fatalf("offload() error = %v", err)
+	}
+
+	var parsed struct {
+		Result struct {
+			Contents []map[string]any `json:"contents"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(got, &parsed); err != nil {
+		t.Fatalf("invalid JSON after offload: %v", err)
+	}
+	content := parsed.Result.Contents[0]
+	if content["blob"] != "" {
+		t.Errorf("blob should be emptied, got %v", content["blob"])
+	}
+	download := downloadMeta(t, content)
+	if download["size"] != float64(len(payload)) {
+		t.Errorf("size = %v, want %d", download["size"], len(payload))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+blobPathPrefix+"{id}", store.handleBlob)
+
+	tests := []struct {
+		name        string
+		url         string
+		rangeHeader string
+		wantStatus  int
+		wantBody    string
+	}{
+		{name: "全体取得_元のバイナリを返す", url: download["url"].(string), wantStatus: http.StatusOK, wantBody: string(payload)},
+		{name: "Range指定_部分を返す", url: download["url"].(string), rangeHeader: "bytes=2-5", wantStatus: http.StatusPartialContent, wantBody: "2345"},
+		{name: "存在しないID_404を返す", url: blobPathPrefix + "unknown", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.rangeHeader != "" {
+				req.Header.Set("Range", tt.rangeHeader)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" {
+				body, _ := io.ReadAll(w.Body)
+				if string(body) != tt.wantBody {
+					t.Errorf("body = %s, want %s", body, tt.wantBody)
+				}
+				if ct := w.Header().Get("Content-Type"); ct != "application/x-test" {
+					t.Errorf("Content-Type = %s, want application/x-test", ct)
+				}
+			}
+		})
+	}
+}
+
+func TestBlobStore_Expiry(t *testing.T) {
+	store := newTestBlobStore(t, 1)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	id, err := store.put([]byte("data"), "")
+	if err != nil {
+		t.Fatalf("put() error = %v", err)
+	}
+	if _, ok := store.get(id); !ok {
+		t.Fatal("get() should find a fresh blob")
+	}
+
+	// 保持期間経過後は削除される
+	now = now.Add(2 * time.Minute)
+	if _, ok := store.get(id); ok {
+		t.Error("get() should not find an expired blob")
+	}
+	if _, err := os.Stat(store.dir + "/" + id); !os.IsNotExist(err) {
+		t.Errorf("expired blob file should be removed, stat err = %v", err)
+	}
+}
+
+func TestNewServer_BlobEndpoint(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	payload := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("z", 64)))
+
+	cfg := &Config{
+		Port:             8080,
+		Command:          "sh",
+		Args:             []string{"-c", `read line; echo '{"jsonrpc":"2.0","id":1,"result":{"contents":[{"uri":"file:///z","blob":"` + payload + `"}]}}'`},
+		DefaultEnv:       map[string]string{},
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+		BlobThreshold:    16,
+	}
+
+	server, err := NewServer(cfg, logger)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer func() { _ = server.blobs.close() }()
+
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"resources/read"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want 200 (body: %s)", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), blobPathPrefix) {
+		t.Fatalf("response should contain a download URL: %s", w.Body.String())
+	}
+
+	var parsed struct {
+		Result struct {
+			Contents []map[string]any `json:"contents"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &parsed); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	url := downloadMeta(t, parsed.Result.Contents[0])["url"].(string)
+
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	if w.Body.String() != strings.Repeat("z", 64) {
+		t.Errorf("downloaded body = %s", w.Body.String())
+	}
+}
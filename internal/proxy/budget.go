@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/webhook"
+)
+
+// 上限を超えた実行の予算の種類
+const (
+	budgetLimitCPU   = "cpu"   // プロセスが使った CPU 時間
+	budgetLimitCalls = "calls" // プロセスに送ったリクエストの数
+	budgetLimitBytes = "bytes" // プロセスとやり取りしたメッセージのバイト数
+)
+
+// SessionBudget はセッションごとの実行の予算です。いずれかの上限に達したセッションは次のリクエストで終了させます。
+// エージェントのループが止まらずにプロセスを使い続けることを防ぎます。
+type SessionBudget struct {
+	MaxCPU   time.Duration // プロセスが使った CPU 時間の合計（0 で無制限。コンテナと WASI では計測できないため適用しない）
+	MaxCalls int           // プロセスに送るリクエストの数（0 で無制限）
+	MaxBytes int64         // プロセスに送ったメッセージとレスポンスのバイト数の合計（0 で無制限）
+}
+
+// enabled はいずれかの上限が設定されているかどうかを返します。
+func (b SessionBudget) enabled() bool {
+	return b.MaxCPU > 0 || b.MaxCalls > 0 || b.MaxBytes > 0
+}
+
+// validate は上限が負の値でないことを確認します。
+func (b SessionBudget) validate() error {
+	if b.MaxCPU < 0 || b.MaxCalls < 0 || b.MaxBytes < 0 {
+		return fmt.Errorf("session budget limits must not be negative")
+	}
+	return nil
+}
+
+// budgetMeter は1つのセッションが使った予算を数えます。nil の場合は何も数えません。
+type budgetMeter struct {
+	limits SessionBudget
+	calls  atomic.Int64
+	bytes  atomic.Int64
+}
+
+// newBudgetMeter は上限が設定されている場合に budgetMeter を返します。
+func newBudgetMeter(limits *SessionBudget) *budgetMeter {
+	if limits == nil || !limits.enabled() {
+		return nil
+	}
+	return &budgetMeter{limits: *limits}
+}
+
+// budgetExceededData は予算を超えたセッションへのエラーレスポンスの data です。
+type budgetExceededData struct {
+	Reason string  `json:"reason"` // 常に "session_budget_exceeded"
+	Limit  string  `json:"limit"`  // 上限に達した予算（cpu / calls / bytes）
+	Used   float64 `json:"used"`   // 使った量（cpu は秒）
+	Max    float64 `json:"max"`    // 上限（cpu は秒）
+}
+
+// admit はメッセージをプロセスに送る前に、上限に達していないことを確認して使った量に加えます。
+// リクエストの数には通知とレスポンスを含めません。上限に達している場合はメッセージを数えずに、その内容を返します。
+func (m *budgetMeter) admit(session *process.Session, msg []byte) *budgetExceededData {
+	if m == nil {
+		return nil
+	}
+	if exceeded := m.exceeded(session); exceeded != nil {
+		return exceeded
+	}
+	if parsed, err := jsonrpc.Parse(msg); err == nil && parsed.IsRequest() {
+		m.calls.Add(1)
+	}
+	m.bytes.Add(int64(len(msg)))
+	return nil
+}
+
+// record はプロセスから受け取ったレスポンスのバイト数を使った量に加えます。
+func (m *budgetMeter) record(msg []byte) {
+	if m == nil {
+		return
+	}
+	m.bytes.Add(int64(len(msg)))
+}
+
+// exceeded は上限に達した予算を返します。達していない場合は nil を返します。
+func (m *budgetMeter) exceeded(session *process.Session) *budgetExceededData {
+	if limit := m.limits.MaxCalls; limit > 0 {
+		if used := m.calls.Load(); used >= int64(limit) {
+			return newBudgetExceeded(budgetLimitCalls, float64(used), float64(limit))
+		}
+	}
+	if limit := m.limits.MaxBytes; limit > 0 {
+		if used := m.bytes.Load(); used >= limit {
+			return newBudgetExceeded(budgetLimitBytes, float64(used), float64(limit))
+		}
+	}
+	if limit := m.limits.MaxCPU; limit > 0 {
+		if used, ok := session.CPUTime(); ok && used >= limit {
+			return newBudgetExceeded(budgetLimitCPU, used.Seconds(), limit.Seconds())
+		}
+	}
+	return nil
+}
+
+func newBudgetExceeded(kind string, used, limit float64) *budgetExceededData {
+	return &budgetExceededData{Reason: "session_budget_exceeded", Limit: kind, Used: used, Max: limit}
+}
+
+// budgetExceeded は予算を超えたセッションを終了させ、リクエストには data に内容を含めた JSON-RPC のエラーを返します。
+// 通知とレスポンスには 410 を返します。
+func (p *subscriptions) budgetExceeded(w http.ResponseWriter, id string, body []byte, responseType string, exceeded *budgetExceededData) {
+	p.server.logger.Warn("Session budget exceeded, terminating session",
+		"session", id, "limit", exceeded.Limit, "used", exceeded.Used, "max", exceeded.Max)
+	p.terminate(id, webhook.ReasonBudget)
+
+	msg, err := jsonrpc.Parse(body)
+	if err != nil || !msg.IsRequest() {
+		http.Error(w, "Session budget exceeded", http.StatusGone)
+		return
+	}
+	data, _ := json.Marshal(exceeded)
+	response := jsonrpc.NewErrorResponseWithData(msg.ID, jsonrpc.CodeInternalError,
+		fmt.Sprintf("session budget exceeded: %s", exceeded.Limit), data)
+	if err := writeMessage(w, responseType, response); err != nil {
+		p.server.logger.Debug("Failed to write response", "error", err)
+	}
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/webhook"
+)
+
+const budgetToolCall = `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`
+
+func TestSessionBudget_上限を超えたセッションを終了(t *testing.T) {
+	tests := []struct {
+		name      string
+		budget    SessionBudget
+		allowed   int // initialize の後に成功する tools/call の数
+		wantLimit string
+	}{
+		{name: "リクエスト数", budget: SessionBudget{MaxCalls: 3}, allowed: 2, wantLimit: budgetLimitCalls},
+		{name: "バイト数", budget: SessionBudget{MaxBytes: 1}, allowed: 0, wantLimit: budgetLimitBytes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook, events := newWebhookReceiver(t)
+			server, httpServer := newSessionServer(t, &Config{Sessions: true, SessionBudget: &tt.budget, SessionWebhook: hook})
+			runSessionEvents(t, server)
+
+			id := initializeSession(t, httpServer.URL, http.Header{})
+			nextSessionEvent(t, events, webhook.EventSessionCreated)
+			for i := range tt.allowed {
+				resp := subscriptionRequest(t, "POST", httpServer.URL, id, budgetToolCall)
+				_ = resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("call %d status = %d, want %d", i+1, resp.StatusCode, http.StatusOK)
+				}
+			}
+
+			resp := subscriptionRequest(t, "POST", httpServer.URL, id, budgetToolCall)
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			var msg struct {
+				ID    int `json:"id"`
+				Error struct {
+					Message string             `json:"message"`
+					Data    budgetExceededData `json:"data"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(body, &msg); err != nil {
+				t.Fatalf("response = %s, want a JSON-RPC error: %v", body, err)
+			}
+			data := msg.Error.Data
+			if msg.ID != 2 || data.Reason != "session_budget_exceeded" || data.Limit != tt.wantLimit || data.Used < data.Max {
+				t.Errorf("response = %s, want the %s budget error", body, tt.wantLimit)
+			}
+			if got := nextSessionEvent(t, events, webhook.EventSessionTerminated); got.Session.ID != id || got.Reason != webhook.ReasonBudget {
+				t.Errorf("terminated = %+v, want reason %q", got, webhook.ReasonBudget)
+			}
+			if _, ok := server.subscriptions.get(id); ok {
+				t.Error("session is still registered after exceeding the budget")
+			}
+		})
+	}
+}
+
+func TestSessionBudget_通知_410(t *testing.T) {
+	_, httpServer := newSessionServer(t, &Config{Sessions: true, SessionBudget: &SessionBudget{MaxCalls: 1}})
+
+	id := initializeSession(t, httpServer.URL, http.Header{})
+	// 上限に達したセッションへの通知にはレスポンスを返せないため 410 を返す
+	resp := subscriptionRequest(t, "POST", httpServer.URL, id, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusGone {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusGone)
+	}
+}
+
+func TestBudgetMeter_通知とレスポンスは数えない(t *testing.T) {
+	m := newBudgetMeter(&SessionBudget{MaxCalls: 1})
+	for _, msg := range []string{
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":"s1","result":{}}`,
+		`{"jsonrpc":"2.0","id":1,"method":"ping"}`,
+	} {
+		if exceeded := m.admit(nil, []byte(msg)); exceeded != nil {
+			t.Fatalf("admit(%s) = %+v, want nil", msg, exceeded)
+		}
+	}
+	if got := m.calls.Load(); got != 1 {
+		t.Errorf("calls = %d, want 1", got)
+	}
+}
+
+func TestNewBudgetMeter_上限なし_nil(t *testing.T) {
+	if m := newBudgetMeter(nil); m != nil {
+		t.Error("newBudgetMeter(nil) != nil")
+	}
+	if m := newBudgetMeter(&SessionBudget{}); m != nil {
+		t.Error("newBudgetMeter(&SessionBudget{}) != nil")
+	}
+	// nil のメソッド呼び出しは何もしない
+	var m *budgetMeter
+	if exceeded := m.admit(nil, []byte(budgetToolCall)); exceeded != nil {
+		t.Errorf("admit() = %+v, want nil", exceeded)
+	}
+	m.record([]byte(budgetToolCall))
+}
+
+func TestNewServer_SessionBudget負の値_エラー(t *testing.T) {
+	for _, budget := range []SessionBudget{{MaxCPU: -time.Second}, {MaxCalls: -1}, {MaxBytes: -1}} {
+		if _, err := NewServer(&Config{Command: "cat", SessionBudget: &budget}, slog.New(slog.NewTextHandler(io.Discard, nil))); err == nil {
+			t.Errorf("NewServer(%+v) error = nil", budget)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/cache"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/metrics"
+)
+
+// headerCacheStatus はキャッシュの利用結果（hit / miss / bypass）を返すレスポンスヘッダーです。
+const headerCacheStatus = "X-Tumiki-Cache"
+
+// キャッシュの利用結果です。
+const (
+	cacheHit    = "hit"
+	cacheMiss   = "miss"
+	cacheBypass = "bypass"
+)
+
+// responseCache はキャッシュルールに一致したリクエストのプロセスのレスポンスを保持します。
+type responseCache struct {
+	rules    cache.Rules
+	store    *cache.Store
+	requests *metrics.Counter
+}
+
+func newResponseCache(rules cache.Rules, maxEntries int, m *metrics.Registry) *responseCache {
+	c := &responseCache{
+		rules:    rules,
+		store:    cache.NewStore(maxEntries),
+		requests: m.Counter("tumiki_cache_requests_total", "Number of requests matching a cache rule by result.", "method", "result"),
+	}
+	evictions := m.Counter("tumiki_cache_evictions_total", "Number of cached responses evicted by the size limit.")
+	c.store.OnEvict = func() { evictions.Inc() }
+	m.GaugeFunc("tumiki_cache_entries", "Number of cached responses.", func() float64 {
+		return float64(c.store.Len())
+	})
+	return c
+}
+
+// cacheEntry はキャッシュを検索したリクエストの情報です。rule が nil の場合はキャッシュの対象外です。
+type cacheEntry struct {
+	rule   *cache.Rule
+	key    string
+	method string
+	server string
+	status string
+}
+
+// cacheLookup はルールに一致するリクエストのキャッシュを検索し、あればリクエストの ID に置き換えたレスポンスを返します。
+// キャッシュのキーにはメソッド・パラメータ・Vary のヘッダーに加えて、
+// ヘッダーから決まるバックエンド・環境変数・引数を含めるため、異なる認証情報のレスポンスは共有しません。
+func (s *Server) cacheLookup(header http.Header, body []byte) (cacheEntry, []byte) {
+	if s.cache == nil {
+		return cacheEntry{}, nil
+	}
+	msg, err := jsonrpc.Parse(body)
+	if err != nil || !msg.IsRequest() {
+		return cacheEntry{}, nil
+	}
+	backend, env, args := s.processConfig(header)
+	rule := s.cache.rules.Match(msg.Method, backend.Version)
+	if rule == nil {
+		return cacheEntry{}, nil
+	}
+
+	h := sha256.New()
+	h.Write([]byte(backend.Version + "\x00" + processFingerprint(backend.identity(), env, args) + "\x00" + msg.Method + "\x00"))
+	h.Write(msg.Params)
+	for _, name := range rule.Vary {
+		h.Write([]byte("\x00" + name + "=" + header.Get(name)))
+	}
+	entry := cacheEntry{rule: rule, key: hex.EncodeToString(h.Sum(nil)), method: msg.Method, server: backend.Version}
+
+	if rule.Bypass(header) {
+		entry.status = cacheBypass
+	} else if cached, ok := s.cache.store.Get(entry.key); ok {
+		if response, err := jsonrpc.WithID(cached, msg.ID); err == nil {
+			entry.status = cacheHit
+			s.cache.requests.Inc(entry.method, entry.status)
+			return entry, response
+		}
+	}
+	if entry.status == "" {
+		entry.status = cacheMiss
+	}
+	s.cache.requests.Inc(entry.method, entry.status)
+	return entry, nil
+}
+
+// cacheStore はキャッシュの対象のリクエストに対する成功レスポンスを保存します。
+func (s *Server) cacheStore(entry cacheEntry, response []byte) {
+	if entry.rule == nil {
+		return
+	}
+	msg, err := jsonrpc.Parse(response)
+	if err != nil || !msg.IsResponse() || msg.Error != nil {
+		return
+	}
+	s.cache.store.Set(entry.key, cache.Entry{Method: entry.method, Server: entry.server, Body: response}, entry.rule.Expiry())
+}
+
+// cachePurgeResult は DELETE /admin/cache のレスポンスです。
+type cachePurgeResult struct {
+	Purged int `json:"purged"`
+}
+
+// handlePurgeCache はクエリの method と server に一致するキャッシュを削除します（指定しない条件は全てに一致）。
+func (s *Server) handlePurgeCache(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	purged := s.cache.store.Purge(query.Get("method"), query.Get("server"))
+	s.logger.Info("Purged response cache", "method", query.Get("method"), "server", query.Get("server"), "purged", purged)
+	s.writeJSON(w, cachePurgeResult{Purged: purged})
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/cache"
+)
+
+// newCacheServer はプロセスを起動するたびにカウンタファイルに1行追記するサーバーを作成します。
+func newCacheServer(t *testing.T, rules cache.Rules) (*Server, string) {
+	t.Helper()
+	counter := filepath.Join(t.TempDir(), "count")
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", `echo x >> "$COUNTER"; read line; echo '{"jsonrpc":"2.0","id":7,"result":{"tenant":"'"$TENANT"'"}}'`},
+		DefaultEnv:       map[string]string{"COUNTER": counter},
+		HeaderEnvMapping: map[string]string{"X-Tenant": "TENANT"},
+		AdminToken:       testAdminToken,
+		CacheRules:       rules,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	return server, counter
+}
+
+// runs はプロセスを起動した回数を返します。
+func runs(t *testing.T, counter string) int {
+	t.Helper()
+	data, err := os.ReadFile(counter)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+func cachedRequest(server *Server, id, method string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":`+id+`,"method":"`+method+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func TestHandler_Cache(t *testing.T) {
+	rules := cache.Rules{{Method: "tools/list", TTL: "1m", BypassHeader: "X-No-Cache"}}
+	if err := rules.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	server, counter := newCacheServer(t, rules)
+
+	steps := []struct {
+		name       string
+		id         string
+		method     string
+		headers    map[string]string
+		wantStatus string
+		wantRuns   int
+		wantBody   string
+	}{
+		{name: "初回_プロセスを実行", id: "1", method: "tools/list", headers: map[string]string{"X-Tenant": "a"}, wantStatus: cacheMiss, wantRuns: 1},
+		{name: "同じリクエスト_キャッシュからIDを置き換えて返す", id: `"two"`, method: "tools/list", headers: map[string]string{"X-Tenant": "a"}, wantStatus: cacheHit, wantRuns: 1, wantBody: `{"id":"two","jsonrpc":"2.0","result":{"tenant":"a"}}`},
+		{name: "マッピングする値が異なる_共有しない", id: "3", method: "tools/list", headers: map[string]string{"X-Tenant": "b"}, wantStatus: cacheMiss, wantRuns: 2},
+		{name: "迂回ヘッダー_プロセスを実行", id: "4", method: "tools/list", headers: map[string]string{"X-Tenant": "a", "X-No-Cache": "1"}, wantStatus: cacheBypass, wantRuns: 3},
+		{name: "対象外のメソッド_キャッシュしない", id: "5", method: "ping", headers: map[string]string{"X-Tenant": "a"}, wantRuns: 4},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			w := cachedRequest(server, step.id, step.method, step.headers)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Status = %d (body: %s)", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get(headerCacheStatus); got != step.wantStatus {
+				t.Errorf("%s = %q, want %q", headerCacheStatus, got, step.wantStatus)
+			}
+			if got := runs(t, counter); got != step.wantRuns {
+				t.Errorf("process runs = %d, want %d", got, step.wantRuns)
+			}
+			if step.wantBody != "" && strings.TrimSpace(w.Body.String()) != step.wantBody {
+				t.Errorf("body = %s, want %s", w.Body.String(), step.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandler_CachePurge(t *testing.T) {
+	rules := cache.Rules{{Method: "tools/list", TTL: "1m"}}
+	if err := rules.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	server, counter := newCacheServer(t, rules)
+
+	cachedRequest(server, "1", "tools/list", nil)
+	w := keyAdminRequest(t, server, "DELETE", "/admin/cache?method=tools/list", "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"purged":1}` {
+		t.Fatalf("DELETE /admin/cache = %d %s, want 1 purged", w.Code, w.Body.String())
+	}
+	if w := cachedRequest(server, "2", "tools/list", nil); w.Header().Get(headerCacheStatus) != cacheMiss || runs(t, counter) != 2 {
+		t.Errorf("request after purge = %q with %d runs, want a miss", w.Header().Get(headerCacheStatus), runs(t, counter))
+	}
+}
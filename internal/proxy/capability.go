@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// serverCapabilities は initialize の結果でサーバーが広告する機能です。
+var serverCapabilities = map[string]bool{
+	"tools": true, "resources": true, "prompts": true, "logging": true, "completions": true, "experimental": true,
+}
+
+// clientCapabilities は initialize のリクエストでクライアントが伝える機能です。
+var clientCapabilities = map[string]bool{
+	"sampling": true, "roots": true, "elicitation": true, "experimental": true,
+}
+
+// capabilityMask は initialize でやり取りする機能の広告から、設定した機能を取り除きます。
+// サーバーの機能（例: "prompts", "resources.subscribe"）はクライアントに返す結果から、
+// クライアントの機能（例: "sampling"）はプロセスに送るリクエストから削除します。
+type capabilityMask struct {
+	server [][]string // result.capabilities から削除するパス
+	client [][]string // params.capabilities から削除するパス
+}
+
+// newCapabilityMask は "prompts" や "tools.listChanged" のようなドット区切りの機能名を検証して capabilityMask を作成します。
+// 両方に存在する "experimental" は両方から削除します。
+func newCapabilityMask(names []string) (*capabilityMask, error) {
+	m := &capabilityMask{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		path := strings.Split(name, ".")
+		if name == "" || strings.Contains(name, "..") || strings.HasSuffix(name, ".") {
+			return nil, fmt.Errorf("invalid capability %q", name)
+		}
+		server, client := serverCapabilities[path[0]], clientCapabilities[path[0]]
+		if !server && !client {
+			return nil, fmt.Errorf("unknown capability %q (supported: tools, resources, prompts, logging, completions, sampling, roots, elicitation, experimental)", name)
+		}
+		if server {
+			m.server = append(m.server, path)
+		}
+		if client {
+			m.client = append(m.client, path)
+		}
+	}
+	return m, nil
+}
+
+// request は initialize のリクエストの params.capabilities からクライアントの機能を削除します。
+// initialize 以外のメッセージと削除するものがない場合はそのまま返します。
+func (m *capabilityMask) request(body []byte) []byte {
+	if len(m.client) == 0 {
+		return body
+	}
+	var msg map[string]any
+	if json.Unmarshal(body, &msg) != nil || msg["method"] != "initialize" {
+		return body
+	}
+	return maskCapabilities(body, msg, "params", m.client)
+}
+
+// response は initialize の結果の result.capabilities からサーバーの機能を削除します。
+func (m *capabilityMask) response(msg []byte, method string) []byte {
+	if len(m.server) == 0 || method != "initialize" {
+		return msg
+	}
+	var parsed map[string]any
+	if json.Unmarshal(msg, &parsed) != nil {
+		return msg
+	}
+	return maskCapabilities(msg, parsed, "result", m.server)
+}
+
+// maskCapabilities は msg[field].capabilities からパスを削除して再エンコードします。何も削除しなかった場合は元のバイト列を返します。
+func maskCapabilities(original []byte, msg map[string]any, field string, paths [][]string) []byte {
+	container, _ := msg[field].(map[string]any)
+	capabilities, _ := container["capabilities"].(map[string]any)
+	if capabilities == nil {
+		return original
+	}
+	changed := false
+	for _, path := range paths {
+		if deletePath(capabilities, path) {
+			changed = true
+		}
+	}
+	if !changed {
+		return original
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return original
+	}
+	return data
+}
+
+// deletePath はネストしたオブジェクトからキーのパスを削除し、削除したかどうかを返します。
+func deletePath(node map[string]any, path []string) bool {
+	for _, key := range path[:len(path)-1] {
+		child, ok := node[key].(map[string]any)
+		if !ok {
+			return false
+		}
+		node = child
+	}
+	last := path[len(path)-1]
+	if _, ok := node[last]; !ok {
+		return false
+	}
+	delete(node, last)
+	return true
+}
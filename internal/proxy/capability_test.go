@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestCapabilityMask(t *testing.T) {
+	tests := []struct {
+		name     string
+		hide     []string
+		request  string
+		response string
+		method   string
+		wantReq  string
+		wantResp string
+	}{
+		{
+			name:     "サーバーの機能_結果から削除",
+			hide:     []string{"prompts", "resources.subscribe"},
+			method:   "initialize",
+			response: `{"jsonrpc":"2.0","id":1,"result":{"capabilities":{"prompts":{},"resources":{"listChanged":true,"subscribe":true},"tools":{}}}}`,
+			wantResp: `{"id":1,"jsonrpc":"2.0","result":{"capabilities":{"resources":{"listChanged":true},"tools":{}}}}`,
+		},
+		{
+			name:     "initialize以外_そのまま",
+			hide:     []string{"prompts"},
+			method:   "tools/list",
+			response: `{"jsonrpc":"2.0","id":1,"result":{"capabilities":{"prompts":{}}}}`,
+			wantResp: `{"jsonrpc":"2.0","id":1,"result":{"capabilities":{"prompts":{}}}}`,
+		},
+		{
+			name:     "存在しない機能_そのまま",
+			hide:     []string{"tools.listChanged"},
+			method:   "initialize",
+			response: `{"jsonrpc":"2.0","id":1,"result":{"capabilities":{"prompts":{}}}}`,
+			wantResp: `{"jsonrpc":"2.0","id":1,"result":{"capabilities":{"prompts":{}}}}`,
+		},
+		{
+			name:    "クライアントの機能_リクエストから削除",
+			hide:    []string{"sampling"},
+			request: `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"capabilities":{"roots":{},"sampling":{}}}}`,
+			wantReq: `{"id":1,"jsonrpc":"2.0","method":"initialize","params":{"capabilities":{"roots":{}}}}`,
+		},
+		{
+			name:    "initialize以外のリクエスト_そのまま",
+			hide:    []string{"sampling"},
+			request: `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"capabilities":{"sampling":{}}}}`,
+			wantReq: `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"capabilities":{"sampling":{}}}}`,
+		},
+		{
+			name:     "experimental_両方から削除",
+			hide:     []string{"experimental"},
+			method:   "initialize",
+			request:  `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"capabilities":{"experimental":{}}}}`,
+			response: `{"jsonrpc":"2.0","id":1,"result":{"capabilities":{"experimental":{}}}}`,
+			wantReq:  `{"id":1,"jsonrpc":"2.0","method":"initialize","params":{"capabilities":{}}}`,
+			wantResp: `{"id":1,"jsonrpc":"2.0","result":{"capabilities":{}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mask, err := newCapabilityMask(tt.hide)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.request != "" {
+				if got := string(mask.request([]byte(tt.request))); got != tt.wantReq {
+					t.Errorf("request() = %s, want %s", got, tt.wantReq)
+				}
+			}
+			if tt.response != "" {
+				if got := string(mask.response([]byte(tt.response), tt.method)); got != tt.wantResp {
+					t.Errorf("response() = %s, want %s", got, tt.wantResp)
+				}
+			}
+		})
+	}
+}
+
+func TestNewCapabilityMask_Invalid(t *testing.T) {
+	for _, name := range []string{"", "unknown", "prompts.", "tools..listChanged"} {
+		if _, err := newCapabilityMask([]string{name}); err == nil {
+			t.Errorf("newCapabilityMask(%q) expected error but got none", name)
+		}
+	}
+}
+
+func TestHandleMCP_HideCapabilities(t *testing.T) {
+	// 受け取った initialize のリクエストを結果に含めて返す
+	script := `read line; printf '{"jsonrpc":"2.0","id":1,"result":{"capabilities":{"prompts":{},"tools":{}},"request":%s}}\n' "$line"`
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", script},
+		HideCapabilities: []string{"prompts", "sampling"},
+	}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	w := postMCP(server, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"capabilities":{"sampling":{}}}}`, nil)
+	body := w.Body.String()
+	if strings.Contains(body, "prompts") || strings.Contains(body, "sampling") || !strings.Contains(body, `"tools":{}`) {
+		t.Errorf("response = %s, want prompts and sampling hidden", body)
+	}
+}
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/sessionstore"
+)
+
+// headerForwardedBy は別のレプリカから転送されたリクエストに付けるヘッダーです。
+// 転送先でセッションが見つからなくても再転送しないために使用します。
+const headerForwardedBy = "X-Tumiki-Forwarded-By"
+
+// forwardedCredentialHeaders は認証で削除・置き換えるヘッダーのうち、転送先のレプリカが認証し直すために
+// クライアントが送った値のまま転送するものです。
+var forwardedCredentialHeaders = []string{
+	"Authorization",
+	headerAPIKey,
+	headerSignatureTimestamp,
+	headerSignatureNonce,
+	headerSignedHeaders,
+	headerSignature,
+}
+
+// clientCredentialsKey は認証の前に保存したクライアントの認証情報のヘッダーを格納するコンテキストのキーです。
+type clientCredentialsKey struct{}
+
+// sessionStoreTimeout はセッションストアへの1回の操作のタイムアウトです。
+const sessionStoreTimeout = 2 * time.Second
+
+// publishSession はセッションを所有していることをセッションストアに記録します。
+// ストアに書き込めなくてもローカルのセッションは使えるため、失敗はログにのみ出力します。
+func (s *Server) publishSession(id, protocolVersion string, ttl time.Duration) {
+	if s.cfg.SessionStore == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sessionStoreTimeout)
+	defer cancel()
+
+	rec := sessionstore.Record{Owner: s.cfg.AdvertiseURL, ProtocolVersion: protocolVersion}
+	if err := s.cfg.SessionStore.Put(ctx, id, rec, ttl); err != nil {
+		s.logger.Warn("Failed to publish session", "session", id, "error", err)
+	}
+}
+
+// unpublishSession はセッションストアからセッションを削除します。
+func (s *Server) unpublishSession(id string) {
+	if s.cfg.SessionStore == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sessionStoreTimeout)
+	defer cancel()
+
+	if err := s.cfg.SessionStore.Delete(ctx, id); err != nil {
+		s.logger.Warn("Failed to unpublish session", "session", id, "error", err)
+	}
+}
+
+// forwardToOwner はローカルにないセッションへのリクエストを、セッションストアに記録された所有レプリカへ転送します。
+// 転送した場合は true を返し、転送先がない場合は何も書き込まずに false を返します。
+func (s *Server) forwardToOwner(w http.ResponseWriter, r *http.Request, id string) bool {
+	if s.cfg.SessionStore == nil || r.Header.Get(headerForwardedBy) != "" {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), sessionStoreTimeout)
+	rec, ok, err := s.cfg.SessionStore.Get(ctx, id)
+	cancel()
+	if err != nil {
+		s.logger.Error("Session store lookup failed", "session", id, "error", err)
+		return false
+	}
+	if !ok || rec.Owner == "" || rec.Owner == s.cfg.AdvertiseURL {
+		return false
+	}
+
+	target, err := url.Parse(rec.Owner)
+	if err != nil {
+		s.logger.Error("Invalid session owner", "session", id, "owner", rec.Owner, "error", err)
+		return false
+	}
+
+	s.logger.Debug("Forwarding request to session owner", "session", id, "owner", rec.Owner)
+	s.proxyTo(w, r, target)
+	return true
+}
+
+// keepClientCredentials は認証がヘッダーを削除・置き換える前に、クライアントの認証情報をコンテキストに保存するミドルウェアです。
+// 別のレプリカへ転送する場合に、転送先で認証し直すために使います。
+func keepClientCredentials(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credentials := make(http.Header)
+		for _, name := range forwardedCredentialHeaders {
+			if values := r.Header.Values(name); len(values) > 0 {
+				credentials[http.CanonicalHeaderKey(name)] = slices.Clone(values)
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientCredentialsKey{}, credentials)))
+	})
+}
+
+// forwardHeader は別のレプリカへ転送するリクエストのヘッダーを整えます。
+// このレプリカが設定した内部ヘッダー（X-Tumiki-*、API キーの環境変数などを含む）は転送せず、
+// 認証で削除したクライアントの認証情報を元に戻して、転送先で改めて認証させます。
+func forwardHeader(header http.Header, credentials http.Header) {
+	for name := range header {
+		if strings.HasPrefix(name, "X-Tumiki-") {
+			header.Del(name)
+		}
+	}
+	for name, values := range credentials {
+		header[name] = slices.Clone(values)
+	}
+}
+
+// proxyTo はリクエストを別のレプリカへ転送します。
+// 転送先で再転送されないよう、headerForwardedBy を付けて送ります。
+func (s *Server) proxyTo(w http.ResponseWriter, r *http.Request, target *url.URL) {
+	credentials, _ := r.Context().Value(clientCredentialsKey{}).(http.Header)
+	proxy := &httputil.ReverseProxy{
+		Transport: s.peerTransport(),
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			forwardHeader(pr.Out.Header, credentials)
+			pr.Out.Header.Set(headerForwardedBy, s.cfg.AdvertiseURL)
+		},
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+			s.logger.Error("Forwarding to replica failed", "target", target.String(), "error", err)
+			http.Error(w, "Replica unreachable", http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// initializeProtocolVersion は initialize リクエストであればクライアントが要求したプロトコルバージョンを返します。
+func initializeProtocolVersion(body []byte) string {
+	msg, err := jsonrpc.Parse(body)
+	if err != nil || msg.Method != "initialize" {
+		return ""
+	}
+	var params struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return ""
+	}
+	return params.ProtocolVersion
+}
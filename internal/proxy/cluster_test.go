@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mcptest"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/sessionstore"
+)
+
+// startReplica はセッションストアを共有するレプリカを HTTP サーバーとして起動します。
+func startReplica(t *testing.T, store sessionstore.Store) (*Server, string) {
+	t.Helper()
+	command, args, env := mcptest.Command(mcptest.ModeCompliant)
+
+	ts := httptest.NewUnstartedServer(nil)
+	advertise := "http://" + ts.Listener.Addr().String()
+
+	server, err := NewServer(&Config{
+		Command:          command,
+		Args:             args,
+		DefaultEnv:       env,
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+		LongPoll:         true,
+		SessionStore:     store,
+		AdvertiseURL:     advertise,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	server.polls.wait = 500 * time.Millisecond
+
+	ts.Config.Handler = server.Handler()
+	ts.Start()
+	t.Cleanup(func() {
+		ts.Close()
+		server.polls.close()
+	})
+	return server, advertise
+}
+
+func TestCluster_ForwardToOwner(t *testing.T) {
+	store := sessionstore.NewMemory()
+	owner, ownerURL := startReplica(t, store)
+	other, _ := startReplica(t, store)
+
+	// owner でセッションを作成するとストアに所有者が記録される
+	w := pollPost(t, owner, "", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("POST status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+	id := w.Header().Get(headerSessionID)
+
+	rec, ok, err := store.Get(context.Background(), id)
+	if err != nil || !ok {
+		t.Fatalf("store.Get() = %v, %v, want record", ok, err)
+	}
+	if rec.Owner != ownerURL || rec.ProtocolVersion != "2025-06-18" {
+		t.Errorf("record = %+v, want owner %s and protocol 2025-06-18", rec, ownerURL)
+	}
+
+	// 別のレプリカに届いたリクエストは owner に転送される
+	w = pollPost(t, other, id, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`)
+	if w.Code != http.StatusAccepted || w.Header().Get(headerSessionID) != id {
+		t.Fatalf("forwarded POST = %d, session %q (body: %s)", w.Code, w.Header().Get(headerSessionID), w.Body.String())
+	}
+
+	var got []string
+	deadline := time.Now().Add(5 * time.Second)
+	for len(got) < 3 && time.Now().Before(deadline) {
+		code, messages := pollGet(t, other, id)
+		if code != http.StatusOK {
+			t.Fatalf("forwarded GET status = %d, want %d", code, http.StatusOK)
+		}
+		for _, msg := range messages {
+			got = append(got, string(msg))
+		}
+	}
+	if len(got) != 3 || !strings.Contains(got[2], `"text":"hi"`) {
+		t.Fatalf("forwarded messages = %v, want 3 ending with the tools/call response", got)
+	}
+
+	// セッションを破棄するとストアからも削除される
+	owner.polls.remove(id, nil)
+	if _, ok, _ := store.Get(context.Background(), id); ok {
+		t.Error("record should be deleted with the session")
+	}
+	if code, _ := pollGet(t, other, id); code != http.StatusNotFound {
+		t.Errorf("GET after removal = %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+// failingStore は常にエラーを返す Store です。
+type failingStore struct{}
+
+func (failingStore) Put(context.Context, string, sessionstore.Record, time.Duration) error {
+	return errors.New("store unavailable")
+}
+
+func (failingStore) Get(context.Context, string) (sessionstore.Record, bool, error) {
+	return sessionstore.Record{}, false, errors.New("store unavailable")
+}
+
+func (failingStore) Delete(context.Context, string) error {
+	return errors.New("store unavailable")
+}
+
+func (failingStore) Close() error {
+	return nil
+}
+
+func TestCluster_ForwardErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		store     sessionstore.Store
+		record    *sessionstore.Record
+		forwarded bool
+		want      int
+	}{
+		{name: "所有者に接続できない_502", record: &sessionstore.Record{Owner: "http://127.0.0.1:1"}, want: http.StatusBadGateway},
+		{name: "転送済みのリクエスト_再転送せず404", record: &sessionstore.Record{Owner: "http://127.0.0.1:1"}, forwarded: true, want: http.StatusNotFound},
+		{name: "不正な所有者URL_404", record: &sessionstore.Record{Owner: "http://[::1"}, want: http.StatusNotFound},
+		{name: "ストアにない_404", want: http.StatusNotFound},
+		{name: "ストアのエラー_404", store: failingStore{}, want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.store
+			if store == nil {
+				memory := sessionstore.NewMemory()
+				if tt.record != nil {
+					_ = memory.Put(context.Background(), "remote", *tt.record, time.Minute)
+				}
+				store = memory
+			}
+			server, _ := startReplica(t, store)
+
+			req := httptest.NewRequest("GET", pollPath, nil)
+			req.Header.Set(headerSessionID, "remote")
+			if tt.forwarded {
+				req.Header.Set(headerForwardedBy, "http://10.0.0.1:8080")
+			}
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCluster_StoreFailureKeepsLocalSession(t *testing.T) {
+	server, _ := startReplica(t, failingStore{})
+
+	// ストアに書き込めなくてもローカルのセッションは使える
+	w := pollPost(t, server, "", `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("POST status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+	id := w.Header().Get(headerSessionID)
+	if code, _ := pollGet(t, server, id); code != http.StatusOK {
+		t.Errorf("GET status = %d, want %d", code, http.StatusOK)
+	}
+	server.polls.remove(id, nil)
+}
+
+func TestNewServer_SessionStoreRequiresAdvertiseURL(t *testing.T) {
+	_, err := NewServer(&Config{Command: "cat", SessionStore: sessionstore.NewMemory()}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err == nil {
+		t.Error("NewServer() without AdvertiseURL expected error but got none")
+	}
+}
+
+func TestInitializeProtocolVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{name: "initialize_バージョンを返す", body: `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`, expected: "2025-06-18"},
+		{name: "別のメソッド_空文字列", body: `{"jsonrpc":"2.0","id":1,"method":"ping"}`},
+		{name: "paramsが不正_空文字列", body: `{"jsonrpc":"2.0","id":1,"method":"initialize","params":[]}`},
+		{name: "JSONでない_空文字列", body: `not json`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := initializeProtocolVersion([]byte(tt.body)); got != tt.expected {
+				t.Errorf("initializeProtocolVersion() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/plugin"
+)
+
+// discoveryPath はクライアントやレジストリが接続方法を調べるディスカバリードキュメントのパスです。
+const discoveryPath = "/.well-known/mcp"
+
+// defaultServerCardName は名前を指定しない場合にディスカバリードキュメントに含める名前です。
+const defaultServerCardName = "tumiki-mcp-http"
+
+// ServerCard はディスカバリードキュメントに含めるアダプターの説明と連絡先です。
+type ServerCard struct {
+	Name        string // 公開するサーバーの名前（空文字列で defaultServerCardName）
+	Description string // 公開するサーバーの説明
+	Contact     Contact
+}
+
+// Contact はディスカバリードキュメントに含める運用者の連絡先です。
+type Contact struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+	URL   string `json:"url,omitempty"`
+}
+
+// discoveryDocument は GET /.well-known/mcp のレスポンスです。
+type discoveryDocument struct {
+	Name           string              `json:"name"`
+	Description    string              `json:"description,omitempty"`
+	Servers        []discoveryServer   `json:"servers"`
+	Transports     []discoveryEndpoint `json:"transports"`
+	Features       discoveryFeatures   `json:"features"`
+	Authentication discoveryAuth       `json:"authentication"`
+	Documentation  string              `json:"documentation"`
+	Contact        *Contact            `json:"contact,omitempty"`
+}
+
+// discoveryServer は公開している1つの MCP サーバーです。
+type discoveryServer struct {
+	Name     string `json:"name"`
+	Endpoint string `json:"endpoint"`
+	Version  string `json:"version,omitempty"` // /mcp で有効なバックエンドのバージョン
+}
+
+// discoveryEndpoint は受け付けるトランスポートとエンドポイントです。
+type discoveryEndpoint struct {
+	Type     string `json:"type"`
+	Endpoint string `json:"endpoint"`
+}
+
+// discoveryFeatures はトランスポートの機能です。
+type discoveryFeatures struct {
+	Sessions      bool `json:"sessions"`      // Mcp-Session-Id で状態を持つセッション
+	Subscriptions bool `json:"subscriptions"` // resources/subscribe の通知の中継
+	SharedProcess bool `json:"sharedProcess"` // 全てのリクエストを1つのプロセスで実行する
+}
+
+// discoveryAuth は MCP エンドポイントの認証の要件です。
+type discoveryAuth struct {
+	Required         bool     `json:"required"`
+	Methods          []string `json:"methods,omitempty"`
+	APIKeyHeader     string   `json:"apiKeyHeader,omitempty"`
+	AnonymousMethods []string `json:"anonymousMethods,omitempty"` // 認証なしで呼び出せるメソッド
+}
+
+// handleDiscovery は公開しているサーバー・トランスポート・認証の要件・連絡先を記述したディスカバリードキュメントを返します。
+// 接続前に参照するため、認証・レート制限の対象にしません。
+func (s *Server) handleDiscovery(w http.ResponseWriter, _ *http.Request) {
+	s.writeJSON(w, s.discoveryDocument())
+}
+
+// discoveryDocument は現在の設定からディスカバリードキュメントを作成します。
+func (s *Server) discoveryDocument() discoveryDocument {
+	card := s.cfg.ServerCard
+	doc := discoveryDocument{
+		Name:          card.Name,
+		Description:   card.Description,
+		Documentation: openAPIPath,
+		Servers:       []discoveryServer{},
+		Transports:    []discoveryEndpoint{},
+		Features: discoveryFeatures{
+			Sessions:      s.cfg.Sessions,
+			Subscriptions: s.cfg.Subscriptions,
+			SharedProcess: s.cfg.SharedProcess,
+		},
+	}
+	if doc.Name == "" {
+		doc.Name = defaultServerCardName
+	}
+	if card.Contact != (Contact{}) {
+		contact := card.Contact
+		doc.Contact = &contact
+	}
+
+	mcpEndpoint := "/mcp"
+	if !s.servesStreamableHTTP() {
+		mcpEndpoint = legacySSEPath
+	}
+	doc.Servers = append(doc.Servers, discoveryServer{Name: DefaultBackendVersion, Endpoint: mcpEndpoint, Version: s.backends.current().Version})
+	if s.servesStreamableHTTP() {
+		servers := s.defs().servers
+		for _, name := range slices.Sorted(maps.Keys(servers)) {
+			doc.Servers = append(doc.Servers, discoveryServer{Name: name, Endpoint: serversPathPrefix + name + "/mcp"})
+		}
+		doc.Transports = append(doc.Transports, discoveryEndpoint{Type: TransportStreamableHTTP, Endpoint: "/mcp"})
+	}
+	if s.servesLegacySSE() {
+		doc.Transports = append(doc.Transports, discoveryEndpoint{Type: TransportSSE, Endpoint: legacySSEPath})
+	}
+	if s.cfg.WebSocket {
+		doc.Transports = append(doc.Transports, discoveryEndpoint{Type: "websocket", Endpoint: webSocketPath})
+	}
+	if s.cfg.LongPoll {
+		doc.Transports = append(doc.Transports, discoveryEndpoint{Type: "long-polling", Endpoint: pollPath})
+	}
+
+	methods := slices.Clone(s.authMethods())
+	if s.cfg.SPIFFE != nil && !slices.Contains(methods, AuthMTLS) {
+		methods = append(methods, AuthMTLS)
+	}
+	if slices.ContainsFunc(s.cfg.Plugins, func(p *plugin.Plugin) bool { return p.Has(plugin.HookAuthenticate) }) {
+		methods = append(methods, "plugin")
+	}
+	if len(methods) > 0 {
+		doc.Authentication = discoveryAuth{
+			Required:         true,
+			Methods:          methods,
+			AnonymousMethods: s.cfg.AnonymousMethods,
+		}
+		if slices.Contains(methods, AuthAPIKey) {
+			doc.Authentication.APIKeyHeader = headerAPIKey
+		}
+	}
+	return doc
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/apikey"
+)
+
+// getDiscovery は GET /.well-known/mcp のステータスコードとディスカバリードキュメントを返します。
+func getDiscovery(t *testing.T, server *Server) (int, discoveryDocument) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest("GET", discoveryPath, nil))
+	var doc discoveryDocument
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+			t.Fatalf("decode discovery document: %v", err)
+		}
+	}
+	return w.Code, doc
+}
+
+func TestHandleDiscovery(t *testing.T) {
+	store, err := apikey.Open(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatalf("apikey.Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	server, err := NewServer(&Config{
+		Command:          "cat",
+		Transport:        TransportAll,
+		WebSocket:        true,
+		Sessions:         true,
+		APIKeys:          store,
+		AnonymousMethods: []string{"tools/list"},
+		Servers:          map[string]ServerDefinition{"github": {Command: "cat"}, "slack": {Command: "cat"}},
+		Discovery:        true,
+		ServerCard: ServerCard{
+			Name:        "files",
+			Description: "Filesystem tools",
+			Contact:     Contact{Email: "ops@example.com"},
+		},
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	t.Cleanup(server.subscriptions.close)
+
+	// 認証なしで取得できる
+	code, doc := getDiscovery(t, server)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	want := discoveryDocument{
+		Name:        "files",
+		Description: "Filesystem tools",
+		Servers: []discoveryServer{
+			{Name: "default", Endpoint: "/mcp", Version: DefaultBackendVersion},
+			{Name: "github", Endpoint: "/servers/github/mcp"},
+			{Name: "slack", Endpoint: "/servers/slack/mcp"},
+		},
+		Transports: []discoveryEndpoint{
+			{Type: TransportStreamableHTTP, Endpoint: "/mcp"},
+			{Type: TransportSSE, Endpoint: "/sse"},
+			{Type: "websocket", Endpoint: "/ws"},
+		},
+		Features: discoveryFeatures{Sessions: true},
+		Authentication: discoveryAuth{
+			Required:         true,
+			Methods:          []string{AuthAPIKey},
+			APIKeyHeader:     headerAPIKey,
+			AnonymousMethods: []string{"tools/list"},
+		},
+		Documentation: "/openapi.json",
+		Contact:       &Contact{Email: "ops@example.com"},
+	}
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("discovery document = %+v, want %+v", doc, want)
+	}
+}
+
+func TestHandleDiscovery_Defaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		wantCode int
+		wantName string
+	}{
+		{name: "無効_404", cfg: Config{Command: "cat"}, wantCode: http.StatusNotFound},
+		{name: "名前を指定しない_デフォルトの名前", cfg: Config{Command: "cat", Discovery: true}, wantCode: http.StatusOK, wantName: defaultServerCardName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewServer(&tt.cfg, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+			code, doc := getDiscovery(t, server)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", code, tt.wantCode)
+			}
+			if doc.Name != tt.wantName || (code == http.StatusOK && (doc.Authentication.Required || doc.Contact != nil)) {
+				t.Errorf("discovery document = %+v, want name %q without auth and contact", doc, tt.wantName)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+)
+
+// DefaultDownloadTTL は resources/read のコンテンツをダウンロードできるデフォルトの期間です。
+const DefaultDownloadTTL = 5 * time.Minute
+
+// downloadPathPrefix は署名付き URL でコンテンツをダウンロードするエンドポイントです。
+const downloadPathPrefix = "/download/"
+
+// downloads は resources/read の大きなコンテンツを一時ファイルに切り出し、
+// 有効期限と署名を付けた URL でダウンロードできるようにします。
+// URL 自体が認証情報になるため、ダウンロードには API キーなどの認証を求めません。
+type downloads struct {
+	*blobStore
+	key []byte
+}
+
+// newDownloads はプロセスごとに生成した鍵で URL に署名する downloads を作成します。
+func newDownloads(threshold int, ttl time.Duration) (*downloads, error) {
+	if ttl <= 0 {
+		ttl = DefaultDownloadTTL
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate download signing key: %w", err)
+	}
+	store, err := newBlobStore(threshold, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &downloads{blobStore: store, key: key}, nil
+}
+
+// sign は id と有効期限（Unix 時刻）の署名を返します。
+func (d *downloads) sign(id string, expires int64) string {
+	mac := hmac.New(sha256.New, d.key)
+	fmt.Fprintf(mac, "%s\n%d", id, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// url は id のコンテンツをダウンロードする署名付き URL を返します。
+func (d *downloads) url(id string, expires time.Time) string {
+	unix := expires.Unix()
+	return downloadPathPrefix + id + "?expires=" + strconv.FormatInt(unix, 10) + "&signature=" + d.sign(id, unix)
+}
+
+// offload は resources/read のレスポンスの contents[] のうち、text または blob がしきい値を超えるものを
+// 一時ファイルに切り出し、元のフィールドを空にして _meta に署名付き URL を追加します。
+// 切り出し対象がない場合は元のメッセージをそのまま返します。
+func (d *downloads) offload(msg []byte) ([]byte, error) {
+	if len(msg) <= d.threshold {
+		return msg, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(msg))
+	decoder.UseNumber()
+	var root map[string]any
+	if err := decoder.Decode(&root); err != nil {
+		return msg, nil
+	}
+	result, _ := root["result"].(map[string]any)
+	contents, _ := result["contents"].([]any)
+
+	changed := false
+	for _, item := range contents {
+		content, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		offloaded, err := d.offloadContent(content)
+		if err != nil {
+			return nil, err
+		}
+		changed = changed || offloaded
+	}
+	if !changed {
+		return msg, nil
+	}
+	return json.Marshal(root)
+}
+
+func (d *downloads) offloadContent(content map[string]any) (bool, error) {
+	field, mimeType := "blob", ""
+	if _, ok := content["text"]; ok {
+		field, mimeType = "text", "text/plain; charset=utf-8"
+	}
+	value, ok := content[field].(string)
+	if !ok || len(value) <= d.threshold {
+		return false, nil
+	}
+
+	data := []byte(value)
+	if field == "blob" {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			// base64 でないデータは切り出さない
+			return false, nil
+		}
+		data = decoded
+	}
+	if declared, _ := content["mimeType"].(string); declared != "" {
+		mimeType = declared
+	}
+
+	id, err := d.put(data, mimeType)
+	if err != nil {
+		return false, err
+	}
+	entry, ok := d.get(id)
+	if !ok {
+		return false, nil
+	}
+
+	content[field] = ""
+	meta, ok := content["_meta"].(map[string]any)
+	if !ok {
+		meta = make(map[string]any)
+		content["_meta"] = meta
+	}
+	meta[blobMetaKey] = map[string]any{
+		"url":        d.url(id, entry.expiresAt),
+		"size":       len(data),
+		"expires_at": entry.expiresAt.UTC().Format(time.RFC3339),
+	}
+	if uri, _ := content["uri"].(string); uri != "" {
+		d.mu.Lock()
+		entry.filename = path.Base(uri)
+		d.mu.Unlock()
+	}
+	return true, nil
+}
+
+// handleDownload は署名と有効期限を検証し、コンテンツを Range リクエスト対応でストリーミングします。
+func (d *downloads) handleDownload(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil || !hmac.Equal([]byte(r.URL.Query().Get("signature")), []byte(d.sign(id, expires))) {
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return
+	}
+	if d.now().Unix() > expires {
+		http.Error(w, "Download URL expired", http.StatusGone)
+		return
+	}
+
+	entry, ok := d.get(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(entry.path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	if entry.mimeType != "" {
+		w.Header().Set("Content-Type", entry.mimeType)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	if entry.filename != "" && entry.filename != "." && entry.filename != "/" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": entry.filename}))
+	}
+	// 署名付き URL は共有されうるため、中継するキャッシュには保存させない
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, "", time.Time{}, f)
+}
@@ -0,0 +1,215 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/apikey"
+)
+
+func newTestDownloads(t *testing.T, threshold int) *downloads {
+	t.Helper()
+	d, err := newDownloads(threshold, time.Minute)
+	if err != nil {
+		t.Fatalf("newDownloads() error = %v", err)
+	}
+	t.Cleanup(func() { _ = d.close() })
+	return d
+}
+
+func TestDownloads_Offload(t *testing.T) {
+	large := strings.Repeat("x", 100)
+
+	tests := []struct {
+		name        string
+		msg         string
+		wantChanged bool
+		wantType    string
+	}{
+		{
+			name:        "しきい値を超えるtext_切り出される",
+			msg:         `{"jsonrpc":"2.0","id":1,"result":{"contents":[{"uri":"file:///a.txt","text":"` + large + `"}]}}`,
+			wantChanged: true,
+			wantType:    "text/plain; charset=utf-8",
+		},
+		{
+			name:        "しきい値を超えるblob_mimeTypeで切り出される",
+			msg:         `{"jsonrpc":"2.0","id":1,"result":{"contents":[{"uri":"file:///a.png","mimeType":"image/png","blob":"` + base64.StdEncoding.EncodeToString([]byte(large)) + `"}]}}`,
+			wantChanged: true,
+			wantType:    "image/png",
+		},
+		{
+			name:        "しきい値以下のtext_そのまま返す",
+			msg:         `{"jsonrpc":"2.0","id":1,"result":{"contents":[{"uri":"file:///a.txt","text":"x"}],"pad":"` + large + `"}}`,
+			wantChanged: false,
+		},
+		{
+			name:        "contents以外のtext_そのまま返す",
+			msg:         `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"` + large + `"}]}}`,
+			wantChanged: false,
+		},
+		{
+			name:        "JSONでない出力_そのまま返す",
+			msg:         strings.Repeat("not json ", 20),
+			wantChanged: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDownloads(t, 64)
+
+			got, err := d.offload([]byte(tt.msg))
+			if err != nil {
+				t.Fatalf("offload() error = %v", err)
+			}
+			if changed := string(got) != tt.msg; changed != tt.wantChanged {
+				t.Fatalf("offload() changed = %v, want %v (got: %s)", changed, tt.wantChanged, got)
+			}
+			if !tt.wantChanged {
+				return
+			}
+
+			var parsed struct {
+				Result struct {
+					Contents []map[string]any `json:"contents"`
+				} `json:"result"`
+			}
+			if err := json.Unmarshal(got, &parsed); err != nil {
+				t.Fatalf("invalid JSON after offload: %v", err)
+			}
+			download := downloadMeta(t, parsed.Result.Contents[0])
+			if url, _ := download["url"].(string); !strings.HasPrefix(url, downloadPathPrefix) || !strings.Contains(url, "signature=") {
+				t.Errorf("url = %v, want a signed %s URL", download["url"], downloadPathPrefix)
+			}
+			for _, entry := range d.entries {
+				if entry.mimeType != tt.wantType {
+					t.Errorf("mimeType = %q, want %q", entry.mimeType, tt.wantType)
+				}
+			}
+		})
+	}
+}
+
+func TestNewServer_DownloadEndpoint(t *testing.T) {
+	text := strings.Repeat("0123456789", 10)
+	server, err := NewServer(&Config{
+		Command:           "sh",
+		Args:              []string{"-c", `read line; echo '{"jsonrpc":"2.0","id":1,"result":{"contents":[{"uri":"file:///docs/report.txt","text":"` + text + `"}]}}'`},
+		DefaultEnv:        map[string]string{},
+		DownloadThreshold: 16,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer func() { _ = server.downloads.close() }()
+
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"resources/read"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want 200 (body: %s)", w.Code, w.Body.String())
+	}
+	var parsed struct {
+		Result struct {
+			Contents []map[string]any `json:"contents"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &parsed); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if parsed.Result.Contents[0]["text"] != "" {
+		t.Errorf("text should be emptied, got %v", parsed.Result.Contents[0]["text"])
+	}
+	url := downloadMeta(t, parsed.Result.Contents[0])["url"].(string)
+
+	tests := []struct {
+		name        string
+		url         string
+		rangeHeader string
+		wantStatus  int
+		wantBody    string
+	}{
+		{name: "署名付きURL_全体を返す", url: url, wantStatus: http.StatusOK, wantBody: text},
+		{name: "Range指定_部分を返す", url: url, rangeHeader: "bytes=10-14", wantStatus: http.StatusPartialContent, wantBody: "01234"},
+		{name: "署名の改ざん_403", url: url[:len(url)-2] + "xx", wantStatus: http.StatusForbidden},
+		{name: "有効期限の改ざん_403", url: strings.Replace(url, "expires=", "expires=9", 1), wantStatus: http.StatusForbidden},
+		{name: "署名なし_403", url: downloadPathPrefix + "unknown", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.rangeHeader != "" {
+				req.Header.Set("Range", tt.rangeHeader)
+			}
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d (body: %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantBody == "" {
+				return
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.wantBody)
+			}
+			if got := w.Header().Get("Content-Disposition"); got != `attachment; filename=report.txt` {
+				t.Errorf("Content-Disposition = %q", got)
+			}
+		})
+	}
+
+	// 有効期限を過ぎた URL は 410 を返す
+	server.downloads.now = func() time.Time { return time.Now().Add(time.Hour) }
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	if w.Code != http.StatusGone {
+		t.Errorf("expired URL status = %d, want %d", w.Code, http.StatusGone)
+	}
+}
+
+func TestNewServer_DownloadSkipsAPIKeyAuth(t *testing.T) {
+	store, err := apikey.Open(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatalf("apikey.Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	server, err := NewServer(&Config{Command: "cat", APIKeys: store, DownloadThreshold: 16}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer func() { _ = server.downloads.close() }()
+
+	id, err := server.downloads.put([]byte("content"), "")
+	if err != nil {
+		t.Fatalf("put() error = %v", err)
+	}
+	entry, _ := server.downloads.get(id)
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest("GET", server.downloads.url(id, entry.expiresAt), nil))
+	if w.Code != http.StatusOK || w.Body.String() != "content" {
+		t.Errorf("download without API key = %d %s, want 200", w.Code, w.Body.String())
+	}
+
+	// 署名付き URL 以外は引き続き API キーが必要
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("POST /mcp without API key status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
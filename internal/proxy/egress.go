@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"errors"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/egress"
+)
+
+var (
+	errEgressNotEnabled  = errors.New("egressProxyAllow requires --egress-proxy")
+	errEgressWithRuntime = errors.New("--egress-proxy cannot restrict connections of container or firecracker runtimes")
+)
+
+// newEgressProxy は EgressProxy の場合に、プロセスの接続を中継するプロキシを起動します。
+// プロセスはプロキシにしか接続できないネットワーク名前空間で実行するため、
+// 名前空間を作成できない環境ではエラーを返します。
+func (s *Server) newEgressProxy() error {
+	if !s.cfg.EgressProxy {
+		if s.cfg.EgressProxyAllow != nil {
+			return errEgressNotEnabled
+		}
+		return nil
+	}
+	if err := validateEgressRuntime(s.cfg.Runtime); err != nil {
+		return err
+	}
+	if _, err := egress.ParsePolicy(s.cfg.EgressProxyAllow); err != nil {
+		return err
+	}
+	results := s.metrics.Counter("tumiki_egress_proxy_requests_total", "Number of outbound connections from processes by server and result.", "server", "result")
+	proxy, err := egress.Listen(s.logger, func(server string, allowed bool) {
+		result := "denied"
+		if allowed {
+			result = "allowed"
+		}
+		results.Inc(server, result)
+	})
+	if err != nil {
+		return err
+	}
+	if err := egress.CheckSandbox(proxy.SocketPath()); err != nil {
+		_ = proxy.Close()
+		return err
+	}
+	s.egress = proxy
+	s.logger.Info("Egress proxy started", "socket", proxy.SocketPath(), "allow", s.cfg.EgressProxyAllow)
+	return nil
+}
+
+// validateEgressRuntime はプロキシで接続を制限できるランタイムかを検証します。
+// コンテナと microVM はホストのネットワーク名前空間の外で動くため、プロキシを迂回する接続を制限できません。
+func validateEgressRuntime(runtime string) error {
+	if runtime != "" {
+		return errEgressWithRuntime
+	}
+	return nil
+}
+
+// egressProxyAllow はプロキシがバックエンドのプロセスの接続を中継するホストを返します。
+// バックエンドに egressProxyAllow がある場合はそれを、ない場合は --egress-proxy-allow を使います。
+func (s *Server) egressProxyAllow(backend *Backend) []string {
+	if backend.EgressProxyAllow != nil {
+		return backend.EgressProxyAllow
+	}
+	return s.cfg.EgressProxyAllow
+}
+
+// egressProxyURL はバックエンドの中継先を登録したプロキシの URL を返します。
+// 中継先はバックエンドのバージョンごとに登録するため、拒否のログとメトリクスでどのサーバーかが分かります。
+func (s *Server) egressProxyURL(backend *Backend) string {
+	// 登録前の validate で解析できることを確認している
+	policy, _ := egress.ParsePolicy(s.egressProxyAllow(backend))
+	return s.egress.Register(backend.Version, policy)
+}
@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/egress"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+func TestHandleMCP_EgressProxyEnv(t *testing.T) {
+	script := `read line; printf '{"jsonrpc":"2.0","id":1,"result":{"https":"%s","http":"%s","noProxy":"%s"}}\n' "$HTTPS_PROXY" "$http_proxy" "$NO_PROXY"`
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", script},
+		HeaderEnvMapping: map[string]string{"X-Proxy": "HTTPS_PROXY", "X-No-Proxy": "NO_PROXY"},
+		EgressProxy:      true,
+		EgressProxyAllow: []string{"api.github.com:443"},
+	}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	t.Cleanup(func() { _ = server.egress.Close() })
+
+	// ヘッダーからプロキシの設定を上書きさせない
+	w := postMCP(server, `{"jsonrpc":"2.0","id":1,"method":"tools/call"}`, http.Header{
+		"X-Proxy":    {"http://attacker.test:3128"},
+		"X-No-Proxy": {"*"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (body: %s)", w.Code, http.StatusOK, w.Body.String())
+	}
+	msg, err := jsonrpc.Parse(w.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		HTTPS   string `json:"https"`
+		HTTP    string `json:"http"`
+		NoProxy string `json:"noProxy"`
+	}
+	if err := json.Unmarshal(msg.Result, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	proxyURL, err := url.Parse(result.HTTPS)
+	if err != nil || proxyURL.Host != egress.SandboxAddr || proxyURL.User.Username() != DefaultBackendVersion {
+		t.Errorf("HTTPS_PROXY = %q, want the egress proxy with the backend version as the user", result.HTTPS)
+	}
+	if result.HTTP != result.HTTPS {
+		t.Errorf("http_proxy = %q, want %q", result.HTTP, result.HTTPS)
+	}
+	if result.NoProxy != "" {
+		t.Errorf("NO_PROXY = %q, want empty", result.NoProxy)
+	}
+}
+
+func TestNewServer_EgressProxy(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "無効_プロキシなし", cfg: Config{Command: "cat"}},
+		{name: "有効_プロキシを起動", cfg: Config{Command: "cat", EgressProxy: true, EgressProxyAllow: []string{"*.example.com"}}},
+		{name: "プロキシなしで中継先を指定_エラー", cfg: Config{Command: "cat", EgressProxyAllow: []string{"*.example.com"}}, wantErr: true},
+		{name: "不正なホスト_エラー", cfg: Config{Command: "cat", EgressProxy: true, EgressProxyAllow: []string{"a.*.com"}}, wantErr: true},
+		{name: "コンテナランタイム_エラー", cfg: Config{Command: "alpine", Runtime: process.RuntimeDocker, EgressProxy: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewServer(&tt.cfg, slog.Default())
+			if tt.wantErr {
+				if err == nil {
+					t.Error("NewServer() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+			if server.egress != nil {
+				t.Cleanup(func() { _ = server.egress.Close() })
+			}
+			if got, want := server.egress != nil, tt.cfg.EgressProxy; got != want {
+				t.Errorf("egress proxy started = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestAdmin_RegisterBackendEgressProxyAllow(t *testing.T) {
+	server := newAdminServer(t, "cat", nil)
+
+	body, _ := json.Marshal(Backend{Command: "cat", EgressProxyAllow: []string{"api.github.com"}})
+	if w, _ := adminRequest(t, server, "PUT", "/admin/backends/v2", string(body)); w.Code != http.StatusBadRequest {
+		t.Errorf("PUT without the egress proxy status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAdmin_RegisterBackendEgressRuntime(t *testing.T) {
+	server, err := NewServer(&Config{Command: "cat", EgressProxy: true, AdminToken: testAdminToken}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	t.Cleanup(func() { _ = server.egress.Close() })
+
+	// コンテナのプロセスの接続はプロキシで制限できないため登録させない
+	body, _ := json.Marshal(Backend{Command: "alpine", Runtime: process.RuntimeDocker})
+	if w, _ := adminRequest(t, server, "PUT", "/admin/backends/v2", string(body)); w.Code != http.StatusBadRequest {
+		t.Errorf("PUT of a container backend status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	body, _ = json.Marshal(Backend{Command: "cat"})
+	if w, _ := adminRequest(t, server, "PUT", "/admin/backends/v2", string(body)); w.Code != http.StatusOK {
+		t.Errorf("PUT of a host backend status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
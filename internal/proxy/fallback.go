@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/metrics"
+)
+
+// セッションの失敗でリクエストごとのプロセスに切り替えるデフォルトの設定です。
+const (
+	DefaultSessionFallbackWindow   = time.Minute
+	DefaultSessionFallbackCooldown = 5 * time.Minute
+)
+
+// SessionFallbackConfig は起動し続けるセッションのプロセスが繰り返し失敗したバックエンドを、
+// 一時的にリクエストごとにプロセスを起動する方式に切り替える設定です。
+type SessionFallbackConfig struct {
+	Failures int           // Window の間にこの回数だけセッションが失敗すると切り替える（1 以上）
+	Window   time.Duration // 失敗を数える期間（0 でデフォルト）
+	Cooldown time.Duration // リクエストごとのプロセスで処理する期間。過ぎると再びセッションを作成する（0 でデフォルト）
+}
+
+// sessionFallback はバックエンドごとにセッションの失敗を数え、失敗が続いたバックエンドの initialize を
+// セッションを作成せずにリクエストごとのプロセスで処理させます。クライアントには Mcp-Session-Id を返さないため、
+// 以降のリクエストもリクエストごとのプロセスで処理され、運用者が原因を調べる間も可用性を保てます。
+type sessionFallback struct {
+	cfg    SessionFallbackConfig
+	logger *slog.Logger
+	now    func() time.Time
+
+	fallbacks *metrics.Counter // 切り替えた回数
+	active    *metrics.Gauge   // 切り替え中のバックエンド
+
+	mu       sync.Mutex
+	backends map[string]*fallbackState // バックエンドのバージョン名（名前付きのサーバーではサーバー名）→ 状態
+}
+
+// fallbackState は1つのバックエンドのセッションの失敗です。
+type fallbackState struct {
+	failures []time.Time // Window の間の失敗の時刻
+	until    time.Time   // リクエストごとのプロセスで処理する期限（ゼロ値で切り替えていない）
+}
+
+func newSessionFallback(cfg SessionFallbackConfig, m *metrics.Registry, logger *slog.Logger) (*sessionFallback, error) {
+	if cfg.Failures < 1 {
+		return nil, fmt.Errorf("session fallback failures must be at least 1, got %d", cfg.Failures)
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultSessionFallbackWindow
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = DefaultSessionFallbackCooldown
+	}
+	return &sessionFallback{
+		cfg:       cfg,
+		logger:    logger,
+		now:       time.Now,
+		fallbacks: m.Counter("tumiki_session_fallbacks_total", "Number of times a backend fell back to one-shot processes after repeated session failures.", "version"),
+		active:    m.Gauge("tumiki_session_fallback_active", "Whether a backend currently serves initialize with one-shot processes instead of sessions (1) or not (0).", "version"),
+		backends:  make(map[string]*fallbackState),
+	}, nil
+}
+
+// failed はバックエンドのセッションが途中で失敗したことを記録し、Window の間の失敗が Failures に達したら切り替えます。
+// nil の sessionFallback では何もしません。
+func (f *sessionFallback) failed(version string, err error) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	state, ok := f.backends[version]
+	if !ok {
+		state = &fallbackState{}
+		f.backends[version] = state
+	}
+	if now.Before(state.until) {
+		return
+	}
+	recent := state.failures[:0]
+	for _, at := range state.failures {
+		if now.Sub(at) < f.cfg.Window {
+			recent = append(recent, at)
+		}
+	}
+	state.failures = append(recent, now)
+	if len(state.failures) < f.cfg.Failures {
+		return
+	}
+	state.failures = nil
+	state.until = now.Add(f.cfg.Cooldown)
+	f.fallbacks.Inc(version)
+	f.active.Set(1, version)
+	attrs := []any{"version", version, "failures", f.cfg.Failures, "window", f.cfg.Window, "until", state.until}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	f.logger.Warn("Sessions failed repeatedly, falling back to one-shot processes", attrs...)
+}
+
+// oneShot はバックエンドの initialize をセッションを作成せずにリクエストごとのプロセスで処理するかを返します。
+// 切り替えの期限を過ぎていれば元に戻します。nil の sessionFallback では false を返します。
+func (f *sessionFallback) oneShot(version string) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	state, ok := f.backends[version]
+	if !ok || state.until.IsZero() {
+		return false
+	}
+	if f.now().Before(state.until) {
+		return true
+	}
+	state.until = time.Time{}
+	f.active.Set(0, version)
+	f.logger.Info("Retrying sessions after one-shot fallback", "version", version)
+	return false
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/metrics"
+)
+
+func TestSessionFallback(t *testing.T) {
+	f, err := newSessionFallback(SessionFallbackConfig{Failures: 3, Window: time.Minute, Cooldown: 5 * time.Minute}, metrics.NewRegistry(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	f.now = func() time.Time { return now }
+
+	// Window より前の失敗は数えない
+	f.failed("default", nil)
+	now = now.Add(2 * time.Minute)
+	f.failed("default", nil)
+	f.failed("default", nil)
+	if f.oneShot("default") {
+		t.Fatal("oneShot() = true after 2 failures in the window, want false")
+	}
+
+	// 他のバックエンドの失敗は数えない
+	f.failed("github", nil)
+	if f.oneShot("default") {
+		t.Fatal("oneShot() = true after another backend failed, want false")
+	}
+
+	f.failed("default", io.ErrUnexpectedEOF)
+	if !f.oneShot("default") || f.oneShot("github") {
+		t.Fatal("oneShot() should be true only for the backend that failed 3 times")
+	}
+
+	// Cooldown を過ぎるとセッションを再び試す
+	now = now.Add(5 * time.Minute)
+	if f.oneShot("default") {
+		t.Error("oneShot() = true after the cooldown, want false")
+	}
+	f.failed("default", nil)
+	if f.oneShot("default") {
+		t.Error("oneShot() = true after one failure following the cooldown, want false")
+	}
+}
+
+func TestSessionFallback_nil(t *testing.T) {
+	var f *sessionFallback
+	f.failed("default", nil)
+	if f.oneShot("default") {
+		t.Error("oneShot() = true, want false")
+	}
+}
+
+func TestNewServer_SessionFallback_不正な設定_エラー(t *testing.T) {
+	for _, cfg := range []*Config{
+		{Command: "cat", SessionFallback: &SessionFallbackConfig{Failures: 3}},
+		{Command: "cat", Sessions: true, SessionFallback: &SessionFallbackConfig{}},
+	} {
+		if _, err := NewServer(cfg, slog.Default()); err == nil {
+			t.Errorf("NewServer(%+v) error = nil", cfg.SessionFallback)
+		}
+	}
+}
+
+func TestSessions_失敗が続くとリクエストごとのプロセスに切り替える(t *testing.T) {
+	// initialize に応答した直後に終了するプロセス（リクエストごとのプロセスとしては正常）
+	server, err := NewServer(&Config{
+		Command:         "sh",
+		Args:            []string{"-c", `read line; echo '{"jsonrpc":"2.0","id":1,"result":{"protocolVersion":"2025-06-18","capabilities":{},"serverInfo":{"name":"test","version":"1"}}}'`},
+		DefaultEnv:      map[string]string{},
+		Sessions:        true,
+		SessionFallback: &SessionFallbackConfig{Failures: 2},
+		Metrics:         true,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+	defer server.subscriptions.close()
+
+	for range 2 {
+		initializeSession(t, httpServer.URL, http.Header{})
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !server.fallback.oneShot(DefaultBackendVersion) {
+		if time.Now().After(deadline) {
+			t.Fatal("backend did not fall back after repeated session failures")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// セッションを作成せず、Mcp-Session-Id のないレスポンスを返す
+	resp := subscriptionRequest(t, "POST", httpServer.URL, "", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get(headerSessionID) != "" || !strings.Contains(string(body), `"serverInfo"`) {
+		t.Errorf("initialize = %d %s (session %q), want a one-shot response without a session", resp.StatusCode, body, resp.Header.Get(headerSessionID))
+	}
+
+	resp, err = http.Get(httpServer.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), `tumiki_session_fallbacks_total{version="default"} 1`) {
+		t.Errorf("metrics do not report the fallback:\n%s", body)
+	}
+}
@@ -0,0 +1,272 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultGossipInterval はクラスタ内の他のノードと状態を交換するデフォルトの間隔です。
+const DefaultGossipInterval = 2 * time.Second
+
+// gossipPath はノード間で状態を交換するエンドポイントです。
+const gossipPath = "/admin/cluster/gossip"
+
+// gossipSuspectRounds はこの回数の間隔の間ハートビートが進まないノードを異常とみなす回数です。
+const gossipSuspectRounds = 5
+
+// gossipMember はノードが自身について広めるハートビートと有効なバックエンドのバージョンです。
+type gossipMember struct {
+	URL       string `json:"url"`
+	Heartbeat uint64 `json:"heartbeat"`
+	Active    string `json:"active"`
+}
+
+// gossipMessage はノード間で交換する状態です。
+type gossipMessage struct {
+	From     string         `json:"from"`
+	Members  []gossipMember `json:"members"`
+	Backends backendState   `json:"backends"`
+}
+
+// memberStatus は管理 API が返すノードの状態です。
+type memberStatus struct {
+	URL      string    `json:"url"`
+	Active   string    `json:"active,omitempty"`
+	Healthy  bool      `json:"healthy"`
+	LastSeen time.Time `json:"lastSeen,omitzero"`
+}
+
+// knownMember はハートビートが最後に進んだ時刻を付けたノードの情報です。
+type knownMember struct {
+	gossipMember
+	updated time.Time
+}
+
+// gossip は外部の調整役なしに、ノード同士でバックエンドの設定と死活を広めます。
+// 間隔ごとにランダムに選んだノードと状態を交換し、新しい方の設定に揃えます。
+type gossip struct {
+	server   *Server
+	self     string
+	seeds    []string
+	interval time.Duration
+	client   *http.Client
+	now      func() time.Time
+
+	mu        sync.Mutex
+	heartbeat uint64
+	members   map[string]*knownMember
+}
+
+// newGossip は self を自身の URL とし、seeds を最初の交換相手とする gossip を作成します。
+func newGossip(s *Server, self string, seeds []string, interval time.Duration) *gossip {
+	if interval <= 0 {
+		interval = DefaultGossipInterval
+	}
+	return &gossip{
+		server:   s,
+		self:     self,
+		seeds:    seeds,
+		interval: interval,
+		client:   &http.Client{Timeout: interval, Transport: s.peerTransport()},
+		now:      time.Now,
+		members:  make(map[string]*knownMember),
+	}
+}
+
+// run は ctx が終了するまで間隔ごとに他のノードと状態を交換します。
+func (g *gossip) run(ctx context.Context) {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.round(ctx)
+		}
+	}
+}
+
+// round はランダムに選んだ1ノードに自身の状態を送り、返ってきた状態を取り込みます。
+func (g *gossip) round(ctx context.Context) {
+	target := g.pickTarget()
+	if target == "" {
+		return
+	}
+
+	body, err := json.Marshal(g.message())
+	if err != nil {
+		g.server.logger.Error("Failed to encode gossip message", "error", err)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target+gossipPath, bytes.NewReader(body))
+	if err != nil {
+		g.server.logger.Debug("Invalid gossip target", "peer", target, "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set("Authorization", "Bearer "+g.server.cfg.AdminToken)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		g.server.logger.Debug("Gossip failed", "peer", target, "error", err)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		g.server.logger.Warn("Gossip rejected", "peer", target, "status", resp.StatusCode)
+		return
+	}
+
+	var reply gossipMessage
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		g.server.logger.Warn("Invalid gossip reply", "peer", target, "error", err)
+		return
+	}
+	g.merge(reply)
+}
+
+// pickTarget は自身以外の既知のノードからランダムに1つ選びます。
+func (g *gossip) pickTarget() string {
+	g.mu.Lock()
+	candidates := slices.Clone(g.seeds)
+	for url := range g.members {
+		candidates = append(candidates, url)
+	}
+	g.mu.Unlock()
+
+	slices.Sort(candidates)
+	candidates = slices.Compact(candidates)
+	candidates = slices.DeleteFunc(candidates, func(url string) bool { return url == g.self })
+	if len(candidates) == 0 {
+		return ""
+	}
+	return candidates[rand.IntN(len(candidates))]
+}
+
+// message はハートビートを進め、他のノードに送る状態を作成します。
+func (g *gossip) message() gossipMessage {
+	state := g.server.backends.state()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.heartbeat++
+	members := []gossipMember{{URL: g.self, Heartbeat: g.heartbeat, Active: state.Active}}
+	for _, m := range g.members {
+		members = append(members, m.gossipMember)
+	}
+	return gossipMessage{From: g.self, Members: members, Backends: state}
+}
+
+// merge は他のノードの状態を取り込みます。
+func (g *gossip) merge(msg gossipMessage) {
+	now := g.now()
+	g.mu.Lock()
+	for _, m := range msg.Members {
+		if m.URL == "" || m.URL == g.self {
+			continue
+		}
+		known, ok := g.members[m.URL]
+		if !ok {
+			g.members[m.URL] = &knownMember{gossipMember: m, updated: now}
+			continue
+		}
+		if m.Heartbeat > known.Heartbeat {
+			known.gossipMember = m
+			known.updated = now
+		}
+	}
+	g.mu.Unlock()
+
+	changed, err := g.server.backends.merge(msg.Backends)
+	if err != nil {
+		g.server.logger.Warn("Ignored invalid cluster state", "from", msg.From, "error", err)
+		return
+	}
+	if changed {
+		g.server.logger.Info("Switched backend from cluster", "version", msg.Backends.Active, "from", msg.From)
+		g.server.drainBackend()
+	}
+}
+
+// statuses は自身を含む全ノードの状態を URL の順に返します。
+func (g *gossip) statuses() []memberStatus {
+	active := g.server.backends.current().Version
+	now := g.now()
+
+	g.mu.Lock()
+	statuses := []memberStatus{{URL: g.self, Active: active, Healthy: true, LastSeen: now}}
+	for _, m := range g.members {
+		statuses = append(statuses, memberStatus{
+			URL:      m.URL,
+			Active:   m.Active,
+			Healthy:  now.Sub(m.updated) <= gossipSuspectRounds*g.interval,
+			LastSeen: m.updated,
+		})
+	}
+	seen := make(map[string]bool, len(statuses))
+	for _, st := range statuses {
+		seen[st.URL] = true
+	}
+	g.mu.Unlock()
+
+	// まだ一度も状態を交換できていない既知のノード
+	for _, seed := range g.seeds {
+		if !seen[seed] {
+			statuses = append(statuses, memberStatus{URL: seed})
+			seen[seed] = true
+		}
+	}
+	slices.SortFunc(statuses, func(a, b memberStatus) int { return strings.Compare(a.URL, b.URL) })
+	return statuses
+}
+
+// healthyMembers は正常なノードの数を返します。
+func (g *gossip) healthyMembers() int {
+	n := 0
+	for _, st := range g.statuses() {
+		if st.Healthy {
+			n++
+		}
+	}
+	return n
+}
+
+// handleGossip は他のノードから届いた状態を取り込み、自身の状態を返します。
+func (s *Server) handleGossip(w http.ResponseWriter, r *http.Request) {
+	var msg gossipMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	s.gossip.merge(msg)
+	s.writeJSON(w, s.gossip.message())
+}
+
+// handleClusterStatus はクラスタ内の全ノードの状態を返します。
+func (s *Server) handleClusterStatus(w http.ResponseWriter, _ *http.Request) {
+	s.writeJSON(w, struct {
+		Members []memberStatus `json:"members"`
+	}{Members: s.gossip.statuses()})
+}
+
+// validateClusterConfig はクラスタモードに必要な設定を検証します。
+func validateClusterConfig(cfg *Config) error {
+	if cfg.AdvertiseURL == "" {
+		return fmt.Errorf("advertise URL is required in cluster mode")
+	}
+	if cfg.AdminToken == "" {
+		return fmt.Errorf("admin token is required in cluster mode to authenticate gossip")
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startClusterNode はクラスタモードのノードを HTTP サーバーとして起動します。
+func startClusterNode(t *testing.T, script string) (*Server, *httptest.Server) {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(nil)
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", script},
+		DefaultEnv:       map[string]string{},
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+		AdvertiseURL:     "http://" + ts.Listener.Addr().String(),
+		AdminToken:       testAdminToken,
+		Cluster:          true,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	ts.Config.Handler = server.Handler()
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return server, ts
+}
+
+func TestGossip_PropagatesBackends(t *testing.T) {
+	blue := `read line; echo '{"jsonrpc":"2.0","id":1,"result":{"version":"blue"}}'`
+	green := `read line; echo '{"jsonrpc":"2.0","id":1,"result":{"version":"green"}}'`
+	a, tsA := startClusterNode(t, blue)
+	b, tsB := startClusterNode(t, blue)
+	a.gossip.seeds = []string{tsB.URL}
+	b.gossip.seeds = []string{tsA.URL}
+
+	// a で登録・切り替えた設定が b に広まる
+	if err := a.backends.register(Backend{Version: "green", Command: "sh", Args: []string{"-c", green}}); err != nil {
+		t.Fatalf("register() error = %v", err)
+	}
+	if _, err := a.backends.activate("green"); err != nil {
+		t.Fatalf("activate() error = %v", err)
+	}
+	a.gossip.round(context.Background())
+
+	if got := b.backends.current().Version; got != "green" {
+		t.Fatalf("b active = %q, want green", got)
+	}
+	if got := mcpResult(t, b); !strings.Contains(got, "green") {
+		t.Errorf("b response = %s, want green", got)
+	}
+
+	// b でのロールバックも a に広まる
+	if _, err := b.backends.rollback(); err != nil {
+		t.Fatalf("rollback() error = %v", err)
+	}
+	b.gossip.round(context.Background())
+	if got := a.backends.current().Version; got != DefaultBackendVersion {
+		t.Errorf("a active = %q, want %q", got, DefaultBackendVersion)
+	}
+
+	// 交換できたノードは正常とみなし、ハートビートが止まると異常とみなす
+	statuses := a.gossip.statuses()
+	if len(statuses) != 2 {
+		t.Fatalf("statuses = %+v, want 2 members", statuses)
+	}
+	for _, st := range statuses {
+		if !st.Healthy {
+			t.Errorf("member %s should be healthy", st.URL)
+		}
+	}
+	later := time.Now().Add(gossipSuspectRounds*DefaultGossipInterval + time.Second)
+	a.gossip.now = func() time.Time { return later }
+	if n := a.gossip.healthyMembers(); n != 1 {
+		t.Errorf("healthy members = %d, want only self", n)
+	}
+}
+
+func TestGossip_Status(t *testing.T) {
+	a, _ := startClusterNode(t, "cat")
+	a.gossip.seeds = []string{"http://127.0.0.1:1"}
+
+	// 交換できないノードは異常として一覧に含める
+	a.gossip.round(context.Background())
+	w, _ := adminRequest(t, a, "GET", "/admin/cluster", "")
+	if w.Code != 200 {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `{"url":"http://127.0.0.1:1","healthy":false}`) {
+		t.Errorf("body = %s, want the unreachable seed as unhealthy", w.Body.String())
+	}
+}
+
+func TestBackends_Merge(t *testing.T) {
+	v2 := []Backend{{Version: "default", Command: "cat"}, {Version: "v2", Command: "cat", Args: []string{"-u"}}}
+
+	tests := []struct {
+		name        string
+		local       backendState
+		remote      backendState
+		wantActive  string
+		wantChanged bool
+		wantErr     bool
+	}{
+		{name: "新しい論理時刻_置き換える", remote: backendState{Revision: 1, Origin: "http://b", Active: "v2", Versions: v2}, wantActive: "v2", wantChanged: true},
+		{name: "古い論理時刻_無視", local: backendState{Revision: 3, Origin: "http://a"}, remote: backendState{Revision: 2, Origin: "http://b", Active: "v2", Versions: v2}, wantActive: "default"},
+		{name: "同じ論理時刻_URLが大きい方を採用", local: backendState{Revision: 2, Origin: "http://a"}, remote: backendState{Revision: 2, Origin: "http://b", Active: "v2", Versions: v2}, wantActive: "v2", wantChanged: true},
+		{name: "同じ論理時刻_URLが小さい方は無視", local: backendState{Revision: 2, Origin: "http://c"}, remote: backendState{Revision: 2, Origin: "http://b", Active: "v2", Versions: v2}, wantActive: "default"},
+		{name: "同じコマンドのまま_切り替えなし", remote: backendState{Revision: 1, Origin: "http://b", Active: "default", Versions: v2}, wantActive: "default"},
+		{name: "有効なバージョンが未定義_エラー", remote: backendState{Revision: 1, Origin: "http://b", Active: "v3", Versions: v2}, wantActive: "default", wantErr: true},
+		{name: "コマンドなし_エラー", remote: backendState{Revision: 1, Origin: "http://b", Active: "v2", Versions: []Backend{{Version: "v2"}}}, wantActive: "default", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBackends(Backend{Version: "default", Command: "cat"})
+			b.revision, b.origin = tt.local.Revision, tt.local.Origin
+
+			changed, err := b.merge(tt.remote)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("merge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("merge() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if got := b.current().Version; got != tt.wantActive {
+				t.Errorf("active = %q, want %q", got, tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestNewServer_ClusterRequirements(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "AdvertiseURLなし_エラー", cfg: Config{Command: "cat", Cluster: true, AdminToken: testAdminToken}},
+		{name: "AdminTokenなし_エラー", cfg: Config{Command: "cat", Cluster: true, AdvertiseURL: "http://127.0.0.1:8080"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewServer(&tt.cfg, slog.New(slog.NewJSONHandler(os.Stderr, nil))); err == nil {
+				t.Error("NewServer() expected error but got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// GRPCServiceName は gRPC フロントエンドのサービス名です（proto/tumiki/mcp/v1/proxy.proto）。
+const GRPCServiceName = "tumiki.mcp.v1.MCPProxy"
+
+// grpcProxyServer は MCPProxy サービスの実装が満たすインターフェースです。
+type grpcProxyServer interface {
+	call(ctx context.Context, req *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error)
+	stream(stream grpc.ServerStream) error
+}
+
+// grpcServiceDesc は protoc の生成コードを使わずに定義した MCPProxy のサービス記述です。
+// メッセージはいずれも google.protobuf.BytesValue に JSON-RPC メッセージを格納します。
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: GRPCServiceName,
+	HandlerType: (*grpcProxyServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Call",
+			Handler:    grpcCallHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			Handler:       grpcStreamHandler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "tumiki/mcp/v1/proxy.proto",
+}
+
+func grpcCallHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	req := new(wrapperspb.BytesValue)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(grpcProxyServer).call(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + GRPCServiceName + "/Call",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(grpcProxyServer).call(ctx, req.(*wrapperspb.BytesValue))
+	}
+	return interceptor(ctx, req, info, handler)
+}
+
+func grpcStreamHandler(srv any, stream grpc.ServerStream) error {
+	return srv.(grpcProxyServer).stream(stream)
+}
+
+// newGRPCServer は MCPProxy サービスを登録した gRPC サーバーを作成します。
+func (s *Server) newGRPCServer() *grpc.Server {
+	options := []grpc.ServerOption{grpc.MaxRecvMsgSize(s.maxMessageSize()), grpc.MaxSendMsgSize(s.maxMessageSize())}
+	if s.cfg.SPIFFE != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(s.cfg.SPIFFE.ServerTLSConfig())))
+	}
+	gs := grpc.NewServer(options...)
+	gs.RegisterService(&grpcServiceDesc, s)
+	return gs
+}
+
+// call は1つの JSON-RPC メッセージを stdio プロセスに渡し、最初のレスポンスを返します。
+// HTTP の POST /mcp と同じ処理を行い、メソッドごとのメトリクスとアクセスログに記録します。
+func (s *Server) call(ctx context.Context, req *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error) {
+	start := time.Now()
+	obs := &observation{}
+	ctx = context.WithValue(ctx, observationKey{}, obs)
+	observeBody(ctx, req.GetValue())
+
+	response, err := s.unaryCall(ctx, req)
+	result := resultOK
+	switch {
+	case obs.partialOutput:
+		result = resultPartialOutput
+	case err != nil:
+		result = resultError
+	case obs.rpcError:
+		result = resultRPCError
+	}
+	s.observer.record(ctx, transportGRPC, obs, result, status.Code(err).String(), time.Since(start))
+	return response, err
+}
+
+func (s *Server) unaryCall(ctx context.Context, req *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error) {
+	if s.isFollower() {
+		return nil, grpcError(errNotLeader)
+	}
+
+	body, err := s.prepareRequest(ctx, req.GetValue())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ProcessTimeout)
+	defer cancel()
+
+	if err := s.authenticateGRPC(ctx); err != nil {
+		return nil, err
+	}
+	header, err := s.requestHeaders(ctx, s.metadataHeader(ctx), grpcMethod(ctx))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	ctx = s.offloadContext(ctx, header)
+
+	meter := s.newUsageMeter(header, s.backends.current().Version)
+	call := meter.request(body)
+
+	cached, response := s.cacheLookup(header, body)
+	if response == nil {
+		response, _, err = s.executeIdempotent(ctx, header, body)
+		if err != nil {
+			meter.fail(call)
+			if response, ok := s.partialOutputResponse(ctx, body, err); ok {
+				return wrapperspb.Bytes(response), nil
+			}
+			if errors.Is(err, errIdempotencyMismatch) || errors.Is(err, errIdempotencyKeyTooLong) {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+			s.logger.Error("Process execution failed", "error", err)
+			return nil, status.Error(codes.Internal, "process execution failed")
+		}
+		s.cacheStore(cached, response)
+	}
+
+	response, err = s.processResponse(ctx, response, call.method)
+	if err != nil {
+		s.logger.Error("Response processing failed", "error", err)
+		meter.fail(call)
+		return nil, status.Error(codes.Internal, "response processing failed")
+	}
+	meter.response(call, response)
+	observeResponse(ctx, response)
+
+	return wrapperspb.Bytes(response), nil
+}
+
+// stream はストリームの間1つの stdio プロセスを起動し続け、双方向に JSON-RPC メッセージを中継します。
+// クライアントが送信を終えると stdin を閉じ、プロセスの出力がすべて届いた時点でストリームを終了します。
+func (s *Server) stream(stream grpc.ServerStream) error {
+	recv := func() ([]byte, error) {
+		req := new(wrapperspb.BytesValue)
+		if err := stream.RecvMsg(req); err != nil {
+			return nil, err
+		}
+		return req.GetValue(), nil
+	}
+	send := func(msg []byte) error {
+		return stream.SendMsg(wrapperspb.Bytes(msg))
+	}
+
+	ctx := stream.Context()
+	if err := s.authenticateGRPC(ctx); err != nil {
+		return err
+	}
+	header, err := s.requestHeaders(ctx, s.metadataHeader(ctx), grpcMethod(ctx))
+	if err != nil {
+		return grpcError(err)
+	}
+	if err := s.relay(ctx, header, recv, send); err != nil {
+		return grpcError(err)
+	}
+	return nil
+}
+
+// metadataHeader は gRPC の受信メタデータを http.Header に変換します。
+// ヘッダーマッピングを HTTP と同じ設定で適用するために使用し、HTTP と同じく設定したヘッダーを削除します。
+func (s *Server) metadataHeader(ctx context.Context) http.Header {
+	header := make(http.Header)
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		for _, v := range values {
+			header.Add(key, v)
+		}
+	}
+	if s.headerStripper != nil {
+		s.headerStripper.strip(header)
+	}
+	return header
+}
+
+// authenticateGRPC は接続元の SPIFFE ID を認可してプラグインでメタデータを認証し、拒否された場合は gRPC のステータスエラーを返します。
+func (s *Server) authenticateGRPC(ctx context.Context) error {
+	if err := s.authorizeSPIFFEGRPC(ctx); err != nil {
+		return err
+	}
+	if len(s.cfg.Plugins) == 0 {
+		return nil
+	}
+	result, err := s.authenticate(ctx, http.MethodPost, grpcMethod(ctx), s.metadataHeader(ctx))
+	if err != nil {
+		s.logger.Error("Plugin authentication failed", "error", err)
+		return status.Error(codes.Internal, "authentication failed")
+	}
+	if result.Allow {
+		return nil
+	}
+	code := codes.Unauthenticated
+	if result.Status == http.StatusForbidden {
+		code = codes.PermissionDenied
+	}
+	message := result.Message
+	if message == "" {
+		message = "rejected by plugin"
+	}
+	return status.Error(code, message)
+}
+
+// grpcMethod は呼び出された gRPC のメソッド名（"/service/method"）を返します。
+func grpcMethod(ctx context.Context) string {
+	method, _ := grpc.Method(ctx)
+	return method
+}
+
+// grpcError はエラーを gRPC のステータスエラーに変換します。
+func grpcError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var denied *scriptDeniedError
+	if errors.As(err, &denied) {
+		return status.Error(codes.PermissionDenied, denied.Error())
+	}
+	if errors.Is(err, errInvalidRequest) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, errTokenRejected) {
+		return status.Error(codes.Unauthenticated, "token exchange rejected")
+	}
+	if errors.Is(err, errTokenExchange) {
+		return status.Error(codes.Unavailable, "token exchange failed")
+	}
+	if errors.Is(err, errNotLeader) {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	if isRelayError(err) {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return status.FromContextError(err).Err()
+}
@@ -0,0 +1,310 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mcptest"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/rewrite"
+)
+
+// startGRPC は cfg の gRPC フロントエンドをローカルで起動し、接続済みのクライアントを返します。
+func startGRPC(t *testing.T, cfg *Config) *grpc.ClientConn {
+	t.Helper()
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	server, err := NewServer(cfg, logger)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	gs := server.newGRPCServer()
+	go func() { _ = gs.Serve(lis) }()
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestGRPC_Call(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		args     []string
+		md       metadata.MD
+		want     string
+		wantCode codes.Code
+	}{
+		{
+			name:    "メタデータ_環境変数にマッピングされる",
+			command: "sh",
+			args:    []string{"-c", `read line; echo "{\"token\":\"$TOKEN\"}"`},
+			md:      metadata.Pairs("x-token", "secret"),
+			want:    `{"token":"secret"}`,
+		},
+		{
+			name:     "プロセス失敗_Internalを返す",
+			command:  "false",
+			args:     []string{},
+			wantCode: codes.Internal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := startGRPC(t, &Config{
+				Command:          tt.command,
+				Args:             tt.args,
+				DefaultEnv:       map[string]string{},
+				HeaderEnvMapping: map[string]string{"X-Token": "TOKEN"},
+				HeaderArgMapping: map[string]string{},
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			ctx = metadata.NewOutgoingContext(ctx, tt.md)
+
+			resp := new(wrapperspb.BytesValue)
+			err := conn.Invoke(ctx, "/"+GRPCServiceName+"/Call", wrapperspb.Bytes([]byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)), resp)
+			if tt.wantCode != codes.OK {
+				if status.Code(err) != tt.wantCode {
+					t.Fatalf("Call() error = %v, want code %v", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Call() error = %v", err)
+			}
+			if string(resp.GetValue()) != tt.want {
+				t.Errorf("Call() = %s, want %s", resp.GetValue(), tt.want)
+			}
+		})
+	}
+}
+
+func TestGRPC_Stream(t *testing.T) {
+	command, args, env := mcptest.Command(mcptest.ModeCompliant)
+	conn := startGRPC(t, &Config{
+		Command:          command,
+		Args:             args,
+		DefaultEnv:       env,
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+		ResponseTransforms: rewrite.ResponseTransforms{{
+			Set: map[string]any{"result._meta.method": "{{.Method}}"},
+		}},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, "/"+GRPCServiceName+"/Stream")
+	if err != nil {
+		t.Fatalf("NewStream() error = %v", err)
+	}
+
+	// 同一プロセスに複数のメッセージを送り、通知を含めてすべて受け取れることを検証
+	requests := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`,
+	}
+	for _, req := range requests {
+		if err := stream.SendMsg(wrapperspb.Bytes([]byte(req))); err != nil {
+			t.Fatalf("SendMsg() error = %v", err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("CloseSend() error = %v", err)
+	}
+
+	var got []string
+	for {
+		resp := new(wrapperspb.BytesValue)
+		err := stream.RecvMsg(resp)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("RecvMsg() error = %v", err)
+		}
+		got = append(got, string(resp.GetValue()))
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("received %d messages, want 3: %v", len(got), got)
+	}
+	if !strings.Contains(got[0], `"method":"initialize"`) {
+		t.Errorf("initialize response should carry its method: %s", got[0])
+	}
+	if !strings.Contains(got[1], `"notifications/message"`) {
+		t.Errorf("second message should be the notification: %s", got[1])
+	}
+	if !strings.Contains(got[2], `"text":"hi"`) || !strings.Contains(got[2], `"method":"tools/call"`) {
+		t.Errorf("tools/call response should be transformed with its method: %s", got[2])
+	}
+}
+
+func TestGRPC_Stream_ProcessFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+	}{
+		{name: "存在しないコマンド_Internalを返す", command: "/nonexistent/command", args: []string{}},
+		{name: "異常終了_Internalを返す", command: "sh", args: []string{"-c", "exit 1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := startGRPC(t, &Config{
+				Command:          tt.command,
+				Args:             tt.args,
+				DefaultEnv:       map[string]string{},
+				HeaderEnvMapping: map[string]string{},
+				HeaderArgMapping: map[string]string{},
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, "/"+GRPCServiceName+"/Stream")
+			if err != nil {
+				t.Fatalf("NewStream() error = %v", err)
+			}
+			err = stream.RecvMsg(new(wrapperspb.BytesValue))
+			if status.Code(err) != codes.Internal {
+				t.Errorf("RecvMsg() error = %v, want code Internal", err)
+			}
+		})
+	}
+}
+
+func TestGRPCError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{name: "ステータスエラー_そのまま返す", err: status.Error(codes.InvalidArgument, "bad"), want: codes.InvalidArgument},
+		{name: "キャンセル_Canceledに変換する", err: context.Canceled, want: codes.Canceled},
+		{name: "タイムアウト_DeadlineExceededに変換する", err: context.DeadlineExceeded, want: codes.DeadlineExceeded},
+		{name: "プロセス側の失敗_Internalに変換する", err: errProcessFailed, want: codes.Internal},
+		{name: "不正なペイロード_InvalidArgumentに変換する", err: fmt.Errorf("%w: bad", errInvalidRequest), want: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(grpcError(tt.err)); got != tt.want {
+				t.Errorf("grpcError() code = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_Start_GRPC(t *testing.T) {
+	t.Setenv("HOST", "127.0.0.1")
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	// 空いているポートを確保してから解放し、gRPC ポートとして使う
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	grpcPort := lis.Addr().(*net.TCPAddr).Port
+	_ = lis.Close()
+
+	server, err := NewServer(&Config{
+		Port:             0,
+		GRPCPort:         grpcPort,
+		Command:          "sh",
+		Args:             []string{"-c", `read line; echo '{"jsonrpc":"2.0","id":1,"result":{}}'`},
+		DefaultEnv:       map[string]string{},
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+	}, logger)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start(ctx)
+	}()
+
+	conn, err := grpc.NewClient(server.grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	callCtx, callCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer callCancel()
+	resp := new(wrapperspb.BytesValue)
+	if err := conn.Invoke(callCtx, "/"+GRPCServiceName+"/Call", wrapperspb.Bytes([]byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)), resp, grpc.WaitForReady(true)); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-errChan:
+		if err != nil {
+			t.Errorf("Server.Start() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Server shutdown timeout")
+	}
+}
+
+func TestServer_Start_GRPCListenError(t *testing.T) {
+	t.Setenv("HOST", "127.0.0.1")
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	// 使用中のポートを指定すると Start がエラーを返す
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer func() { _ = lis.Close() }()
+
+	server, err := NewServer(&Config{
+		Port:             0,
+		GRPCPort:         lis.Addr().(*net.TCPAddr).Port,
+		Command:          "echo",
+		Args:             []string{},
+		DefaultEnv:       map[string]string{},
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+	}, logger)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	if err := server.Start(context.Background()); err == nil || !strings.Contains(err.Error(), "grpc listen") {
+		t.Errorf("Server.Start() error = %v, want grpc listen error", err)
+	}
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/templatefunc"
+)
+
+// ヘッダーの値のデコード方式です。
+// HTTP ヘッダーには改行やバイナリを含められないため、クライアントがエンコードした値を復元して
+// 環境変数・引数に渡します。
+const (
+	HeaderDecodingPercent   = "percent"   // パーセントエンコーディング（例: "line1%0Aline2"）
+	HeaderDecodingBase64    = "base64"    // 標準の base64（パディングは省略可）
+	HeaderDecodingBase64URL = "base64url" // URL セーフな base64（パディングは省略可）
+)
+
+// headerDecoder はヘッダーの値をデコードします。
+type headerDecoder func(value string) (string, error)
+
+// newHeaderDecoders はヘッダー名 → デコード方式の設定から、正規化したヘッダー名ごとのデコーダーを作成します。
+func newHeaderDecoders(decoding map[string]string) (map[string]headerDecoder, error) {
+	normalized, err := normalizeHeaderMapping(decoding)
+	if err != nil {
+		return nil, err
+	}
+
+	decoders := make(map[string]headerDecoder, len(normalized))
+	for name, method := range normalized {
+		switch strings.ToLower(method) {
+		case HeaderDecodingPercent:
+			decoders[name] = url.PathUnescape
+		case HeaderDecodingBase64:
+			decoders[name] = base64Decoder(base64.RawStdEncoding)
+		case HeaderDecodingBase64URL:
+			decoders[name] = base64Decoder(base64.RawURLEncoding)
+		default:
+			return nil, fmt.Errorf("unknown decoding %q for header %q (want %s, %s or %s)",
+				method, name, HeaderDecodingPercent, HeaderDecodingBase64, HeaderDecodingBase64URL)
+		}
+	}
+	return decoders, nil
+}
+
+// withHeaderTemplates はヘッダー名 → テンプレートの設定を decoders に追加します。
+// テンプレートは {{.Value}} でヘッダーの値を参照し、templatefunc の関数を使えます。
+// デコード方式も設定されたヘッダーは、デコードした値をテンプレートに渡します。
+func withHeaderTemplates(decoders map[string]headerDecoder, templates map[string]string) error {
+	normalized, err := normalizeHeaderMapping(templates)
+	if err != nil {
+		return err
+	}
+	for name, text := range normalized {
+		tmpl, err := template.New(name).Funcs(templatefunc.FuncMap()).Parse(text)
+		if err != nil {
+			return fmt.Errorf("header %s: %w", name, err)
+		}
+		render := func(value string) (string, error) {
+			var b strings.Builder
+			if err := tmpl.Execute(&b, struct{ Value string }{value}); err != nil {
+				return "", err
+			}
+			return b.String(), nil
+		}
+		// .Value 以外のフィールドの参照などは起動時に検出する
+		if _, err := render(""); err != nil {
+			return fmt.Errorf("header %s: %w", name, err)
+		}
+		if decode, ok := decoders[name]; ok {
+			decoders[name] = func(value string) (string, error) {
+				plain, err := decode(value)
+				if err != nil {
+					return "", err
+				}
+				return render(plain)
+			}
+			continue
+		}
+		decoders[name] = render
+	}
+	return nil
+}
+
+// base64Decoder はパディングの有無にかかわらず enc でデコードするデコーダーを返します。
+func base64Decoder(enc *base64.Encoding) headerDecoder {
+	return func(value string) (string, error) {
+		decoded, err := enc.DecodeString(strings.TrimRight(value, "="))
+		return string(decoded), err
+	}
+}
+
+// decodeHeaders はデコード方式・テンプレートが設定されたヘッダーの値を変換したヘッダーを返します。
+// 元のヘッダーは変更しません。デコード・テンプレートの評価ができない値の場合は errInvalidRequest を返します。
+func (s *Server) decodeHeaders(header http.Header) (http.Header, error) {
+	if len(s.headerDecoders) == 0 {
+		return header, nil
+	}
+
+	decoded := header.Clone()
+	if decoded == nil {
+		decoded = make(http.Header)
+	}
+	for name, decode := range s.headerDecoders {
+		value := headerValue(header, name)
+		if value == "" {
+			continue
+		}
+		plain, err := decode(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: header %s: %v", errInvalidRequest, name, err)
+		}
+		// 環境変数・引数には NUL 文字を渡せない
+		if strings.ContainsRune(plain, 0) {
+			return nil, fmt.Errorf("%w: header %s: decoded value contains NUL", errInvalidRequest, name)
+		}
+		decoded.Set(name, plain)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,263 @@
+package proxy
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDecodeHeaders(t *testing.T) {
+	decoding := map[string]string{
+		"X-Pem":    HeaderDecodingPercent,
+		"X-Secret": HeaderDecodingBase64,
+		"X-Url":    HeaderDecodingBase64URL,
+	}
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "パーセントエンコーディング_改行を復元",
+			header: http.Header{"X-Pem": {"line1%0Aline2%20end"}},
+			want:   map[string]string{"X-Pem": "line1\nline2 end"},
+		},
+		{
+			name:   "base64_パディングあり",
+			header: http.Header{"X-Secret": {"c2VjcmV0Cg=="}},
+			want:   map[string]string{"X-Secret": "secret\n"},
+		},
+		{
+			name:   "base64_パディングなし",
+			header: http.Header{"X-Secret": {"c2VjcmV0Cg"}},
+			want:   map[string]string{"X-Secret": "secret\n"},
+		},
+		{
+			name:   "base64url_URLセーフな文字を復元",
+			header: http.Header{"X-Url": {"-_8"}},
+			want:   map[string]string{"X-Url": "\xfb\xff"},
+		},
+		{
+			name:   "正規化されていないヘッダーキー_デコードされる",
+			header: http.Header{"x-secret": {"c2VjcmV0Cg=="}},
+			want:   map[string]string{"X-Secret": "secret\n"},
+		},
+		{
+			name:   "設定のないヘッダー_そのまま",
+			header: http.Header{"X-Other": {"a%0Ab"}},
+			want:   map[string]string{"X-Other": "a%0Ab"},
+		},
+		{
+			name:    "不正なパーセントエンコーディング_エラー",
+			header:  http.Header{"X-Pem": {"%zz"}},
+			wantErr: true,
+		},
+		{
+			name:    "不正なbase64_エラー",
+			header:  http.Header{"X-Secret": {"!!!"}},
+			wantErr: true,
+		},
+		{
+			name:    "NUL文字を含む_エラー",
+			header:  http.Header{"X-Pem": {"a%00b"}},
+			wantErr: true,
+		},
+	}
+
+	server, err := NewServer(&Config{Command: "cat", HeaderDecoding: decoding}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := tt.header.Clone()
+			got, err := server.decodeHeaders(tt.header)
+			if tt.wantErr {
+				if !errors.Is(err, errInvalidRequest) {
+					t.Fatalf("decodeHeaders() error = %v, want errInvalidRequest", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeHeaders() unexpected error: %v", err)
+			}
+			for name, want := range tt.want {
+				if v := headerValue(got, name); v != want {
+					t.Errorf("header %s = %q, want %q", name, v, want)
+				}
+			}
+			// 元のヘッダーは変更しない
+			for name := range original {
+				if tt.header.Get(name) != original.Get(name) {
+					t.Errorf("original header %s was modified", name)
+				}
+			}
+		})
+	}
+}
+
+func TestNewServer_InvalidHeaderDecoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		decoding map[string]string
+	}{
+		{name: "未知のデコード方式_エラー", decoding: map[string]string{"X-Secret": "hex"}},
+		{name: "正規化後に異なる方式_エラー", decoding: map[string]string{"X-Secret": "base64", "x-secret": "percent"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewServer(&Config{Command: "cat", HeaderDecoding: tt.decoding}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+			if err == nil {
+				t.Error("NewServer() expected error but got none")
+			}
+		})
+	}
+}
+
+func TestHandleMCP_HeaderDecoding(t *testing.T) {
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", `read line; printf '%s' "$PEM" | wc -l`},
+		DefaultEnv:       map[string]string{},
+		HeaderEnvMapping: map[string]string{"X-Pem": "PEM"},
+		HeaderArgMapping: map[string]string{},
+		HeaderDecoding:   map[string]string{"X-Pem": HeaderDecodingPercent},
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		value    string
+		wantCode int
+		wantBody string
+	}{
+		{name: "改行を含む値_環境変数に復元される", value: "a%0Ab%0Ac", wantCode: http.StatusOK, wantBody: "2"},
+		{name: "デコードできない値_400", value: "%zz", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Pem", tt.value)
+			w := httptest.NewRecorder()
+			server.handleMCP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("Status = %d, want %d (body: %s)", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantBody != "" && strings.TrimSpace(w.Body.String()) != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandleMCP_HeaderTemplates(t *testing.T) {
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", `read line; printf '%s:%s\n' "$TOKEN" "$*"`, "sh"},
+		HeaderEnvMapping: map[string]string{"Authorization": "TOKEN"},
+		HeaderArgMapping: map[string]string{"X-Region": "region"},
+		HeaderDecoding:   map[string]string{"X-Region": HeaderDecodingBase64},
+		HeaderTemplates: map[string]string{
+			"authorization": `{{.Value | trimPrefix "Bearer "}}`,
+			"X-Region":      `{{.Value | lower}}`,
+		},
+		Servers: map[string]ServerDefinition{
+			"github": {
+				Command:          "sh",
+				Args:             []string{"-c", `read line; printf '%s\n' "$GITHUB_TOKEN"`},
+				HeaderEnvMapping: map[string]string{"Authorization": "GITHUB_TOKEN"},
+			},
+		},
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		headers  map[string]string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "環境変数のマッピング_テンプレートで変換",
+			path:     "/mcp",
+			headers:  map[string]string{"Authorization": "Bearer ghp_abc"},
+			wantCode: http.StatusOK,
+			wantBody: "ghp_abc:",
+		},
+		{
+			name:     "引数のマッピング_デコードしてから変換",
+			path:     "/mcp",
+			headers:  map[string]string{"X-Region": "VVMtRWFzdA"},
+			wantCode: http.StatusOK,
+			wantBody: ":--region us-east",
+		},
+		{
+			name:     "名前付きのサーバーのマッピング_テンプレートで変換",
+			path:     "/servers/github/mcp",
+			headers:  map[string]string{"Authorization": "Bearer ghp_abc"},
+			wantCode: http.StatusOK,
+			wantBody: "ghp_abc",
+		},
+		{
+			name:     "デコードできない値_400",
+			path:     "/mcp",
+			headers:  map[string]string{"X-Region": "!!!"},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			req.Header.Set("Content-Type", "application/json")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("Status = %d, want %d (body: %s)", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantBody != "" && strings.TrimSpace(w.Body.String()) != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestNewServer_InvalidHeaderTemplate(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates map[string]string
+	}{
+		{name: "構文エラー_エラー", templates: map[string]string{"X-Token": "{{.Value"}},
+		{name: "未定義の関数_エラー", templates: map[string]string{"X-Token": "{{title .Value}}"}},
+		{name: "Value 以外のフィールド_エラー", templates: map[string]string{"X-Token": "{{.Header}}"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewServer(&Config{Command: "cat", HeaderTemplates: tt.templates}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+			if err == nil {
+				t.Error("NewServer() expected error but got none")
+			}
+		})
+	}
+}
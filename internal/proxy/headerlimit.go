@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jwtauth"
+)
+
+// マッピングでプロセスに渡すヘッダーの値のデフォルトの上限です。
+// Linux では引数・環境変数の1つの文字列が 128KiB、合計がスタックサイズの 1/4 までに制限されるため、
+// exec が失敗しないよう十分小さい値にしています。
+const (
+	DefaultMaxHeaderValueBytes = 8 * 1024  // マッピングするヘッダーの値1つあたりの最大バイト数
+	DefaultMaxInjectedBytes    = 64 * 1024 // ヘッダーから追加する環境変数・引数の合計の最大バイト数
+)
+
+// errHeaderTooLarge はマッピングするヘッダーの値が上限を超えたことを表します。
+var errHeaderTooLarge = fmt.Errorf("%w: mapped header value too large", errInvalidRequest)
+
+// requestHeaders はリクエストヘッダーをデコードし、マッピングでプロセスに渡す値が上限内かを検証します。
+// path は条件付きマッピングのパスの条件とスクリプト、名前付きのサーバーの選択に使用します。
+// 値1つが上限を超えた場合は errHeaderTooLarge を、合計が上限を超えた場合は errInvalidRequest を、
+// スクリプトが拒否した場合は scriptDeniedError を、トークンを交換できない場合は errTokenRejected・errTokenExchange を返します。
+// プロセスに必要な環境変数が設定されない場合は errInvalidRequest を返します。
+func (s *Server) requestHeaders(ctx context.Context, header http.Header, path string) (http.Header, error) {
+	header, err := s.decodeHeaders(header)
+	if err != nil {
+		return nil, err
+	}
+	if header, err = s.mapPluginHeaders(ctx, header, path); err != nil {
+		return nil, err
+	}
+	// スクリプト・マッピングにはクライアントのトークンを渡さない
+	if header, err = s.exchangeToken(ctx, header); err != nil {
+		return nil, err
+	}
+	if len(s.cfg.MappingRules) > 0 {
+		header = withMappingRequest(header, path, jwtauth.FromContext(ctx))
+	}
+	if len(s.defs().servers) > 0 {
+		header = withServerName(header, path)
+	}
+	scriptBytes := 0
+	if len(s.cfg.Scripts) > 0 {
+		if header, scriptBytes, err = s.runScripts(ctx, header, path); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkStagedFiles(header); err != nil {
+		return nil, err
+	}
+
+	maxValue := s.cfg.MaxHeaderValueBytes
+	if maxValue == 0 {
+		maxValue = DefaultMaxHeaderValueBytes
+	}
+	maxTotal := s.cfg.MaxInjectedBytes
+	if maxTotal == 0 {
+		maxTotal = DefaultMaxInjectedBytes
+	}
+
+	// スクリプトが計算した環境変数・引数
+	total := scriptBytes
+	if maxTotal > 0 && total > maxTotal {
+		return nil, fmt.Errorf("%w: injected environment variables and arguments exceed %d bytes", errInvalidRequest, maxTotal)
+	}
+	check := func(headerName string, injected func(value string) int) error {
+		value := headerValue(header, headerName)
+		if value == "" {
+			return nil
+		}
+		if maxValue > 0 && len(value) > maxValue {
+			return fmt.Errorf("%w: %s is %d bytes (max %d)", errHeaderTooLarge, headerName, len(value), maxValue)
+		}
+		total += injected(value)
+		if maxTotal > 0 && total > maxTotal {
+			return fmt.Errorf("%w: injected environment variables and arguments exceed %d bytes", errInvalidRequest, maxTotal)
+		}
+		return nil
+	}
+
+	envMapping, argMapping := s.headerMappings(header)
+	for headerName, envName := range envMapping {
+		// "NAME=value" と終端の NUL
+		if err := check(headerName, func(value string) int { return len(envName) + len(value) + 2 }); err != nil {
+			return nil, err
+		}
+	}
+	for headerName, argName := range argMapping {
+		// 引数ごとの文字列と終端の NUL
+		if err := check(headerName, func(value string) int {
+			n := 0
+			for _, arg := range renderArg(argName, value) {
+				n += len(arg) + 1
+			}
+			return n
+		}); err != nil {
+			return nil, err
+		}
+	}
+	for _, rule := range s.cfg.MappingRules {
+		// 条件を満たさない場合も含め、環境変数・引数の最大の長さで数える
+		if err := check(rule.Header, func(value string) int {
+			if rule.Arg == nil {
+				return len(rule.Env) + len(value) + 2
+			}
+			n := 0
+			for _, arg := range renderArg(*rule.Arg, value) {
+				n += len(arg) + 1
+			}
+			return n
+		}); err != nil {
+			return nil, err
+		}
+	}
+	for headerName := range s.argOverrides {
+		// 置き換えた値と終端の NUL（置き換えられる元の値の分は差し引かない）
+		if err := check(headerName, func(value string) int { return len(value) + 1 }); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkRequiredEnv(header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
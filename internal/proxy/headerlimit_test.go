@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHandleMCP_HeaderLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxValue  int
+		maxTotal  int
+		headers   map[string]string
+		wantCode  int
+		wantInErr string
+	}{
+		{
+			name:     "上限内_200",
+			maxValue: 16,
+			maxTotal: 64,
+			headers:  map[string]string{"X-Token": "short", "X-Team-Id": "T123"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:      "値1つが上限を超える_431",
+			maxValue:  16,
+			headers:   map[string]string{"X-Token": strings.Repeat("a", 17)},
+			wantCode:  http.StatusRequestHeaderFieldsTooLarge,
+			wantInErr: "X-Token",
+		},
+		{
+			name:      "合計が上限を超える_400",
+			maxValue:  16,
+			maxTotal:  32,
+			headers:   map[string]string{"X-Token": strings.Repeat("a", 16), "X-Team-Id": strings.Repeat("b", 16)},
+			wantCode:  http.StatusBadRequest,
+			wantInErr: "exceed 32 bytes",
+		},
+		{
+			name:     "マッピングのないヘッダー_上限の対象外",
+			maxValue: 16,
+			headers:  map[string]string{"X-Other": strings.Repeat("a", 100)},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "負の値_無制限",
+			maxValue: -1,
+			maxTotal: -1,
+			headers:  map[string]string{"X-Token": strings.Repeat("a", DefaultMaxInjectedBytes+1)},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "0_デフォルトの上限",
+			headers:  map[string]string{"X-Token": strings.Repeat("a", DefaultMaxHeaderValueBytes+1)},
+			wantCode: http.StatusRequestHeaderFieldsTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewServer(&Config{
+				Command:             "sh",
+				Args:                []string{"-c", `read line; echo "$line"`, "sh"},
+				DefaultEnv:          map[string]string{},
+				HeaderEnvMapping:    map[string]string{"X-Token": "TOKEN"},
+				HeaderArgMapping:    map[string]string{"X-Team-Id": "team-id"},
+				MaxHeaderValueBytes: tt.maxValue,
+				MaxInjectedBytes:    tt.maxTotal,
+			}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+
+			req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			req.Header.Set("Content-Type", "application/json")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			server.handleMCP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("Status = %d, want %d (body: %s)", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantInErr != "" && !strings.Contains(w.Body.String(), tt.wantInErr) {
+				t.Errorf("body = %q, want it to contain %q", w.Body.String(), tt.wantInErr)
+			}
+		})
+	}
+}
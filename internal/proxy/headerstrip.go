@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// headerStripper は設定したパターンに一致するリクエストヘッダーを、マッピングや認証より前に削除します。
+// クライアントがプロキシやプラグインにとって意味のある内部ヘッダーを偽装できないようにします。
+type headerStripper struct {
+	names    map[string]bool // 完全一致（正規化したヘッダー名）
+	prefixes []string        // 末尾の * で指定した前方一致（正規化したヘッダー名の接頭辞）
+}
+
+// newHeaderStripper はパターンを検証して headerStripper を作成します。
+// パターンはヘッダー名か、末尾に * を付けた接頭辞（例: "X-Internal-*"）で、大文字小文字を区別しません。
+func newHeaderStripper(patterns []string) (*headerStripper, error) {
+	h := &headerStripper{names: make(map[string]bool)}
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		prefix, wildcard := strings.CutSuffix(pattern, "*")
+		if prefix == "" || strings.Contains(prefix, "*") {
+			return nil, fmt.Errorf("invalid header pattern %q (use a header name or a prefix ending with *)", pattern)
+		}
+		if wildcard {
+			h.prefixes = append(h.prefixes, strings.ToLower(prefix))
+		} else {
+			h.names[http.CanonicalHeaderKey(prefix)] = true
+		}
+	}
+	return h, nil
+}
+
+// strip は一致するヘッダーを header から削除し、削除したヘッダー名を返します。
+// 転送元のレプリカを示すヘッダーは再転送を防ぐために必要なため削除しません。
+func (h *headerStripper) strip(header http.Header) []string {
+	var removed []string
+	for name := range header {
+		if name == headerForwardedBy || !h.match(name) {
+			continue
+		}
+		delete(header, name)
+		removed = append(removed, name)
+	}
+	return removed
+}
+
+func (h *headerStripper) match(name string) bool {
+	if h.names[http.CanonicalHeaderKey(name)] {
+		return true
+	}
+	lower := strings.ToLower(name)
+	for _, prefix := range h.prefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripHeaders は一致するリクエストヘッダーを削除してから next を呼び出します。
+func (s *Server) stripHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if removed := s.headerStripper.strip(r.Header); len(removed) > 0 {
+			s.logger.Debug("Stripped request headers", "headers", removed)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func TestNewHeaderStripper(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		wantErr  bool
+	}{
+		{name: "ヘッダー名_成功", patterns: []string{"X-User-Id"}},
+		{name: "末尾のワイルドカード_成功", patterns: []string{"X-Internal-*"}},
+		{name: "ワイルドカードのみ_エラー", patterns: []string{"*"}, wantErr: true},
+		{name: "途中のワイルドカード_エラー", patterns: []string{"X-*-Id"}, wantErr: true},
+		{name: "空文字列_エラー", patterns: []string{" "}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newHeaderStripper(tt.patterns)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newHeaderStripper() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHeaderStripper_Strip(t *testing.T) {
+	h, err := newHeaderStripper([]string{"x-internal-*", "x-user-id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{
+		"X-Internal-Role":       {"admin"},
+		"X-Internal-Tenant":     {"acme"},
+		"X-User-Id":             {"alice"},
+		"X-User-Name":           {"Alice"},
+		"Authorization":         {"Bearer token"},
+		"X-Tumiki-Forwarded-By": {"http://replica-1"},
+	}
+
+	removed := h.strip(header)
+	slices.Sort(removed)
+	if want := []string{"X-Internal-Role", "X-Internal-Tenant", "X-User-Id"}; !slices.Equal(removed, want) {
+		t.Errorf("strip() = %v, want %v", removed, want)
+	}
+	for _, name := range []string{"X-User-Name", "Authorization", "X-Tumiki-Forwarded-By"} {
+		if header.Get(name) == "" {
+			t.Errorf("%s should be kept", name)
+		}
+	}
+}
+
+func TestHandleMCP_StripHeaders(t *testing.T) {
+	script := `read line; echo "{\"jsonrpc\":\"2.0\",\"id\":1,\"result\":{\"role\":\"$ROLE\",\"region\":\"$REGION\"}}"`
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", script},
+		HeaderEnvMapping: map[string]string{"X-Internal-Role": "ROLE", "X-Region": "REGION"},
+		StripHeaders:     []string{"X-Internal-*"},
+	}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	// クライアントが送った内部ヘッダーはマッピングより前に削除する
+	w := postMCP(server, `{"jsonrpc":"2.0","id":1,"method":"ping"}`, http.Header{
+		"X-Internal-Role": {"admin"},
+		"X-Region":        {"eu"},
+	})
+	if got := w.Body.String(); !strings.Contains(got, `"role":"","region":"eu"`) {
+		t.Errorf("response = %s, want the spoofed role stripped", got)
+	}
+}
+
+func TestNewServer_InvalidStripHeaders(t *testing.T) {
+	if _, err := NewServer(&Config{Command: "cat", StripHeaders: []string{"*"}}, slog.Default()); err == nil {
+		t.Error("NewServer() with an invalid strip pattern expected error but got none")
+	}
+}
+
+func TestMetadataHeader_StripHeaders(t *testing.T) {
+	server, err := NewServer(&Config{Command: "cat", StripHeaders: []string{"X-Internal-*"}}, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-internal-role", "admin", "x-region", "eu"))
+	header := server.metadataHeader(ctx)
+	if header.Get("X-Internal-Role") != "" || header.Get("X-Region") != "eu" {
+		t.Errorf("metadataHeader() = %v, want X-Internal-Role stripped and X-Region kept", header)
+	}
+}
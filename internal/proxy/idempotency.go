@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// Idempotency-Key による重複排除で使うヘッダーです。
+const (
+	headerIdempotencyKey     = "Idempotency-Key"
+	headerIdempotentReplayed = "Idempotent-Replayed" // 既存の実行のレスポンスを返した場合に "true"
+)
+
+// DefaultIdempotencyTTL は完了した実行のレスポンスを再送に返す期間のデフォルトです。
+const DefaultIdempotencyTTL = 10 * time.Minute
+
+// maxIdempotencyKeyBytes は Idempotency-Key の最大バイト数です。
+const maxIdempotencyKeyBytes = 256
+
+var (
+	// errIdempotencyMismatch は同じ Idempotency-Key が異なるリクエストに使われたことを表します。
+	errIdempotencyMismatch = errors.New("idempotency key was already used for a different request")
+	// errIdempotencyKeyTooLong は Idempotency-Key が長すぎることを表します。
+	errIdempotencyKeyTooLong = errors.New("idempotency key is too long")
+)
+
+// idempotentCall は1つの Idempotency-Key の実行です。
+type idempotentCall struct {
+	fingerprint string
+	done        chan struct{}
+	response    []byte
+	err         error
+	expires     time.Time // 完了後に設定する
+}
+
+// idempotency は Idempotency-Key ごとの実行を保持し、同時のリクエストや再送で実行を共有します。
+type idempotency struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	calls map[string]*idempotentCall
+}
+
+func newIdempotency(ttl time.Duration) *idempotency {
+	if ttl == 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	return &idempotency{ttl: ttl, now: time.Now, calls: make(map[string]*idempotentCall)}
+}
+
+// do は key の実行がなければ execute を実行し、あればその完了を待ってレスポンスを共有します。
+// 同じキーで異なるリクエストを送った場合は errIdempotencyMismatch を返します。
+// 失敗した実行は保持しないため、失敗後の再送は改めて実行します。replayed は既存の実行を共有したかどうかです。
+func (i *idempotency) do(ctx context.Context, key, fingerprint string, execute func() ([]byte, error)) (response []byte, replayed bool, err error) {
+	i.mu.Lock()
+	i.evictExpiredLocked()
+	call, ok := i.calls[key]
+	if ok {
+		i.mu.Unlock()
+		if call.fingerprint != fingerprint {
+			return nil, false, errIdempotencyMismatch
+		}
+		select {
+		case <-call.done:
+			return call.response, true, call.err
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+	call = &idempotentCall{fingerprint: fingerprint, done: make(chan struct{})}
+	i.calls[key] = call
+	i.mu.Unlock()
+
+	call.response, call.err = execute()
+
+	i.mu.Lock()
+	if call.err != nil {
+		delete(i.calls, key)
+	} else {
+		call.expires = i.now().Add(i.ttl)
+	}
+	i.mu.Unlock()
+	close(call.done)
+	return call.response, false, call.err
+}
+
+func (i *idempotency) evictExpiredLocked() {
+	now := i.now()
+	for key, call := range i.calls {
+		if !call.expires.IsZero() && !now.Before(call.expires) {
+			delete(i.calls, key)
+		}
+	}
+}
+
+// executeIdempotent はリクエストに Idempotency-Key がある場合、同じキーの実行とレスポンスを共有して実行します。
+// キーは API キーとヘッダーから決まる環境変数・引数ごとに区別し、JSON-RPC の ID が異なる再送にも一致します。
+// 実行はクライアントの切断で中断しないよう、リクエストのキャンセルから切り離して ProcessTimeout まで行います。
+func (s *Server) executeIdempotent(ctx context.Context, header http.Header, body []byte) ([]byte, bool, error) {
+	key := header.Get(headerIdempotencyKey)
+	if s.idempotency == nil || key == "" {
+		response, err := s.execute(ctx, header, body)
+		return response, false, err
+	}
+	if len(key) > maxIdempotencyKeyBytes {
+		return nil, false, errIdempotencyKeyTooLong
+	}
+
+	backend, env, args := s.processConfig(header)
+	scope := backend.Version + "\x00" + processFingerprint(backend.identity(), env, args)
+	if s.cfg.APIKeys != nil {
+		scope += "\x00" + header.Get(headerAPIKeyID)
+	}
+
+	var id []byte
+	fingerprint := sha256.New()
+	if msg, err := jsonrpc.Parse(body); err == nil && msg.Method != "" {
+		id = msg.ID
+		fingerprint.Write([]byte(msg.Method + "\x00"))
+		fingerprint.Write(msg.Params)
+	} else {
+		fingerprint.Write(body)
+	}
+
+	response, replayed, err := s.idempotency.do(ctx, scope+"\x00"+key, hex.EncodeToString(fingerprint.Sum(nil)), func() ([]byte, error) {
+		execCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ProcessTimeout)
+		defer cancel()
+		return s.execute(execCtx, header, body)
+	})
+	if err != nil || !replayed || len(id) == 0 {
+		return response, replayed, err
+	}
+	// 再送で JSON-RPC の ID が変わっていてもリクエストの ID で返す
+	if response, err = jsonrpc.WithID(response, id); err != nil {
+		return nil, false, err
+	}
+	return response, true, nil
+}
+
+// writeExecuteError は executeIdempotent のエラーを HTTP レスポンスとして返します。
+func writeExecuteError(w http.ResponseWriter, logger *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, errIdempotencyMismatch):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, errIdempotencyKeyTooLong):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, process.ErrWorkspaceQuota):
+		logger.Warn("Process exceeded the workspace quota", "error", err)
+		http.Error(w, "Workspace quota exceeded", http.StatusInsufficientStorage)
+	default:
+		logger.Error("Process execution failed", "error", err)
+		http.Error(w, "Process execution failed", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotency_ConcurrentCallsShareExecution(t *testing.T) {
+	i := newIdempotency(0)
+	var executions atomic.Int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	results := make([]string, 3)
+	for n := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, _, err := i.do(context.Background(), "key", "fp", func() ([]byte, error) {
+				executions.Add(1)
+				<-release
+				return []byte("done"), nil
+			})
+			if err != nil {
+				t.Errorf("do() error = %v", err)
+			}
+			results[n] = string(response)
+		}()
+	}
+	// 全てのゴルーチンが実行を待つまで解放しない
+	for {
+		i.mu.Lock()
+		_, started := i.calls["key"]
+		i.mu.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := executions.Load(); got != 1 {
+		t.Errorf("executions = %d, want 1", got)
+	}
+	for _, r := range results {
+		if r != "done" {
+			t.Errorf("response = %q, want %q", r, "done")
+		}
+	}
+}
+
+func TestIdempotency_FailureAndExpiry(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	i := newIdempotency(time.Minute)
+	i.now = func() time.Time { return now }
+	executions := 0
+	execute := func(err error) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			executions++
+			return []byte("ok"), err
+		}
+	}
+
+	// 失敗した実行は保持しない
+	if _, _, err := i.do(context.Background(), "key", "fp", execute(errors.New("boom"))); err == nil {
+		t.Fatal("do() expected error")
+	}
+	if _, replayed, _ := i.do(context.Background(), "key", "fp", execute(nil)); replayed || executions != 2 {
+		t.Errorf("retry after failure replayed = %v, executions = %d; want a new execution", replayed, executions)
+	}
+	if _, replayed, _ := i.do(context.Background(), "key", "fp", execute(nil)); !replayed || executions != 2 {
+		t.Errorf("retry after success replayed = %v, executions = %d; want a replay", replayed, executions)
+	}
+	if _, _, err := i.do(context.Background(), "key", "other", execute(nil)); !errors.Is(err, errIdempotencyMismatch) {
+		t.Errorf("different request error = %v, want %v", err, errIdempotencyMismatch)
+	}
+
+	now = now.Add(time.Minute)
+	if _, replayed, _ := i.do(context.Background(), "key", "fp", execute(nil)); replayed || executions != 3 {
+		t.Errorf("retry after expiry replayed = %v, executions = %d; want a new execution", replayed, executions)
+	}
+}
+
+func TestHandler_IdempotencyKey(t *testing.T) {
+	server, counter := newCacheServer(t, nil)
+
+	steps := []struct {
+		name         string
+		body         string
+		key          string
+		wantStatus   int
+		wantReplayed string
+		wantRuns     int
+		wantBody     string
+	}{
+		{name: "初回_プロセスを実行", body: `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"send"}}`, key: "k1", wantStatus: http.StatusOK, wantRuns: 1},
+		{name: "IDの異なる再送_実行せずIDを置き換えて返す", body: `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"send"}}`, key: "k1", wantStatus: http.StatusOK, wantReplayed: "true", wantRuns: 1, wantBody: `{"id":2,"jsonrpc":"2.0","result":{"tenant":""}}`},
+		{name: "同じキーで異なるリクエスト_422", body: `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"delete"}}`, key: "k1", wantStatus: http.StatusUnprocessableEntity, wantRuns: 1},
+		{name: "キーなし_毎回実行", body: `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"send"}}`, wantStatus: http.StatusOK, wantRuns: 2},
+		{name: "長すぎるキー_400", body: `{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"send"}}`, key: strings.Repeat("k", maxIdempotencyKeyBytes+1), wantStatus: http.StatusBadRequest, wantRuns: 2},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/mcp", strings.NewReader(step.body))
+			req.Header.Set("Content-Type", "application/json")
+			if step.key != "" {
+				req.Header.Set(headerIdempotencyKey, step.key)
+			}
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+			if w.Code != step.wantStatus {
+				t.Fatalf("Status = %d, want %d (body: %s)", w.Code, step.wantStatus, w.Body.String())
+			}
+			if got := w.Header().Get(headerIdempotentReplayed); got != step.wantReplayed {
+				t.Errorf("%s = %q, want %q", headerIdempotentReplayed, got, step.wantReplayed)
+			}
+			if got := runs(t, counter); got != step.wantRuns {
+				t.Errorf("process runs = %d, want %d", got, step.wantRuns)
+			}
+			if step.wantBody != "" && strings.TrimSpace(w.Body.String()) != step.wantBody {
+				t.Errorf("body = %s, want %s", w.Body.String(), step.wantBody)
+			}
+		})
+	}
+}
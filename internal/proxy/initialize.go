@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// DefaultInitializeTimeout はセッションのプロセスの起動から initialize のレスポンスまでを待つデフォルトの最大時間です。
+const DefaultInitializeTimeout = ProcessTimeout
+
+// initializeError はセッションのプロセスの起動か initialize に失敗したことを、失敗を調べるための診断情報とともに表します。
+type initializeError struct {
+	err         error
+	timeout     time.Duration
+	diagnostics process.Diagnostics
+}
+
+func (e *initializeError) Error() string {
+	if e.timedOut() {
+		return fmt.Sprintf("process did not respond to initialize within %s", e.timeout)
+	}
+	return fmt.Sprintf("initialize session process: %v", e.err)
+}
+
+func (e *initializeError) Unwrap() error {
+	return e.err
+}
+
+func (e *initializeError) timedOut() bool {
+	return errors.Is(e.err, context.DeadlineExceeded)
+}
+
+// diagnosticsExitWait は initialize の失敗の直後に、終了しかけているプロセスの終了を待つ最大時間です。
+// stdin への書き込みの失敗はプロセスの終了と同時に起きるため、stderr と終了の原因が揃うのを待ちます。
+const diagnosticsExitWait = 500 * time.Millisecond
+
+// initializeErrorData は initialize に失敗した場合に、JSON-RPC のエラーの data で返す情報です。
+// コマンドライン・stderr・終了の原因には秘密の値が含まれることがあるため、診断情報はログにだけ出力し、
+// クライアントにはログと照合するための ID を返します。
+type initializeErrorData struct {
+	CorrelationID string `json:"correlationId"` // 診断情報のログの correlation_id
+	TimedOut      bool   `json:"timedOut"`      // 時間内に initialize のレスポンスがなかった
+}
+
+// newCorrelationID はログとエラーのレスポンスを照合するための ID を返します。
+func newCorrelationID() string {
+	buf := make([]byte, 8)
+	// crypto/rand の Read は失敗しない
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// initializeTimeout はセッションのプロセスの initialize を待つ最大時間を返します。
+func (s *Server) initializeTimeout() time.Duration {
+	if s.cfg.InitializeTimeout > 0 {
+		return s.cfg.InitializeTimeout
+	}
+	return DefaultInitializeTimeout
+}
+
+// sessionDiagnostics は initialize に失敗したセッションのプロセスの診断情報を返します。
+// 時間切れ以外の失敗ではプロセスが終了しかけていることが多いため、diagnosticsExitWait まで終了を待ちます。
+func sessionDiagnostics(session *process.Session, err error) process.Diagnostics {
+	if !errors.Is(err, context.DeadlineExceeded) {
+		select {
+		case <-session.Exited():
+		case <-time.After(diagnosticsExitWait):
+		}
+	}
+	return session.Diagnostics()
+}
+
+// newInitializeError は err をセッションの診断情報とともに initializeError にします。
+func (s *Server) newInitializeError(err error, diagnostics process.Diagnostics) error {
+	return &initializeError{err: err, timeout: s.initializeTimeout(), diagnostics: diagnostics}
+}
+
+// initializeFailed はセッションのプロセスの起動か initialize に失敗したことを診断情報とともにログに出力し、
+// リクエストにはログの ID を data に含めた JSON-RPC のエラーを返します。リクエストが ID を持たない場合は 500 を返します。
+func (p *subscriptions) initializeFailed(w http.ResponseWriter, body []byte, responseType string, err error) {
+	var initErr *initializeError
+	if !errors.As(err, &initErr) {
+		p.server.logger.Error("Process start failed", "error", err)
+		http.Error(w, "Process start failed", http.StatusInternalServerError)
+		return
+	}
+
+	d := initErr.diagnostics
+	data := initializeErrorData{CorrelationID: newCorrelationID(), TimedOut: initErr.timedOut()}
+	var startedAt string
+	if !d.StartedAt.IsZero() {
+		startedAt = d.StartedAt.UTC().Format(time.RFC3339Nano)
+	}
+	p.server.logger.Error("Session initialize failed",
+		"correlation_id", data.CorrelationID,
+		"error", initErr,
+		"command", d.Command,
+		"started_at", startedAt,
+		"elapsed", d.Elapsed,
+		"timed_out", data.TimedOut,
+		"stdout_bytes", d.StdoutBytes,
+		"stderr_tail", d.StderrTail,
+		"env_keys", d.EnvKeys,
+		"exited", d.Exited,
+		"exit_error", d.ExitError)
+
+	msg, err := jsonrpc.Parse(body)
+	if err != nil || !msg.IsRequest() {
+		http.Error(w, "Session initialize failed", http.StatusInternalServerError)
+		return
+	}
+	encoded, _ := json.Marshal(data)
+	response := jsonrpc.NewErrorResponseWithData(msg.ID, jsonrpc.CodeInternalError, "Session initialize failed", encoded)
+	w.Header().Del(headerSessionID)
+	if err := writeMessage(w, responseType, response); err != nil {
+		p.server.logger.Debug("Failed to write response", "error", err)
+	}
+}
@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+)
+
+// syncBuffer はプロセスの goroutine からのログと同時に読み取れるバッファです。
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSessions_InitializeDiagnostics(t *testing.T) {
+	const initialize = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`
+
+	tests := []struct {
+		name         string
+		command      string
+		args         []string
+		wantTimedOut bool
+		wantExited   bool
+		wantStderr   string
+		wantStdout   int64
+	}{
+		{
+			name:       "起動直後に終了_stderrの末尾を返す",
+			command:    "sh",
+			args:       []string{"-c", `echo 'Usage: server --root <dir>' >&2; exit 2`},
+			wantExited: true,
+			wantStderr: "Usage: server --root <dir>",
+		},
+		{
+			name:         "応答しない_時間切れ",
+			command:      "sh",
+			args:         []string{"-c", `echo 'loading' >&2; printf 'banner\n'; cat >/dev/null`},
+			wantTimedOut: true,
+			wantStderr:   "loading",
+			wantStdout:   7,
+		},
+		{
+			name:    "存在しないコマンド_起動できない",
+			command: "nonexistent-command-12345",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs syncBuffer
+			server, err := NewServer(&Config{
+				Command:           tt.command,
+				Args:              tt.args,
+				DefaultEnv:        map[string]string{"API_TOKEN": "secret-value"},
+				Sessions:          true,
+				InitializeTimeout: 300 * time.Millisecond,
+			}, slog.New(slog.NewJSONHandler(&logs, nil)))
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+			defer server.subscriptions.close()
+
+			w := postMCP(server, initialize, nil)
+			if w.Code != http.StatusOK || w.Header().Get(headerSessionID) != "" {
+				t.Fatalf("initialize = %d (session %q), want 200 without a session", w.Code, w.Header().Get(headerSessionID))
+			}
+			msg, err := jsonrpc.Parse(w.Body.Bytes())
+			if err != nil || msg.Error == nil {
+				t.Fatalf("response = %s, want a JSON-RPC error", w.Body.String())
+			}
+			// コマンドライン・stderr・環境変数はクライアントに返さない
+			for _, leaked := range []string{"secret-value", tt.command, "API_TOKEN", "exit status"} {
+				if strings.Contains(w.Body.String(), leaked) {
+					t.Errorf("response must not contain %q: %s", leaked, w.Body.String())
+				}
+			}
+			if tt.wantStderr != "" && strings.Contains(w.Body.String(), tt.wantStderr) {
+				t.Errorf("response must not contain stderr: %s", w.Body.String())
+			}
+
+			var data initializeErrorData
+			if err := json.Unmarshal(msg.Error.Data, &data); err != nil {
+				t.Fatal(err)
+			}
+			if data.CorrelationID == "" || data.TimedOut != tt.wantTimedOut {
+				t.Errorf("data = %+v, want a correlation ID and timedOut %v", data, tt.wantTimedOut)
+			}
+
+			// 診断情報は同じ ID でログに出力する
+			var entry struct {
+				CorrelationID string   `json:"correlation_id"`
+				Command       string   `json:"command"`
+				TimedOut      bool     `json:"timed_out"`
+				StdoutBytes   int64    `json:"stdout_bytes"`
+				StderrTail    []string `json:"stderr_tail"`
+				EnvKeys       []string `json:"env_keys"`
+				Exited        bool     `json:"exited"`
+			}
+			for line := range strings.Lines(logs.String()) {
+				if strings.Contains(line, `"msg":"Session initialize failed"`) {
+					if err := json.Unmarshal([]byte(line), &entry); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if entry.CorrelationID != data.CorrelationID || entry.Command != tt.command || !slices.Contains(entry.EnvKeys, "API_TOKEN") {
+				t.Errorf("log = %+v, want the correlation ID %q, the command and env keys", entry, data.CorrelationID)
+			}
+			if entry.TimedOut != tt.wantTimedOut || entry.Exited != tt.wantExited || entry.StdoutBytes != tt.wantStdout {
+				t.Errorf("log = %+v, want timedOut %v, exited %v, stdoutBytes %d", entry, tt.wantTimedOut, tt.wantExited, tt.wantStdout)
+			}
+			if tt.wantStderr != "" && !slices.Contains(entry.StderrTail, tt.wantStderr) {
+				t.Errorf("log stderr_tail = %q, want %q", entry.StderrTail, tt.wantStderr)
+			}
+			if n := sessionCount(server.subscriptions); n != 0 {
+				t.Errorf("sessions = %d, want 0", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// DefaultKeepAliveMethod はバックエンドに送るキープアライブのデフォルトのメソッドです。
+const DefaultKeepAliveMethod = "ping"
+
+// keepAliveIDPrefix はキープアライブのリクエスト ID のプレフィックスです。
+// この ID へのレスポンスはクライアントに返しません。
+const keepAliveIDPrefix = "tumiki-keepalive-"
+
+// sseKeepAlive は SSE のストリームに書き込むキープアライブのコメントです。
+const sseKeepAlive = ": keep-alive\n\n"
+
+// keepAliveSeq はキープアライブのリクエスト ID の連番です。
+var keepAliveSeq atomic.Uint64
+
+// keepAlive は永続的なセッションのプロセスが終了するまで、一定間隔でキープアライブのメッセージを送ります。
+// "notifications/" で始まるメソッドは通知として、それ以外はリクエストとして送ります。
+// stdin が閉じられるなどで送信に失敗した時点で終了します。
+func (s *Server) keepAlive(session *process.Session) {
+	if s.cfg.KeepAliveInterval <= 0 {
+		return
+	}
+	method := s.cfg.KeepAliveMethod
+	if method == "" {
+		method = DefaultKeepAliveMethod
+	}
+
+	ticker := time.NewTicker(s.cfg.KeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-session.Exited():
+			return
+		case <-ticker.C:
+		}
+
+		var msg []byte
+		var err error
+		if strings.HasPrefix(method, "notifications/") {
+			msg, err = jsonrpc.NewNotification(method, nil)
+		} else {
+			msg, err = jsonrpc.NewRequest(fmt.Sprintf("%s%d", keepAliveIDPrefix, keepAliveSeq.Add(1)), method, nil)
+		}
+		if err == nil {
+			err = session.Send(msg)
+		}
+		if err != nil {
+			s.logger.Debug("Keep-alive stopped", "error", err)
+			return
+		}
+	}
+}
+
+// isKeepAliveResponse はキープアライブのリクエストに対するレスポンスかどうかを返します。
+func (s *Server) isKeepAliveResponse(msg []byte) bool {
+	if s.cfg.KeepAliveInterval <= 0 {
+		return false
+	}
+	parsed, err := jsonrpc.Parse(msg)
+	if err != nil || !parsed.IsResponse() {
+		return false
+	}
+	var id string
+	return json.Unmarshal(parsed.ID, &id) == nil && strings.HasPrefix(id, keepAliveIDPrefix)
+}
+
+// writeSSEKeepAlive は SSE のキープアライブのコメントを書き込みます。
+func writeSSEKeepAlive(w io.Writer) error {
+	_, err := io.WriteString(w, sseKeepAlive)
+	return err
+}
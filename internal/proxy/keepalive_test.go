@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+)
+
+func TestHandleMCP_SSEKeepAlive(t *testing.T) {
+	server, err := NewServer(&Config{
+		Command:           "sh",
+		Args:              []string{"-c", `read line; sleep 0.3; echo '{"jsonrpc":"2.0","id":1,"result":{}}'`},
+		DefaultEnv:        map[string]string{},
+		KeepAliveInterval: 50 * time.Millisecond,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/call"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	w := httptest.NewRecorder()
+	server.handleMCP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d (body: %s)", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	keepAlive := strings.Index(body, sseKeepAlive)
+	event := strings.Index(body, "event: message")
+	if keepAlive < 0 || event < keepAlive {
+		t.Errorf("body = %q, want keep-alive comments before the response event", body)
+	}
+}
+
+func TestKeepAlive_SendsPingToSession(t *testing.T) {
+	server, err := NewServer(&Config{Command: "cat", KeepAliveInterval: 10 * time.Millisecond}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := server.newExecutor(http.Header{}).Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	go server.keepAlive(session)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// cat はキープアライブのリクエストをそのまま出力する
+	msg, err := session.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	parsed, err := jsonrpc.Parse(msg)
+	if err != nil || parsed.Method != DefaultKeepAliveMethod || !strings.HasPrefix(string(parsed.ID), `"`+keepAliveIDPrefix) {
+		t.Errorf("keep-alive message = %s, want a ping request with a keep-alive ID", msg)
+	}
+}
+
+func TestIsKeepAliveResponse(t *testing.T) {
+	server := &Server{cfg: &Config{KeepAliveInterval: time.Second}}
+	disabled := &Server{cfg: &Config{}}
+
+	tests := []struct {
+		name   string
+		server *Server
+		msg    string
+		want   bool
+	}{
+		{name: "キープアライブのレスポンス_true", server: server, msg: `{"jsonrpc":"2.0","id":"tumiki-keepalive-3","result":{}}`, want: true},
+		{name: "キープアライブのエラーレスポンス_true", server: server, msg: `{"jsonrpc":"2.0","id":"tumiki-keepalive-3","error":{"code":-32601,"message":"x"}}`, want: true},
+		{name: "通常のレスポンス_false", server: server, msg: `{"jsonrpc":"2.0","id":3,"result":{}}`, want: false},
+		{name: "同じIDのリクエスト_false", server: server, msg: `{"jsonrpc":"2.0","id":"tumiki-keepalive-3","method":"ping"}`, want: false},
+		{name: "キープアライブが無効_false", server: disabled, msg: `{"jsonrpc":"2.0","id":"tumiki-keepalive-3","result":{}}`, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.server.isKeepAliveResponse([]byte(tt.msg)); got != tt.want {
+				t.Errorf("isKeepAliveResponse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/metrics"
+)
+
+// headerLabels はリクエストの利用量をプロジェクトなどに按分するためのラベルを指定するヘッダーです（例: "project=search,team=infra"）。
+const headerLabels = "X-Mcp-Labels"
+
+// maxLabelSeries はラベル付きのメトリクスでラベルにする値の組み合わせの最大数です。超えた分は methodOther にまとめます。
+const maxLabelSeries = 1024
+
+var (
+	// labelKeyPattern はラベルのキーとして受け付ける名前です。メトリクスのラベル名に使えるよう英小文字・数字・_ に限ります。
+	labelKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+	// labelValuePattern はラベルの値として受け付ける文字列です。
+	labelValuePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:/@-]{0,127}$`)
+)
+
+// validateRequestLabelKeys は RequestLabels に指定したラベルのキーを検証します。
+func validateRequestLabelKeys(keys []string) error {
+	for i, key := range keys {
+		if !labelKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid request label key %q: use lowercase letters, digits and _", key)
+		}
+		if slices.Contains(keys[:i], key) {
+			return fmt.Errorf("duplicate request label key %q", key)
+		}
+	}
+	return nil
+}
+
+// requestLabels は X-Mcp-Labels のラベルです。値は requestLabeler のキーの順で、指定されていないキーは空文字列です。
+type requestLabels []string
+
+// requestLabeler は X-Mcp-Labels を検証し、ラベル付きのメトリクスに記録します。
+// ラベルのキーは設定したものだけを受け付け、メトリクスのシリーズの数を抑えます。
+type requestLabeler struct {
+	keys     []string // 受け付けるラベルのキー（ソート済み）
+	requests *metrics.Counter
+	duration *metrics.Counter
+
+	mu     sync.Mutex
+	series map[string]bool // ラベルにした値の組み合わせ
+}
+
+// newRequestLabeler は keys のラベルを受け付ける requestLabeler を作成します。keys が空の場合は nil を返します。
+func newRequestLabeler(m *metrics.Registry, keys []string) *requestLabeler {
+	if len(keys) == 0 {
+		return nil
+	}
+	keys = slices.Sorted(slices.Values(keys))
+	names := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		// result などの既存のラベルと衝突しないよう接頭辞を付ける
+		names = append(names, "label_"+key)
+	}
+	return &requestLabeler{
+		keys:     keys,
+		requests: m.Counter("tumiki_labeled_requests_total", "Number of MCP requests by X-Mcp-Labels and result.", append(names, "result")...),
+		duration: m.Counter("tumiki_labeled_request_duration_seconds_total", "Total time spent handling MCP requests by X-Mcp-Labels.", names...),
+		series:   make(map[string]bool),
+	}
+}
+
+// parse は X-Mcp-Labels の値（カンマ区切りの key=value）を検証してラベルを返します。
+// 設定していないキー、重複したキー、形式が正しくない値はエラーです。ヘッダーがない場合は nil を返します。
+func (l *requestLabeler) parse(header http.Header) (requestLabels, error) {
+	value := strings.Join(header.Values(headerLabels), ",")
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	labels := make(requestLabels, len(l.keys))
+	for pair := range strings.SplitSeq(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(pair, "=")
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q: use key=value", pair)
+		}
+		i := slices.Index(l.keys, key)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown label %q: accepted labels are %s", key, strings.Join(l.keys, ", "))
+		}
+		if labels[i] != "" {
+			return nil, fmt.Errorf("duplicate label %q", key)
+		}
+		if !labelValuePattern.MatchString(val) {
+			return nil, fmt.Errorf("invalid value for label %q", key)
+		}
+		labels[i] = val
+	}
+	return labels, nil
+}
+
+// fromHeader は X-Mcp-Labels のラベルを返します。ラベルを受け付けない場合と、ラベルが正しくない場合は nil を返します。
+func (l *requestLabeler) fromHeader(header http.Header) requestLabels {
+	if l == nil {
+		return nil
+	}
+	labels, _ := l.parse(header)
+	return labels
+}
+
+// format はラベルを "key=value,key=value" の形式（キーの順）で返します。利用量の集計の単位に使います。
+func (l *requestLabeler) format(labels requestLabels) string {
+	var pairs []string
+	for i, value := range labels {
+		if value != "" {
+			pairs = append(pairs, l.keys[i]+"="+value)
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+// logAttr はアクセスログに出力するラベルの属性を返します。
+func (l *requestLabeler) logAttr(labels requestLabels) slog.Attr {
+	var attrs []any
+	for i, value := range labels {
+		if value != "" {
+			attrs = append(attrs, slog.String(l.keys[i], value))
+		}
+	}
+	return slog.Group("labels", attrs...)
+}
+
+// record はラベル付きのメトリクスにリクエストを記録します。
+// クライアントが任意の値を送れるため、maxLabelSeries を超えた新しい組み合わせは全ての値を methodOther にします。
+func (l *requestLabeler) record(labels requestLabels, result string, seconds float64) {
+	values := make([]string, len(l.keys), len(l.keys)+1)
+	copy(values, labels)
+	series := strings.Join(values, "\x00")
+	l.mu.Lock()
+	if !l.series[series] {
+		if len(l.series) >= maxLabelSeries {
+			for i := range values {
+				values[i] = methodOther
+			}
+		} else {
+			l.series[series] = true
+		}
+	}
+	l.mu.Unlock()
+	l.duration.Add(seconds, values...)
+	l.requests.Inc(append(values, result)...)
+}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/metrics"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/usage"
+)
+
+func TestRequestLabeler_parse(t *testing.T) {
+	labeler := newRequestLabeler(metrics.NewRegistry(), []string{"team", "project"})
+	tests := []struct {
+		name    string
+		values  []string
+		want    string
+		wantErr string
+	}{
+		{name: "ヘッダーなし_ラベルなし"},
+		{name: "キーの順に並べる", values: []string{"team=infra, project=docs"}, want: "project=docs,team=infra"},
+		{name: "複数のヘッダー_まとめる", values: []string{"project=docs", "team=infra"}, want: "project=docs,team=infra"},
+		{name: "一部のキーのみ", values: []string{"project=search-v2"}, want: "project=search-v2"},
+		{name: "設定していないキー_エラー", values: []string{"cost_center=1"}, wantErr: "unknown label"},
+		{name: "重複したキー_エラー", values: []string{"project=a,project=b"}, wantErr: "duplicate label"},
+		{name: "イコールがない_エラー", values: []string{"project"}, wantErr: "use key=value"},
+		{name: "空の値_エラー", values: []string{"project="}, wantErr: "invalid value"},
+		{name: "使えない文字を含む値_エラー", values: []string{`project=a"b`}, wantErr: "invalid value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for _, v := range tt.values {
+				header.Add(headerLabels, v)
+			}
+			labels, err := labeler.parse(header)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse() error = %v", err)
+			}
+			if got := labeler.format(labels); got != tt.want {
+				t.Errorf("parse() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRequestLabelKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []string
+		wantErr bool
+	}{
+		{name: "英小文字と数字と_成功", keys: []string{"project", "cost_center2"}},
+		{name: "大文字_エラー", keys: []string{"Project"}, wantErr: true},
+		{name: "ハイフン_エラー", keys: []string{"cost-center"}, wantErr: true},
+		{name: "重複_エラー", keys: []string{"project", "project"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRequestLabelKeys(tt.keys); (err != nil) != tt.wantErr {
+				t.Errorf("validateRequestLabelKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequestLabeler_record_シリーズの上限(t *testing.T) {
+	registry := metrics.NewRegistry()
+	labeler := newRequestLabeler(registry, []string{"project"})
+	for i := range maxLabelSeries + 1 {
+		labeler.record(requestLabels{strings.Repeat("p", i%100+1) + string(rune('a'+i/100))}, resultOK, 0)
+	}
+	var buf bytes.Buffer
+	if err := registry.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// 上限を超えた新しい組み合わせは other にまとめる
+	if want := `tumiki_labeled_requests_total{label_project="other",result="ok"} 1`; !strings.Contains(buf.String(), want) {
+		t.Errorf("metrics should contain %s", want)
+	}
+}
+
+func TestHandleMCP_RequestLabels(t *testing.T) {
+	var logs bytes.Buffer
+	server, err := NewServer(&Config{
+		Command:       "sh",
+		Args:          []string{"-c", `read line; echo '{"jsonrpc":"2.0","id":1,"result":{}}'`},
+		Metrics:       true,
+		AccessLog:     true,
+		Usage:         true,
+		RequestLabels: []string{"project", "team"},
+	}, slog.New(slog.NewJSONHandler(&logs, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	post := func(labels string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if labels != "" {
+			req.Header.Set(headerLabels, labels)
+		}
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		return w
+	}
+	for range 2 {
+		if w := post("project=docs"); w.Code != http.StatusOK {
+			t.Fatalf("Status = %d (body: %s)", w.Code, w.Body.String())
+		}
+	}
+	if w := post(""); w.Code != http.StatusOK {
+		t.Fatalf("Status without labels = %d", w.Code)
+	}
+	// 受け付けないラベルはプロセスを起動せずに拒否する
+	if w := post("tenant=acme"); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unknown label") {
+		t.Errorf("Status with an unknown label = %d %s, want 400", w.Code, w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`tumiki_labeled_requests_total{label_project="docs",label_team="",result="ok"} 2`,
+		`tumiki_labeled_requests_total{label_project="",label_team="",result="ok"} 1`,
+		`tumiki_labeled_requests_total{label_project="",label_team="",result="error"} 1`,
+		`tumiki_labeled_request_duration_seconds_total{label_project="docs",label_team=""}`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("metrics should contain %s:\n%s", want, w.Body.String())
+		}
+	}
+
+	if want := `"labels":{"project":"docs"}`; !strings.Contains(logs.String(), want) {
+		t.Errorf("access log should contain %s:\n%s", want, logs.String())
+	}
+
+	report := server.usage.Snapshot()
+	if !slices.ContainsFunc(report.Entries, func(e usage.Entry) bool { return e.Labels == "project=docs" && e.Calls == 2 }) {
+		t.Errorf("usage entries = %+v, want 2 calls labeled project=docs", report.Entries)
+	}
+}
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"context"
+	"time"
+)
+
+// launcherBackends はパッケージを取得するバックエンド（登録済みの全てのバージョンと名前付きのサーバー）を返します。
+func (s *Server) launcherBackends() []Backend {
+	_, _, list := s.backends.snapshot()
+	for _, server := range s.defs().servers {
+		list = append(list, *server.backend)
+	}
+	return list
+}
+
+// prefetchLaunchers は npx・uvx・bunx・deno で起動するバックエンドのパッケージを、最初のリクエストより前にキャッシュに取得します。
+// 取得はバックエンドごとに並行して行い、完了を待たずに戻ります。取得に失敗しても、リクエストの処理時にランチャーが取得し直します。
+func (s *Server) prefetchLaunchers(ctx context.Context, backends []Backend) {
+	if !s.cfg.LauncherPrefetch || s.cfg.WASI != nil {
+		return
+	}
+	for _, backend := range backends {
+		if backend.Runtime != "" {
+			continue
+		}
+		l := s.launchers.Get(backend.Command, backend.Args)
+		if l == nil {
+			continue
+		}
+		go func() {
+			start := time.Now()
+			if err := l.PrefetchPackage(ctx); err != nil {
+				s.logger.Warn("Failed to prefetch launcher package", "version", backend.Version, "launcher", l.Name, "package", l.Package, "error", err)
+				return
+			}
+			s.logger.Info("Prefetched launcher package", "version", backend.Version, "launcher", l.Name, "package", l.Package, "duration", time.Since(start))
+		}()
+	}
+}
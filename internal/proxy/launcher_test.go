@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_prefetchLaunchers(t *testing.T) {
+	dir := t.TempDir()
+	record := filepath.Join(dir, "record")
+	// npx・uvx の代わりに、パッケージの取得に使う引数を記録する
+	for _, name := range []string{"npm", "uvx"} {
+		script := "#!/bin/sh\necho \"" + name + " $*\" >> " + record + "\n"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server, err := NewServer(&Config{
+		Command:          filepath.Join(dir, "npx"),
+		Args:             []string{"-y", "@scope/server"},
+		LauncherPrefetch: true,
+		Servers: map[string]ServerDefinition{
+			"fetch": {Command: filepath.Join(dir, "uvx"), Args: []string{"mcp-server-fetch"}},
+			"local": {Command: "sh", Args: []string{"-c", "cat"}},
+		},
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	server.prefetchLaunchers(context.Background(), server.launcherBackends())
+
+	want := []string{
+		"npm cache add @scope/server",
+		"uvx --from mcp-server-fetch python -c ",
+	}
+	var got []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		data, _ := os.ReadFile(record)
+		got = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		if len(got) == len(want) {
+			break
+		}
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("prefetch commands = %q, want %q", got, want)
+	}
+}
+
+func TestServer_executorOptions_Launcher(t *testing.T) {
+	server, err := NewServer(&Config{Command: "npx", Args: []string{"-y", "@scope/server"}}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	// ランチャーのバックエンドはランチャーの設定の分だけオプションが増える
+	launcher := server.executorOptions(&Backend{Version: "v1", Command: "npx", Args: []string{"-y", "@scope/server"}})
+	plain := server.executorOptions(&Backend{Version: "v1", Command: "node", Args: []string{"server.js"}})
+	if len(launcher) != len(plain)+1 {
+		t.Errorf("executorOptions() = %d options, want %d for a launcher backend", len(launcher), len(plain)+1)
+	}
+}
@@ -0,0 +1,298 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/webhook"
+)
+
+// MCP のトランスポートです。
+const (
+	TransportStreamableHTTP = "streamable-http" // POST /mcp（Streamable HTTP）
+	TransportSSE            = "sse"             // 非推奨の HTTP+SSE（GET /sse と POST /messages）
+	TransportAll            = "all"             // Streamable HTTP と HTTP+SSE の両方
+)
+
+// 非推奨の HTTP+SSE トランスポートのエンドポイントです。
+const (
+	legacySSEPath      = "/sse"
+	legacyMessagesPath = "/messages"
+)
+
+// ValidateTransport はトランスポートの名前を検証します。空文字列は TransportStreamableHTTP を表します。
+func ValidateTransport(name string) error {
+	switch name {
+	case "", TransportStreamableHTTP, TransportSSE, TransportAll:
+		return nil
+	default:
+		return fmt.Errorf("unsupported transport %q (want %s, %s or %s)", name, TransportStreamableHTTP, TransportSSE, TransportAll)
+	}
+}
+
+// servesStreamableHTTP は POST /mcp を受け付けるかを返します。
+func (s *Server) servesStreamableHTTP() bool {
+	return s.cfg.Transport != TransportSSE
+}
+
+// servesLegacySSE は GET /sse と POST /messages を受け付けるかを返します。
+func (s *Server) servesLegacySSE() bool {
+	return s.cfg.Transport == TransportSSE || s.cfg.Transport == TransportAll
+}
+
+// legacySession は GET /sse のストリームの間だけ起動し続ける1つの stdio プロセスです。
+type legacySession struct {
+	session *process.Session
+	methods *pendingMethods
+	usage   *usageMeter
+	owner   webhook.Session // セッションを作成したクライアント（sessionOwnedBy で照合する）
+}
+
+// legacySessions は非推奨の HTTP+SSE トランスポートのセッションを管理します。
+// GET /sse で起動したプロセスの出力をそのストリームに送り、POST /messages?sessionId=... のメッセージを同じプロセスに渡します。
+// セッションはストリームが切断されるかプロセスが終了するまで続きます。
+type legacySessions struct {
+	server *Server
+
+	mu       sync.Mutex
+	sessions map[string]*legacySession
+	closing  int        // close で終了させている途中のセッションの数
+	closed   *sync.Cond // closing が 0 になったことを通知する（mu を使用）
+}
+
+func newLegacySessions(server *Server) *legacySessions {
+	l := &legacySessions{server: server, sessions: make(map[string]*legacySession)}
+	l.closed = sync.NewCond(&l.mu)
+	return l
+}
+
+// create は新しいプロセスを起動してセッションとして登録し、その ID を返します。
+// プロセスの終了はストリームの終了時に remove で行うため、リクエストのコンテキストとは切り離して起動します。
+func (l *legacySessions) create(header http.Header) (string, *legacySession, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("generate session id: %w", err)
+	}
+	id := hex.EncodeToString(buf)
+
+	executor, version := l.server.newVersionedExecutor(header)
+	session, err := executor.Start(context.Background())
+	if err != nil {
+		return "", nil, err
+	}
+	go l.server.keepAlive(session)
+
+	ls := &legacySession{
+		session: session,
+		methods: &pendingMethods{},
+		usage:   l.server.newUsageMeter(header, version),
+		owner: webhook.Session{
+			AuthMethod: header.Get(headerAuthMethod),
+			Principal:  header.Get(headerPrincipal),
+			APIKeyID:   header.Get(headerAPIKeyID),
+		},
+	}
+	l.mu.Lock()
+	l.sessions[id] = ls
+	l.mu.Unlock()
+	return id, ls, nil
+}
+
+func (l *legacySessions) get(id string) (*legacySession, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ls, ok := l.sessions[id]
+	return ls, ok
+}
+
+// remove はセッションを登録解除してプロセスを終了させます。
+func (l *legacySessions) remove(id string) {
+	l.mu.Lock()
+	ls, ok := l.sessions[id]
+	delete(l.sessions, id)
+	l.mu.Unlock()
+	if ok {
+		l.closeSession(ls)
+	}
+}
+
+func (l *legacySessions) closeSession(ls *legacySession) {
+	if err := ls.session.Close(); err != nil {
+		l.server.logger.Debug("Failed to close SSE session", "error", err)
+	}
+}
+
+// close は全てのセッションのプロセスを終了させます。ストリームはプロセスの終了で閉じます。
+// 同時に実行している別の close（シャットダウンの開始時の close など）が終了させているセッションの終了も待ちます。
+func (l *legacySessions) close() {
+	l.mu.Lock()
+	sessions := l.sessions
+	l.sessions = make(map[string]*legacySession)
+	l.closing += len(sessions)
+	l.mu.Unlock()
+
+	for _, ls := range sessions {
+		go func() {
+			l.server.drain.sessionClosed(ls.session, ls.session.Close())
+			l.mu.Lock()
+			l.closing--
+			if l.closing == 0 {
+				l.closed.Broadcast()
+			}
+			l.mu.Unlock()
+		}()
+	}
+
+	l.mu.Lock()
+	for l.closing > 0 {
+		l.closed.Wait()
+	}
+	l.mu.Unlock()
+}
+
+// handleSSE は GET /sse を処理します。
+// プロセスを起動して最初に endpoint イベントで POST /messages の URL を通知し、以降はプロセスの出力を message イベントで送ります。
+// ストリームが切断されるとプロセスを終了させ、プロセスが終了するとストリームを閉じます。
+func (l *legacySessions) handleSSE(w http.ResponseWriter, r *http.Request) {
+	if accept := r.Header.Get("Accept"); accept != "" && acceptQuality(accept, contentTypeSSE) <= 0 {
+		http.Error(w, "Not Acceptable: GET /sse only returns text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+
+	header, err := l.server.requestHeaders(r.Context(), r.Header, r.URL.Path)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	id, ls, err := l.create(header)
+	if err != nil {
+		l.server.logger.Error("Process start failed", "error", err)
+		http.Error(w, "Process start failed", http.StatusInternalServerError)
+		return
+	}
+	defer l.remove(id)
+
+	// プロセスの出力を待ち続けるため、サーバーの WriteTimeout で切断されないようにする
+	controller := http.NewResponseController(w)
+	_ = controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", contentTypeSSE)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	endpoint := legacyMessagesPath + "?sessionId=" + url.QueryEscape(id)
+	if _, err := io.WriteString(w, "event: endpoint\ndata: "+endpoint+"\n\n"); err != nil {
+		return
+	}
+	_ = controller.Flush()
+
+	// Receive はキープアライブと同時に待てないため、別の goroutine で読み取る
+	ctx := r.Context()
+	messages := make(chan []byte)
+	go func() {
+		defer close(messages)
+		for {
+			msg, err := ls.session.Receive(ctx)
+			if err != nil {
+				return
+			}
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var keepAlive <-chan time.Time
+	if l.server.cfg.KeepAliveInterval > 0 {
+		ticker := time.NewTicker(l.server.cfg.KeepAliveInterval)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+
+	offloadCtx := l.server.offloadContext(ctx, r.Header)
+	for {
+		var err error
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			if l.server.isKeepAliveResponse(msg) {
+				continue
+			}
+			call := ls.methods.take(msg)
+			if msg, err = l.server.processResponse(offloadCtx, msg, call.method); err != nil {
+				l.server.logger.Error("Response processing failed", "error", err)
+				continue
+			}
+			ls.usage.response(call, msg)
+			err = writeSSEFrame(w, msg)
+		case <-keepAlive:
+			err = writeSSEKeepAlive(w)
+		case <-ctx.Done():
+			return
+		}
+		if err == nil {
+			err = controller.Flush()
+		}
+		if err != nil {
+			l.server.logger.Debug("Failed to write message", "error", err)
+			return
+		}
+	}
+}
+
+// handleMessages は POST /messages?sessionId=... を処理し、メッセージをセッションのプロセスに渡します。
+// レスポンスは GET /sse のストリームで送るため、ここでは 202 Accepted のみを返します。
+func (l *legacySessions) handleMessages(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("sessionId")
+	if id == "" {
+		http.Error(w, "sessionId query parameter is required", http.StatusBadRequest)
+		return
+	}
+	ls, ok := l.get(id)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !sessionOwnedBy(ls.owner, r.Header) {
+		http.Error(w, "Session belongs to another client", http.StatusForbidden)
+		return
+	}
+	if !isJSONContentType(r.Header.Get("Content-Type")) {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	observeBody(r.Context(), body)
+
+	body, err = l.server.prepareRequest(r.Context(), body)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	ls.methods.add(body)
+	ls.usage.request(body)
+	if err := ls.session.Send(body); err != nil {
+		l.server.logger.Error("Process write failed", "error", err)
+		l.remove(id)
+		http.Error(w, "Process write failed", http.StatusGone)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
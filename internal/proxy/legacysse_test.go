@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"bufio"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mcptest"
+)
+
+// newLegacySSEServer はフェイクサーバーを起動する transport の Server を HTTP サーバーとして起動します。
+func newLegacySSEServer(t *testing.T, transport string) (*Server, *httptest.Server) {
+	t.Helper()
+	cfg := &Config{Transport: transport}
+	cfg.Command, cfg.Args, cfg.DefaultEnv = mcptest.Command(mcptest.ModeCompliant)
+	server, err := NewServer(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	httpServer := httptest.NewServer(server.Handler())
+	t.Cleanup(func() {
+		httpServer.Close()
+		if server.legacy != nil {
+			server.legacy.close()
+		}
+	})
+	return server, httpServer
+}
+
+// openLegacySSE は GET /sse のストリームを開き、endpoint イベントで通知された POST 先の URL を返します。
+func openLegacySSE(t *testing.T, baseURL string) (*http.Response, *bufio.Reader, string) {
+	t.Helper()
+	req, err := http.NewRequest("GET", baseURL+legacySSEPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", contentTypeSSE)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != contentTypeSSE {
+		t.Fatalf("GET /sse status = %d, Content-Type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "event: endpoint\n" {
+		t.Fatalf("first event = %q, want endpoint", line)
+	}
+	endpoint := readSSEData(t, reader)
+	if !strings.HasPrefix(endpoint, legacyMessagesPath+"?sessionId=") {
+		t.Fatalf("endpoint = %q, want %s?sessionId=...", endpoint, legacyMessagesPath)
+	}
+	return resp, reader, baseURL + endpoint
+}
+
+func postLegacyMessage(t *testing.T, url, contentType, body string) int {
+	t.Helper()
+	resp, err := http.Post(url, contentType, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
+
+// readSSEResponse は id のレスポンスが届くまで SSE のストリームのメッセージを読み取ります（途中の通知は読み飛ばします）。
+func readSSEResponse(t *testing.T, reader *bufio.Reader, id string) string {
+	t.Helper()
+	for {
+		data := readSSEData(t, reader)
+		if data == "" || strings.Contains(data, `"id":`+id) {
+			return data
+		}
+	}
+}
+
+func TestLegacySSE(t *testing.T) {
+	server, httpServer := newLegacySSEServer(t, TransportAll)
+	stream, reader, endpoint := openLegacySSE(t, httpServer.URL)
+
+	// レスポンスは POST ではなくストリームで届く
+	if status := postLegacyMessage(t, endpoint, contentTypeJSON, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`); status != http.StatusAccepted {
+		t.Fatalf("POST initialize status = %d, want %d", status, http.StatusAccepted)
+	}
+	if got := readSSEResponse(t, reader, "1"); !strings.Contains(got, `"serverInfo"`) {
+		t.Errorf("initialize response = %s, want the server info", got)
+	}
+	if status := postLegacyMessage(t, endpoint, contentTypeJSON, `{"jsonrpc":"2.0","method":"notifications/initialized"}`); status != http.StatusAccepted {
+		t.Errorf("POST notification status = %d, want %d", status, http.StatusAccepted)
+	}
+
+	// 同じプロセスで処理する
+	if status := postLegacyMessage(t, endpoint, contentTypeJSON, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`); status != http.StatusAccepted {
+		t.Fatalf("POST tools/call status = %d, want %d", status, http.StatusAccepted)
+	}
+	if got := readSSEResponse(t, reader, "2"); !strings.Contains(got, `"text":"hi"`) {
+		t.Errorf("tools/call response = %s, want the echo result", got)
+	}
+
+	// Streamable HTTP も同時に受け付ける
+	if w := postMCP(server, `{"jsonrpc":"2.0","id":3,"method":"ping"}`, nil); w.Code != http.StatusOK {
+		t.Errorf("POST /mcp status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// ストリームを閉じるとセッションのプロセスを終了させる
+	_ = stream.Body.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		server.legacy.mu.Lock()
+		n := len(server.legacy.sessions)
+		server.legacy.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sessions = %d after the stream closed, want 0", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := postLegacyMessage(t, endpoint, contentTypeJSON, `{"jsonrpc":"2.0","id":4,"method":"ping"}`); status != http.StatusNotFound {
+		t.Errorf("POST after close status = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestLegacySSE_MessageErrors(t *testing.T) {
+	_, httpServer := newLegacySSEServer(t, TransportSSE)
+	_, _, endpoint := openLegacySSE(t, httpServer.URL)
+
+	tests := []struct {
+		name        string
+		url         string
+		contentType string
+		want        int
+	}{
+		{name: "sessionIdなし_400", url: httpServer.URL + legacyMessagesPath, contentType: contentTypeJSON, want: http.StatusBadRequest},
+		{name: "未知のセッション_404", url: httpServer.URL + legacyMessagesPath + "?sessionId=unknown", contentType: contentTypeJSON, want: http.StatusNotFound},
+		{name: "JSONでない_415", url: endpoint, contentType: "text/plain", want: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := postLegacyMessage(t, tt.url, tt.contentType, `{"jsonrpc":"2.0","id":1,"method":"ping"}`); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewServer_Transport(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport string
+		wantMCP   bool
+		wantSSE   bool
+		wantErr   bool
+	}{
+		{name: "デフォルト_StreamableHTTPのみ", transport: "", wantMCP: true},
+		{name: "streamable-http", transport: TransportStreamableHTTP, wantMCP: true},
+		{name: "sse_HTTP+SSEのみ", transport: TransportSSE, wantSSE: true},
+		{name: "all_両方", transport: TransportAll, wantMCP: true, wantSSE: true},
+		{name: "不明なトランスポート_エラー", transport: "websocket", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewServer(&Config{Command: "cat", Transport: tt.transport}, slog.Default())
+			if tt.wantErr {
+				if err == nil {
+					t.Error("NewServer() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+
+			if w := postMCP(server, `{"jsonrpc":"2.0","id":1,"method":"ping"}`, nil); (w.Code != http.StatusNotFound) != tt.wantMCP {
+				t.Errorf("POST /mcp status = %d, want served = %v", w.Code, tt.wantMCP)
+			}
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, httptest.NewRequest("POST", legacyMessagesPath+"?sessionId=x", strings.NewReader("{}")))
+			if (w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "Session not found")) != tt.wantSSE {
+				t.Errorf("POST /messages = %d %q, want served = %v", w.Code, w.Body.String(), tt.wantSSE)
+			}
+		})
+	}
+}
+
+func TestLegacySSE_OtherClient(t *testing.T) {
+	_, httpServer := newLegacySSEServer(t, TransportAll)
+	_, _, endpoint := openLegacySSE(t, httpServer.URL)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{name: "作成したクライアント_202", header: http.Header{}, want: http.StatusAccepted},
+		// 認証を設定していないため、API キーの ID はクライアントが送ったものを使う
+		{name: "別のキー_403", header: http.Header{headerAPIKeyID: {"key2"}}, want: http.StatusForbidden},
+		{name: "別のプリンシパル_403", header: http.Header{headerPrincipal: {"bob"}, headerAuthMethod: {AuthJWT}}, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", endpoint, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			req.Header = tt.header
+			req.Header.Set("Content-Type", contentTypeJSON)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("POST status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jwtauth"
+)
+
+// 条件付きマッピングの条件に使うリクエストの情報を渡す内部ヘッダーです。
+// クライアントが送った同名のヘッダーは受信時に上書き・削除します。
+const (
+	headerRequestPath = "X-Tumiki-Request-Path" // リクエストのパス
+	headerJWTClaims   = "X-Tumiki-Jwt-Claims"   // 認証で検証した JWT のクレーム（JSON）
+)
+
+// withMappingRequest はリクエストのパスを headerRequestPath に、検証した JWT のクレームを headerJWTClaims に設定したヘッダーを返します。
+// claims が nil（JWT で認証していない）の場合は headerJWTClaims を削除します。元のヘッダーは変更しません。
+func withMappingRequest(header http.Header, path string, claims jwtauth.Claims) http.Header {
+	header = header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set(headerRequestPath, path)
+	header.Del(headerJWTClaims)
+	if claims != nil {
+		// JSON から検証したクレームのため失敗しない
+		data, _ := json.Marshal(claims)
+		header.Set(headerJWTClaims, string(data))
+	}
+	return header
+}
+
+// claimsFromHeader は headerJWTClaims から検証した JWT のクレームを取り出します。
+func claimsFromHeader(header http.Header) map[string]any {
+	value := header.Get(headerJWTClaims)
+	if value == "" {
+		return nil
+	}
+	var claims map[string]any
+	// withMappingRequest が設定した値のため失敗しない
+	_ = json.Unmarshal([]byte(value), &claims)
+	return claims
+}
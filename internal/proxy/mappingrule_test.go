@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jwtauth"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mapping"
+)
+
+func TestHandleMCP_MappingRules(t *testing.T) {
+	staffArg := "debug"
+	rules := mapping.Rules{
+		{Header: "X-Debug", Env: "DEBUG_MODE", When: mapping.Condition{Claims: map[string]string{"role": "staff"}}},
+		{Header: "X-Debug", Arg: &staffArg, When: mapping.Condition{Path: "^/mcp/poll$"}},
+	}
+	verifier, err := jwtauth.NewVerifier(jwtauth.Config{Secret: testJWTSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServer(&Config{
+		Command:      "sh",
+		Args:         []string{"-c", `read line; printf '{"debug":"%s","args":"%s"}\n' "$DEBUG_MODE" "$*"`, "sh"},
+		DefaultEnv:   map[string]string{},
+		MappingRules: rules,
+		JWT:          verifier,
+		AuthMethods:  []string{AuthJWT},
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	staff := "Bearer " + hs256Token(t, testJWTSecret, map[string]any{"sub": "alice", "role": "staff"})
+	user := "Bearer " + hs256Token(t, testJWTSecret, map[string]any{"sub": "bob", "role": "user"})
+	forged := "Bearer " + hs256Token(t, []byte("other-secret"), map[string]any{"sub": "mallory", "role": "staff"})
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		wantCode int
+		want     string
+	}{
+		{name: "スタッフのトークン_環境変数に渡す", headers: map[string]string{"X-Debug": "1", "Authorization": staff}, wantCode: http.StatusOK, want: `{"debug":"1","args":""}`},
+		{name: "スタッフ以外のトークン_渡さない", headers: map[string]string{"X-Debug": "1", "Authorization": user}, wantCode: http.StatusOK, want: `{"debug":"","args":""}`},
+		{name: "クレームを偽装_渡さない", headers: map[string]string{"X-Debug": "1", "Authorization": user, headerJWTClaims: `{"role":"staff"}`}, wantCode: http.StatusOK, want: `{"debug":"","args":""}`},
+		{name: "検証できないトークン_拒否", headers: map[string]string{"X-Debug": "1", "Authorization": forged}, wantCode: http.StatusUnauthorized},
+		{name: "パスの条件を偽装_渡さない", headers: map[string]string{"X-Debug": "1", "Authorization": user, headerRequestPath: "/mcp/poll"}, wantCode: http.StatusOK, want: `{"debug":"","args":""}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := make(http.Header)
+			for k, v := range tt.headers {
+				header.Set(k, v)
+			}
+			w := postMCP(server, `{"jsonrpc":"2.0","id":1,"method":"ping"}`, header)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("Status = %d, want %d (body: %s)", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.want == "" {
+				return
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.want {
+				t.Errorf("body = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewServer_InvalidMappingRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules mapping.Rules
+	}{
+		{name: "envとargのどちらもなし_エラー", rules: mapping.Rules{{Header: "X-Debug"}}},
+		{name: "JWTの検証なしでクレームの条件_エラー", rules: mapping.Rules{{Header: "X-Debug", Env: "DEBUG_MODE", When: mapping.Condition{Claims: map[string]string{"role": "staff"}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewServer(&Config{
+				Command:      "cat",
+				MappingRules: tt.rules,
+			}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+			if err == nil {
+				t.Error("NewServer() expected error but got none")
+			}
+		})
+	}
+}
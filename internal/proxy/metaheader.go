@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// metaHeaderPrefix は結果の _meta から設定するレスポンスヘッダーの名前の接頭辞です。
+// プロセスが Set-Cookie などの任意のヘッダーを設定できないよう、この接頭辞のヘッダーに限ります。
+const metaHeaderPrefix = "X-Mcp-"
+
+// serverHeadersMetaKey はプロセスがレスポンスヘッダーを直接指定する _meta のキーです（ServerMetaHeaders が有効な場合のみ）。
+// ヘッダー名に X-Mcp- がない場合は付けます。
+//
+//	{"_meta": {"io.tumiki/headers": {"Cache-Hint": "max-age=60", "X-Mcp-Cost": 0.02}}}
+const serverHeadersMetaKey = "io.tumiki/headers"
+
+// metaHeaderNamePattern はヘッダー名に使える文字です。
+var metaHeaderNamePattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// metaHeaders は JSON-RPC の結果の _meta の値を X-Mcp-* のレスポンスヘッダーとして返します。
+// キャッシュのヒントやコストなど、本文を読まずに観測したい値をクライアントやプロキシに渡すために使います。
+type metaHeaders struct {
+	mapping map[string]string // ヘッダー名 → _meta のキー
+	server  bool              // プロセスが serverHeadersMetaKey で指定したヘッダーも返す
+	logger  *slog.Logger
+}
+
+// newMetaHeaders は _meta のキーとヘッダーの対応を検証します。対応がなく、プロセスの指定も受け付けない場合は nil を返します。
+func newMetaHeaders(mapping map[string]string, server bool, logger *slog.Logger) (*metaHeaders, error) {
+	if len(mapping) == 0 && !server {
+		return nil, nil
+	}
+	normalized, err := normalizeHeaderMapping(mapping)
+	if err != nil {
+		return nil, fmt.Errorf("meta header: %w", err)
+	}
+	for name, key := range normalized {
+		if !metaHeaderNamePattern.MatchString(name) || !strings.HasPrefix(name, metaHeaderPrefix) || name == metaHeaderPrefix {
+			return nil, fmt.Errorf("meta header %q must be a header name starting with %s", name, metaHeaderPrefix)
+		}
+		if key == "" {
+			return nil, fmt.Errorf("meta header %q: _meta key is required", name)
+		}
+	}
+	return &metaHeaders{mapping: normalized, server: server, logger: logger}, nil
+}
+
+// set はレスポンスの結果の _meta からヘッダーを設定します。結果や _meta がない場合は何もしません。
+// 同じヘッダーをプロセスが指定した場合は、設定の対応付けを優先します。
+func (m *metaHeaders) set(header http.Header, msg []byte) {
+	if m == nil {
+		return
+	}
+	var fields struct {
+		Result struct {
+			Meta map[string]json.RawMessage `json:"_meta"`
+		} `json:"result"`
+	}
+	if json.Unmarshal(msg, &fields) != nil || len(fields.Result.Meta) == 0 {
+		return
+	}
+	meta := fields.Result.Meta
+
+	if raw, ok := meta[serverHeadersMetaKey]; ok && m.server {
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &values); err != nil {
+			m.logger.Debug("Ignoring invalid response headers in _meta", "key", serverHeadersMetaKey, "error", err)
+		}
+		for name, raw := range values {
+			if !metaHeaderNamePattern.MatchString(name) {
+				m.logger.Debug("Ignoring invalid response header name in _meta", "header", name)
+				continue
+			}
+			name = http.CanonicalHeaderKey(name)
+			if !strings.HasPrefix(name, metaHeaderPrefix) {
+				name = metaHeaderPrefix + name
+			}
+			if _, mapped := m.mapping[name]; !mapped {
+				m.setValue(header, name, raw)
+			}
+		}
+	}
+	for name, key := range m.mapping {
+		if raw, ok := meta[key]; ok {
+			m.setValue(header, name, raw)
+		}
+	}
+}
+
+// setValue は _meta の値をヘッダーに設定します。文字列はそのまま、それ以外は JSON で設定し、
+// ヘッダーに含められない制御文字を含む値は設定しません。
+func (m *metaHeaders) setValue(header http.Header, name string, raw json.RawMessage) {
+	var value string
+	if json.Unmarshal(raw, &value) != nil {
+		var compact bytes.Buffer
+		if json.Compact(&compact, raw) != nil {
+			return
+		}
+		value = compact.String()
+	}
+	if strings.ContainsFunc(value, func(r rune) bool { return (r < 0x20 && r != '\t') || r == 0x7f }) {
+		m.logger.Debug("Ignoring response header value with control characters", "header", name)
+		return
+	}
+	header.Set(name, value)
+}
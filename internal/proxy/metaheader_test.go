@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"testing"
+)
+
+func TestMetaHeaders_Set(t *testing.T) {
+	mapping := map[string]string{"X-MCP-Cost": "com.example/cost", "X-Mcp-Cache-Hint": "com.example/cache"}
+	tests := []struct {
+		name   string
+		server bool
+		msg    string
+		want   http.Header
+	}{
+		{
+			name: "対応付けた_metaの値",
+			msg:  `{"jsonrpc":"2.0","id":1,"result":{"_meta":{"com.example/cost":0.02,"com.example/cache":"max-age=60","other":"x"}}}`,
+			want: http.Header{"X-Mcp-Cost": {"0.02"}, "X-Mcp-Cache-Hint": {"max-age=60"}},
+		},
+		{
+			name: "オブジェクト_JSON",
+			msg:  `{"jsonrpc":"2.0","id":1,"result":{"_meta":{"com.example/cost":{"usd": 0.02}}}}`,
+			want: http.Header{"X-Mcp-Cost": {`{"usd":0.02}`}},
+		},
+		{
+			name: "制御文字を含む値_無視",
+			msg:  `{"jsonrpc":"2.0","id":1,"result":{"_meta":{"com.example/cache":"a\r\nSet-Cookie: x"}}}`,
+			want: http.Header{},
+		},
+		{
+			name: "_metaなし",
+			msg:  `{"jsonrpc":"2.0","id":1,"result":{"content":[]}}`,
+			want: http.Header{},
+		},
+		{
+			name: "エラーレスポンス",
+			msg:  `{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"failed"}}`,
+			want: http.Header{},
+		},
+		{
+			name: "プロセスの指定_無効",
+			msg:  `{"jsonrpc":"2.0","id":1,"result":{"_meta":{"io.tumiki/headers":{"Region":"ap-northeast-1"}}}}`,
+			want: http.Header{},
+		},
+		{
+			name:   "プロセスの指定_X-Mcp-を付与",
+			server: true,
+			msg:    `{"jsonrpc":"2.0","id":1,"result":{"_meta":{"io.tumiki/headers":{"region":"ap-northeast-1","X-Mcp-Tokens":1200,"Bad Name":"x"}}}}`,
+			want:   http.Header{"X-Mcp-Region": {"ap-northeast-1"}, "X-Mcp-Tokens": {"1200"}},
+		},
+		{
+			name:   "プロセスの指定_対応付けを優先",
+			server: true,
+			msg:    `{"jsonrpc":"2.0","id":1,"result":{"_meta":{"com.example/cost":1,"io.tumiki/headers":{"Cost":2}}}}`,
+			want:   http.Header{"X-Mcp-Cost": {"1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newMetaHeaders(mapping, tt.server, slog.Default())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := http.Header{}
+			m.set(got, []byte(tt.msg))
+			if len(got) != len(tt.want) {
+				t.Fatalf("headers = %v, want %v", got, tt.want)
+			}
+			for name := range tt.want {
+				if got.Get(name) != tt.want.Get(name) {
+					t.Errorf("%s = %q, want %q", name, got.Get(name), tt.want.Get(name))
+				}
+			}
+		})
+	}
+}
+
+func TestNewMetaHeaders_不正な設定_エラー(t *testing.T) {
+	for _, mapping := range []map[string]string{
+		{"Cache-Control": "com.example/cache"},
+		{"X-Mcp-": "com.example/cache"},
+		{"X-Mcp-Bad Name": "com.example/cache"},
+		{"X-Mcp-Cost": ""},
+	} {
+		if _, err := newMetaHeaders(mapping, false, slog.Default()); err == nil {
+			t.Errorf("newMetaHeaders(%v) error = nil", mapping)
+		}
+	}
+	if m, err := newMetaHeaders(nil, false, slog.Default()); m != nil || err != nil {
+		t.Errorf("newMetaHeaders(nil) = %v, %v, want nil", m, err)
+	}
+}
+
+func TestHandleMCP_MetaHeaders(t *testing.T) {
+	script := `read line; echo '{"jsonrpc":"2.0","id":1,"result":{"content":[],"_meta":{"com.example/cost":0.5}}}'`
+	server, err := NewServer(&Config{
+		Command:     "sh",
+		Args:        []string{"-c", script},
+		MetaHeaders: map[string]string{"X-Mcp-Cost": "com.example/cost"},
+	}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	w := postMCP(server, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"price"}}`, nil)
+	if got := w.Header().Get("X-Mcp-Cost"); got != "0.5" {
+		t.Errorf("X-Mcp-Cost = %q, want 0.5 (response %s)", got, w.Body.String())
+	}
+}
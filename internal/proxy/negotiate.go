@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// contentTypeSSE は Server-Sent Events のメディアタイプです。
+const contentTypeSSE = "text/event-stream"
+
+// responseTypes は返却できるメディアタイプです。
+// Accept で同じ q 値が付いている場合はこの順に優先します（通知も返せるストリーミング形式を優先）。
+var responseTypes = []string{contentTypeNDJSON, contentTypeSSE, contentTypeJSON}
+
+// negotiate は Accept ヘッダーから返却するメディアタイプを選択します。
+// Accept がない場合は application/json を返し、受け付け可能な形式がない場合は空文字列を返します。
+// ワイルドカード（*/* や application/*）は application/json のみに一致させ、
+// ストリーミング形式は明示的に指定された場合だけ選択します。
+func negotiate(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return contentTypeJSON
+	}
+
+	best, bestQ := "", 0.0
+	for _, candidate := range responseTypes {
+		q := acceptQuality(accept, candidate)
+		if q > bestQ {
+			best, bestQ = candidate, q
+		}
+	}
+	return best
+}
+
+// acceptQuality は Accept ヘッダーにおける mediaType の q 値を返します。
+// 最も具体的に一致する範囲の q 値を使用し、一致しない場合は 0 を返します。
+func acceptQuality(accept, mediaType string) float64 {
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		s := -1
+		switch {
+		case mt == mediaType:
+			s = 2
+		case mediaType != contentTypeJSON:
+			// ストリーミング形式はワイルドカードでは選択しない
+		case mt == "*/*":
+			s = 0
+		case strings.HasSuffix(mt, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mt, "*")):
+			s = 1
+		}
+		if s <= specificity {
+			continue
+		}
+
+		specificity = s
+		q = 1
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+	}
+	return q
+}
+
+// isJSONContentType は Content-Type が application/json（charset を指定する場合は UTF-8）かどうかを返します。
+func isJSONContentType(contentType string) bool {
+	mt, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mt != contentTypeJSON {
+		return false
+	}
+	charset, ok := params["charset"]
+	return !ok || strings.EqualFold(charset, "utf-8")
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		expected string
+	}{
+		{name: "空のAccept_JSON", accept: "", expected: contentTypeJSON},
+		{name: "JSONのみ_JSON", accept: "application/json", expected: contentTypeJSON},
+		{name: "全ワイルドカード_JSON", accept: "*/*", expected: contentTypeJSON},
+		{name: "タイプワイルドカード_JSON", accept: "application/*", expected: contentTypeJSON},
+		{name: "textワイルドカード_該当なし", accept: "text/*", expected: ""},
+		{name: "SSEのみ_SSE", accept: "text/event-stream", expected: contentTypeSSE},
+		{name: "JSONとSSEが同順位_SSE", accept: "application/json, text/event-stream", expected: contentTypeSSE},
+		{name: "JSONとNDJSONが同順位_NDJSON", accept: "application/json, application/x-ndjson", expected: contentTypeNDJSON},
+		{name: "q値が高いJSON_JSON", accept: "application/json, text/event-stream;q=0.5", expected: contentTypeJSON},
+		{name: "q値が高いSSE_SSE", accept: "application/json;q=0.1, text/event-stream", expected: contentTypeSSE},
+		{name: "具体的な指定のq=0を優先_該当なし", accept: "application/json;q=0, */*;q=0.1", expected: ""},
+		{name: "具体的な指定を優先_ワイルドカードより低いq", accept: "*/*, application/json;q=0.2, text/event-stream;q=0.1", expected: contentTypeJSON},
+		{name: "不正な値は無視_JSON", accept: "@@@, application/json", expected: contentTypeJSON},
+		{name: "q値が不正_1として扱う", accept: "application/json;q=abc", expected: contentTypeJSON},
+		{name: "対応しない形式のみ_空文字列", accept: "text/html", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiate(tt.accept); got != tt.expected {
+				t.Errorf("negotiate(%q) = %q, want %q", tt.accept, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIsJSONContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		expected    bool
+	}{
+		{name: "JSON_true", contentType: "application/json", expected: true},
+		{name: "charsetがUTF-8_true", contentType: "application/json; charset=UTF-8", expected: true},
+		{name: "charsetがUTF-8以外_false", contentType: "application/json; charset=shift_jis", expected: false},
+		{name: "別のメディアタイプ_false", contentType: "text/plain", expected: false},
+		{name: "空文字列_false", contentType: "", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isJSONContentType(tt.contentType); got != tt.expected {
+				t.Errorf("isJSONContentType(%q) = %v, want %v", tt.contentType, got, tt.expected)
+			}
+		})
+	}
+}
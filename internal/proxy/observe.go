@@ -0,0 +1,321 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/metrics"
+)
+
+// リクエストを受け付けたフロントエンドです。
+const (
+	transportHTTP = "http"
+	transportGRPC = "grpc"
+)
+
+// リクエストの結果です。
+const (
+	resultOK        = "ok"         // 成功した
+	resultRPCError  = "rpc_error"  // JSON-RPC のエラーレスポンスを返した
+	resultError     = "error"      // HTTP・gRPC のエラーを返した
+	resultToolError = "tool_error" // ツールが isError: true の結果を返した（ツールのメトリクスのみ）
+
+	resultPartialOutput = "partial_output" // プロセスがメッセージを途中まで書き込んで終了した
+)
+
+// maxToolLabels はツールのメトリクスでラベルにするツール名の最大数です。超えた分は methodOther にまとめます。
+const maxToolLabels = 256
+
+// メソッドのラベルにできないリクエストのラベルです。
+const (
+	methodBatch    = "batch"    // バッチ
+	methodResponse = "response" // サーバーからのリクエストへのレスポンス
+	methodInvalid  = "invalid"  // JSON-RPC のメッセージでない
+	methodOther    = "other"    // MCP の仕様にないメソッド
+	methodUnknown  = "unknown"  // ボディを読む前に失敗した
+)
+
+// mcpMethods はメソッド名をそのままラベルにする MCP のメソッドです。
+// クライアントが任意の文字列を送れるため、それ以外は methodOther にまとめてシリーズの数を抑えます。
+var mcpMethods = map[string]bool{
+	"initialize":                       true,
+	"ping":                             true,
+	"tools/list":                       true,
+	"tools/call":                       true,
+	"resources/list":                   true,
+	"resources/templates/list":         true,
+	"resources/read":                   true,
+	"resources/subscribe":              true,
+	"resources/unsubscribe":            true,
+	"prompts/list":                     true,
+	"prompts/get":                      true,
+	"completion/complete":              true,
+	"logging/setLevel":                 true,
+	"notifications/initialized":        true,
+	"notifications/cancelled":          true,
+	"notifications/progress":           true,
+	"notifications/roots/list_changed": true,
+}
+
+// methodLabel はリクエストボディからメトリクスとログのラベルにするメソッド名を返します。
+func methodLabel(body []byte) string {
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		return methodBatch
+	}
+	msg, err := jsonrpc.Parse(body)
+	switch {
+	case err != nil:
+		return methodInvalid
+	case msg.Method == "":
+		return methodResponse
+	case mcpMethods[msg.Method]:
+		return msg.Method
+	default:
+		return methodOther
+	}
+}
+
+// requestObserver はメソッド・ツールごとのリクエスト数と処理時間をメトリクスに記録し、
+// 有効な場合はアクセスログと遅いツールの呼び出しのログに出力します。
+type requestObserver struct {
+	requests     *metrics.Counter
+	duration     *metrics.Counter
+	toolCalls    *metrics.Counter
+	toolDuration *metrics.Counter
+
+	logger    *slog.Logger
+	accessLog bool          // リクエストごとにアクセスログを出力する
+	slowTool  time.Duration // これ以上かかったツールの呼び出しをログに出力する（0 で無効）
+
+	labels *requestLabeler // X-Mcp-Labels のラベル付きのメトリクス（nil で無効）
+
+	served atomic.Int64 // 記録したリクエストの数（シャットダウンのレポートに含める）
+
+	windowRequests atomic.Int64 // 重みの公開の間隔に記録したリクエストの数
+	windowFailures atomic.Int64 // そのうちバックエンドの失敗で終わったリクエストの数
+
+	mu    sync.Mutex
+	tools map[string]bool // ラベルにしたツール名
+}
+
+func newRequestObserver(m *metrics.Registry, logger *slog.Logger, accessLog bool, slowTool time.Duration) *requestObserver {
+	return &requestObserver{
+		requests:     m.Counter("tumiki_requests_total", "Number of MCP requests by transport, JSON-RPC method and result.", "transport", "method", "result"),
+		duration:     m.Counter("tumiki_request_duration_seconds_total", "Total time spent handling MCP requests by transport and JSON-RPC method.", "transport", "method"),
+		toolCalls:    m.Counter("tumiki_tool_calls_total", "Number of tools/call requests by tool and result.", "tool", "result"),
+		toolDuration: m.Counter("tumiki_tool_call_duration_seconds_total", "Total time spent handling tools/call requests by tool.", "tool"),
+		logger:       logger,
+		accessLog:    accessLog,
+		slowTool:     slowTool,
+		tools:        make(map[string]bool),
+	}
+}
+
+// toolLabel はツール名をラベルにします。クライアントが任意の名前を送れるため、maxToolLabels を超えた新しい名前は methodOther にします。
+func (o *requestObserver) toolLabel(name string) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.tools[name] {
+		if len(o.tools) >= maxToolLabels {
+			return methodOther
+		}
+		o.tools[name] = true
+	}
+	return name
+}
+
+// observation は1つのリクエストの記録です。ハンドラーがボディを読んだ時点でメソッドを設定します。
+type observation struct {
+	method    string
+	tool      string // tools/call の場合のみ
+	rpcError  bool
+	toolError bool // ツールが isError: true の結果を返した
+
+	partialOutput bool // プロセスがメッセージを途中まで書き込んで終了した
+
+	labels requestLabels // X-Mcp-Labels のラベル（nil でラベルなし）
+}
+
+type observationKey struct{}
+
+// observeBody はリクエストボディのメソッドを ctx の記録に設定します。記録していないリクエストでは何もしません。
+func observeBody(ctx context.Context, body []byte) {
+	if o, ok := ctx.Value(observationKey{}).(*observation); ok {
+		o.method = methodLabel(body)
+		o.tool = requestCall(body).tool
+	}
+}
+
+// observeResponse はクライアントに返したレスポンスが JSON-RPC のエラーか、ツールのエラーかを ctx の記録に設定します。
+func observeResponse(ctx context.Context, response []byte) {
+	o, ok := ctx.Value(observationKey{}).(*observation)
+	if !ok {
+		return
+	}
+	msg, err := jsonrpc.Parse(response)
+	if err != nil {
+		return
+	}
+	o.rpcError = msg.Error != nil
+	if o.tool != "" && len(msg.Result) > 0 {
+		var result struct {
+			IsError bool `json:"isError"`
+		}
+		o.toolError = json.Unmarshal(msg.Result, &result) == nil && result.IsError
+	}
+}
+
+// observeHTTP は MCP エンドポイントのリクエストを記録します。
+func (o *requestObserver) observeHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		obs := &observation{method: methodUnknown}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		var labelErr error
+		if o.labels != nil {
+			obs.labels, labelErr = o.labels.parse(r.Header)
+		}
+		if labelErr != nil {
+			http.Error(rec, labelErr.Error(), http.StatusBadRequest)
+		} else {
+			next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), observationKey{}, obs)))
+		}
+
+		result := resultOK
+		switch {
+		case obs.partialOutput:
+			result = resultPartialOutput
+		case rec.status >= http.StatusBadRequest:
+			result = resultError
+		case obs.rpcError:
+			result = resultRPCError
+		}
+		o.record(r.Context(), transportHTTP, obs, result, strconv.Itoa(rec.status), time.Since(start))
+	})
+}
+
+// record はリクエストの結果をメトリクスとログに記録します。status は HTTP のステータスコードまたは gRPC のコードです。
+func (o *requestObserver) record(ctx context.Context, transport string, obs *observation, result, status string, elapsed time.Duration) {
+	o.served.Add(1)
+	o.windowRequests.Add(1)
+	if backendFailure(result, status) {
+		o.windowFailures.Add(1)
+	}
+	o.requests.Inc(transport, obs.method, result)
+	o.duration.Add(elapsed.Seconds(), transport, obs.method)
+	if o.labels != nil {
+		o.labels.record(obs.labels, result, elapsed.Seconds())
+	}
+	if obs.tool != "" {
+		o.recordTool(ctx, obs, result, elapsed)
+	}
+	if !o.accessLog {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("transport", transport),
+		slog.String("method", obs.method),
+		slog.String("result", result),
+		slog.String("status", status),
+		slog.Duration("duration", elapsed),
+	}
+	if obs.tool != "" {
+		attrs = append(attrs, slog.String("tool", obs.tool))
+	}
+	if obs.labels != nil {
+		attrs = append(attrs, o.labels.logAttr(obs.labels))
+	}
+	o.logger.LogAttrs(ctx, slog.LevelInfo, "Request completed", attrs...)
+}
+
+// takeWindow は前回の呼び出しから記録したリクエストの数と、そのうちバックエンドの失敗で終わった数を返し、数え直します。
+func (o *requestObserver) takeWindow() (requests, failures int64) {
+	return o.windowRequests.Swap(0), o.windowFailures.Swap(0)
+}
+
+// backendFailure はリクエストがバックエンドの失敗で終わったかを返します。
+// 認証やレート制限などのクライアント側の理由のエラー（4xx）や JSON-RPC のエラーは、バックエンドの健全性に関係しないため含めません。
+func backendFailure(result, status string) bool {
+	switch result {
+	case resultPartialOutput:
+		return true
+	case resultError:
+		return strings.HasPrefix(status, "5") || backendFailureCodes[status]
+	default:
+		return false
+	}
+}
+
+// backendFailureCodes はバックエンドの失敗として数える gRPC のコードです。
+var backendFailureCodes = map[string]bool{
+	codes.Unknown.String():          true,
+	codes.Internal.String():         true,
+	codes.Unavailable.String():      true,
+	codes.DeadlineExceeded.String(): true,
+	codes.DataLoss.String():         true,
+}
+
+// recordTool は tools/call の結果をツールごとのメトリクスに記録し、遅い呼び出しをログに出力します。
+func (o *requestObserver) recordTool(ctx context.Context, obs *observation, result string, elapsed time.Duration) {
+	if result == resultOK && obs.toolError {
+		result = resultToolError
+	}
+	tool := o.toolLabel(obs.tool)
+	o.toolCalls.Inc(tool, result)
+	o.toolDuration.Add(elapsed.Seconds(), tool)
+	if o.slowTool > 0 && elapsed >= o.slowTool {
+		attrs := []slog.Attr{
+			slog.String("tool", obs.tool),
+			slog.String("result", result),
+			slog.Duration("duration", elapsed),
+			slog.Duration("threshold", o.slowTool),
+		}
+		if obs.labels != nil {
+			attrs = append(attrs, o.labels.logAttr(obs.labels))
+		}
+		o.logger.LogAttrs(ctx, slog.LevelWarn, "Slow tool call", attrs...)
+	}
+}
+
+// statusRecorder は書き込んだステータスコードを記録する http.ResponseWriter です。
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(p)
+}
+
+// Flush はストリーミングのレスポンスを逐次返せるよう、元の http.ResponseWriter の Flush を呼び出します。
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap は http.ResponseController が元の http.ResponseWriter を使えるようにします。
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/metrics"
+)
+
+func TestMethodLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "MCPのメソッド_そのまま", body: `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search"}}`, want: "tools/call"},
+		{name: "通知_そのまま", body: `{"jsonrpc":"2.0","method":"notifications/initialized"}`, want: "notifications/initialized"},
+		{name: "仕様にないメソッド_other", body: `{"jsonrpc":"2.0","id":1,"method":"x/random-1234"}`, want: methodOther},
+		{name: "レスポンス_response", body: `{"jsonrpc":"2.0","id":1,"result":{}}`, want: methodResponse},
+		{name: "バッチ_batch", body: ` [{"jsonrpc":"2.0","id":1,"method":"ping"}]`, want: methodBatch},
+		{name: "JSONでない_invalid", body: `not json`, want: methodInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := methodLabel([]byte(tt.body)); got != tt.want {
+				t.Errorf("methodLabel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleMCP_MethodMetrics(t *testing.T) {
+	script := `read line; case "$line" in
+*tools/call*) echo '{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"failed"}}' ;;
+*) echo '{"jsonrpc":"2.0","id":1,"result":{}}' ;;
+esac`
+	var logs bytes.Buffer
+	server, err := NewServer(&Config{Command: "sh", Args: []string{"-c", script}, Metrics: true, AccessLog: true},
+		slog.New(slog.NewJSONHandler(&logs, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	post := func(body, contentType string) {
+		req := httptest.NewRequest("POST", "/mcp", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		server.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+	post(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search"}}`, "application/json")
+	post(`{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":"file:///a"}}`, "application/json")
+	post(`{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":"file:///b"}}`, "application/json")
+	post(`{}`, "text/plain")
+	if _, err := server.call(context.Background(), wrapperspb.Bytes([]byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))); err != nil {
+		t.Fatalf("call() error = %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`tumiki_requests_total{transport="http",method="tools/call",result="rpc_error"} 1`,
+		`tumiki_requests_total{transport="http",method="resources/read",result="ok"} 2`,
+		`tumiki_requests_total{transport="http",method="unknown",result="error"} 1`,
+		`tumiki_requests_total{transport="grpc",method="ping",result="ok"} 1`,
+		`tumiki_request_duration_seconds_total{transport="http",method="resources/read"}`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("metrics should contain %s:\n%s", want, w.Body.String())
+		}
+	}
+
+	// アクセスログにはメソッドに加えてツール名とステータスコードを出力する
+	if want := `"msg":"Request completed","transport":"http","method":"tools/call","result":"rpc_error","status":"200"`; !strings.Contains(logs.String(), want) {
+		t.Errorf("access log should contain %s:\n%s", want, logs.String())
+	}
+	if !strings.Contains(logs.String(), `"tool":"search"`) {
+		t.Errorf("access log should contain the tool name:\n%s", logs.String())
+	}
+}
+
+func TestHandleMCP_AccessLogDisabled(t *testing.T) {
+	var logs bytes.Buffer
+	server, err := NewServer(&Config{Command: "cat"}, slog.New(slog.NewJSONHandler(&logs, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+	req.Header.Set("Content-Type", "application/json")
+	server.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	if strings.Contains(logs.String(), "Request completed") {
+		t.Errorf("access log should be disabled by default:\n%s", logs.String())
+	}
+}
+
+func TestHandleMCP_ToolMetrics(t *testing.T) {
+	script := `read line; case "$line" in
+*'"name":"broken"'*) echo '{"jsonrpc":"2.0","id":1,"result":{"content":[],"isError":true}}' ;;
+*'"name":"slow"'*) sleep 0.2; echo '{"jsonrpc":"2.0","id":1,"result":{"content":[]}}' ;;
+*) echo '{"jsonrpc":"2.0","id":1,"result":{"content":[]}}' ;;
+esac`
+	var logs bytes.Buffer
+	server, err := NewServer(&Config{Command: "sh", Args: []string{"-c", script}, Metrics: true, SlowToolThreshold: 100 * time.Millisecond},
+		slog.New(slog.NewJSONHandler(&logs, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	for _, tool := range []string{"search", "search", "broken", "slow"} {
+		req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"`+tool+`"}}`))
+		req.Header.Set("Content-Type", "application/json")
+		server.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`tumiki_tool_calls_total{tool="search",result="ok"} 2`,
+		`tumiki_tool_calls_total{tool="broken",result="tool_error"} 1`,
+		`tumiki_tool_calls_total{tool="slow",result="ok"} 1`,
+		`tumiki_tool_call_duration_seconds_total{tool="slow"} 0.2`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("metrics should contain %s:\n%s", want, w.Body.String())
+		}
+	}
+
+	// しきい値を超えたツールの呼び出しだけを警告ログに出力する
+	if got := strings.Count(logs.String(), `"msg":"Slow tool call"`); got != 1 {
+		t.Errorf("slow tool logs = %d, want 1:\n%s", got, logs.String())
+	}
+	if !strings.Contains(logs.String(), `"msg":"Slow tool call","tool":"slow"`) {
+		t.Errorf("slow tool log should name the tool:\n%s", logs.String())
+	}
+}
+
+func TestRequestObserver_ToolLabelLimit(t *testing.T) {
+	o := newRequestObserver(metrics.NewRegistry(), slog.Default(), false, 0)
+	for i := range maxToolLabels {
+		if got := o.toolLabel(fmt.Sprintf("tool-%d", i)); got != fmt.Sprintf("tool-%d", i) {
+			t.Fatalf("toolLabel() = %q, want the tool name", got)
+		}
+	}
+	if got := o.toolLabel("tool-new"); got != methodOther {
+		t.Errorf("toolLabel() over the limit = %q, want %q", got, methodOther)
+	}
+	if got := o.toolLabel("tool-0"); got != "tool-0" {
+		t.Errorf("toolLabel() for a known tool = %q, want tool-0", got)
+	}
+}
@@ -0,0 +1,249 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/objectstore"
+)
+
+// DefaultOffloadThreshold はオブジェクトストレージに退避するデフォルトのバイト数です。
+const DefaultOffloadThreshold = 1024 * 1024
+
+// offloadRefKey は退避した値の代わりに置く参照オブジェクトのキーです。
+//
+//	{"io.tumiki/offload": {"ref": "s3://bucket/key", "size": 123, "sha256": "..."}}
+//
+// オブジェクトには元の値を JSON として保存します。
+const offloadRefKey = "io.tumiki/offload"
+
+// headerOffload はクライアントが参照を解決できることを表すリクエストヘッダーです。
+// このヘッダーを送ったクライアントにだけ、レスポンスの大きなバイナリを参照に置き換えて返します。
+const headerOffload = "X-Mcp-Offload"
+
+// offloadRef は退避した値の参照です。
+type offloadRef struct {
+	Ref    string `json:"ref"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// offloadContextKey はレスポンスを参照に置き換えてよいことを表すコンテキストのキーです。
+type offloadContextKey struct{}
+
+// offloadContext はクライアントが X-Mcp-Offload ヘッダーを送った場合に、レスポンスの退避を有効にしたコンテキストを返します。
+func (s *Server) offloadContext(ctx context.Context, header http.Header) context.Context {
+	if s.cfg.Offload == nil || header.Get(headerOffload) == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, offloadContextKey{}, true)
+}
+
+func (s *Server) offloadThreshold() int {
+	if s.cfg.OffloadThreshold > 0 {
+		return s.cfg.OffloadThreshold
+	}
+	return DefaultOffloadThreshold
+}
+
+// rehydrate はリクエストの params に含まれる参照をオブジェクトストレージから取得した値に置き換えます。
+// プロセスは参照を意識せずに元の値を受け取ります。
+func (s *Server) rehydrate(ctx context.Context, body []byte) ([]byte, error) {
+	if s.cfg.Offload == nil || !bytes.Contains(body, []byte(offloadRefKey)) {
+		return body, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var root any
+	if err := decoder.Decode(&root); err != nil {
+		return body, nil
+	}
+	messages, ok := root.([]any)
+	if !ok {
+		messages = []any{root}
+	}
+
+	changed := false
+	for _, msg := range messages {
+		obj, ok := msg.(map[string]any)
+		if !ok || obj["params"] == nil {
+			continue
+		}
+		params, replaced, err := s.resolveRefs(ctx, obj["params"])
+		if err != nil {
+			return nil, err
+		}
+		obj["params"] = params
+		changed = changed || replaced
+	}
+	if !changed {
+		return body, nil
+	}
+	return json.Marshal(root)
+}
+
+// resolveRefs は node 以下の参照オブジェクトを元の値に置き換えます。
+func (s *Server) resolveRefs(ctx context.Context, node any) (any, bool, error) {
+	switch v := node.(type) {
+	case map[string]any:
+		if ref, ok := parseOffloadRef(v); ok {
+			value, err := s.fetchRef(ctx, ref)
+			return value, err == nil, err
+		}
+		changed := false
+		for key, child := range v {
+			resolved, c, err := s.resolveRefs(ctx, child)
+			if err != nil {
+				return nil, false, err
+			}
+			v[key] = resolved
+			changed = changed || c
+		}
+		return v, changed, nil
+	case []any:
+		changed := false
+		for i, child := range v {
+			resolved, c, err := s.resolveRefs(ctx, child)
+			if err != nil {
+				return nil, false, err
+			}
+			v[i] = resolved
+			changed = changed || c
+		}
+		return v, changed, nil
+	}
+	return node, false, nil
+}
+
+// parseOffloadRef は offloadRefKey だけを持つオブジェクトを参照として解析します。
+func parseOffloadRef(obj map[string]any) (offloadRef, bool) {
+	raw, ok := obj[offloadRefKey]
+	if !ok || len(obj) != 1 {
+		return offloadRef{}, false
+	}
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return offloadRef{}, false
+	}
+	var ref offloadRef
+	ref.Ref, _ = fields["ref"].(string)
+	ref.SHA256, _ = fields["sha256"].(string)
+	if size, ok := fields["size"].(json.Number); ok {
+		ref.Size, _ = size.Int64()
+	}
+	return ref, ref.Ref != ""
+}
+
+// fetchRef は参照先のオブジェクトを取得し、サイズとハッシュを検証して元の値に戻します。
+func (s *Server) fetchRef(ctx context.Context, ref offloadRef) (any, error) {
+	data, err := s.cfg.Offload.Get(ctx, ref.Ref, int64(s.maxMessageSize()))
+	if errors.Is(err, objectstore.ErrNotFound) || errors.Is(err, objectstore.ErrInvalidRef) {
+		return nil, fmt.Errorf("%w: %v", errInvalidRequest, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fetch offloaded payload: %w", err)
+	}
+	if ref.Size > 0 && int64(len(data)) != ref.Size {
+		return nil, fmt.Errorf("%w: offloaded payload %s has %d bytes, want %d", errInvalidRequest, ref.Ref, len(data), ref.Size)
+	}
+	if ref.SHA256 != "" {
+		if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != ref.SHA256 {
+			return nil, fmt.Errorf("%w: offloaded payload %s does not match its sha256", errInvalidRequest, ref.Ref)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("%w: offloaded payload %s is not JSON: %v", errInvalidRequest, ref.Ref, err)
+	}
+	return value, nil
+}
+
+// offloadResponse は X-Mcp-Offload ヘッダーを送ったクライアントへのレスポンスのうち、
+// しきい値を超える resources/read の contents[].blob と image/audio コンテンツの data をオブジェクトストレージに退避し、参照に置き換えます。
+func (s *Server) offloadResponse(ctx context.Context, msg []byte) ([]byte, error) {
+	if enabled, _ := ctx.Value(offloadContextKey{}).(bool); !enabled || len(msg) <= s.offloadThreshold() {
+		return msg, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(msg))
+	decoder.UseNumber()
+	var root any
+	if err := decoder.Decode(&root); err != nil {
+		return msg, nil
+	}
+	changed, err := s.offloadNode(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return msg, nil
+	}
+	return json.Marshal(root)
+}
+
+func (s *Server) offloadNode(ctx context.Context, node any) (bool, error) {
+	changed := false
+	switch v := node.(type) {
+	case map[string]any:
+		field := ""
+		switch {
+		case v["blob"] != nil:
+			field = "blob"
+		case v["type"] == "image" || v["type"] == "audio":
+			field = "data"
+		}
+		if value, ok := v[field].(string); ok && len(value) > s.offloadThreshold() {
+			ref, err := s.putRef(ctx, value)
+			if err != nil {
+				return false, err
+			}
+			v[field] = map[string]any{offloadRefKey: ref}
+			changed = true
+		}
+		for _, child := range v {
+			c, err := s.offloadNode(ctx, child)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || c
+		}
+	case []any:
+		for _, child := range v {
+			c, err := s.offloadNode(ctx, child)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || c
+		}
+	}
+	return changed, nil
+}
+
+// putRef は値を JSON としてオブジェクトストレージに保存し、参照を返します。
+func (s *Server) putRef(ctx context.Context, value any) (offloadRef, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return offloadRef{}, err
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return offloadRef{}, fmt.Errorf("generate object name: %w", err)
+	}
+	ref, err := s.cfg.Offload.Put(ctx, hex.EncodeToString(buf)+".json", data, contentTypeJSON)
+	if err != nil {
+		return offloadRef{}, fmt.Errorf("offload payload: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return offloadRef{Ref: ref, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}, nil
+}
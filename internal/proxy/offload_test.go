@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/objectstore"
+)
+
+func newOffloadServer(t *testing.T, store objectstore.Store, args ...string) *Server {
+	t.Helper()
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             append([]string{"-c"}, args...),
+		DefaultEnv:       map[string]string{},
+		Offload:          store,
+		OffloadThreshold: 16,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	return server
+}
+
+func postMCP(server *Server, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func TestHandleMCP_RehydrateOffloadedParams(t *testing.T) {
+	store := objectstore.NewMemory()
+	value := []byte(`"` + strings.Repeat("a", 32) + `"`)
+	ref, _ := store.Put(context.Background(), "param.json", value, contentTypeJSON)
+	sum := sha256.Sum256(value)
+	refJSON := func(ref, hash string) string {
+		return `{"` + offloadRefKey + `":{"ref":"` + ref + `","size":` + "34" + `,"sha256":"` + hash + `"}}`
+	}
+
+	// プロセスは受け取ったリクエストをそのまま result として返す
+	server := newOffloadServer(t, store, `read line; echo "{\"jsonrpc\":\"2.0\",\"id\":1,\"result\":$line}"`)
+
+	tests := []struct {
+		name       string
+		content    string
+		wantStatus int
+		wantText   string
+	}{
+		{name: "参照_元の値に戻して渡す", content: refJSON(ref, hex.EncodeToString(sum[:])), wantStatus: http.StatusOK, wantText: strings.Repeat("a", 32)},
+		{name: "存在しない参照_400", content: refJSON("mem://missing", ""), wantStatus: http.StatusBadRequest},
+		{name: "ハッシュの不一致_400", content: refJSON(ref, strings.Repeat("0", 64)), wantStatus: http.StatusBadRequest},
+		{name: "別のストアの参照_400", content: refJSON("s3://other/key", ""), wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postMCP(server, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","arguments":{"text":`+tt.content+`}}}`, nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d (body: %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantText == "" {
+				return
+			}
+			var got struct {
+				Result struct {
+					Params struct {
+						Arguments struct {
+							Text string `json:"text"`
+						} `json:"arguments"`
+					} `json:"params"`
+				} `json:"result"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("invalid JSON: %v (%s)", err, w.Body.String())
+			}
+			if got.Result.Params.Arguments.Text != tt.wantText {
+				t.Errorf("text = %q, want %q", got.Result.Params.Arguments.Text, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestHandleMCP_OffloadResponse(t *testing.T) {
+	store := objectstore.NewMemory()
+	blob := strings.Repeat("QUJD", 16)
+	server := newOffloadServer(t, store, `read line; echo '{"jsonrpc":"2.0","id":1,"result":{"contents":[{"uri":"file:///a.bin","blob":"`+blob+`"}]}}'`)
+	request := `{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":"file:///a.bin"}}`
+
+	// X-Mcp-Offload を送らないクライアントにはそのまま返す
+	if w := postMCP(server, request, nil); !strings.Contains(w.Body.String(), blob) {
+		t.Fatalf("response without X-Mcp-Offload = %s, want the inline blob", w.Body.String())
+	}
+
+	w := postMCP(server, request, http.Header{headerOffload: {"1"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d (body: %s)", w.Code, w.Body.String())
+	}
+	var got struct {
+		Result struct {
+			Contents []struct {
+				Blob map[string]offloadRef `json:"blob"`
+			} `json:"contents"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v (%s)", err, w.Body.String())
+	}
+	ref := got.Result.Contents[0].Blob[offloadRefKey]
+	data, err := store.Get(context.Background(), ref.Ref, 0)
+	if err != nil {
+		t.Fatalf("Get(%q) error = %v", ref.Ref, err)
+	}
+	sum := sha256.Sum256(data)
+	if string(data) != `"`+blob+`"` || ref.Size != int64(len(data)) || ref.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("offloaded object = %s, ref = %+v", data, ref)
+	}
+}
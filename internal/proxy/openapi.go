@@ -0,0 +1,466 @@
+package proxy
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// openAPIPath は設定から生成した OpenAPI ドキュメントを返すパスです。
+const openAPIPath = "/openapi.json"
+
+// openAPIDocVersion は生成する OpenAPI ドキュメント自体のバージョンです。
+const openAPIDocVersion = "1.0.0"
+
+// object は OpenAPI ドキュメントの JSON オブジェクトです。
+type object = map[string]any
+
+// headerMappingDoc は x-tumiki-header-mappings に含めるヘッダーマッピング1件です。
+type headerMappingDoc struct {
+	Header   string  `json:"header"`
+	Env      string  `json:"env,omitempty"`
+	Arg      *string `json:"arg,omitempty"` // 空文字列は位置引数
+	Override string  `json:"override,omitempty"`
+	Remove   string  `json:"remove,omitempty"`
+	Decoding string  `json:"decoding,omitempty"`
+	// Conditional は条件付きマッピング（--mapping-rules）の場合に true です。
+	Conditional bool `json:"conditional,omitempty"`
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, _ *http.Request) {
+	s.writeJSON(w, s.openAPIDocument())
+}
+
+// openAPIDocument は有効なエンドポイントと設定済みのヘッダーマッピングを記述した OpenAPI 3.1 ドキュメントを返します。
+func (s *Server) openAPIDocument() object {
+	mappings := s.headerMappingDocs()
+
+	mcpParams := []any{}
+	for _, m := range mappings {
+		mcpParams = append(mcpParams, object{"$ref": "#/components/parameters/" + m.Header})
+	}
+	if s.cfg.RateLimitKeyHeader != "" {
+		mcpParams = append(mcpParams, object{
+			"name": s.cfg.RateLimitKeyHeader, "in": "header",
+			"description": "Client key for rate limiting",
+			"schema":      object{"type": "string"},
+		})
+	}
+	if s.cfg.AffinityHeader != "" {
+		mcpParams = append(mcpParams, object{
+			"name": s.cfg.AffinityHeader, "in": "header",
+			"description": "Affinity key that routes requests with the same value to the same replica",
+			"schema":      object{"type": "string"},
+		})
+	}
+
+	paths := object{
+		"/mcp": object{
+			"post": object{
+				"summary":     "Send a JSON-RPC message to the MCP server",
+				"description": "Starts the stdio MCP server with env vars and args derived from the mapped headers and returns its response.",
+				"operationId": "postMCP",
+				"parameters": append(mcpParams, object{
+					"name": "Accept", "in": "header",
+					"description": "Response format; streaming formats also deliver notifications",
+					"schema":      object{"type": "string", "enum": []string{contentTypeJSON, contentTypeNDJSON, "text/event-stream"}},
+				}),
+				"requestBody": object{
+					"required": true,
+					"content":  object{contentTypeJSON: object{"schema": object{"$ref": "#/components/schemas/JSONRPCMessage"}}},
+				},
+				"responses": object{
+					"200": object{
+						"description": "JSON-RPC response",
+						"content": object{
+							contentTypeJSON:     object{"schema": object{"$ref": "#/components/schemas/JSONRPCMessage"}},
+							contentTypeNDJSON:   object{"schema": object{"type": "string"}},
+							"text/event-stream": object{"schema": object{"type": "string"}},
+						},
+					},
+					"400": object{"description": "Invalid request payload or header value"},
+					"401": object{"description": "Rejected by a plugin"},
+					"403": object{"description": "Rejected by a plugin or script"},
+					"406": object{"description": "No acceptable response format"},
+					"415": object{"description": "Content-Type is not application/json"},
+					"429": object{"description": "Rate limit exceeded"},
+					"431": object{"description": "Mapped header value too large"},
+					"500": object{"description": "Process execution failed"},
+				},
+			},
+		},
+		openAPIPath: object{
+			"get": object{
+				"summary":     "This OpenAPI document",
+				"operationId": "getOpenAPI",
+				"responses":   object{"200": object{"description": "OpenAPI document", "content": object{contentTypeJSON: object{}}}},
+			},
+		},
+	}
+
+	if s.cfg.WebSocket {
+		paths[webSocketPath] = object{
+			"get": object{
+				"summary":     "Upgrade to a WebSocket relaying JSON-RPC messages with a dedicated stdio process",
+				"operationId": "getWebSocket",
+				"parameters":  mcpParams,
+				"responses": object{
+					"101": object{"description": "Switching Protocols; each WebSocket message carries newline-delimited JSON-RPC messages"},
+					"426": object{"description": "Upgrade Required"},
+				},
+			},
+		}
+	}
+
+	if s.cfg.LongPoll {
+		session := object{
+			"name": headerSessionID, "in": "header",
+			"description": "Long-polling session ID (omit on the first POST to create a session)",
+			"schema":      object{"type": "string"},
+		}
+		paths[pollPath] = object{
+			"post": object{
+				"summary":     "Send a JSON-RPC message to a long-polling session",
+				"operationId": "postPoll",
+				"parameters":  append(slices.Clone(mcpParams), session),
+				"requestBody": object{
+					"required": true,
+					"content":  object{contentTypeJSON: object{"schema": object{"$ref": "#/components/schemas/JSONRPCMessage"}}},
+				},
+				"responses": object{
+					"202": object{"description": "Accepted; the session ID is returned in " + headerSessionID},
+					"403": object{"description": "Session belongs to another client"},
+					"404": object{"description": "Session not found"},
+				},
+			},
+			"get": object{
+				"summary":     "Receive pending messages of a long-polling session",
+				"operationId": "getPoll",
+				"parameters":  []any{session},
+				"responses": object{
+					"200": object{
+						"description": "Messages received while waiting (empty when none arrived)",
+						"content": object{contentTypeJSON: object{"schema": object{
+							"type": "array", "items": object{"$ref": "#/components/schemas/JSONRPCMessage"},
+						}}},
+					},
+					"403": object{"description": "Session belongs to another client"},
+					"404": object{"description": "Session not found"},
+					"410": object{"description": "Session closed"},
+				},
+			},
+		}
+	}
+
+	if s.cfg.Subscriptions || s.cfg.Sessions {
+		session := object{
+			"name": headerSessionID, "in": "header",
+			"description": "Session ID returned by resources/subscribe or initialize",
+			"schema":      object{"type": "string"},
+		}
+		mcp := paths["/mcp"].(object)
+		post := mcp["post"].(object)
+		post["parameters"] = append(post["parameters"].([]any), session)
+		mcp["get"] = object{
+			"summary":     "Receive notifications of a session",
+			"description": "Streams notifications such as notifications/resources/updated sent by the session process until it exits.",
+			"operationId": "streamMCP",
+			"parameters":  []any{session},
+			"responses": object{
+				"200": object{"description": "Notification stream", "content": object{"text/event-stream": object{"schema": object{"type": "string"}}}},
+				"403": object{"description": "Session belongs to another client"},
+				"404": object{"description": "Session not found"},
+			},
+		}
+		mcp["delete"] = object{
+			"summary":     "End a session",
+			"operationId": "deleteMCP",
+			"parameters":  []any{session},
+			"responses": object{
+				"204": object{"description": "Session ended"},
+				"403": object{"description": "Session belongs to another client"},
+				"404": object{"description": "Session not found"},
+			},
+		}
+	}
+
+	if s.cfg.BlobThreshold > 0 {
+		paths[blobPathPrefix+"{id}"] = object{
+			"get": object{
+				"summary":     "Download binary data offloaded from a response",
+				"operationId": "getBlob",
+				"parameters":  []any{object{"name": "id", "in": "path", "required": true, "schema": object{"type": "string"}}},
+				"responses": object{
+					"200": object{"description": "Binary data", "content": object{"application/octet-stream": object{}}},
+					"404": object{"description": "Blob not found or expired"},
+				},
+			},
+		}
+	}
+
+	if s.downloads != nil {
+		paths[downloadPathPrefix+"{id}"] = object{
+			"get": object{
+				"summary":     "Download resources/read content through its signed URL",
+				"operationId": "download",
+				"parameters": []any{
+					object{"name": "id", "in": "path", "required": true, "schema": object{"type": "string"}},
+					object{"name": "expires", "in": "query", "required": true, "schema": object{"type": "integer"}},
+					object{"name": "signature", "in": "query", "required": true, "schema": object{"type": "string"}},
+				},
+				"responses": object{
+					"200": object{"description": "Content (Range requests are supported)", "content": object{"application/octet-stream": object{}}},
+					"403": object{"description": "Invalid signature"},
+					"404": object{"description": "Content not found"},
+					"410": object{"description": "Download URL expired"},
+				},
+			},
+		}
+	}
+
+	if s.staged != nil {
+		paths[stagedFilesPath] = object{
+			"post": object{
+				"summary":     "Upload a file to pass to processes via the " + headerStagedFiles + " header",
+				"operationId": "uploadFile",
+				"parameters":  []any{object{"name": "name", "in": "query", "required": true, "schema": object{"type": "string"}}},
+				"requestBody": object{"required": true, "content": object{"application/octet-stream": object{}}},
+				"responses": object{
+					"200": object{"description": "Staged file (id, name, path, size, expires_at)", "content": object{contentTypeJSON: object{}}},
+					"400": object{"description": "Invalid file name"},
+					"413": object{"description": "File too large"},
+				},
+			},
+		}
+		paths[stagedFilesPath+"/{id}"] = object{
+			"delete": object{
+				"summary":     "Delete an uploaded file",
+				"operationId": "deleteFile",
+				"parameters":  []any{object{"name": "id", "in": "path", "required": true, "schema": object{"type": "string"}}},
+				"responses": object{
+					"204": object{"description": "Deleted"},
+					"404": object{"description": "File not found or expired"},
+				},
+			},
+		}
+	}
+
+	if s.cfg.Metrics {
+		paths["/metrics"] = object{
+			"get": object{
+				"summary":     "Prometheus metrics",
+				"operationId": "getMetrics",
+				"responses":   object{"200": object{"description": "Metrics in the Prometheus text format", "content": object{"text/plain": object{}}}},
+			},
+		}
+	}
+
+	if s.cfg.AdminToken != "" {
+		admin := func(summary, operationID string, params ...any) object {
+			op := object{
+				"summary":     summary,
+				"operationId": operationID,
+				"tags":        []string{"admin"},
+				"security":    []any{object{"adminToken": []string{}}},
+				"responses": object{
+					"200": object{"description": "Backend status", "content": object{contentTypeJSON: object{}}},
+					"401": object{"description": "Invalid admin token"},
+				},
+			}
+			if len(params) > 0 {
+				op["parameters"] = params
+			}
+			return op
+		}
+		version := object{"name": "version", "in": "path", "required": true, "schema": object{"type": "string"}}
+		paths["/admin/backends"] = object{"get": admin("List backend versions", "listBackends")}
+		register := admin("Register a backend version", "registerBackend", version)
+		register["requestBody"] = object{
+			"required": true,
+			"content": object{contentTypeJSON: object{"schema": object{
+				"type": "object",
+				"properties": object{
+					"command": object{"type": "string"},
+					"args":    object{"type": "array", "items": object{"type": "string"}},
+					"runtime": object{"type": "string", "enum": []string{process.RuntimeDocker, process.RuntimePodman, process.RuntimeContainerd, process.RuntimeFirecracker}},
+				},
+				"required": []string{"command"},
+			}}},
+		}
+		paths["/admin/backends/{version}"] = object{"put": register}
+		paths["/admin/backends/{version}/activate"] = object{"post": admin("Activate a backend version", "activateBackend", version)}
+		paths["/admin/backends/rollback"] = object{"post": admin("Roll back to the previous backend version", "rollbackBackend")}
+		if s.cfg.APIKeys != nil {
+			paths["/admin/keys"] = object{
+				"get":  admin("List API keys", "listAPIKeys"),
+				"post": admin("Create an API key (the key is returned only once)", "createAPIKey"),
+			}
+			keyID := object{"name": "id", "in": "path", "required": true, "schema": object{"type": "string"}}
+			paths["/admin/keys/{id}"] = object{
+				"delete": admin("Revoke an API key", "revokeAPIKey", keyID),
+			}
+			paths["/admin/keys/{id}/env"] = object{
+				"put": admin("Replace the environment variables injected for an API key", "setAPIKeyEnv", keyID),
+			}
+		}
+		if s.usage != nil {
+			paths["/admin/usage"] = object{"get": admin("Usage since the last exported report", "getUsage")}
+		}
+		if s.cache != nil {
+			paths["/admin/cache"] = object{"delete": admin("Purge cached responses", "purgeCache",
+				object{"name": "method", "in": "query", "schema": object{"type": "string"}},
+				object{"name": "server", "in": "query", "schema": object{"type": "string"}})}
+		}
+		if s.gossip != nil {
+			paths["/admin/cluster"] = object{"get": admin("Cluster membership and health", "getCluster")}
+		}
+	}
+
+	parameters := object{}
+	for _, m := range mappings {
+		parameters[m.Header] = object{
+			"name": m.Header, "in": "header",
+			"description": m.description(),
+			"schema":      object{"type": "string"},
+		}
+	}
+
+	components := object{
+		"schemas": object{
+			"JSONRPCMessage": object{
+				"type": "object",
+				"properties": object{
+					"jsonrpc": object{"const": "2.0"},
+					"id":      object{"type": []string{"string", "integer", "null"}},
+					"method":  object{"type": "string"},
+					"params":  object{},
+					"result":  object{},
+					"error":   object{"type": "object"},
+				},
+				"required": []string{"jsonrpc"},
+			},
+		},
+		"parameters": parameters,
+	}
+	schemes := object{}
+	if s.cfg.AdminToken != "" {
+		schemes["adminToken"] = object{"type": "http", "scheme": "bearer"}
+	}
+	// MCP エンドポイントはいずれかの方式で認証する
+	var security []any
+	for _, method := range s.authMethods() {
+		switch method {
+		case AuthMTLS:
+			schemes["mutualTLS"] = object{"type": "mutualTLS"}
+			security = append(security, object{"mutualTLS": []string{}})
+		case AuthJWT:
+			schemes["jwt"] = object{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"}
+			security = append(security, object{"jwt": []string{}})
+		case AuthAPIKey:
+			// X-Api-Key または Authorization: Bearer のどちらかで認証する
+			schemes["apiKey"] = object{"type": "apiKey", "in": "header", "name": headerAPIKey}
+			schemes["apiKeyBearer"] = object{"type": "http", "scheme": "bearer"}
+			security = append(security, object{"apiKey": []string{}}, object{"apiKeyBearer": []string{}})
+		}
+	}
+	if len(security) > 0 {
+		for path, item := range paths {
+			if strings.HasPrefix(path, adminPathPrefix) || path == openAPIPath || path == "/metrics" {
+				continue
+			}
+			for _, op := range item.(object) {
+				op.(object)["security"] = security
+			}
+		}
+	}
+	if len(schemes) > 0 {
+		components["securitySchemes"] = schemes
+	}
+
+	return object{
+		"openapi": "3.1.0",
+		"info": object{
+			"title":       "tumiki-mcp-http",
+			"description": "HTTP adapter for stdio MCP servers. Header names are case-insensitive; mapped headers are passed to the server process as env vars or args.",
+			"version":     openAPIDocVersion,
+		},
+		"paths":                    paths,
+		"components":               components,
+		"x-tumiki-header-mappings": mappings,
+	}
+}
+
+// headerMappingDocs は設定済みのヘッダーマッピングをヘッダー名の順に返します。
+func (s *Server) headerMappingDocs() []headerMappingDoc {
+	docs := make(map[string]*headerMappingDoc)
+	get := func(header string) *headerMappingDoc {
+		header = http.CanonicalHeaderKey(header)
+		if d, ok := docs[header]; ok {
+			return d
+		}
+		d := &headerMappingDoc{Header: header}
+		docs[header] = d
+		return d
+	}
+
+	defs := s.defs()
+	for header, env := range defs.headerEnvMapping {
+		get(header).Env = env
+	}
+	for header, arg := range defs.headerArgMapping {
+		get(header).Arg = &arg
+	}
+	for header, target := range s.argOverrides {
+		get(header).Override = target
+	}
+	for header, flag := range s.argRemovals {
+		get(header).Remove = flag
+	}
+	for _, rule := range s.cfg.MappingRules {
+		d := get(rule.Header)
+		d.Conditional = true
+		if rule.Arg == nil && d.Env == "" {
+			d.Env = rule.Env
+		} else if rule.Arg != nil && d.Arg == nil {
+			d.Arg = rule.Arg
+		}
+	}
+	for header, decoding := range s.cfg.HeaderDecoding {
+		if d, ok := docs[http.CanonicalHeaderKey(header)]; ok {
+			d.Decoding = decoding
+		}
+	}
+
+	result := make([]headerMappingDoc, 0, len(docs))
+	for _, header := range slices.Sorted(maps.Keys(docs)) {
+		result = append(result, *docs[header])
+	}
+	return result
+}
+
+// description はヘッダーマッピングの説明文を返します。
+func (m headerMappingDoc) description() string {
+	desc := "Mapped header"
+	switch {
+	case m.Env != "":
+		desc = "Passed to the process as env var " + m.Env
+	case m.Arg != nil && *m.Arg == "":
+		desc = "Passed to the process as a positional argument"
+	case m.Arg != nil:
+		desc = "Passed to the process as argument " + *m.Arg
+	case m.Override != "":
+		desc = "Replaces the static argument " + m.Override
+	case m.Remove != "":
+		desc = "Removes the static flag " + m.Remove + " when true"
+	}
+	if m.Conditional {
+		desc += " (only when the mapping rule conditions match)"
+	}
+	if m.Decoding != "" {
+		desc += "; " + m.Decoding + "-encoded"
+	}
+	return desc
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mapping"
+)
+
+func TestHandleOpenAPI(t *testing.T) {
+	positional := ""
+	server, err := NewServer(&Config{
+		Command:          "cat",
+		HeaderEnvMapping: map[string]string{"x-slack-token": "SLACK_TOKEN"},
+		HeaderArgMapping: map[string]string{"X-Data-Dir": ""},
+		HeaderDecoding:   map[string]string{"X-Slack-Token": HeaderDecodingBase64},
+		MappingRules:     mapping.Rules{{Header: "X-Debug", Arg: &positional}},
+		LongPoll:         true,
+		AdminToken:       "secret",
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	req := httptest.NewRequest("GET", openAPIPath, nil)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	var doc struct {
+		OpenAPI    string                     `json:"openapi"`
+		Paths      map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Parameters map[string]struct {
+				Name        string `json:"name"`
+				In          string `json:"in"`
+				Description string `json:"description"`
+			} `json:"parameters"`
+		} `json:"components"`
+		Mappings []headerMappingDoc `json:"x-tumiki-header-mappings"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("openapi = %q, want 3.1.0", doc.OpenAPI)
+	}
+	for _, path := range []string{"/mcp", pollPath, openAPIPath, "/admin/backends", "/admin/backends/{version}"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("paths missing %s", path)
+		}
+	}
+	for _, path := range []string{"/metrics", blobPathPrefix + "{id}", stagedFilesPath, downloadPathPrefix + "{id}", "/admin/cluster"} {
+		if _, ok := doc.Paths[path]; ok {
+			t.Errorf("paths include disabled endpoint %s", path)
+		}
+	}
+
+	token := doc.Components.Parameters["X-Slack-Token"]
+	if token.Name != "X-Slack-Token" || token.In != "header" || token.Description != "Passed to the process as env var SLACK_TOKEN; base64-encoded" {
+		t.Errorf("X-Slack-Token parameter = %+v", token)
+	}
+	if got := doc.Components.Parameters["X-Debug"].Description; got != "Passed to the process as a positional argument (only when the mapping rule conditions match)" {
+		t.Errorf("X-Debug description = %q", got)
+	}
+
+	var headers []string
+	for _, m := range doc.Mappings {
+		headers = append(headers, m.Header)
+	}
+	if want := []string{"X-Data-Dir", "X-Debug", "X-Slack-Token"}; !slices.Equal(headers, want) {
+		t.Errorf("x-tumiki-header-mappings headers = %v, want %v", headers, want)
+	}
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+)
+
+// セッションの中のリクエストをプロセスに送る順序
+const (
+	SessionOrderingParallel = "parallel" // レスポンスを待たずに届いた順に送る
+	SessionOrderingStrict   = "strict"   // 前のリクエストのレスポンスを受け取ってから、届いた順に1つずつ送る
+)
+
+// ValidateSessionOrdering はセッションの中のリクエストの順序として指定された値を検証します。空文字列は SessionOrderingParallel を表します。
+func ValidateSessionOrdering(mode string) error {
+	switch mode {
+	case "", SessionOrderingParallel, SessionOrderingStrict:
+		return nil
+	default:
+		return fmt.Errorf("unknown session ordering %q (supported: %s, %s)", mode, SessionOrderingParallel, SessionOrderingStrict)
+	}
+}
+
+// newSessionTurn は strict の場合にセッションのリクエストの順番を表すチャネルを作成します。parallel の場合は nil を返します。
+// チャネルの送信を待つゴルーチンは待ち始めた順に送信するため、リクエストは届いた順に送られます。
+func newSessionTurn(mode string) chan struct{} {
+	if mode != SessionOrderingStrict {
+		return nil
+	}
+	return make(chan struct{}, 1)
+}
+
+// waitTurn は strict のセッションで前のリクエストのレスポンスを待ち、順番を取得します。
+// 返した関数でレスポンスを受け取った後に順番を解放します。parallel のセッションではすぐに戻ります。
+func (sub *subscription) waitTurn(ctx context.Context) (func(), error) {
+	if sub.turn == nil {
+		return func() {}, nil
+	}
+	select {
+	case sub.turn <- struct{}{}:
+		return func() { <-sub.turn }, nil
+	case <-sub.done:
+		return nil, errSubscriptionClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
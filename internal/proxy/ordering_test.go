@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidateSessionOrdering(t *testing.T) {
+	for _, mode := range []string{SessionOrderingParallel, SessionOrderingStrict} {
+		if err := ValidateSessionOrdering(mode); err != nil {
+			t.Errorf("ValidateSessionOrdering(%q) error = %v", mode, err)
+		}
+	}
+	if err := ValidateSessionOrdering("serial"); err == nil {
+		t.Error("ValidateSessionOrdering(serial) expected error but got none")
+	}
+}
+
+func TestWaitTurn_Parallel_待たない(t *testing.T) {
+	sub := &subscription{turn: newSessionTurn(SessionOrderingParallel), done: make(chan struct{})}
+	for range 3 {
+		if _, err := sub.waitTurn(context.Background()); err != nil {
+			t.Fatalf("waitTurn() error = %v", err)
+		}
+	}
+}
+
+func TestWaitTurn_Strict_届いた順に1つずつ(t *testing.T) {
+	sub := &subscription{turn: newSessionTurn(SessionOrderingStrict), done: make(chan struct{})}
+	release, err := sub.waitTurn(context.Background())
+	if err != nil {
+		t.Fatalf("waitTurn() error = %v", err)
+	}
+
+	// 前のリクエストが終わるまで待つ。待ち始めた順に順番を取得する
+	order := make(chan int, 3)
+	for i := range 3 {
+		go func() {
+			next, err := sub.waitTurn(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- i
+			next()
+		}()
+		time.Sleep(20 * time.Millisecond)
+	}
+	select {
+	case i := <-order:
+		t.Fatalf("request %d was sent before the previous response", i)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	for want := range 3 {
+		select {
+		case got := <-order:
+			if got != want {
+				t.Errorf("turn %d went to request %d", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("waitTurn() did not return after release")
+		}
+	}
+}
+
+func TestWaitTurn_Strict_中断(t *testing.T) {
+	sub := &subscription{turn: newSessionTurn(SessionOrderingStrict), done: make(chan struct{})}
+	if _, err := sub.waitTurn(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := sub.waitTurn(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waitTurn() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(sub.done)
+	if _, err := sub.waitTurn(context.Background()); !errors.Is(err, errSubscriptionClosed) {
+		t.Errorf("waitTurn() after exit error = %v, want %v", err, errSubscriptionClosed)
+	}
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// maxPartialErrorData は切れたメッセージのエラーに含める、途中までの出力と stderr のそれぞれの最大バイト数です。
+const maxPartialErrorData = 4096
+
+// partialOutputData はプロセスが途中で切れたメッセージを出力した場合に、JSON-RPC のエラーの data で返す内容です。
+type partialOutputData struct {
+	Partial     string `json:"partialOutput"` // 読み取れた途中までの出力（先頭から最大 maxPartialErrorData バイト）
+	PartialSize int    `json:"partialSize"`   // 途中までの出力の元の大きさ
+	Stderr      string `json:"stderr"`        // プロセスの stderr（末尾から最大 maxPartialErrorData バイト）
+}
+
+// partialOutput は err がプロセスの切れたメッセージを表す場合に、ログとメトリクスに記録して true を返します。
+func (s *Server) partialOutput(ctx context.Context, err error) (*process.PartialMessageError, bool) {
+	var partial *process.PartialMessageError
+	if !errors.As(err, &partial) {
+		return nil, false
+	}
+	s.partialMessages.Inc()
+	if o, ok := ctx.Value(observationKey{}).(*observation); ok {
+		o.partialOutput = true
+	}
+	s.logger.Error("Process exited after writing a partial message",
+		"size", len(partial.Partial),
+		"partial", string(headBytes(partial.Partial, maxPartialErrorData)),
+		"stderr", partial.Stderr)
+	return partial, true
+}
+
+// partialOutputResponse は err がプロセスの切れたメッセージを表す場合に、途中までの出力と stderr を data に含めた
+// リクエストへの JSON-RPC のエラーレスポンスを返します。リクエストが ID を持たない場合はレスポンスを返しません。
+func (s *Server) partialOutputResponse(ctx context.Context, body []byte, err error) ([]byte, bool) {
+	partial, ok := s.partialOutput(ctx, err)
+	if !ok {
+		return nil, false
+	}
+	msg, err := jsonrpc.Parse(body)
+	if err != nil || !msg.IsRequest() {
+		return nil, false
+	}
+	data, _ := json.Marshal(partialOutputData{
+		Partial:     string(headBytes(partial.Partial, maxPartialErrorData)),
+		PartialSize: len(partial.Partial),
+		Stderr:      string(tailBytes([]byte(partial.Stderr), maxPartialErrorData)),
+	})
+	return jsonrpc.NewErrorResponseWithData(msg.ID, jsonrpc.CodeInternalError,
+		"process exited after writing a partial message", data), true
+}
+
+func headBytes(b []byte, n int) []byte {
+	if len(b) <= n {
+		return b
+	}
+	return b[:n]
+}
+
+func tailBytes(b []byte, n int) []byte {
+	if len(b) <= n {
+		return b
+	}
+	return b[len(b)-n:]
+}
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+)
+
+func TestHandleMCP_PartialOutput(t *testing.T) {
+	script := `read line; echo 'fatal: out of memory' >&2; printf '{"jsonrpc":"2.0","id":1,"result":{"con'`
+	server, err := NewServer(&Config{Command: "sh", Args: []string{"-c", script}, Metrics: true}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		accept string
+	}{
+		{name: "JSON_エラーレスポンス", accept: contentTypeJSON},
+		{name: "SSE_エラーのイベント", accept: contentTypeSSE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postMCP(server, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"dump"}}`, http.Header{"Accept": {tt.accept}})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			body := strings.TrimPrefix(strings.TrimSpace(w.Body.String()), "event: message\ndata: ")
+			msg, err := jsonrpc.Parse([]byte(body))
+			if err != nil || msg.Error == nil {
+				t.Fatalf("response = %s, want a JSON-RPC error", w.Body.String())
+			}
+			var data partialOutputData
+			if err := json.Unmarshal(msg.Error.Data, &data); err != nil {
+				t.Fatal(err)
+			}
+			if data.Partial != `{"jsonrpc":"2.0","id":1,"result":{"con` || !strings.Contains(data.Stderr, "out of memory") {
+				t.Errorf("data = %+v, want the partial output and stderr", data)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`tumiki_partial_messages_total 2`,
+		`tumiki_requests_total{transport="http",method="tools/call",result="partial_output"} 2`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
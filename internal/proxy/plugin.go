@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/plugin"
+)
+
+// pluginAuth はプラグインの tumiki_authenticate でリクエストを認証します。
+// プラグインの呼び出しに失敗した場合は拒否します。
+func (s *Server) pluginAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, err := s.authenticate(r.Context(), r.Method, r.URL.Path, r.Header)
+		if err != nil {
+			s.logger.Error("Plugin authentication failed", "error", err)
+			http.Error(w, "Authentication failed", http.StatusInternalServerError)
+			return
+		}
+		if !result.Allow {
+			status := result.Status
+			if status == 0 {
+				status = http.StatusUnauthorized
+			}
+			message := result.Message
+			if message == "" {
+				message = http.StatusText(status)
+			}
+			http.Error(w, message, status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate は全てのプラグインで認証し、最初に拒否したプラグインの結果を返します。
+func (s *Server) authenticate(ctx context.Context, method, path string, header http.Header) (plugin.AuthResult, error) {
+	req := plugin.AuthRequest{Method: method, Path: path, Headers: header}
+	for _, p := range s.cfg.Plugins {
+		result, err := p.Authenticate(ctx, req)
+		if err != nil {
+			return plugin.AuthResult{}, err
+		}
+		if !result.Allow {
+			return result, nil
+		}
+	}
+	return plugin.AuthResult{Allow: true}, nil
+}
+
+// mapPluginHeaders はプラグインの tumiki_map_headers でヘッダーを変更します。
+// 変更後のヘッダーにヘッダーマッピングが適用されます。
+func (s *Server) mapPluginHeaders(ctx context.Context, header http.Header, path string) (http.Header, error) {
+	for _, p := range s.cfg.Plugins {
+		if !p.Has(plugin.HookMapHeaders) {
+			continue
+		}
+		changes, err := p.MapHeaders(ctx, plugin.HeaderRequest{Path: path, Headers: header})
+		if err != nil {
+			s.logger.Error("Plugin header mapping failed", "plugin", p.Name(), "error", err)
+			return nil, errRequestRewrite
+		}
+		header = changes.Apply(header)
+	}
+	return header, nil
+}
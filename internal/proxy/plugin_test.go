@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/plugin"
+)
+
+// loadExamplePlugin は internal/plugin のテスト用プラグインをビルドして読み込みます。
+func loadExamplePlugin(t *testing.T) *plugin.Plugin {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "example.wasm")
+	cmd := exec.Command(filepath.Join(runtime.GOROOT(), "bin", "go"), "build", "-buildmode=c-shared", "-o", path, ".")
+	cmd.Dir = filepath.Join("..", "plugin", "testdata", "example")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("build example plugin: %v\n%s", err, out)
+	}
+
+	p, err := plugin.Load(context.Background(), path)
+	if err != nil {
+		t.Fatalf("plugin.Load() error = %v", err)
+	}
+	t.Cleanup(func() { _ = p.Close(context.Background()) })
+	return p
+}
+
+func TestHandler_Plugin(t *testing.T) {
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", `read line; printf '{"tenant":"%s","token":"%s","request":%s}\n' "$TENANT" "$TOKEN" "$line"`, "sh"},
+		DefaultEnv:       map[string]string{},
+		HeaderEnvMapping: map[string]string{"X-Tenant": "TENANT", "Authorization": "TOKEN"},
+		Plugins:          []*plugin.Plugin{loadExamplePlugin(t)},
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "プラグインが許可_ヘッダーとリクエストを書き換えて渡す",
+			token:      "Bearer good",
+			body:       `{"jsonrpc":"2.0","id":1,"method":"hello"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"tenant":"acme","token":"","request":{"jsonrpc":"2.0","id":1,"method":"ping"}}`,
+		},
+		{
+			name:       "プラグインが拒否_プラグインのステータスを返す",
+			token:      "Bearer bad",
+			body:       `{"jsonrpc":"2.0","id":1,"method":"hello"}`,
+			wantStatus: http.StatusForbidden,
+			wantBody:   "forbidden by plugin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/mcp", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", tt.token)
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d (body: %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.wantBody {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,360 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/webhook"
+)
+
+// ロングポーリングの設定
+const (
+	DefaultPollSessionTTL = 5 * time.Minute  // 最後のアクセスからセッションを破棄するまでのデフォルト期間
+	PollWait              = 25 * time.Second // GET /mcp/poll がメッセージを待つ最大時間（WriteTimeout より短くする）
+)
+
+// pollPath はロングポーリングのエンドポイントです。
+const pollPath = "/mcp/poll"
+
+// headerSessionID はロングポーリングのセッションを識別するヘッダーです。
+const headerSessionID = "Mcp-Session-Id"
+
+// pollSession はロングポーリングで使用する1つの stdio プロセスです。
+type pollSession struct {
+	session         *process.Session
+	methods         *pendingMethods
+	protocolVersion string
+	version         string // プロセスを起動したバックエンドのバージョン
+	usage           *usageMeter
+	meta            webhook.Session // Webhook のイベントに含めるメタデータ
+
+	// 同時に複数の GET が届いてもメッセージの順序が入れ替わらないようにする
+	receiveMu sync.Mutex
+
+	mu       sync.Mutex
+	lastSeen time.Time
+}
+
+// pollSessions は SSE を使えないクライアント向けに、
+// POST で受け取ったメッセージをプロセスに送り、出力を GET で返すためのセッションを管理します。
+type pollSessions struct {
+	server *Server
+	ttl    time.Duration
+	wait   time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*pollSession
+}
+
+func newPollSessions(server *Server, ttl time.Duration) *pollSessions {
+	if ttl <= 0 {
+		ttl = DefaultPollSessionTTL
+	}
+	return &pollSessions{
+		server:   server,
+		ttl:      ttl,
+		wait:     PollWait,
+		now:      time.Now,
+		sessions: make(map[string]*pollSession),
+	}
+}
+
+// create は新しいプロセスを起動してセッションとして登録し、その ID を返します。
+// プロセスはリクエストより長く生存するため、リクエストのコンテキストとは切り離して起動します。
+// セッションストアが設定されている場合は、他のレプリカから転送されるよう所有者として記録します。
+func (p *pollSessions) create(header http.Header, protocolVersion string) (string, *pollSession, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("generate session id: %w", err)
+	}
+	id := hex.EncodeToString(buf)
+
+	executor, version := p.server.newVersionedExecutor(header)
+	session, err := executor.Start(context.Background())
+	if err != nil {
+		return "", nil, err
+	}
+	go p.server.keepAlive(session)
+
+	ps := &pollSession{
+		session:         session,
+		methods:         &pendingMethods{},
+		protocolVersion: protocolVersion,
+		version:         version,
+		usage:           p.server.newUsageMeter(header, version),
+		meta:            sessionMetadata(id, sessionTransportLongPoll, protocolVersion, version, header, p.now()),
+		lastSeen:        p.now(),
+	}
+
+	p.mu.Lock()
+	p.sessions[id] = ps
+	p.mu.Unlock()
+
+	p.server.publishSession(id, protocolVersion, p.ttl)
+	p.server.notifySession(webhook.EventSessionCreated, ps.meta, "", nil)
+	return id, ps, nil
+}
+
+// get はセッションを取得し、最終アクセス時刻とセッションストアの有効期限を更新します。
+func (p *pollSessions) get(id string) (*pollSession, bool) {
+	p.evictExpired()
+
+	p.mu.Lock()
+	ps, ok := p.sessions[id]
+	p.mu.Unlock()
+	if ok {
+		ps.touch(p.now())
+		p.server.publishSession(id, ps.protocolVersion, p.ttl)
+	}
+	return ps, ok
+}
+
+// remove はセッションを登録解除してプロセスを終了させます。
+// セッションが登録されていた場合は、プロセスの失敗として err とともに Webhook に通知します。
+func (p *pollSessions) remove(id string, err error) {
+	p.mu.Lock()
+	ps, ok := p.sessions[id]
+	delete(p.sessions, id)
+	p.mu.Unlock()
+	if ok {
+		p.server.unpublishSession(id)
+		p.closeSession(ps)
+		p.server.notifySession(webhook.EventSessionError, ps.meta, "", err)
+	}
+}
+
+func (p *pollSessions) evictExpired() {
+	p.mu.Lock()
+	now := p.now()
+	expired := make(map[string]*pollSession)
+	for id, ps := range p.sessions {
+		if now.Sub(ps.lastAccess()) > p.ttl {
+			expired[id] = ps
+			delete(p.sessions, id)
+		}
+	}
+	p.mu.Unlock()
+
+	// Close はプロセスの終了を待つためロックの外で行う
+	for id, ps := range expired {
+		go func() {
+			p.server.unpublishSession(id)
+			p.closeSession(ps)
+			p.server.notifySession(webhook.EventSessionExpired, ps.meta, "", nil)
+		}()
+	}
+}
+
+// countByVersion はバックエンドのバージョンごとのセッション数を返します。
+func (p *pollSessions) countByVersion() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	counts := make(map[string]int)
+	for _, ps := range p.sessions {
+		counts[ps.version]++
+	}
+	return counts
+}
+
+func (p *pollSessions) closeSession(ps *pollSession) {
+	if err := ps.session.Close(); err != nil {
+		p.server.logger.Debug("Failed to close poll session", "error", err)
+	}
+}
+
+// close は全てのセッションのプロセスを終了させます。
+func (p *pollSessions) close() {
+	p.mu.Lock()
+	sessions := p.sessions
+	p.sessions = make(map[string]*pollSession)
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for id, ps := range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.server.unpublishSession(id)
+			p.server.drain.sessionClosed(ps.session, ps.session.Close())
+			p.server.notifySession(webhook.EventSessionTerminated, ps.meta, webhook.ReasonShutdown, nil)
+		}()
+	}
+	wg.Wait()
+}
+
+func (ps *pollSession) touch(now time.Time) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.lastSeen = now
+}
+
+func (ps *pollSession) lastAccess() time.Time {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.lastSeen
+}
+
+// receive は最初のメッセージを ctx が終了するまで待ち、その時点で読み取り済みのメッセージをまとめて返します。
+// プロセスの出力が終了しており返すメッセージもない場合は io.EOF を返します。
+func (ps *pollSession) receive(ctx context.Context) ([][]byte, error) {
+	ps.receiveMu.Lock()
+	defer ps.receiveMu.Unlock()
+
+	msg, err := ps.session.Receive(ctx)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	messages := [][]byte{msg}
+	for {
+		msg, err := ps.session.TryReceive()
+		if msg == nil || err != nil {
+			// 出力終了は次のポーリングで通知する
+			return messages, nil
+		}
+		messages = append(messages, msg)
+	}
+}
+
+// handlePost は POST /mcp/poll を処理します。
+// Mcp-Session-Id ヘッダーがない場合は新しいセッションを作成し、レスポンスヘッダーで ID を返します。
+// 別のレプリカが所有するセッションの場合はそのレプリカへ転送します。
+// レスポンスは GET /mcp/poll で受け取るため、ここでは 202 Accepted のみを返します。
+func (p *pollSessions) handlePost(w http.ResponseWriter, r *http.Request) {
+	if !isJSONContentType(r.Header.Get("Content-Type")) {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	id := r.Header.Get(headerSessionID)
+	var ps *pollSession
+	if id != "" {
+		var ok bool
+		if ps, ok = p.get(id); !ok {
+			// 転送する場合はボディを読まずにそのまま渡す
+			if !p.server.forwardToOwner(w, r, id) {
+				http.Error(w, "Session not found", http.StatusNotFound)
+			}
+			return
+		}
+		if !sessionOwnedBy(ps.meta, r.Header) {
+			http.Error(w, "Session belongs to another client", http.StatusForbidden)
+			return
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	body, err = p.server.prepareRequest(r.Context(), body)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	if ps == nil {
+		header, err := p.server.requestHeaders(r.Context(), r.Header, r.URL.Path)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		id, ps, err = p.create(header, initializeProtocolVersion(body))
+		if err != nil {
+			p.server.logger.Error("Process start failed", "error", err)
+			http.Error(w, "Process start failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	ps.methods.add(body)
+	ps.usage.request(body)
+	if err := ps.session.Send(body); err != nil {
+		p.server.logger.Error("Process write failed", "error", err)
+		p.remove(id, err)
+		http.Error(w, "Process write failed", http.StatusGone)
+		return
+	}
+
+	w.Header().Set(headerSessionID, id)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleGet は GET /mcp/poll を処理します。
+// 最大 PollWait だけメッセージを待ち、届いたメッセージを JSON 配列で返します（なければ空配列）。
+// プロセスが終了して全てのメッセージを返し終えたセッションには 410 Gone を返します。
+// 別のレプリカが所有するセッションの場合はそのレプリカへ転送します。
+func (p *pollSessions) handleGet(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(headerSessionID)
+	ps, ok := p.get(id)
+	if !ok {
+		if id == "" || !p.server.forwardToOwner(w, r, id) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+		}
+		return
+	}
+	if !sessionOwnedBy(ps.meta, r.Header) {
+		http.Error(w, "Session belongs to another client", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), p.wait)
+	defer cancel()
+
+	messages, err := ps.receive(ctx)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		if !errors.Is(err, io.EOF) {
+			p.server.logger.Error("Process read failed", "error", err)
+		}
+		p.remove(id, err)
+		http.Error(w, "Session closed", http.StatusGone)
+		return
+	}
+
+	batch := make([]json.RawMessage, 0, len(messages))
+	for _, msg := range messages {
+		if p.server.isKeepAliveResponse(msg) {
+			continue
+		}
+		call := ps.methods.take(msg)
+		msg, err := p.server.processResponse(p.server.offloadContext(r.Context(), r.Header), msg, call.method)
+		if err != nil {
+			p.server.logger.Error("Response processing failed", "error", err)
+			http.Error(w, "Response processing failed", http.StatusInternalServerError)
+			return
+		}
+		ps.usage.response(call, msg)
+		batch = append(batch, msg)
+	}
+
+	response, err := json.Marshal(batch)
+	if err != nil {
+		p.server.logger.Error("Response processing failed", "error", err)
+		http.Error(w, "Response processing failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(response); err != nil {
+		p.server.logger.Debug("Failed to write response", "error", err)
+	}
+}
@@ -0,0 +1,253 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mcptest"
+)
+
+// newPollServer はロングポーリングを有効にした Server を作成します。
+func newPollServer(t *testing.T, command string, args []string, env map[string]string) *Server {
+	t.Helper()
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	server, err := NewServer(&Config{
+		Command:          command,
+		Args:             args,
+		DefaultEnv:       env,
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+		LongPoll:         true,
+	}, logger)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	server.polls.wait = 500 * time.Millisecond
+	t.Cleanup(server.polls.close)
+	return server
+}
+
+func pollPost(t *testing.T, server *Server, sessionID, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", pollPath, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if sessionID != "" {
+		req.Header.Set(headerSessionID, sessionID)
+	}
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func pollGet(t *testing.T, server *Server, sessionID string) (int, []json.RawMessage) {
+	t.Helper()
+	req := httptest.NewRequest("GET", pollPath, nil)
+	req.Header.Set(headerSessionID, sessionID)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	var messages []json.RawMessage
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &messages); err != nil {
+			t.Fatalf("response is not a JSON array: %s", w.Body.String())
+		}
+	}
+	return w.Code, messages
+}
+
+func TestLongPoll(t *testing.T) {
+	command, args, env := mcptest.Command(mcptest.ModeCompliant)
+	server := newPollServer(t, command, args, env)
+
+	// 最初の POST でセッションが作成される
+	w := pollPost(t, server, "", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("POST status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+	id := w.Header().Get(headerSessionID)
+	if id == "" {
+		t.Fatal("POST should return a session id")
+	}
+
+	// 同じセッションに続けて送信できる
+	w = pollPost(t, server, id, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`)
+	if w.Code != http.StatusAccepted || w.Header().Get(headerSessionID) != id {
+		t.Fatalf("POST status = %d, session = %q", w.Code, w.Header().Get(headerSessionID))
+	}
+
+	// 通知を含む全メッセージが順番に届くまでポーリングする
+	var got []string
+	deadline := time.Now().Add(5 * time.Second)
+	for len(got) < 3 && time.Now().Before(deadline) {
+		code, messages := pollGet(t, server, id)
+		if code != http.StatusOK {
+			t.Fatalf("GET status = %d, want %d", code, http.StatusOK)
+		}
+		for _, msg := range messages {
+			got = append(got, string(msg))
+		}
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("received %d messages, want 3: %v", len(got), got)
+	}
+	if !strings.Contains(got[0], `"id":1`) {
+		t.Errorf("first message should be the initialize response: %s", got[0])
+	}
+	if !strings.Contains(got[1], `"notifications/message"`) {
+		t.Errorf("second message should be the notification: %s", got[1])
+	}
+	if !strings.Contains(got[2], `"text":"hi"`) {
+		t.Errorf("third message should be the tools/call response: %s", got[2])
+	}
+
+	// メッセージがない場合は待機後に空配列を返す
+	code, messages := pollGet(t, server, id)
+	if code != http.StatusOK || len(messages) != 0 {
+		t.Errorf("GET = %d, %v, want 200 and empty array", code, messages)
+	}
+}
+
+func TestLongPoll_SessionGone(t *testing.T) {
+	server := newPollServer(t, "sh", []string{"-c", `read line; echo '{"jsonrpc":"2.0","id":1,"result":{}}'`}, map[string]string{})
+
+	w := pollPost(t, server, "", `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("POST status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+	id := w.Header().Get(headerSessionID)
+
+	// 出力済みのメッセージを返した後、終了したセッションには 410 を返す
+	code, messages := pollGet(t, server, id)
+	if code != http.StatusOK || len(messages) != 1 {
+		t.Fatalf("GET = %d, %v, want one message", code, messages)
+	}
+	if code, _ := pollGet(t, server, id); code != http.StatusGone {
+		t.Errorf("GET status = %d, want %d", code, http.StatusGone)
+	}
+
+	// 410 を返したセッションは削除される
+	if code, _ := pollGet(t, server, id); code != http.StatusNotFound {
+		t.Errorf("GET status = %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestLongPoll_Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		command   string
+		method    string
+		sessionID string
+		want      int
+	}{
+		{name: "POST_存在しないセッション_404", command: "cat", method: "POST", sessionID: "unknown", want: http.StatusNotFound},
+		{name: "GET_存在しないセッション_404", command: "cat", method: "GET", sessionID: "unknown", want: http.StatusNotFound},
+		{name: "POST_プロセス起動失敗_500", command: "/nonexistent/command", method: "POST", want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newPollServer(t, tt.command, []string{}, map[string]string{})
+
+			var code int
+			if tt.method == "POST" {
+				code = pollPost(t, server, tt.sessionID, `{"jsonrpc":"2.0","id":1,"method":"ping"}`).Code
+			} else {
+				code, _ = pollGet(t, server, tt.sessionID)
+			}
+			if code != tt.want {
+				t.Errorf("status = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestLongPoll_OtherAPIKey(t *testing.T) {
+	server := newPollServer(t, "cat", []string{}, map[string]string{})
+
+	// 認証を設定していないため、API キーの ID はクライアントが送ったものを使う
+	req := httptest.NewRequest("POST", pollPath, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(headerAPIKeyID, "key1")
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	id := w.Header().Get(headerSessionID)
+	if w.Code != http.StatusAccepted || id == "" {
+		t.Fatalf("POST status = %d (session %q), want %d and a session id", w.Code, id, http.StatusAccepted)
+	}
+
+	// 別の API キーのリクエストには、セッションへの送信も受信も許可しない
+	if w := pollPost(t, server, id, `{"jsonrpc":"2.0","id":2,"method":"ping"}`); w.Code != http.StatusForbidden {
+		t.Errorf("POST status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if code, _ := pollGet(t, server, id); code != http.StatusForbidden {
+		t.Errorf("GET status = %d, want %d", code, http.StatusForbidden)
+	}
+}
+
+func TestLongPoll_UnsupportedContentType(t *testing.T) {
+	server := newPollServer(t, "cat", []string{}, map[string]string{})
+
+	req := httptest.NewRequest("POST", pollPath, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	req.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnsupportedMediaType)
+	}
+}
+
+func TestPollSessions_EvictExpired(t *testing.T) {
+	server := newPollServer(t, "cat", []string{}, map[string]string{})
+
+	now := time.Now()
+	server.polls.now = func() time.Time { return now }
+
+	id, _, err := server.polls.create(http.Header{}, "")
+	if err != nil {
+		t.Fatalf("create() error = %v", err)
+	}
+
+	// アクセスがあれば TTL は延長される
+	now = now.Add(DefaultPollSessionTTL - time.Second)
+	if _, ok := server.polls.get(id); !ok {
+		t.Fatal("session should still exist")
+	}
+	now = now.Add(DefaultPollSessionTTL - time.Second)
+	if _, ok := server.polls.get(id); !ok {
+		t.Fatal("session should be extended by the last access")
+	}
+
+	now = now.Add(DefaultPollSessionTTL + time.Second)
+	if _, ok := server.polls.get(id); ok {
+		t.Error("session should be evicted after TTL")
+	}
+}
+
+func TestPollSessions_Close(t *testing.T) {
+	server := newPollServer(t, "cat", []string{}, map[string]string{})
+
+	_, ps, err := server.polls.create(http.Header{}, "")
+	if err != nil {
+		t.Fatalf("create() error = %v", err)
+	}
+
+	server.polls.close()
+
+	select {
+	case <-ps.session.Exited():
+	case <-time.After(5 * time.Second):
+		t.Fatal("process should exit after close")
+	}
+	if len(server.polls.sessions) != 0 {
+		t.Errorf("sessions = %d, want 0", len(server.polls.sessions))
+	}
+}
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// rateLimit はクライアントごとのリクエスト数を制限するミドルウェアです。
+// クライアントは RateLimitKeyHeader のヘッダー値（未設定または値がない場合は接続元 IP）で識別します。
+// カウンタの保存先に接続できない場合は、可用性を優先してリクエストを許可します。
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision, err := s.cfg.RateLimiter.Allow(r.Context(), s.rateLimitKey(r))
+		if err != nil {
+			s.logger.Warn("Rate limiter unavailable", "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(decision.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		if !decision.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitKey はリクエストのクライアントを識別するキーを返します。
+func (s *Server) rateLimitKey(r *http.Request) string {
+	if s.cfg.RateLimitKeyHeader != "" {
+		if v := r.Header.Get(s.cfg.RateLimitKeyHeader); v != "" {
+			return "header:" + v
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
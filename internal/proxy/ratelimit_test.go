@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mcptest"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/ratelimit"
+)
+
+// failingLimiter は常にエラーを返す Limiter です。
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string) (ratelimit.Decision, error) {
+	return ratelimit.Decision{}, errors.New("limiter unavailable")
+}
+
+func (failingLimiter) Close() error {
+	return nil
+}
+
+func newRateLimitedServer(t *testing.T, limiter ratelimit.Limiter, keyHeader string) *Server {
+	t.Helper()
+	command, args, env := mcptest.Command(mcptest.ModeCompliant)
+	server, err := NewServer(&Config{
+		Command:            command,
+		Args:               args,
+		DefaultEnv:         env,
+		HeaderEnvMapping:   map[string]string{},
+		HeaderArgMapping:   map[string]string{},
+		RateLimiter:        limiter,
+		RateLimitKeyHeader: keyHeader,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	return server
+}
+
+func rateLimitedPost(server *Server, remoteAddr, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = remoteAddr
+	if apiKey != "" {
+		req.Header.Set("X-Api-Key", apiKey)
+	}
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit(t *testing.T) {
+	server := newRateLimitedServer(t, ratelimit.NewMemory(1, time.Minute), "")
+
+	w := rateLimitedPost(server, "192.0.2.1:1000", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("first request status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w.Header().Get("X-RateLimit-Limit") != "1" || w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("rate limit headers = %v", w.Header())
+	}
+
+	// 同じ IP は別のポートからでも同じクライアントとして数える
+	w = rateLimitedPost(server, "192.0.2.1:2000", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter == "" || retryAfter == "0" {
+		t.Errorf("Retry-After = %q, want positive seconds", retryAfter)
+	}
+
+	if w := rateLimitedPost(server, "192.0.2.2:1000", ""); w.Code != http.StatusOK {
+		t.Errorf("other client status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimit_KeyHeader(t *testing.T) {
+	server := newRateLimitedServer(t, ratelimit.NewMemory(1, time.Minute), "X-Api-Key")
+
+	if w := rateLimitedPost(server, "192.0.2.1:1000", "key-a"); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	// ヘッダーで識別する場合は同じ IP でもキーごとに数える
+	if w := rateLimitedPost(server, "192.0.2.1:1000", "key-b"); w.Code != http.StatusOK {
+		t.Errorf("other key status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := rateLimitedPost(server, "192.0.2.1:1000", "key-a"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("same key status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimit_LimiterUnavailable(t *testing.T) {
+	server := newRateLimitedServer(t, failingLimiter{}, "")
+
+	// 保存先に接続できない場合はリクエストを許可する
+	if w := rateLimitedPost(server, "192.0.2.1:1000", ""); w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		keyHeader  string
+		header     string
+		remoteAddr string
+		expected   string
+	}{
+		{name: "ヘッダー指定あり_ヘッダー値", keyHeader: "X-Api-Key", header: "abc", remoteAddr: "192.0.2.1:1000", expected: "header:abc"},
+		{name: "ヘッダー値なし_接続元IP", keyHeader: "X-Api-Key", remoteAddr: "192.0.2.1:1000", expected: "ip:192.0.2.1"},
+		{name: "ポートなしのアドレス_そのまま", remoteAddr: "192.0.2.1", expected: "ip:192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{cfg: &Config{RateLimitKeyHeader: tt.keyHeader}}
+			req := httptest.NewRequest("GET", "/mcp", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.header != "" {
+				req.Header.Set("X-Api-Key", tt.header)
+			}
+			if got := s.rateLimitKey(req); got != tt.expected {
+				t.Errorf("rateLimitKey() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultRegistryInterval はレジストリにハートビートを送るデフォルトの間隔です。
+const DefaultRegistryInterval = 30 * time.Second
+
+// registryTTLRounds はこの回数の間隔の間ハートビートが届かない場合に、レジストリが登録を破棄してよいことを表す回数です。
+const registryTTLRounds = 3
+
+// レジストリに送る登録の状態
+const (
+	registryStatusUp   = "up"   // 起動中でリクエストを受け付ける
+	registryStatusDown = "down" // 停止したため一覧から外す
+)
+
+// RegistryConfig はエンドポイントを登録する MCP レジストリ（カタログ）の設定です。
+type RegistryConfig struct {
+	URL      string        // 登録とハートビートを POST する URL
+	Token    string        // Authorization: Bearer で送るトークン（空で送らない）
+	Interval time.Duration // ハートビートの間隔（0 でデフォルト）
+}
+
+// registryRecord はレジストリに送るこのアダプターの登録内容です。
+// 同じ ID で送り直すたびに登録を更新し、ttlSeconds を過ぎても更新がなければレジストリが破棄できます。
+type registryRecord struct {
+	ID          string            `json:"id"`  // 登録を識別する AdvertiseURL
+	URL         string            `json:"url"` // クライアントが接続するベース URL
+	Status      string            `json:"status"`
+	StartedAt   time.Time         `json:"startedAt"`
+	HeartbeatAt time.Time         `json:"heartbeatAt"`
+	TTLSeconds  int               `json:"ttlSeconds"`
+	Server      discoveryDocument `json:"server"` // 公開しているサーバー・トランスポート・認証の要件
+}
+
+// registrar は起動時に MCP レジストリにエンドポイントを登録し、間隔ごとにハートビートで登録を更新します。
+// 停止時には status を down にした登録を送ります。送信に失敗しても次の間隔で送り直します。
+type registrar struct {
+	server    *Server
+	cfg       RegistryConfig
+	self      string
+	client    *http.Client
+	now       func() time.Time
+	startedAt time.Time
+
+	registered bool // 最後の送信で登録できた
+	failing    bool // 最後の送信に失敗した
+}
+
+// newRegistrar は設定を検証し、self を自身のベース URL とする registrar を作成します。
+func newRegistrar(s *Server, cfg RegistryConfig, self string) (*registrar, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid registry URL %q", cfg.URL)
+	}
+	if self == "" {
+		return nil, fmt.Errorf("advertise URL is required when a registry is configured")
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultRegistryInterval
+	}
+	return &registrar{
+		server: s,
+		cfg:    cfg,
+		self:   self,
+		client: &http.Client{Timeout: min(cfg.Interval, 10*time.Second)},
+		now:    time.Now,
+	}, nil
+}
+
+// run は登録を送り、ctx が終了するまで間隔ごとにハートビートを送ります。終了時には停止を知らせます。
+func (r *registrar) run(ctx context.Context) {
+	r.startedAt = r.now()
+	r.beat(ctx, registryStatusUp)
+
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			finalCtx, cancel := context.WithTimeout(context.Background(), r.client.Timeout)
+			defer cancel()
+			r.beat(finalCtx, registryStatusDown)
+			return
+		case <-ticker.C:
+			r.beat(ctx, registryStatusUp)
+		}
+	}
+}
+
+// beat は現在の設定から登録内容を作成して送ります。ハートビートごとにログが出ないよう、成否が変わった時だけ出力します。
+func (r *registrar) beat(ctx context.Context, status string) {
+	err := r.post(ctx, r.record(status))
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return
+	case err != nil:
+		if !r.failing {
+			r.server.logger.Warn("Failed to register with MCP registry", "registry", r.cfg.URL, "error", err)
+		}
+		r.failing, r.registered = true, false
+	case status == registryStatusDown:
+		r.server.logger.Info("Deregistered from MCP registry", "registry", r.cfg.URL)
+	default:
+		if !r.registered {
+			r.server.logger.Info("Registered with MCP registry", "registry", r.cfg.URL, "url", r.self)
+		}
+		r.failing, r.registered = false, true
+	}
+}
+
+// record はレジストリに送る登録内容を作成します。設定の再読み込みで変わった名前付きのサーバーも反映します。
+func (r *registrar) record(status string) registryRecord {
+	return registryRecord{
+		ID:          r.self,
+		URL:         r.self,
+		Status:      status,
+		StartedAt:   r.startedAt,
+		HeartbeatAt: r.now(),
+		TTLSeconds:  int(math.Ceil((r.cfg.Interval * registryTTLRounds).Seconds())),
+		Server:      r.server.discoveryDocument(),
+	}
+}
+
+// post は登録内容を1回送ります。
+func (r *registrar) post(ctx context.Context, record registryRecord) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	if r.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.cfg.Token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("registry returned %s", resp.Status)
+	}
+	return nil
+}
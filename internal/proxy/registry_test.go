@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRegistry は受け取った登録内容を記録するレジストリです。
+type fakeRegistry struct {
+	mu      sync.Mutex
+	records []registryRecord
+	auth    []string
+	status  int
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var record registryRecord
+	if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records = append(f.records, record)
+	f.auth = append(f.auth, r.Header.Get("Authorization"))
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+	}
+}
+
+func (f *fakeRegistry) snapshot() ([]registryRecord, []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]registryRecord(nil), f.records...), append([]string(nil), f.auth...)
+}
+
+func TestRegistrar_RegisterHeartbeatDeregister(t *testing.T) {
+	registry := &fakeRegistry{}
+	ts := httptest.NewServer(registry)
+	defer ts.Close()
+
+	server, err := NewServer(&Config{
+		Command:      "cat",
+		AdvertiseURL: "https://mcp.example.com",
+		Servers:      map[string]ServerDefinition{"github": {Command: "cat"}},
+		ServerCard:   ServerCard{Name: "files"},
+		Registry:     &RegistryConfig{URL: ts.URL, Token: "secret", Interval: 20 * time.Millisecond},
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.registrar.run(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if records, _ := registry.snapshot(); len(records) >= 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	records, auth := registry.snapshot()
+	if len(records) < 4 {
+		t.Fatalf("registry received %d records, want registration, heartbeats and deregistration", len(records))
+	}
+	first, last := records[0], records[len(records)-1]
+	if first.ID != "https://mcp.example.com" || first.URL != "https://mcp.example.com" || first.Status != registryStatusUp {
+		t.Errorf("first record = %+v", first)
+	}
+	if first.Server.Name != "files" || len(first.Server.Servers) != 2 || first.Server.Servers[1].Endpoint != "/servers/github/mcp" {
+		t.Errorf("first record server = %+v", first.Server)
+	}
+	if first.TTLSeconds != 1 {
+		t.Errorf("ttlSeconds = %d", first.TTLSeconds)
+	}
+	if last.Status != registryStatusDown || !last.StartedAt.Equal(first.StartedAt) {
+		t.Errorf("last record = %+v, want status %q", last, registryStatusDown)
+	}
+	if !records[1].HeartbeatAt.After(first.HeartbeatAt) {
+		t.Errorf("heartbeatAt did not advance: %v -> %v", first.HeartbeatAt, records[1].HeartbeatAt)
+	}
+	for _, got := range auth {
+		if got != "Bearer secret" {
+			t.Errorf("Authorization = %q, want %q", got, "Bearer secret")
+		}
+	}
+}
+
+func TestRegistrar_Reload_反映される(t *testing.T) {
+	registry := &fakeRegistry{}
+	ts := httptest.NewServer(registry)
+	defer ts.Close()
+
+	server, err := NewServer(&Config{
+		Command:      "cat",
+		AdvertiseURL: "https://mcp.example.com",
+		Registry:     &RegistryConfig{URL: ts.URL},
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	if _, err := server.Reload(&Config{Servers: map[string]ServerDefinition{"slack": {Command: "cat"}}}); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	server.registrar.beat(context.Background(), registryStatusUp)
+	records, auth := registry.snapshot()
+	if len(records) != 1 || len(records[0].Server.Servers) != 2 || records[0].Server.Servers[1].Name != "slack" {
+		t.Fatalf("records = %+v, want the reloaded server", records)
+	}
+	if records[0].TTLSeconds != int(DefaultRegistryInterval.Seconds())*registryTTLRounds {
+		t.Errorf("ttlSeconds = %d", records[0].TTLSeconds)
+	}
+	if auth[0] != "" {
+		t.Errorf("Authorization = %q, want none", auth[0])
+	}
+}
+
+func TestRegistrar_失敗_次の間隔で送り直す(t *testing.T) {
+	registry := &fakeRegistry{status: http.StatusServiceUnavailable}
+	ts := httptest.NewServer(registry)
+	defer ts.Close()
+
+	server, err := NewServer(&Config{
+		Command:      "cat",
+		AdvertiseURL: "https://mcp.example.com",
+		Registry:     &RegistryConfig{URL: ts.URL},
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	r := server.registrar
+
+	r.beat(context.Background(), registryStatusUp)
+	if !r.failing || r.registered {
+		t.Errorf("after failure failing = %v, registered = %v", r.failing, r.registered)
+	}
+	registry.mu.Lock()
+	registry.status = 0
+	registry.mu.Unlock()
+	r.beat(context.Background(), registryStatusUp)
+	if r.failing || !r.registered {
+		t.Errorf("after recovery failing = %v, registered = %v", r.failing, r.registered)
+	}
+}
+
+func TestNewServer_RegistryRequirements(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "AdvertiseURLなし_エラー", cfg: Config{Command: "cat", Registry: &RegistryConfig{URL: "https://registry.example.com"}}},
+		{name: "不正なURL_エラー", cfg: Config{Command: "cat", AdvertiseURL: "https://mcp.example.com", Registry: &RegistryConfig{URL: "registry"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewServer(&tt.cfg, slog.New(slog.NewTextHandler(io.Discard, nil))); err == nil {
+				t.Error("NewServer() error = nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// relay がプロセス側の失敗を表すエラー。詳細はログに出力し、クライアントにはこれらのみを返す。
+var (
+	errProcessStart    = errors.New("process start failed")
+	errProcessFailed   = errors.New("process execution failed")
+	errProcessRead     = errors.New("process read failed")
+	errProcessWrite    = errors.New("process write failed")
+	errRequestRewrite  = errors.New("request rewrite failed")
+	errResponseProcess = errors.New("response processing failed")
+)
+
+// relay は接続の間1つの stdio プロセスを起動し続け、
+// recv で受け取ったメッセージを stdin に、stdout に出力されたメッセージを send に中継します。
+// recv が io.EOF を返すと stdin を閉じ、プロセスの出力がすべて届いた時点で nil を返します。
+// recv が返すスライスは次の recv 呼び出しまでしか使用しません。
+func (s *Server) relay(ctx context.Context, header http.Header, recv func() ([]byte, error), send func(msg []byte) error) error {
+	if s.isFollower() {
+		return errNotLeader
+	}
+
+	ctx, cancel := context.WithCancelCause(s.offloadContext(ctx, header))
+	defer cancel(nil)
+
+	executor, version := s.newVersionedExecutor(header)
+	session, err := executor.Start(ctx)
+	if err != nil {
+		s.logger.Error("Process start failed", "error", err)
+		return errProcessStart
+	}
+	defer func() {
+		if err := session.Close(); err != nil {
+			s.logger.Debug("Failed to close session", "error", err)
+		}
+	}()
+
+	go s.keepAlive(session)
+
+	// レスポンス変換のテンプレートで使うため、リクエスト ID ごとのメソッド名を覚えておく
+	methods := &pendingMethods{}
+	meter := s.newUsageMeter(header, version)
+
+	go func() {
+		if err := s.forward(ctx, session, methods, meter, recv); err != nil {
+			cancel(err)
+		}
+	}()
+
+	for {
+		msg, err := session.Receive(ctx)
+		if errors.Is(err, io.EOF) {
+			<-session.Exited()
+			if err := session.Err(); err != nil {
+				s.logger.Error("Process failed", "error", err, "stderr", session.Stderr())
+				return errProcessFailed
+			}
+			return nil
+		}
+		if err != nil {
+			if cause := context.Cause(ctx); cause != nil {
+				return cause
+			}
+			if _, ok := s.partialOutput(ctx, err); ok {
+				return errProcessRead
+			}
+			s.logger.Error("Process read failed", "error", err)
+			return errProcessRead
+		}
+
+		if s.isKeepAliveResponse(msg) {
+			continue
+		}
+		call := methods.take(msg)
+		msg, err = s.processResponse(ctx, msg, call.method)
+		if err != nil {
+			s.logger.Error("Response processing failed", "error", err)
+			return errResponseProcess
+		}
+		meter.response(call, msg)
+		if err := send(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// forward は recv で受け取ったメッセージを書き換えてプロセスの stdin に書き込みます。
+func (s *Server) forward(ctx context.Context, session *process.Session, methods *pendingMethods, meter *usageMeter, recv func() ([]byte, error)) error {
+	for {
+		msg, err := recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				// クライアントの送信終了をプロセスに伝える
+				if err := session.CloseInput(); err != nil {
+					s.logger.Debug("Failed to close stdin", "error", err)
+				}
+				return nil
+			}
+			return err
+		}
+
+		body, err := s.prepareRequest(ctx, msg)
+		if err != nil {
+			return err
+		}
+		methods.add(body)
+		meter.request(body)
+
+		if err := session.Send(body); err != nil {
+			s.logger.Error("Process write failed", "error", err)
+			return errProcessWrite
+		}
+	}
+}
+
+// isRelayError は relay がプロセス側の失敗または不正なペイロードとして返したエラーかどうかを返します。
+func isRelayError(err error) bool {
+	for _, target := range []error{errProcessStart, errProcessFailed, errProcessRead, errProcessWrite, errRequestRewrite, errResponseProcess, errInvalidRequest, errNotLeader} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingMethods は応答待ちのリクエスト ID と呼び出しの対応を保持します。
+type pendingMethods struct {
+	m sync.Map
+}
+
+// add はリクエストであればその ID と呼び出しを記録します。
+func (p *pendingMethods) add(body []byte) {
+	msg, err := jsonrpc.Parse(body)
+	if err != nil || !msg.IsRequest() {
+		return
+	}
+	p.m.Store(string(bytes.TrimSpace(msg.ID)), callOf(msg))
+}
+
+// take はレスポンスに対応するリクエストの呼び出しを返し、記録を削除します。
+// 対応するリクエストがない場合はゼロ値を返します。
+func (p *pendingMethods) take(body []byte) rpcCall {
+	msg, err := jsonrpc.Parse(body)
+	if err != nil || !msg.IsResponse() {
+		return rpcCall{}
+	}
+	call, ok := p.m.LoadAndDelete(string(bytes.TrimSpace(msg.ID)))
+	if !ok {
+		return rpcCall{}
+	}
+	return call.(rpcCall)
+}
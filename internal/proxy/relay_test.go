@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestPendingMethods(t *testing.T) {
+	var p pendingMethods
+	p.add([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	p.add([]byte(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"search","arguments":{}}}`))
+	p.add([]byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+
+	tests := []struct {
+		name string
+		body string
+		want rpcCall
+	}{
+		{name: "対応するレスポンス_メソッド名を返す", body: `{"jsonrpc":"2.0","id":1,"result":{}}`, want: rpcCall{method: "tools/list"}},
+		{name: "ツール呼び出しのレスポンス_ツール名も返す", body: `{"jsonrpc":"2.0","id":2,"result":{}}`, want: rpcCall{method: "tools/call", tool: "search"}},
+		{name: "取得済みのID_ゼロ値を返す", body: `{"jsonrpc":"2.0","id":1,"result":{}}`, want: rpcCall{}},
+		{name: "通知_ゼロ値を返す", body: `{"jsonrpc":"2.0","method":"notifications/message"}`, want: rpcCall{}},
+		{name: "不正なJSON_ゼロ値を返す", body: `not json`, want: rpcCall{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.take([]byte(tt.body)); got != tt.want {
+				t.Errorf("take() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRelayError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "プロセス起動失敗_true", err: errProcessStart, want: true},
+		{name: "ラップされたプロセス失敗_true", err: fmt.Errorf("relay: %w", errProcessFailed), want: true},
+		{name: "クライアント側のエラー_false", err: errors.New("connection reset"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRelayError(tt.err); got != tt.want {
+				t.Errorf("isRelayError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
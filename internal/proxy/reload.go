@@ -0,0 +1,225 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/secrets"
+)
+
+// definitions は設定の再読み込みで置き換えるサーバーの定義です。
+// 処理中のリクエストは受け付けた時点の定義のまま完了し、置き換えた後のリクエストから新しい定義を使います。
+type definitions struct {
+	defaultEnv       map[string]string
+	headerEnvMapping map[string]string
+	headerArgMapping map[string]string
+	requiredEnv      *requiredEnv            // リクエストごとに検証する必要な環境変数（nil で無効）
+	servers          map[string]*namedServer // /servers/{name}/mcp で公開する名前付きのサーバー
+}
+
+// newDefinitions は cfg のデフォルト環境変数・ヘッダーマッピング・名前付きのサーバーを検証し、定義を作成します。
+// デフォルト環境変数のシークレットの参照（例: vault:secret/data/slack#token）は refs で読み取ります。
+func newDefinitions(cfg *Config, refs *secrets.Resolver) (*definitions, error) {
+	headerEnvMapping, err := normalizeHeaderMapping(cfg.HeaderEnvMapping)
+	if err != nil {
+		return nil, fmt.Errorf("header-env mapping: %w", err)
+	}
+	headerArgMapping, err := normalizeHeaderMapping(cfg.HeaderArgMapping)
+	if err != nil {
+		return nil, fmt.Errorf("header-arg mapping: %w", err)
+	}
+	requiredEnv, err := newRequiredEnv(cfg, cfg.RequiredEnv, envSources{
+		defaultEnv:       cfg.DefaultEnv,
+		headerEnvMapping: headerEnvMapping,
+		mappingRules:     cfg.MappingRules,
+		scripts:          len(cfg.Scripts) > 0,
+		envFlag:          "--env",
+	})
+	if err != nil {
+		return nil, err
+	}
+	servers, err := newNamedServers(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := refs.Resolve(context.Background(), cfg.DefaultEnv); err != nil {
+		return nil, err
+	}
+	for name, def := range cfg.Servers {
+		if err := refs.Resolve(context.Background(), def.DefaultEnv); err != nil {
+			return nil, fmt.Errorf("server %s: %w", name, err)
+		}
+	}
+	return &definitions{
+		defaultEnv:       cfg.DefaultEnv,
+		headerEnvMapping: headerEnvMapping,
+		headerArgMapping: headerArgMapping,
+		requiredEnv:      requiredEnv,
+		servers:          servers,
+	}, nil
+}
+
+// defs は現在のサーバーの定義を返します。
+func (s *Server) defs() *definitions {
+	return s.definitions.Load()
+}
+
+// KeyChanges は名前ごとの追加・削除・変更です。それぞれ名前の順に並べます。
+type KeyChanges struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// empty は変更がないかを返します。
+func (c KeyChanges) empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+// diffKeys は before と after のキーを比べ、追加・削除・値が変わったキーを返します。
+func diffKeys[V any](before, after map[string]V, equal func(a, b V) bool) KeyChanges {
+	var c KeyChanges
+	for key, value := range after {
+		old, ok := before[key]
+		switch {
+		case !ok:
+			c.Added = append(c.Added, key)
+		case !equal(old, value):
+			c.Changed = append(c.Changed, key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			c.Removed = append(c.Removed, key)
+		}
+	}
+	slices.Sort(c.Added)
+	slices.Sort(c.Removed)
+	slices.Sort(c.Changed)
+	return c
+}
+
+// ReloadDiff は設定の再読み込みで変わった項目です。値に秘密情報を含むため、環境変数は名前だけを記録します。
+type ReloadDiff struct {
+	Env              KeyChanges `json:"env"`              // デフォルト環境変数の名前
+	HeaderEnvMapping KeyChanges `json:"headerEnvMapping"` // ヘッダー→環境変数マッピングのヘッダー名
+	HeaderArgMapping KeyChanges `json:"headerArgMapping"` // ヘッダー→引数マッピングのヘッダー名
+	Servers          KeyChanges `json:"servers"`          // 名前付きのサーバー名（コマンド・引数・環境変数・マッピングのいずれかが変わったものは Changed）
+}
+
+// diffDefinitions は before から after への変更を返します。
+func diffDefinitions(before, after *definitions) ReloadDiff {
+	return ReloadDiff{
+		Env:              diffKeys(before.defaultEnv, after.defaultEnv, stringsEqual),
+		HeaderEnvMapping: diffKeys(before.headerEnvMapping, after.headerEnvMapping, stringsEqual),
+		HeaderArgMapping: diffKeys(before.headerArgMapping, after.headerArgMapping, stringsEqual),
+		Servers:          diffKeys(before.servers, after.servers, (*namedServer).equal),
+	}
+}
+
+func stringsEqual(a, b string) bool {
+	return a == b
+}
+
+// Empty は変更がないかを返します。
+func (d ReloadDiff) Empty() bool {
+	return !d.defaultChanged() && d.Servers.empty()
+}
+
+// defaultChanged は /mcp のバックエンドの定義（デフォルト環境変数・ヘッダーマッピング）が変わったかを返します。
+func (d ReloadDiff) defaultChanged() bool {
+	return !d.Env.empty() || !d.HeaderEnvMapping.empty() || !d.HeaderArgMapping.empty()
+}
+
+// logAttrs は変更があった項目をログの属性として返します。
+func (d ReloadDiff) logAttrs() []any {
+	var attrs []any
+	for _, item := range []struct {
+		name    string
+		changes KeyChanges
+	}{
+		{"env", d.Env},
+		{"headerEnv", d.HeaderEnvMapping},
+		{"headerArg", d.HeaderArgMapping},
+		{"servers", d.Servers},
+	} {
+		if !item.changes.empty() {
+			attrs = append(attrs, item.name, item.changes)
+		}
+	}
+	return attrs
+}
+
+// Reload は cfg の DefaultEnv・HeaderEnvMapping・HeaderArgMapping・Servers で、サーバーの定義を置き換え、変わった項目を返します。
+// その他の項目は無視します。HTTP サーバーはそのままで、処理中のリクエストは元の定義で完了します。
+// 予備プロセス・再利用しているプロセス・共有プロセスは、定義が変わったバックエンドのものだけを終了させて新しい定義で起動し直し、
+// 変わっていないバックエンドのプロセスはそのまま使い続けます。セッションのプロセスは元の定義のまま終了を待ちます。
+// 検証に失敗した場合はエラーを返し、元の定義を使い続けます。
+func (s *Server) Reload(cfg *Config) (ReloadDiff, error) {
+	next := *s.cfg
+	next.DefaultEnv = cfg.DefaultEnv
+	next.HeaderEnvMapping = cfg.HeaderEnvMapping
+	next.HeaderArgMapping = cfg.HeaderArgMapping
+	next.Servers = cfg.Servers
+	if next.SharedProcess {
+		if err := validateSharedProcess(&next); err != nil {
+			return ReloadDiff{}, err
+		}
+	}
+	defs, err := newDefinitions(&next, s.secretRefs)
+	if err != nil {
+		return ReloadDiff{}, err
+	}
+
+	diff := diffDefinitions(s.definitions.Swap(defs), defs)
+	if s.signer != nil {
+		s.signer.setRequired(s.signedHeaderNames())
+	}
+	restarted := s.restartBackends(diff)
+	// 追加・変更した名前付きのサーバーのパッケージは最初のリクエストより前に取得する
+	var added []Backend
+	for _, name := range append(diff.Servers.Added, diff.Servers.Changed...) {
+		added = append(added, *defs.servers[name].backend)
+	}
+	s.prefetchLaunchers(context.Background(), added)
+	if diff.Empty() {
+		s.logger.Info("Reloaded server definitions without changes")
+		return diff, nil
+	}
+	attrs := append(diff.logAttrs(), "restarted", restarted)
+	s.logger.Info("Reloaded server definitions", attrs...)
+	return diff, nil
+}
+
+// restartBackends は定義が変わったバックエンドの予備プロセス・再利用しているプロセス・共有プロセスを終了させ、
+// 終了させたバックエンドのバージョン（名前付きのサーバーではサーバー名）を返します。
+// /mcp の定義は全てのバージョンに適用するため、/mcp の定義が変わった場合は登録済みの全てのバージョンが対象です。
+func (s *Server) restartBackends(diff ReloadDiff) []string {
+	var versions []string
+	if diff.defaultChanged() {
+		_, _, list := s.backends.snapshot()
+		for _, backend := range list {
+			versions = append(versions, backend.Version)
+		}
+	}
+	// 削除したサーバーのプロセスも終了させる
+	versions = append(versions, diff.Servers.Removed...)
+	versions = append(versions, diff.Servers.Changed...)
+	if len(versions) == 0 {
+		return nil
+	}
+
+	if s.standby != nil {
+		s.standby.drainVersions(versions)
+	}
+	if s.reuse != nil {
+		for _, version := range versions {
+			s.reuse.DrainLabel(version)
+		}
+	}
+	if s.shared != nil && diff.defaultChanged() {
+		s.shared.Drain()
+	}
+	return versions
+}
@@ -0,0 +1,272 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// postPing は path に ping を送り、ステータスコードとボディを返します。
+func postPing(t *testing.T, server *Server, path string, headers map[string]string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	return w.Code, w.Body.String()
+}
+
+func TestReload(t *testing.T) {
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", echoEnvScript, "sh"},
+		DefaultEnv:       map[string]string{"NAME": "before"},
+		HeaderEnvMapping: map[string]string{"X-Token": "TOKEN"},
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	handler := server.Handler()
+
+	headers := map[string]string{"X-Token": "a", "X-Api-Token": "b"}
+	if _, body := postPing(t, server, "/mcp", headers); !strings.Contains(body, `"result":"before:a:"`) {
+		t.Fatalf("before reload body = %s", body)
+	}
+	if code, _ := postPing(t, server, "/servers/github/mcp", nil); code != http.StatusNotFound {
+		t.Fatalf("before reload /servers/github/mcp status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	_, err = server.Reload(&Config{
+		DefaultEnv:       map[string]string{"NAME": "after"},
+		HeaderEnvMapping: map[string]string{"x-api-token": "TOKEN"},
+		Servers: map[string]ServerDefinition{
+			"github": {Command: "sh", Args: []string{"-c", echoEnvScript, "sh"}, DefaultEnv: map[string]string{"NAME": "github"}},
+		},
+		// 再読み込みで変更できない項目は無視する
+		Command: "ignored",
+	})
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	// 同じハンドラー（HTTP サーバー）のまま新しい定義を使う
+	if server.Handler() != handler {
+		t.Error("Reload() replaced the handler")
+	}
+	if _, body := postPing(t, server, "/mcp", headers); !strings.Contains(body, `"result":"after:b:"`) {
+		t.Errorf("after reload body = %s, want the new env and mapping", body)
+	}
+	if code, body := postPing(t, server, "/servers/github/mcp", nil); code != http.StatusOK || !strings.Contains(body, `"result":"github::"`) {
+		t.Errorf("after reload /servers/github/mcp = %d %s, want the added server", code, body)
+	}
+	if backend := server.backends.current(); backend.Command != "sh" {
+		t.Errorf("backend command = %q, want sh", backend.Command)
+	}
+}
+
+func TestReload_Error(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    Config
+		reload  Config
+		wantErr string
+	}{
+		{
+			name:    "重複するマッピング_エラー",
+			reload:  Config{HeaderEnvMapping: map[string]string{"X-Token": "A", "x-token": "B"}},
+			wantErr: "header-env mapping",
+		},
+		{
+			name:    "不正なサーバー名_エラー",
+			reload:  Config{Servers: map[string]ServerDefinition{"GitHub": {Command: "cat"}}},
+			wantErr: "invalid server name",
+		},
+		{
+			name:    "共有プロセスと名前付きのサーバー_エラー",
+			base:    Config{SharedProcess: true},
+			reload:  Config{Servers: map[string]ServerDefinition{"github": {Command: "cat"}}},
+			wantErr: "shared process",
+		},
+		{
+			name:    "必要な環境変数がなくなる_エラー",
+			base:    Config{RequiredEnv: []string{"TUMIKI_RELOAD_TEST_TOKEN"}, DefaultEnv: map[string]string{"TUMIKI_RELOAD_TEST_TOKEN": "x"}},
+			reload:  Config{},
+			wantErr: "TUMIKI_RELOAD_TEST_TOKEN",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := tt.base
+			base.Command = "cat"
+			server, err := NewServer(&base, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+			defs := server.defs()
+			_, err = server.Reload(&tt.reload)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Reload() error = %v, want %q", err, tt.wantErr)
+			}
+			// 失敗した場合は元の定義を使い続ける
+			if server.defs() != defs {
+				t.Error("Reload() replaced the definitions on error")
+			}
+		})
+	}
+}
+
+func TestReload_Diff(t *testing.T) {
+	github := ServerDefinition{Command: "sh", Args: []string{"-c", "cat"}, DefaultEnv: map[string]string{"HOST": "github.com"}}
+	server, err := NewServer(&Config{
+		Command:          "cat",
+		DefaultEnv:       map[string]string{"A": "1", "B": "2"},
+		HeaderEnvMapping: map[string]string{"X-Token": "TOKEN"},
+		Servers:          map[string]ServerDefinition{"github": github, "slack": {Command: "cat"}},
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		reload Config
+		want   ReloadDiff
+	}{
+		{
+			name: "変更なし_空",
+			reload: Config{
+				DefaultEnv:       map[string]string{"A": "1", "B": "2"},
+				HeaderEnvMapping: map[string]string{"x-token": "TOKEN"},
+				Servers:          map[string]ServerDefinition{"github": github, "slack": {Command: "cat"}},
+			},
+		},
+		{
+			name: "追加・削除・変更_名前の順",
+			reload: Config{
+				DefaultEnv:       map[string]string{"A": "changed", "C": "3"},
+				HeaderArgMapping: map[string]string{"X-Team": "team"},
+				Servers: map[string]ServerDefinition{
+					"github": {Command: "sh", Args: []string{"-c", "cat"}, DefaultEnv: map[string]string{"HOST": "ghe.example.com"}},
+					"linear": {Command: "cat"},
+				},
+			},
+			want: ReloadDiff{
+				Env:              KeyChanges{Added: []string{"C"}, Removed: []string{"B"}, Changed: []string{"A"}},
+				HeaderEnvMapping: KeyChanges{Removed: []string{"X-Token"}},
+				HeaderArgMapping: KeyChanges{Added: []string{"X-Team"}},
+				Servers:          KeyChanges{Added: []string{"linear"}, Removed: []string{"slack"}, Changed: []string{"github"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := server.Reload(&tt.reload)
+			if err != nil {
+				t.Fatalf("Reload() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Reload() = %+v, want %+v", got, tt.want)
+			}
+			if got.Empty() != reflect.DeepEqual(tt.want, ReloadDiff{}) {
+				t.Errorf("Empty() = %v", got.Empty())
+			}
+		})
+	}
+}
+
+func TestReload_RestartsChangedBackends(t *testing.T) {
+	server := newReuseServer(t)
+	first := postForPID(t, server, "tools/list", "a")
+
+	// /mcp の定義が変わらなければ起動済みのプロセスを使い続ける
+	if _, err := server.Reload(&Config{
+		HeaderEnvMapping: map[string]string{"X-Api-Key": "API_KEY"},
+		Servers:          map[string]ServerDefinition{"github": {Command: "cat"}},
+	}); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if got := postForPID(t, server, "tools/list", "a"); got != first {
+		t.Errorf("pid = %d, want the reused process %d after adding a named server", got, first)
+	}
+
+	// /mcp の定義が変わった場合は元の定義で起動したプロセスを終了させる
+	if _, err := server.Reload(&Config{
+		DefaultEnv:       map[string]string{"LOG_LEVEL": "debug"},
+		HeaderEnvMapping: map[string]string{"X-Api-Key": "API_KEY"},
+	}); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if got := server.reuse.Stats().Processes; got != 0 {
+		t.Errorf("Processes = %d after changing the env, want 0", got)
+	}
+	if got := postForPID(t, server, "tools/list", "a"); got == first {
+		t.Errorf("pid = %d, want a new process with the new definitions", got)
+	}
+}
+
+func TestReload_SignedHeaders(t *testing.T) {
+	server, err := NewServer(&Config{
+		Command:           "cat",
+		HeaderEnvMapping:  map[string]string{"X-Token": "TOKEN"},
+		RequestSigningKey: []byte("secret"),
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	if _, err := server.Reload(&Config{HeaderEnvMapping: map[string]string{"X-Api-Token": "TOKEN"}}); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	// 新しいマッピングの元のヘッダーを署名に含める必要がある
+	if required := *server.signer.required.Load(); !slices.Equal(required, []string{"X-Api-Token"}) {
+		t.Errorf("required signed headers = %v, want [X-Api-Token]", required)
+	}
+}
+
+func TestNewServer_SecretReferences(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/secret/data/app":
+			_, _ = w.Write([]byte(`{"data":{"data":{"name":"from-vault","token":"t0ken"},"metadata":{"version":1}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", echoEnvScript, "sh"},
+		DefaultEnv:       map[string]string{"NAME": "vault:secret/data/app#name"},
+		HeaderEnvMapping: map[string]string{"X-Token": "TOKEN"},
+	}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer server.secretRefs.Close()
+
+	// ヘッダーの値の参照は読み取らない
+	if _, body := postPing(t, server, "/mcp", map[string]string{"X-Token": "vault:secret/data/app#token"}); !strings.Contains(body, `"result":"from-vault:vault:secret/data/app#token:"`) {
+		t.Errorf("body = %s, want the default env resolved and the header value unchanged", body)
+	}
+
+	// 読み取れない参照を含む再読み込みは失敗し、元の定義を使い続ける
+	if _, err := server.Reload(&Config{DefaultEnv: map[string]string{"NAME": "vault:secret/data/missing#name"}}); err == nil {
+		t.Error("Reload() with an unreadable secret expected error but got none")
+	}
+	if _, err := NewServer(&Config{Command: "cat", DefaultEnv: map[string]string{"NAME": "vault:secret/data/app#missing"}}, slog.Default()); err == nil {
+		t.Error("NewServer() with a missing secret key expected error but got none")
+	}
+}
@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mapping"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// requiredEnv はプロセスの起動に必要な環境変数のうち、リクエストによっては設定されないものを検証します。
+type requiredEnv struct {
+	names   []string            // リクエストごとに検証する環境変数
+	headers map[string][]string // 環境変数を設定するヘッダー（エラーメッセージに含める）
+	apiKeys bool                // 認証した API キーの環境変数でも設定される（エラーメッセージに含める）
+}
+
+// envSources はサーバーのプロセスに環境変数を設定する経路のうち、サーバーごとに異なるものです。
+type envSources struct {
+	defaultEnv       map[string]string
+	headerEnvMapping map[string]string
+	mappingRules     mapping.Rules
+	scripts          bool   // スクリプトが環境変数を計算する
+	envFlag          string // デフォルト環境変数を設定するオプション（エラーメッセージに含める）
+}
+
+// newRequiredEnv は names の環境変数が設定される経路を調べ、常に設定されるものを除いた requiredEnv を返します。
+// いずれの経路でも設定されない環境変数がある場合は、起動を拒否するためエラーを返します。
+// 検証するものがない場合は nil を返します。
+func newRequiredEnv(cfg *Config, names []string, sources envSources) (*requiredEnv, error) {
+	static := make(map[string]bool)
+	for k, v := range sources.defaultEnv {
+		static[k] = v != ""
+	}
+	if cfg.Secrets != nil {
+		for _, name := range cfg.Secrets.EnvNames() {
+			static[name] = true
+		}
+	}
+	if cfg.Workspace != nil {
+		name := cfg.Workspace.Env
+		if name == "" {
+			name = process.DefaultWorkspaceEnv
+		}
+		static[name] = true
+	}
+
+	// API キーの環境変数は管理 API でキーごとに変えられるため、リクエストごとに検証する
+	r := &requiredEnv{headers: make(map[string][]string), apiKeys: cfg.APIKeys != nil}
+	var missing []string
+	for _, name := range names {
+		if name == "" || strings.Contains(name, "=") {
+			return nil, fmt.Errorf("invalid required environment variable name %q", name)
+		}
+		// ホストのプロセスはアダプターの環境変数を引き継ぐ
+		if static[name] || (cfg.Runtime == "" && cfg.WASI == nil && os.Getenv(name) != "") {
+			continue
+		}
+
+		var headers []string
+		for header, env := range sources.headerEnvMapping {
+			if env == name {
+				headers = append(headers, header)
+			}
+		}
+		for _, rule := range sources.mappingRules {
+			if rule.Arg == nil && rule.Env == name {
+				headers = append(headers, http.CanonicalHeaderKey(rule.Header))
+			}
+		}
+		dynamic := sources.scripts || r.apiKeys || (cfg.FileStaging && name == envStagedFiles)
+		if len(headers) == 0 && !dynamic {
+			missing = append(missing, name)
+			continue
+		}
+		slices.Sort(headers)
+		r.names = append(r.names, name)
+		r.headers[name] = slices.Compact(headers)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("required environment variables are not set: %s (set them with %s or map them from a header)", strings.Join(missing, ", "), sources.envFlag)
+	}
+	if len(r.names) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// check はリクエストのヘッダーから計算したプロセスの環境変数に、必要なものが全て含まれているかを検証します。
+// 足りない場合は、設定するヘッダーを添えて全て列挙した errInvalidRequest を返します。
+func (r *requiredEnv) check(env map[string]string) error {
+	var missing []string
+	for _, name := range r.names {
+		if env[name] != "" {
+			continue
+		}
+		var sources []string
+		if headers := r.headers[name]; len(headers) > 0 {
+			sources = append(sources, "header "+strings.Join(headers, " or "))
+		}
+		if r.apiKeys {
+			sources = append(sources, "API key env")
+		}
+		if len(sources) > 0 {
+			name += " (" + strings.Join(sources, " or ") + ")"
+		}
+		missing = append(missing, name)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing required environment variables: %s", errInvalidRequest, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// checkRequiredEnv は header で起動するプロセスに必要な環境変数が全て設定されるかを検証します。
+// 名前付きのサーバーへのリクエストはそのサーバーの必要な環境変数を検証します。
+func (s *Server) checkRequiredEnv(header http.Header) error {
+	required := s.defs().requiredEnv
+	if server := s.namedServerFor(header); server != nil {
+		required = server.requiredEnv
+	}
+	if required == nil {
+		return nil
+	}
+	_, env, _ := s.processConfig(header)
+	return required.check(env)
+}
@@ -0,0 +1,308 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/apikey"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mapping"
+)
+
+func TestNewServer_RequiredEnv(t *testing.T) {
+	t.Setenv("TUMIKI_TEST_INHERITED", "value")
+
+	tests := []struct {
+		name      string
+		cfg       Config
+		wantErr   string
+		wantCheck bool // リクエストごとに検証する
+	}{
+		{
+			name: "デフォルト環境変数で設定_検証しない",
+			cfg:  Config{DefaultEnv: map[string]string{"TOKEN": "a"}, RequiredEnv: []string{"TOKEN"}},
+		},
+		{
+			name: "アダプターから引き継ぐ_検証しない",
+			cfg:  Config{RequiredEnv: []string{"TUMIKI_TEST_INHERITED"}},
+		},
+		{
+			name:      "ヘッダーマッピングで設定_リクエストごとに検証",
+			cfg:       Config{HeaderEnvMapping: map[string]string{"X-Token": "TOKEN"}, RequiredEnv: []string{"TOKEN"}},
+			wantCheck: true,
+		},
+		{
+			name:      "条件付きマッピングで設定_リクエストごとに検証",
+			cfg:       Config{MappingRules: mapping.Rules{{Header: "X-Token", Env: "TOKEN"}}, RequiredEnv: []string{"TOKEN"}},
+			wantCheck: true,
+		},
+		{
+			name:    "どこからも設定されない_エラー",
+			cfg:     Config{DefaultEnv: map[string]string{"TOKEN": ""}, RequiredEnv: []string{"TOKEN", "TEAM"}},
+			wantErr: "required environment variables are not set: TOKEN, TEAM",
+		},
+		{
+			name:    "コンテナではアダプターから引き継がない_エラー",
+			cfg:     Config{Runtime: "docker", RequiredEnv: []string{"TUMIKI_TEST_INHERITED"}},
+			wantErr: "TUMIKI_TEST_INHERITED",
+		},
+		{
+			name:    "不正な名前_エラー",
+			cfg:     Config{RequiredEnv: []string{"TOKEN=a"}},
+			wantErr: "invalid required environment variable name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.Command = "cat"
+			server, err := NewServer(&cfg, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewServer() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+			if got := server.defs().requiredEnv != nil; got != tt.wantCheck {
+				t.Errorf("checks per request = %v, want %v", got, tt.wantCheck)
+			}
+		})
+	}
+}
+
+func TestHandleMCP_RequiredEnv(t *testing.T) {
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", `read line; echo "$line"`},
+		DefaultEnv:       map[string]string{"REGION": "us"},
+		HeaderEnvMapping: map[string]string{"X-Token": "TOKEN", "X-Team-Id": "TEAM"},
+		RequiredEnv:      []string{"REGION", "TOKEN", "TEAM"},
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		headers   map[string]string
+		wantCode  int
+		wantInErr string
+	}{
+		{
+			name:     "全て設定_200",
+			headers:  map[string]string{"X-Token": "secret", "X-Team-Id": "T123"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:      "1つ足りない_400",
+			headers:   map[string]string{"X-Token": "secret"},
+			wantCode:  http.StatusBadRequest,
+			wantInErr: "missing required environment variables: TEAM (header X-Team-Id)",
+		},
+		{
+			name:      "全て足りない_全て列挙",
+			wantCode:  http.StatusBadRequest,
+			wantInErr: "TOKEN (header X-Token), TEAM (header X-Team-Id)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			req.Header.Set("Content-Type", "application/json")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			server.handleMCP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantInErr != "" && !strings.Contains(w.Body.String(), tt.wantInErr) {
+				t.Errorf("body = %q, want to contain %q", w.Body.String(), tt.wantInErr)
+			}
+		})
+	}
+}
+
+func TestNewServer_ServerRequiredEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		def       ServerDefinition
+		wantErr   string
+		wantCheck bool // リクエストごとに検証する
+	}{
+		{
+			name: "サーバーのデフォルト環境変数で設定_検証しない",
+			def:  ServerDefinition{DefaultEnv: map[string]string{"TOKEN": "a"}, RequiredEnv: []string{"TOKEN"}},
+		},
+		{
+			name:      "サーバーのヘッダーマッピングで設定_リクエストごとに検証",
+			def:       ServerDefinition{HeaderEnvMapping: map[string]string{"X-Github-Token": "TOKEN"}, RequiredEnv: []string{"TOKEN"}},
+			wantCheck: true,
+		},
+		{
+			name:    "/mcp のマッピングでは設定されない_エラー",
+			def:     ServerDefinition{RequiredEnv: []string{"TOKEN"}},
+			wantErr: "server github: required environment variables are not set: TOKEN (set them with --server-env",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := tt.def
+			def.Command = "cat"
+			server, err := NewServer(&Config{
+				Command:          "cat",
+				DefaultEnv:       map[string]string{"TOKEN": "default"},
+				HeaderEnvMapping: map[string]string{"X-Token": "TOKEN"},
+				Servers:          map[string]ServerDefinition{"github": def},
+			}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewServer() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+			if got := server.defs().servers["github"].requiredEnv != nil; got != tt.wantCheck {
+				t.Errorf("checks per request = %v, want %v", got, tt.wantCheck)
+			}
+		})
+	}
+}
+
+func TestHandleMCP_ServerRequiredEnv(t *testing.T) {
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", `read line; echo "$line"`},
+		HeaderEnvMapping: map[string]string{"X-Token": "TOKEN"},
+		Servers: map[string]ServerDefinition{
+			"github": {
+				Command:          "sh",
+				Args:             []string{"-c", `read line; echo "$line"`},
+				HeaderEnvMapping: map[string]string{"X-Github-Token": "GITHUB_TOKEN"},
+				RequiredEnv:      []string{"GITHUB_TOKEN"},
+			},
+		},
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		headers   map[string]string
+		wantCode  int
+		wantInErr string
+	}{
+		{
+			name:     "サーバーのヘッダーで設定_200",
+			path:     "/servers/github/mcp",
+			headers:  map[string]string{"X-Github-Token": "secret"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:      "足りない_400",
+			path:      "/servers/github/mcp",
+			headers:   map[string]string{"X-Token": "secret"},
+			wantCode:  http.StatusBadRequest,
+			wantInErr: "missing required environment variables: GITHUB_TOKEN (header X-Github-Token)",
+		},
+		{
+			name:     "/mcp はサーバーの必要な環境変数を検証しない_200",
+			path:     "/mcp",
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			req.Header.Set("Content-Type", "application/json")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantInErr != "" && !strings.Contains(w.Body.String(), tt.wantInErr) {
+				t.Errorf("body = %q, want to contain %q", w.Body.String(), tt.wantInErr)
+			}
+		})
+	}
+}
+
+func TestHandleMCP_RequiredEnvFromAPIKey(t *testing.T) {
+	store, err := apikey.Open(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatalf("apikey.Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	// API キーの環境変数でだけ設定される環境変数でも起動できる
+	server, err := NewServer(&Config{
+		Command:     "sh",
+		Args:        []string{"-c", `read line; echo "$line"`},
+		RequiredEnv: []string{"GITHUB_TOKEN"},
+		AdminToken:  testAdminToken,
+		APIKeys:     store,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	acme, _ := createKey(t, server, `{"name":"acme","env":{"GITHUB_TOKEN":"ghp_acme"}}`)
+	plain, _ := createKey(t, server, `{"name":"plain"}`)
+
+	tests := []struct {
+		name      string
+		headers   map[string]string
+		wantCode  int
+		wantInErr string
+	}{
+		{
+			name:     "キーの環境変数で設定_200",
+			headers:  map[string]string{headerAPIKey: acme},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:      "キーに環境変数がない_400",
+			headers:   map[string]string{headerAPIKey: plain},
+			wantCode:  http.StatusBadRequest,
+			wantInErr: "missing required environment variables: GITHUB_TOKEN (API key env)",
+		},
+		{
+			name:      "環境変数のないキーで内部ヘッダーを偽装_400",
+			headers:   map[string]string{headerAPIKey: plain, headerAPIKeyEnv: `{"GITHUB_TOKEN":"ghp_evil"}`},
+			wantCode:  http.StatusBadRequest,
+			wantInErr: "GITHUB_TOKEN",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := mcpRequest(server, tt.headers)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantInErr != "" && !strings.Contains(w.Body.String(), tt.wantInErr) {
+				t.Errorf("body = %q, want to contain %q", w.Body.String(), tt.wantInErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"unicode/utf8"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/metrics"
+)
+
+// レスポンスが上限を超えた場合の扱いです。
+const (
+	ResponseLimitError    = "error"    // JSON-RPC のエラーレスポンスに置き換える
+	ResponseLimitTruncate = "truncate" // ツールの結果のコンテンツを切り詰めて警告を追加する（切り詰められない場合はエラー）
+)
+
+// truncatedMetaKey は切り詰めた結果の _meta に追加するキーです。
+//
+//	{"_meta": {"io.tumiki/truncated": {"originalSize": 123, "maxSize": 100}}}
+const truncatedMetaKey = "io.tumiki/truncated"
+
+// errResponseTooLarge はレスポンスでないメッセージが上限を超えたことを表します。エラーレスポンスに置き換えられないため、処理を失敗させます。
+var errResponseTooLarge = errors.New("message exceeds max response size")
+
+// truncatedMeta は切り詰めた結果に追加するメタデータです。
+type truncatedMeta struct {
+	OriginalSize int `json:"originalSize"`
+	MaxSize      int `json:"maxSize"`
+}
+
+// responseLimiter はクライアントに返すメッセージの大きさを制限します。
+type responseLimiter struct {
+	maxBytes int
+	policy   string
+	logger   *slog.Logger
+	limited  *metrics.Counter
+}
+
+func newResponseLimiter(maxBytes int, policy string, m *metrics.Registry, logger *slog.Logger) (*responseLimiter, error) {
+	switch policy {
+	case "":
+		policy = ResponseLimitError
+	case ResponseLimitError, ResponseLimitTruncate:
+	default:
+		return nil, fmt.Errorf("unsupported response limit policy %q (supported: %s, %s)", policy, ResponseLimitError, ResponseLimitTruncate)
+	}
+	return &responseLimiter{
+		maxBytes: maxBytes,
+		policy:   policy,
+		logger:   logger,
+		limited:  m.Counter("tumiki_oversized_responses_total", "Number of process messages that exceeded the max response size by action taken.", "action"),
+	}, nil
+}
+
+// apply は上限を超えたメッセージを方針に従って置き換えます。
+// レスポンスは切り詰めるか JSON-RPC のエラーに置き換え、それ以外のメッセージは errResponseTooLarge を返します。
+func (l *responseLimiter) apply(msg []byte) ([]byte, error) {
+	if len(msg) <= l.maxBytes {
+		return msg, nil
+	}
+	parsed, err := jsonrpc.Parse(msg)
+	if err != nil || !parsed.IsResponse() {
+		l.limited.Inc(ResponseLimitError)
+		return nil, fmt.Errorf("%w: %d bytes (max %d)", errResponseTooLarge, len(msg), l.maxBytes)
+	}
+	if l.policy == ResponseLimitTruncate {
+		if truncated, ok := l.truncate(msg); ok {
+			l.limited.Inc(ResponseLimitTruncate)
+			l.log("Truncated oversized response", len(msg))
+			return truncated, nil
+		}
+	}
+	l.limited.Inc(ResponseLimitError)
+	l.log("Replaced oversized response with an error", len(msg))
+	return jsonrpc.NewErrorResponse(parsed.ID, jsonrpc.CodeInternalError,
+		fmt.Sprintf("response exceeds max size of %d bytes", l.maxBytes)), nil
+}
+
+// truncate はツールの結果の content を上限に収まるまで切り詰め、末尾に警告のテキストを、_meta に元の大きさを追加します。
+// テキストは途中で切り、収まらない残りのコンテンツは省きます。content を持たない結果や、content 以外で上限を超える場合は false を返します。
+func (l *responseLimiter) truncate(msg []byte) ([]byte, bool) {
+	var fields, result map[string]json.RawMessage
+	var content []json.RawMessage
+	if json.Unmarshal(msg, &fields) != nil || json.Unmarshal(fields["result"], &result) != nil ||
+		json.Unmarshal(result["content"], &content) != nil || len(content) == 0 {
+		return nil, false
+	}
+
+	meta := map[string]json.RawMessage{}
+	if raw, ok := result["_meta"]; ok && json.Unmarshal(raw, &meta) != nil {
+		return nil, false
+	}
+	meta[truncatedMetaKey], _ = json.Marshal(truncatedMeta{OriginalSize: len(msg), MaxSize: l.maxBytes})
+	result["_meta"], _ = json.Marshal(meta)
+
+	// MCP のコンテンツの annotations で、クライアントとモデルの両方に切り詰めたことを伝える
+	notice, _ := json.Marshal(map[string]any{
+		"type":        "text",
+		"text":        fmt.Sprintf("[Response truncated: the tool result exceeded the maximum size of %d bytes]", l.maxBytes),
+		"annotations": map[string]any{"audience": []string{"user", "assistant"}, "priority": 1},
+	})
+
+	encode := func(items []json.RawMessage) []byte {
+		result["content"], _ = json.Marshal(append(items, notice))
+		fields["result"], _ = json.Marshal(result)
+		data, _ := json.Marshal(fields)
+		return data
+	}
+
+	var kept []json.RawMessage
+	remaining := l.maxBytes - len(encode(nil))
+	for _, item := range content {
+		// 2つ目以降はカンマの分も必要になる
+		if len(item)+1 <= remaining {
+			kept = append(kept, item)
+			remaining -= len(item) + 1
+			continue
+		}
+		if text, ok := truncateTextContent(item, remaining-1); ok {
+			kept = append(kept, text)
+		}
+		break
+	}
+
+	truncated := encode(kept)
+	if len(truncated) > l.maxBytes {
+		return nil, false
+	}
+	return truncated, true
+}
+
+// truncateTextContent はテキストのコンテンツを、エンコードした大きさが maxBytes 以下になるよう UTF-8 の文字の境界で切り詰めます。
+// テキストでないか、テキストを1文字も残せない場合は false を返します。
+func truncateTextContent(item json.RawMessage, maxBytes int) (json.RawMessage, bool) {
+	var fields map[string]json.RawMessage
+	var kind, text string
+	if json.Unmarshal(item, &fields) != nil || json.Unmarshal(fields["type"], &kind) != nil || kind != "text" ||
+		json.Unmarshal(fields["text"], &text) != nil {
+		return nil, false
+	}
+
+	n := min(len(text), maxBytes)
+	for n > 0 {
+		for n < len(text) && n > 0 && !utf8.RuneStart(text[n]) {
+			n--
+		}
+		if n == 0 {
+			break
+		}
+		fields["text"], _ = json.Marshal(text[:n])
+		encoded, _ := json.Marshal(fields)
+		if len(encoded) <= maxBytes {
+			return encoded, true
+		}
+		// エスケープで大きくなった分だけ減らして再試行する
+		n -= len(encoded) - maxBytes
+	}
+	return nil, false
+}
+
+func (l *responseLimiter) log(msg string, size int) {
+	if l.logger != nil {
+		l.logger.Warn(msg, "size", size, "max_size", l.maxBytes, "policy", l.policy)
+	}
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/metrics"
+)
+
+func TestResponseLimiter_Apply(t *testing.T) {
+	long := strings.Repeat("あ", 200)
+	tests := []struct {
+		name      string
+		policy    string
+		msg       string
+		wantText  string // 切り詰めた場合の最初のコンテンツのテキストの接頭辞
+		wantItems int    // 切り詰めた場合の警告を含むコンテンツの数
+		wantError bool   // エラーレスポンスに置き換える
+		wantErr   bool   // 処理を失敗させる
+	}{
+		{name: "上限以下_そのまま", policy: ResponseLimitError, msg: `{"jsonrpc":"2.0","id":1,"result":{}}`},
+		{name: "error_エラーレスポンス", policy: ResponseLimitError, msg: `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"` + long + `"}]}}`, wantError: true},
+		{name: "truncate_テキストを切り詰め", policy: ResponseLimitTruncate, msg: `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"` + long + `"}]}}`, wantText: "あ", wantItems: 2},
+		{name: "truncate_収まらないコンテンツを省略", policy: ResponseLimitTruncate, msg: `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"ok"},{"type":"image","data":"` + strings.Repeat("A", 600) + `","mimeType":"image/png"}]}}`, wantText: "ok", wantItems: 2},
+		{name: "truncate_contentなし_エラーレスポンス", policy: ResponseLimitTruncate, msg: `{"jsonrpc":"2.0","id":1,"result":{"contents":[{"uri":"file:///a","text":"` + long + `"}]}}`, wantError: true},
+		{name: "truncate_content以外で超過_エラーレスポンス", policy: ResponseLimitTruncate, msg: `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"ok"}],"structuredContent":{"data":"` + long + `"}}}`, wantError: true},
+		{name: "通知_失敗", policy: ResponseLimitTruncate, msg: `{"jsonrpc":"2.0","method":"notifications/message","params":{"data":"` + long + `"}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, err := newResponseLimiter(500, tt.policy, metrics.NewRegistry(), slog.Default())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := limiter.apply([]byte(tt.msg))
+			if tt.wantErr {
+				if !errors.Is(err, errResponseTooLarge) {
+					t.Errorf("apply() error = %v, want errResponseTooLarge", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("apply() error = %v", err)
+			}
+			if len(got) > 500 {
+				t.Errorf("apply() = %d bytes, want <= 500", len(got))
+			}
+			msg, err := jsonrpc.Parse(got)
+			if err != nil {
+				t.Fatalf("apply() = %s, not a JSON-RPC message: %v", got, err)
+			}
+			if string(msg.ID) != "1" {
+				t.Errorf("id = %s, want 1", msg.ID)
+			}
+			if tt.wantError != (msg.Error != nil) {
+				t.Errorf("apply() = %s, wantError %v", got, tt.wantError)
+			}
+			if tt.wantItems == 0 {
+				if !tt.wantError && string(got) != tt.msg {
+					t.Errorf("apply() = %s, want unchanged", got)
+				}
+				return
+			}
+
+			var result struct {
+				Content []struct {
+					Type        string         `json:"type"`
+					Text        string         `json:"text"`
+					Annotations map[string]any `json:"annotations"`
+				} `json:"content"`
+				Meta map[string]truncatedMeta `json:"_meta"`
+			}
+			if err := json.Unmarshal(msg.Result, &result); err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Content) != tt.wantItems || !strings.HasPrefix(result.Content[0].Text, tt.wantText) {
+				t.Errorf("content = %+v, want %d items starting with %q", result.Content, tt.wantItems, tt.wantText)
+			}
+			notice := result.Content[len(result.Content)-1]
+			if !strings.Contains(notice.Text, "Response truncated") || notice.Annotations["audience"] == nil {
+				t.Errorf("last content = %+v, want an annotated truncation notice", notice)
+			}
+			if meta := result.Meta[truncatedMetaKey]; meta.OriginalSize != len(tt.msg) || meta.MaxSize != 500 {
+				t.Errorf("_meta = %+v, want originalSize %d and maxSize 500", result.Meta, len(tt.msg))
+			}
+		})
+	}
+}
+
+func TestNewServer_InvalidResponseLimitPolicy(t *testing.T) {
+	if _, err := NewServer(&Config{Command: "cat", MaxResponseBytes: 1024, ResponseLimitPolicy: "drop"}, slog.Default()); err == nil {
+		t.Error("NewServer() with an unsupported policy expected error but got none")
+	}
+}
+
+func TestHandleMCP_MaxResponseBytes(t *testing.T) {
+	script := `read line; printf '{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"%s"}]}}\n' "$(head -c 4096 /dev/zero | tr '\0' 'x')"`
+	server, err := NewServer(&Config{
+		Command:             "sh",
+		Args:                []string{"-c", script},
+		MaxResponseBytes:    1024,
+		ResponseLimitPolicy: ResponseLimitTruncate,
+	}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	w := postMCP(server, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"dump"}}`, nil)
+	if w.Body.Len() > 1024 || !strings.Contains(w.Body.String(), truncatedMetaKey) {
+		t.Errorf("response = %d bytes %s, want a truncated result within 1024 bytes", w.Body.Len(), w.Body.String())
+	}
+}
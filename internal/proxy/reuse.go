@@ -0,0 +1,17 @@
+package proxy
+
+// registerReuseMetrics は再利用しているプロセスの数とキャッシュの利用状況をメトリクスに登録します。
+func (s *Server) registerReuseMetrics() {
+	s.metrics.GaugeFunc("tumiki_process_cache_processes", "Number of running processes reused by requests with the same env/args.", func() float64 {
+		return float64(s.reuse.Stats().Processes)
+	})
+	s.metrics.CounterFunc("tumiki_process_cache_hits_total", "Number of requests run on a reused process.", func() float64 {
+		return float64(s.reuse.Stats().Hits)
+	})
+	s.metrics.CounterFunc("tumiki_process_cache_misses_total", "Number of requests that started a process to reuse.", func() float64 {
+		return float64(s.reuse.Stats().Misses)
+	})
+	s.metrics.CounterFunc("tumiki_process_cache_evictions_total", "Number of reused processes stopped after the TTL or over the max entries.", func() float64 {
+		return float64(s.reuse.Stats().Evictions)
+	})
+}
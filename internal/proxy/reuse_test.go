@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// newReuseServer はプロセスの再利用を有効にした Server を作成します。
+// プロセスはリクエストごとに、result に PID と API_KEY を入れたレスポンスを返します。
+func newReuseServer(t *testing.T) *Server {
+	t.Helper()
+	script := `while read line; do
+printf '%s\n' "$line" | sed "s/\"method\":\"[^\"]*\"/\"result\":{\"pid\":$$,\"key\":\"$API_KEY\"}/"
+done`
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", script},
+		DefaultEnv:       map[string]string{},
+		HeaderEnvMapping: map[string]string{"X-Api-Key": "API_KEY"},
+		ProcessReuse:     &process.CacheConfig{},
+		Metrics:          true,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	t.Cleanup(func() { _ = server.reuse.Close() })
+	return server
+}
+
+// postForPID は POST /mcp で method を呼び出し、応答したプロセスの PID を返します。
+func postForPID(t *testing.T, server *Server, method, key string) int {
+	t.Helper()
+	w := postMCP(server, `{"jsonrpc":"2.0","id":1,"method":"`+method+`"}`, http.Header{"X-Api-Key": {key}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body: %s)", w.Code, w.Body.String())
+	}
+	var response struct {
+		Result struct {
+			PID int    `json:"pid"`
+			Key string `json:"key"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("body = %s: %v", w.Body.String(), err)
+	}
+	if response.Result.Key != key {
+		t.Errorf("key = %q, want %q", response.Result.Key, key)
+	}
+	return response.Result.PID
+}
+
+func TestHandleMCP_ProcessReuse(t *testing.T) {
+	server := newReuseServer(t)
+
+	// 同じヘッダーのリクエストは同じプロセスで実行する
+	first := postForPID(t, server, "tools/list", "a")
+	if got := postForPID(t, server, "tools/call", "a"); got != first {
+		t.Errorf("pid = %d, want the reused process %d", got, first)
+	}
+
+	// ヘッダーから決まる環境変数が異なるリクエストは別のプロセスで実行する
+	if got := postForPID(t, server, "tools/list", "b"); got == first {
+		t.Errorf("pid = %d, want another process for a different key", got)
+	}
+
+	// initialize は再利用しているプロセスに送らない
+	if got := postForPID(t, server, "initialize", "a"); got == first {
+		t.Errorf("initialize pid = %d, want a new process", got)
+	}
+}
+
+func TestHandleMetrics_ProcessReuse(t *testing.T) {
+	server := newReuseServer(t)
+	postForPID(t, server, "tools/list", "a")
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, name := range []string{"tumiki_process_cache_processes 1", "tumiki_process_cache_hits_total 0", "tumiki_process_cache_misses_total 1", "tumiki_process_cache_evictions_total 0"} {
+		if !strings.Contains(w.Body.String(), name) {
+			t.Errorf("metrics should contain %q:\n%s", name, w.Body.String())
+		}
+	}
+}
+
+func TestNewServer_ProcessReuse(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "有効", cfg: Config{Command: "cat", ProcessReuse: &process.CacheConfig{MaxEntries: 4}}},
+		{name: "最大数が負_エラー", cfg: Config{Command: "cat", ProcessReuse: &process.CacheConfig{MaxEntries: -1}}, wantErr: true},
+		{name: "予備プロセスと併用_エラー", cfg: Config{Command: "cat", ProcessReuse: &process.CacheConfig{}, WarmStandby: &process.StandbyConfig{Min: 1, Max: 1}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewServer(&tt.cfg, slog.Default())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewServer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if server != nil && server.reuse != nil {
+				_ = server.reuse.Close()
+			}
+		})
+	}
+}
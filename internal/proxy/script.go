@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jwtauth"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/script"
+)
+
+// headerScriptResult はスクリプトが計算した環境変数・引数をプロセスの設定に渡す内部ヘッダーです。
+// クライアントが送った同名のヘッダーは受信時に削除します。
+const headerScriptResult = "X-Tumiki-Script-Result"
+
+// scriptResult はスクリプトが計算した環境変数・引数です。
+type scriptResult struct {
+	Env  map[string]string `json:"env,omitempty"`
+	Args []string          `json:"args,omitempty"`
+}
+
+// scriptDeniedError はスクリプトがリクエストを拒否したことを表します。
+type scriptDeniedError struct {
+	message string
+}
+
+func (e *scriptDeniedError) Error() string {
+	if e.message == "" {
+		return "request denied by script"
+	}
+	return e.message
+}
+
+// runScripts は全てのスクリプトを順に実行し、計算した環境変数・引数を headerScriptResult に設定したヘッダーと、
+// 追加する環境変数・引数のバイト数を返します。いずれかのスクリプトが拒否した場合は scriptDeniedError を返します。
+func (s *Server) runScripts(ctx context.Context, header http.Header, path string) (http.Header, int, error) {
+	header = header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Del(headerScriptResult)
+
+	var result scriptResult
+	req := script.Request{Path: path, Header: header, Claims: jwtauth.FromContext(ctx)}
+	for _, sc := range s.cfg.Scripts {
+		r, err := sc.Eval(ctx, req)
+		if err != nil {
+			s.logger.Error("Script failed", "script", sc.Name(), "error", err)
+			return nil, 0, errRequestRewrite
+		}
+		if !r.Allow {
+			return nil, 0, &scriptDeniedError{message: r.Message}
+		}
+		if len(r.Env) > 0 {
+			if result.Env == nil {
+				result.Env = make(map[string]string)
+			}
+			maps.Copy(result.Env, r.Env)
+		}
+		result.Args = append(result.Args, r.Args...)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, 0, err
+	}
+	header.Set(headerScriptResult, string(data))
+
+	// "NAME=value"・引数ごとの文字列と終端の NUL
+	size := 0
+	for name, value := range result.Env {
+		size += len(name) + len(value) + 2
+	}
+	for _, arg := range result.Args {
+		size += len(arg) + 1
+	}
+	return header, size, nil
+}
+
+// scriptResultFromHeader は headerScriptResult からスクリプトが計算した環境変数・引数を取り出します。
+func scriptResultFromHeader(header http.Header) scriptResult {
+	var result scriptResult
+	if value := header.Get(headerScriptResult); value != "" {
+		// runScripts が設定した値のため失敗しない
+		_ = json.Unmarshal([]byte(value), &result)
+	}
+	return result
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/script"
+)
+
+func TestHandleMCP_Scripts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hook.star")
+	src := `
+def allow(req):
+    if req.headers.get("X-Tenant") == "blocked":
+        return "tenant is blocked"
+    return True
+
+def env(req):
+    return {"TENANT": req.headers.get("X-Tenant", "default")}
+
+def args(req):
+    return ["--path", req.path]
+`
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sc, err := script.Load(path, script.Limits{})
+	if err != nil {
+		t.Fatalf("script.Load() error = %v", err)
+	}
+
+	server, err := NewServer(&Config{
+		Command:    "sh",
+		Args:       []string{"-c", `read line; printf '{"tenant":"%s","args":"%s"}\n' "$TENANT" "$*"`, "sh"},
+		DefaultEnv: map[string]string{},
+		Scripts:    []*script.Script{sc},
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "スクリプトが許可_計算した環境変数と引数を渡す",
+			headers:    map[string]string{"X-Tenant": "acme"},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"tenant":"acme","args":"--path /mcp"}`,
+		},
+		{
+			name:       "結果のヘッダーを偽装_スクリプトの結果で上書き",
+			headers:    map[string]string{headerScriptResult: `{"env":{"TENANT":"evil"}}`},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"tenant":"default","args":"--path /mcp"}`,
+		},
+		{
+			name:       "スクリプトが拒否_403とメッセージを返す",
+			headers:    map[string]string{"X-Tenant": "blocked"},
+			wantStatus: http.StatusForbidden,
+			wantBody:   "tenant is blocked",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			req.Header.Set("Content-Type", "application/json")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			server.handleMCP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d (body: %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.wantBody {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
@@ -3,14 +3,47 @@ package proxy
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"net"
 	"net/http"
 	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"google.golang.org/grpc"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/apikey"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/cache"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/egress"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/election"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/hashring"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jwtauth"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mapping"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/metrics"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mux"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/objectstore"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/plugin"
 	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/ratelimit"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/rewrite"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/sanitize"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/script"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/secrets"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/sessionstore"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/spiffe"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/tokenexchange"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/usage"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/webhook"
 )
 
 // タイムアウト設定は定数として定義
@@ -21,76 +54,743 @@ const (
 	ProcessTimeout  = 30 * time.Second
 )
 
+// レスポンスの Content-Type
+const (
+	contentTypeJSON   = "application/json"
+	contentTypeNDJSON = "application/x-ndjson"
+)
+
 // Config は プロキシサーバーの最小限の設定構造体です。
 type Config struct {
+	Host             string            // 待ち受けるホスト（空の場合は環境変数 HOST、未設定なら 0.0.0.0）
 	Port             int               // サーバーポート（必須）
+	GRPCPort         int               // gRPC サーバーポート（0 で無効）
+	TCPPort          int               // 改行区切り JSON-RPC の TCP ポート（0 で無効）
+	ReadTimeout      time.Duration     // リクエストの読み込みのタイムアウト（0 で ReadTimeout）
+	WriteTimeout     time.Duration     // レスポンスの書き込みのタイムアウト（0 で WriteTimeout）
 	Command          string            // stdio コマンド（必須）
 	Args             []string          // コマンド引数
 	DefaultEnv       map[string]string // デフォルト環境変数
+	RequiredEnv      []string          // プロセスの起動に必要な環境変数（どこからも設定されない場合は起動を、リクエストで設定されない場合はリクエストを拒否する）
 	HeaderEnvMapping map[string]string // ヘッダー→環境変数マッピング
 	HeaderArgMapping map[string]string // ヘッダー→引数マッピング
+	HeaderDecoding   map[string]string // ヘッダー→値のデコード方式（HeaderDecodingPercent / HeaderDecodingBase64 / HeaderDecodingBase64URL）
+	HeaderTemplates  map[string]string // ヘッダー→マッピングの前に値を変換するテンプレート（{{.Value}} と templatefunc の関数）
+
+	HeaderArgOverride map[string]string // ヘッダー→値を置き換える静的な引数（"-" で始まる場合はフラグの値）
+	HeaderArgRemoval  map[string]string // ヘッダー→値が真の場合に削除する静的なフラグ
+	MappingRules      mapping.Rules     // 他のヘッダー・JWT のクレーム・パスが条件を満たす場合のみ適用するマッピング
+	StripHeaders      []string          // 認証・マッピングより前に削除するリクエストヘッダー（末尾の * で前方一致）
+
+	Servers map[string]ServerDefinition // /servers/{name}/mcp で公開する名前付きのサーバー（マッピングはサーバーごとに独立）
+
+	Plugins []*plugin.Plugin // 認証・ヘッダーの変換・リクエストとレスポンスの書き換えを行う WebAssembly プラグイン（順に適用）
+	Scripts []*script.Script // リクエストの拒否と環境変数・引数の計算を行う Starlark スクリプト（順に適用）
+
+	MaxHeaderValueBytes int // マッピングするヘッダーの値1つあたりの最大バイト数（0 でデフォルト、負の値で無制限）
+	MaxInjectedBytes    int // ヘッダーから追加する環境変数・引数の合計の最大バイト数（0 でデフォルト、負の値で無制限）
+
+	Trace *process.TraceConfig // stdio フレームトレース設定（nil で無効）
+
+	MaxMessageSize      int           // stdout から読み取る1メッセージの最大バイト数（0 でデフォルト）
+	MaxResponseBytes    int           // クライアントに返す1メッセージの最大バイト数（0 で無制限）
+	ResponseLimitPolicy string        // レスポンスが上限を超えた場合の扱い（ResponseLimitError / ResponseLimitTruncate。空文字列で ResponseLimitError）
+	Compression         string        // stdio で送受信するメッセージの圧縮形式（空文字列で無効）
+	Framing             string        // stdio のメッセージの区切り方（process.FramingNewline / FramingContentLength / FramingAuto。空文字列で FramingNewline）
+	BlobThreshold       int           // このバイト数を超える base64 データをダウンロード URL に置き換える（0 で無効）
+	BlobTTL             time.Duration // オフロードしたデータの保持期間（0 でデフォルト）
+
+	MetaHeaders       map[string]string // 結果の _meta の値を返すレスポンスヘッダー（X-Mcp-* のヘッダー名 → _meta のキー）
+	ServerMetaHeaders bool              // プロセスが結果の _meta の "io.tumiki/headers" で指定した X-Mcp-* のレスポンスヘッダーも返す
+
+	DownloadThreshold int           // resources/read のコンテンツがこのバイト数を超える場合に署名付き URL に置き換える（0 で無効）
+	DownloadTTL       time.Duration // 署名付き URL の有効期間（0 でデフォルト）
+
+	Offload          objectstore.Store // 大きなペイロードを参照に置き換えて受け渡すオブジェクトストレージ（nil で無効）
+	OffloadThreshold int               // X-Mcp-Offload を送ったクライアントへのレスポンスで退避するバイト数（0 でデフォルト）
+
+	WASI             *process.WASIRuntime     // Command を WASI モジュールとして実行するランタイム（nil で OS のプロセス）
+	Runtime          string                   // Command を実行するコンテナランタイムまたは firecracker（空文字列でホストのプロセス）
+	ContainerOptions []string                 // コンテナの `run` に追加するオプション（--network=none など）
+	MicroVM          *process.MicroVMConfig   // Runtime が firecracker のバックエンドを実行する microVM（nil で無効）
+	Workspace        *process.WorkspaceConfig // プロセスごとに作成して終了後に削除する作業ディレクトリ（nil で無効）
+	Secrets          *secrets.Manager         // プロセスごとに発行し、動いている間は更新して終了後に失効させる動的シークレット（nil で無効）
+	SecretRotation   string                   // 起動し続けるプロセスの動的シークレットの期限が近づいた時の扱い（process.RotationReplace など。空文字列で何もしない）
+	SecretCacheTTL   time.Duration            // デフォルト環境変数が参照する有効期間のないシークレット（KV・AWS）を読み直す間隔（0 で設定の再読み込みまで読み直さない）
+	LauncherPrefetch bool                     // 起動時に npx・uvx・bunx・deno のバックエンドのパッケージをキャッシュに取得する
+
+	EgressProxy      bool     // プロセスをプロキシにしか接続できないネットワーク名前空間で実行し、HTTP_PROXY・HTTPS_PROXY に設定する
+	EgressProxyAllow []string // EgressProxy のプロキシが中継するホスト（"host"・"host:port"・"*.domain"）
+
+	FileStaging         bool          // ファイルをアップロードして X-Mcp-Files ヘッダーでプロセスに渡せるようにする
+	FileStagingDir      string        // アップロードしたファイルを保存するディレクトリ（空文字列でシステムの一時ディレクトリ）
+	FileStagingTTL      time.Duration // アップロードしたファイルの保持期間（0 でデフォルト）
+	FileStagingMaxBytes int64         // アップロードできるファイルの最大バイト数（0 でデフォルト）
+
+	Transport string // 受け付ける MCP のトランスポート（TransportStreamableHTTP / TransportSSE / TransportAll。空文字列で TransportStreamableHTTP）
+
+	WebSocket bool // SSE を使えないクライアント向けに GET /ws で WebSocket の全二重の接続を受け付ける
+
+	LongPoll       bool          // SSE を使えないクライアント向けのロングポーリング（/mcp/poll）を有効にする
+	PollSessionTTL time.Duration // ロングポーリングのセッションを最後のアクセスから保持する期間（0 でデフォルト）
+
+	Subscriptions     bool           // resources/subscribe を起動し続けるプロセスで受け付け、通知を GET /mcp の SSE で中継する
+	SubscriptionTTL   time.Duration  // 通知のストリームが接続していない購読のセッションを保持する期間（0 でデフォルト）
+	Sessions          bool           // initialize で起動し続けるプロセスを作成し、Mcp-Session-Id を付けた以降の POST /mcp を同じプロセスに渡す
+	SessionTTL        time.Duration  // 通知のストリームが接続していない initialize のセッションを最後のアクセスから保持する期間（0 でデフォルト）
+	SessionOrdering   string         // セッションの中のリクエストを送る順序（SessionOrderingParallel / SessionOrderingStrict。空文字列で SessionOrderingParallel）
+	SessionBudget     *SessionBudget // セッションごとの CPU 時間・リクエスト数・バイト数の上限（nil で無制限）
+	InitializeTimeout time.Duration  // セッションのプロセスの起動から initialize のレスポンスまでを待つ最大時間（0 でデフォルト）
+
+	SessionFallback *SessionFallbackConfig // セッションが繰り返し失敗したバックエンドを一時的にリクエストごとのプロセスで処理する（nil で無効、Sessions が必須）
+
+	WarmStandby      *process.StandbyConfig // 起動済みの予備プロセスで実行し、応答前に終了した場合は切り替える（nil で無効）
+	StandbyCacheSize int                    // 予備プロセスを保持する環境変数・引数の組み合わせの最大数（0 でデフォルト）
+	ProcessReuse     *process.CacheConfig   // 環境変数・引数が同じリクエストを起動し続けるプロセスで実行する（nil で無効）
+	SharedProcess    bool                   // 全てのリクエストを1つの起動し続けるプロセスで、ID を書き換えて同時に実行する
+
+	SessionWebhook *webhook.Config // セッションの作成・期限切れ・終了・失敗を Webhook に通知する（nil で無効）
+	Registry       *RegistryConfig // 起動時に MCP レジストリにエンドポイントを登録し、ハートビートを送る（nil で無効、AdvertiseURL が必須）
+	Weights        *WeightConfig   // バックエンドの失敗の割合から計算したインスタンスの重みを公開する（nil で無効、AdvertiseURL が必須）
+
+	ShutdownReportPath string // 停止時にログに出力するシャットダウンのレポートを JSON で書き込むファイル（空文字列で書き込まない）
+
+	Metrics           bool          // GET /metrics で Prometheus 形式のメトリクスを公開する
+	AccessLog         bool          // MCP のリクエストごとにメソッド・結果・処理時間をログに出力する
+	SlowToolThreshold time.Duration // これ以上かかった tools/call をツール名とともに警告ログに出力する（0 で無効）
+	RequestLabels     []string      // X-Mcp-Labels で受け付けるラベルのキー（ログ・メトリクス・利用量に付ける。nil で無効）
+	AdminToken        string        // 管理 API（/admin/）の Bearer トークン（空文字列で管理 API を無効化）
+
+	APIKeys *apikey.Store // MCP エンドポイントを保護する API キーのストア（nil で無効、HTTP のみ）
+
+	AuthMethods []string          // 順に試す認証方式（AuthMTLS・AuthJWT・AuthAPIKey、空で従来の API キー・SPIFFE の認証、HTTP のみ）
+	JWT         *jwtauth.Verifier // AuthJWT で Bearer トークンを検証する Verifier
+
+	AnonymousMethods []string // 認証情報のないクライアントが呼び出せる JSON-RPC のメソッド（例: tools/list、APIKeys か AuthMethods が必要）
+
+	SPIFFE           *spiffe.Source  // SVID で HTTP・gRPC・TCP の全てのリスナーを mTLS にする（nil で無効）
+	SPIFFEAllow      *spiffe.Matcher // MCP エンドポイントに接続できる SPIFFE ID（nil で同じトラストドメインの全て）
+	SPIFFEAdminAllow *spiffe.Matcher // 管理 API に接続できる SPIFFE ID（nil で同じトラストドメインの全て、AdminToken も必要）
+
+	RequestSigningKey []byte        // HMAC で署名したリクエストだけを受け付ける共有鍵（nil で無効、HTTP のみ）
+	SignatureMaxSkew  time.Duration // 署名した時刻と受け取った時刻の差の最大値（0 でデフォルト）
+	NonceCacheSize    int           // 再送を防ぐために覚えておく使用済みのノンスの最大数（0 でデフォルト）
+
+	TokenExchange       *tokenexchange.Client // クライアントのトークンを下流向けのトークンに交換してからマッピングする（nil で無効）
+	TokenExchangeHeader string                // 交換するトークンを含むヘッダー（空文字列で Authorization）
+
+	Usage       bool                // API キー・バックエンド・ツールごとの利用量を集計し、GET /admin/usage で公開する
+	UsageExport *usage.ExportConfig // 集計した利用量を定期的に出力する（nil で無効、指定した場合は Usage も有効になる）
+
+	Cluster        bool          // Peers とバックエンドの設定・死活を交換するクラスタモード（AdvertiseURL と AdminToken が必須）
+	GossipInterval time.Duration // クラスタ内で状態を交換する間隔（0 でデフォルト）
+
+	SessionStore sessionstore.Store // レプリカ間でセッションの所有者を共有するストア（nil で無効）
+	AdvertiseURL string             // 他のレプリカからこのレプリカに転送する際のベース URL（SessionStore 使用時は必須）
+
+	RateLimiter        ratelimit.Limiter // クライアントごとのリクエスト数の制限（nil で無効）
+	RateLimitKeyHeader string            // クライアントを識別するヘッダー（空文字列の場合は接続元 IP）
+
+	LeaderLock    election.Lock // バックエンドを1台のレプリカだけで動かすためのリーダーロック（nil で無効）
+	LeaderLockTTL time.Duration // リーダーロックの有効期限（0 でデフォルト）
+	FollowerMode  string        // リーダー以外のレプリカでのリクエストの扱い（FollowerProxy / FollowerNotReady）
+
+	Peers          []string // アフィニティで振り分ける全レプリカのベース URL（AdvertiseURL を含める）
+	AffinityHeader string   // 振り分けに使うアフィニティキーのヘッダー（空文字列で無効）
+
+	RequestPayload  sanitize.Policy // リクエストボディの UTF-8 検証・正規化
+	ResponsePayload sanitize.Policy // プロセス出力の UTF-8 検証・正規化
+
+	IdempotencyTTL time.Duration // Idempotency-Key の実行のレスポンスを再送に返す期間（0 でデフォルト、負の値で重複排除を無効化）
+
+	CacheRules      cache.Rules // メソッド・バックエンドごとにプロセスのレスポンスをキャッシュするルール（空で無効）
+	CacheMaxEntries int         // キャッシュするレスポンスの最大数（0 でデフォルト）
+
+	KeepAliveInterval time.Duration // 永続的なセッションのプロセスへのキープアライブと、SSE のキープアライブのコメントの間隔（0 で無効）
+	KeepAliveMethod   string        // プロセスに送るキープアライブのメソッド（空文字列で DefaultKeepAliveMethod）
+
+	RequestRewrites    rewrite.Rules              // リクエスト書き換えルール
+	ResponseTransforms rewrite.ResponseTransforms // レスポンス変換
+
+	HideCapabilities []string // initialize でやり取りする機能の広告から取り除く機能（例: "prompts", "resources.subscribe", "sampling"）
+
+	Discovery  bool       // GET /.well-known/mcp で公開しているサーバー・トランスポート・認証の要件を返す
+	ServerCard ServerCard // ディスカバリードキュメントに含める名前・説明・連絡先
 }
 
 // Server is an HTTP proxy server that forwards requests to stdio-based MCP servers.
 type Server struct {
-	cfg    *Config
-	logger *slog.Logger
-	server *http.Server
+	cfg           *Config
+	logger        *slog.Logger
+	server        *http.Server
+	blobs         *blobStore
+	downloads     *downloads
+	staged        *stagedFiles
+	polls         *pollSessions
+	subscriptions *subscriptions
+	legacy        *legacySessions
+	webSockets    *webSockets
+
+	metrics  *metrics.Registry
+	egress   *egress.Proxy // プロセスの接続を中継するプロキシ（EgressProxy の場合のみ）
+	observer *requestObserver
+	backends *backends
+	gossip   *gossip
+	standby  *standbyPools
+	reuse    *process.Cache
+	shared   *mux.Mux // 全てのリクエストで共有するプロセス（nil で無効）
+	election *election.Election
+	ring     *hashring.Ring
+
+	launchers *process.Launchers // npx・uvx などのランチャーのバックエンドのプロファイル（コマンドと引数ごと）
+
+	keyLimiters keyLimiters    // API キーごとのレート制限
+	signer      *requestSigner // 署名付きリクエストの検証（nil で無効）
+
+	responseLimit   *responseLimiter // クライアントに返すメッセージの大きさの制限（nil で無効）
+	metaHeaders     *metaHeaders     // 結果の _meta から設定するレスポンスヘッダー（nil で無効）
+	partialMessages *metrics.Counter // プロセスがメッセージを途中まで書き込んで終了した回数
+	capabilities    *capabilityMask  // initialize の機能の広告から取り除く機能（nil で無効）
+
+	usage         *usage.Recorder
+	usageExporter *usage.Exporter
+	sessionEvents *webhook.Notifier
+	registrar     *registrar
+	fallback      *sessionFallback
+	weights       *weightPublisher
+	cache         *responseCache
+	framings      *process.FramingCache // サーバーごとに判定した stdio の区切り方（Framing が FramingAuto の場合のみ）
+	idempotency   *idempotency
+
+	// ヘッダー名を正規化したヘッダーマッピング
+	headerDecoders map[string]headerDecoder
+	argOverrides   map[string]string
+	argRemovals    map[string]string
+	headerStripper *headerStripper // 受け取ったリクエストから削除するヘッダー（nil で無効）
+
+	definitions atomic.Pointer[definitions] // デフォルト環境変数・ヘッダーマッピング・名前付きのサーバー（Reload で置き換える）
+	secretRefs  *secrets.Resolver           // デフォルト環境変数のシークレットの参照を読み取った値
+
+	grpcServer *grpc.Server
+	grpcAddr   string
+	tcpAddr    string
+
+	drain drainStats // 停止の間の結果（シャットダウンのレポートに含める）
 }
 
 // NewServer creates a new Server with the specified configuration and logger.
 func NewServer(cfg *Config, logger *slog.Logger) (*Server, error) {
+	if cfg.SessionStore != nil && cfg.AdvertiseURL == "" {
+		return nil, fmt.Errorf("advertise URL is required when a session store is configured")
+	}
+	if cfg.LeaderLock != nil && cfg.AdvertiseURL == "" {
+		return nil, fmt.Errorf("advertise URL is required when a leader lock is configured")
+	}
+	if cfg.SessionFallback != nil && !cfg.Sessions {
+		return nil, fmt.Errorf("session fallback requires sessions")
+	}
+	if cfg.WarmStandby != nil && cfg.LeaderLock != nil {
+		// リーダー以外のレプリカでも予備プロセスが動き続けてしまうため併用できない
+		return nil, fmt.Errorf("warm standby cannot be combined with a leader lock")
+	}
+	if cfg.ProcessReuse != nil && cfg.WarmStandby != nil {
+		// 予備プロセスはリクエストごとに入れ替えるため、プロセスを使い続ける再利用とは併用できない
+		return nil, fmt.Errorf("process reuse cannot be combined with warm standby")
+	}
+	if cfg.SharedProcess {
+		if err := validateSharedProcess(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Cluster {
+		if err := validateClusterConfig(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateAuthConfig(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateAnonymousMethods(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.SessionBudget != nil {
+		if err := cfg.SessionBudget.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateRequestLabelKeys(cfg.RequestLabels); err != nil {
+		return nil, err
+	}
+	if cfg.APIKeys != nil && (cfg.GRPCPort > 0 || cfg.TCPPort > 0) {
+		// gRPC と TCP のフロントエンドは API キーを検証しないため併用できない
+		return nil, fmt.Errorf("api keys cannot be combined with the gRPC or TCP frontends")
+	}
+	if cfg.RequestSigningKey != nil && (cfg.GRPCPort > 0 || cfg.TCPPort > 0) {
+		// gRPC と TCP のフロントエンドは署名を検証しないため併用できない
+		return nil, fmt.Errorf("request signing cannot be combined with the gRPC or TCP frontends")
+	}
+	if cfg.AffinityHeader != "" && (cfg.AdvertiseURL == "" || !slices.Contains(cfg.Peers, cfg.AdvertiseURL)) {
+		return nil, fmt.Errorf("peers must include the advertise URL when affinity routing is enabled")
+	}
+	headerDecoders, err := newHeaderDecoders(cfg.HeaderDecoding)
+	if err != nil {
+		return nil, fmt.Errorf("header decoding: %w", err)
+	}
+	if err := withHeaderTemplates(headerDecoders, cfg.HeaderTemplates); err != nil {
+		return nil, fmt.Errorf("header template: %w", err)
+	}
+	argOverrides, err := normalizeHeaderMapping(cfg.HeaderArgOverride)
+	if err != nil {
+		return nil, fmt.Errorf("header-arg override: %w", err)
+	}
+	argRemovals, err := normalizeHeaderMapping(cfg.HeaderArgRemoval)
+	if err != nil {
+		return nil, fmt.Errorf("header-arg removal: %w", err)
+	}
+	if err := cfg.MappingRules.Validate(cfg.JWT != nil); err != nil {
+		return nil, err
+	}
+	secretRefs := secrets.NewResolver(cfg.SecretCacheTTL, logger)
+	defs, err := newDefinitions(cfg, secretRefs)
+	if err != nil {
+		return nil, err
+	}
+	var headerStripper *headerStripper
+	if len(cfg.StripHeaders) > 0 {
+		if headerStripper, err = newHeaderStripper(cfg.StripHeaders); err != nil {
+			return nil, fmt.Errorf("strip headers: %w", err)
+		}
+	}
+	if err := cfg.CacheRules.Validate(); err != nil {
+		return nil, err
+	}
+	if err := process.ValidateRuntime(cfg.Runtime); err != nil {
+		return nil, err
+	}
+	if cfg.MicroVM != nil {
+		if err := cfg.MicroVM.Validate(); err != nil {
+			return nil, err
+		}
+	} else if cfg.Runtime == process.RuntimeFirecracker {
+		return nil, errMicroVMNotConfigured
+	}
+
 	s := &Server{
-		cfg:    cfg,
-		logger: logger,
+		cfg:     cfg,
+		logger:  logger,
+		metrics: metrics.NewRegistry(),
+		backends: newBackends(Backend{
+			Version: DefaultBackendVersion,
+			Command: cfg.Command,
+			Args:    cfg.Args,
+			Runtime: cfg.Runtime,
+		}),
+		headerDecoders: headerDecoders,
+		argOverrides:   argOverrides,
+		argRemovals:    argRemovals,
+		headerStripper: headerStripper,
+		secretRefs:     secretRefs,
+		launchers:      process.NewLaunchers(),
+	}
+	s.definitions.Store(defs)
+
+	if cfg.Framing == process.FramingAuto {
+		s.framings = process.NewFramingCache()
+	}
+
+	// メソッド・ツールごとのメトリクスとログ
+	s.observer = newRequestObserver(s.metrics, logger, cfg.AccessLog, cfg.SlowToolThreshold)
+	s.observer.labels = newRequestLabeler(s.metrics, cfg.RequestLabels)
+	s.partialMessages = s.metrics.Counter("tumiki_partial_messages_total", "Number of times a process closed stdout after writing a partial message.")
+	s.metrics.GaugeFunc("tumiki_goroutines", "Number of goroutines in the adapter.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	s.metrics.GaugeFunc("tumiki_process_goroutines", "Number of goroutines managing stdio processes.", func() float64 {
+		return float64(process.Goroutines())
+	})
+
+	// プロセスの外部への接続の制限（有効時のみ）
+	if err := s.newEgressProxy(); err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxResponseBytes > 0 {
+		if s.responseLimit, err = newResponseLimiter(cfg.MaxResponseBytes, cfg.ResponseLimitPolicy, s.metrics, logger); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.metaHeaders, err = newMetaHeaders(cfg.MetaHeaders, cfg.ServerMetaHeaders, logger); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.HideCapabilities) > 0 {
+		if s.capabilities, err = newCapabilityMask(cfg.HideCapabilities); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ValidateTransport(cfg.Transport); err != nil {
+		return nil, err
 	}
 
 	mux := http.NewServeMux()
 
-	// MCP エンドポイント（/mcp のみ）
-	mux.HandleFunc("/mcp", s.handleMCP)
+	// MCP エンドポイント（Streamable HTTP を受け付ける場合のみ）
+	if s.servesStreamableHTTP() {
+		mux.Handle("/mcp", s.observer.observeHTTP(http.HandlerFunc(s.handleMCP)))
+	}
+
+	// 非推奨の HTTP+SSE トランスポートのエンドポイント（有効時のみ）
+	if s.servesLegacySSE() {
+		s.legacy = newLegacySessions(s)
+		mux.HandleFunc("GET "+legacySSEPath, s.legacy.handleSSE)
+		mux.Handle("POST "+legacyMessagesPath, s.observer.observeHTTP(http.HandlerFunc(s.legacy.handleMessages)))
+	}
+
+	// 設定から生成した OpenAPI ドキュメント
+	mux.HandleFunc("GET "+openAPIPath, s.handleOpenAPI)
 
-	// ホスト設定は環境変数 HOST から取得（デフォルト: 0.0.0.0）
-	host := os.Getenv("HOST")
+	// 大きなバイナリのダウンロードエンドポイント（有効時のみ）
+	if cfg.BlobThreshold > 0 {
+		blobs, err := newBlobStore(cfg.BlobThreshold, cfg.BlobTTL)
+		if err != nil {
+			return nil, err
+		}
+		s.blobs = blobs
+		mux.HandleFunc("GET "+blobPathPrefix+"{id}", blobs.handleBlob)
+	}
+
+	// resources/read のコンテンツの切り出し（有効時のみ、エンドポイントは認証の外側に登録する）
+	if cfg.DownloadThreshold > 0 {
+		downloads, err := newDownloads(cfg.DownloadThreshold, cfg.DownloadTTL)
+		if err != nil {
+			return nil, err
+		}
+		s.downloads = downloads
+	}
+
+	// ファイルのアップロードエンドポイント（有効時のみ）
+	if cfg.FileStaging {
+		staged, err := newStagedFiles(cfg.FileStagingDir, cfg.FileStagingTTL, cfg.FileStagingMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		s.staged = staged
+		mux.HandleFunc("POST "+stagedFilesPath, s.handleUploadFile)
+		mux.HandleFunc("DELETE "+stagedFilesPath+"/{id}", s.handleDeleteFile)
+	}
+
+	// WebSocket のエンドポイント（有効時のみ）
+	if cfg.WebSocket {
+		s.webSockets = newWebSockets(s)
+		mux.Handle("GET "+webSocketPath, s.webSockets)
+	}
+
+	// ロングポーリングのエンドポイント（有効時のみ）
+	if cfg.LongPoll {
+		s.polls = newPollSessions(s, cfg.PollSessionTTL)
+		mux.HandleFunc("POST "+pollPath, s.polls.handlePost)
+		mux.HandleFunc("GET "+pollPath, s.polls.handleGet)
+	}
+
+	// 購読・initialize のセッションの通知のストリームとセッションの終了（有効時のみ）
+	// 共有プロセスが有効な場合、GET /mcp は共有プロセスの通知のストリームになる
+	// 無効な場合、セッションを持たない GET /mcp と DELETE /mcp ではプロセスを起動せずに 405 を返す
+	if cfg.Subscriptions || cfg.Sessions {
+		s.subscriptions = newSubscriptions(s, cfg.SubscriptionTTL, cfg.SessionTTL)
+		if cfg.SessionFallback != nil {
+			fallback, err := newSessionFallback(*cfg.SessionFallback, s.metrics, logger)
+			if err != nil {
+				return nil, err
+			}
+			s.fallback = fallback
+		}
+		if s.servesStreamableHTTP() {
+			mux.HandleFunc("GET /mcp", s.subscriptions.handleStream)
+			mux.HandleFunc("DELETE /mcp", s.subscriptions.handleDelete)
+		}
+	} else if cfg.SharedProcess && s.servesStreamableHTTP() {
+		mux.HandleFunc("GET /mcp", s.handleSharedStream)
+		mux.HandleFunc("DELETE /mcp", handleSessionsDisabled)
+	} else if s.servesStreamableHTTP() {
+		mux.HandleFunc("GET /mcp", handleSessionsDisabled)
+		mux.HandleFunc("DELETE /mcp", handleSessionsDisabled)
+	}
+
+	// 名前付きのサーバーの MCP エンドポイント（/mcp と同じハンドラーでサーバーをパスから選ぶ）
+	// 設定の再読み込みでサーバーを追加できるよう、共有プロセス以外では設定していなくても登録する
+	if !cfg.SharedProcess && s.servesStreamableHTTP() {
+		path := serversPathPrefix + "{name}/mcp"
+		mux.Handle(path, s.routeServer(s.observer.observeHTTP(http.HandlerFunc(s.handleMCP))))
+		if s.subscriptions != nil {
+			mux.Handle("GET "+path, s.routeServer(http.HandlerFunc(s.subscriptions.handleStream)))
+			mux.Handle("DELETE "+path, s.routeServer(http.HandlerFunc(s.subscriptions.handleDelete)))
+		} else {
+			mux.HandleFunc("GET "+path, handleSessionsDisabled)
+			mux.HandleFunc("DELETE "+path, handleSessionsDisabled)
+		}
+	}
+
+	// 予備プロセスの起動（有効時のみ）
+	if cfg.WarmStandby != nil {
+		standby, err := newStandbyPools(s, *cfg.WarmStandby, cfg.StandbyCacheSize)
+		if err != nil {
+			return nil, err
+		}
+		s.standby = standby
+	}
+
+	// 起動し続けるプロセスの再利用（有効時のみ）
+	if cfg.ProcessReuse != nil {
+		reuse, err := process.NewCache(*cfg.ProcessReuse)
+		if err != nil {
+			return nil, err
+		}
+		s.reuse = reuse
+		s.registerReuseMetrics()
+	}
+
+	// 全てのリクエストで共有するプロセス（有効時のみ、最初のリクエストで起動する）
+	if cfg.SharedProcess {
+		s.newSharedProcess()
+	}
+
+	// 利用量の集計と定期的な出力（有効時のみ）
+	if cfg.Usage || cfg.UsageExport != nil {
+		s.usage = usage.NewRecorder()
+		if cfg.UsageExport != nil {
+			exporter, err := usage.NewExporter(s.usage, *cfg.UsageExport, logger)
+			if err != nil {
+				return nil, err
+			}
+			s.usageExporter = exporter
+		}
+	}
+
+	// セッションのイベントの Webhook（有効時のみ）
+	if cfg.SessionWebhook != nil {
+		notifier, err := webhook.NewNotifier(*cfg.SessionWebhook, logger)
+		if err != nil {
+			return nil, err
+		}
+		s.sessionEvents = notifier
+	}
+
+	// MCP レジストリへの登録（有効時のみ）
+	if cfg.Registry != nil {
+		registrar, err := newRegistrar(s, *cfg.Registry, cfg.AdvertiseURL)
+		if err != nil {
+			return nil, err
+		}
+		s.registrar = registrar
+	}
+
+	// インスタンスの重みの公開（有効時のみ）
+	if cfg.Weights != nil {
+		publisher, err := newWeightPublisher(s, *cfg.Weights, cfg.AdvertiseURL)
+		if err != nil {
+			return nil, err
+		}
+		s.weights = publisher
+	}
+
+	// Idempotency-Key による重複排除（無効化しない限り有効）
+	if cfg.IdempotencyTTL >= 0 {
+		s.idempotency = newIdempotency(cfg.IdempotencyTTL)
+	}
+
+	// レスポンスのキャッシュ（有効時のみ）
+	if len(cfg.CacheRules) > 0 {
+		s.cache = newResponseCache(cfg.CacheRules, cfg.CacheMaxEntries, s.metrics)
+	}
+
+	// メトリクスのエンドポイント（有効時のみ）
+	if cfg.Metrics {
+		mux.Handle("GET /metrics", s.metrics)
+	}
+
+	// ホスト設定は Host、未設定の場合は環境変数 HOST から取得（デフォルト: 0.0.0.0）
+	host := cfg.Host
+	if host == "" {
+		host = os.Getenv("HOST")
+	}
 	if host == "" {
 		host = "0.0.0.0"
 	}
+	readTimeout, writeTimeout := cfg.ReadTimeout, cfg.WriteTimeout
+	if readTimeout <= 0 {
+		readTimeout = ReadTimeout
+	}
+	if writeTimeout <= 0 {
+		writeTimeout = WriteTimeout
+	}
+
+	var handler http.Handler = mux
+
+	// リーダー選出とリーダー以外のレプリカからの転送（有効時のみ）
+	if cfg.LeaderLock != nil {
+		s.election = election.New(cfg.LeaderLock, cfg.AdvertiseURL, cfg.LeaderLockTTL, logger)
+		if s.polls != nil || s.subscriptions != nil || s.legacy != nil {
+			// リーダーを降りたらバックエンドのプロセスを残さない
+			s.election.OnChange = func(isLeader bool) {
+				if isLeader {
+					return
+				}
+				if s.polls != nil {
+					go s.polls.close()
+				}
+				if s.subscriptions != nil {
+					go s.subscriptions.close()
+				}
+				if s.legacy != nil {
+					go s.legacy.close()
+				}
+			}
+		}
+		handler = s.singleton(handler)
+	}
+
+	// アフィニティキーによるレプリカへの振り分け（有効時のみ）
+	if cfg.AffinityHeader != "" {
+		s.ring = hashring.New(cfg.Peers, 0)
+		handler = s.affinity(handler)
+	}
+
+	// 認証チェーン、または API キーによる認証（有効時のみ）
+	if len(cfg.AuthMethods) > 0 {
+		handler = s.authChain(handler, cfg.AuthMethods)
+	} else if cfg.APIKeys != nil {
+		handler = s.apiKeyAuth(handler)
+	}
+
+	// プラグインによる認証（有効時のみ）
+	if slices.ContainsFunc(cfg.Plugins, func(p *plugin.Plugin) bool { return p.Has(plugin.HookAuthenticate) }) {
+		handler = s.pluginAuth(handler)
+	}
+
+	// レート制限（有効時のみ）
+	if cfg.RateLimiter != nil {
+		handler = s.rateLimit(handler)
+	}
+
+	// クラスタ内でのバックエンドの設定・死活の共有（有効時のみ）
+	if cfg.Cluster {
+		s.backends.node = cfg.AdvertiseURL
+		s.gossip = newGossip(s, cfg.AdvertiseURL, cfg.Peers, cfg.GossipInterval)
+		s.metrics.GaugeFunc("tumiki_cluster_healthy_members", "Number of healthy cluster members including this node.", func() float64 {
+			return float64(s.gossip.healthyMembers())
+		})
+	}
+
+	// 署名と再送の検証（有効時のみ、API キーなどの認証より先に検証する）
+	if cfg.RequestSigningKey != nil {
+		s.signer = newRequestSigner(cfg.RequestSigningKey, cfg.SignatureMaxSkew, cfg.NonceCacheSize, s.signedHeaderNames())
+		handler = s.verifySignature(handler)
+	}
+
+	// mTLS で検証した SPIFFE ID による認可（有効時のみ、認証チェーンに mtls を含む場合はチェーンで認可する）
+	if cfg.SPIFFE != nil && !s.optionalClientCert() {
+		handler = s.spiffeAuth(handler, cfg.SPIFFEAllow)
+	}
+
+	// 偽装された内部ヘッダーの削除（有効時のみ、署名の検証を含む全ての処理より先に削除する）
+	if s.headerStripper != nil {
+		handler = s.stripHeaders(handler)
+	}
+
+	// レプリカへの転送で認証し直すため、認証より先にクライアントの認証情報を保存する（転送する場合のみ）
+	if cfg.SessionStore != nil || cfg.AffinityHeader != "" || cfg.LeaderLock != nil {
+		handler = keepClientCredentials(handler)
+	}
+
+	// 署名付き URL は URL 自体で認可するため、認証・レート制限の対象にしない（有効時のみ）
+	if s.downloads != nil {
+		root := http.NewServeMux()
+		root.HandleFunc("GET "+downloadPathPrefix+"{id}", s.downloads.handleDownload)
+		root.Handle("/", handler)
+		handler = root
+	}
+
+	// ディスカバリードキュメントは接続前に参照するため、認証・レート制限の対象にしない（有効時のみ）
+	if cfg.Discovery {
+		root := http.NewServeMux()
+		root.HandleFunc("GET "+discoveryPath, s.handleDiscovery)
+		root.Handle("/", handler)
+		handler = root
+	}
+
+	// 管理 API はレプリカ間の転送・レート制限の対象にしない（有効時のみ）
+	if cfg.AdminToken != "" {
+		root := http.NewServeMux()
+		admin := s.newAdminHandler()
+		if cfg.SPIFFE != nil {
+			admin = s.spiffeAuth(admin, cfg.SPIFFEAdminAllow)
+		}
+		root.Handle(adminPathPrefix, admin)
+		root.Handle("/", handler)
+		handler = root
+	}
 
 	s.server = &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", host, cfg.Port),
-		Handler:      mux,
-		ReadTimeout:  ReadTimeout,
-		WriteTimeout: WriteTimeout,
+		Handler:      handler,
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+	}
+	if cfg.SPIFFE != nil {
+		s.server.TLSConfig = cfg.SPIFFE.ServerTLSConfig()
+		if s.optionalClientCert() {
+			s.server.TLSConfig = cfg.SPIFFE.OptionalClientServerTLSConfig()
+		}
+	}
+
+	// gRPC フロントエンド（有効時のみ）
+	if cfg.GRPCPort > 0 {
+		s.grpcServer = s.newGRPCServer()
+		s.grpcAddr = fmt.Sprintf("%s:%d", host, cfg.GRPCPort)
+	}
+
+	// 生の TCP リスナー（有効時のみ）
+	if cfg.TCPPort > 0 {
+		s.tcpAddr = fmt.Sprintf("%s:%d", host, cfg.TCPPort)
 	}
 
 	return s, nil
 }
 
 func (s *Server) handleMCP(w http.ResponseWriter, r *http.Request) {
-	// 1. ヘッダー解析（カスタムマッピング使用）
-	envVars := make(map[string]string)
-
-	// デフォルト環境変数
-	for k, v := range s.cfg.DefaultEnv {
-		envVars[k] = v
+	// 0. Content-Type の検証と Accept による返却形式の決定
+	if r.Method == http.MethodPost && !isJSONContentType(r.Header.Get("Content-Type")) {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+	responseType := negotiate(r.Header.Get("Accept"))
+	if responseType == "" {
+		http.Error(w, "Not Acceptable: supported types are application/json, text/event-stream, application/x-ndjson", http.StatusNotAcceptable)
+		return
 	}
 
-	// カスタムヘッダーマッピングを使用してヘッダーを解析
-	headerEnv, headerArgs := parseHeaders(
-		r.Header,
-		s.cfg.HeaderEnvMapping,
-		s.cfg.HeaderArgMapping,
-	)
+	// 参照を解決できるクライアントにはレスポンスの大きなバイナリを退避して返す
+	r = r.WithContext(s.offloadContext(r.Context(), r.Header))
 
-	// ヘッダーから取得した環境変数（デフォルトを上書き）
-	for k, v := range headerEnv {
-		envVars[k] = v
+	// 購読・initialize のセッションへのリクエストは、起動し続けるプロセスに渡す
+	// 未知・期限切れ・終了済みのセッションは、Streamable HTTP の仕様に従って 404 を返してクライアントに初期化し直させる
+	if id := r.Header.Get(headerSessionID); s.subscriptions != nil && id != "" {
+		if sub, ok := s.subscriptions.lookup(w, r, id); ok {
+			s.subscriptions.handlePost(w, r, id, sub, responseType)
+		}
+		return
 	}
 
-	// 2. 引数マージ（元のスライスを変更しない）
-	args := make([]string, 0, len(s.cfg.Args)+len(headerArgs))
-	args = append(args, s.cfg.Args...)
-	args = append(args, headerArgs...)
+	// 1-2. ヘッダー解析と環境変数・引数のマージ
+	header, err := s.requestHeaders(r.Context(), r.Header, r.URL.Path)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	executor := s.newExecutor(header)
 
 	// 3. リクエストボディ読み込み
 	body, err := io.ReadAll(r.Body)
@@ -103,31 +803,481 @@ func (s *Server) handleMCP(w http.ResponseWriter, r *http.Request) {
 			s.logger.Debug("Failed to close request body", "error", err)
 		}
 	}()
+	observeBody(r.Context(), body)
+
+	// UTF-8 の検証とクライアントとサーバーの差異を吸収するための書き換え
+	body, err = s.prepareRequest(r.Context(), body)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	// 購読はリクエストごとのプロセスでは通知を送れないため、起動し続けるプロセスで受け付ける
+	// セッションが有効な場合は、状態を持つサーバーのために initialize でも起動し続けるプロセスを作成する
+	// ただしセッションが繰り返し失敗したバックエンドでは、切り替えの期間中はリクエストごとのプロセスで処理する
+	switch method := requestMethod(body); {
+	case s.cfg.Subscriptions && method == "resources/subscribe":
+		s.subscriptions.handleSubscribe(w, r, header, body, responseType)
+		return
+	case s.cfg.Sessions && method == "initialize" && !s.fallback.oneShot(s.backendFor(header).Version):
+		s.subscriptions.handleInitialize(w, r, header, body, responseType)
+		return
+	}
+
+	meter := s.newUsageMeter(header, s.backendFor(header).Version)
+	call := meter.request(body)
 
 	// 4. stdio プロセス実行
 	ctx, cancel := context.WithTimeout(r.Context(), ProcessTimeout)
 	defer cancel()
 
-	executor := process.NewExecutor(
-		s.cfg.Command,
+	// 通知とレスポンスにはレスポンスを返さないため、プロセスに渡した後に 202 を返す
+	if msg, err := jsonrpc.Parse(body); err == nil && (msg.IsNotification() || msg.IsResponse()) {
+		s.deliverMessage(ctx, w, executor, body, meter, call)
+		return
+	}
+
+	// ストリーミング形式を受け付けるクライアントには通知を含む全メッセージを逐次返す
+	switch responseType {
+	case contentTypeNDJSON:
+		s.streamMessages(ctx, w, executor, body, meter, contentTypeNDJSON, writeNDJSONFrame)
+		return
+	case contentTypeSSE:
+		s.streamMessages(ctx, w, executor, body, meter, contentTypeSSE, writeSSEFrame)
+		return
+	}
+
+	cached, response := s.cacheLookup(header, body)
+	replayed := false
+	if response == nil {
+		response, replayed, err = s.executeIdempotent(ctx, header, body)
+		if err != nil {
+			meter.fail(call)
+			// プロセスがメッセージの途中で終了した場合は、読み取れた出力と stderr を JSON-RPC のエラーで返す
+			if response, ok := s.partialOutputResponse(r.Context(), body, err); ok {
+				w.Header().Set("Content-Type", contentTypeJSON)
+				w.WriteHeader(http.StatusOK)
+				if _, err := w.Write(response); err != nil {
+					s.logger.Debug("Failed to write response", "error", err)
+				}
+				return
+			}
+			writeExecuteError(w, s.logger, err)
+			return
+		}
+		s.cacheStore(cached, response)
+	}
+
+	response, err = s.processResponse(ctx, response, call.method)
+	if err != nil {
+		s.logger.Error("Response processing failed", "error", err)
+		meter.fail(call)
+		http.Error(w, "Response processing failed", http.StatusInternalServerError)
+		return
+	}
+	meter.response(call, response)
+	observeResponse(r.Context(), response)
+
+	// 5. レスポンス返却
+	if cached.status != "" {
+		w.Header().Set(headerCacheStatus, cached.status)
+	}
+	if replayed {
+		w.Header().Set(headerIdempotentReplayed, "true")
+	}
+	s.metaHeaders.set(w.Header(), response)
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(response); err != nil && s.logger != nil {
+		s.logger.Debug("Failed to write response", "error", err)
+	}
+}
+
+// newExecutor はリクエストヘッダーをカスタムマッピングで解析し、
+// デフォルト設定とマージした環境変数・引数で Executor を作成します。
+func (s *Server) newExecutor(header http.Header) *process.Executor {
+	executor, _ := s.newVersionedExecutor(header)
+	return executor
+}
+
+// newVersionedExecutor は newExecutor と同じ Executor と、起動するコマンドのバージョン名を返します。
+func (s *Server) newVersionedExecutor(header http.Header) (*process.Executor, string) {
+	backend, envVars, args := s.processConfig(header)
+	return process.NewExecutor(
+		backend.Command,
 		args,
 		envVars,
 		s.logger,
+		s.executorOptions(backend)...,
+	), backend.Version
+}
+
+// processConfig は有効なバックエンドと、デフォルト設定とヘッダー由来の値をマージした環境変数と引数を返します。
+// 名前付きのサーバーへのリクエストでは、そのサーバーのコマンド・デフォルト環境変数・マッピングのみを使います。
+func (s *Server) processConfig(header http.Header) (*Backend, map[string]string, []string) {
+	if server := s.namedServerFor(header); server != nil {
+		envVars := s.secretRefs.Expand(server.defaultEnv)
+		headerEnv, headerArgs := parseHeaders(header, server.headerEnvMapping, server.headerArgMapping)
+		maps.Copy(envVars, headerEnv)
+		maps.Copy(envVars, s.apiKeyEnvFromHeader(header))
+		args := s.withStagedFiles(header, envVars, mergeArgs(server.backend.Args, headerArgs))
+		return server.backend, envVars, args
+	}
+
+	backend := s.backends.current()
+	defs := s.defs()
+	// デフォルト環境変数（シークレットの参照は読み取った値に置き換える）
+	envVars := s.secretRefs.Expand(defs.defaultEnv)
+
+	// カスタムヘッダーマッピングを使用してヘッダーを解析
+	headerEnv, headerArgs := parseHeaders(
+		header,
+		defs.headerEnvMapping,
+		defs.headerArgMapping,
 	)
 
-	response, err := executor.Execute(ctx, body)
+	// ヘッダーから取得した環境変数（デフォルトを上書き）
+	for k, v := range headerEnv {
+		envVars[k] = v
+	}
+
+	// 条件付きマッピング（通常のマッピングの後に適用）
+	for _, m := range s.cfg.MappingRules.Match(mapping.Request{Header: header, Path: header.Get(headerRequestPath), Claims: claimsFromHeader(header)}) {
+		if m.Rule.Arg == nil {
+			envVars[m.Rule.Env] = m.Value
+			continue
+		}
+		headerArgs = append(headerArgs, renderArg(*m.Rule.Arg, m.Value)...)
+	}
+
+	// 認証した API キーの環境変数（マッピングの後に適用し、クライアントのヘッダーで上書きできない）
+	maps.Copy(envVars, s.apiKeyEnvFromHeader(header))
+
+	// スクリプトが計算した環境変数・引数（マッピングの後に適用）
+	if len(s.cfg.Scripts) > 0 {
+		result := scriptResultFromHeader(header)
+		maps.Copy(envVars, result.Env)
+		headerArgs = append(headerArgs, result.Args...)
+	}
+
+	static := overrideArgs(backend.Args, header, s.argOverrides, s.argRemovals)
+	args := s.withStagedFiles(header, envVars, mergeArgs(static, headerArgs))
+	return backend, envVars, args
+}
+
+// HeaderArgsPlaceholder は静的な引数のうち、ヘッダー由来の引数に置き換える位置を示すトークンです。
+// 最後の引数が位置引数でなければならないコマンドのために、ヘッダー由来の引数を途中に挿入できます。
+const HeaderArgsPlaceholder = "{{headerArgs}}"
+
+// mergeArgs は静的な引数の HeaderArgsPlaceholder をヘッダー由来の引数に置き換えます。
+// プレースホルダーがない場合は末尾に追加します。元のスライスは変更しません。
+func mergeArgs(static, headerArgs []string) []string {
+	args := make([]string, 0, len(static)+len(headerArgs))
+	placed := false
+	for _, arg := range static {
+		if arg == HeaderArgsPlaceholder {
+			if !placed {
+				args = append(args, headerArgs...)
+				placed = true
+			}
+			continue
+		}
+		args = append(args, arg)
+	}
+	if !placed {
+		args = append(args, headerArgs...)
+	}
+	return args
+}
+
+// streamMessages はプロセスが出力した JSON-RPC メッセージを contentType の形式で逐次返却します。
+// ステータスコードは最初のメッセージを書き込む時点で確定するため、
+// それ以前にプロセスが失敗した場合のみ 500 を返します。
+func (s *Server) streamMessages(ctx context.Context, w http.ResponseWriter, executor *process.Executor, body []byte, meter *usageMeter, contentType string, writeFrame func(io.Writer, []byte) error) {
+	flusher, _ := w.(http.Flusher)
+	call := requestCall(body)
+
+	// キープアライブと書き込みが競合しないようレスポンスへの書き込みは mu で保護する
+	var mu sync.Mutex
+	wroteHeader := false
+	lastWrite := time.Now()
+	write := func(frame func(io.Writer) error) error {
+		if !wroteHeader {
+			w.Header().Set("Content-Type", contentType)
+			if contentType == contentTypeSSE {
+				w.Header().Set("Cache-Control", "no-cache")
+			}
+			w.WriteHeader(http.StatusOK)
+			wroteHeader = true
+		}
+		if err := frame(w); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		lastWrite = time.Now()
+		return nil
+	}
+
+	// 応答に時間がかかる間も中継サーバーに接続を切られないよう、SSE では一定時間書き込みがなければコメントを送る
+	if contentType == contentTypeSSE && s.cfg.KeepAliveInterval > 0 {
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			ticker := time.NewTicker(s.cfg.KeepAliveInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+				}
+				mu.Lock()
+				if time.Since(lastWrite) >= s.cfg.KeepAliveInterval {
+					if err := write(writeSSEKeepAlive); err != nil {
+						s.logger.Debug("Failed to write keep-alive", "error", err)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+		defer func() {
+			close(done)
+			<-stopped
+		}()
+	}
+
+	err := s.streamProcess(ctx, executor, body, func(msg []byte) error {
+		msg, err := s.processResponse(ctx, msg, call.method)
+		if err != nil {
+			return err
+		}
+		meter.response(call, msg)
+		mu.Lock()
+		defer mu.Unlock()
+		return write(func(w io.Writer) error { return writeFrame(w, msg) })
+	})
 	if err != nil {
+		meter.fail(call)
+		mu.Lock()
+		defer mu.Unlock()
+		if response, ok := s.partialOutputResponse(ctx, body, err); ok {
+			if err := write(func(w io.Writer) error { return writeFrame(w, response) }); err != nil {
+				s.logger.Debug("Failed to write response", "error", err)
+			}
+			return
+		}
 		s.logger.Error("Process execution failed", "error", err)
-		http.Error(w, "Process execution failed", http.StatusInternalServerError)
+		if !wroteHeader {
+			http.Error(w, "Process execution failed", http.StatusInternalServerError)
+		}
+	}
+}
+
+// deliverMessage はリクエストではないメッセージ（通知・レスポンス）をプロセスに渡し、
+// Streamable HTTP の仕様に従ってボディのない 202 を返します。プロセスの出力は破棄します。
+func (s *Server) deliverMessage(ctx context.Context, w http.ResponseWriter, executor *process.Executor, body []byte, meter *usageMeter, call rpcCall) {
+	err := s.streamProcess(ctx, executor, body, func(msg []byte) error {
+		s.logger.Debug("Discarding process output for a non-request message", "method", call.method)
+		return nil
+	})
+	if err != nil {
+		meter.fail(call)
+		writeExecuteError(w, s.logger, err)
 		return
 	}
+	w.WriteHeader(http.StatusAccepted)
+}
 
-	// 5. レスポンス返却
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(response); err != nil && s.logger != nil {
-		s.logger.Debug("Failed to write response", "error", err)
+// writeNDJSONFrame はメッセージを NDJSON の1行として書き込みます。
+// msg は読み取りバッファを指しているため append せずに改行を別途書き込みます。
+func writeNDJSONFrame(w io.Writer, msg []byte) error {
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte("\n"))
+	return err
+}
+
+// writeSSEFrame はメッセージを SSE の message イベントとして書き込みます。
+// JSON-RPC メッセージは1行で出力されるため data フィールドは1つで足ります。
+func writeSSEFrame(w io.Writer, msg []byte) error {
+	if _, err := io.WriteString(w, "event: message\ndata: "); err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n\n")
+	return err
+}
+
+// errInvalidRequest はクライアントから受け取ったペイロードが不正であることを表します。
+var errInvalidRequest = errors.New("invalid request payload")
+
+// prepareRequest はリクエストボディを UTF-8 として検証・正規化し、退避した params を元に戻して書き換えルールとプラグインの変換を適用します。
+// 最後に initialize のリクエストから隠すクライアントの機能を取り除きます。
+// 検証に失敗した場合は errInvalidRequest を、書き換えに失敗した場合は errRequestRewrite を返します。
+func (s *Server) prepareRequest(ctx context.Context, body []byte) ([]byte, error) {
+	body, err := s.cfg.RequestPayload.Apply(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidRequest, err)
+	}
+	body, err = s.rehydrate(ctx, body)
+	if err != nil {
+		if !errors.Is(err, errInvalidRequest) {
+			s.logger.Error("Offloaded payload fetch failed", "error", err)
+		}
+		return nil, err
+	}
+	body, err = s.cfg.RequestRewrites.Apply(body)
+	if err != nil {
+		s.logger.Error("Request rewrite failed", "error", err)
+		return nil, errRequestRewrite
+	}
+	for _, p := range s.cfg.Plugins {
+		if body, err = p.TransformRequest(ctx, body); err != nil {
+			s.logger.Error("Plugin request transform failed", "plugin", p.Name(), "error", err)
+			return nil, errRequestRewrite
+		}
+	}
+	if s.capabilities != nil {
+		body = s.capabilities.request(body)
+	}
+	return body, nil
+}
+
+// writeRequestError は prepareRequest のエラーを HTTP レスポンスとして返します。
+// 不正なペイロードは原因が分かるよう 400 とエラー内容を返します。
+func writeRequestError(w http.ResponseWriter, err error) {
+	var denied *scriptDeniedError
+	if errors.As(err, &denied) {
+		http.Error(w, denied.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errHeaderTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestHeaderFieldsTooLarge)
+		return
+	}
+	if errors.Is(err, errTokenRejected) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, errTokenExchange) {
+		http.Error(w, "Token exchange failed", http.StatusBadGateway)
+		return
+	}
+	if errors.Is(err, errInvalidRequest) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	http.Error(w, "Request rewrite failed", http.StatusInternalServerError)
+}
+
+// processResponse はプロセスが出力したメッセージを検証・正規化してプラグインとレスポンス変換を適用し、initialize の結果から隠す機能を取り除きます。
+// オフロードが有効な場合は resources/read の大きなコンテンツや大きなバイナリを切り出します。
+// 最後に、オフロードしても上限を超えるメッセージをレスポンスの大きさの制限に従って置き換えます。
+func (s *Server) processResponse(ctx context.Context, msg []byte, method string) ([]byte, error) {
+	msg, err := s.cfg.ResponsePayload.Apply(msg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response payload: %w", err)
+	}
+	for _, p := range s.cfg.Plugins {
+		if msg, err = p.TransformResponse(ctx, msg); err != nil {
+			return nil, err
+		}
+	}
+	msg, err = s.cfg.ResponseTransforms.Apply(msg, rewrite.TemplateData{Method: method})
+	if err != nil {
+		return nil, err
+	}
+	if s.capabilities != nil {
+		msg = s.capabilities.response(msg, method)
+	}
+	if msg, err = s.offloadResponse(ctx, msg); err != nil {
+		return nil, err
+	}
+	if s.downloads != nil && method == "resources/read" {
+		if msg, err = s.downloads.offload(msg); err != nil {
+			return nil, err
+		}
+	}
+	if s.blobs != nil {
+		if msg, err = s.blobs.offload(msg); err != nil {
+			return nil, err
+		}
+	}
+	if s.responseLimit == nil {
+		return msg, nil
+	}
+	return s.responseLimit.apply(msg)
+}
+
+// requestMethod はリクエストボディから JSON-RPC のメソッド名を取り出します。
+// バッチや JSON でないボディの場合は空文字列を返します。
+func requestMethod(body []byte) string {
+	msg, err := jsonrpc.Parse(body)
+	if err != nil {
+		return ""
+	}
+	return msg.Method
+}
+
+// executorOptions は設定とバックエンドから Executor のオプションを組み立てます。
+func (s *Server) executorOptions(backend *Backend) []process.Option {
+	// 設定の再読み込みで定義が変わったバックエンドのプロセスだけを終了させるためのラベル
+	opts := []process.Option{process.WithLabel(backend.Version)}
+	switch backend.Runtime {
+	case "":
+		// ランチャーはサーバーを子孫のプロセスとして起動するため、プロセスグループでまとめて終了させる
+		if s.cfg.WASI == nil {
+			if l := s.launchers.Get(backend.Command, backend.Args); l != nil {
+				opts = append(opts, process.WithLauncher(l))
+			}
+		}
+	case process.RuntimeFirecracker:
+		opts = append(opts, process.WithMicroVM(s.cfg.MicroVM))
+	default:
+		opts = append(opts, process.WithContainer(backend.Runtime, s.cfg.ContainerOptions...))
+	}
+	if s.cfg.Trace != nil {
+		opts = append(opts, process.WithTrace(*s.cfg.Trace))
+	}
+	if s.cfg.MaxMessageSize > 0 {
+		opts = append(opts, process.WithMaxMessageSize(s.cfg.MaxMessageSize))
+	}
+	if s.cfg.Compression != "" {
+		opts = append(opts, process.WithCompression(s.cfg.Compression))
+	}
+	if s.cfg.Framing != "" {
+		// 区切り方はサーバーの実装で決まるため、バックエンドのコマンドと静的な引数ごとに判定する
+		key := backend.Version + "\x00" + backend.identity() + "\x00" + strings.Join(backend.Args, "\x00")
+		opts = append(opts, process.WithFraming(s.cfg.Framing, s.framings, key))
+	}
+	if s.cfg.WASI != nil {
+		opts = append(opts, process.WithWASI(s.cfg.WASI))
+	}
+	if s.cfg.Workspace != nil {
+		opts = append(opts, process.WithWorkspace(*s.cfg.Workspace))
+	}
+	if s.cfg.Secrets != nil {
+		opts = append(opts, process.WithSecrets(s.cfg.Secrets), process.WithSecretRotation(s.cfg.SecretRotation))
+	}
+	if s.egress != nil {
+		opts = append(opts, process.WithEgressProxy(s.egressProxyURL(backend), s.egress.SocketPath()))
+	}
+	return opts
+}
+
+// maxMessageSize は1メッセージの最大サイズを返します。
+// stdio 以外のフロントエンドでも stdio で扱える最大サイズに揃えます。
+func (s *Server) maxMessageSize() int {
+	if s.cfg.MaxMessageSize > 0 {
+		return s.cfg.MaxMessageSize
+	}
+	return process.DefaultMaxMessageSize
 }
 
 // Handler returns the HTTP handler for testing purposes
@@ -137,47 +1287,329 @@ func (s *Server) Handler() http.Handler {
 
 // Start starts the HTTP server and blocks until the context is cancelled.
 func (s *Server) Start(ctx context.Context) error {
-	errChan := make(chan error, 1)
+	errChan := make(chan error, 3)
+
+	// シャットダウンのレポートは全ての終了処理の後に出力する
+	startedAt := time.Now()
+	defer func() {
+		if !s.drain.startedAt.IsZero() {
+			s.writeShutdownReport(s.shutdownReport(startedAt, time.Now()))
+		}
+	}()
+	defer s.secretRefs.Close()
 
 	go func() {
 		s.logger.Info("Server starting", "addr", s.server.Addr)
-		if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
+		var err error
+		if s.server.TLSConfig != nil {
+			// 証明書は TLSConfig.GetCertificate が SVID を返す
+			err = s.server.ListenAndServeTLS("", "")
+		} else {
+			err = s.server.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
 			errChan <- err
 		}
 	}()
 
+	// ランチャーのパッケージは接続を受け付けながら取得し、シャットダウンの開始時に取得のプロセスも終了させる
+	s.prefetchLaunchers(ctx, s.launcherBackends())
+
+	if s.grpcServer != nil {
+		lis, err := net.Listen("tcp", s.grpcAddr)
+		if err != nil {
+			_ = s.server.Close()
+			return fmt.Errorf("grpc listen: %w", err)
+		}
+		go func() {
+			s.logger.Info("gRPC server starting", "addr", s.grpcAddr)
+			if err := s.grpcServer.Serve(lis); err != nil {
+				errChan <- err
+			}
+		}()
+		defer s.stopGRPC()
+	}
+
+	if s.tcpAddr != "" {
+		lis, err := net.Listen("tcp", s.tcpAddr)
+		if err != nil {
+			_ = s.server.Close()
+			return fmt.Errorf("tcp listen: %w", err)
+		}
+		if s.cfg.SPIFFE != nil {
+			lis = tls.NewListener(lis, s.cfg.SPIFFE.ServerTLSConfig())
+		}
+		go func() {
+			s.logger.Info("TCP server starting", "addr", s.tcpAddr)
+			if err := s.serveTCP(ctx, lis); err != nil {
+				errChan <- err
+			}
+		}()
+	}
+
+	// 重みはシャットダウンの開始時に 0 にし、処理中のリクエストの完了を待つ間に新しいトラフィックが来ないようにする
+	if s.weights != nil {
+		weightsCtx, stopWeights := context.WithCancel(ctx)
+		weightsDone := make(chan struct{})
+		go func() {
+			s.weights.run(weightsCtx)
+			close(weightsDone)
+		}()
+		defer func() {
+			stopWeights()
+			<-weightsDone
+		}()
+	}
+
+	// リーダー選出は処理中のリクエストが完了した後にロックを解放する
+	if s.election != nil {
+		electionCtx, stopElection := context.WithCancel(context.Background())
+		electionDone := make(chan struct{})
+		go func() {
+			s.election.Run(electionCtx)
+			close(electionDone)
+		}()
+		defer func() {
+			stopElection()
+			<-electionDone
+		}()
+	}
+
+	if s.gossip != nil {
+		gossipCtx, stopGossip := context.WithCancel(context.Background())
+		gossipDone := make(chan struct{})
+		go func() {
+			s.gossip.run(gossipCtx)
+			close(gossipDone)
+		}()
+		defer func() {
+			stopGossip()
+			<-gossipDone
+		}()
+	}
+
+	// 利用量のレポートは処理中のリクエストが完了した後に最後の出力を行う
+	if s.usageExporter != nil {
+		usageCtx, stopUsage := context.WithCancel(context.Background())
+		usageDone := make(chan struct{})
+		go func() {
+			s.usageExporter.Run(usageCtx)
+			close(usageDone)
+		}()
+		defer func() {
+			stopUsage()
+			<-usageDone
+		}()
+	}
+
+	// セッションのイベントは全てのセッションを終了させた後に残りを送る
+	if s.sessionEvents != nil {
+		eventsCtx, stopEvents := context.WithCancel(context.Background())
+		eventsDone := make(chan struct{})
+		go func() {
+			s.sessionEvents.Run(eventsCtx)
+			close(eventsDone)
+		}()
+		defer func() {
+			stopEvents()
+			<-eventsDone
+		}()
+	}
+
+	// レジストリには処理中のリクエストが完了した後に停止を知らせる
+	if s.registrar != nil {
+		registryCtx, stopRegistry := context.WithCancel(context.Background())
+		registryDone := make(chan struct{})
+		go func() {
+			s.registrar.run(registryCtx)
+			close(registryDone)
+		}()
+		defer func() {
+			stopRegistry()
+			<-registryDone
+		}()
+	}
+
+	if s.blobs != nil {
+		defer func() {
+			if err := s.blobs.close(); err != nil {
+				s.logger.Debug("Failed to remove blob directory", "error", err)
+			}
+		}()
+	}
+
+	if s.downloads != nil {
+		defer func() {
+			if err := s.downloads.close(); err != nil {
+				s.logger.Debug("Failed to remove download directory", "error", err)
+			}
+		}()
+	}
+
+	if s.staged != nil {
+		defer func() {
+			if err := s.staged.close(); err != nil {
+				s.logger.Debug("Failed to remove staging directory", "error", err)
+			}
+		}()
+	}
+
+	if s.polls != nil {
+		defer s.polls.close()
+	}
+
+	if s.egress != nil {
+		defer func() { _ = s.egress.Close() }()
+	}
+
+	if s.subscriptions != nil {
+		// 通知のストリームは終了しないため、シャットダウンの開始時にプロセスを終了させてストリームを閉じる
+		// OnShutdown は goroutine で実行されるため、defer の close で終了を待ってからシャットダウンのレポートを出力する
+		s.server.RegisterOnShutdown(s.subscriptions.close)
+		defer s.subscriptions.close()
+	}
+
+	if s.legacy != nil {
+		// SSE のストリームは終了しないため、シャットダウンの開始時にプロセスを終了させてストリームを閉じる
+		// OnShutdown は goroutine で実行されるため、defer の close で終了を待ってからシャットダウンのレポートを出力する
+		s.server.RegisterOnShutdown(s.legacy.close)
+		defer s.legacy.close()
+	}
+
+	if s.webSockets != nil {
+		// ハイジャックした接続はシャットダウンで閉じられないため、シャットダウンの開始時にプロセスを終了させて接続を閉じる
+		s.server.RegisterOnShutdown(s.webSockets.close)
+		defer s.webSockets.close()
+	}
+
+	if s.standby != nil {
+		defer func() {
+			if err := s.standby.close(); err != nil {
+				s.logger.Debug("Failed to close standby process", "error", err)
+				s.drain.fail("close standby process", err)
+			}
+		}()
+	}
+
+	if s.reuse != nil {
+		defer func() {
+			if err := s.reuse.Close(); err != nil {
+				s.logger.Debug("Failed to close reused process", "error", err)
+				s.drain.fail("close reused process", err)
+			}
+		}()
+	}
+
+	if s.shared != nil {
+		defer func() {
+			if err := s.shared.Close(); err != nil {
+				s.logger.Debug("Failed to close shared process", "error", err)
+				s.drain.fail("close shared process", err)
+			}
+		}()
+	}
+
 	select {
 	case err := <-errChan:
 		return err
 	case <-ctx.Done():
 		s.logger.Info("Shutting down server...")
+		s.drain.startedAt = time.Now()
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
 		defer cancel()
-		return s.server.Shutdown(shutdownCtx)
+		err := s.server.Shutdown(shutdownCtx)
+		if err != nil {
+			s.drain.fail("http shutdown", err)
+		}
+		return err
+	}
+}
+
+// stopGRPC は処理中のストリームの完了を ShutdownTimeout まで待ってから gRPC サーバーを停止します。
+func (s *Server) stopGRPC() {
+	done := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(ShutdownTimeout):
+		s.drain.fail("grpc shutdown", context.DeadlineExceeded)
+		s.grpcServer.Stop()
 	}
 }
 
 // parseHeaders はカスタムヘッダーマッピングに基づいて HTTP ヘッダーから環境変数と引数を抽出します。
 // envMapping: ヘッダー名 → 環境変数名 (例: "X-Slack-Token" → "SLACK_TOKEN")
-// argMapping: ヘッダー名 → 引数名 (例: "X-Team-Id" → "team-id")
+// argMapping: ヘッダー名 → 引数名 (例: "X-Team-Id" → "team-id")。引数の形式は renderArg を参照してください。
 func parseHeaders(headers http.Header, envMapping, argMapping map[string]string) (map[string]string, []string) {
 	envVars := make(map[string]string)
 	var args []string
 
 	// 環境変数マッピング
 	for headerName, envName := range envMapping {
-		if value := headers.Get(headerName); value != "" {
+		if value := headerValue(headers, headerName); value != "" {
 			envVars[envName] = value
 		}
 	}
 
-	// 引数マッピング
-	for headerName, argName := range argMapping {
-		if value := headers.Get(headerName); value != "" {
-			// "team-id" → "--team-id value" 形式で追加
-			args = append(args, "--"+argName, value)
+	// 引数マッピング（ヘッダー名の順に並べ、同じヘッダーからは常に同じ引数列を作る）
+	for _, headerName := range slices.Sorted(maps.Keys(argMapping)) {
+		argName := argMapping[headerName]
+		if value := headerValue(headers, headerName); value != "" {
+			args = append(args, renderArg(argName, value)...)
 		}
 	}
 
 	return envVars, args
 }
+
+// renderArg は引数マッピングの引数名の書き方に応じた形式で引数を作成します。
+//   - "team-id" / "--team-id": "--team-id value"
+//   - "--team-id=": "--team-id=value"
+//   - "-t": "-t value"
+//   - "": "value"（位置引数）
+func renderArg(name, value string) []string {
+	switch {
+	case name == "":
+		return []string{value}
+	case strings.HasSuffix(name, "="):
+		if !strings.HasPrefix(name, "-") {
+			name = "--" + name
+		}
+		return []string{name + value}
+	case strings.HasPrefix(name, "-"):
+		return []string{name, value}
+	default:
+		return []string{"--" + name, value}
+	}
+}
+
+// headerValue は name のヘッダーの値を大文字小文字を区別せずに返します。
+// http.Header を直接組み立てた場合など、キーが正規化されていないヘッダーにも一致させます。
+func headerValue(headers http.Header, name string) string {
+	if value := headers.Get(name); value != "" {
+		return value
+	}
+	for key, values := range headers {
+		if len(values) > 0 && strings.EqualFold(key, name) {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// normalizeHeaderMapping はヘッダーマッピングのヘッダー名を正規化します（例: "X-MCP-Token" → "X-Mcp-Token"）。
+// 正規化すると同じになるヘッダー名が異なる値に割り当てられている場合はエラーを返します。
+func normalizeHeaderMapping(mapping map[string]string) (map[string]string, error) {
+	normalized := make(map[string]string, len(mapping))
+	for name, value := range mapping {
+		key := http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if existing, ok := normalized[key]; ok && existing != value {
+			return nil, fmt.Errorf("header %q is mapped to both %q and %q", key, existing, value)
+		}
+		normalized[key] = value
+	}
+	return normalized, nil
+}
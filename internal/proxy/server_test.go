@@ -7,11 +7,25 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/egress"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mcptest"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/rewrite"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/sanitize"
 )
 
+func TestMain(m *testing.M) {
+	mcptest.RunIfRequested()
+	egress.RunSandboxIfRequested()
+	os.Exit(m.Run())
+}
+
 func TestNewServer(t *testing.T) {
 	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
 
@@ -110,6 +124,23 @@ func TestParseHeaders(t *testing.T) {
 			},
 			wantArgs: []string{"--team-id", "T123"},
 		},
+		{
+			name: "正規化されていないヘッダーキー_大文字小文字を区別せず一致",
+			headers: http.Header{
+				"x-mcp-token": []string{"secret"},
+				"X-TEAM-ID":   []string{"T123"},
+			},
+			envMapping: map[string]string{
+				"X-Mcp-Token": "MCP_TOKEN",
+			},
+			argMapping: map[string]string{
+				"X-Team-Id": "team-id",
+			},
+			wantEnvVars: map[string]string{
+				"MCP_TOKEN": "secret",
+			},
+			wantArgs: []string{"--team-id", "T123"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -153,6 +184,158 @@ func TestParseHeaders(t *testing.T) {
 	}
 }
 
+func TestMergeArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		static     []string
+		headerArgs []string
+		want       []string
+	}{
+		{
+			name:       "プレースホルダーなし_末尾に追加",
+			static:     []string{"-y", "server"},
+			headerArgs: []string{"--team-id", "T123"},
+			want:       []string{"-y", "server", "--team-id", "T123"},
+		},
+		{
+			name:       "プレースホルダーあり_その位置に挿入",
+			static:     []string{"-y", "server", HeaderArgsPlaceholder, "/data"},
+			headerArgs: []string{"--team-id", "T123"},
+			want:       []string{"-y", "server", "--team-id", "T123", "/data"},
+		},
+		{
+			name:       "ヘッダー由来の引数なし_プレースホルダーを取り除く",
+			static:     []string{"server", HeaderArgsPlaceholder, "/data"},
+			headerArgs: nil,
+			want:       []string{"server", "/data"},
+		},
+		{
+			name:       "複数のプレースホルダー_最初の位置にだけ挿入",
+			static:     []string{HeaderArgsPlaceholder, "server", HeaderArgsPlaceholder},
+			headerArgs: []string{"--a", "1"},
+			want:       []string{"--a", "1", "server"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			static := slices.Clone(tt.static)
+			got := mergeArgs(tt.static, tt.headerArgs)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeArgs() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.static, static) {
+				t.Errorf("mergeArgs() modified static args: %v", tt.static)
+			}
+		})
+	}
+}
+
+func TestRenderArg(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  string
+		value string
+		want  []string
+	}{
+		{name: "名前のみ_長いフラグと値", spec: "team-id", value: "T123", want: []string{"--team-id", "T123"}},
+		{name: "長いフラグ_そのまま値と並べる", spec: "--team-id", value: "T123", want: []string{"--team-id", "T123"}},
+		{name: "末尾が=_1つの引数に結合", spec: "--team-id=", value: "T123", want: []string{"--team-id=T123"}},
+		{name: "名前のみで末尾が=_長いフラグに結合", spec: "team-id=", value: "T123", want: []string{"--team-id=T123"}},
+		{name: "短いフラグ_値と並べる", spec: "-t", value: "T123", want: []string{"-t", "T123"}},
+		{name: "空の名前_位置引数", spec: "", value: "/data", want: []string{"/data"}},
+		{name: "値に=を含む_そのまま結合", spec: "--filter=", value: "a=b", want: []string{"--filter=a=b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderArg(tt.spec, tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("renderArg() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHeaders_ArgsOrderedByHeaderName(t *testing.T) {
+	headers := http.Header{"X-A": {"1"}, "X-B": {"2"}, "X-C": {"3"}}
+	argMapping := map[string]string{"X-C": "c", "X-A": "a", "X-B": "b"}
+
+	want := []string{"--a", "1", "--b", "2", "--c", "3"}
+	for range 10 {
+		if _, got := parseHeaders(headers, nil, argMapping); !reflect.DeepEqual(got, want) {
+			t.Fatalf("parseHeaders() args = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestNormalizeHeaderMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "大文字の略語_正規化される",
+			mapping: map[string]string{"X-MCP-Token": "MCP_TOKEN", "x-team-id": "team-id"},
+			want:    map[string]string{"X-Mcp-Token": "MCP_TOKEN", "X-Team-Id": "team-id"},
+		},
+		{
+			name:    "正規化後に同じ名前で同じ値_1つにまとめる",
+			mapping: map[string]string{"X-MCP-Token": "MCP_TOKEN", "x-mcp-token": "MCP_TOKEN"},
+			want:    map[string]string{"X-Mcp-Token": "MCP_TOKEN"},
+		},
+		{
+			name:    "正規化後に同じ名前で異なる値_エラー",
+			mapping: map[string]string{"X-MCP-Token": "MCP_TOKEN", "x-mcp-token": "OTHER_TOKEN"},
+			wantErr: true,
+		},
+		{
+			name:    "nil_空のマップ",
+			mapping: nil,
+			want:    map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeHeaderMapping(tt.mapping)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeHeaderMapping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeHeaderMapping() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleMCP_HeaderMappingCaseInsensitive(t *testing.T) {
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", `read line; printf '{"token":"%s"}\n' "$MCP_TOKEN"`},
+		DefaultEnv:       map[string]string{},
+		HeaderEnvMapping: map[string]string{"X-MCP-Token": "MCP_TOKEN"},
+		HeaderArgMapping: map[string]string{},
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-mcp-token", "secret")
+	w := httptest.NewRecorder()
+	server.handleMCP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d (body: %s)", w.Code, http.StatusOK, w.Body.String())
+	}
+	if got := strings.TrimSpace(w.Body.String()); got != `{"token":"secret"}` {
+		t.Errorf("body = %s, want the mapped token", got)
+	}
+}
+
 func TestHandleMCP_Basic(t *testing.T) {
 	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
 
@@ -171,6 +354,7 @@ func TestHandleMCP_Basic(t *testing.T) {
 	}
 
 	req := httptest.NewRequest("POST", "/mcp", bytes.NewReader([]byte("test input\n")))
+	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
 	server.handleMCP(w, req)
@@ -214,6 +398,7 @@ func TestHandleMCP_WithHeaderMapping(t *testing.T) {
 
 	// ヘッダーで環境変数を上書き
 	req := httptest.NewRequest("POST", "/mcp", bytes.NewReader([]byte("test\n")))
+	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-Custom-Var", "override")
 	w := httptest.NewRecorder()
 
@@ -310,6 +495,7 @@ func TestHandleMCP_InvalidBody(t *testing.T) {
 
 	// エラーを引き起こすボディ（nil reader）
 	req := httptest.NewRequest("POST", "/mcp", nil)
+	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
 	server.handleMCP(w, req)
@@ -326,3 +512,493 @@ func TestHandleMCP_InvalidBody(t *testing.T) {
 		t.Logf("Status = %d (this is expected for some edge cases)", resp.StatusCode)
 	}
 }
+
+func TestHandleMCP_NDJSON(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	command, args, env := mcptest.Command(mcptest.ModeCompliant)
+
+	cfg := &Config{
+		Port:             8080,
+		Command:          command,
+		Args:             args,
+		DefaultEnv:       env,
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+	}
+
+	server, err := NewServer(cfg, logger)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	body := `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, application/x-ndjson")
+	w := httptest.NewRecorder()
+
+	server.handleMCP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d (body: %s)", w.Code, http.StatusOK, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %s, want application/x-ndjson", ct)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("line count = %d, want 2 (body: %s)", len(lines), w.Body.String())
+	}
+	if !strings.Contains(lines[0], "notifications/message") {
+		t.Errorf("first line should be the notification: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"id":7`) || !strings.Contains(lines[1], `"hi"`) {
+		t.Errorf("second line should be the response: %s", lines[1])
+	}
+}
+
+func TestHandleMCP_JSONSkipsNotifications(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	command, args, env := mcptest.Command(mcptest.ModeCompliant)
+
+	server, err := NewServer(&Config{
+		Port:             8080,
+		Command:          command,
+		Args:             args,
+		DefaultEnv:       env,
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+	}, logger)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	// echo はレスポンスの前に notifications/message を出力する
+	w := postMCP(server, `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d (body: %s)", w.Code, http.StatusOK, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"id":7`) || strings.Contains(w.Body.String(), "notifications/message") {
+		t.Errorf("body should be the response only: %s", w.Body.String())
+	}
+}
+
+func TestHandleMCP_NotificationAccepted(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	tests := []struct {
+		name   string
+		accept string
+		body   string
+	}{
+		{name: "通知_JSON", accept: contentTypeJSON, body: `{"jsonrpc":"2.0","method":"notifications/initialized"}`},
+		{name: "通知_SSE", accept: contentTypeSSE, body: `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":1}}`},
+		{name: "レスポンス_JSON", accept: contentTypeJSON, body: `{"jsonrpc":"2.0","id":"s-1","result":{}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 受け取ったメッセージを出力するプロセスでも、クライアントにはボディを返さない
+			server, err := NewServer(&Config{Command: "cat"}, logger)
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+			w := postMCP(server, tt.body, http.Header{"Accept": {tt.accept}})
+			if w.Code != http.StatusAccepted || w.Body.Len() != 0 {
+				t.Errorf("handleMCP() = %d %q, want 202 with an empty body", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleMCP_NDJSON_ProcessFailure(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	cfg := &Config{
+		Port:             8080,
+		Command:          "nonexistent-command-12345",
+		Args:             []string{},
+		DefaultEnv:       map[string]string{},
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+	}
+
+	server, err := NewServer(cfg, logger)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/x-ndjson")
+	w := httptest.NewRecorder()
+
+	server.handleMCP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestHandleMCP_SSE(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	command, args, env := mcptest.Command(mcptest.ModeCompliant)
+
+	cfg := &Config{
+		Port:             8080,
+		Command:          command,
+		Args:             args,
+		DefaultEnv:       env,
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+	}
+
+	server, err := NewServer(cfg, logger)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	body := `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	w := httptest.NewRecorder()
+
+	server.handleMCP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d (body: %s)", w.Code, http.StatusOK, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %s, want text/event-stream", ct)
+	}
+	if vary := w.Header().Get("Vary"); vary != "Accept" {
+		t.Errorf("Vary = %q, want Accept", vary)
+	}
+
+	events := strings.Split(strings.TrimSuffix(w.Body.String(), "\n\n"), "\n\n")
+	if len(events) != 2 {
+		t.Fatalf("event count = %d, want 2 (body: %s)", len(events), w.Body.String())
+	}
+	for _, event := range events {
+		if !strings.HasPrefix(event, "event: message\ndata: {") {
+			t.Errorf("unexpected event format: %q", event)
+		}
+	}
+	if !strings.Contains(events[0], "notifications/message") {
+		t.Errorf("first event should be the notification: %s", events[0])
+	}
+	if !strings.Contains(events[1], `"id":7`) {
+		t.Errorf("second event should be the response: %s", events[1])
+	}
+}
+
+func TestHandleMCP_ContentNegotiation(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	command, args, env := mcptest.Command(mcptest.ModeCompliant)
+
+	cfg := &Config{
+		Port:             8080,
+		Command:          command,
+		Args:             args,
+		DefaultEnv:       env,
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+	}
+
+	server, err := NewServer(cfg, logger)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		accept      string
+		wantStatus  int
+		wantType    string
+	}{
+		{name: "JSONとcharset指定_JSONを返す", contentType: "application/json; charset=utf-8", accept: "application/json", wantStatus: http.StatusOK, wantType: "application/json"},
+		{name: "Acceptなし_JSONを返す", contentType: "application/json", wantStatus: http.StatusOK, wantType: "application/json"},
+		{name: "ワイルドカード_JSONを返す", contentType: "application/json", accept: "*/*", wantStatus: http.StatusOK, wantType: "application/json"},
+		{name: "Content-Typeなし_415", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "テキスト_415", contentType: "text/plain", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "UTF-8以外のcharset_415", contentType: "application/json; charset=latin1", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "対応しないAccept_406", contentType: "application/json", accept: "text/html", wantStatus: http.StatusNotAcceptable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			server.handleMCP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d (body: %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantType != "" {
+				if ct := w.Header().Get("Content-Type"); ct != tt.wantType {
+					t.Errorf("Content-Type = %s, want %s", ct, tt.wantType)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleMCP_RequestRewrites(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	cfg := &Config{
+		Port:             8080,
+		Command:          "cat",
+		Args:             []string{},
+		DefaultEnv:       map[string]string{},
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+		RequestRewrites:  rewrite.Rules{{Method: "tools/invoke", RenameTo: "tools/call"}},
+	}
+
+	server, err := NewServer(cfg, logger)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/invoke"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.handleMCP(w, req)
+
+	// cat はリクエストをそのまま返すため、書き換え後のメソッド名が含まれる
+	if !strings.Contains(w.Body.String(), `"method":"tools/call"`) {
+		t.Errorf("request should be rewritten before reaching the process: got %s", w.Body.String())
+	}
+}
+
+func TestHandleMCP_ResponseTransforms(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	command, args, env := mcptest.Command(mcptest.ModeCompliant)
+
+	cfg := &Config{
+		Port:             8080,
+		Command:          command,
+		Args:             args,
+		DefaultEnv:       env,
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+		ResponseTransforms: rewrite.ResponseTransforms{{
+			Method:   "tools/list",
+			Truncate: map[string]int{"result.tools[*].name": 2},
+			Set:      map[string]any{"result._meta.adapter": "tumiki:{{.Method}}"},
+		}},
+	}
+
+	server, err := NewServer(cfg, logger)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		accept string
+	}{
+		{name: "JSONレスポンス_変換が適用される", accept: "application/json"},
+		{name: "NDJSONレスポンス_変換が適用される", accept: "application/x-ndjson"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`
+			req := httptest.NewRequest("POST", "/mcp", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			server.handleMCP(w, req)
+
+			got := w.Body.String()
+			if !strings.Contains(got, `ec… [truncated 2 characters]`) || !strings.Contains(got, `"adapter":"tumiki:tools/list"`) {
+				t.Errorf("response should be transformed: got %s", got)
+			}
+		})
+	}
+}
+
+func TestHandleMCP_Compression(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	// 圧縮フレームをそのまま返すサーバーで、HTTP クライアントには平文が届くことを検証
+	cfg := &Config{
+		Port:             8080,
+		Command:          "sh",
+		Args:             []string{"-c", `read line; echo "$line"`},
+		DefaultEnv:       map[string]string{},
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+		Compression:      process.CompressionGzip,
+	}
+
+	server, err := NewServer(cfg, logger)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	body := `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.handleMCP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != body {
+		t.Errorf("handleMCP() = %d %s, want 200 %s", w.Code, w.Body.String(), body)
+	}
+}
+
+func TestHandleMCP_FramingAuto(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	command, args, env := mcptest.Command(mcptest.ModeContentLength)
+
+	// Content-Length でしか読み書きしないサーバーでも、判定した区切り方で応答が得られることを検証
+	cfg := &Config{
+		Port:             8080,
+		Command:          command,
+		Args:             args,
+		DefaultEnv:       env,
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+		Framing:          process.FramingAuto,
+	}
+
+	server, err := NewServer(cfg, logger)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	for range 2 {
+		w := postMCP(server, `{"jsonrpc":"2.0","id":1,"method":"ping"}`, nil)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"result"`) {
+			t.Fatalf("handleMCP() = %d %s, want a ping result", w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestHandleMCP_PayloadPolicy(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	echo := []string{"-c", `read line; printf '%s\n' "$line"`}
+	dirtyOutput := []string{"-c", `read line; printf '{"a":"\377"}\n'`}
+
+	tests := []struct {
+		name     string
+		args     []string
+		request  sanitize.Policy
+		response sanitize.Policy
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "リクエスト検証_不正なUTF8は400",
+			args:     echo,
+			request:  sanitize.PolicyValidate,
+			body:     "{\"a\":\"\xff\"}",
+			wantCode: http.StatusBadRequest,
+			wantBody: "invalid request payload: invalid UTF-8 at byte 6",
+		},
+		{
+			name:     "リクエスト正規化_BOMと制御文字を除去して転送",
+			args:     echo,
+			request:  sanitize.PolicySanitize,
+			body:     "\xEF\xBB\xBF{\"a\":\"x\x01y\"}",
+			wantCode: http.StatusOK,
+			wantBody: `{"a":"xy"}`,
+		},
+		{
+			name:     "レスポンス検証_不正なUTF8は500",
+			args:     dirtyOutput,
+			response: sanitize.PolicyValidate,
+			body:     `{}`,
+			wantCode: http.StatusInternalServerError,
+			wantBody: "Response processing failed",
+		},
+		{
+			name:     "レスポンス正規化_置換文字に置き換え",
+			args:     dirtyOutput,
+			response: sanitize.PolicySanitize,
+			body:     `{}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"a":"�"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewServer(&Config{
+				Port:             8080,
+				Command:          "sh",
+				Args:             tt.args,
+				DefaultEnv:       map[string]string{},
+				HeaderEnvMapping: map[string]string{},
+				HeaderArgMapping: map[string]string{},
+				RequestPayload:   tt.request,
+				ResponsePayload:  tt.response,
+			}, logger)
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+
+			req := httptest.NewRequest("POST", "/mcp", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			server.handleMCP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandleMCP_WorkspaceQuota(t *testing.T) {
+	server, err := NewServer(&Config{
+		Command:    "sh",
+		Args:       []string{"-c", `head -c 4096 /dev/zero > "$MCP_WORKSPACE/big"; exec sleep 5`},
+		DefaultEnv: map[string]string{},
+		Workspace:  &process.WorkspaceConfig{Dir: t.TempDir(), MaxBytes: 1024},
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/call"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.handleMCP(w, req)
+
+	if w.Code != http.StatusInsufficientStorage {
+		t.Errorf("Status = %d, want %d (body: %s)", w.Code, http.StatusInsufficientStorage, w.Body.String())
+	}
+}
+
+func TestServer_GoroutineMetrics(t *testing.T) {
+	server, err := NewServer(&Config{Command: "cat", Metrics: true}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{"tumiki_goroutines ", "tumiki_process_goroutines "} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
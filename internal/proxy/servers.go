@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// serversPathPrefix は名前付きのサーバーの MCP エンドポイント（/servers/{name}/mcp）のパスの接頭辞です。
+const serversPathPrefix = "/servers/"
+
+// headerServer は名前付きのサーバーへのリクエストでサーバー名を渡す内部ヘッダーです。
+// クライアントが送った同名のヘッダーは受信時に上書き・削除します。
+const headerServer = "X-Tumiki-Server"
+
+// serverNamePattern はパスに使えるサーバー名です。
+var serverNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ServerDefinition は /servers/{name}/mcp で公開する名前付きのサーバーの設定です。
+// 環境変数・引数のマッピングはサーバーごとに独立しており、/mcp の DefaultEnv・マッピング・スクリプトは適用しません。
+type ServerDefinition struct {
+	Command          string            // stdio コマンド（必須）
+	Args             []string          // コマンド引数
+	DefaultEnv       map[string]string // デフォルト環境変数
+	HeaderEnvMapping map[string]string // ヘッダー→環境変数マッピング
+	HeaderArgMapping map[string]string // ヘッダー→引数マッピング
+	RequiredEnv      []string          // プロセスの起動に必要な環境変数（Config.RequiredEnv と同じ）
+}
+
+// namedServer は検証済みの名前付きのサーバーです。
+type namedServer struct {
+	backend          *Backend // Version はサーバー名
+	defaultEnv       map[string]string
+	headerEnvMapping map[string]string
+	headerArgMapping map[string]string
+	requiredEnv      *requiredEnv // リクエストごとに検証する必要な環境変数（nil で無効）
+}
+
+// equal は起動するプロセスに関わる定義（コマンド・引数・環境変数・ヘッダーマッピング）が同じかを返します。
+func (n *namedServer) equal(other *namedServer) bool {
+	return n.backend.identity() == other.backend.identity() &&
+		slices.Equal(n.backend.Args, other.backend.Args) &&
+		maps.Equal(n.defaultEnv, other.defaultEnv) &&
+		maps.Equal(n.headerEnvMapping, other.headerEnvMapping) &&
+		maps.Equal(n.headerArgMapping, other.headerArgMapping)
+}
+
+// ValidateServerName はサーバー名がパスに使える形式かを検証します。
+func ValidateServerName(name string) error {
+	if !serverNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid server name %q: use lowercase letters, digits, '-' and '_'", name)
+	}
+	return nil
+}
+
+// newNamedServers は名前付きのサーバーの設定を検証し、ヘッダー名を正規化します。
+func newNamedServers(cfg *Config) (map[string]*namedServer, error) {
+	servers := make(map[string]*namedServer, len(cfg.Servers))
+	for name, def := range cfg.Servers {
+		if err := ValidateServerName(name); err != nil {
+			return nil, err
+		}
+		if def.Command == "" {
+			return nil, fmt.Errorf("server %s: command is required", name)
+		}
+		envMapping, err := normalizeHeaderMapping(def.HeaderEnvMapping)
+		if err != nil {
+			return nil, fmt.Errorf("server %s: header-env mapping: %w", name, err)
+		}
+		argMapping, err := normalizeHeaderMapping(def.HeaderArgMapping)
+		if err != nil {
+			return nil, fmt.Errorf("server %s: header-arg mapping: %w", name, err)
+		}
+		requiredEnv, err := newRequiredEnv(cfg, def.RequiredEnv, envSources{
+			defaultEnv:       def.DefaultEnv,
+			headerEnvMapping: envMapping,
+			envFlag:          "--server-env",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("server %s: %w", name, err)
+		}
+		servers[name] = &namedServer{
+			backend: &Backend{
+				Version: name,
+				Command: def.Command,
+				Args:    def.Args,
+				Runtime: cfg.Runtime,
+			},
+			defaultEnv:       maps.Clone(def.DefaultEnv),
+			headerEnvMapping: envMapping,
+			headerArgMapping: argMapping,
+			requiredEnv:      requiredEnv,
+		}
+	}
+	return servers, nil
+}
+
+// serverNameFromPath は /servers/{name}/mcp のパスからサーバー名を返します。
+func serverNameFromPath(path string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, serversPathPrefix)
+	if !ok {
+		return "", false
+	}
+	name, ok := strings.CutSuffix(rest, "/mcp")
+	if !ok || strings.Contains(name, "/") {
+		return "", false
+	}
+	return name, true
+}
+
+// withServerName はパスが名前付きのサーバーのものであればサーバー名を headerServer に設定し、
+// そうでなければクライアントが送った headerServer を削除したヘッダーを返します。元のヘッダーは変更しません。
+func withServerName(header http.Header, path string) http.Header {
+	header = header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	if name, ok := serverNameFromPath(path); ok {
+		header.Set(headerServer, name)
+	} else {
+		header.Del(headerServer)
+	}
+	return header
+}
+
+// namedServerFor はリクエストの送り先の名前付きのサーバーを返します。/mcp へのリクエストでは nil を返します。
+func (s *Server) namedServerFor(header http.Header) *namedServer {
+	servers := s.defs().servers
+	if len(servers) == 0 {
+		return nil
+	}
+	return servers[header.Get(headerServer)]
+}
+
+// backendFor はリクエストを実行するコマンドを返します。名前付きのサーバーへのリクエストではそのサーバーのコマンドを返します。
+func (s *Server) backendFor(header http.Header) *Backend {
+	if server := s.namedServerFor(header); server != nil {
+		return server.backend
+	}
+	return s.backends.current()
+}
+
+// headerMappings はリクエストに適用するヘッダー→環境変数・引数マッピングを返します。
+func (s *Server) headerMappings(header http.Header) (map[string]string, map[string]string) {
+	if server := s.namedServerFor(header); server != nil {
+		return server.headerEnvMapping, server.headerArgMapping
+	}
+	defs := s.defs()
+	return defs.headerEnvMapping, defs.headerArgMapping
+}
+
+// routeServer は名前付きのサーバーのエンドポイントで、設定されていないサーバー名のリクエストに 404 を返します。
+func (s *Server) routeServer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := s.defs().servers[r.PathValue("name")]; !ok {
+			http.Error(w, "server not found", http.StatusNotFound)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// echoEnvScript はリクエストに NAME と TOKEN の環境変数と引数を result に入れて応答するスクリプトです。
+const echoEnvScript = `read line; printf '{"jsonrpc":"2.0","id":1,"result":"%s:%s:%s"}\n' "$NAME" "$TOKEN" "$*"`
+
+func TestHandleMCP_NamedServers(t *testing.T) {
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", echoEnvScript, "sh"},
+		DefaultEnv:       map[string]string{"NAME": "default"},
+		HeaderEnvMapping: map[string]string{"X-Token": "TOKEN"},
+		Servers: map[string]ServerDefinition{
+			"github": {
+				Command:          "sh",
+				Args:             []string{"-c", echoEnvScript, "sh"},
+				DefaultEnv:       map[string]string{"NAME": "github"},
+				HeaderEnvMapping: map[string]string{"X-Github-Token": "TOKEN"},
+			},
+			"slack": {
+				Command:          "sh",
+				Args:             []string{"-c", echoEnvScript, "sh"},
+				DefaultEnv:       map[string]string{"NAME": "slack"},
+				HeaderArgMapping: map[string]string{"X-Slack-Team": "team"},
+			},
+		},
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		headers  map[string]string
+		wantCode int
+		want     string
+	}{
+		{
+			name:     "デフォルトのサーバー_mcp のマッピング",
+			path:     "/mcp",
+			headers:  map[string]string{"X-Token": "a", "X-Github-Token": "b"},
+			wantCode: http.StatusOK,
+			want:     `"result":"default:a:"`,
+		},
+		{
+			name:     "名前付きのサーバー_サーバーのマッピング",
+			path:     "/servers/github/mcp",
+			headers:  map[string]string{"X-Token": "a", "X-Github-Token": "b"},
+			wantCode: http.StatusOK,
+			want:     `"result":"github:b:"`,
+		},
+		{
+			name:     "引数のマッピング_サーバーごと",
+			path:     "/servers/slack/mcp",
+			headers:  map[string]string{"X-Slack-Team": "T1"},
+			wantCode: http.StatusOK,
+			want:     `"result":"slack::--team T1"`,
+		},
+		{
+			name:     "内部ヘッダーの偽装_無視",
+			path:     "/mcp",
+			headers:  map[string]string{headerServer: "github"},
+			wantCode: http.StatusOK,
+			want:     `"result":"default::"`,
+		},
+		{
+			name:     "設定されていないサーバー_404",
+			path:     "/servers/unknown/mcp",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			req.Header.Set("Content-Type", "application/json")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("body = %q, want to contain %q", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestNewServer_NamedServers(t *testing.T) {
+	tests := []struct {
+		name    string
+		servers map[string]ServerDefinition
+		shared  bool
+		wantErr string
+	}{
+		{name: "正常_成功", servers: map[string]ServerDefinition{"github-v2": {Command: "cat"}}},
+		{name: "大文字の名前_エラー", servers: map[string]ServerDefinition{"GitHub": {Command: "cat"}}, wantErr: "invalid server name"},
+		{name: "スラッシュを含む名前_エラー", servers: map[string]ServerDefinition{"a/b": {Command: "cat"}}, wantErr: "invalid server name"},
+		{name: "コマンドなし_エラー", servers: map[string]ServerDefinition{"github": {}}, wantErr: "server github: command is required"},
+		{
+			name:    "不正なマッピング_エラー",
+			servers: map[string]ServerDefinition{"github": {Command: "cat", HeaderEnvMapping: map[string]string{"X-Token": "A", "x-token": "B"}}},
+			wantErr: "server github: header-env mapping",
+		},
+		{name: "共有プロセス_エラー", servers: map[string]ServerDefinition{"github": {Command: "cat"}}, shared: true, wantErr: "named servers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewServer(&Config{Command: "cat", Servers: tt.servers, SharedProcess: tt.shared}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewServer() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+			if server.shared != nil {
+				_ = server.shared.Close()
+			}
+		})
+	}
+}
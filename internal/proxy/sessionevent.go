@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/webhook"
+)
+
+// sessionTransportLongPoll は Webhook のイベントでロングポーリングのセッションを表すトランスポートです。
+const sessionTransportLongPoll = "long-poll"
+
+// errSessionProcessExited はセッションのプロセスが終了の原因を残さずに終了したことを表します。
+var errSessionProcessExited = errors.New("session process exited")
+
+// sessionMetadata は Webhook のイベントに含めるセッションのメタデータを、認証で設定した内部ヘッダーから作成します。
+func sessionMetadata(id, transport, protocolVersion, version string, header http.Header, createdAt time.Time) webhook.Session {
+	return webhook.Session{
+		ID:              id,
+		Transport:       transport,
+		ProtocolVersion: protocolVersion,
+		Version:         version,
+		Tenant:          header.Get(headerTenant),
+		APIKeyID:        header.Get(headerAPIKeyID),
+		AuthMethod:      header.Get(headerAuthMethod),
+		Principal:       header.Get(headerPrincipal),
+		CreatedAt:       createdAt,
+	}
+}
+
+// notifySession はセッションのイベントを Webhook に通知します。Webhook が設定されていない場合は何もしません。
+// session.error のイベントでは err を原因として含めます（nil か io.EOF の場合は errSessionProcessExited）。
+func (s *Server) notifySession(eventType string, session webhook.Session, reason string, err error) {
+	if s.sessionEvents == nil {
+		return
+	}
+	event := webhook.Event{Type: eventType, Session: session, Reason: reason}
+	if eventType == webhook.EventSessionError {
+		if err == nil || errors.Is(err, io.EOF) {
+			err = errSessionProcessExited
+		}
+		event.Error = err.Error()
+	}
+	s.sessionEvents.Notify(event)
+}
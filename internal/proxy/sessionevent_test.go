@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/webhook"
+)
+
+// newWebhookReceiver は受け取ったイベントをチャネルに渡す Webhook を起動し、その設定を返します。
+func newWebhookReceiver(t *testing.T) (*webhook.Config, <-chan webhook.Event) {
+	t.Helper()
+	events := make(chan webhook.Event, 16)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhook.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("decode event: %v", err)
+		}
+		events <- event
+	}))
+	t.Cleanup(receiver.Close)
+	return &webhook.Config{URL: receiver.URL}, events
+}
+
+// runSessionEvents は Start の代わりにセッションのイベントの送信を始めます。
+func runSessionEvents(t *testing.T, server *Server) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.sessionEvents.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// nextSessionEvent は次のイベントを待ち、種類が want であることを確かめます。
+func nextSessionEvent(t *testing.T, events <-chan webhook.Event, want string) webhook.Event {
+	t.Helper()
+	select {
+	case event := <-events:
+		if event.Type != want {
+			t.Fatalf("event = %+v, want %s", event, want)
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s was not delivered", want)
+		return webhook.Event{}
+	}
+}
+
+// initializeSession は initialize でセッションを作成し、その ID を返します。
+func initializeSession(t *testing.T, url string, header http.Header) string {
+	t.Helper()
+	req, _ := http.NewRequest("POST", url+"/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`))
+	req.Header = header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	id := resp.Header.Get(headerSessionID)
+	if id == "" {
+		t.Fatalf("initialize status = %d, want a session id", resp.StatusCode)
+	}
+	return id
+}
+
+func TestSessionEvents(t *testing.T) {
+	hook, events := newWebhookReceiver(t)
+	server, httpServer := newSessionServer(t, &Config{Sessions: true, SessionTTL: time.Minute, SessionWebhook: hook})
+	runSessionEvents(t, server)
+	now := time.Now()
+	server.subscriptions.now = func() time.Time { return now }
+
+	// 作成したセッションを、認証で設定したテナントとキーとともに通知する
+	id := initializeSession(t, httpServer.URL, http.Header{headerTenant: {"acme"}, headerAPIKeyID: {"key1"}})
+	created := nextSessionEvent(t, events, webhook.EventSessionCreated)
+	want := webhook.Session{ID: id, Transport: TransportStreamableHTTP, ProtocolVersion: "2025-06-18", Version: DefaultBackendVersion, Tenant: "acme", APIKeyID: "key1", CreatedAt: created.Session.CreatedAt}
+	if created.Session != want {
+		t.Errorf("session = %+v, want %+v", created.Session, want)
+	}
+
+	// クライアントが DELETE で終了させたセッション（セッションを作成したキーで終了させる）
+	req, _ := http.NewRequest("DELETE", httpServer.URL+"/mcp", nil)
+	req.Header.Set(headerSessionID, id)
+	req.Header.Set(headerAPIKeyID, "key1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if got := nextSessionEvent(t, events, webhook.EventSessionTerminated); got.Session.ID != id || got.Reason != webhook.ReasonClient {
+		t.Errorf("terminated = %+v, want the session terminated by the client", got)
+	}
+
+	// 保持期間を過ぎたセッション
+	id = initializeSession(t, httpServer.URL, http.Header{})
+	nextSessionEvent(t, events, webhook.EventSessionCreated)
+	now = now.Add(time.Minute + time.Second)
+	server.subscriptions.evictExpired()
+	if got := nextSessionEvent(t, events, webhook.EventSessionExpired); got.Session.ID != id {
+		t.Errorf("expired session = %q, want %q", got.Session.ID, id)
+	}
+
+	// サーバーの停止で終了させたセッション
+	id = initializeSession(t, httpServer.URL, http.Header{})
+	nextSessionEvent(t, events, webhook.EventSessionCreated)
+	server.subscriptions.close()
+	if got := nextSessionEvent(t, events, webhook.EventSessionTerminated); got.Session.ID != id || got.Reason != webhook.ReasonShutdown {
+		t.Errorf("terminated = %+v, want the session terminated by the shutdown", got)
+	}
+}
+
+func TestSessionEvents_ProcessExit(t *testing.T) {
+	hook, events := newWebhookReceiver(t)
+	// initialize に応答した直後に終了するプロセス
+	server, err := NewServer(&Config{
+		Command:        "sh",
+		Args:           []string{"-c", `read line; echo '{"jsonrpc":"2.0","id":1,"result":{"protocolVersion":"2025-06-18","capabilities":{},"serverInfo":{"name":"test","version":"1"}}}'; exit 3`},
+		DefaultEnv:     map[string]string{},
+		Sessions:       true,
+		SessionWebhook: hook,
+	}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	runSessionEvents(t, server)
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+	defer server.subscriptions.close()
+
+	id := initializeSession(t, httpServer.URL, http.Header{})
+	nextSessionEvent(t, events, webhook.EventSessionCreated)
+	if got := nextSessionEvent(t, events, webhook.EventSessionError); got.Session.ID != id || got.Error == "" {
+		t.Errorf("error event = %+v, want the session with the cause", got)
+	}
+}
+
+func TestSessionEvents_LongPoll(t *testing.T) {
+	hook, events := newWebhookReceiver(t)
+	server := newPollServer(t, "cat", nil, map[string]string{})
+	var err error
+	if server.sessionEvents, err = webhook.NewNotifier(*hook, slog.Default()); err != nil {
+		t.Fatal(err)
+	}
+	runSessionEvents(t, server)
+
+	id, _, err := server.polls.create(http.Header{headerPrincipal: {"alice"}}, "2025-06-18")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := nextSessionEvent(t, events, webhook.EventSessionCreated)
+	if created.Session.ID != id || created.Session.Transport != sessionTransportLongPoll || created.Session.Principal != "alice" {
+		t.Errorf("session = %+v, want the long-poll session of alice", created.Session)
+	}
+
+	server.polls.remove(id, io.ErrUnexpectedEOF)
+	if got := nextSessionEvent(t, events, webhook.EventSessionError); got.Error != io.ErrUnexpectedEOF.Error() {
+		t.Errorf("error = %q, want %q", got.Error, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestNewServer_SessionWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		hook    *webhook.Config
+		wantErr bool
+	}{
+		{name: "未指定", hook: nil},
+		{name: "URLを指定", hook: &webhook.Config{URL: "https://hooks.example.com/sessions"}},
+		{name: "不正なURL_エラー", hook: &webhook.Config{URL: "hooks.example.com"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewServer(&Config{Command: "cat", SessionWebhook: tt.hook}, slog.Default())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewServer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mux"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// validateSharedProcess は共有プロセスと併用できない設定を検証します。
+func validateSharedProcess(cfg *Config) error {
+	if cfg.WarmStandby != nil || cfg.ProcessReuse != nil {
+		return fmt.Errorf("shared process cannot be combined with warm standby or process reuse")
+	}
+	if cfg.Sessions || cfg.Subscriptions {
+		// GET /mcp は共有プロセスの通知のストリームに使う
+		return fmt.Errorf("shared process cannot be combined with sessions or subscriptions")
+	}
+	if len(cfg.HeaderEnvMapping) > 0 || len(cfg.HeaderArgMapping) > 0 || len(cfg.HeaderArgOverride) > 0 ||
+		len(cfg.HeaderArgRemoval) > 0 || len(cfg.MappingRules) > 0 || len(cfg.Scripts) > 0 || cfg.FileStaging {
+		// 全てのリクエストを同じ環境変数・引数で起動したプロセスで実行するため、リクエストごとの値を渡せない
+		return fmt.Errorf("shared process cannot be combined with header mappings, scripts or file staging")
+	}
+	if len(cfg.Servers) > 0 {
+		return fmt.Errorf("shared process cannot be combined with named servers")
+	}
+	return nil
+}
+
+// newSharedProcess は全てのリクエストで共有するプロセスを作成し、状態をメトリクスに登録します。
+// プロセスは起動するたびにその時点の有効なバックエンドで作成します。
+func (s *Server) newSharedProcess() {
+	start := func(ctx context.Context) (*process.Session, error) {
+		return s.newExecutor(http.Header{}).Start(ctx)
+	}
+	s.shared = mux.New(start, mux.Config{
+		ProtocolVersion:   subscriptionProtocolVersion,
+		InitializeTimeout: s.initializeTimeout(),
+	}, s.logger)
+
+	s.metrics.GaugeFunc("tumiki_shared_process_in_flight", "Number of requests waiting for the shared process to respond.", func() float64 {
+		return float64(s.shared.Stats().InFlight)
+	})
+	s.metrics.GaugeFunc("tumiki_shared_process_subscribers", "Number of GET /mcp streams receiving notifications from the shared process.", func() float64 {
+		return float64(s.shared.Stats().Subscribers)
+	})
+	s.metrics.CounterFunc("tumiki_shared_process_requests_total", "Number of requests run on the shared process.", func() float64 {
+		return float64(s.shared.Stats().Requests)
+	})
+	s.metrics.CounterFunc("tumiki_shared_process_starts_total", "Number of times the shared process was started.", func() float64 {
+		return float64(s.shared.Stats().Starts)
+	})
+}
+
+// streamProcess は executor.Stream と同じように、プロセスが出力したメッセージを emit に渡します。
+// 共有プロセスが有効な場合は共有プロセスで実行し、リクエストのレスポンスだけを渡します（通知は GET /mcp で配信します）。
+func (s *Server) streamProcess(ctx context.Context, executor *process.Executor, body []byte, emit func(msg []byte) error) error {
+	if s.shared == nil {
+		return executor.Stream(ctx, body, emit)
+	}
+	response, err := s.shared.Call(ctx, body)
+	if err != nil || response == nil {
+		return err
+	}
+	return emit(response)
+}
+
+// handleSharedStream は GET /mcp を処理し、共有プロセスが送る通知をクライアントが切断するまで SSE で返します。
+// Accept が SSE を受け付けない場合は 406 を返します。
+func (s *Server) handleSharedStream(w http.ResponseWriter, r *http.Request) {
+	if accept := r.Header.Get("Accept"); accept != "" && acceptQuality(accept, contentTypeSSE) <= 0 {
+		http.Error(w, "Not Acceptable: GET /mcp only returns text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+	notifications, unsubscribe := s.shared.Subscribe()
+	defer unsubscribe()
+
+	// 通知を待ち続けるため、サーバーの WriteTimeout で切断されないようにする
+	controller := http.NewResponseController(w)
+	_ = controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", contentTypeSSE)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	_ = controller.Flush()
+
+	var keepAlive <-chan time.Time
+	if s.cfg.KeepAliveInterval > 0 {
+		ticker := time.NewTicker(s.cfg.KeepAliveInterval)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+
+	ctx := s.offloadContext(r.Context(), r.Header)
+	for {
+		var err error
+		select {
+		case msg, ok := <-notifications:
+			if !ok {
+				return
+			}
+			if msg, err = s.processResponse(ctx, msg, ""); err != nil {
+				s.logger.Error("Response processing failed", "error", err)
+				continue
+			}
+			err = writeSSEFrame(w, msg)
+		case <-keepAlive:
+			err = writeSSEKeepAlive(w)
+		case <-r.Context().Done():
+			return
+		}
+		if err == nil {
+			err = controller.Flush()
+		}
+		if err != nil {
+			s.logger.Debug("Failed to write notification", "error", err)
+			return
+		}
+	}
+}
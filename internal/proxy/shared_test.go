@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// newSharedServer は共有プロセスを有効にした Server を作成します。
+// プロセスはリクエストごとに result に PID を入れたレスポンスを返し、notifications/test を受け取ると通知を出力します。
+func newSharedServer(t *testing.T) *Server {
+	t.Helper()
+	script := `while read line; do
+case "$line" in
+*'"method":"notifications/test"'*) echo '{"jsonrpc":"2.0","method":"notifications/message","params":{"data":"test"}}' ;;
+*'"method":"notifications/'*) ;;
+*) printf '%s\n' "$line" | sed "s/\"method\":\"[^\"]*\"/\"result\":{\"pid\":$$}/" ;;
+esac
+done`
+	server, err := NewServer(&Config{
+		Command:       "sh",
+		Args:          []string{"-c", script},
+		SharedProcess: true,
+		Metrics:       true,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	t.Cleanup(func() { _ = server.shared.Close() })
+	return server
+}
+
+func TestHandleMCP_SharedProcess(t *testing.T) {
+	server := newSharedServer(t)
+
+	// 全てのリクエストを同じプロセスで実行し、クライアントの ID で返す
+	first := postForPID(t, server, "tools/list", "")
+	if got := postForPID(t, server, "tools/call", ""); got != first {
+		t.Errorf("pid = %d, want the shared process %d", got, first)
+	}
+
+	// initialize には共有プロセスを初期化した結果を返す
+	if got := postForPID(t, server, "initialize", ""); got != first {
+		t.Errorf("initialize pid = %d, want the shared process %d", got, first)
+	}
+
+	// SSE を受け付けるクライアントにはレスポンスを1つのイベントで返す
+	w := postMCP(server, `{"jsonrpc":"2.0","id":"a","method":"ping"}`, http.Header{"Accept": {contentTypeSSE}})
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), `event: message`+"\n"+`data: {"id":"a"`) {
+		t.Errorf("SSE response = %d %q, want a single message event", w.Code, w.Body.String())
+	}
+
+	// 通知はプロセスに送って 202 を返す
+	if w := postMCP(server, `{"jsonrpc":"2.0","method":"notifications/initialized"}`, nil); w.Code != http.StatusAccepted {
+		t.Errorf("notification status = %d, want 202", w.Code)
+	}
+
+	if stats := server.shared.Stats(); stats.Starts != 1 || stats.Requests != 4 {
+		t.Errorf("Stats() = %+v, want 1 start and 4 requests", stats)
+	}
+}
+
+func TestHandleSharedStream(t *testing.T) {
+	server := newSharedServer(t)
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/mcp", nil)
+	req.Header.Set("Accept", contentTypeSSE)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != contentTypeSSE {
+		t.Fatalf("GET /mcp = %d %s, want an event stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// 共有プロセスの通知を GET /mcp のストリームに配信する
+	if w := postMCP(server, `{"jsonrpc":"2.0","method":"notifications/test"}`, nil); w.Code != http.StatusAccepted {
+		t.Fatalf("notification status = %d, want 202", w.Code)
+	}
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		if data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: "); ok {
+			var msg struct {
+				Method string `json:"method"`
+			}
+			if err := json.Unmarshal([]byte(data), &msg); err != nil || msg.Method != "notifications/message" {
+				t.Errorf("data = %s, want notifications/message", data)
+			}
+			break
+		}
+	}
+
+	// セッションはないため DELETE /mcp は 405
+	del, _ := http.NewRequest(http.MethodDelete, ts.URL+"/mcp", nil)
+	delResp, err := http.DefaultClient.Do(del)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delResp.Body.Close()
+	if delResp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE /mcp status = %d, want 405", delResp.StatusCode)
+	}
+}
+
+func TestNewServer_SharedProcess(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "単独_成功", cfg: Config{}},
+		{name: "デフォルト環境変数_成功", cfg: Config{DefaultEnv: map[string]string{"TOKEN": "a"}}},
+		{name: "予備プロセス_エラー", cfg: Config{WarmStandby: &process.StandbyConfig{Min: 1, Max: 1}}, wantErr: true},
+		{name: "プロセスの再利用_エラー", cfg: Config{ProcessReuse: &process.CacheConfig{}}, wantErr: true},
+		{name: "セッション_エラー", cfg: Config{Sessions: true}, wantErr: true},
+		{name: "ヘッダーマッピング_エラー", cfg: Config{HeaderEnvMapping: map[string]string{"X-Token": "TOKEN"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.Command = "cat"
+			cfg.SharedProcess = true
+			server, err := NewServer(&cfg, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewServer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if server != nil {
+				_ = server.shared.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// ShutdownReport はシャットダウンの最後にログに出力する、起動から停止までの結果のまとめです。
+// デプロイ後の確認や障害の時系列の整理に使います。
+type ShutdownReport struct {
+	StartedAt       time.Time `json:"startedAt"`
+	StoppedAt       time.Time `json:"stoppedAt"`
+	RequestsServed  int64     `json:"requestsServed"`  // 起動してから処理した MCP のリクエストの数
+	SessionsClosed  int64     `json:"sessionsClosed"`  // 停止で終了させたセッションの数
+	ProcessesKilled int64     `json:"processesKilled"` // 停止で終了させたセッションのうち、終了しなかったため強制終了したプロセスの数
+	DrainMs         int64     `json:"drainMs"`         // 停止の開始から全ての終了処理が完了するまでの時間
+	Errors          []string  `json:"errors"`          // 停止の間に起きたエラー
+}
+
+// drainStats は停止の間の結果を数えます。
+type drainStats struct {
+	startedAt       time.Time // 停止を開始した時刻（ゼロ値で停止していない）
+	sessionsClosed  atomic.Int64
+	processesKilled atomic.Int64
+
+	mu     sync.Mutex
+	errors []string
+}
+
+// sessionClosed は停止で終了させたセッションを数えます。err はセッションの終了のエラーです。
+func (d *drainStats) sessionClosed(session *process.Session, err error) {
+	d.sessionsClosed.Add(1)
+	if session.Killed() {
+		d.processesKilled.Add(1)
+	}
+	if err != nil {
+		d.fail("close session", err)
+	}
+}
+
+// fail は停止の間に起きたエラーを記録します。
+func (d *drainStats) fail(action string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.errors = append(d.errors, fmt.Sprintf("%s: %v", action, err))
+}
+
+// shutdownReport は停止の結果をまとめます。
+func (s *Server) shutdownReport(startedAt, stoppedAt time.Time) ShutdownReport {
+	d := &s.drain
+	d.mu.Lock()
+	errs := append([]string{}, d.errors...)
+	d.mu.Unlock()
+	return ShutdownReport{
+		StartedAt:       startedAt,
+		StoppedAt:       stoppedAt,
+		RequestsServed:  s.observer.served.Load(),
+		SessionsClosed:  d.sessionsClosed.Load(),
+		ProcessesKilled: d.processesKilled.Load(),
+		DrainMs:         stoppedAt.Sub(d.startedAt).Milliseconds(),
+		Errors:          errs,
+	}
+}
+
+// writeShutdownReport は停止の結果をログに出力し、ShutdownReportPath が指定されている場合は JSON でファイルに書き込みます。
+func (s *Server) writeShutdownReport(report ShutdownReport) {
+	s.logger.Info("Shutdown report",
+		slog.Time("started_at", report.StartedAt),
+		slog.Int64("requests_served", report.RequestsServed),
+		slog.Int64("sessions_closed", report.SessionsClosed),
+		slog.Int64("processes_killed", report.ProcessesKilled),
+		slog.Duration("drain_duration", time.Duration(report.DrainMs)*time.Millisecond),
+		slog.Any("errors", report.Errors))
+	if s.cfg.ShutdownReportPath == "" {
+		return
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err == nil {
+		err = os.WriteFile(s.cfg.ShutdownReportPath, append(data, '\n'), 0o644)
+	}
+	if err != nil {
+		s.logger.Error("Failed to write shutdown report", "path", s.cfg.ShutdownReportPath, "error", err)
+	}
+}
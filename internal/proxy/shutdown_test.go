@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServer_ShutdownReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shutdown.json")
+	server, httpServer := newSessionServer(t, &Config{Host: "127.0.0.1", Sessions: true, ShutdownReportPath: path})
+
+	id := initializeSession(t, httpServer.URL, http.Header{})
+	resp := subscriptionRequest(t, "POST", httpServer.URL, id, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	_ = resp.Body.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error, 1)
+	go func() { errChan <- server.Start(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-errChan:
+		if err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server shutdown timeout")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("shutdown report was not written: %v", err)
+	}
+	var report ShutdownReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("report = %s: %v", data, err)
+	}
+	if report.RequestsServed != 2 || report.SessionsClosed != 1 || report.ProcessesKilled != 0 || len(report.Errors) != 0 {
+		t.Errorf("report = %+v, want 2 requests and 1 closed session without errors", report)
+	}
+	if !report.StoppedAt.After(report.StartedAt) || report.DrainMs < 0 {
+		t.Errorf("report times = %v - %v (drain %dms)", report.StartedAt, report.StoppedAt, report.DrainMs)
+	}
+}
+
+func TestServer_ShutdownReport_起動に失敗_出力しない(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shutdown.json")
+	server, err := NewServer(&Config{Command: "cat", Host: "127.0.0.1", Port: -1, ShutdownReportPath: path}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	if err := server.Start(context.Background()); err == nil {
+		t.Fatal("Start() error = nil, want a listen error")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("shutdown report exists after a failed start: %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 署名付きリクエストのヘッダーです。
+const (
+	headerSignatureTimestamp = "X-Tumiki-Timestamp"      // 署名した時刻（Unix 秒）
+	headerSignatureNonce     = "X-Tumiki-Nonce"          // リクエストごとに一意な値
+	headerSignedHeaders      = "X-Tumiki-Signed-Headers" // 署名に含めたヘッダー名（カンマ区切り）
+	headerSignature          = "X-Tumiki-Signature"      // HMAC-SHA256 の署名（16進）
+)
+
+// 署名の検証の設定のデフォルト値です。
+const (
+	DefaultSignatureMaxSkew = 5 * time.Minute // 署名した時刻と受け取った時刻の差の最大値
+	DefaultNonceCacheSize   = 10000           // 使用済みとして覚えておくノンスの最大数
+)
+
+// maxNonceBytes はノンスの最大バイト数です。
+const maxNonceBytes = 128
+
+// signatureError は署名の検証に失敗した理由です。401 とともにクライアントに返します。
+type signatureError string
+
+func (e signatureError) Error() string { return string(e) }
+
+// requestSigner は HMAC で署名したリクエストを検証し、署名した時刻の鮮度とノンスの一意性で再送を防ぎます。
+type requestSigner struct {
+	key     []byte
+	maxSkew time.Duration
+	now     func() time.Time
+
+	// 署名に含める必要があるヘッダー（プロセスに渡す認証情報を含みうるマッピング元）。設定の再読み込みで置き換える
+	required atomic.Pointer[[]string]
+
+	nonces *nonceCache
+}
+
+func newRequestSigner(key []byte, maxSkew time.Duration, nonceCacheSize int, required []string) *requestSigner {
+	if maxSkew <= 0 {
+		maxSkew = DefaultSignatureMaxSkew
+	}
+	if nonceCacheSize <= 0 {
+		nonceCacheSize = DefaultNonceCacheSize
+	}
+	signer := &requestSigner{
+		key:     key,
+		maxSkew: maxSkew,
+		now:     time.Now,
+		nonces:  newNonceCache(nonceCacheSize),
+	}
+	signer.setRequired(required)
+	return signer
+}
+
+// setRequired は署名に含める必要があるヘッダーを置き換えます。
+func (s *requestSigner) setRequired(required []string) {
+	required = slices.Compact(slices.Sorted(slices.Values(required)))
+	s.required.Store(&required)
+}
+
+// stringToSign は署名する文字列を組み立てます。
+// 時刻・ノンス・メソッド・パス・署名に含めたヘッダー（小文字の名前:値）・ボディの SHA-256 を改行で連結します。
+func stringToSign(r *http.Request, timestamp, nonce string, signed []string, body []byte) string {
+	var b strings.Builder
+	b.WriteString(timestamp + "\n" + nonce + "\n" + r.Method + "\n" + r.URL.RequestURI() + "\n")
+	for _, name := range signed {
+		b.WriteString(strings.ToLower(name) + ":" + strings.Join(r.Header.Values(name), ",") + "\n")
+	}
+	sum := sha256.Sum256(body)
+	b.WriteString(hex.EncodeToString(sum[:]))
+	return b.String()
+}
+
+// sign は署名する文字列の HMAC-SHA256 を16進で返します。
+func (s *requestSigner) sign(data string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify はリクエストの署名を検証し、ノンスを使用済みにします。
+func (s *requestSigner) verify(r *http.Request, body []byte) error {
+	timestamp := r.Header.Get(headerSignatureTimestamp)
+	nonce := r.Header.Get(headerSignatureNonce)
+	signature := r.Header.Get(headerSignature)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return signatureError("missing request signature")
+	}
+	if len(nonce) > maxNonceBytes {
+		return signatureError("nonce is too long")
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return signatureError("invalid signature timestamp")
+	}
+	signedAt := time.Unix(unix, 0)
+	now := s.now()
+	if signedAt.Before(now.Add(-s.maxSkew)) || signedAt.After(now.Add(s.maxSkew)) {
+		return signatureError("signature timestamp is outside the allowed window")
+	}
+
+	var signed []string
+	for name := range strings.SplitSeq(r.Header.Get(headerSignedHeaders), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			signed = append(signed, http.CanonicalHeaderKey(name))
+		}
+	}
+	// マッピングでプロセスに渡すヘッダーは、差し替えて再送できないよう署名に含める必要がある
+	for _, name := range *s.required.Load() {
+		if len(r.Header.Values(name)) > 0 && !slices.Contains(signed, name) {
+			return signatureError("header " + name + " must be signed")
+		}
+	}
+
+	expected := s.sign(stringToSign(r, timestamp, nonce, signed, body))
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected)) {
+		return signatureError("invalid request signature")
+	}
+	// ノンスは時刻の許容範囲を過ぎるまで覚えておけば十分
+	if !s.nonces.add(nonce, signedAt.Add(s.maxSkew), now) {
+		return signatureError("nonce has already been used")
+	}
+	return nil
+}
+
+// verifySignature は署名を検証してから next を呼び出します。ボディは署名の検証のために読み取り、next に渡し直します。
+func (s *Server) verifySignature(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			return
+		}
+		_ = r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if err := s.signer.verify(r, body); err != nil {
+			w.Header().Set("WWW-Authenticate", `Signature realm="mcp"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// signedHeaderNames は署名に含める必要があるヘッダー名を返します。ヘッダーの値をプロセスに渡すマッピングの元です。
+func (s *Server) signedHeaderNames() []string {
+	var names []string
+	defs := s.defs()
+	for _, mapping := range []map[string]string{defs.headerEnvMapping, defs.headerArgMapping, s.argOverrides, s.argRemovals} {
+		for name := range mapping {
+			names = append(names, name)
+		}
+	}
+	for _, rule := range s.cfg.MappingRules {
+		names = append(names, http.CanonicalHeaderKey(rule.Header))
+	}
+	for _, server := range defs.servers {
+		for _, mapping := range []map[string]string{server.headerEnvMapping, server.headerArgMapping} {
+			for name := range mapping {
+				names = append(names, name)
+			}
+		}
+	}
+	if s.cfg.TokenExchange != nil {
+		names = append(names, http.CanonicalHeaderKey(s.tokenExchangeHeader()))
+	}
+	return names
+}
+
+// nonceCache は使用済みのノンスを期限まで覚えておきます。上限を超えた場合は最も古いものから忘れます。
+type nonceCache struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]*list.Element
+	order   *list.List // 先頭ほど新しい nonceEntry
+}
+
+type nonceEntry struct {
+	nonce   string
+	expires time.Time
+}
+
+func newNonceCache(max int) *nonceCache {
+	return &nonceCache{max: max, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// add はノンスを使用済みにします。期限内のノンスを既に使用していた場合は false を返します。
+func (c *nonceCache) add(nonce string, expires, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[nonce]; ok {
+		if now.Before(elem.Value.(*nonceEntry).expires) {
+			return false
+		}
+		c.order.Remove(elem)
+		delete(c.entries, nonce)
+	}
+	c.entries[nonce] = c.order.PushFront(&nonceEntry{nonce: nonce, expires: expires})
+
+	// 期限切れのものと上限を超えた分を古い方から削除する
+	for back := c.order.Back(); back != nil; back = c.order.Back() {
+		entry := back.Value.(*nonceEntry)
+		if c.order.Len() <= c.max && now.Before(entry.expires) {
+			break
+		}
+		c.order.Remove(back)
+		delete(c.entries, entry.nonce)
+	}
+	return true
+}
+
+// len は覚えているノンスの数を返します。
+func (c *nonceCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
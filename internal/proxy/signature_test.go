@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signRequest は鍵でリクエストに署名します。
+func signRequest(r *http.Request, key string, signedAt time.Time, nonce, body string, signed ...string) {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	r.Header.Set(headerSignatureTimestamp, timestamp)
+	r.Header.Set(headerSignatureNonce, nonce)
+	r.Header.Set(headerSignedHeaders, strings.Join(signed, ","))
+	for i, name := range signed {
+		signed[i] = http.CanonicalHeaderKey(name)
+	}
+	signer := &requestSigner{key: []byte(key)}
+	r.Header.Set(headerSignature, signer.sign(stringToSign(r, timestamp, nonce, signed, []byte(body))))
+}
+
+func TestRequestSigner_Verify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`
+
+	tests := []struct {
+		name    string
+		prepare func(r *http.Request)
+		wantErr string
+	}{
+		{
+			name:    "正しい署名_成功",
+			prepare: func(r *http.Request) { signRequest(r, "secret", now, "n-1", body, "x-api-key") },
+		},
+		{
+			name:    "署名なし_エラー",
+			prepare: func(*http.Request) {},
+			wantErr: "missing request signature",
+		},
+		{
+			name:    "異なる鍵_エラー",
+			prepare: func(r *http.Request) { signRequest(r, "other", now, "n-2", body, "x-api-key") },
+			wantErr: "invalid request signature",
+		},
+		{
+			name:    "許容範囲より古い時刻_エラー",
+			prepare: func(r *http.Request) { signRequest(r, "secret", now.Add(-6*time.Minute), "n-3", body, "x-api-key") },
+			wantErr: "outside the allowed window",
+		},
+		{
+			name:    "許容範囲より先の時刻_エラー",
+			prepare: func(r *http.Request) { signRequest(r, "secret", now.Add(6*time.Minute), "n-4", body, "x-api-key") },
+			wantErr: "outside the allowed window",
+		},
+		{
+			name: "署名後にヘッダーを差し替え_エラー",
+			prepare: func(r *http.Request) {
+				signRequest(r, "secret", now, "n-5", body, "x-api-key")
+				r.Header.Set("X-Api-Key", "stolen")
+			},
+			wantErr: "invalid request signature",
+		},
+		{
+			name:    "マッピングするヘッダーを署名に含めない_エラー",
+			prepare: func(r *http.Request) { signRequest(r, "secret", now, "n-6", body) },
+			wantErr: "header X-Api-Key must be signed",
+		},
+		{
+			name: "署名後にボディを差し替え_エラー",
+			prepare: func(r *http.Request) {
+				signRequest(r, "secret", now, "n-7", `{"jsonrpc":"2.0","id":1,"method":"tools/call"}`, "x-api-key")
+			},
+			wantErr: "invalid request signature",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := newRequestSigner([]byte("secret"), 0, 0, []string{"X-Api-Key"})
+			signer.now = func() time.Time { return now }
+
+			r := httptest.NewRequest("POST", "/mcp", strings.NewReader(body))
+			r.Header.Set("X-Api-Key", "key-1")
+			tt.prepare(r)
+			err := signer.verify(r, []byte(body))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("verify() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("verify() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequestSigner_Replay(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	signer := newRequestSigner([]byte("secret"), time.Minute, 0, nil)
+	signer.now = func() time.Time { return now }
+
+	r := httptest.NewRequest("POST", "/mcp", nil)
+	signRequest(r, "secret", now, "n-1", "")
+	if err := signer.verify(r, nil); err != nil {
+		t.Fatalf("first verify() error = %v", err)
+	}
+	// 同じノンスの再送は時刻の許容範囲内では拒否する
+	signer.now = func() time.Time { return now.Add(59 * time.Second) }
+	if err := signer.verify(r, nil); err == nil || !strings.Contains(err.Error(), "already been used") {
+		t.Errorf("replayed verify() error = %v, want nonce reuse", err)
+	}
+	// 許容範囲を過ぎた再送は時刻で拒否する
+	signer.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if err := signer.verify(r, nil); err == nil || !strings.Contains(err.Error(), "outside the allowed window") {
+		t.Errorf("late verify() error = %v, want timestamp rejection", err)
+	}
+}
+
+func TestNonceCache_Add(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	c := newNonceCache(2)
+
+	if !c.add("a", now.Add(time.Minute), now) || !c.add("b", now.Add(time.Minute), now) {
+		t.Fatal("add() of new nonces should succeed")
+	}
+	if c.add("a", now.Add(time.Minute), now) {
+		t.Error("add() of a used nonce should fail")
+	}
+	// 上限を超えると最も古いノンスから忘れる
+	c.add("c", now.Add(time.Minute), now)
+	if got := c.len(); got != 2 {
+		t.Errorf("len() = %d, want 2", got)
+	}
+	if !c.add("a", now.Add(time.Minute), now) {
+		t.Error("the oldest nonce should be evicted")
+	}
+	// 期限切れのノンスは次の追加で削除する
+	later := now.Add(2 * time.Minute)
+	c.add("d", later.Add(time.Minute), later)
+	if got := c.len(); got != 1 {
+		t.Errorf("len() after expiry = %d, want 1", got)
+	}
+}
+
+func TestHandleMCP_RequestSigning(t *testing.T) {
+	server, err := NewServer(&Config{
+		Command:           "cat",
+		HeaderEnvMapping:  map[string]string{"x-api-key": "API_KEY"},
+		RequestSigningKey: []byte("secret"),
+	}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	body := `{"jsonrpc":"2.0","method":"notifications/initialized"}`
+	send := func(nonce string, sign bool) int {
+		req := httptest.NewRequest("POST", "/mcp", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Api-Key", "key-1")
+		if sign {
+			signRequest(req, "secret", time.Now(), nonce, body, "X-Api-Key")
+		}
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if got := send("n-1", true); got != http.StatusAccepted {
+		t.Errorf("signed request status = %d, want %d", got, http.StatusAccepted)
+	}
+	if got := send("n-1", true); got != http.StatusUnauthorized {
+		t.Errorf("replayed request status = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := send("", false); got != http.StatusUnauthorized {
+		t.Errorf("unsigned request status = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestNewServer_RequestSigningWithGRPC(t *testing.T) {
+	for _, cfg := range []*Config{
+		{Command: "cat", RequestSigningKey: []byte("secret"), GRPCPort: 9090},
+		{Command: "cat", RequestSigningKey: []byte("secret"), TCPPort: 9091},
+	} {
+		if _, err := NewServer(cfg, slog.Default()); err == nil {
+			t.Errorf("NewServer(%+v) expected error but got none", cfg)
+		}
+	}
+}
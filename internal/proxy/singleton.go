@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// リーダー以外のレプリカでのリクエストの扱い
+const (
+	FollowerProxy    = "proxy"     // リーダーに転送する
+	FollowerNotReady = "not-ready" // 503 を返す
+)
+
+// errNotLeader はバックエンドを単一インスタンスで動かすため、このレプリカでは実行できないことを表します。
+var errNotLeader = errors.New("backend is running on another replica")
+
+// ValidateFollowerMode はリーダー以外のレプリカでの扱いとして指定された値を検証します。
+func ValidateFollowerMode(mode string) error {
+	switch mode {
+	case FollowerProxy, FollowerNotReady:
+		return nil
+	default:
+		return fmt.Errorf("unknown follower mode %q (supported: %s, %s)", mode, FollowerProxy, FollowerNotReady)
+	}
+}
+
+// isFollower はリーダー選出が有効で、このレプリカがリーダーではないかどうかを返します。
+func (s *Server) isFollower() bool {
+	return s.election != nil && !s.election.IsLeader()
+}
+
+// singleton はリーダー以外のレプリカに届いたリクエストをリーダーへ転送するか、503 を返すミドルウェアです。
+// リーダーが分からない場合や、別のレプリカから転送済みのリクエストには 503 を返します。
+func (s *Server) singleton(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.isFollower() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		leader := s.election.Leader()
+		if s.cfg.FollowerMode != FollowerNotReady && leader != "" && r.Header.Get(headerForwardedBy) == "" {
+			target, err := url.Parse(leader)
+			if err == nil {
+				s.logger.Debug("Forwarding request to leader", "leader", leader)
+				s.proxyTo(w, r, target)
+				return
+			}
+			s.logger.Error("Invalid leader URL", "leader", leader, "error", err)
+		}
+
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Service Unavailable: "+errNotLeader.Error(), http.StatusServiceUnavailable)
+	})
+}
@@ -0,0 +1,227 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/election"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mcptest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// staticLock は holder が常にロックを保持している Lock です。
+type staticLock struct {
+	id     string
+	holder string
+}
+
+func (l staticLock) TryAcquire(context.Context) (bool, error) {
+	return l.holder == l.id, nil
+}
+
+func (l staticLock) Holder(context.Context) (string, bool, error) {
+	return l.holder, l.holder != "", nil
+}
+
+func (l staticLock) Release(context.Context) error {
+	return nil
+}
+
+func (l staticLock) Close() error {
+	return nil
+}
+
+// newSingletonServer はリーダー選出を有効にした Server を作成し、選出を開始します。
+func newSingletonServer(t *testing.T, lock election.Lock, mode string) (*Server, *election.Election) {
+	t.Helper()
+	command, args, env := mcptest.Command(mcptest.ModeCompliant)
+	server, err := NewServer(&Config{
+		Command:          command,
+		Args:             args,
+		DefaultEnv:       env,
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+		LongPoll:         true,
+		AdvertiseURL:     "http://self",
+		LeaderLock:       lock,
+		LeaderLockTTL:    30 * time.Millisecond,
+		FollowerMode:     mode,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.election.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		server.polls.close()
+	})
+	return server, server.election
+}
+
+func TestSingleton(t *testing.T) {
+	var forwardedBy string
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedBy = r.Header.Get(headerForwardedBy)
+		_, _ = io.WriteString(w, `{"from":"leader"}`)
+	}))
+	t.Cleanup(leader.Close)
+
+	tests := []struct {
+		name       string
+		holder     string
+		mode       string
+		forwarded  bool
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "リーダー_ローカルで実行", holder: "http://self", mode: FollowerProxy, wantStatus: http.StatusOK, wantBody: `"result"`},
+		{name: "フォロワー_リーダーに転送", holder: leader.URL, mode: FollowerProxy, wantStatus: http.StatusOK, wantBody: `{"from":"leader"}`},
+		{name: "フォロワーのnot-ready_503", holder: leader.URL, mode: FollowerNotReady, wantStatus: http.StatusServiceUnavailable},
+		{name: "転送済みのリクエスト_503", holder: leader.URL, mode: FollowerProxy, forwarded: true, wantStatus: http.StatusServiceUnavailable},
+		{name: "リーダー不明_503", mode: FollowerProxy, wantStatus: http.StatusServiceUnavailable},
+		{name: "不正なリーダーURL_503", holder: "http://[::1", mode: FollowerProxy, wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, e := newSingletonServer(t, staticLock{id: "http://self", holder: tt.holder}, tt.mode)
+			waitFor(t, func() bool { return e.Leader() == tt.holder })
+
+			req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.forwarded {
+				req.Header.Set(headerForwardedBy, "http://other")
+			}
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.wantBody)
+			}
+			if tt.wantStatus == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+				t.Error("Retry-After should be set")
+			}
+		})
+	}
+
+	// 転送先には転送元のレプリカが伝わる
+	if forwardedBy != "http://self" {
+		t.Errorf("%s = %q, want http://self", headerForwardedBy, forwardedBy)
+	}
+}
+
+func TestSingleton_FollowerFrontends(t *testing.T) {
+	server, e := newSingletonServer(t, staticLock{id: "http://self", holder: "http://leader"}, FollowerProxy)
+	waitFor(t, func() bool { return e.Leader() == "http://leader" })
+
+	// gRPC と TCP は転送できないため Unavailable を返す
+	_, err := server.call(context.Background(), wrapperspb.Bytes([]byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)))
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("call() code = %v, want Unavailable", status.Code(err))
+	}
+
+	client, conn := net.Pipe()
+	go server.handleTCPConn(context.Background(), conn)
+	t.Cleanup(func() { _ = client.Close() })
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+	line, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("read error = %v", err)
+	}
+	if !strings.Contains(string(line), errNotLeader.Error()) {
+		t.Errorf("TCP response = %s, want not-leader error", line)
+	}
+	if !errors.Is(server.relay(context.Background(), nil, nil, nil), errNotLeader) {
+		t.Error("relay() should return errNotLeader on a follower")
+	}
+}
+
+func TestSingleton_StepDownClosesSessions(t *testing.T) {
+	lock := &toggleLock{held: true}
+	server, e := newSingletonServer(t, lock, FollowerNotReady)
+	waitFor(t, e.IsLeader)
+
+	w := pollPost(t, server, "", `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("POST status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+
+	// リーダーを降りるとロングポーリングのセッションを終了する
+	lock.set(false)
+	waitFor(t, func() bool {
+		server.polls.mu.Lock()
+		defer server.polls.mu.Unlock()
+		return len(server.polls.sessions) == 0
+	})
+}
+
+func TestNewServer_LeaderLockRequiresAdvertiseURL(t *testing.T) {
+	_, err := NewServer(&Config{Command: "cat", LeaderLock: staticLock{}}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err == nil {
+		t.Error("NewServer() without AdvertiseURL expected error but got none")
+	}
+}
+
+func TestValidateFollowerMode(t *testing.T) {
+	for _, mode := range []string{FollowerProxy, FollowerNotReady} {
+		if err := ValidateFollowerMode(mode); err != nil {
+			t.Errorf("ValidateFollowerMode(%q) error = %v", mode, err)
+		}
+	}
+	if err := ValidateFollowerMode("standby"); err == nil {
+		t.Error("ValidateFollowerMode(standby) expected error but got none")
+	}
+}
+
+// toggleLock は保持状態を切り替えられる Lock です。
+type toggleLock struct {
+	staticLock
+	mu   sync.Mutex
+	held bool
+}
+
+func (l *toggleLock) set(held bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.held = held
+}
+
+func (l *toggleLock) TryAcquire(context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.held, nil
+}
+
+// waitFor は cond が true になるまで最大5秒待ちます。
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 5s")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
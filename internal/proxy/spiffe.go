@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/spiffe"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// headerSPIFFEID は mTLS で認証した接続元の SPIFFE ID をマッピングに渡す内部ヘッダーです。クライアントが送った同名のヘッダーは上書きします。
+const headerSPIFFEID = "X-Tumiki-Spiffe-Id"
+
+// authorizeSPIFFE は接続元の SPIFFE ID を allow で認可します。
+// 同じ ID を使う他のレプリカからの転送・ゴシップは常に許可します。
+func (s *Server) authorizeSPIFFE(state *tls.ConnectionState, allow *spiffe.Matcher) (string, error) {
+	id, ok := spiffe.PeerID(state)
+	if !ok {
+		return "", spiffe.ErrNotAuthorized
+	}
+	if s.cfg.SPIFFE != nil && id == s.cfg.SPIFFE.ID() {
+		return id, nil
+	}
+	return id, allow.Authorize(id)
+}
+
+// spiffeAuth は mTLS で検証したクライアントの SPIFFE ID を allow で認可し、内部ヘッダーに設定します。
+func (s *Server) spiffeAuth(next http.Handler, allow *spiffe.Matcher) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := s.authorizeSPIFFE(r.TLS, allow)
+		if err != nil {
+			s.logger.Warn("SPIFFE authorization failed", "spiffe_id", id, "path", r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		r = r.Clone(r.Context())
+		r.Header.Set(headerSPIFFEID, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorizeSPIFFEGRPC は gRPC の接続元の SPIFFE ID を認可します。SPIFFE が無効な場合は何もしません。
+func (s *Server) authorizeSPIFFEGRPC(ctx context.Context) error {
+	if s.cfg.SPIFFE == nil {
+		return nil
+	}
+	var state *tls.ConnectionState
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state = &info.State
+		}
+	}
+	if _, err := s.authorizeSPIFFE(state, s.cfg.SPIFFEAllow); err != nil {
+		return status.Error(codes.PermissionDenied, "SPIFFE ID is not authorized")
+	}
+	return nil
+}
+
+// peerTransport は他のレプリカへの転送・ゴシップで使う Transport を返します。
+// SPIFFE が有効な場合は SVID をクライアント証明書として提示します。
+func (s *Server) peerTransport() http.RoundTripper {
+	if s.cfg.SPIFFE == nil {
+		return http.DefaultTransport
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = s.cfg.SPIFFE.ClientTLSConfig()
+	return transport
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/spiffe"
+)
+
+// peerState は SPIFFE ID を URI SAN に持つ証明書で接続した TLS の状態を返します。
+func peerState(t *testing.T, id string) *tls.ConnectionState {
+	t.Helper()
+	u, err := url.Parse(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{URIs: []*url.URL{u}}}}
+}
+
+func TestSpiffeAuth(t *testing.T) {
+	allow, err := spiffe.NewMatcher([]string{"spiffe://example.org/ns/prod/sa/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{cfg: &Config{}, logger: slog.New(slog.NewJSONHandler(os.Stderr, nil))}
+	handler := server.spiffeAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get(headerSPIFFEID)))
+	}), allow)
+
+	tests := []struct {
+		name       string
+		state      *tls.ConnectionState
+		header     string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "許可されたID_ヘッダーに設定",
+			state:      peerState(t, "spiffe://example.org/ns/prod/sa/agent"),
+			wantStatus: http.StatusOK,
+			wantBody:   "spiffe://example.org/ns/prod/sa/agent",
+		},
+		{
+			name:       "クライアントのヘッダーを偽装_検証したIDで上書き",
+			state:      peerState(t, "spiffe://example.org/ns/prod/sa/agent"),
+			header:     "spiffe://example.org/ns/prod/sa/admin",
+			wantStatus: http.StatusOK,
+			wantBody:   "spiffe://example.org/ns/prod/sa/agent",
+		},
+		{
+			name:       "許可されていないID_403",
+			state:      peerState(t, "spiffe://example.org/ns/dev/sa/agent"),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "SVIDでない証明書_403",
+			state:      peerState(t, "https://example.org/agent"),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "TLSなし_403",
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/mcp", nil)
+			req.TLS = tt.state
+			if tt.header != "" {
+				req.Header.Set(headerSPIFFEID, tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d (body: %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
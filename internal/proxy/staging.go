@@ -0,0 +1,271 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultStagedFileTTL はアップロードしたファイルを保持するデフォルトの期間です。
+const DefaultStagedFileTTL = time.Hour
+
+// DefaultStagedFileMaxBytes はアップロードできるファイルのデフォルトの最大バイト数です。
+const DefaultStagedFileMaxBytes = 32 * 1024 * 1024
+
+// stagedFilesPath はファイルをアップロードするエンドポイントです。
+const stagedFilesPath = "/mcp/files"
+
+// ステージングしたファイルをプロセスに渡すためのヘッダー・環境変数・引数です。
+const (
+	headerStagedFiles      = "X-Mcp-Files" // プロセスに渡すファイルの ID（カンマ区切り）
+	envStagedFiles         = "MCP_FILES"   // ファイルのパス（パスリストの区切り文字で連結）
+	stagedFilesPlaceholder = "{files}"     // ファイルのパスごとの引数に置き換える引数
+)
+
+// errStagedFileTooLarge はアップロードしたファイルが大きすぎることを表します。
+var errStagedFileTooLarge = errors.New("staged file is too large")
+
+// stagedFile はアップロードされた1件のファイルです。
+type stagedFile struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	owner string // アップロードした API キーの ID（API キーが無効な場合は空）
+}
+
+// stagedFiles はアップロードされたファイルを、プロセスの引数・環境変数から参照できるパスに保持します。
+type stagedFiles struct {
+	dir      string
+	ttl      time.Duration
+	maxBytes int64
+	now      func() time.Time
+
+	mu    sync.Mutex
+	files map[string]*stagedFile
+}
+
+// newStagedFiles は parent（空文字列でシステムの一時ディレクトリ）にファイルを保持するディレクトリを作成します。
+func newStagedFiles(parent string, ttl time.Duration, maxBytes int64) (*stagedFiles, error) {
+	dir, err := os.MkdirTemp(parent, "tumiki-mcp-files-")
+	if err != nil {
+		return nil, fmt.Errorf("create staging directory: %w", err)
+	}
+	if ttl <= 0 {
+		ttl = DefaultStagedFileTTL
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultStagedFileMaxBytes
+	}
+	return &stagedFiles{
+		dir:      dir,
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		now:      time.Now,
+		files:    make(map[string]*stagedFile),
+	}, nil
+}
+
+// put は r の内容を name のファイルとして保存します。パスは ID ごとのディレクトリの下で、元のファイル名を保ちます。
+func (s *stagedFiles) put(name, owner string, r io.Reader) (*stagedFile, error) {
+	s.evictExpired()
+
+	name = filepath.Base(name)
+	if name == "." || name == ".." || name == string(filepath.Separator) || strings.ContainsRune(name, 0) {
+		return nil, fmt.Errorf("%w: invalid file name", errInvalidRequest)
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("generate file id: %w", err)
+	}
+	id := hex.EncodeToString(buf)
+
+	dir := filepath.Join(s.dir, id)
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create file directory: %w", err)
+	}
+	path := filepath.Join(dir, name)
+	size, err := s.write(path, r)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	file := &stagedFile{ID: id, Name: name, Path: path, Size: size, ExpiresAt: s.now().Add(s.ttl), owner: owner}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[id] = file
+	return file, nil
+}
+
+func (s *stagedFiles) write(path string, r io.Reader) (int64, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("create staged file: %w", err)
+	}
+	size, err := io.Copy(f, io.LimitReader(r, s.maxBytes+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("write staged file: %w", err)
+	}
+	if size > s.maxBytes {
+		return 0, fmt.Errorf("%w: max %d bytes", errStagedFileTooLarge, s.maxBytes)
+	}
+	return size, nil
+}
+
+// get は owner がアップロードした有効期限内のファイルを返します。
+func (s *stagedFiles) get(id, owner string) (*stagedFile, bool) {
+	s.evictExpired()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[id]
+	if !ok || file.owner != owner {
+		return nil, false
+	}
+	return file, true
+}
+
+// remove は owner がアップロードしたファイルを削除します。
+func (s *stagedFiles) remove(id, owner string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[id]
+	if !ok || file.owner != owner {
+		return false
+	}
+	_ = os.RemoveAll(filepath.Dir(file.Path))
+	delete(s.files, id)
+	return true
+}
+
+func (s *stagedFiles) evictExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for id, file := range s.files {
+		if now.After(file.ExpiresAt) {
+			_ = os.RemoveAll(filepath.Dir(file.Path))
+			delete(s.files, id)
+		}
+	}
+}
+
+// close は保持している全てのファイルを削除します。
+func (s *stagedFiles) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files = make(map[string]*stagedFile)
+	return os.RemoveAll(s.dir)
+}
+
+// stagedFileIDs は X-Mcp-Files ヘッダーのファイル ID を返します。
+func stagedFileIDs(header http.Header) []string {
+	var ids []string
+	for _, id := range strings.Split(header.Get(headerStagedFiles), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// stagedFileOwner はファイルの所有者として扱う API キーの ID を返します。
+func (s *Server) stagedFileOwner(header http.Header) string {
+	if s.cfg.APIKeys == nil {
+		return ""
+	}
+	return header.Get(headerAPIKeyID)
+}
+
+// checkStagedFiles は X-Mcp-Files ヘッダーのファイルが全て参照できることを確かめます。
+func (s *Server) checkStagedFiles(header http.Header) error {
+	ids := stagedFileIDs(header)
+	if len(ids) == 0 {
+		return nil
+	}
+	if s.staged == nil {
+		return fmt.Errorf("%w: file staging is disabled", errInvalidRequest)
+	}
+	owner := s.stagedFileOwner(header)
+	for _, id := range ids {
+		if _, ok := s.staged.get(id, owner); !ok {
+			return fmt.Errorf("%w: staged file %q not found", errInvalidRequest, id)
+		}
+	}
+	return nil
+}
+
+// withStagedFiles は X-Mcp-Files ヘッダーのファイルのパスを環境変数 MCP_FILES に設定し、
+// 引数の {files} をファイルごとのパスに置き換えます。ファイルがない場合 {files} は取り除きます。
+func (s *Server) withStagedFiles(header http.Header, env map[string]string, args []string) []string {
+	if s.staged == nil {
+		return args
+	}
+	owner := s.stagedFileOwner(header)
+	var paths []string
+	for _, id := range stagedFileIDs(header) {
+		if file, ok := s.staged.get(id, owner); ok {
+			paths = append(paths, file.Path)
+		}
+	}
+	if len(paths) > 0 {
+		env[envStagedFiles] = strings.Join(paths, string(os.PathListSeparator))
+	}
+
+	replaced := make([]string, 0, len(args)+len(paths))
+	for _, arg := range args {
+		if arg == stagedFilesPlaceholder {
+			replaced = append(replaced, paths...)
+			continue
+		}
+		replaced = append(replaced, arg)
+	}
+	return replaced
+}
+
+// handleUploadFile はリクエストボディを ?name= のファイルとして保存し、ID とパスを返します。
+func (s *Server) handleUploadFile(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	file, err := s.staged.put(name, s.stagedFileOwner(r.Header), r.Body)
+	switch {
+	case errors.Is(err, errInvalidRequest):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, errStagedFileTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		s.logger.Error("Failed to stage file", "error", err)
+		http.Error(w, "Failed to stage file", http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, file)
+}
+
+// handleDeleteFile はアップロードしたファイルを削除します。
+func (s *Server) handleDeleteFile(w http.ResponseWriter, r *http.Request) {
+	if !s.staged.remove(r.PathValue("id"), s.stagedFileOwner(r.Header)) {
+		http.Error(w, "Staged file not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
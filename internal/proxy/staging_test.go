@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newStagingServer はファイルのパスを引数と MCP_FILES で受け取り、その内容を返すサーバーを作成します。
+func newStagingServer(t *testing.T, maxBytes int64) *Server {
+	t.Helper()
+	server, err := NewServer(&Config{
+		Command:             "sh",
+		Args:                []string{"-c", `read line; echo "{\"jsonrpc\":\"2.0\",\"id\":1,\"result\":{\"args\":\"$*\",\"env\":\"$MCP_FILES\",\"content\":\"$(cat "$@")\"}}"`, "sh", "{files}"},
+		DefaultEnv:          map[string]string{},
+		FileStaging:         true,
+		FileStagingDir:      t.TempDir(),
+		FileStagingMaxBytes: maxBytes,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	t.Cleanup(func() { _ = server.staged.close() })
+	return server
+}
+
+func uploadFile(t *testing.T, server *Server, name, content string) (*httptest.ResponseRecorder, stagedFile) {
+	t.Helper()
+	req := httptest.NewRequest("POST", stagedFilesPath+"?name="+name, strings.NewReader(content))
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	var file stagedFile
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &file); err != nil {
+			t.Fatalf("upload response %s: %v", w.Body.String(), err)
+		}
+	}
+	return w, file
+}
+
+func stagedRequest(server *Server, files string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/call"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if files != "" {
+		req.Header.Set(headerStagedFiles, files)
+	}
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func TestHandler_StagedFiles(t *testing.T) {
+	server := newStagingServer(t, 0)
+
+	w, file := uploadFile(t, server, "../notes.txt", "hello")
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload status = %d (body: %s)", w.Code, w.Body.String())
+	}
+	// ディレクトリを含む名前はファイル名だけを使う
+	if file.Name != "notes.txt" || file.Size != 5 || !strings.HasSuffix(file.Path, "/"+file.ID+"/notes.txt") {
+		t.Errorf("staged file = %+v", file)
+	}
+
+	w = stagedRequest(server, file.ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /mcp status = %d (body: %s)", w.Code, w.Body.String())
+	}
+	var got struct {
+		Result struct {
+			Args    string `json:"args"`
+			Env     string `json:"env"`
+			Content string `json:"content"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("response %s: %v", w.Body.String(), err)
+	}
+	if got.Result.Args != file.Path || got.Result.Env != file.Path || got.Result.Content != "hello" {
+		t.Errorf("result = %+v, want the staged file path in args and MCP_FILES", got.Result)
+	}
+
+	// ファイルを指定しない場合は {files} を取り除く
+	w = stagedRequest(server, "")
+	if !strings.Contains(w.Body.String(), `"args":""`) {
+		t.Errorf("POST /mcp without files = %s, want no args", w.Body.String())
+	}
+
+	req := httptest.NewRequest("DELETE", stagedFilesPath+"/"+file.ID, nil)
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("DELETE status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if _, err := os.Stat(file.Path); !os.IsNotExist(err) {
+		t.Errorf("staged file still exists after DELETE (err = %v)", err)
+	}
+	if w := stagedRequest(server, file.ID); w.Code != http.StatusBadRequest {
+		t.Errorf("POST /mcp with a deleted file status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandler_StagedFileErrors(t *testing.T) {
+	server := newStagingServer(t, 4)
+
+	tests := []struct {
+		name    string
+		request func() *httptest.ResponseRecorder
+		want    int
+	}{
+		{name: "大きすぎるファイル_413", request: func() *httptest.ResponseRecorder { w, _ := uploadFile(t, server, "a.txt", "12345"); return w }, want: http.StatusRequestEntityTooLarge},
+		{name: "名前なし_400", request: func() *httptest.ResponseRecorder { w, _ := uploadFile(t, server, "", "1"); return w }, want: http.StatusBadRequest},
+		{name: "不正な名前_400", request: func() *httptest.ResponseRecorder { w, _ := uploadFile(t, server, "..", "1"); return w }, want: http.StatusBadRequest},
+		{name: "未知のID_400", request: func() *httptest.ResponseRecorder { return stagedRequest(server, "unknown") }, want: http.StatusBadRequest},
+		{name: "未知のIDを削除_404", request: func() *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, httptest.NewRequest("DELETE", stagedFilesPath+"/unknown", nil))
+			return w
+		}, want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := tt.request(); w.Code != tt.want {
+				t.Errorf("status = %d, want %d (body: %s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestStagedFiles_Expiry(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	staged, err := newStagedFiles(t.TempDir(), time.Minute, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staged.now = func() time.Time { return now }
+
+	file, err := staged.put("a.txt", "key-1", strings.NewReader("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := staged.get(file.ID, "key-2"); ok {
+		t.Error("get() by another API key = found, want not found")
+	}
+	if _, ok := staged.get(file.ID, "key-1"); !ok {
+		t.Error("get() by the owner = not found, want found")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := staged.get(file.ID, "key-1"); ok {
+		t.Error("get() after expiry = found, want not found")
+	}
+	if _, err := os.Stat(file.Path); !os.IsNotExist(err) {
+		t.Errorf("expired file still exists (err = %v)", err)
+	}
+}
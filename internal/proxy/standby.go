@@ -0,0 +1,292 @@
+package proxy
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/metrics"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// DefaultStandbyCacheSize は予備プロセスを保持する環境変数・引数の組み合わせのデフォルトの最大数です。
+const DefaultStandbyCacheSize = 16
+
+// retrySafeMethods はプロセスが応答せずに終了した場合に予備プロセスで再実行してよいメソッドです。
+// 読み取りのみで副作用のないメソッドに限り、tools/call などは2回実行されないよう含めません。
+var retrySafeMethods = map[string]bool{
+	"initialize":               true,
+	"ping":                     true,
+	"tools/list":               true,
+	"resources/list":           true,
+	"resources/templates/list": true,
+	"resources/read":           true,
+	"prompts/list":             true,
+	"prompts/get":              true,
+	"completion/complete":      true,
+}
+
+// execute はリクエストを実行し、最初のレスポンスを返します。
+// 予備プロセスが有効な場合はヘッダーから決まる環境変数・引数の予備プロセスで、
+// プロセスの再利用が有効な場合は同じ環境変数・引数で起動し続けているプロセスで実行し、
+// 共有プロセスが有効な場合は共有プロセスで、それ以外の場合は新しくプロセスを起動します。
+func (s *Server) execute(ctx context.Context, header http.Header, body []byte) ([]byte, error) {
+	if s.shared != nil {
+		return s.shared.Call(ctx, body)
+	}
+	// initialize は再利用しているプロセスを初期化し直さないよう、これまで通り新しいプロセスで実行する
+	if s.reuse != nil && requestMethod(body) != "initialize" {
+		return s.reuse.Execute(ctx, s.newExecutor(header), body)
+	}
+	if s.standby != nil {
+		response, err := s.standby.get(header).Execute(ctx, body, retrySafeMethods[requestMethod(body)])
+		// 追い出された予備プロセスを使おうとした場合は新しく起動する
+		if !errors.Is(err, process.ErrStandbyClosed) {
+			return response, err
+		}
+	}
+	return s.newExecutor(header).Execute(ctx, body)
+}
+
+// standbyPools は環境変数・引数の組み合わせごとに予備プロセスを保持します。
+// 組み合わせの数が上限を超えた場合は最も長く使われていないものから終了させます。
+type standbyPools struct {
+	server *Server
+	cfg    process.StandbyConfig
+	size   int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // 先頭ほど最近使われた standbyEntry
+	closed  bool
+
+	// 追い出した予備プロセスの累計値（カウンターが減らないように加算し続ける）
+	evicted process.StandbyStats
+
+	evictions *metrics.Counter
+}
+
+type standbyEntry struct {
+	key     string
+	version string // 予備プロセスのバックエンドのバージョン（名前付きのサーバーではサーバー名）
+	standby *process.Standby
+}
+
+// newStandbyPools は standbyPools を作成し、ヘッダー由来の値を含まない組み合わせの予備プロセスを起動します。
+func newStandbyPools(s *Server, cfg process.StandbyConfig, size int) (*standbyPools, error) {
+	if err := process.ValidateStandbyConfig(cfg); err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		size = DefaultStandbyCacheSize
+	}
+
+	scaled := s.metrics.Counter("tumiki_standby_scale_total", "Number of standby pool scaling decisions.", "direction")
+	cfg.OnScale = func(d process.ScaleDecision) {
+		direction := "up"
+		if d.To < d.From {
+			direction = "down"
+		}
+		scaled.Inc(direction)
+		s.logger.Info("Scaled standby pool", "from", d.From, "to", d.To, "queue_depth", d.QueueDepth, "max_wait", d.MaxWait)
+	}
+
+	p := &standbyPools{
+		server:    s,
+		cfg:       cfg,
+		size:      size,
+		entries:   make(map[string]*list.Element),
+		lru:       list.New(),
+		evictions: s.metrics.Counter("tumiki_standby_pool_evictions_total", "Number of standby pools evicted from the cache."),
+	}
+	p.registerMetrics(s.metrics)
+
+	p.get(http.Header{})
+	return p, nil
+}
+
+// get はヘッダーから決まる環境変数・引数の予備プロセスを返します。なければ作成します。
+func (p *standbyPools) get(header http.Header) *process.Standby {
+	backend, env, args := p.server.processConfig(header)
+	key := processFingerprint(backend.identity(), env, args)
+
+	p.mu.Lock()
+	if elem, ok := p.entries[key]; ok {
+		p.lru.MoveToFront(elem)
+		p.mu.Unlock()
+		return elem.Value.(*standbyEntry).standby
+	}
+
+	// 設定は検証済みのためエラーにならない
+	standby, _ := process.NewStandby(process.NewExecutor(
+		backend.Command,
+		args,
+		env,
+		p.server.logger,
+		p.server.executorOptions(backend)...,
+	), p.cfg)
+	if p.closed {
+		p.mu.Unlock()
+		_ = standby.Close()
+		return standby
+	}
+	p.entries[key] = p.lru.PushFront(&standbyEntry{key: key, version: backend.Version, standby: standby})
+
+	var evicted []*process.Standby
+	for p.lru.Len() > p.size {
+		entry := p.lru.Remove(p.lru.Back()).(*standbyEntry)
+		delete(p.entries, entry.key)
+		p.addEvicted(entry.standby.Stats())
+		evicted = append(evicted, entry.standby)
+	}
+	p.mu.Unlock()
+
+	for _, standby := range evicted {
+		p.evictions.Inc()
+		p.server.logger.Debug("Evicted standby pool")
+		go func() { _ = standby.Close() }()
+	}
+	return standby
+}
+
+// addEvicted は追い出した予備プロセスの累計値を加算します。p.mu を保持した状態で呼び出してください。
+func (p *standbyPools) addEvicted(stats process.StandbyStats) {
+	p.evicted.Queued += stats.Queued
+	p.evicted.QueueWait += stats.QueueWait
+	p.evicted.Recycled += stats.Recycled
+}
+
+// stats は全ての予備プロセスの状態と累計値を合計して返します。
+func (p *standbyPools) stats() process.StandbyStats {
+	p.mu.Lock()
+	total := p.evicted
+	for elem := p.lru.Front(); elem != nil; elem = elem.Next() {
+		stats := elem.Value.(*standbyEntry).standby.Stats()
+		total.Size += stats.Size
+		total.Idle += stats.Idle
+		total.Waiting += stats.Waiting
+		total.Queued += stats.Queued
+		total.QueueWait += stats.QueueWait
+		total.Recycled += stats.Recycled
+	}
+	p.mu.Unlock()
+	return total
+}
+
+// len は予備プロセスを保持している組み合わせの数を返します。
+func (p *standbyPools) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lru.Len()
+}
+
+// registerMetrics は予備プロセスの数と待ち行列の状態をメトリクスに登録します。
+func (p *standbyPools) registerMetrics(r *metrics.Registry) {
+	r.GaugeFunc("tumiki_standby_pools", "Number of env/args combinations with standby processes.", func() float64 {
+		return float64(p.len())
+	})
+	r.GaugeFunc("tumiki_standby_size", "Target number of standby processes.", func() float64 {
+		return float64(p.stats().Size)
+	})
+	r.GaugeFunc("tumiki_standby_idle", "Number of started standby processes waiting for a request.", func() float64 {
+		return float64(p.stats().Idle)
+	})
+	r.GaugeFunc("tumiki_standby_queue_depth", "Number of requests waiting for a standby process to start.", func() float64 {
+		return float64(p.stats().Waiting)
+	})
+	r.CounterFunc("tumiki_standby_queued_total", "Number of requests that waited for a standby process.", func() float64 {
+		return float64(p.stats().Queued)
+	})
+	r.CounterFunc("tumiki_standby_queue_wait_seconds_total", "Total time requests waited for a standby process.", func() float64 {
+		return p.stats().QueueWait.Seconds()
+	})
+	r.CounterFunc("tumiki_standby_recycled_total", "Number of standby processes restarted after idling longer than the max idle time.", func() float64 {
+		return float64(p.stats().Recycled)
+	})
+}
+
+// drain は全ての予備プロセスを終了させ、以降は新しいコマンドで予備プロセスを起動し直します。
+func (p *standbyPools) drain() {
+	standbys := p.removeAll(false)
+	for _, standby := range standbys {
+		go func() { _ = standby.Close() }()
+	}
+	p.get(http.Header{})
+}
+
+// drainVersions は versions のバックエンドの予備プロセスだけを終了させ、
+// ヘッダー由来の値を含まない組み合わせの予備プロセスを新しい定義で起動し直します。
+func (p *standbyPools) drainVersions(versions []string) {
+	p.mu.Lock()
+	var standbys []*process.Standby
+	for elem := p.lru.Front(); elem != nil; {
+		entry := elem.Value.(*standbyEntry)
+		next := elem.Next()
+		if slices.Contains(versions, entry.version) {
+			p.lru.Remove(elem)
+			delete(p.entries, entry.key)
+			p.addEvicted(entry.standby.Stats())
+			standbys = append(standbys, entry.standby)
+		}
+		elem = next
+	}
+	p.mu.Unlock()
+
+	for _, standby := range standbys {
+		go func() { _ = standby.Close() }()
+	}
+	p.get(http.Header{})
+}
+
+// close は全ての予備プロセスを終了させます。
+func (p *standbyPools) close() error {
+	var errs []error
+	for _, standby := range p.removeAll(true) {
+		errs = append(errs, standby.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// removeAll は全ての予備プロセスをキャッシュから取り除いて返します。
+func (p *standbyPools) removeAll(closed bool) []*process.Standby {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if closed {
+		p.closed = true
+	}
+	var standbys []*process.Standby
+	for elem := p.lru.Front(); elem != nil; elem = elem.Next() {
+		standby := elem.Value.(*standbyEntry).standby
+		p.addEvicted(standby.Stats())
+		standbys = append(standbys, standby)
+	}
+	p.entries = make(map[string]*list.Element)
+	p.lru.Init()
+	return standbys
+}
+
+// processFingerprint はコマンド・環境変数・引数の組み合わせを識別するキーを返します。
+// ヘッダー由来の秘密情報をそのままキーとして保持しないようハッシュ化します。
+func processFingerprint(command string, env map[string]string, args []string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	h := sha256.New()
+	h.Write([]byte(command + "\x00"))
+	for _, k := range keys {
+		h.Write([]byte(k + "=" + env[k] + "\x00"))
+	}
+	h.Write([]byte("\x00"))
+	for _, arg := range args {
+		h.Write([]byte(arg + "\x00"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+)
+
+// newStandbyServer は予備プロセスを有効にした Server を作成します。
+func newStandbyServer(t *testing.T, command string, args []string, env map[string]string) *Server {
+	t.Helper()
+	server, err := NewServer(&Config{
+		Command:          command,
+		Args:             args,
+		DefaultEnv:       env,
+		HeaderEnvMapping: map[string]string{"X-Api-Key": "API_KEY"},
+		HeaderArgMapping: map[string]string{},
+		WarmStandby:      &process.StandbyConfig{Min: 1, Max: 1},
+		Metrics:          true,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	t.Cleanup(func() { _ = server.standby.close() })
+	return server
+}
+
+func TestHandleMCP_WarmStandby(t *testing.T) {
+	// 最初に入力を受け取ったプロセスだけが応答せずに異常終了し、以降は API_KEY を付けて応答する
+	script := `read line; if mkdir "$MARKER" 2>/dev/null; then exit 1; fi; printf '{"jsonrpc":"2.0","id":1,"result":{"key":"%s"}}\n' "$API_KEY"`
+
+	tests := []struct {
+		name     string
+		body     string
+		header   map[string]string
+		wantCode int
+		wantBody string
+	}{
+		{name: "安全なメソッド_予備プロセスで再実行", body: `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`, wantCode: http.StatusOK, wantBody: `"key":"default"`},
+		{name: "tools/call_再実行せず500", body: `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo"}}`, wantCode: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"MARKER": t.TempDir() + "/failed", "API_KEY": "default"}
+			server := newStandbyServer(t, "sh", []string{"-c", script}, env)
+
+			req := httptest.NewRequest("POST", "/mcp", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (body: %s)", w.Code, tt.wantCode, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want to contain %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandleMCP_WarmStandby_HeaderMapping(t *testing.T) {
+	script := `read line; printf '{"jsonrpc":"2.0","id":1,"result":{"key":"%s"}}\n' "$API_KEY"`
+	server := newStandbyServer(t, "sh", []string{"-c", script}, map[string]string{"API_KEY": "default"})
+	server.standby.size = 2
+
+	post := func(apiKey string) string {
+		req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set("X-Api-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body: %s)", w.Code, http.StatusOK, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	// ヘッダーの値ごとに別の予備プロセスが作られ、その値で起動される
+	if got := post("tenant-a"); !strings.Contains(got, `"key":"tenant-a"`) {
+		t.Errorf("response = %s, want the tenant-a key", got)
+	}
+	if got := post(""); !strings.Contains(got, `"key":"default"`) {
+		t.Errorf("response = %s, want the default key", got)
+	}
+	if n := server.standby.len(); n != 2 {
+		t.Errorf("pools = %d, want 2", n)
+	}
+
+	// 上限を超えると最も長く使われていない組み合わせ（tenant-a）を追い出す
+	if got := post("tenant-b"); !strings.Contains(got, `"key":"tenant-b"`) {
+		t.Errorf("response = %s, want the tenant-b key", got)
+	}
+	if n := server.standby.len(); n != 2 {
+		t.Errorf("pools = %d, want 2", n)
+	}
+	backend, env, args := server.processConfig(http.Header{"X-Api-Key": {"tenant-a"}})
+	if _, ok := server.standby.entries[processFingerprint(backend.identity(), env, args)]; ok {
+		t.Error("least recently used pool should be evicted")
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), "tumiki_standby_pool_evictions_total 1") {
+		t.Errorf("metrics should count the eviction:\n%s", w.Body.String())
+	}
+}
+
+func TestProcessFingerprint(t *testing.T) {
+	base := processFingerprint("cmd", map[string]string{"A": "1", "B": "2"}, []string{"--x", "1"})
+
+	tests := []struct {
+		name    string
+		command string
+		env     map[string]string
+		args    []string
+		equal   bool
+	}{
+		{name: "同じ組み合わせ_一致", command: "cmd", env: map[string]string{"B": "2", "A": "1"}, args: []string{"--x", "1"}, equal: true},
+		{name: "コマンドが異なる_不一致", command: "other", env: map[string]string{"A": "1", "B": "2"}, args: []string{"--x", "1"}},
+		{name: "環境変数の値が異なる_不一致", command: "cmd", env: map[string]string{"A": "1", "B": "3"}, args: []string{"--x", "1"}},
+		{name: "引数が異なる_不一致", command: "cmd", env: map[string]string{"A": "1", "B": "2"}, args: []string{"--x", "2"}},
+		{name: "区切りがずれる_不一致", command: "cmd", env: map[string]string{"A": "1", "B": "2"}, args: []string{"--x1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := processFingerprint(tt.command, tt.env, tt.args) == base; got != tt.equal {
+				t.Errorf("fingerprint equal = %v, want %v", got, tt.equal)
+			}
+		})
+	}
+}
+
+func TestNewServer_WarmStandbyWithLeaderLock(t *testing.T) {
+	_, err := NewServer(&Config{
+		Command:      "cat",
+		WarmStandby:  &process.StandbyConfig{Min: 1, Max: 1},
+		LeaderLock:   staticLock{},
+		AdvertiseURL: "http://127.0.0.1:8080",
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err == nil {
+		t.Error("NewServer() with warm standby and leader lock expected error but got none")
+	}
+}
+
+func TestNewServer_InvalidWarmStandby(t *testing.T) {
+	_, err := NewServer(&Config{
+		Command:     "cat",
+		WarmStandby: &process.StandbyConfig{Min: 2, Max: 1},
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err == nil {
+		t.Error("NewServer() with max below min expected error but got none")
+	}
+}
+
+func TestHandleMetrics_WarmStandby(t *testing.T) {
+	server := newStandbyServer(t, "cat", []string{}, map[string]string{})
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	for _, name := range []string{"tumiki_standby_size 1", "tumiki_standby_idle", "tumiki_standby_queue_depth", "tumiki_standby_queued_total", "tumiki_standby_queue_wait_seconds_total", "tumiki_standby_recycled_total"} {
+		if !strings.Contains(w.Body.String(), name) {
+			t.Errorf("metrics should contain %q:\n%s", name, w.Body.String())
+		}
+	}
+}
+
+func TestHandleMCP_WarmStandby_BackendSwitch(t *testing.T) {
+	blue := `read line; echo '{"jsonrpc":"2.0","id":1,"result":{"version":"blue"}}'`
+	green := `read line; echo '{"jsonrpc":"2.0","id":1,"result":{"version":"green"}}'`
+	server := newStandbyServer(t, "sh", []string{"-c", blue}, map[string]string{})
+
+	if got := mcpResult(t, server); !strings.Contains(got, "blue") {
+		t.Fatalf("response = %s, want blue", got)
+	}
+
+	// 切り替えると起動済みの予備プロセスは使わず、新しいコマンドで起動し直す
+	if err := server.backends.register(Backend{Version: "green", Command: "sh", Args: []string{"-c", green}}); err != nil {
+		t.Fatalf("register() error = %v", err)
+	}
+	if _, err := server.backends.activate("green"); err != nil {
+		t.Fatalf("activate() error = %v", err)
+	}
+	server.drainBackend()
+
+	if got := mcpResult(t, server); !strings.Contains(got, "green") {
+		t.Errorf("response after switch = %s, want green", got)
+	}
+}
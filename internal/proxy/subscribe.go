@@ -0,0 +1,703 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/process"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/webhook"
+)
+
+// 購読のブリッジとセッションの設定
+const (
+	DefaultSubscriptionTTL  = 5 * time.Minute  // 通知のストリームが接続していない購読のセッションを最後のアクセスから破棄するまでのデフォルト期間
+	DefaultSessionTTL       = 30 * time.Minute // initialize で作成したセッションを最後のアクセスから破棄するまでのデフォルト期間
+	maxPendingNotifications = 256              // ストリームが接続していない間に保持する通知の最大数（超えた分は古いものから破棄する）
+)
+
+// headerProtocolVersion はクライアントが初期化後のリクエストで送るプロトコルバージョンのヘッダーです。
+const headerProtocolVersion = "Mcp-Protocol-Version"
+
+// subscriptionProtocolVersion はクライアントがプロトコルバージョンを送らなかった場合に、購読のプロセスの初期化で使うバージョンです。
+const subscriptionProtocolVersion = "2025-06-18"
+
+// subscriptionInitID は購読のプロセスに送る initialize の ID です。クライアントの ID と衝突しないよう文字列にしています。
+var subscriptionInitID = json.RawMessage(`"tumiki-subscription-init"`)
+
+// errSubscriptionClosed はレスポンスを待っている間に購読のプロセスが終了したことを表します。
+var errSubscriptionClosed = errors.New("subscription process exited")
+
+// subscription は resources/subscribe か initialize を受け付けた起動し続けるプロセスと、通知を受け取るクライアントの SSE ストリームを結び付けます。
+type subscription struct {
+	session         *process.Session
+	protocolVersion string
+	ttl             time.Duration // 通知のストリームが接続していない間、最後のアクセスから保持する期間
+	usage           *usageMeter
+	budget          *budgetMeter    // セッションの実行の予算（nil で無制限）
+	meta            webhook.Session // Webhook のイベントに含めるメタデータ（API キーの ID はセッションの所有者）
+	server          string          // セッションを作成した名前付きのサーバー（/mcp では空文字列）
+	done            chan struct{}   // プロセスの出力が終了すると閉じる
+	turn            chan struct{}   // strict のセッションでレスポンスを待っているリクエスト（nil で順序を保証しない）
+
+	mu       sync.Mutex
+	waiters  map[string]chan []byte // リクエストの ID → レスポンスを待つ POST
+	stream   *notificationStream    // 接続中の GET /mcp（nil で未接続）
+	pending  [][]byte               // ストリームが接続していない間に届いた通知とサーバーからのリクエスト
+	lastSeen time.Time
+}
+
+// notificationStream はクライアントが GET /mcp で開いた1つの SSE ストリームです。
+type notificationStream struct {
+	messages chan []byte
+	replaced chan struct{} // 新しいストリームに置き換えられると閉じる
+}
+
+// subscriptions は HTTP のリクエストごとにプロセスを起動する /mcp で、購読か initialize を受け付けたプロセスを Mcp-Session-Id で管理し、
+// 以降の POST /mcp を同じプロセスに渡して、プロセスが送る notifications/resources/updated などを GET /mcp の SSE ストリームに中継します。
+type subscriptions struct {
+	server          *Server
+	subscriptionTTL time.Duration // 購読で作成したセッションの保持期間
+	sessionTTL      time.Duration // initialize で作成したセッションの保持期間
+	now             func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*subscription
+	closing  int        // close で終了させている途中のセッションの数
+	closed   *sync.Cond // closing が 0 になったことを通知する（mu を使用）
+}
+
+func newSubscriptions(server *Server, subscriptionTTL, sessionTTL time.Duration) *subscriptions {
+	if subscriptionTTL <= 0 {
+		subscriptionTTL = DefaultSubscriptionTTL
+	}
+	if sessionTTL <= 0 {
+		sessionTTL = DefaultSessionTTL
+	}
+	p := &subscriptions{
+		server:          server,
+		subscriptionTTL: subscriptionTTL,
+		sessionTTL:      sessionTTL,
+		now:             time.Now,
+		sessions:        make(map[string]*subscription),
+	}
+	p.closed = sync.NewCond(&p.mu)
+	return p
+}
+
+// create は新しいプロセスを起動し、セッションとして登録してその ID を返します。
+// handshake が true の場合はクライアントの代わりにプロセスを初期化してから登録します。
+// プロセスはリクエストより長く生存するため、リクエストのコンテキストとは切り離して起動します。
+func (p *subscriptions) create(ctx context.Context, header http.Header, protocolVersion string, ttl time.Duration, handshake bool) (string, *subscription, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("generate session id: %w", err)
+	}
+	id := hex.EncodeToString(buf)
+
+	var server string
+	if named := p.server.namedServerFor(header); named != nil {
+		server = named.backend.Version
+	}
+	executor, version := p.server.newVersionedExecutor(header)
+	session, err := executor.Start(context.Background())
+	if err != nil {
+		return "", nil, p.server.newInitializeError(err, executor.Diagnostics())
+	}
+	go p.server.keepAlive(session)
+
+	sub := &subscription{
+		session:         session,
+		protocolVersion: protocolVersion,
+		ttl:             ttl,
+		usage:           p.server.newUsageMeter(header, version),
+		budget:          newBudgetMeter(p.server.cfg.SessionBudget),
+		meta:            sessionMetadata(id, TransportStreamableHTTP, protocolVersion, version, header, p.now()),
+		server:          server,
+		done:            make(chan struct{}),
+		turn:            newSessionTurn(p.server.cfg.SessionOrdering),
+		waiters:         make(map[string]chan []byte),
+		lastSeen:        p.now(),
+	}
+	go p.dispatch(id, sub)
+
+	// リクエストごとのプロセスと違い、通知を送り続けるプロセスは初期化してから使う
+	if handshake {
+		if err := sub.initialize(ctx, protocolVersion); err != nil {
+			diagnostics := sessionDiagnostics(session, err)
+			p.closeSession(sub)
+			return "", nil, p.server.newInitializeError(err, diagnostics)
+		}
+	}
+
+	p.mu.Lock()
+	p.sessions[id] = sub
+	p.mu.Unlock()
+
+	p.server.publishSession(id, protocolVersion, ttl)
+	p.server.notifySession(webhook.EventSessionCreated, sub.meta, "", nil)
+	return id, sub, nil
+}
+
+// get はセッションを取得し、最終アクセス時刻とセッションストアの有効期限を更新します。
+func (p *subscriptions) get(id string) (*subscription, bool) {
+	p.evictExpired()
+
+	p.mu.Lock()
+	sub, ok := p.sessions[id]
+	p.mu.Unlock()
+	if ok {
+		sub.touch(p.now())
+		p.server.publishSession(id, sub.protocolVersion, sub.ttl)
+	}
+	return sub, ok
+}
+
+// lookup はリクエストの Mcp-Session-Id のセッションを取得し、セッションを作成したサーバーとクライアントからのリクエストかを検証します。
+// 見つからない場合は別のレプリカが所有するセッションであれば転送し、そうでなければ 404 を返します。
+// 別のサーバーのパスへのリクエストにはセッションがないものとして 404 を、別のクライアントのリクエストには 403 を返します。
+// レスポンスを返した場合は false を返します。
+func (p *subscriptions) lookup(w http.ResponseWriter, r *http.Request, id string) (*subscription, bool) {
+	sub, ok := p.get(id)
+	if !ok {
+		if !p.server.forwardToOwner(w, r, id) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+		}
+		return nil, false
+	}
+	if server, _ := serverNameFromPath(r.URL.Path); server != sub.server {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return nil, false
+	}
+	if !sessionOwnedBy(sub.meta, r.Header) {
+		http.Error(w, "Session belongs to another client", http.StatusForbidden)
+		return nil, false
+	}
+	return sub, true
+}
+
+// sessionOwnedBy はセッションを作成したクライアントとリクエストのクライアントが同じかを返します。
+// 認証した方式・プリンシパル・API キーが全て一致する場合に同じクライアントとみなします（認証しない場合はいずれも空文字列です）。
+func sessionOwnedBy(meta webhook.Session, header http.Header) bool {
+	return meta.AuthMethod == header.Get(headerAuthMethod) &&
+		meta.Principal == header.Get(headerPrincipal) &&
+		meta.APIKeyID == header.Get(headerAPIKeyID)
+}
+
+// remove はセッションを登録解除してプロセスを終了させます。
+// セッションが登録されていた場合は、プロセスの失敗として err とともに Webhook に通知し、バックエンドの失敗として数えます。
+func (p *subscriptions) remove(id string, err error) {
+	p.mu.Lock()
+	sub, ok := p.sessions[id]
+	delete(p.sessions, id)
+	p.mu.Unlock()
+	if ok {
+		p.server.unpublishSession(id)
+		p.closeSession(sub)
+		p.server.notifySession(webhook.EventSessionError, sub.meta, "", err)
+		p.server.fallback.failed(sub.meta.Version, err)
+	}
+}
+
+// terminate はクライアントか予算の上限が終了させたセッションを登録解除し、プロセスに SIGTERM を送って終了を待ちます。
+// reason は Webhook に通知する終了の理由です。セッションが見つからない場合は false を返します。
+func (p *subscriptions) terminate(id, reason string) bool {
+	p.mu.Lock()
+	sub, ok := p.sessions[id]
+	delete(p.sessions, id)
+	p.mu.Unlock()
+	if !ok {
+		return false
+	}
+	p.server.unpublishSession(id)
+	if err := sub.session.Terminate(); err != nil {
+		p.server.logger.Debug("Failed to terminate session process", "session", id, "error", err)
+	}
+	p.server.notifySession(webhook.EventSessionTerminated, sub.meta, reason, nil)
+	return true
+}
+
+// evictExpired は通知のストリームが接続しておらず、最後のアクセスからセッションの保持期間を過ぎたセッションを破棄します。
+func (p *subscriptions) evictExpired() {
+	p.mu.Lock()
+	now := p.now()
+	expired := make(map[string]*subscription)
+	for id, sub := range p.sessions {
+		if sub.idle(now) > sub.ttl {
+			expired[id] = sub
+			delete(p.sessions, id)
+		}
+	}
+	p.mu.Unlock()
+
+	// Close はプロセスの終了を待つためロックの外で行う
+	for id, sub := range expired {
+		go func() {
+			p.server.unpublishSession(id)
+			p.closeSession(sub)
+			p.server.notifySession(webhook.EventSessionExpired, sub.meta, "", nil)
+		}()
+	}
+}
+
+func (p *subscriptions) closeSession(sub *subscription) {
+	if err := sub.session.Close(); err != nil {
+		p.server.logger.Debug("Failed to close subscription session", "error", err)
+	}
+}
+
+// close は全てのセッションのプロセスを終了させます。接続中の通知のストリームも終了します。
+// 同時に実行している別の close（シャットダウンの開始時の close など）が終了させているセッションの終了も待ちます。
+func (p *subscriptions) close() {
+	p.mu.Lock()
+	sessions := p.sessions
+	p.sessions = make(map[string]*subscription)
+	p.closing += len(sessions)
+	p.mu.Unlock()
+
+	for id, sub := range sessions {
+		go func() {
+			p.server.unpublishSession(id)
+			p.server.drain.sessionClosed(sub.session, sub.session.Close())
+			p.server.notifySession(webhook.EventSessionTerminated, sub.meta, webhook.ReasonShutdown, nil)
+			p.mu.Lock()
+			p.closing--
+			if p.closing == 0 {
+				p.closed.Broadcast()
+			}
+			p.mu.Unlock()
+		}()
+	}
+
+	p.mu.Lock()
+	for p.closing > 0 {
+		p.closed.Wait()
+	}
+	p.mu.Unlock()
+}
+
+// dispatch はプロセスの出力を読み続け、レスポンスは待っている POST に、それ以外は通知のストリームに渡します。
+// プロセスの出力が終了した時点でセッションを破棄します。
+func (p *subscriptions) dispatch(id string, sub *subscription) {
+	var cause error
+	defer func() {
+		sub.mu.Lock()
+		close(sub.done)
+		sub.mu.Unlock()
+		p.remove(id, cause)
+	}()
+	for {
+		msg, err := sub.session.Receive(context.Background())
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				p.server.logger.Error("Process read failed", "error", err)
+				cause = err
+			}
+			return
+		}
+		if p.server.isKeepAliveResponse(msg) {
+			continue
+		}
+		parsed, err := jsonrpc.Parse(msg)
+		if err == nil && parsed.IsResponse() {
+			sub.respond(parsed.ID, msg)
+			continue
+		}
+		if !sub.deliver(msg) {
+			p.server.logger.Warn("Dropped notification for a slow subscription stream", "session", id)
+		}
+	}
+}
+
+// initialize はプロセスに initialize を送ってレスポンスを待ち、notifications/initialized を送ります。
+func (sub *subscription) initialize(ctx context.Context, protocolVersion string) error {
+	request, err := jsonrpc.NewRequest(subscriptionInitID, "initialize", map[string]any{
+		"protocolVersion": protocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "tumiki-mcp-http", "version": "0"},
+	})
+	if err != nil {
+		return err
+	}
+	response, err := sub.exchange(ctx, request)
+	if err != nil {
+		return fmt.Errorf("initialize subscription process: %w", err)
+	}
+	if msg, err := jsonrpc.Parse(response); err == nil && msg.Error != nil {
+		return fmt.Errorf("initialize subscription process: %w", msg.Error)
+	}
+	initialized, err := jsonrpc.NewNotification("notifications/initialized", nil)
+	if err != nil {
+		return err
+	}
+	_, err = sub.exchange(ctx, initialized)
+	return err
+}
+
+// exchange はメッセージをプロセスに送り、リクエストの場合は同じ ID のレスポンスを返します。
+// 通知とクライアントからのレスポンスは送るだけで nil を返します。
+// strict のセッションでは、リクエストを前のリクエストのレスポンスを受け取ってから送ります。
+// 通知（notifications/cancelled など）とサーバーからのリクエストへのレスポンスは順番を待たずに送ります。
+func (sub *subscription) exchange(ctx context.Context, msg []byte) ([]byte, error) {
+	parsed, err := jsonrpc.Parse(msg)
+	if err != nil || !parsed.IsRequest() {
+		return nil, sub.session.Send(msg)
+	}
+	release, err := sub.waitTurn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	key := string(bytes.TrimSpace(parsed.ID))
+	ch := make(chan []byte, 1)
+	sub.mu.Lock()
+	sub.waiters[key] = ch
+	sub.mu.Unlock()
+	defer func() {
+		sub.mu.Lock()
+		delete(sub.waiters, key)
+		sub.mu.Unlock()
+	}()
+
+	if err := sub.session.Send(msg); err != nil {
+		return nil, err
+	}
+	select {
+	case response := <-ch:
+		return response, nil
+	case <-sub.done:
+		return nil, errSubscriptionClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// respond はレスポンスを同じ ID のリクエストを待っている POST に渡します。待っていない場合は破棄します。
+func (sub *subscription) respond(id json.RawMessage, msg []byte) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if ch, ok := sub.waiters[string(bytes.TrimSpace(id))]; ok {
+		// 同じ ID のレスポンスが重複しても待たない
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// deliver は通知を接続中のストリームに渡し、接続していない場合は次の接続まで保持します。
+// ストリームが読み取りに追いつかず破棄した場合は false を返します。
+func (sub *subscription) deliver(msg []byte) bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.stream != nil {
+		select {
+		case sub.stream.messages <- msg:
+			return true
+		default:
+			return false
+		}
+	}
+	sub.pending = append(sub.pending, msg)
+	if len(sub.pending) > maxPendingNotifications {
+		sub.pending = sub.pending[len(sub.pending)-maxPendingNotifications:]
+	}
+	return true
+}
+
+// attach は新しい通知のストリームを接続し、保持していた通知を渡します。既に接続中のストリームは置き換えます。
+func (sub *subscription) attach() *notificationStream {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.stream != nil {
+		close(sub.stream.replaced)
+	}
+	stream := &notificationStream{
+		messages: make(chan []byte, maxPendingNotifications),
+		replaced: make(chan struct{}),
+	}
+	for _, msg := range sub.pending {
+		stream.messages <- msg
+	}
+	sub.pending = nil
+	sub.stream = stream
+	return stream
+}
+
+// detach はストリームを切り離し、書き込めなかった通知を次の接続まで保持します。
+func (sub *subscription) detach(stream *notificationStream, now time.Time) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.stream == stream {
+		sub.stream = nil
+		for {
+			select {
+			case msg := <-stream.messages:
+				sub.pending = append(sub.pending, msg)
+				continue
+			default:
+			}
+			break
+		}
+	}
+	sub.lastSeen = now
+}
+
+func (sub *subscription) touch(now time.Time) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.lastSeen = now
+}
+
+// idle は通知のストリームが接続していない時間を返します。接続中は 0 です。
+func (sub *subscription) idle(now time.Time) time.Duration {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.stream != nil {
+		return 0
+	}
+	return now.Sub(sub.lastSeen)
+}
+
+// handleSubscribe は Mcp-Session-Id のない resources/subscribe を受け付けます。
+// プロセスを起動して購読を送り、レスポンスヘッダーで通知のストリームを開くための ID を返します。
+func (p *subscriptions) handleSubscribe(w http.ResponseWriter, r *http.Request, header http.Header, body []byte, responseType string) {
+	protocolVersion := r.Header.Get(headerProtocolVersion)
+	if protocolVersion == "" {
+		protocolVersion = subscriptionProtocolVersion
+	}
+
+	initCtx, cancelInit := context.WithTimeout(r.Context(), p.server.initializeTimeout())
+	defer cancelInit()
+	id, sub, err := p.create(initCtx, header, protocolVersion, p.subscriptionTTL, true)
+	if err != nil {
+		p.initializeFailed(w, body, responseType, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), ProcessTimeout)
+	defer cancel()
+
+	w.Header().Set(headerSessionID, id)
+	p.forward(ctx, w, r, id, sub, body, responseType)
+}
+
+// handleInitialize は Mcp-Session-Id のない initialize を受け付けます。
+// プロセスを起動してクライアントの initialize をそのまま送り、レスポンスヘッダーで以降のリクエストに付ける ID を返します。
+func (p *subscriptions) handleInitialize(w http.ResponseWriter, r *http.Request, header http.Header, body []byte, responseType string) {
+	var msg struct {
+		Params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		} `json:"params"`
+	}
+	_ = json.Unmarshal(body, &msg)
+	protocolVersion := msg.Params.ProtocolVersion
+	if protocolVersion == "" {
+		protocolVersion = subscriptionProtocolVersion
+	}
+
+	// initialize はプロセスの起動を含めて時間を区切り、失敗した場合は診断情報を返す
+	ctx, cancel := context.WithTimeout(r.Context(), p.server.initializeTimeout())
+	defer cancel()
+
+	id, sub, err := p.create(ctx, header, protocolVersion, p.sessionTTL, false)
+	if err != nil {
+		p.initializeFailed(w, body, responseType, err)
+		return
+	}
+	w.Header().Set(headerSessionID, id)
+	p.forward(ctx, w, r, id, sub, body, responseType)
+}
+
+// handlePost は購読か initialize で作成したセッションへの POST /mcp を処理します。
+// 購読の解除や他のリクエスト、サーバーからのリクエストへのレスポンスも同じプロセスに渡します。
+func (p *subscriptions) handlePost(w http.ResponseWriter, r *http.Request, id string, sub *subscription, responseType string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	observeBody(r.Context(), body)
+
+	body, err = p.server.prepareRequest(r.Context(), body)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), ProcessTimeout)
+	defer cancel()
+
+	w.Header().Set(headerSessionID, id)
+	p.forward(ctx, w, r, id, sub, body, responseType)
+}
+
+// forward はメッセージをセッションのプロセスに送り、リクエストの場合はレスポンスを返します。それ以外は 202 を返します。
+func (p *subscriptions) forward(ctx context.Context, w http.ResponseWriter, r *http.Request, id string, sub *subscription, body []byte, responseType string) {
+	if exceeded := sub.budget.admit(sub.session, body); exceeded != nil {
+		p.budgetExceeded(w, id, body, responseType, exceeded)
+		return
+	}
+	meter := sub.usage
+	call := meter.request(body)
+	response, err := sub.exchange(ctx, body)
+	if err != nil {
+		meter.fail(call)
+		if call.method == "initialize" {
+			diagnostics := sessionDiagnostics(sub.session, err)
+			p.remove(id, err)
+			p.initializeFailed(w, body, responseType, p.server.newInitializeError(err, diagnostics))
+			return
+		}
+		p.server.logger.Error("Process execution failed", "error", err)
+		if ctx.Err() != nil {
+			http.Error(w, "Process execution failed", http.StatusInternalServerError)
+			return
+		}
+		// 書き込めないかレスポンスの前に終了したプロセスのセッションは続けられない
+		p.remove(id, err)
+		http.Error(w, "Session closed", http.StatusGone)
+		return
+	}
+	if response == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	sub.budget.record(response)
+
+	response, err = p.server.processResponse(p.server.offloadContext(ctx, r.Header), response, call.method)
+	if err != nil {
+		p.server.logger.Error("Response processing failed", "error", err)
+		meter.fail(call)
+		http.Error(w, "Response processing failed", http.StatusInternalServerError)
+		return
+	}
+	meter.response(call, response)
+	observeResponse(r.Context(), response)
+
+	p.server.metaHeaders.set(w.Header(), response)
+	if err := writeMessage(w, responseType, response); err != nil {
+		p.server.logger.Debug("Failed to write response", "error", err)
+	}
+}
+
+// writeMessage は1つのメッセージを responseType の形式で 200 のレスポンスとして書き込みます。
+func writeMessage(w http.ResponseWriter, responseType string, msg []byte) error {
+	writeFrame := func(w io.Writer, msg []byte) error {
+		_, err := w.Write(msg)
+		return err
+	}
+	switch responseType {
+	case contentTypeSSE:
+		writeFrame = writeSSEFrame
+	case contentTypeNDJSON:
+		writeFrame = writeNDJSONFrame
+	}
+	w.Header().Set("Content-Type", responseType)
+	w.WriteHeader(http.StatusOK)
+	return writeFrame(w, msg)
+}
+
+// handleStream は GET /mcp を処理します。
+// Mcp-Session-Id のセッションのプロセスが送る通知とリクエストを、クライアントが切断するかプロセスが終了するまで SSE で返します。
+// 別のレプリカが所有するセッションの場合はそのレプリカへ転送します。
+// Accept が SSE を受け付けない場合は 406、Mcp-Session-Id がない場合は 400、別の API キーのセッションの場合は 403 を返します。
+func (p *subscriptions) handleStream(w http.ResponseWriter, r *http.Request) {
+	if accept := r.Header.Get("Accept"); accept != "" && acceptQuality(accept, contentTypeSSE) <= 0 {
+		http.Error(w, "Not Acceptable: GET /mcp only returns text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+	id := r.Header.Get(headerSessionID)
+	if id == "" {
+		http.Error(w, "Mcp-Session-Id header is required", http.StatusBadRequest)
+		return
+	}
+	sub, ok := p.lookup(w, r, id)
+	if !ok {
+		return
+	}
+
+	stream := sub.attach()
+	defer func() { sub.detach(stream, p.now()) }()
+
+	// 通知を待ち続けるため、サーバーの WriteTimeout で切断されないようにする
+	controller := http.NewResponseController(w)
+	_ = controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", contentTypeSSE)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set(headerSessionID, id)
+	w.WriteHeader(http.StatusOK)
+	_ = controller.Flush()
+
+	var keepAlive <-chan time.Time
+	if p.server.cfg.KeepAliveInterval > 0 {
+		ticker := time.NewTicker(p.server.cfg.KeepAliveInterval)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+
+	ctx := p.server.offloadContext(r.Context(), r.Header)
+	for {
+		var err error
+		select {
+		case msg := <-stream.messages:
+			if msg, err = p.server.processResponse(ctx, msg, ""); err != nil {
+				p.server.logger.Error("Response processing failed", "error", err)
+				continue
+			}
+			err = writeSSEFrame(w, msg)
+		case <-keepAlive:
+			err = writeSSEKeepAlive(w)
+		case <-stream.replaced:
+			return
+		case <-sub.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+		if err == nil {
+			err = controller.Flush()
+		}
+		if err != nil {
+			p.server.logger.Debug("Failed to write notification", "error", err)
+			return
+		}
+	}
+}
+
+// handleSessionsDisabled はセッションが無効な場合の GET /mcp と DELETE /mcp を処理します。
+// リクエストごとにプロセスを起動する構成ではサーバーから通知を送るストリームも終了させるセッションもないため、
+// Streamable HTTP の仕様に従って 405 を返します。
+func handleSessionsDisabled(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", http.MethodPost)
+	http.Error(w, r.Method+" /mcp is only available when sessions are enabled", http.StatusMethodNotAllowed)
+}
+
+// handleDelete は DELETE /mcp を処理し、Mcp-Session-Id のセッションのプロセスに SIGTERM を送って終了させます。
+// Mcp-Session-Id がない場合は 400、未知のセッションの場合は 404、別の API キーのセッションの場合は 403 を返します。
+func (p *subscriptions) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(headerSessionID)
+	if id == "" {
+		http.Error(w, "Mcp-Session-Id header is required", http.StatusBadRequest)
+		return
+	}
+	if _, ok := p.lookup(w, r, id); !ok {
+		return
+	}
+	if !p.terminate(id, webhook.ReasonClient) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
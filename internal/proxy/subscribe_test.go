@@ -0,0 +1,502 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/apikey"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jwtauth"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mcptest"
+)
+
+// newSubscriptionServer は購読のブリッジを有効にした Server を HTTP サーバーとして起動します。
+func newSubscriptionServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	return newSessionServer(t, &Config{Subscriptions: true})
+}
+
+// newSessionServer はフェイクサーバーを起動する cfg の Server を HTTP サーバーとして起動します。
+func newSessionServer(t *testing.T, cfg *Config) (*Server, *httptest.Server) {
+	t.Helper()
+	cfg.Command, cfg.Args, cfg.DefaultEnv = mcptest.Command(mcptest.ModeCompliant)
+	server, err := NewServer(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	httpServer := httptest.NewServer(server.Handler())
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.subscriptions.close()
+	})
+	return server, httpServer
+}
+
+// sessionCount はセッションの数をロックを取って返します。
+func sessionCount(p *subscriptions) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sessions)
+}
+
+func subscriptionRequest(t *testing.T, method, url, sessionID, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url+"/mcp", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sessionID != "" {
+		req.Header.Set(headerSessionID, sessionID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// readSSEData は SSE のストリームから次の message イベントのデータを読み取ります。
+func readSSEData(t *testing.T, reader *bufio.Reader) string {
+	t.Helper()
+	result := make(chan string, 1)
+	go func() {
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				result <- ""
+				return
+			}
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				result <- strings.TrimSpace(data)
+				return
+			}
+		}
+	}()
+	select {
+	case data := <-result:
+		return data
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an SSE event")
+		return ""
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	_, httpServer := newSubscriptionServer(t)
+
+	// 購読はセッションを作成し、ID を返す
+	resp := subscriptionRequest(t, "POST", httpServer.URL, "", `{"jsonrpc":"2.0","id":1,"method":"resources/subscribe","params":{"uri":"file:///a.txt"}}`)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	id := resp.Header.Get(headerSessionID)
+	if resp.StatusCode != http.StatusOK || id == "" || !strings.Contains(string(body), `"result":{}`) {
+		t.Fatalf("subscribe = %d %s (session %q), want 200 with a result and a session id", resp.StatusCode, body, id)
+	}
+
+	// ストリームを開く前に届いた通知も受け取れる
+	stream := subscriptionRequest(t, "GET", httpServer.URL, id, "")
+	defer func() { _ = stream.Body.Close() }()
+	if stream.StatusCode != http.StatusOK || stream.Header.Get("Content-Type") != contentTypeSSE {
+		t.Fatalf("GET status = %d, Content-Type = %q", stream.StatusCode, stream.Header.Get("Content-Type"))
+	}
+	reader := bufio.NewReader(stream.Body)
+	if got := readSSEData(t, reader); !strings.Contains(got, `"method":"notifications/resources/updated"`) || !strings.Contains(got, "file:///a.txt") {
+		t.Errorf("event = %s, want notifications/resources/updated for file:///a.txt", got)
+	}
+
+	// 同じセッションへのリクエストは同じプロセスで処理し、その通知もストリームに届く
+	resp = subscriptionRequest(t, "POST", httpServer.URL, id, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`)
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"text":"hi"`) {
+		t.Errorf("tools/call = %d %s, want the echo result", resp.StatusCode, body)
+	}
+	if got := readSSEData(t, reader); !strings.Contains(got, `"method":"notifications/message"`) {
+		t.Errorf("event = %s, want notifications/message", got)
+	}
+
+	// 通知には 202 を返す
+	resp = subscriptionRequest(t, "POST", httpServer.URL, id, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":9}}`)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("notification status = %d, want %d", resp.StatusCode, http.StatusAccepted)
+	}
+
+	// 終了したセッションには接続できない
+	resp = subscriptionRequest(t, "DELETE", httpServer.URL, id, "")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	resp = subscriptionRequest(t, "GET", httpServer.URL, id, "")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET after DELETE status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestSubscriptions_StatelessRequests(t *testing.T) {
+	server, httpServer := newSubscriptionServer(t)
+
+	// 購読以外のリクエストは従来どおりリクエストごとのプロセスで処理する
+	resp := subscriptionRequest(t, "POST", httpServer.URL, "", `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get(headerSessionID) != "" || !strings.Contains(string(body), `"result":{}`) {
+		t.Errorf("ping = %d %s (session %q), want the result without a session", resp.StatusCode, body, resp.Header.Get(headerSessionID))
+	}
+	if n := sessionCount(server.subscriptions); n != 0 {
+		t.Errorf("sessions = %d, want 0", n)
+	}
+}
+
+func TestSubscriptions_StreamRequestErrors(t *testing.T) {
+	_, httpServer := newSubscriptionServer(t)
+
+	tests := []struct {
+		name      string
+		sessionID string
+		accept    string
+		want      int
+	}{
+		{name: "セッションIDなし_400", want: http.StatusBadRequest},
+		{name: "未知のセッション_404", sessionID: "unknown", accept: contentTypeSSE, want: http.StatusNotFound},
+		{name: "SSEを受け付けない_406", sessionID: "unknown", accept: contentTypeJSON, want: http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", httpServer.URL+"/mcp", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.sessionID != "" {
+				req.Header.Set(headerSessionID, tt.sessionID)
+			}
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("GET status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleSessionsDisabled(t *testing.T) {
+	// セッションが無効な場合はプロセスを起動せずに 405 を返す
+	server, err := NewServer(&Config{Command: "nonexistent-command-12345"}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	for _, method := range []string{"GET", "DELETE"} {
+		req := httptest.NewRequest(method, "/mcp", nil)
+		req.Header.Set("Accept", contentTypeSSE)
+		req.Header.Set(headerSessionID, "abc")
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+
+		if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodPost {
+			t.Errorf("%s = %d (Allow %q), want 405 with Allow: POST", method, w.Code, w.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestSessions_DeleteRequestErrors(t *testing.T) {
+	_, httpServer := newSessionServer(t, &Config{Sessions: true})
+
+	tests := []struct {
+		name      string
+		sessionID string
+		want      int
+	}{
+		{name: "セッションIDなし_400", want: http.StatusBadRequest},
+		{name: "未知のセッション_404", sessionID: "unknown", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := subscriptionRequest(t, "DELETE", httpServer.URL, tt.sessionID, "")
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("DELETE status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessions(t *testing.T) {
+	server, httpServer := newSessionServer(t, &Config{Sessions: true})
+
+	// initialize はプロセスを起動してクライアントの initialize をそのまま送り、セッションの ID を返す
+	resp := subscriptionRequest(t, "POST", httpServer.URL, "", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	id := resp.Header.Get(headerSessionID)
+	if resp.StatusCode != http.StatusOK || id == "" || !strings.Contains(string(body), `"protocolVersion":"2025-03-26"`) {
+		t.Fatalf("initialize = %d %s (session %q), want the server's result and a session id", resp.StatusCode, body, id)
+	}
+
+	resp = subscriptionRequest(t, "POST", httpServer.URL, id, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("notifications/initialized status = %d, want %d", resp.StatusCode, http.StatusAccepted)
+	}
+
+	// 以降のリクエストは同じプロセスで処理する
+	resp = subscriptionRequest(t, "POST", httpServer.URL, id, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`)
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get(headerSessionID) != id || !strings.Contains(string(body), `"text":"hi"`) {
+		t.Errorf("tools/call = %d %s, want the echo result in the session", resp.StatusCode, body)
+	}
+	if n := sessionCount(server.subscriptions); n != 1 {
+		t.Errorf("sessions = %d, want 1", n)
+	}
+
+	// 購読を有効にしていない場合も、セッションの中の購読は同じプロセスに渡す
+	resp = subscriptionRequest(t, "POST", httpServer.URL, id, `{"jsonrpc":"2.0","id":3,"method":"resources/subscribe","params":{"uri":"file:///a.txt"}}`)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("resources/subscribe status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	resp = subscriptionRequest(t, "DELETE", httpServer.URL, id, "")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	// 終了したセッションへのリクエストは 404 を返し、クライアントに初期化し直させる
+	resp = subscriptionRequest(t, "POST", httpServer.URL, id, `{"jsonrpc":"2.0","id":4,"method":"ping"}`)
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("ping after DELETE = %d %s, want %d", resp.StatusCode, body, http.StatusNotFound)
+	}
+}
+
+func TestSessions_UnknownSession(t *testing.T) {
+	initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`
+	tests := []struct {
+		name string
+		// session は Mcp-Session-Id に送るセッションの ID を返します。
+		session func(t *testing.T, server *Server, url string, now *time.Time) string
+	}{
+		{
+			name:    "作成していないID_404",
+			session: func(*testing.T, *Server, string, *time.Time) string { return "deadbeef" },
+		},
+		{
+			name: "期限切れのセッション_404",
+			session: func(t *testing.T, _ *Server, url string, now *time.Time) string {
+				resp := subscriptionRequest(t, "POST", url, "", initialize)
+				_ = resp.Body.Close()
+				*now = now.Add(time.Minute + time.Second)
+				return resp.Header.Get(headerSessionID)
+			},
+		},
+		{
+			name: "DELETEしたセッション_404",
+			session: func(t *testing.T, _ *Server, url string, _ *time.Time) string {
+				resp := subscriptionRequest(t, "POST", url, "", initialize)
+				_ = resp.Body.Close()
+				id := resp.Header.Get(headerSessionID)
+				resp = subscriptionRequest(t, "DELETE", url, id, "")
+				_ = resp.Body.Close()
+				return id
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, httpServer := newSessionServer(t, &Config{Sessions: true, SessionTTL: time.Minute})
+			now := time.Now()
+			server.subscriptions.now = func() time.Time { return now }
+
+			id := tt.session(t, server, httpServer.URL, &now)
+			if id == "" {
+				t.Fatal("no session ID")
+			}
+			resp := subscriptionRequest(t, "POST", httpServer.URL, id, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusNotFound {
+				t.Errorf("status = %d %s, want %d", resp.StatusCode, body, http.StatusNotFound)
+			}
+		})
+	}
+}
+
+func TestSessions_Owner(t *testing.T) {
+	command, args, env := mcptest.Command(mcptest.ModeCompliant)
+	backend := ServerDefinition{Command: command, Args: args, DefaultEnv: env}
+	_, httpServer := newSessionServer(t, &Config{Sessions: true, Servers: map[string]ServerDefinition{"a": backend, "b": backend}})
+
+	// 認証を設定していないため、API キーの ID はクライアントが送ったものを使う
+	id := initializeSession(t, httpServer.URL+"/servers/a", http.Header{headerAPIKeyID: {"key1"}})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		keyID  string
+		want   int
+	}{
+		{name: "作成したサーバーとキー_200", method: "POST", path: "/servers/a/mcp", keyID: "key1", want: http.StatusOK},
+		{name: "別のサーバーへのPOST_404", method: "POST", path: "/servers/b/mcp", keyID: "key1", want: http.StatusNotFound},
+		{name: "デフォルトのサーバーへのPOST_404", method: "POST", path: "/mcp", keyID: "key1", want: http.StatusNotFound},
+		{name: "別のサーバーへのGET_404", method: "GET", path: "/servers/b/mcp", keyID: "key1", want: http.StatusNotFound},
+		{name: "別のサーバーへのDELETE_404", method: "DELETE", path: "/servers/b/mcp", keyID: "key1", want: http.StatusNotFound},
+		{name: "別のキーのPOST_403", method: "POST", path: "/servers/a/mcp", keyID: "key2", want: http.StatusForbidden},
+		{name: "キーなしのPOST_403", method: "POST", path: "/servers/a/mcp", want: http.StatusForbidden},
+		{name: "別のキーのGET_403", method: "GET", path: "/servers/a/mcp", keyID: "key2", want: http.StatusForbidden},
+		{name: "別のキーのDELETE_403", method: "DELETE", path: "/servers/a/mcp", keyID: "key2", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, httpServer.URL+tt.path, strings.NewReader(`{"jsonrpc":"2.0","id":2,"method":"ping"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(headerSessionID, id)
+			if tt.keyID != "" {
+				req.Header.Set(headerAPIKeyID, tt.keyID)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("%s %s status = %d %s, want %d", tt.method, tt.path, resp.StatusCode, body, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessions_OwnerPrincipal(t *testing.T) {
+	store, err := apikey.Open(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatalf("apikey.Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	key, _, err := store.Create(apikey.Key{Name: "ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := jwtauth.NewVerifier(jwtauth.Config{Secret: testJWTSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, httpServer := newSessionServer(t, &Config{
+		Sessions:    true,
+		JWT:         verifier,
+		APIKeys:     store,
+		AuthMethods: []string{AuthJWT, AuthAPIKey},
+	})
+
+	alice := "Bearer " + hs256Token(t, testJWTSecret, map[string]any{"sub": "alice"})
+	bob := "Bearer " + hs256Token(t, testJWTSecret, map[string]any{"sub": "bob"})
+	id := initializeSession(t, httpServer.URL, http.Header{"Authorization": {alice}})
+
+	tests := []struct {
+		name   string
+		method string
+		header http.Header
+		want   int
+	}{
+		{name: "作成したプリンシパルのPOST_200", method: "POST", header: http.Header{"Authorization": {alice}}, want: http.StatusOK},
+		{name: "別のプリンシパルのPOST_403", method: "POST", header: http.Header{"Authorization": {bob}}, want: http.StatusForbidden},
+		{name: "別のプリンシパルのGET_403", method: "GET", header: http.Header{"Authorization": {bob}}, want: http.StatusForbidden},
+		{name: "別のプリンシパルのDELETE_403", method: "DELETE", header: http.Header{"Authorization": {bob}}, want: http.StatusForbidden},
+		{name: "プリンシパルを偽装_403", method: "POST", header: http.Header{"Authorization": {bob}, headerPrincipal: {"alice"}}, want: http.StatusForbidden},
+		{name: "別の方式で認証したクライアント_403", method: "POST", header: http.Header{headerAPIKey: {key}}, want: http.StatusForbidden},
+		{name: "認証なし_401", method: "POST", header: http.Header{}, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, httpServer.URL+"/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":2,"method":"ping"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(headerSessionID, id)
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("%s status = %d %s, want %d", tt.method, resp.StatusCode, body, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessions_EvictIdle(t *testing.T) {
+	server, httpServer := newSessionServer(t, &Config{Sessions: true, SessionTTL: time.Minute})
+	now := time.Now()
+	server.subscriptions.now = func() time.Time { return now }
+
+	resp := subscriptionRequest(t, "POST", httpServer.URL, "", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`)
+	_ = resp.Body.Close()
+	id := resp.Header.Get(headerSessionID)
+
+	now = now.Add(30 * time.Second)
+	if _, ok := server.subscriptions.get(id); !ok {
+		t.Fatal("get() did not find the session within the TTL")
+	}
+	// 最後のアクセスから ttl を過ぎたセッションは破棄する
+	now = now.Add(time.Minute + time.Second)
+	if _, ok := server.subscriptions.get(id); ok {
+		t.Error("get() found an idle session past the TTL")
+	}
+}
+
+func TestSubscriptions_EvictIdle(t *testing.T) {
+	server, httpServer := newSubscriptionServer(t)
+	now := time.Now()
+	server.subscriptions.now = func() time.Time { return now }
+
+	resp := subscriptionRequest(t, "POST", httpServer.URL, "", `{"jsonrpc":"2.0","id":1,"method":"resources/subscribe","params":{"uri":"file:///a.txt"}}`)
+	_ = resp.Body.Close()
+	id := resp.Header.Get(headerSessionID)
+
+	// ストリームが接続していないまま ttl を過ぎたセッションは破棄する
+	now = now.Add(DefaultSubscriptionTTL + time.Second)
+	if _, ok := server.subscriptions.get(id); ok {
+		t.Error("get() found an idle session past the TTL")
+	}
+}
+
+func TestHandleOpenAPI_Subscriptions(t *testing.T) {
+	server, err := NewServer(&Config{Command: "cat", Subscriptions: true}, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest("GET", openAPIPath, nil))
+
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	for _, method := range []string{"post", "get", "delete"} {
+		if _, ok := doc.Paths["/mcp"][method]; !ok {
+			t.Errorf("/mcp is missing %s", method)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+)
+
+// serveTCP は改行区切りの JSON-RPC を直接受け付ける TCP リスナーを処理します。
+// 接続ごとに1つの stdio プロセスを起動し、ctx がキャンセルされるとリスナーと全接続を閉じます。
+func (s *Server) serveTCP(ctx context.Context, lis net.Listener) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	stop := context.AfterFunc(ctx, func() { _ = lis.Close() })
+	defer stop()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handleTCPConn(ctx, conn)
+		}()
+	}
+}
+
+// handleTCPConn は1つの TCP 接続と stdio プロセスの間でメッセージを中継します。
+// TCP には HTTP ヘッダーがないため、ヘッダーマッピングは適用されません。
+func (s *Server) handleTCPConn(ctx context.Context, conn net.Conn) {
+	defer func() {
+		if err := conn.Close(); err != nil && s.logger != nil {
+			s.logger.Debug("Failed to close connection", "error", err)
+		}
+	}()
+
+	// SPIFFE が有効な場合は mTLS のハンドシェイク後に接続元を認可する
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			s.logger.Debug("TLS handshake failed", "remote", conn.RemoteAddr().String(), "error", err)
+			return
+		}
+		state := tlsConn.ConnectionState()
+		if id, err := s.authorizeSPIFFE(&state, s.cfg.SPIFFEAllow); err != nil {
+			s.logger.Warn("SPIFFE authorization failed", "spiffe_id", id, "remote", conn.RemoteAddr().String())
+			return
+		}
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(nil, s.maxMessageSize())
+
+	recv := func() ([]byte, error) {
+		for scanner.Scan() {
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				return line, nil
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	send := func(msg []byte) error {
+		buf := net.Buffers{msg, []byte("\n")}
+		_, err := buf.WriteTo(conn)
+		return err
+	}
+
+	err := s.relay(ctx, nil, recv, send)
+	if err == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	s.logger.Debug("TCP connection closed with error", "remote", conn.RemoteAddr().String(), "error", err)
+
+	// プロセス側の失敗はクライアントが原因を判別できるよう JSON-RPC エラーとして通知する
+	if isRelayError(err) {
+		_ = send(jsonrpc.NewErrorResponse(nil, jsonrpc.CodeInternalError, err.Error()))
+	}
+}
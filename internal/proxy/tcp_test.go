@@ -0,0 +1,267 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mcptest"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/sanitize"
+)
+
+// startTCP は cfg の TCP リスナーをローカルで起動し、アドレスと停止関数を返します。
+// 停止関数は serveTCP の戻り値を返します。
+func startTCP(t *testing.T, cfg *Config) (string, func() error) {
+	t.Helper()
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	server, err := NewServer(cfg, logger)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.serveTCP(ctx, lis)
+	}()
+
+	stopped := false
+	var stopErr error
+	stop := func() error {
+		if !stopped {
+			stopped = true
+			cancel()
+			select {
+			case stopErr = <-errChan:
+			case <-time.After(5 * time.Second):
+				t.Error("serveTCP() did not return after cancel")
+			}
+		}
+		return stopErr
+	}
+	t.Cleanup(func() { _ = stop() })
+	return lis.Addr().String(), stop
+}
+
+// readLines は接続が閉じられるまでに受信した行をすべて返します。
+func readLines(t *testing.T, conn net.Conn) []string {
+	t.Helper()
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("SetReadDeadline() error = %v", err)
+	}
+	var lines []string
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("read error = %v", err)
+	}
+	return lines
+}
+
+func TestServeTCP(t *testing.T) {
+	command, args, env := mcptest.Command(mcptest.ModeCompliant)
+	addr, _ := startTCP(t, &Config{
+		Command:          command,
+		Args:             args,
+		DefaultEnv:       env,
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// 同一接続で複数メッセージをやり取りし、空行は無視されることを検証
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`,
+		``,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`,
+	}, "\n") + "\n"
+	if _, err := io.WriteString(conn, input); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatalf("CloseWrite() error = %v", err)
+	}
+
+	got := readLines(t, conn)
+	if len(got) != 3 {
+		t.Fatalf("received %d lines, want 3: %v", len(got), got)
+	}
+	if !strings.Contains(got[0], `"id":1`) || !strings.Contains(got[0], `"result"`) {
+		t.Errorf("first line should be the initialize response: %s", got[0])
+	}
+	if !strings.Contains(got[1], `"notifications/message"`) {
+		t.Errorf("second line should be the notification: %s", got[1])
+	}
+	if !strings.Contains(got[2], `"text":"hi"`) {
+		t.Errorf("third line should be the tools/call response: %s", got[2])
+	}
+}
+
+func TestServeTCP_Errors(t *testing.T) {
+	tests := []struct {
+		name           string
+		command        string
+		args           []string
+		maxMessageSize int
+		requestPayload sanitize.Policy
+		input          string
+		want           string
+	}{
+		{
+			name:    "プロセス異常終了_JSONRPCエラーを返す",
+			command: "sh",
+			args:    []string{"-c", "exit 1"},
+			want:    `"message":"process execution failed"`,
+		},
+		{
+			name:    "存在しないコマンド_JSONRPCエラーを返す",
+			command: "/nonexistent/command",
+			args:    []string{},
+			want:    `"message":"process start failed"`,
+		},
+		{
+			name:           "不正なUTF8_JSONRPCエラーを返す",
+			command:        "cat",
+			args:           []string{},
+			requestPayload: sanitize.PolicyValidate,
+			input:          "{\"a\":\"\xff\"}\n",
+			want:           `"message":"invalid request payload: invalid UTF-8 at byte 6"`,
+		},
+		{
+			name:           "最大サイズ超過_何も返さず切断する",
+			command:        "cat",
+			args:           []string{},
+			maxMessageSize: 16,
+			input:          `{"jsonrpc":"2.0","id":1,"method":"ping"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, _ := startTCP(t, &Config{
+				Command:          tt.command,
+				Args:             tt.args,
+				DefaultEnv:       map[string]string{},
+				HeaderEnvMapping: map[string]string{},
+				HeaderArgMapping: map[string]string{},
+				MaxMessageSize:   tt.maxMessageSize,
+				RequestPayload:   tt.requestPayload,
+			})
+
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			defer func() { _ = conn.Close() }()
+
+			if tt.input != "" {
+				if _, err := io.WriteString(conn, tt.input); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+
+			if tt.want == "" {
+				// 未読のデータが残ったまま閉じられるため RST になる場合もある
+				if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+					t.Fatalf("SetReadDeadline() error = %v", err)
+				}
+				data, err := io.ReadAll(conn)
+				if len(data) != 0 || os.IsTimeout(err) {
+					t.Errorf("ReadAll() = %q, %v, want connection closed without data", data, err)
+				}
+				return
+			}
+
+			got := readLines(t, conn)
+			if len(got) != 1 || !strings.Contains(got[0], tt.want) || !strings.Contains(got[0], `"code":-32603`) {
+				t.Errorf("received %v, want one error response containing %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeTCP_Shutdown(t *testing.T) {
+	addr, stop := startTCP(t, &Config{
+		Command:          "cat",
+		Args:             []string{},
+		DefaultEnv:       map[string]string{},
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// 接続が確立しプロセスが起動していることを確認してから停止する
+	if _, err := io.WriteString(conn, `{"id":1}`+"\n"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	if line, err := reader.ReadString('\n'); err != nil || line != "{\"id\":1}\n" {
+		t.Fatalf("ReadString() = %q, %v", line, err)
+	}
+
+	if err := stop(); err != nil {
+		t.Errorf("serveTCP() error = %v, want nil", err)
+	}
+
+	// 停止後は接続が閉じられている
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("SetReadDeadline() error = %v", err)
+	}
+	if _, err := reader.ReadString('\n'); err != io.EOF {
+		t.Errorf("ReadString() error = %v, want io.EOF", err)
+	}
+}
+
+func TestServer_Start_TCPListenError(t *testing.T) {
+	t.Setenv("HOST", "127.0.0.1")
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	// 使用中のポートを指定すると Start がエラーを返す
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer func() { _ = lis.Close() }()
+
+	server, err := NewServer(&Config{
+		Port:             0,
+		TCPPort:          lis.Addr().(*net.TCPAddr).Port,
+		Command:          "echo",
+		Args:             []string{},
+		DefaultEnv:       map[string]string{},
+		HeaderEnvMapping: map[string]string{},
+		HeaderArgMapping: map[string]string{},
+	}, logger)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	if err := server.Start(context.Background()); err == nil || !strings.Contains(err.Error(), "tcp listen") {
+		t.Errorf("Server.Start() error = %v, want tcp listen error", err)
+	}
+}
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/tokenexchange"
+)
+
+// トークン交換のエラーです。
+var (
+	errTokenRejected = errors.New("token exchange rejected") // トークンエンドポイントがクライアントのトークンを拒否した
+	errTokenExchange = errors.New("token exchange failed")   // トークンエンドポイントに接続できないなど、プロキシ側の問題で交換できなかった
+)
+
+// exchangeToken はクライアントのトークンを下流向けのトークンに交換したヘッダーを返します。
+// "Bearer " で始まる値はプレフィックスを残してトークンだけを置き換えます。
+// トークンがない場合はそのまま返します。元のヘッダーは変更しません。
+func (s *Server) exchangeToken(ctx context.Context, header http.Header) (http.Header, error) {
+	if s.cfg.TokenExchange == nil {
+		return header, nil
+	}
+	name := s.tokenExchangeHeader()
+	value := header.Get(name)
+	if value == "" {
+		return header, nil
+	}
+
+	prefix, token := "", value
+	if len(value) > len("Bearer ") && strings.EqualFold(value[:len("Bearer ")], "Bearer ") {
+		prefix, token = value[:len("Bearer ")], value[len("Bearer "):]
+	}
+	exchanged, err := s.cfg.TokenExchange.Exchange(ctx, token)
+	if errors.Is(err, tokenexchange.ErrRejected) {
+		s.logger.Warn("Token exchange rejected", "error", err)
+		return nil, errTokenRejected
+	}
+	if err != nil {
+		s.logger.Error("Token exchange failed", "error", err)
+		return nil, errTokenExchange
+	}
+
+	header = header.Clone()
+	header.Set(name, prefix+exchanged)
+	return header, nil
+}
+
+// tokenExchangeHeader は交換するトークンを含むヘッダー名を返します。
+func (s *Server) tokenExchangeHeader() string {
+	if s.cfg.TokenExchangeHeader == "" {
+		return "Authorization"
+	}
+	return s.cfg.TokenExchangeHeader
+}
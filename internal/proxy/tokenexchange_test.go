@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/tokenexchange"
+)
+
+func TestTokenExchange(t *testing.T) {
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.FormValue("subject_token") {
+		case "user-token":
+			_, _ = w.Write([]byte(`{"access_token":"downstream-token","token_type":"Bearer","expires_in":300}`))
+		case "unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		}
+	}))
+	defer sts.Close()
+	client, err := tokenexchange.New(tokenexchange.Config{Endpoint: sts.URL, Audience: "downstream"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewServer(&Config{
+		Command:          "sh",
+		Args:             []string{"-c", `read line; printf '{"token":"%s"}\n' "$TOKEN"`},
+		DefaultEnv:       map[string]string{},
+		HeaderEnvMapping: map[string]string{"Authorization": "TOKEN"},
+		TokenExchange:    client,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Bearerトークン_交換したトークンを渡す",
+			headers:    map[string]string{"Authorization": "Bearer user-token"},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"token":"Bearer downstream-token"}`,
+		},
+		{
+			name:       "トークンなし_交換せずに実行",
+			headers:    map[string]string{},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"token":""}`,
+		},
+		{
+			name:       "拒否されたトークン_401",
+			headers:    map[string]string{"Authorization": "Bearer expired-token"},
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   "Unauthorized",
+		},
+		{
+			name:       "エンドポイントが利用できない_502",
+			headers:    map[string]string{"Authorization": "Bearer unavailable"},
+			wantStatus: http.StatusBadGateway,
+			wantBody:   "Token exchange failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := mcpRequest(server, tt.headers)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d (body: %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.wantBody {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/usage"
+)
+
+// rpcCall は利用量の集計とレスポンス変換で使うリクエストの JSON-RPC のメソッド名とツール名です。
+type rpcCall struct {
+	method string
+	tool   string // tools/call の場合のみ
+}
+
+// callOf はメッセージの呼び出しを返します。
+func callOf(msg *jsonrpc.Message) rpcCall {
+	call := rpcCall{method: msg.Method}
+	if msg.Method == "tools/call" {
+		var params struct {
+			Name string `json:"name"`
+		}
+		if json.Unmarshal(msg.Params, &params) == nil {
+			call.tool = params.Name
+		}
+	}
+	return call
+}
+
+// requestCall はリクエストボディの呼び出しを返します。バッチや JSON でないボディの場合はゼロ値を返します。
+func requestCall(body []byte) rpcCall {
+	msg, err := jsonrpc.Parse(body)
+	if err != nil {
+		return rpcCall{}
+	}
+	return callOf(msg)
+}
+
+// usageMeter は1つのリクエストまたは接続の利用量を Recorder に記録します。
+// 利用量の集計が無効な場合は nil で、nil のメソッド呼び出しは何もしません。
+type usageMeter struct {
+	recorder *usage.Recorder
+	key      string // API キーの ID
+	server   string // バックエンドのバージョン
+	labels   string // X-Mcp-Labels のラベル（"key=value,key=value"）
+}
+
+// newUsageMeter は API キーの ID・バックエンドのバージョン・X-Mcp-Labels のラベルで集計する usageMeter を返します。
+func (s *Server) newUsageMeter(header http.Header, version string) *usageMeter {
+	if s.usage == nil {
+		return nil
+	}
+	m := &usageMeter{recorder: s.usage, server: version}
+	// キーの ID は apiKeyAuth が設定した場合のみ信用する
+	if s.cfg.APIKeys != nil {
+		m.key = header.Get(headerAPIKeyID)
+	}
+	if labeler := s.observer.labels; labeler != nil {
+		m.labels = labeler.format(labeler.fromHeader(header))
+	}
+	return m
+}
+
+func (m *usageMeter) dimensions(call rpcCall) usage.Dimensions {
+	return usage.Dimensions{Key: m.key, Server: m.server, Method: call.method, Tool: call.tool, Labels: m.labels}
+}
+
+// request はプロセスに送るメッセージを記録し、その呼び出しを返します。
+func (m *usageMeter) request(body []byte) rpcCall {
+	call := requestCall(body)
+	if m != nil {
+		m.recorder.RecordRequest(m.dimensions(call), len(body))
+	}
+	return call
+}
+
+// response はクライアントに返すメッセージを call の利用量として記録します。
+// JSON-RPC のエラーレスポンスはエラーとして数えます。
+func (m *usageMeter) response(call rpcCall, msg []byte) {
+	if m == nil {
+		return
+	}
+	failed := false
+	if parsed, err := jsonrpc.Parse(msg); err == nil {
+		failed = parsed.Error != nil
+	}
+	m.recorder.RecordResponse(m.dimensions(call), len(msg), failed)
+}
+
+// fail はプロセスの失敗などで call にレスポンスを返せなかったことを記録します。
+func (m *usageMeter) fail(call rpcCall) {
+	if m == nil {
+		return
+	}
+	m.recorder.RecordResponse(m.dimensions(call), 0, true)
+}
+
+// handleUsage は前回のレポートの出力以降の利用量を返します。
+func (s *Server) handleUsage(w http.ResponseWriter, _ *http.Request) {
+	s.writeJSON(w, s.usage.Snapshot())
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/apikey"
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/usage"
+)
+
+func TestRequestCall(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want rpcCall
+	}{
+		{name: "ツール呼び出し_ツール名を返す", body: `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search"}}`, want: rpcCall{method: "tools/call", tool: "search"}},
+		{name: "その他のメソッド_メソッド名のみ返す", body: `{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{"name":"search"}}`, want: rpcCall{method: "tools/list"}},
+		{name: "バッチ_ゼロ値を返す", body: `[{"jsonrpc":"2.0","id":1,"method":"ping"}]`, want: rpcCall{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requestCall([]byte(tt.body)); got != tt.want {
+				t.Errorf("requestCall() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_Usage(t *testing.T) {
+	store, err := apikey.Open(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	server, err := NewServer(&Config{
+		Command: "sh",
+		Args: []string{"-c", `read line; case "$line" in
+*broken*) echo '{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"broken"}}' ;;
+*) echo '{"jsonrpc":"2.0","id":1,"result":{}}' ;;
+esac`},
+		DefaultEnv: map[string]string{},
+		AdminToken: testAdminToken,
+		APIKeys:    store,
+		Usage:      true,
+	}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	token, id := createKey(t, server, `{"name":"ci"}`)
+
+	for _, tool := range []string{"search", "search", "broken"} {
+		req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"`+tool+`"}}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(headerAPIKey, token)
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST /mcp status = %d (body: %s)", w.Code, w.Body.String())
+		}
+	}
+
+	w := keyAdminRequest(t, server, "GET", "/admin/usage", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /admin/usage status = %d (body: %s)", w.Code, w.Body.String())
+	}
+	var report usage.Report
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+
+	type row struct {
+		dims           usage.Dimensions
+		calls, errors  int64
+		hasRequestSize bool
+	}
+	var got []row
+	for _, e := range report.Entries {
+		got = append(got, row{dims: e.Dimensions, calls: e.Calls, errors: e.Errors, hasRequestSize: e.RequestBytes > 0 && e.ResponseBytes > 0})
+	}
+	want := []row{
+		{dims: usage.Dimensions{Key: id, Server: DefaultBackendVersion, Method: "tools/call", Tool: "broken"}, calls: 1, errors: 1, hasRequestSize: true},
+		{dims: usage.Dimensions{Key: id, Server: DefaultBackendVersion, Method: "tools/call", Tool: "search"}, calls: 2, hasRequestSize: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("usage entries = %+v, want %+v", got, want)
+	}
+}
+
+func TestUsageMeter_IgnoresKeyWithoutAPIKeys(t *testing.T) {
+	server, err := NewServer(&Config{Command: "cat", Usage: true}, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{}
+	header.Set(headerAPIKeyID, "spoofed")
+	if m := server.newUsageMeter(header, "v1"); m.key != "" {
+		t.Errorf("key = %q, want empty when API keys are disabled", m.key)
+	}
+}
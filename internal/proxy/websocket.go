@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/jsonrpc"
+	"golang.org/x/net/websocket"
+)
+
+// webSocketPath は WebSocket トランスポートのエンドポイントです。
+const webSocketPath = "/ws"
+
+// webSockets は GET /ws の WebSocket の接続を処理します。
+// 接続ごとに1つの stdio プロセスを起動し、テキストまたはバイナリのメッセージ（改行区切りで複数のメッセージを含められる）を stdin に、
+// プロセスの出力を1メッセージずつテキストのメッセージとして中継します。
+// ハイジャックした接続は http.Server のシャットダウンで閉じられないため、close で全ての接続を終了させます。
+type webSockets struct {
+	server *Server
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newWebSockets(server *Server) *webSockets {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &webSockets{server: server, ctx: ctx, cancel: cancel}
+}
+
+// close は全ての接続のプロセスを終了させ、接続が閉じるまで待ちます。
+func (ws *webSockets) close() {
+	ws.cancel()
+	ws.wg.Wait()
+}
+
+// ServeHTTP はヘッダーマッピングを適用してから WebSocket にアップグレードします。
+// ヘッダーの検証に失敗した場合はアップグレードせずに HTTP のエラーを返します。
+func (ws *webSockets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// websocket.Server はハンドシェイクの検証より先に接続をハイジャックするため、アップグレードでないリクエストはここで拒否する
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		http.Error(w, "Upgrade Required: GET /ws only accepts WebSocket connections", http.StatusUpgradeRequired)
+		return
+	}
+	header, err := ws.server.requestHeaders(r.Context(), r.Header, r.URL.Path)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	if ws.ctx.Err() != nil {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	ws.wg.Add(1)
+	defer ws.wg.Done()
+
+	websocket.Server{
+		// 認証はミドルウェアで行うため、ブラウザ拡張などの任意の Origin（Origin なしを含む）を受け付ける
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			ws.handleConn(r.Context(), conn, header)
+		},
+	}.ServeHTTP(w, r)
+}
+
+// handleConn は1つの WebSocket の接続と stdio プロセスの間でメッセージを中継します。
+func (ws *webSockets) handleConn(ctx context.Context, conn *websocket.Conn, header http.Header) {
+	s := ws.server
+	defer func() {
+		if err := conn.Close(); err != nil {
+			s.logger.Debug("Failed to close WebSocket", "error", err)
+		}
+	}()
+
+	// プロセスの出力を待ち続けるため、サーバーの ReadTimeout・WriteTimeout で設定された期限を解除する
+	_ = conn.SetDeadline(time.Time{})
+	conn.MaxPayloadBytes = s.maxMessageSize()
+	conn.PayloadType = websocket.TextFrame
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(ws.ctx, cancel)
+	defer stop()
+
+	// 1つのメッセージに改行区切りで複数の JSON-RPC メッセージを含められる
+	var pending [][]byte
+	recv := func() ([]byte, error) {
+		for len(pending) == 0 {
+			var data []byte
+			if err := websocket.Message.Receive(conn, &data); err != nil {
+				return nil, err
+			}
+			for line := range bytes.SplitSeq(data, []byte("\n")) {
+				if line = bytes.TrimSpace(line); len(line) > 0 {
+					pending = append(pending, line)
+				}
+			}
+		}
+		msg := pending[0]
+		pending = pending[1:]
+		return msg, nil
+	}
+	send := func(msg []byte) error {
+		return websocket.Message.Send(conn, string(msg))
+	}
+
+	err := s.relay(ctx, header, recv, send)
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, io.EOF) {
+		return
+	}
+	s.logger.Debug("WebSocket closed with error", "remote", conn.Request().RemoteAddr, "error", err)
+
+	// プロセス側の失敗はクライアントが原因を判別できるよう JSON-RPC エラーとして通知する
+	if isRelayError(err) {
+		_ = send(jsonrpc.NewErrorResponse(nil, jsonrpc.CodeInternalError, err.Error()))
+	}
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/mcptest"
+	"golang.org/x/net/websocket"
+)
+
+// newWebSocketServer はフェイクサーバーを起動する WebSocket を有効にした Server を HTTP サーバーとして起動します。
+func newWebSocketServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	cfg := &Config{WebSocket: true}
+	cfg.Command, cfg.Args, cfg.DefaultEnv = mcptest.Command(mcptest.ModeCompliant)
+	server, err := NewServer(cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	httpServer := httptest.NewServer(server.Handler())
+	t.Cleanup(func() {
+		server.webSockets.close()
+		httpServer.Close()
+	})
+	return server, httpServer
+}
+
+// dialWebSocket は GET /ws に WebSocket で接続します。
+func dialWebSocket(t *testing.T, baseURL string) *websocket.Conn {
+	t.Helper()
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(baseURL, "http")+webSocketPath, "", baseURL)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// receiveWebSocket は id のレスポンスが届くまでメッセージを受信します（途中の通知は読み飛ばします）。
+func receiveWebSocket(t *testing.T, conn *websocket.Conn, id string) string {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg string
+		if err := websocket.Message.Receive(conn, &msg); err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		if strings.Contains(msg, `"id":`+id) {
+			return msg
+		}
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	_, httpServer := newWebSocketServer(t)
+	conn := dialWebSocket(t, httpServer.URL)
+
+	if err := websocket.Message.Send(conn, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`); err != nil {
+		t.Fatal(err)
+	}
+	if got := receiveWebSocket(t, conn, "1"); !strings.Contains(got, `"serverInfo"`) {
+		t.Errorf("initialize response = %s, want the server info", got)
+	}
+
+	// 改行区切りの複数のメッセージを1つのメッセージで送れ、レスポンスは1つずつ届く
+	if err := websocket.Message.Send(conn, "{\"jsonrpc\":\"2.0\",\"method\":\"notifications/initialized\"}\n"+
+		"{\"jsonrpc\":\"2.0\",\"id\":2,\"method\":\"tools/call\",\"params\":{\"name\":\"echo\",\"arguments\":{\"text\":\"hi\"}}}\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got := receiveWebSocket(t, conn, "2"); !strings.Contains(got, `"text":"hi"`) {
+		t.Errorf("tools/call response = %s, want the echo result", got)
+	}
+
+	// バイナリのメッセージも受け付ける
+	if err := websocket.Message.Send(conn, []byte(`{"jsonrpc":"2.0","id":3,"method":"ping"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := receiveWebSocket(t, conn, "3"); !strings.Contains(got, `"result"`) {
+		t.Errorf("ping response = %s, want a result", got)
+	}
+}
+
+func TestWebSocket_Shutdown(t *testing.T) {
+	server, httpServer := newWebSocketServer(t)
+	conn := dialWebSocket(t, httpServer.URL)
+	if err := websocket.Message.Send(conn, `{"jsonrpc":"2.0","id":1,"method":"ping"}`); err != nil {
+		t.Fatal(err)
+	}
+	receiveWebSocket(t, conn, "1")
+
+	// シャットダウンでプロセスを終了させ、接続を閉じる
+	done := make(chan struct{})
+	go func() {
+		server.webSockets.close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close() did not return")
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg string
+	if err := websocket.Message.Receive(conn, &msg); err == nil {
+		t.Errorf("Receive() after shutdown = %q, want the connection closed", msg)
+	}
+}
+
+func TestWebSocket_Endpoint(t *testing.T) {
+	tests := []struct {
+		name      string
+		webSocket bool
+		want      int
+	}{
+		{name: "有効_アップグレードでない_426", webSocket: true, want: http.StatusUpgradeRequired},
+		{name: "無効_404", webSocket: false, want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewServer(&Config{Command: "cat", WebSocket: tt.webSocket}, slog.Default())
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, httptest.NewRequest("GET", webSocketPath, nil))
+			if w.Code != tt.want {
+				t.Errorf("GET /ws status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
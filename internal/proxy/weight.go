@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/weights"
+)
+
+const (
+	// DefaultWeightInterval は重みを計算し直すデフォルトの間隔です。
+	DefaultWeightInterval = 15 * time.Second
+
+	// DefaultMaxWeight は正常なインスタンスのデフォルトの重みです。
+	DefaultMaxWeight = 100
+)
+
+// weightTimeout は停止時に重み 0 を公開するまで待つ最大時間です。
+const weightTimeout = 10 * time.Second
+
+// WeightConfig はインスタンスの健全性と重みを公開する設定です。
+type WeightConfig struct {
+	Publisher weights.Publisher // 重みを公開する先
+	Interval  time.Duration     // 重みを計算し直す間隔（0 でデフォルト）
+	MaxWeight int               // 正常なインスタンスの重み（0 でデフォルト）
+}
+
+// weightPublisher は間隔ごとにバックエンドの失敗の割合から重みを計算し、変わった時に公開します。
+// 失敗がなければ MaxWeight、全て失敗すれば 0 になり、ロードバランサーは正常なインスタンスにトラフィックを移します。
+// シャットダウンの開始時には、処理中のリクエストの完了を待つ間に新しいトラフィックが来ないよう重み 0 を公開します。
+type weightPublisher struct {
+	server *Server
+	cfg    WeightConfig
+	self   string
+	now    func() time.Time
+
+	published *weights.Report // 最後に公開できた重み（nil で未公開）
+	failing   bool            // 最後の公開に失敗した
+}
+
+// newWeightPublisher は設定を検証し、self を自身のベース URL とする weightPublisher を作成します。
+func newWeightPublisher(s *Server, cfg WeightConfig, self string) (*weightPublisher, error) {
+	if cfg.Publisher == nil {
+		return nil, fmt.Errorf("weight publisher is required")
+	}
+	if self == "" {
+		return nil, fmt.Errorf("advertise URL is required when weight publishing is configured")
+	}
+	if cfg.MaxWeight < 0 {
+		return nil, fmt.Errorf("invalid max weight %d", cfg.MaxWeight)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultWeightInterval
+	}
+	if cfg.MaxWeight == 0 {
+		cfg.MaxWeight = DefaultMaxWeight
+	}
+	return &weightPublisher{server: s, cfg: cfg, self: self, now: time.Now}, nil
+}
+
+// run は起動時に重みを公開し、ctx が終了するまで間隔ごとに計算し直します。終了時には重み 0 を公開します。
+func (w *weightPublisher) run(ctx context.Context) {
+	w.publish(ctx, w.report(0, 0))
+
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			finalCtx, cancel := context.WithTimeout(context.Background(), weightTimeout)
+			defer cancel()
+			down := w.report(0, 0)
+			down.Status, down.Weight = weights.StatusDown, 0
+			w.publish(finalCtx, down)
+			return
+		case <-ticker.C:
+			w.publish(ctx, w.report(w.server.observer.takeWindow()))
+		}
+	}
+}
+
+// report は直前の間隔のリクエストの数と失敗の数から重みを計算します。リクエストがなかった場合は正常とします。
+func (w *weightPublisher) report(requests, failures int64) weights.Report {
+	r := weights.Report{
+		ID:        w.self,
+		URL:       w.self,
+		Status:    weights.StatusHealthy,
+		Weight:    w.cfg.MaxWeight,
+		MaxWeight: w.cfg.MaxWeight,
+		Requests:  requests,
+		Failures:  failures,
+		UpdatedAt: w.now(),
+	}
+	if failures > 0 && requests > 0 {
+		r.Status = weights.StatusDegraded
+		r.Weight = int(math.Round(float64(w.cfg.MaxWeight) * (1 - float64(failures)/float64(requests))))
+	}
+	return r
+}
+
+// publish は状態か重みが前回と変わった場合と、前回の公開に失敗した場合に公開します。
+// 間隔ごとにログが出ないよう、状態が変わった時と成否が変わった時だけ出力します。
+func (w *weightPublisher) publish(ctx context.Context, r weights.Report) {
+	if !w.failing && w.published != nil && w.published.Status == r.Status && w.published.Weight == r.Weight {
+		return
+	}
+	err := w.cfg.Publisher.Publish(ctx, r)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return
+	case err != nil:
+		if !w.failing {
+			w.server.logger.Warn("Failed to publish instance weight", "status", r.Status, "weight", r.Weight, "error", err)
+		}
+		w.failing = true
+		return
+	}
+	if w.published == nil || w.published.Status != r.Status || w.failing {
+		w.server.logger.Info("Published instance weight", "status", r.Status, "weight", r.Weight, "requests", r.Requests, "failures", r.Failures)
+	}
+	w.failing = false
+	w.published = &r
+}
@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/weights"
+)
+
+// fakeWeights は公開された重みを記録する weights.Publisher です。
+type fakeWeights struct {
+	mu      sync.Mutex
+	reports []weights.Report
+	err     error
+}
+
+func (f *fakeWeights) Publish(_ context.Context, r weights.Report) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.reports = append(f.reports, r)
+	return nil
+}
+
+func (f *fakeWeights) snapshot() []weights.Report {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]weights.Report(nil), f.reports...)
+}
+
+func newTestWeightPublisher(t *testing.T, publisher weights.Publisher) *weightPublisher {
+	t.Helper()
+	server, err := NewServer(&Config{
+		Command:      "cat",
+		AdvertiseURL: "https://mcp-1.example.com",
+		Weights:      &WeightConfig{Publisher: publisher, Interval: time.Hour},
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	return server.weights
+}
+
+func TestWeightPublisher_Report(t *testing.T) {
+	w := newTestWeightPublisher(t, &fakeWeights{})
+	tests := []struct {
+		name       string
+		requests   int64
+		failures   int64
+		wantStatus string
+		wantWeight int
+	}{
+		{name: "リクエストなし_正常", wantStatus: weights.StatusHealthy, wantWeight: DefaultMaxWeight},
+		{name: "失敗なし_正常", requests: 10, wantStatus: weights.StatusHealthy, wantWeight: DefaultMaxWeight},
+		{name: "一部失敗_重みを下げる", requests: 8, failures: 2, wantStatus: weights.StatusDegraded, wantWeight: 75},
+		{name: "全て失敗_重み0", requests: 3, failures: 3, wantStatus: weights.StatusDegraded, wantWeight: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := w.report(tt.requests, tt.failures)
+			if got.Status != tt.wantStatus || got.Weight != tt.wantWeight || got.MaxWeight != DefaultMaxWeight {
+				t.Errorf("report(%d, %d) = %+v, want %s %d", tt.requests, tt.failures, got, tt.wantStatus, tt.wantWeight)
+			}
+			if got.ID != "https://mcp-1.example.com" || got.URL != got.ID {
+				t.Errorf("report ID/URL = %q/%q", got.ID, got.URL)
+			}
+		})
+	}
+}
+
+func TestWeightPublisher_Publish_変わった時だけ公開(t *testing.T) {
+	publisher := &fakeWeights{}
+	w := newTestWeightPublisher(t, publisher)
+	ctx := context.Background()
+
+	w.publish(ctx, w.report(0, 0))
+	w.publish(ctx, w.report(5, 0))
+	w.publish(ctx, w.report(4, 1))
+	w.publish(ctx, w.report(8, 2))
+
+	// 公開に失敗した場合は同じ重みでも次の間隔で公開し直す
+	publisher.err = errors.New("unavailable")
+	w.publish(ctx, w.report(0, 0))
+	publisher.err = nil
+	w.publish(ctx, w.report(0, 0))
+
+	reports := publisher.snapshot()
+	var got []int
+	for _, r := range reports {
+		got = append(got, r.Weight)
+	}
+	want := []int{100, 75, 100}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("published weights = %v, want %v", got, want)
+	}
+}
+
+func TestWeightPublisher_Run_停止時に重み0(t *testing.T) {
+	publisher := &fakeWeights{}
+	w := newTestWeightPublisher(t, publisher)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.run(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(publisher.snapshot()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	reports := publisher.snapshot()
+	if len(reports) != 2 {
+		t.Fatalf("published %d reports, want startup and shutdown", len(reports))
+	}
+	if last := reports[1]; last.Status != weights.StatusDown || last.Weight != 0 {
+		t.Errorf("last report = %+v, want down with weight 0", last)
+	}
+}
+
+func TestNewServer_Weights_AdvertiseURLなし_エラー(t *testing.T) {
+	_, err := NewServer(&Config{Command: "cat", Weights: &WeightConfig{Publisher: &fakeWeights{}}}, slog.Default())
+	if err == nil {
+		t.Error("NewServer() error = nil, want advertise URL error")
+	}
+}
+
+func TestBackendFailure(t *testing.T) {
+	tests := []struct {
+		result string
+		status string
+		want   bool
+	}{
+		{result: resultOK, status: "200"},
+		{result: resultRPCError, status: "200"},
+		{result: resultError, status: "401"},
+		{result: resultError, status: "429"},
+		{result: resultError, status: "502", want: true},
+		{result: resultPartialOutput, status: "200", want: true},
+		{result: resultError, status: "Unavailable", want: true},
+		{result: resultError, status: "PermissionDenied"},
+	}
+	for _, tt := range tests {
+		if got := backendFailure(tt.result, tt.status); got != tt.want {
+			t.Errorf("backendFailure(%q, %q) = %v, want %v", tt.result, tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Package ratelimit はクライアントごとのリクエスト数を固定ウィンドウで制限する機能を提供します。
+//
+// カウンタの保存先は Limiter として差し替えられ、単一レプリカではプロセス内の Memory を、
+// 複数レプリカで上限を共有する場合は Redis を使用します。
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultWindow はレート制限のデフォルトのウィンドウ長です。
+const DefaultWindow = time.Minute
+
+// Decision は1回のリクエストに対する判定結果です。
+type Decision struct {
+	Allowed    bool          // リクエストを許可するか
+	Limit      int           // ウィンドウあたりの上限
+	Remaining  int           // 現在のウィンドウで残っているリクエスト数
+	RetryAfter time.Duration // 次のウィンドウが始まるまでの時間
+}
+
+// Limiter はキーごとのリクエスト数を数え、上限を超えたかどうかを判定します。
+type Limiter interface {
+	// Allow はキーのリクエストを1回数え、許可するかどうかを返します。
+	Allow(ctx context.Context, key string) (Decision, error)
+	// Close はカウンタの保存先への接続を閉じます。
+	Close() error
+}
+
+// window は固定ウィンドウの計算を Memory と Redis で共有します。
+type window struct {
+	limit  int
+	length time.Duration
+	now    func() time.Time
+}
+
+// current は現在のウィンドウの番号と、次のウィンドウが始まるまでの時間を返します。
+func (w window) current() (int64, time.Duration) {
+	now := w.now().UnixNano()
+	length := w.length.Nanoseconds()
+	index := now / length
+	return index, time.Duration((index+1)*length - now)
+}
+
+// decide はウィンドウ内のリクエスト数から判定結果を作ります。
+func (w window) decide(count int, retryAfter time.Duration) Decision {
+	return Decision{
+		Allowed:    count <= w.limit,
+		Limit:      w.limit,
+		Remaining:  max(w.limit-count, 0),
+		RetryAfter: retryAfter,
+	}
+}
+
+// Memory はプロセス内でカウンタを保持する Limiter です。
+type Memory struct {
+	window
+
+	mu     sync.Mutex
+	index  int64
+	counts map[string]int
+}
+
+// NewMemory は length ごとに limit 回までリクエストを許可する Memory を作成します。
+func NewMemory(limit int, length time.Duration) *Memory {
+	return &Memory{
+		window: window{limit: limit, length: length, now: time.Now},
+		counts: make(map[string]int),
+	}
+}
+
+// Allow はキーのリクエストを数えます。ウィンドウが切り替わるとすべてのカウンタをリセットします。
+func (m *Memory) Allow(_ context.Context, key string) (Decision, error) {
+	index, retryAfter := m.current()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if index != m.index {
+		m.index = index
+		clear(m.counts)
+	}
+	m.counts[key]++
+	return m.decide(m.counts[key], retryAfter), nil
+}
+
+// Close は何もしません。
+func (m *Memory) Close() error {
+	return nil
+}
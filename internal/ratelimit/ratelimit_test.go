@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemory_Allow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(100, 0)
+	m := NewMemory(2, time.Minute)
+	m.now = func() time.Time { return now }
+
+	tests := []struct {
+		name          string
+		key           string
+		advance       time.Duration
+		wantAllowed   bool
+		wantRemaining int
+	}{
+		{name: "1回目_許可", key: "a", wantAllowed: true, wantRemaining: 1},
+		{name: "2回目_許可", key: "a", wantAllowed: true, wantRemaining: 0},
+		{name: "上限超過_拒否", key: "a", wantAllowed: false, wantRemaining: 0},
+		{name: "別のキー_独立して許可", key: "b", wantAllowed: true, wantRemaining: 1},
+		{name: "次のウィンドウ_リセットされ許可", key: "a", advance: time.Minute, wantAllowed: true, wantRemaining: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+			got, err := m.Allow(ctx, tt.key)
+			if err != nil {
+				t.Fatalf("Allow() error = %v", err)
+			}
+			if got.Allowed != tt.wantAllowed || got.Remaining != tt.wantRemaining || got.Limit != 2 {
+				t.Errorf("Allow() = %+v, want allowed %v remaining %d", got, tt.wantAllowed, tt.wantRemaining)
+			}
+		})
+	}
+
+	if err := m.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+func TestWindow_Current(t *testing.T) {
+	w := window{length: time.Minute, now: func() time.Time { return time.Unix(90, 0) }}
+	index, retryAfter := w.current()
+	if index != 1 || retryAfter != 30*time.Second {
+		t.Errorf("current() = %d, %v, want 1, 30s", index, retryAfter)
+	}
+}
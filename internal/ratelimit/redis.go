@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/redis"
+)
+
+// DefaultRedisKeyPrefix はカウンタのキーに付けるプレフィックスです。
+const DefaultRedisKeyPrefix = "tumiki:ratelimit:"
+
+// Redis はカウンタを Redis に保持し、全レプリカで上限を共有する Limiter です。
+// ウィンドウごとに別のキーを INCR し、最初のリクエストで有効期限を設定します。
+type Redis struct {
+	window
+	client *redis.Client
+	prefix string
+}
+
+// NewRedis は redis://[user:password@]host[:port][/db] 形式の URL から Redis を作成します。
+func NewRedis(rawURL string, limit int, length time.Duration) (*Redis, error) {
+	client, err := redis.NewClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Redis{
+		window: window{limit: limit, length: length, now: time.Now},
+		client: client,
+		prefix: DefaultRedisKeyPrefix,
+	}, nil
+}
+
+// Allow はキーのリクエストを現在のウィンドウのカウンタに加算します。
+func (r *Redis) Allow(ctx context.Context, key string) (Decision, error) {
+	index, retryAfter := r.current()
+	counter := r.prefix + key + ":" + strconv.FormatInt(index, 10)
+
+	reply, _, err := r.client.Do(ctx, "INCR", counter)
+	if err != nil {
+		return Decision{}, err
+	}
+	count, err := strconv.Atoi(string(reply))
+	if err != nil {
+		return Decision{}, fmt.Errorf("unexpected INCR reply %q", reply)
+	}
+	if count == 1 {
+		// 時刻のずれがあってもウィンドウ中に消えないよう、ウィンドウ長だけ余裕を持たせる
+		ttl := retryAfter + r.length
+		if _, _, err := r.client.Do(ctx, "PEXPIRE", counter, strconv.FormatInt(ttl.Milliseconds(), 10)); err != nil {
+			return Decision{}, err
+		}
+	}
+	return r.decide(count, retryAfter), nil
+}
+
+// Close は Redis への接続を閉じます。
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/redistest"
+)
+
+func TestRedis_Allow(t *testing.T) {
+	fake := redistest.Start(t, "")
+	r, err := NewRedis("redis://"+fake.Addr(), 2, time.Minute)
+	if err != nil {
+		t.Fatalf("NewRedis() error = %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	r.now = func() time.Time { return time.Unix(90, 0) }
+	ctx := context.Background()
+
+	var allowed []bool
+	for range 3 {
+		d, err := r.Allow(ctx, "client")
+		if err != nil {
+			t.Fatalf("Allow() error = %v", err)
+		}
+		allowed = append(allowed, d.Allowed)
+		if d.RetryAfter != 30*time.Second {
+			t.Errorf("RetryAfter = %v, want 30s", d.RetryAfter)
+		}
+	}
+	if allowed[0] != true || allowed[1] != true || allowed[2] != false {
+		t.Errorf("allowed = %v, want [true true false]", allowed)
+	}
+
+	// 有効期限はウィンドウの最初のリクエストでのみ設定する
+	want := []string{
+		"INCR tumiki:ratelimit:client:1",
+		"PEXPIRE tumiki:ratelimit:client:1 90000",
+		"INCR tumiki:ratelimit:client:1",
+		"INCR tumiki:ratelimit:client:1",
+	}
+	if got := fake.Commands(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+}
+
+func TestRedis_Errors(t *testing.T) {
+	if _, err := NewRedis("memcached://localhost", 1, time.Minute); err == nil {
+		t.Error("NewRedis() with unsupported scheme expected error but got none")
+	}
+
+	ctx := context.Background()
+
+	t.Run("INCRのエラー応答_エラー", func(t *testing.T) {
+		fake := redistest.Start(t, "")
+		r, _ := NewRedis("redis://"+fake.Addr(), 1, time.Minute)
+		r.now = func() time.Time { return time.Unix(0, 0) }
+		fake.Set("tumiki:ratelimit:client:0", "abc")
+		if _, err := r.Allow(ctx, "client"); err == nil || !strings.Contains(err.Error(), "not an integer") {
+			t.Errorf("Allow() error = %v, want INCR error", err)
+		}
+	})
+
+	t.Run("認証エラー_エラー", func(t *testing.T) {
+		fake := redistest.Start(t, "secret")
+		r, _ := NewRedis("redis://"+fake.Addr(), 1, time.Minute)
+		if _, err := r.Allow(ctx, "client"); err == nil {
+			t.Error("Allow() expected error but got none")
+		}
+	})
+}
@@ -0,0 +1,224 @@
+// Package redis はセッションストアやレート制限で使用する最小限の Redis クライアントを提供します。
+//
+// 必要なコマンドは少数の文字列操作だけなので、外部ライブラリを使わずに RESP を直接話します。
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 接続設定
+const (
+	timeout = 5 * time.Second // ctx に期限がない場合の1コマンドあたりのタイムアウト
+	maxIdle = 8               // 再利用のために保持するアイドル接続の最大数
+)
+
+// Client は Redis のクライアントです。複数の goroutine から同時に使用できます。
+type Client struct {
+	addr      string
+	password  string
+	username  string
+	db        int
+	tlsConfig *tls.Config
+
+	idle chan *conn
+}
+
+// conn は Redis との1本の接続です。
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// NewClient は redis://[user:password@]host[:port][/db] 形式の URL から Client を作成します。
+// rediss:// を指定した場合は TLS で接続します。接続は最初のコマンド実行時に確立します。
+func NewClient(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse redis url: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("unsupported redis url scheme %q (supported: redis, rediss)", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("redis url has no host: %s", rawURL)
+	}
+
+	c := &Client{
+		addr: u.Host,
+		idle: make(chan *conn, maxIdle),
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.Scheme == "rediss" {
+		c.tlsConfig = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			c.username = u.User.Username()
+			c.password = password
+		} else {
+			// redis://secret@host の形式はパスワードのみの指定として扱う
+			c.password = u.User.Username()
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis database %q: %w", db, err)
+		}
+	}
+	return c, nil
+}
+
+// Close はアイドル接続を閉じます。
+func (c *Client) Close() error {
+	var errs []error
+	for {
+		select {
+		case cn := <-c.idle:
+			errs = append(errs, cn.Close())
+		default:
+			return errors.Join(errs...)
+		}
+	}
+}
+
+// Do はコマンドを実行して応答を返します。
+// 応答が nil（キーが存在しない等）の場合は ok が false になります。
+// Redis がエラー応答を返した場合は Error 型のエラーを返します。
+func (c *Client) Do(ctx context.Context, args ...string) (reply []byte, ok bool, err error) {
+	cn, err := c.conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	reply, ok, err = cn.command(ctx, args...)
+	var replyErr Error
+	if err != nil && !errors.As(err, &replyErr) {
+		// 通信エラーの接続は状態が分からないため再利用しない
+		_ = cn.Close()
+		return nil, false, err
+	}
+
+	select {
+	case c.idle <- cn:
+	default:
+		_ = cn.Close()
+	}
+	return reply, ok, err
+}
+
+// conn はアイドル接続を取り出すか、新しく接続して認証とデータベース選択を行います。
+func (c *Client) conn(ctx context.Context) (*conn, error) {
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var (
+		nc  net.Conn
+		err error
+	)
+	if c.tlsConfig != nil {
+		nc, err = (&tls.Dialer{NetDialer: dialer, Config: c.tlsConfig}).DialContext(ctx, "tcp", c.addr)
+	} else {
+		nc, err = dialer.DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connect redis: %w", err)
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc)}
+
+	var setup [][]string
+	switch {
+	case c.username != "":
+		setup = append(setup, []string{"AUTH", c.username, c.password})
+	case c.password != "":
+		setup = append(setup, []string{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	for _, args := range setup {
+		if _, _, err := cn.command(ctx, args...); err != nil {
+			_ = cn.Close()
+			return nil, fmt.Errorf("redis %s: %w", args[0], err)
+		}
+	}
+	return cn, nil
+}
+
+// Error は Redis が返したエラー応答です。接続自体は引き続き使用できます。
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// command は RESP の配列としてコマンドを送信し、応答を1つ読み取ります。
+func (c *conn) command(ctx context.Context, args ...string) ([]byte, bool, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(timeout)
+	}
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, false, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c, b.String()); err != nil {
+		return nil, false, fmt.Errorf("write redis command: %w", err)
+	}
+	return c.readReply()
+}
+
+// readReply は単純文字列・エラー・整数・バルク文字列の応答を読み取ります。
+func (c *conn) readReply() ([]byte, bool, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, false, fmt.Errorf("read redis reply: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, false, fmt.Errorf("malformed redis reply")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return []byte(line[1:]), true, nil
+	case '-':
+		return nil, false, Error(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, false, fmt.Errorf("malformed redis bulk length %q", line[1:])
+		}
+		if n < 0 {
+			return nil, false, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, false, fmt.Errorf("read redis reply: %w", err)
+		}
+		return buf[:n], true, nil
+	default:
+		return nil, false, fmt.Errorf("unsupported redis reply type %q", line[0])
+	}
+}
@@ -0,0 +1,184 @@
+// Package redistest はテスト用のインメモリ Redis サーバーを提供します。
+//
+// AUTH / SELECT / SET（NX のみ対応）/ GET / DEL / INCR / PEXPIRE のみを実装しており、有効期限は扱いません。
+// EVAL などその他のコマンドは Handle で登録できます。
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Server はフェイクの Redis サーバーです。
+type Server struct {
+	addr     string
+	password string
+
+	mu       sync.Mutex
+	data     map[string]string
+	commands []string
+	handlers map[string]HandlerFunc
+}
+
+// HandlerFunc は追加のコマンドを処理し、RESP 形式の応答を返します。
+// サーバーのロックを保持した状態で呼ばれるため、data を直接読み書きできます。
+type HandlerFunc func(data map[string]string, args []string) string
+
+// Start はフェイクサーバーを起動します。password が空でない場合は AUTH を要求します。
+// サーバーはテスト終了時に停止します。
+func Start(t testing.TB, password string) *Server {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { _ = lis.Close() })
+
+	s := &Server{
+		addr:     lis.Addr().String(),
+		password: password,
+		data:     make(map[string]string),
+		handlers: make(map[string]HandlerFunc),
+	}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// Addr はサーバーのアドレスを返します。
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// Handle は追加のコマンドを登録します。
+func (s *Server) Handle(name string, fn HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[name] = fn
+}
+
+// Set はキーに値を直接設定します。
+func (s *Server) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+}
+
+// Get はキーの値を直接取得します。
+func (s *Server) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	return v, ok
+}
+
+// Commands は受け取ったコマンドを空白区切りの文字列として返します。
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	authed := s.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		reply := s.handle(args, &authed)
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handle(args []string, authed *bool) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, strings.Join(args, " "))
+
+	switch {
+	case args[0] == "AUTH":
+		if args[len(args)-1] != s.password {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		*authed = true
+		return "+OK\r\n"
+	case !*authed:
+		return "-NOAUTH Authentication required.\r\n"
+	case args[0] == "SELECT":
+		return "+OK\r\n"
+	case args[0] == "SET" && len(args) >= 3:
+		if _, exists := s.data[args[1]]; exists && slices.Contains(args[3:], "NX") {
+			return "$-1\r\n"
+		}
+		s.data[args[1]] = args[2]
+		return "+OK\r\n"
+	case args[0] == "GET" && len(args) == 2:
+		v, ok := s.data[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case args[0] == "DEL" && len(args) == 2:
+		if _, ok := s.data[args[1]]; !ok {
+			return ":0\r\n"
+		}
+		delete(s.data, args[1])
+		return ":1\r\n"
+	case args[0] == "INCR" && len(args) == 2:
+		n, err := strconv.Atoi(s.data[args[1]])
+		if err != nil && s.data[args[1]] != "" {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		s.data[args[1]] = strconv.Itoa(n + 1)
+		return fmt.Sprintf(":%d\r\n", n+1)
+	case args[0] == "PEXPIRE" && len(args) == 3:
+		return ":1\r\n"
+	case s.handlers[args[0]] != nil:
+		return s.handlers[args[0]](s.data, args)
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+// readCommand は RESP の配列として送られたコマンドを読み取ります。
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("malformed command: %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
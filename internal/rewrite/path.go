@@ -0,0 +1,111 @@
+package rewrite
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// segment はパスの1要素です（オブジェクトのキー、配列のインデックス、または [*]）。
+type segment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parsePath は "result.content[*].text" 形式のパスを分解します。
+func parsePath(path string) ([]segment, error) {
+	if path == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+
+	var segs []segment
+	for _, part := range strings.Split(path, ".") {
+		key, rest, hasIndex := strings.Cut(part, "[")
+		if key == "" && !hasIndex {
+			return nil, fmt.Errorf("invalid path %q: empty segment", path)
+		}
+		if key != "" {
+			segs = append(segs, segment{key: key})
+		}
+		for hasIndex {
+			var idx string
+			var ok bool
+			idx, rest, ok = strings.Cut(rest, "]")
+			if !ok {
+				return nil, fmt.Errorf("invalid path %q: missing ']'", path)
+			}
+			if idx == "*" {
+				segs = append(segs, segment{wildcard: true})
+			} else {
+				n, err := strconv.Atoi(idx)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid path %q: bad index %q", path, idx)
+				}
+				segs = append(segs, segment{index: n, isIndex: true})
+			}
+			if rest == "" {
+				break
+			}
+			if !strings.HasPrefix(rest, "[") {
+				return nil, fmt.Errorf("invalid path %q: unexpected %q", path, rest)
+			}
+			rest = rest[1:]
+		}
+	}
+	return segs, nil
+}
+
+// visitParents はパスの最後の要素を含むコンテナ（map または slice）ごとに fn を呼び出します。
+// create が true の場合、存在しない中間オブジェクトをキー要素に限り作成します。
+func visitParents(node any, segs []segment, create bool, fn func(container any, last segment)) {
+	if len(segs) == 1 {
+		fn(node, segs[0])
+		return
+	}
+
+	seg, rest := segs[0], segs[1:]
+	switch v := node.(type) {
+	case map[string]any:
+		if seg.isIndex || seg.wildcard {
+			return
+		}
+		child, ok := v[seg.key]
+		if !ok || child == nil {
+			if !create || rest[0].isIndex || rest[0].wildcard {
+				return
+			}
+			child = make(map[string]any)
+			v[seg.key] = child
+		}
+		visitParents(child, rest, create, fn)
+	case []any:
+		switch {
+		case seg.wildcard:
+			for _, child := range v {
+				visitParents(child, rest, create, fn)
+			}
+		case seg.isIndex && seg.index < len(v):
+			visitParents(v[seg.index], rest, create, fn)
+		}
+	}
+}
+
+// updateValues はパスに一致する全ての値を fn の戻り値で置き換えます。
+func updateValues(root any, segs []segment, fn func(value any) any) {
+	visitParents(root, segs, false, func(container any, last segment) {
+		switch c := container.(type) {
+		case map[string]any:
+			if value, ok := c[last.key]; ok && !last.isIndex && !last.wildcard {
+				c[last.key] = fn(value)
+			}
+		case []any:
+			for i := range c {
+				if last.wildcard || (last.isIndex && last.index == i) {
+					c[i] = fn(c[i])
+				}
+			}
+		}
+	})
+}
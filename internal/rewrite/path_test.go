@@ -0,0 +1,46 @@
+package rewrite
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		expected  []segment
+		wantError bool
+	}{
+		{name: "ドット区切り_キーに分解される", path: "result.content", expected: []segment{{key: "result"}, {key: "content"}}},
+		{
+			name:     "ワイルドカードとインデックス_分解される",
+			path:     "result.content[*].items[2]",
+			expected: []segment{{key: "result"}, {key: "content"}, {wildcard: true}, {key: "items"}, {index: 2, isIndex: true}},
+		},
+		{name: "連続したインデックス_分解される", path: "a[0][1]", expected: []segment{{key: "a"}, {index: 0, isIndex: true}, {index: 1, isIndex: true}}},
+		{name: "空のパス_エラーを返す", path: "", wantError: true},
+		{name: "空のセグメント_エラーを返す", path: "a..b", wantError: true},
+		{name: "閉じ括弧なし_エラーを返す", path: "a[0", wantError: true},
+		{name: "数値でないインデックス_エラーを返す", path: "a[x]", wantError: true},
+		{name: "インデックス後の不正な文字_エラーを返す", path: "a[0]b", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePath(tt.path)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("parsePath(%q) expected error but got none", tt.path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePath(%q) unexpected error: %v", tt.path, err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("parsePath(%q) = %+v, want %+v", tt.path, got, tt.expected)
+			}
+		})
+	}
+}
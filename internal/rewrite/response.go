@@ -0,0 +1,189 @@
+package rewrite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/templatefunc"
+)
+
+// ResponseTransform はバックエンドのレスポンスに適用する1件の変換です。
+//
+// パスは "result.content[*].text" のようにドット区切りと配列インデックス（[0] または [*]）で指定します。
+// 適用順は Delete → Truncate → Set です。
+type ResponseTransform struct {
+	// Method は対象とするリクエストのメソッド名です。空の場合は全てのレスポンスが対象です。
+	Method string `json:"method,omitempty"`
+	// Delete は削除するフィールドのパスです。
+	Delete []string `json:"delete,omitempty"`
+	// Truncate はパスごとの文字列の最大文字数です。超過分は切り詰めて注記を付けます。
+	Truncate map[string]int `json:"truncate,omitempty"`
+	// Set はパスに設定する値です。文字列の値は text/template として評価されます
+	// （{{.Method}} でリクエストのメソッド名を参照でき、lower・sha256 などの templatefunc の関数を使えます）。
+	Set map[string]any `json:"set,omitempty"`
+}
+
+// ResponseTransforms は順に適用されるレスポンス変換の一覧です。
+type ResponseTransforms []ResponseTransform
+
+// TemplateData は Set のテンプレートから参照できる値です。
+type TemplateData struct {
+	Method string // リクエストのメソッド名
+}
+
+// LoadResponseTransforms は JSON ファイルからレスポンス変換を読み込みます。
+func LoadResponseTransforms(path string) (ResponseTransforms, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read response transforms: %w", err)
+	}
+	var transforms ResponseTransforms
+	if err := json.Unmarshal(data, &transforms); err != nil {
+		return nil, fmt.Errorf("parse response transforms %s: %w", path, err)
+	}
+	if err := transforms.Validate(); err != nil {
+		return nil, err
+	}
+	return transforms, nil
+}
+
+// Validate はパスとテンプレートの構文を検証します。
+func (t ResponseTransforms) Validate() error {
+	for i, tr := range t {
+		paths := append([]string{}, tr.Delete...)
+		for path, limit := range tr.Truncate {
+			if limit <= 0 {
+				return fmt.Errorf("response transform %d: truncate limit for %q must be positive", i, path)
+			}
+			paths = append(paths, path)
+		}
+		for path, value := range tr.Set {
+			paths = append(paths, path)
+			if s, ok := value.(string); ok {
+				if _, err := template.New("set").Funcs(templatefunc.FuncMap()).Parse(s); err != nil {
+					return fmt.Errorf("response transform %d: invalid template for %q: %w", i, path, err)
+				}
+			}
+		}
+		for _, path := range paths {
+			if _, err := parsePath(path); err != nil {
+				return fmt.Errorf("response transform %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Apply はレスポンスメッセージに変換を適用します。
+// レスポンス以外のメッセージ（通知など）や JSON として解釈できない出力はそのまま返します。
+func (t ResponseTransforms) Apply(msg []byte, data TemplateData) ([]byte, error) {
+	if len(t) == 0 {
+		return msg, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(msg))
+	decoder.UseNumber()
+	var root map[string]any
+	if err := decoder.Decode(&root); err != nil {
+		return msg, nil
+	}
+	if _, isResponse := root["id"]; !isResponse || root["method"] != nil {
+		return msg, nil
+	}
+
+	applied := false
+	for _, tr := range t {
+		if tr.Method != "" && tr.Method != data.Method {
+			continue
+		}
+		if err := tr.apply(root, data); err != nil {
+			return nil, err
+		}
+		applied = true
+	}
+	if !applied {
+		return msg, nil
+	}
+
+	out, err := json.Marshal(root)
+	if err != nil {
+		return nil, fmt.Errorf("encode transformed response: %w", err)
+	}
+	return out, nil
+}
+
+func (tr ResponseTransform) apply(root map[string]any, data TemplateData) error {
+	for _, path := range tr.Delete {
+		segs, err := parsePath(path)
+		if err != nil {
+			return err
+		}
+		visitParents(root, segs, false, func(container any, last segment) {
+			if m, ok := container.(map[string]any); ok && !last.isIndex && !last.wildcard {
+				delete(m, last.key)
+			}
+		})
+	}
+
+	for path, limit := range tr.Truncate {
+		segs, err := parsePath(path)
+		if err != nil {
+			return err
+		}
+		updateValues(root, segs, func(value any) any {
+			s, ok := value.(string)
+			if !ok || utf8.RuneCountInString(s) <= limit {
+				return value
+			}
+			runes := []rune(s)
+			return fmt.Sprintf("%s… [truncated %d characters]", string(runes[:limit]), len(runes)-limit)
+		})
+	}
+
+	for path, value := range tr.Set {
+		segs, err := parsePath(path)
+		if err != nil {
+			return err
+		}
+		resolved, err := renderValue(value, data)
+		if err != nil {
+			return fmt.Errorf("render %q: %w", path, err)
+		}
+		visitParents(root, segs, true, func(container any, last segment) {
+			switch c := container.(type) {
+			case map[string]any:
+				if !last.isIndex && !last.wildcard {
+					c[last.key] = resolved
+				}
+			case []any:
+				for i := range c {
+					if last.wildcard || (last.isIndex && last.index == i) {
+						c[i] = resolved
+					}
+				}
+			}
+		})
+	}
+	return nil
+}
+
+func renderValue(value any, data TemplateData) (any, error) {
+	s, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+	tmpl, err := template.New("set").Funcs(templatefunc.FuncMap()).Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	return b.String(), nil
+}
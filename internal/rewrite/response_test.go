@@ -0,0 +1,142 @@
+package rewrite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResponseTransforms_Apply(t *testing.T) {
+	tests := []struct {
+		name       string
+		transforms ResponseTransforms
+		method     string
+		input      string
+		expected   string
+	}{
+		{
+			name:       "フィールド削除_削除される",
+			transforms: ResponseTransforms{{Delete: []string{"result.structuredContent", "result.content[*].annotations"}}},
+			input:      `{"jsonrpc":"2.0","id":1,"result":{"structuredContent":{},"content":[{"type":"text","text":"a","annotations":{}}]}}`,
+			expected:   `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"a"}]}}`,
+		},
+		{
+			name:       "長いテキストの切り詰め_注記付きで切り詰められる",
+			transforms: ResponseTransforms{{Method: "tools/call", Truncate: map[string]int{"result.content[*].text": 3}}},
+			method:     "tools/call",
+			input:      `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"あいうえお"},{"type":"text","text":"ab"}]}}`,
+			expected:   `{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"あいう… [truncated 2 characters]"},{"type":"text","text":"ab"}]}}`,
+		},
+		{
+			name:       "テンプレートでメタデータ付与_中間オブジェクトが作成される",
+			transforms: ResponseTransforms{{Set: map[string]any{"result._meta.adapter": "tumiki:{{.Method}}", "result._meta.version": 2}}},
+			method:     "tools/list",
+			input:      `{"jsonrpc":"2.0","id":1,"result":{"tools":[]}}`,
+			expected:   `{"jsonrpc":"2.0","id":1,"result":{"tools":[],"_meta":{"adapter":"tumiki:tools/list","version":2}}}`,
+		},
+		{
+			name:       "テンプレートの関数_適用される",
+			transforms: ResponseTransforms{{Set: map[string]any{"result._meta.method": `{{.Method | trimPrefix "tools/" | upper}}`}}},
+			method:     "tools/call",
+			input:      `{"jsonrpc":"2.0","id":1,"result":{}}`,
+			expected:   `{"jsonrpc":"2.0","id":1,"result":{"_meta":{"method":"CALL"}}}`,
+		},
+		{
+			name:       "インデックス指定の設定_該当要素のみ置き換えられる",
+			transforms: ResponseTransforms{{Set: map[string]any{"result.items[1]": "x", "result.items[5]": "y"}}},
+			input:      `{"jsonrpc":"2.0","id":1,"result":{"items":["a","b"]}}`,
+			expected:   `{"jsonrpc":"2.0","id":1,"result":{"items":["a","x"]}}`,
+		},
+		{
+			name:       "エラーレスポンス_対象になる",
+			transforms: ResponseTransforms{{Delete: []string{"error.data"}}},
+			input:      `{"jsonrpc":"2.0","id":1,"error":{"code":-1,"message":"m","data":"stack"}}`,
+			expected:   `{"jsonrpc":"2.0","id":1,"error":{"code":-1,"message":"m"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.transforms.Apply([]byte(tt.input), TemplateData{Method: tt.method})
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if !jsonEqual(t, got, tt.expected) {
+				t.Errorf("Apply() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResponseTransforms_Apply_Unchanged(t *testing.T) {
+	transforms := ResponseTransforms{{Method: "tools/call", Delete: []string{"result"}}}
+
+	tests := []struct {
+		name   string
+		method string
+		input  string
+	}{
+		{name: "メソッド不一致_そのまま返す", method: "tools/list", input: `{"jsonrpc":"2.0","id":1,"result":{}}`},
+		{name: "通知_そのまま返す", method: "tools/call", input: `{"jsonrpc":"2.0","method":"notifications/message"}`},
+		{name: "JSONでない出力_そのまま返す", method: "tools/call", input: `plain text`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := transforms.Apply([]byte(tt.input), TemplateData{Method: tt.method})
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if string(got) != tt.input {
+				t.Errorf("Apply() = %s, want %s", got, tt.input)
+			}
+		})
+	}
+}
+
+func TestResponseTransforms_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		transforms ResponseTransforms
+		wantError  bool
+	}{
+		{name: "正常な変換_エラーなし", transforms: ResponseTransforms{{Delete: []string{"result.a"}, Set: map[string]any{"result.b": "{{.Method}}"}}}},
+		{name: "不正なパス_エラーを返す", transforms: ResponseTransforms{{Delete: []string{"a[x]"}}}, wantError: true},
+		{name: "不正なテンプレート_エラーを返す", transforms: ResponseTransforms{{Set: map[string]any{"a": "{{"}}}, wantError: true},
+		{name: "未定義の関数_エラーを返す", transforms: ResponseTransforms{{Set: map[string]any{"a": "{{title .Method}}"}}}, wantError: true},
+		{name: "0以下の切り詰め上限_エラーを返す", transforms: ResponseTransforms{{Truncate: map[string]int{"a": 0}}}, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.transforms.Validate()
+			if (err != nil) != tt.wantError {
+				t.Errorf("Validate() error = %v, wantError %v", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestLoadResponseTransforms(t *testing.T) {
+	dir := t.TempDir()
+	ok := filepath.Join(dir, "ok.json")
+	bad := filepath.Join(dir, "bad.json")
+	invalid := filepath.Join(dir, "invalid.json")
+	_ = os.WriteFile(ok, []byte(`[{"method":"tools/call","truncate":{"result.content[*].text":100}}]`), 0o600)
+	_ = os.WriteFile(bad, []byte(`[`), 0o600)
+	_ = os.WriteFile(invalid, []byte(`[{"delete":["a[x]"]}]`), 0o600)
+
+	transforms, err := LoadResponseTransforms(ok)
+	if err != nil {
+		t.Fatalf("LoadResponseTransforms() error = %v", err)
+	}
+	if len(transforms) != 1 || transforms[0].Truncate["result.content[*].text"] != 100 {
+		t.Errorf("LoadResponseTransforms() = %+v", transforms)
+	}
+
+	for _, path := range []string{bad, invalid, filepath.Join(dir, "missing.json")} {
+		if _, err := LoadResponseTransforms(path); err == nil {
+			t.Errorf("LoadResponseTransforms(%s) expected error but got none", path)
+		}
+	}
+}
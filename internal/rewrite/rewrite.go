@@ -0,0 +1,175 @@
+// Package rewrite は JSON-RPC メッセージを宣言的な設定で書き換える機能を提供します。
+//
+// リクエスト側の Rules はクライアントとラップ対象サーバーのバージョン差異（メソッド名の変更、
+// 必須パラメータの追加など）を吸収し、レスポンス側の ResponseTransforms は冗長なツール結果の
+// 切り詰めやアダプターのメタデータ付与などに使用します。
+package rewrite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Rule は1件の書き換えルールです。
+//
+// パスはメッセージのルートからのドット区切りで指定します（例: "params._meta"）。
+type Rule struct {
+	// Method は対象メソッド名です。空の場合は全てのリクエスト・通知が対象です。
+	Method string `json:"method,omitempty"`
+	// RenameTo が指定されている場合、メソッド名を置き換えます。
+	RenameTo string `json:"renameTo,omitempty"`
+	// DefaultParams は params に存在しない場合のみ追加する値です（キーは params からのドット区切りパス）。
+	DefaultParams map[string]any `json:"defaultParams,omitempty"`
+	// DropFields は削除するフィールドのパスです。
+	DropFields []string `json:"dropFields,omitempty"`
+}
+
+// Rules は順に適用される書き換えルールの一覧です。
+// 各ルールは直前のルールを適用した後のメソッド名で照合されます。
+type Rules []Rule
+
+// Load は JSON ファイルから書き換えルールを読み込みます。
+func Load(path string) (Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rewrite rules: %w", err)
+	}
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse rewrite rules %s: %w", path, err)
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Validate はルールの内容を検証します。
+func (r Rules) Validate() error {
+	for i, rule := range r {
+		if rule.RenameTo == "" && len(rule.DefaultParams) == 0 && len(rule.DropFields) == 0 {
+			return fmt.Errorf("rewrite rule %d has no action (renameTo, defaultParams or dropFields)", i)
+		}
+		for _, path := range rule.DropFields {
+			if path == "" || path == "jsonrpc" || path == "id" || path == "method" {
+				return fmt.Errorf("rewrite rule %d cannot drop field %q", i, path)
+			}
+		}
+		for path := range rule.DefaultParams {
+			if path == "" {
+				return fmt.Errorf("rewrite rule %d has an empty defaultParams key", i)
+			}
+		}
+	}
+	return nil
+}
+
+// Apply はメッセージ（またはバッチ）にルールを適用します。
+// JSON として解釈できないメッセージや、どのルールにも一致しないメッセージはそのまま返します。
+func (r Rules) Apply(msg []byte) ([]byte, error) {
+	if len(r) == 0 {
+		return msg, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(msg))
+	decoder.UseNumber()
+	var root any
+	if err := decoder.Decode(&root); err != nil {
+		return msg, nil
+	}
+
+	changed := false
+	switch v := root.(type) {
+	case map[string]any:
+		changed = r.applyMessage(v)
+	case []any:
+		for _, item := range v {
+			if obj, ok := item.(map[string]any); ok {
+				changed = r.applyMessage(obj) || changed
+			}
+		}
+	}
+	if !changed {
+		return msg, nil
+	}
+
+	data, err := json.Marshal(root)
+	if err != nil {
+		return nil, fmt.Errorf("encode rewritten message: %w", err)
+	}
+	return data, nil
+}
+
+func (r Rules) applyMessage(msg map[string]any) bool {
+	changed := false
+	for _, rule := range r {
+		method, _ := msg["method"].(string)
+		if method == "" || (rule.Method != "" && rule.Method != method) {
+			continue
+		}
+
+		if rule.RenameTo != "" && rule.RenameTo != method {
+			msg["method"] = rule.RenameTo
+			changed = true
+		}
+		for path, value := range rule.DefaultParams {
+			if setDefault(msg, "params."+path, value) {
+				changed = true
+			}
+		}
+		for _, path := range rule.DropFields {
+			if drop(msg, path) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// setDefault はパスに値が存在しない場合のみ設定します。途中のオブジェクトは必要に応じて作成します。
+func setDefault(root map[string]any, path string, value any) bool {
+	keys := strings.Split(path, ".")
+	current := root
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]any)
+		if !ok {
+			if _, exists := current[key]; exists {
+				// オブジェクト以外の値は上書きしない
+				return false
+			}
+			next = make(map[string]any)
+			current[key] = next
+		}
+		current = next
+	}
+
+	last := keys[len(keys)-1]
+	if _, exists := current[last]; exists {
+		return false
+	}
+	current[last] = value
+	return true
+}
+
+// drop はパスのフィールドを削除し、削除したかどうかを返します。
+func drop(root map[string]any, path string) bool {
+	keys := strings.Split(path, ".")
+	current := root
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]any)
+		if !ok {
+			return false
+		}
+		current = next
+	}
+
+	last := keys[len(keys)-1]
+	if _, exists := current[last]; !exists {
+		return false
+	}
+	delete(current, last)
+	return true
+}
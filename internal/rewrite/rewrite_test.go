@@ -0,0 +1,184 @@
+package rewrite
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// jsonEqual は2つの JSON が意味的に等しいかどうかを比較します。
+func jsonEqual(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid JSON: %s", got)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid expected JSON: %s", want)
+	}
+	return reflect.DeepEqual(g, w)
+}
+
+func TestRules_Apply(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    Rules
+		input    string
+		expected string
+	}{
+		{
+			name:     "メソッド名の変更_置き換えられる",
+			rules:    Rules{{Method: "tools/invoke", RenameTo: "tools/call"}},
+			input:    `{"jsonrpc":"2.0","id":1,"method":"tools/invoke"}`,
+			expected: `{"jsonrpc":"2.0","id":1,"method":"tools/call"}`,
+		},
+		{
+			name:     "デフォルトパラメータ_存在しない場合のみ追加される",
+			rules:    Rules{{Method: "tools/call", DefaultParams: map[string]any{"arguments.limit": 10, "name": "ignored"}}},
+			input:    `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search"}}`,
+			expected: `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search","arguments":{"limit":10}}}`,
+		},
+		{
+			name:     "paramsなしのリクエスト_paramsが作成される",
+			rules:    Rules{{DefaultParams: map[string]any{"cursor": ""}}},
+			input:    `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+			expected: `{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{"cursor":""}}`,
+		},
+		{
+			name:     "オブジェクト以外の中間値_上書きしない",
+			rules:    Rules{{DefaultParams: map[string]any{"arguments.limit": 10}}},
+			input:    `{"jsonrpc":"2.0","id":1,"method":"x","params":{"arguments":"raw"}}`,
+			expected: `{"jsonrpc":"2.0","id":1,"method":"x","params":{"arguments":"raw"}}`,
+		},
+		{
+			name:     "フィールドの削除_削除される",
+			rules:    Rules{{DropFields: []string{"params._meta", "params.missing.deep"}}},
+			input:    `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"_meta":{"progressToken":1},"name":"a"}}`,
+			expected: `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"a"}}`,
+		},
+		{
+			name:     "連続するルール_変更後のメソッド名で照合される",
+			rules:    Rules{{Method: "old", RenameTo: "new"}, {Method: "new", DefaultParams: map[string]any{"v": 2}}},
+			input:    `{"jsonrpc":"2.0","method":"old"}`,
+			expected: `{"jsonrpc":"2.0","method":"new","params":{"v":2}}`,
+		},
+		{
+			name:     "バッチリクエスト_各要素に適用される",
+			rules:    Rules{{Method: "a", RenameTo: "b"}},
+			input:    `[{"jsonrpc":"2.0","id":1,"method":"a"},{"jsonrpc":"2.0","id":2,"method":"c"},1]`,
+			expected: `[{"jsonrpc":"2.0","id":1,"method":"b"},{"jsonrpc":"2.0","id":2,"method":"c"},1]`,
+		},
+		{
+			name:     "大きな数値のID_精度を失わない",
+			rules:    Rules{{RenameTo: "b"}},
+			input:    `{"jsonrpc":"2.0","id":12345678901234567890,"method":"a"}`,
+			expected: `{"jsonrpc":"2.0","id":12345678901234567890,"method":"b"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rules.Apply([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if !jsonEqual(t, got, tt.expected) {
+				t.Errorf("Apply() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRules_Apply_Unchanged(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules Rules
+		input string
+	}{
+		{name: "ルールなし_そのまま返す", rules: nil, input: `{"method":"a"}`},
+		{name: "一致しないメソッド_バイト列がそのまま返る", rules: Rules{{Method: "x", RenameTo: "y"}}, input: `{ "method" : "a" }`},
+		{name: "レスポンス_対象外", rules: Rules{{RenameTo: "y"}}, input: `{"jsonrpc":"2.0","id":1,"result":{}}`},
+		{name: "JSONでない入力_そのまま返す", rules: Rules{{RenameTo: "y"}}, input: `not json`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rules.Apply([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if string(got) != tt.input {
+				t.Errorf("Apply() = %s, want %s", got, tt.input)
+			}
+		})
+	}
+}
+
+func TestRules_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		rules     Rules
+		wantError bool
+	}{
+		{name: "正常なルール_エラーなし", rules: Rules{{Method: "a", RenameTo: "b"}}, wantError: false},
+		{name: "アクションなし_エラーを返す", rules: Rules{{Method: "a"}}, wantError: true},
+		{name: "idの削除_エラーを返す", rules: Rules{{DropFields: []string{"id"}}}, wantError: true},
+		{name: "空のデフォルトパラメータキー_エラーを返す", rules: Rules{{DefaultParams: map[string]any{"": 1}}}, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rules.Validate()
+			if (err != nil) != tt.wantError {
+				t.Errorf("Validate() error = %v, wantError %v", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		expected  Rules
+		wantError bool
+	}{
+		{
+			name:     "正常なファイル_ルールが読み込まれる",
+			path:     write("ok.json", `[{"method":"a","renameTo":"b","dropFields":["params.x"]}]`),
+			expected: Rules{{Method: "a", RenameTo: "b", DropFields: []string{"params.x"}}},
+		},
+		{name: "不正なJSON_エラーを返す", path: write("bad.json", `{`), wantError: true},
+		{name: "不正なルール_エラーを返す", path: write("invalid.json", `[{"method":"a"}]`), wantError: true},
+		{name: "存在しないファイル_エラーを返す", path: filepath.Join(dir, "missing.json"), wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := Load(tt.path)
+			if tt.wantError {
+				if err == nil {
+					t.Error("Load() expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(rules, tt.expected) {
+				t.Errorf("Load() = %+v, want %+v", rules, tt.expected)
+			}
+		})
+	}
+}
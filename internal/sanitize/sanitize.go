@@ -0,0 +1,105 @@
+// Package sanitize は JSON-RPC ペイロードのバイト列を UTF-8 として検証・正規化する機能を提供します。
+//
+// ラップ対象のサーバーには不正な UTF-8 や BOM を受け取るとクラッシュするものがあり、
+// クライアントにも制御文字の混入した出力を扱えないものがあるため、プロキシの入出力で補正します。
+package sanitize
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Policy はペイロードの扱い方です。
+type Policy string
+
+// ポリシー
+const (
+	PolicyOff      Policy = ""         // 何もしない
+	PolicyValidate Policy = "validate" // 問題があればエラーを返す
+	PolicySanitize Policy = "sanitize" // 問題のあるバイトを除去・置換する
+)
+
+// bom は UTF-8 の BOM です。
+var bom = []byte{0xEF, 0xBB, 0xBF}
+
+// replacement は不正なバイト列の置換に使用する U+FFFD です。
+var replacement = []byte(string(utf8.RuneError))
+
+// ParsePolicy はフラグなどで指定された文字列をポリシーに変換します。"off" は PolicyOff として扱います。
+func ParsePolicy(s string) (Policy, error) {
+	switch Policy(s) {
+	case PolicyOff, "off":
+		return PolicyOff, nil
+	case PolicyValidate, PolicySanitize:
+		return Policy(s), nil
+	default:
+		return PolicyOff, fmt.Errorf("unknown payload policy %q (supported: off, validate, sanitize)", s)
+	}
+}
+
+// Apply はポリシーに従ってペイロードを検証または正規化します。
+// 問題がない場合は data をそのまま返します。
+func (p Policy) Apply(data []byte) ([]byte, error) {
+	switch p {
+	case PolicyValidate:
+		if err := Validate(data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	case PolicySanitize:
+		return Sanitize(data), nil
+	default:
+		return data, nil
+	}
+}
+
+// Validate は data が BOM・不正な UTF-8・制御文字を含まないことを検証します。
+// タブ・改行・復帰は JSON の空白として許可します。
+func Validate(data []byte) error {
+	if bytes.HasPrefix(data, bom) {
+		return fmt.Errorf("payload starts with a UTF-8 byte order mark")
+	}
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			return fmt.Errorf("invalid UTF-8 at byte %d", i)
+		}
+		if isControl(r) {
+			return fmt.Errorf("control character U+%04X at byte %d", r, i)
+		}
+		i += size
+	}
+	return nil
+}
+
+// Sanitize は先頭の BOM と制御文字を除去し、不正な UTF-8 を U+FFFD に置き換えます。
+func Sanitize(data []byte) []byte {
+	if Validate(data) == nil {
+		return data
+	}
+
+	for bytes.HasPrefix(data, bom) {
+		data = data[len(bom):]
+	}
+
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			out = append(out, replacement...)
+		case isControl(r):
+			// 除去する
+		default:
+			out = append(out, data[i:i+size]...)
+		}
+		i += size
+	}
+	return out
+}
+
+// isControl は JSON テキスト中に生で現れてはならない C0 制御文字かどうかを返します。
+func isControl(r rune) bool {
+	return r < 0x20 && r != '\t' && r != '\n' && r != '\r'
+}
@@ -0,0 +1,115 @@
+package sanitize
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Policy
+		wantErr bool
+	}{
+		{name: "空文字列_無効", input: "", want: PolicyOff},
+		{name: "off_無効", input: "off", want: PolicyOff},
+		{name: "validate_検証", input: "validate", want: PolicyValidate},
+		{name: "sanitize_正規化", input: "sanitize", want: PolicySanitize},
+		{name: "未知の値_エラー", input: "strict", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePolicy(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParsePolicy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "正常なJSON_エラーなし", input: "{\"text\":\"こんにちは\"}\r\n\t"},
+		{name: "先頭のBOM_エラー", input: "\xEF\xBB\xBF{}", wantErr: "byte order mark"},
+		{name: "不正なUTF8_位置を含むエラー", input: "{\"a\":\"\xff\"}", wantErr: "invalid UTF-8 at byte 6"},
+		{name: "途中で切れたマルチバイト_エラー", input: "{\"a\":\"\xe3\x81\"}", wantErr: "invalid UTF-8 at byte 6"},
+		{name: "制御文字_エラー", input: "{\"a\":\"\x00\"}", wantErr: "control character U+0000 at byte 6"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate([]byte(tt.input))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "正常なJSON_そのまま", input: `{"text":"こんにちは"}`, want: `{"text":"こんにちは"}`},
+		{name: "先頭のBOM_除去", input: "\xEF\xBB\xBF\xEF\xBB\xBF{}", want: "{}"},
+		{name: "不正なUTF8_置換文字に置き換え", input: "{\"a\":\"x\xffy\"}", want: "{\"a\":\"x�y\"}"},
+		{name: "制御文字_除去", input: "{\"a\":\"x\x00\x1by\"}\n", want: "{\"a\":\"xy\"}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(Sanitize([]byte(tt.input))); got != tt.want {
+				t.Errorf("Sanitize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy_Apply(t *testing.T) {
+	dirty := "{\"a\":\"\xff\"}"
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		want    string
+		wantErr bool
+	}{
+		{name: "無効_そのまま返す", policy: PolicyOff, want: dirty},
+		{name: "検証_エラーを返す", policy: PolicyValidate, wantErr: true},
+		{name: "正規化_置換して返す", policy: PolicySanitize, want: "{\"a\":\"�\"}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.Apply([]byte(dirty))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Apply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// 問題のないペイロードは検証を通過する
+	if got, err := PolicyValidate.Apply([]byte(`{}`)); err != nil || string(got) != `{}` {
+		t.Errorf("Apply() = %q, %v, want {}", got, err)
+	}
+}
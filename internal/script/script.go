@@ -0,0 +1,370 @@
+// Package script は Starlark のスクリプトでリクエストを拒否したり、プロセスに渡す環境変数・引数を
+// 計算したりするフックを提供します。
+//
+// WebAssembly プラグインより手軽な拡張のためのもので、スクリプトは次の関数を定義します（必要なものだけ）。
+//
+//	def allow(req):  # True（または None）で許可、False または文字列（エラーメッセージ）で拒否
+//	def env(req):    # 環境変数名 → 値の dict を返す
+//	def args(req):   # 追加する引数の list を返す
+//
+// req は path（HTTP のパス、gRPC ではメソッド名）、headers（正規化したヘッダー名 → 最初の値の dict）、
+// claims（認証で検証した JWT のクレーム、JWT で認証していない場合は空の dict）を持ちます。
+//
+// スクリプトはファイルやネットワークにアクセスできず、実行ステップ数と実行時間が制限されます。
+// Limits.MaxMemory を指定すると、実行中のプロセス全体のヒープの増加量も目安として確認します。
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/metrics"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// スクリプトの1回の実行に対するデフォルトの制限です。
+const (
+	DefaultMaxSteps = 1_000_000              // 実行ステップ数の上限
+	DefaultTimeout  = 100 * time.Millisecond // 実行時間の上限
+)
+
+// memoryCheckInterval はヒープの増加量を確認する間隔です。
+const memoryCheckInterval = 5 * time.Millisecond
+
+// heapMetric はヒープ上の生存オブジェクトのバイト数を表すランタイムメトリクスです。
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// フックとして定義する関数名です。
+const (
+	hookAllow = "allow"
+	hookEnv   = "env"
+	hookArgs  = "args"
+)
+
+// Limits はスクリプトの1回の実行に対する制限です。MaxSteps と Timeout は 0 の場合にデフォルト値を使用します。
+type Limits struct {
+	MaxSteps uint64
+	Timeout  time.Duration
+	// MaxMemory は実行中のヒープの増加量の上限です（0 で確認しない）。スクリプトごとの確保量ではなく
+	// プロセス全体のヒープで測るため、同時に処理している他のリクエストの確保や GC の時機で誤って
+	// 中断することがある、ベストエフォートの確認です。デフォルトでは無効です。
+	MaxMemory uint64
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxSteps == 0 {
+		l.MaxSteps = DefaultMaxSteps
+	}
+	if l.Timeout == 0 {
+		l.Timeout = DefaultTimeout
+	}
+	return l
+}
+
+// Request はスクリプトに渡すリクエストの情報です。
+type Request struct {
+	Path   string
+	Header http.Header
+	Claims map[string]any // 認証で検証した JWT のクレーム（JWT で認証していない場合は nil）
+}
+
+// Result はスクリプトの実行結果です。
+type Result struct {
+	Allow   bool
+	Message string // 拒否する場合のエラーメッセージ
+	Env     map[string]string
+	Args    []string
+}
+
+// Script は読み込んだ Starlark スクリプトです。グローバル変数は読み込み後に凍結されるため、
+// 複数のゴルーチンから同時に実行できます。
+type Script struct {
+	name   string
+	limits Limits
+	hooks  map[string]*starlark.Function
+}
+
+// Load は path のスクリプトを実行してフックを調べます。
+func Load(path string, limits Limits) (*Script, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read script: %w", err)
+	}
+	s := &Script{
+		name:   filepath.Base(path),
+		limits: limits.withDefaults(),
+		hooks:  make(map[string]*starlark.Function),
+	}
+
+	var globals starlark.StringDict
+	err = s.run(context.Background(), func(thread *starlark.Thread) error {
+		var err error
+		globals, err = starlark.ExecFileOptions(&syntax.FileOptions{}, thread, path, src, starlark.StringDict{
+			"struct": starlark.NewBuiltin("struct", starlarkstruct.Make),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load script %s: %w", path, err)
+	}
+
+	for _, name := range []string{hookAllow, hookEnv, hookArgs} {
+		v, ok := globals[name]
+		if !ok {
+			continue
+		}
+		fn, ok := v.(*starlark.Function)
+		if !ok || fn.NumParams() != 1 {
+			return nil, fmt.Errorf("script %s: %s must be a function with one parameter", path, name)
+		}
+		s.hooks[name] = fn
+	}
+	if len(s.hooks) == 0 {
+		return nil, fmt.Errorf("script %s defines none of allow, env or args", path)
+	}
+	return s, nil
+}
+
+// Name はスクリプトのファイル名を返します。
+func (s *Script) Name() string {
+	return s.name
+}
+
+// Eval はリクエストに対してフックを実行します。allow で拒否された場合は env と args を実行しません。
+func (s *Script) Eval(ctx context.Context, req Request) (Result, error) {
+	result := Result{Allow: true}
+	err := s.run(ctx, func(thread *starlark.Thread) error {
+		arg, err := requestValue(req)
+		if err != nil {
+			return err
+		}
+
+		if fn, ok := s.hooks[hookAllow]; ok {
+			v, err := starlark.Call(thread, fn, starlark.Tuple{arg}, nil)
+			if err != nil {
+				return err
+			}
+			switch v := v.(type) {
+			case starlark.NoneType:
+			case starlark.Bool:
+				result.Allow = bool(v)
+			case starlark.String:
+				result.Allow, result.Message = false, string(v)
+			default:
+				return fmt.Errorf("allow returned %s, want bool, string or None", v.Type())
+			}
+			if !result.Allow {
+				return nil
+			}
+		}
+
+		if fn, ok := s.hooks[hookEnv]; ok {
+			v, err := starlark.Call(thread, fn, starlark.Tuple{arg}, nil)
+			if err != nil {
+				return err
+			}
+			if result.Env, err = envValue(v); err != nil {
+				return err
+			}
+		}
+
+		if fn, ok := s.hooks[hookArgs]; ok {
+			v, err := starlark.Call(thread, fn, starlark.Tuple{arg}, nil)
+			if err != nil {
+				return err
+			}
+			if result.Args, err = argsValue(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("script %s: %w", s.name, err)
+	}
+	return result, nil
+}
+
+// run は制限を設定したスレッドで fn を実行します。実行時間または（MaxMemory を指定した場合は）ヒープの増加量が上限を超えた場合は中断します。
+func (s *Script) run(ctx context.Context, fn func(thread *starlark.Thread) error) error {
+	ctx, cancel := context.WithTimeout(ctx, s.limits.Timeout)
+	defer cancel()
+
+	thread := &starlark.Thread{
+		Name: s.name,
+		Load: func(*starlark.Thread, string) (starlark.StringDict, error) {
+			return nil, errors.New("load is not allowed")
+		},
+		Print: func(*starlark.Thread, string) {},
+	}
+	thread.SetMaxExecutionSteps(s.limits.MaxSteps)
+
+	done := make(chan struct{})
+	defer close(done)
+	go watch(ctx, done, thread, s.limits.MaxMemory)
+
+	return fn(thread)
+}
+
+// watch は ctx の終了またはヒープの増加量の超過でスレッドを中断します。maxMemory が 0 の場合はヒープを確認しません。
+func watch(ctx context.Context, done <-chan struct{}, thread *starlark.Thread, maxMemory uint64) {
+	if maxMemory == 0 {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		}
+		return
+	}
+
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	base := sample[0].Value.Uint64()
+
+	ticker := time.NewTicker(memoryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+			return
+		case <-ticker.C:
+			metrics.Read(sample)
+			if heap := sample[0].Value.Uint64(); heap > base && heap-base > maxMemory {
+				thread.Cancel("memory limit exceeded")
+				return
+			}
+		}
+	}
+}
+
+// requestValue はリクエストを Starlark の struct に変換します。
+func requestValue(req Request) (starlark.Value, error) {
+	headers := starlark.NewDict(len(req.Header))
+	for name, values := range req.Header {
+		if len(values) == 0 {
+			continue
+		}
+		if err := headers.SetKey(starlark.String(http.CanonicalHeaderKey(name)), starlark.String(values[0])); err != nil {
+			return nil, err
+		}
+	}
+	claims, err := toStarlark(req.Claims)
+	if err != nil {
+		return nil, err
+	}
+	if claims == starlark.None {
+		claims = starlark.NewDict(0)
+	}
+
+	v := starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"path":    starlark.String(req.Path),
+		"headers": headers,
+		"claims":  claims,
+	})
+	v.Freeze()
+	return v, nil
+}
+
+// toStarlark は JSON から読み込んだ値を Starlark の値に変換します。
+func toStarlark(v any) (starlark.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case string:
+		return starlark.String(v), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return starlark.MakeInt64(int64(v)), nil
+		}
+		return starlark.Float(v), nil
+	case []any:
+		elems := make([]starlark.Value, 0, len(v))
+		for _, elem := range v {
+			sv, err := toStarlark(elem)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, sv)
+		}
+		return starlark.NewList(elems), nil
+	case map[string]any:
+		if v == nil {
+			return starlark.None, nil
+		}
+		dict := starlark.NewDict(len(v))
+		for key, elem := range v {
+			sv, err := toStarlark(elem)
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(starlark.String(key), sv); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	default:
+		return nil, fmt.Errorf("unsupported claim type %T", v)
+	}
+}
+
+// envValue は env の戻り値を環境変数のマップに変換します。
+func envValue(v starlark.Value) (map[string]string, error) {
+	if v == starlark.None {
+		return nil, nil
+	}
+	dict, ok := v.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf("env returned %s, want dict", v.Type())
+	}
+	env := make(map[string]string, dict.Len())
+	for _, item := range dict.Items() {
+		name, ok := starlark.AsString(item[0])
+		if !ok || name == "" {
+			return nil, fmt.Errorf("env returned an invalid name %s", item[0])
+		}
+		value, ok := starlark.AsString(item[1])
+		if !ok {
+			return nil, fmt.Errorf("env returned %s for %s, want string", item[1].Type(), name)
+		}
+		env[name] = value
+	}
+	return env, nil
+}
+
+// argsValue は args の戻り値を引数のスライスに変換します。
+func argsValue(v starlark.Value) ([]string, error) {
+	if v == starlark.None {
+		return nil, nil
+	}
+	var iterable starlark.Indexable
+	switch v := v.(type) {
+	case *starlark.List:
+		iterable = v
+	case starlark.Tuple:
+		iterable = v
+	default:
+		return nil, fmt.Errorf("args returned %s, want list", v.Type())
+	}
+	args := make([]string, 0, iterable.Len())
+	for i := range iterable.Len() {
+		arg, ok := starlark.AsString(iterable.Index(i))
+		if !ok {
+			return nil, fmt.Errorf("args returned %s at %d, want string", iterable.Index(i).Type(), i)
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
@@ -0,0 +1,182 @@
+package script
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScript は src をスクリプトファイルに書き込み、パスを返します。
+func writeScript(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hook.star")
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// bearer はペイロードが payload の署名なし JWT を Authorization ヘッダーの値として返します。
+func bearer(payload string) string {
+	enc := base64.RawURLEncoding
+	return "Bearer " + enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString([]byte(payload)) + ".sig"
+}
+
+const exampleScript = `
+def allow(req):
+    if req.path == "/admin":
+        return "admin is not allowed"
+    return req.claims.get("role") in ("staff", "user")
+
+def env(req):
+    return {"TENANT": req.headers.get("X-Tenant", "default"), "ROLE": req.claims["role"]}
+
+def args(req):
+    if "staff" in req.claims.get("groups", []):
+        return ["--debug"]
+    return []
+`
+
+func TestScript_Eval(t *testing.T) {
+	s, err := Load(writeScript(t, exampleScript), Limits{})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		req  Request
+		want Result
+	}{
+		{
+			name: "スタッフのトークン_環境変数と引数を計算",
+			req: Request{
+				Path:   "/mcp",
+				Header: http.Header{"X-Tenant": {"acme"}},
+				Claims: map[string]any{"role": "staff", "groups": []any{"staff"}},
+			},
+			want: Result{Allow: true, Env: map[string]string{"TENANT": "acme", "ROLE": "staff"}, Args: []string{"--debug"}},
+		},
+		{
+			name: "ヘッダーなし_デフォルトの値",
+			req:  Request{Path: "/mcp", Header: http.Header{}, Claims: map[string]any{"role": "user"}},
+			want: Result{Allow: true, Env: map[string]string{"TENANT": "default", "ROLE": "user"}, Args: []string{}},
+		},
+		{
+			name: "ロールなし_拒否",
+			req:  Request{Path: "/mcp", Header: http.Header{}},
+			want: Result{Allow: false},
+		},
+		{
+			name: "検証していないトークンのクレーム_拒否",
+			req:  Request{Path: "/mcp", Header: http.Header{"Authorization": {bearer(`{"role":"staff"}`)}}},
+			want: Result{Allow: false},
+		},
+		{
+			name: "文字列を返す_メッセージ付きで拒否",
+			req:  Request{Path: "/admin", Header: http.Header{}, Claims: map[string]any{"role": "staff"}},
+			want: Result{Allow: false, Message: "admin is not allowed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Eval(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Eval() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScript_Limits(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		limits  Limits
+		wantErr string
+	}{
+		{
+			name:    "無限ループ_ステップ数の上限で中断",
+			src:     "def allow(req):\n    for i in range(1000000000):\n        pass\n",
+			limits:  Limits{MaxSteps: 10000, Timeout: time.Minute},
+			wantErr: "too many steps",
+		},
+		{
+			name:    "長時間の実行_実行時間の上限で中断",
+			src:     "def allow(req):\n    for i in range(1000000000):\n        pass\n",
+			limits:  Limits{MaxSteps: 1 << 62, Timeout: 20 * time.Millisecond},
+			wantErr: "deadline exceeded",
+		},
+		{
+			name:    "大量の確保_メモリの上限で中断",
+			src:     "def allow(req):\n    xs = []\n    for i in range(100000000):\n        xs.append(\"x\" * 1024)\n",
+			limits:  Limits{MaxSteps: 1 << 62, Timeout: time.Minute, MaxMemory: 16 << 20},
+			wantErr: "memory limit exceeded",
+		},
+		{
+			name:    "戻り値の型が不正_エラー",
+			src:     "def env(req):\n    return [\"A=1\"]\n",
+			wantErr: "want dict",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Load(writeScript(t, tt.src), tt.limits)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			_, err = s.Eval(context.Background(), Request{Header: http.Header{}})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Eval() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScript_Limits_メモリの上限なし_ヒープを確認しない(t *testing.T) {
+	// デフォルトではプロセス全体のヒープを確認しないため、確保の多いスクリプトも最後まで実行する
+	s, err := Load(writeScript(t, "def allow(req):\n    xs = []\n    for i in range(40000):\n        xs.append(\"x\" * 1024)\n    return \"done\"\n"), Limits{Timeout: time.Minute})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	result, err := s.Eval(context.Background(), Request{Header: http.Header{}})
+	if err != nil || result.Message != "done" {
+		t.Errorf("Eval() = %+v, %v, want the script to finish", result, err)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{name: "フックなし_エラー", src: "x = 1\n"},
+		{name: "フックが関数でない_エラー", src: "allow = True\n"},
+		{name: "構文エラー_エラー", src: "def allow(req:\n"},
+		{name: "loadの使用_エラー", src: "load(\"other.star\", \"x\")\ndef allow(req):\n    return True\n"},
+		{name: "トップレベルの無限ループ_エラー", src: "def f():\n    for i in range(1000000000):\n        pass\nf()\ndef allow(req):\n    return True\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(writeScript(t, tt.src), Limits{}); err == nil {
+				t.Error("Load() expected error but got none")
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.star"), Limits{}); err == nil {
+		t.Error("Load() expected error for a missing file")
+	}
+}
@@ -0,0 +1,159 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// awsRequestTimeout は ctx に期限がない場合の1リクエストあたりのタイムアウトです。
+const awsRequestTimeout = 10 * time.Second
+
+// errNotRenewable は AWS・Google Cloud のシークレットにリースがないため、更新できないことを表すエラーです。
+var errNotRenewable = errors.New("secret has no lease to renew")
+
+// errNoAWSRegion はリージョンを設定していないことを表すエラーです。
+var errNoAWSRegion = errors.New("AWS_REGION is not set")
+
+// loadAWSConfig は AWS の SDK の既定の方法でリージョンと認証情報を読み込みます。
+// 認証情報は SDK の既定の順（環境変数・共有の設定ファイル・ECS/Fargate のタスクロール・EKS のロール・EC2 のインスタンスロール）で探し、
+// エンドポイントは AWS_ENDPOINT_URL_<サービス> または AWS_ENDPOINT_URL で変更できます。
+func loadAWSConfig() (aws.Config, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("load AWS config: %w", err)
+	}
+	return cfg, nil
+}
+
+// awsContext は ctx に期限がない場合に awsRequestTimeout の期限を付けます。
+func awsContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, awsRequestTimeout)
+}
+
+// AWSSecretsManager は AWS Secrets Manager のシークレットを読み取ります。
+// リージョンと認証情報は AWS の SDK の既定の方法（AWS_REGION、タスクロールやサービスアカウントのロールなど）で読み込みます。
+type AWSSecretsManager struct {
+	client *secretsmanager.Client
+}
+
+// NewAWSSecretsManagerFromEnv は AWS の SDK の既定の設定で AWSSecretsManager を作成します。
+func NewAWSSecretsManagerFromEnv() (*AWSSecretsManager, error) {
+	cfg, err := loadAWSConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &AWSSecretsManager{client: secretsmanager.NewFromConfig(cfg)}, nil
+}
+
+// Issue は名前または ARN が path のシークレットの現在の値を読み取ります。ARN の場合は ARN のリージョンから読み取ります。
+// 値全体をキー "" に設定し、値が JSON のオブジェクトの場合は各フィールドもキーに設定します（文字列以外は JSON の文字列）。
+func (s *AWSSecretsManager) Issue(ctx context.Context, path string) (*Lease, error) {
+	region := s.client.Options().Region
+	if parts := strings.Split(path, ":"); len(parts) >= 7 && parts[0] == "arn" {
+		region = parts[3]
+	}
+	if region == "" {
+		return nil, errNoAWSRegion
+	}
+	ctx, cancel := awsContext(ctx)
+	defer cancel()
+	out, err := s.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(path)}, func(o *secretsmanager.Options) {
+		o.Region = region
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out.SecretString == nil {
+		return &Lease{Data: map[string]string{wholeValueKey: base64.StdEncoding.EncodeToString(out.SecretBinary)}}, nil
+	}
+	data, err := valueWithFields(*out.SecretString)
+	if err != nil {
+		return nil, err
+	}
+	return &Lease{Data: data}, nil
+}
+
+// valueWithFields は値全体をキー "" に設定し、値が JSON のオブジェクトの場合は各フィールドもキーに設定します（文字列以外は JSON の文字列）。
+func valueWithFields(value string) (map[string]string, error) {
+	data := map[string]string{wholeValueKey: value}
+	var fields map[string]any
+	if json.Unmarshal([]byte(value), &fields) == nil {
+		for key, field := range fields {
+			if str, ok := field.(string); ok {
+				data[key] = str
+				continue
+			}
+			encoded, err := json.Marshal(field)
+			if err != nil {
+				return nil, err
+			}
+			data[key] = string(encoded)
+		}
+	}
+	return data, nil
+}
+
+// Renew は AWS のシークレットにリースがないため常にエラーを返します。
+func (s *AWSSecretsManager) Renew(context.Context, *Lease) (time.Duration, error) {
+	return 0, errNotRenewable
+}
+
+// Revoke は AWS のシークレットにリースがないため何もしません。
+func (s *AWSSecretsManager) Revoke(context.Context, *Lease) error {
+	return nil
+}
+
+// AWSParameterStore は AWS Systems Manager パラメータストアのパラメータを読み取ります。
+// SecureString は復号した値を返します。リージョンと認証情報は AWSSecretsManager と同じです。
+type AWSParameterStore struct {
+	client *ssm.Client
+}
+
+// NewAWSParameterStoreFromEnv は AWS の SDK の既定の設定で AWSParameterStore を作成します。
+func NewAWSParameterStoreFromEnv() (*AWSParameterStore, error) {
+	cfg, err := loadAWSConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &AWSParameterStore{client: ssm.NewFromConfig(cfg)}, nil
+}
+
+// Issue は名前が path のパラメータの値をキー "" に設定して返します。
+func (p *AWSParameterStore) Issue(ctx context.Context, path string) (*Lease, error) {
+	if p.client.Options().Region == "" {
+		return nil, errNoAWSRegion
+	}
+	ctx, cancel := awsContext(ctx)
+	defer cancel()
+	out, err := p.client.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(path), WithDecryption: aws.Bool(true)})
+	if err != nil {
+		return nil, err
+	}
+	if out.Parameter == nil {
+		return nil, fmt.Errorf("ssm parameter %s has no value", path)
+	}
+	return &Lease{Data: map[string]string{wholeValueKey: aws.ToString(out.Parameter.Value)}}, nil
+}
+
+// Renew は AWS のパラメータにリースがないため常にエラーを返します。
+func (p *AWSParameterStore) Renew(context.Context, *Lease) (time.Duration, error) {
+	return 0, errNotRenewable
+}
+
+// Revoke は AWS のパラメータにリースがないため何もしません。
+func (p *AWSParameterStore) Revoke(context.Context, *Lease) error {
+	return nil
+}
@@ -0,0 +1,147 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeAWS は Secrets Manager とパラメータストアの API のリクエストを記録して応答します。
+type fakeAWS struct {
+	targets []string
+	scopes  []string
+}
+
+func (f *fakeAWS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	scope := strings.SplitN(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/"), ",", 2)[0]
+	target := r.Header.Get("X-Amz-Target")
+	f.targets = append(f.targets, target)
+	f.scopes = append(f.scopes, scope)
+	var in map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&in)
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	switch {
+	case target == "secretsmanager.GetSecretValue" && strings.HasSuffix(in["SecretId"].(string), "prod/slack"):
+		_, _ = w.Write([]byte(`{"Name":"prod/slack","SecretString":"{\"token\":\"xoxb-1\",\"port\":5432}"}`))
+	case target == "secretsmanager.GetSecretValue" && in["SecretId"] == "plain":
+		_, _ = w.Write([]byte(`{"Name":"plain","SecretString":"s3cr3t"}`))
+	case target == "AmazonSSM.GetParameter" && in["Name"] == "/mcp/token" && in["WithDecryption"] == true:
+		_, _ = w.Write([]byte(`{"Parameter":{"Name":"/mcp/token","Type":"SecureString","Value":"ssm-value"}}`))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"__type":"com.amazonaws.secretsmanager#ResourceNotFoundException","Message":"not found"}`))
+	}
+}
+
+// setAWSEnv はテスト用の認証情報・リージョンと、f に接続するエンドポイントを設定します。
+func setAWSEnv(t *testing.T, f *fakeAWS) {
+	t.Helper()
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	t.Setenv("AWS_ENDPOINT_URL", server.URL)
+}
+
+func TestAWSSecretsManager(t *testing.T) {
+	f := &fakeAWS{}
+	setAWSEnv(t, f)
+	sm, err := NewAWSSecretsManagerFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	lease, err := sm.Issue(ctx, "prod/slack")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if lease.Data["token"] != "xoxb-1" || lease.Data["port"] != "5432" || lease.Data[wholeValueKey] != `{"token":"xoxb-1","port":5432}` {
+		t.Errorf("Issue().Data = %v", lease.Data)
+	}
+	if lease.Duration != 0 || lease.ID != "" {
+		t.Errorf("Issue() = %+v, want no lease", lease)
+	}
+
+	lease, err = sm.Issue(ctx, "plain")
+	if err != nil {
+		t.Fatalf("Issue(plain) error = %v", err)
+	}
+	if len(lease.Data) != 1 || lease.Data[wholeValueKey] != "s3cr3t" {
+		t.Errorf("Issue(plain).Data = %v", lease.Data)
+	}
+
+	// ARN のシークレットは ARN のリージョンで署名する
+	if _, err := sm.Issue(ctx, "arn:aws:secretsmanager:us-west-2:123456789012:secret:prod/slack"); err != nil {
+		t.Fatalf("Issue(ARN) error = %v", err)
+	}
+	if want := "/us-west-2/secretsmanager/aws4_request"; !strings.HasSuffix(f.scopes[2], want) {
+		t.Errorf("scope = %q, want suffix %q", f.scopes[2], want)
+	}
+
+	_, err = sm.Issue(ctx, "missing")
+	if err == nil || !strings.Contains(err.Error(), "ResourceNotFoundException") || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Issue(missing) error = %v, want ResourceNotFoundException", err)
+	}
+}
+
+func TestAWSParameterStore(t *testing.T) {
+	f := &fakeAWS{}
+	setAWSEnv(t, f)
+	ssm, err := NewAWSParameterStoreFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lease, err := ssm.Issue(context.Background(), "/mcp/token")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if lease.Data[wholeValueKey] != "ssm-value" {
+		t.Errorf("Issue().Data = %v", lease.Data)
+	}
+	if f.targets[0] != "AmazonSSM.GetParameter" || !strings.HasSuffix(f.scopes[0], "/ap-northeast-1/ssm/aws4_request") {
+		t.Errorf("request = %v %v", f.targets, f.scopes)
+	}
+}
+
+func TestAWS_リージョンなし_エラー(t *testing.T) {
+	f := &fakeAWS{}
+	setAWSEnv(t, f)
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	ssm, err := NewAWSParameterStoreFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ssm.Issue(context.Background(), "/mcp/token"); err == nil || !strings.Contains(err.Error(), "AWS_REGION") {
+		t.Errorf("Issue() error = %v, want AWS_REGION error", err)
+	}
+}
+
+func TestNewResolver_AWSの参照(t *testing.T) {
+	setAWSEnv(t, &fakeAWS{})
+	r := NewResolver(0, nil)
+	defer r.Close()
+	env := map[string]string{
+		"SLACK_TOKEN": "aws-sm:prod/slack#token",
+		"PLAIN":       "aws-sm:plain",
+		"API_TOKEN":   "aws-ssm:/mcp/token",
+	}
+	if err := r.Resolve(context.Background(), env); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	got := r.Expand(env)
+	if got["SLACK_TOKEN"] != "xoxb-1" || got["PLAIN"] != "s3cr3t" || got["API_TOKEN"] != "ssm-value" {
+		t.Errorf("Expand() = %v", got)
+	}
+}
@@ -0,0 +1,121 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/gcpauth"
+)
+
+const (
+	// gcpSecretManagerEndpoint は Secret Manager の API のエンドポイントです。
+	gcpSecretManagerEndpoint = "https://secretmanager.googleapis.com"
+
+	// gcpRequestTimeout は ctx に期限がない場合の1リクエストあたりのタイムアウトです。
+	gcpRequestTimeout = 10 * time.Second
+)
+
+// GCPSecretManager は Google Cloud Secret Manager のシークレットのバージョンを読み取ります。
+// 認証情報は GOOGLE_APPLICATION_CREDENTIALS のキーファイルか、GKE の Workload Identity などのメタデータサーバーから取得します。
+// 必要な API は値の読み取りだけなので、クライアントライブラリを使わずに HTTP API を直接呼び出します。
+type GCPSecretManager struct {
+	tokens   *gcpauth.Source
+	client   *http.Client
+	endpoint string // テストでエンドポイントを差し替えるための URL
+}
+
+// NewGCPSecretManagerFromEnv は環境の認証情報で GCPSecretManager を作成します。
+func NewGCPSecretManagerFromEnv() (*GCPSecretManager, error) {
+	tokens, err := gcpauth.SourceFromEnv(gcpauth.CloudPlatformScope)
+	if err != nil {
+		return nil, err
+	}
+	return &GCPSecretManager{tokens: tokens, client: &http.Client{}, endpoint: gcpSecretManagerEndpoint}, nil
+}
+
+// Issue は path（projects/PROJECT/secrets/SECRET/versions/VERSION）のシークレットのバージョンの値を読み取ります。
+// バージョンを省略した場合は最新のバージョン（latest）を読み取ります。
+// 値全体をキー "" に設定し、値が JSON のオブジェクトの場合は各フィールドもキーに設定します（文字列以外は JSON の文字列）。
+func (g *GCPSecretManager) Issue(ctx context.Context, path string) (*Lease, error) {
+	parts := strings.Split(path, "/")
+	switch {
+	case len(parts) == 4 && parts[0] == "projects" && parts[2] == "secrets":
+		path += "/versions/latest"
+	case len(parts) == 6 && parts[0] == "projects" && parts[2] == "secrets" && parts[4] == "versions":
+	default:
+		return nil, fmt.Errorf("invalid Secret Manager name %q: use projects/PROJECT/secrets/SECRET[/versions/VERSION]", path)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, gcpRequestTimeout)
+		defer cancel()
+	}
+	token, err := g.tokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.endpoint+"/v1/"+path+":access", nil)
+	if err != nil {
+		return nil, fmt.Errorf("create secretmanager request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("secretmanager access %s: %w", path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		var errBody struct {
+			Error struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&errBody)
+		return nil, fmt.Errorf("secretmanager access %s: %s: %s %s", path, resp.Status, errBody.Error.Status, errBody.Error.Message)
+	}
+	var out struct {
+		Payload struct {
+			Data       string `json:"data"`       // base64
+			DataCrc32c string `json:"dataCrc32c"` // int64 の文字列（省略される場合がある）
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode secretmanager response: %w", err)
+	}
+	value, err := base64.StdEncoding.DecodeString(out.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("decode secret payload: %w", err)
+	}
+	if out.Payload.DataCrc32c != "" {
+		want, err := strconv.ParseUint(out.Payload.DataCrc32c, 10, 32)
+		if err != nil || crc32.Checksum(value, crc32.MakeTable(crc32.Castagnoli)) != uint32(want) {
+			return nil, errors.New("secret payload checksum mismatch")
+		}
+	}
+	data, err := valueWithFields(string(value))
+	if err != nil {
+		return nil, err
+	}
+	return &Lease{Data: data}, nil
+}
+
+// Renew は Secret Manager のシークレットにリースがないため常にエラーを返します。
+func (g *GCPSecretManager) Renew(context.Context, *Lease) (time.Duration, error) {
+	return 0, errNotRenewable
+}
+
+// Revoke は Secret Manager のシークレットにリースがないため何もしません。
+func (g *GCPSecretManager) Revoke(context.Context, *Lease) error {
+	return nil
+}
@@ -0,0 +1,94 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/gcpauth"
+)
+
+// newFakeGCPSecretManager は values（リソース名 → 値）を返す Secret Manager の API に接続する GCPSecretManager を作成します。
+// checksum が空でない場合は値のチェックサムの代わりに返します。
+func newFakeGCPSecretManager(t *testing.T, values map[string]string, checksum string) *GCPSecretManager {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ya29.test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), ":access")
+		value, found := values[name]
+		if !ok || !found {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"code":404,"message":"Secret [` + name + `] not found or has no versions.","status":"NOT_FOUND"}}`))
+			return
+		}
+		sum := checksum
+		if sum == "" {
+			sum = strconv.FormatUint(uint64(crc32.Checksum([]byte(value), crc32.MakeTable(crc32.Castagnoli))), 10)
+		}
+		_, _ = w.Write([]byte(`{"name":"` + name + `","payload":{"data":"` + base64.StdEncoding.EncodeToString([]byte(value)) + `","dataCrc32c":"` + sum + `"}}`))
+	}))
+	t.Cleanup(server.Close)
+	return &GCPSecretManager{tokens: gcpauth.StaticSource("ya29.test"), client: server.Client(), endpoint: server.URL}
+}
+
+func TestGCPSecretManager(t *testing.T) {
+	sm := newFakeGCPSecretManager(t, map[string]string{
+		"projects/p/secrets/slack/versions/latest": `{"token":"xoxb-1","port":5432}`,
+		"projects/p/secrets/plain/versions/3":      "s3cr3t",
+	}, "")
+	ctx := context.Background()
+
+	// バージョンを省略した場合は最新のバージョンを読み取る
+	lease, err := sm.Issue(ctx, "projects/p/secrets/slack")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if lease.Data["token"] != "xoxb-1" || lease.Data["port"] != "5432" || lease.Data[wholeValueKey] != `{"token":"xoxb-1","port":5432}` {
+		t.Errorf("Issue().Data = %v", lease.Data)
+	}
+	if lease.Duration != 0 || lease.ID != "" {
+		t.Errorf("Issue() = %+v, want no lease", lease)
+	}
+
+	lease, err = sm.Issue(ctx, "projects/p/secrets/plain/versions/3")
+	if err != nil {
+		t.Fatalf("Issue(plain) error = %v", err)
+	}
+	if len(lease.Data) != 1 || lease.Data[wholeValueKey] != "s3cr3t" {
+		t.Errorf("Issue(plain).Data = %v", lease.Data)
+	}
+	if _, err := sm.Renew(ctx, lease); err == nil {
+		t.Error("Renew() error = nil, want an error for a secret without a lease")
+	}
+}
+
+func TestGCPSecretManager_Error(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		checksum string
+		wantErr  string
+	}{
+		{name: "存在しないシークレット_エラー", path: "projects/p/secrets/missing", wantErr: "NOT_FOUND"},
+		{name: "不正な名前_エラー", path: "slack", wantErr: "invalid Secret Manager name"},
+		{name: "バージョンの位置が不正_エラー", path: "projects/p/secrets/slack/latest/x", wantErr: "invalid Secret Manager name"},
+		{name: "チェックサムの不一致_エラー", path: "projects/p/secrets/slack", checksum: "1", wantErr: "checksum"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := newFakeGCPSecretManager(t, map[string]string{"projects/p/secrets/slack/versions/latest": "value"}, tt.checksum)
+			_, err := sm.Issue(context.Background(), tt.path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Issue() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+)
+
+// referenceProvider は設定の値から参照できるプロバイダーです。
+type referenceProvider struct {
+	new       func() (Provider, error) // 環境変数の設定でプロバイダーを作成する
+	trimPath  bool                     // パスの前後の "/" を除く
+	keyNeeded bool                     // #KEY が必須（false の場合、省略すると値全体を参照する）
+}
+
+// referenceProviders は設定の値から参照できるプロバイダーです。値の接頭辞（"vault:"）がプロバイダー名です。
+var referenceProviders = map[string]referenceProvider{
+	ProviderVault:             {new: func() (Provider, error) { return NewVaultFromEnv() }, trimPath: true, keyNeeded: true},
+	ProviderAWSSecretsManager: {new: func() (Provider, error) { return NewAWSSecretsManagerFromEnv() }},
+	ProviderAWSParameterStore: {new: func() (Provider, error) { return NewAWSParameterStoreFromEnv() }},
+	ProviderGCPSecretManager:  {new: func() (Provider, error) { return NewGCPSecretManagerFromEnv() }, trimPath: true},
+}
+
+// wholeValueKey はシークレットの値全体を設定するキーです。#KEY を省略した参照はこのキーの値を参照します。
+const wholeValueKey = ""
+
+// Reference は設定の値が参照するシークレットの1つの値です。
+//
+//	vault:secret/data/slack#token → {Provider: "vault", Path: "secret/data/slack", Key: "token"}
+//	aws-sm:prod/slack#token       → {Provider: "aws-sm", Path: "prod/slack", Key: "token"}
+//	aws-ssm:/mcp/slack/token      → {Provider: "aws-ssm", Path: "/mcp/slack/token", Key: ""}（値全体）
+//	gcp-sm:projects/p/secrets/slack/versions/latest#token
+//	                              → {Provider: "gcp-sm", Path: "projects/p/secrets/slack/versions/latest", Key: "token"}
+type Reference struct {
+	Provider string
+	Path     string
+	Key      string
+}
+
+// ParseReference は値がシークレットの参照の場合に Reference を返します。
+// 接頭辞が参照できるプロバイダーでない値は参照ではないため、ok が false になります（"https://..." など）。
+// 接頭辞がプロバイダーで、パスがない場合と、Vault でキーがない場合はエラーを返します。
+func ParseReference(value string) (ref Reference, ok bool, err error) {
+	name, rest, found := strings.Cut(value, ":")
+	provider, known := referenceProviders[name]
+	if !found || !known {
+		return Reference{}, false, nil
+	}
+	path, key, hasKey := strings.Cut(rest, "#")
+	if provider.trimPath {
+		path = strings.Trim(path, "/")
+	}
+	if path == "" || (hasKey || provider.keyNeeded) && key == "" {
+		if provider.keyNeeded {
+			return Reference{}, true, fmt.Errorf("invalid secret reference %q: use %s:PATH#KEY", value, name)
+		}
+		return Reference{}, true, fmt.Errorf("invalid secret reference %q: use %s:NAME or %s:NAME#KEY", value, name, name)
+	}
+	return Reference{Provider: name, Path: path, Key: key}, true, nil
+}
+
+// Resolver は設定の値のシークレットの参照を解決します。複数の goroutine から同時に使用できます。
+//
+// 読み取ったシークレットはリースの有効期間の 2/3 が過ぎるとバックグラウンドで読み直し、以降に起動するプロセスには新しい値を渡します。
+// プロセスの起動時は保持している値を使うため、プロバイダーへの問い合わせで起動を待たせません。
+// 有効期間のないシークレット（KV・AWS など）は、cacheTTL が 0 の場合は次に Resolve で読み直すまで読み取った値を使い続け、
+// 0 より大きい場合は cacheTTL ごとにバックグラウンドで読み直します。
+type Resolver struct {
+	newProvider func(name string) (Provider, error)
+	cacheTTL    time.Duration
+	logger      *slog.Logger
+
+	mu        sync.Mutex
+	providers map[string]Provider
+	secrets   map[secretPath]map[string]string // 読み取ったシークレットの値
+	leased    map[secretPath]bool              // バックグラウンドで読み直しているシークレット
+
+	ctx    context.Context // 読み直しを止めるためのコンテキスト
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// secretPath はプロバイダーとパスの組です。
+type secretPath struct {
+	provider string
+	path     string
+}
+
+// NewResolver は参照するプロバイダーを、最初に参照された時に環境変数の設定で作成する Resolver を作成します。
+// cacheTTL は有効期間のないシークレットを読み直す間隔です（0 で設定の再読み込みまで読み直さない）。
+func NewResolver(cacheTTL time.Duration, logger *slog.Logger) *Resolver {
+	return newResolver(func(name string) (Provider, error) { return referenceProviders[name].new() }, cacheTTL, logger)
+}
+
+func newResolver(newProvider func(name string) (Provider, error), cacheTTL time.Duration, logger *slog.Logger) *Resolver {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Resolver{
+		newProvider: newProvider,
+		cacheTTL:    cacheTTL,
+		logger:      logger,
+		providers:   make(map[string]Provider),
+		secrets:     make(map[secretPath]map[string]string),
+		leased:      make(map[secretPath]bool),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Resolve は env の値のシークレットの参照を全て読み取ります。設定の再読み込みで呼び出すと、有効期間のないシークレットを読み直します。
+// 有効期間のあるシークレットはバックグラウンドで読み直しているため、読み取り済みの値を使います。
+// 参照の形式が正しくない場合、読み取れない場合、シークレットにキーがない場合はエラーを返します。
+func (r *Resolver) Resolve(ctx context.Context, env map[string]string) error {
+	read := make(map[secretPath]bool)
+	for name, value := range env {
+		ref, ok, err := ParseReference(value)
+		if err != nil {
+			return fmt.Errorf("environment variable %s: %w", name, err)
+		}
+		if !ok {
+			continue
+		}
+		sp := secretPath{provider: ref.Provider, path: ref.Path}
+		data, err := r.read(ctx, sp, !read[sp])
+		read[sp] = true
+		if err != nil {
+			return fmt.Errorf("environment variable %s: %w", name, err)
+		}
+		if _, ok := data[ref.Key]; !ok {
+			return fmt.Errorf("environment variable %s: secret %s:%s has no %q", name, ref.Provider, ref.Path, ref.Key)
+		}
+	}
+	return nil
+}
+
+// Expand は env のシークレットの参照を、読み取った値に置き換えた新しい map を返します。
+// Resolve で読み取っていない参照はそのまま残します。nil の Resolver は env の複製を返します。
+func (r *Resolver) Expand(env map[string]string) map[string]string {
+	expanded := maps.Clone(env)
+	if expanded == nil {
+		expanded = make(map[string]string)
+	}
+	if r == nil {
+		return expanded
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, value := range env {
+		ref, ok, err := ParseReference(value)
+		if !ok || err != nil {
+			continue
+		}
+		if secret, ok := r.secrets[secretPath{provider: ref.Provider, path: ref.Path}]; ok {
+			if v, ok := secret[ref.Key]; ok {
+				expanded[name] = v
+			}
+		}
+	}
+	return expanded
+}
+
+// Close はシークレットの読み直しを止めます。nil の Resolver では何もしません。
+func (r *Resolver) Close() {
+	if r == nil {
+		return
+	}
+	r.cancel()
+	r.wg.Wait()
+}
+
+// read はシークレットを読み取り、有効期間がある場合は読み直しを開始します。
+// 読み取り済みで、バックグラウンドで読み直しているか fresh でない場合は保持している値を返します。
+func (r *Resolver) read(ctx context.Context, sp secretPath, fresh bool) (map[string]string, error) {
+	r.mu.Lock()
+	if data, ok := r.secrets[sp]; ok && (r.leased[sp] || !fresh) {
+		r.mu.Unlock()
+		return data, nil
+	}
+	provider, ok := r.providers[sp.provider]
+	if !ok {
+		var err error
+		if provider, err = r.newProvider(sp.provider); err != nil {
+			r.mu.Unlock()
+			return nil, err
+		}
+		r.providers[sp.provider] = provider
+	}
+	r.mu.Unlock()
+
+	lease, err := provider.Issue(ctx, sp.path)
+	if err != nil {
+		return nil, fmt.Errorf("read secret %s:%s: %w", sp.provider, sp.path, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.leased[sp] {
+		// 同時に読み取った別の呼び出しが先に読み直しを開始した
+		return r.secrets[sp], nil
+	}
+	r.secrets[sp] = lease.Data
+	if wait := r.refreshAfter(lease); wait > 0 {
+		r.leased[sp] = true
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.refresh(sp, provider, wait)
+		}()
+	}
+	return lease.Data, nil
+}
+
+// refreshAfter はシークレットをバックグラウンドで読み直すまでの時間を返します。読み直さない場合は 0 を返します。
+func (r *Resolver) refreshAfter(lease *Lease) time.Duration {
+	if lease.Duration > 0 {
+		return lease.Duration * 2 / 3
+	}
+	return r.cacheTTL
+}
+
+// refresh は wait が過ぎるごとにシークレットを読み直します（リースの有効期間の 2/3 または cacheTTL）。
+// 読み直しに失敗した場合は元の値を使い続け、renewRetryInterval ごとに再試行します。
+// 動的シークレットの古いリースは、その値で起動したプロセスが使い続けるため失効させず、有効期間の経過に任せます。
+func (r *Resolver) refresh(sp secretPath, provider Provider, wait time.Duration) {
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		lease, err := provider.Issue(r.ctx, sp.path)
+		if r.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			r.logger.Warn("Secret refresh failed", "provider", sp.provider, "path", sp.path, "error", err)
+			wait = renewRetryInterval
+			continue
+		}
+		wait = r.refreshAfter(lease)
+		r.mu.Lock()
+		r.secrets[sp] = lease.Data
+		if wait <= 0 {
+			// 有効期間がなくなったシークレットは、次の Resolve で読み直す
+			delete(r.leased, sp)
+		}
+		r.mu.Unlock()
+		r.logger.Info("Refreshed secret", "provider", sp.provider, "path", sp.path, "lease_duration", lease.Duration)
+		if wait <= 0 {
+			return
+		}
+	}
+}
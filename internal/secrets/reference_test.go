@@ -0,0 +1,156 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    Reference
+		wantOK  bool
+		wantErr bool
+	}{
+		{name: "vault", value: "vault:secret/data/slack#token", want: Reference{Provider: "vault", Path: "secret/data/slack", Key: "token"}, wantOK: true},
+		{name: "前後のスラッシュ_除去", value: "vault:/secret/data/slack/#token", want: Reference{Provider: "vault", Path: "secret/data/slack", Key: "token"}, wantOK: true},
+		{name: "通常の値", value: "plain"},
+		{name: "URL", value: "https://example.com/#token"},
+		{name: "キーなし_エラー", value: "vault:secret/data/slack", wantOK: true, wantErr: true},
+		{name: "パスなし_エラー", value: "vault:#token", wantOK: true, wantErr: true},
+		{name: "Secrets Manager_キー", value: "aws-sm:prod/slack#token", want: Reference{Provider: "aws-sm", Path: "prod/slack", Key: "token"}, wantOK: true},
+		{name: "Secrets Manager_値全体", value: "aws-sm:arn:aws:secretsmanager:us-east-1:123456789012:secret:slack-AbCdEf", want: Reference{Provider: "aws-sm", Path: "arn:aws:secretsmanager:us-east-1:123456789012:secret:slack-AbCdEf"}, wantOK: true},
+		{name: "パラメータストア_先頭のスラッシュを残す", value: "aws-ssm:/mcp/slack/token", want: Reference{Provider: "aws-ssm", Path: "/mcp/slack/token"}, wantOK: true},
+		{name: "Secrets Manager_空のキー_エラー", value: "aws-sm:prod/slack#", wantOK: true, wantErr: true},
+		{name: "パラメータストア_パスなし_エラー", value: "aws-ssm:", wantOK: true, wantErr: true},
+		{name: "Secret Manager_キー", value: "gcp-sm:projects/p/secrets/slack/versions/latest#token", want: Reference{Provider: "gcp-sm", Path: "projects/p/secrets/slack/versions/latest", Key: "token"}, wantOK: true},
+		{name: "Secret Manager_前後のスラッシュを除く", value: "gcp-sm:/projects/p/secrets/slack/", want: Reference{Provider: "gcp-sm", Path: "projects/p/secrets/slack"}, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := ParseReference(tt.value)
+			if (err != nil) != tt.wantErr || ok != tt.wantOK {
+				t.Fatalf("ParseReference(%q) = %v, %v, want ok %v, error %v", tt.value, ok, err, tt.wantOK, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseReference(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolver_ResolveExpand(t *testing.T) {
+	provider := &fakeProvider{}
+	r := newResolver(func(string) (Provider, error) { return provider, nil }, 0, nil)
+	defer r.Close()
+
+	env := map[string]string{
+		"DB_USER":     "vault:database/creds/app#username",
+		"DB_PASSWORD": "vault:database/creds/app#password",
+		"REGION":      "ap-northeast-1",
+	}
+	if err := r.Resolve(context.Background(), env); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	got := r.Expand(env)
+	if got["DB_USER"] != "user-1" || got["DB_PASSWORD"] != "secret" || got["REGION"] != "ap-northeast-1" {
+		t.Errorf("Expand() = %v", got)
+	}
+	if env["DB_USER"] != "vault:database/creds/app#username" {
+		t.Error("Expand() modified the original env")
+	}
+	// 同じパスのシークレットは1回だけ読み取る
+	if provider.issued != 1 {
+		t.Errorf("issued = %d, want 1", provider.issued)
+	}
+
+	// 再読み込みでは有効期間のないシークレットを読み直す
+	if err := r.Resolve(context.Background(), env); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if got := r.Expand(env); got["DB_USER"] != "user-2" {
+		t.Errorf("Expand() after reload = %v, want user-2", got)
+	}
+}
+
+func TestResolver_Resolve_エラー(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		providerErr error
+	}{
+		{name: "キーがない", value: "vault:database/creds/app#token"},
+		{name: "読み取りに失敗", value: "vault:database/creds/denied#username"},
+		{name: "形式が不正", value: "vault:database/creds/app"},
+		{name: "プロバイダーを作成できない", value: "vault:database/creds/app#username", providerErr: errors.New("VAULT_ADDR is not set")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &fakeProvider{failPath: "database/creds/denied"}
+			r := newResolver(func(string) (Provider, error) { return provider, tt.providerErr }, 0, nil)
+			defer r.Close()
+			if err := r.Resolve(context.Background(), map[string]string{"VALUE": tt.value}); err == nil {
+				t.Error("Resolve() expected error but got none")
+			}
+		})
+	}
+}
+
+func TestResolver_有効期間の前に読み直す(t *testing.T) {
+	provider := &fakeProvider{duration: 30 * time.Millisecond}
+	r := newResolver(func(string) (Provider, error) { return provider, nil }, 0, nil)
+	env := map[string]string{"DB_USER": "vault:database/creds/app#username"}
+	if err := r.Resolve(context.Background(), env); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for r.Expand(env)["DB_USER"] == "user-1" {
+		if time.Now().After(deadline) {
+			t.Fatal("secret was not refreshed before its lease expired")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	r.Close()
+	provider.mu.Lock()
+	issued := provider.issued
+	provider.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	if provider.issued != issued {
+		t.Error("secret was refreshed after Close")
+	}
+}
+
+func TestResolver_cacheTTLごとに読み直す(t *testing.T) {
+	provider := &fakeProvider{}
+	r := newResolver(func(string) (Provider, error) { return provider, nil }, 20*time.Millisecond, nil)
+	defer r.Close()
+	env := map[string]string{"DB_USER": "aws-sm:prod/db#username"}
+	if err := r.Resolve(context.Background(), env); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for r.Expand(env)["DB_USER"] == "user-1" {
+		if time.Now().After(deadline) {
+			t.Fatal("secret was not refreshed after the cache TTL")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+}
+
+func TestResolver_nil(t *testing.T) {
+	var r *Resolver
+	env := map[string]string{"DB_USER": "vault:database/creds/app#username"}
+	if got := r.Expand(env); got["DB_USER"] != env["DB_USER"] {
+		t.Errorf("Expand() = %v, want unchanged", got)
+	}
+	r.Close()
+}
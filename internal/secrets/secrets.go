@@ -0,0 +1,282 @@
+// Package secrets はプロセスの起動ごとに有効期間の短い認証情報を発行し、プロセスが動いている間は更新し、
+// 終了時に失効させる機能を提供します。
+//
+// Vault のデータベースシークレットエンジンが発行するユーザーや、AWS シークレットエンジンが発行する STS のキーのように、
+// リース付きの動的シークレットを対象にしています。発行した値は環境変数としてプロセスに渡します。
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// シークレットのプロバイダーです。
+const (
+	ProviderVault = "vault" // HashiCorp Vault（VAULT_ADDR・VAULT_TOKEN・VAULT_NAMESPACE を使用）
+
+	ProviderAWSSecretsManager = "aws-sm"  // AWS Secrets Manager（AWS の SDK の既定のリージョンと認証情報を使用、設定の値の参照のみ）
+	ProviderAWSParameterStore = "aws-ssm" // AWS Systems Manager パラメータストア（同上）
+
+	ProviderGCPSecretManager = "gcp-sm" // Google Cloud Secret Manager（GOOGLE_APPLICATION_CREDENTIALS かメタデータサーバーの認証情報を使用、設定の値の参照のみ）
+)
+
+// リースの更新と失効の設定です。
+const (
+	renewRetryInterval = 5 * time.Second  // 更新に失敗した場合に再試行するまでの間隔
+	revokeTimeout      = 10 * time.Second // プロセスの終了後にリースを失効させるまで待つ最大時間
+)
+
+// Lease は発行したシークレットとそのリースです。
+type Lease struct {
+	ID        string            // リースの ID（空の場合は更新・失効しない）
+	Data      map[string]string // 発行した値
+	Duration  time.Duration     // リースの残りの有効期間
+	Renewable bool              // 有効期間を延長できる
+}
+
+// Provider はシークレットを発行・更新・失効させます。
+type Provider interface {
+	// Issue は path のシークレットを発行します。
+	Issue(ctx context.Context, path string) (*Lease, error)
+	// Renew はリースを延長し、新しい有効期間を返します。
+	Renew(ctx context.Context, lease *Lease) (time.Duration, error)
+	// Revoke はリースを失効させ、発行した認証情報を使えなくします。
+	Revoke(ctx context.Context, lease *Lease) error
+}
+
+// Spec は1つの動的シークレットの設定です。
+type Spec struct {
+	// Provider はシークレットのプロバイダーです（空の場合は vault）。
+	Provider string `json:"provider,omitempty"`
+	// Path はシークレットのパスです（例: "database/creds/readonly"、"aws/sts/deploy"）。
+	Path string `json:"path"`
+	// Env は発行した値のキーから、値を渡す環境変数への対応です（例: {"username": "DB_USER"}）。
+	Env map[string]string `json:"env"`
+}
+
+// Load は JSON ファイルからシークレットの設定を読み込みます。
+func Load(path string) ([]Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read secrets: %w", err)
+	}
+	var specs []Spec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("parse secrets %s: %w", path, err)
+	}
+	return specs, nil
+}
+
+// Manager は設定した全てのシークレットをプロセスごとに発行します。複数の goroutine から同時に使用できます。
+type Manager struct {
+	specs     []Spec
+	providers map[string]Provider
+	logger    *slog.Logger
+}
+
+// NewManager は設定を検証し、使用するプロバイダーを環境変数の設定で作成します。
+func NewManager(specs []Spec, logger *slog.Logger) (*Manager, error) {
+	providers := make(map[string]Provider)
+	for i := range specs {
+		spec := &specs[i]
+		if spec.Provider == "" {
+			spec.Provider = ProviderVault
+		}
+		if spec.Path == "" {
+			return nil, fmt.Errorf("secret %d: path is required", i)
+		}
+		if len(spec.Env) == 0 {
+			return nil, fmt.Errorf("secret %s: env is required", spec.Path)
+		}
+		if _, ok := providers[spec.Provider]; ok {
+			continue
+		}
+		switch spec.Provider {
+		case ProviderVault:
+			vault, err := NewVaultFromEnv()
+			if err != nil {
+				return nil, err
+			}
+			providers[spec.Provider] = vault
+		default:
+			return nil, fmt.Errorf("secret %s: unknown provider %q (supported: %s)", spec.Path, spec.Provider, ProviderVault)
+		}
+	}
+	return newManager(specs, providers, logger), nil
+}
+
+func newManager(specs []Spec, providers map[string]Provider, logger *slog.Logger) *Manager {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Manager{specs: specs, providers: providers, logger: logger}
+}
+
+// EnvNames は発行した値を設定する全ての環境変数の名前を返します。
+func (m *Manager) EnvNames() []string {
+	var names []string
+	for _, spec := range m.specs {
+		for _, envName := range spec.Env {
+			names = append(names, envName)
+		}
+	}
+	return names
+}
+
+// Leases は1つのプロセスのために発行したシークレットです。
+type Leases struct {
+	env    map[string]string
+	leases []issued
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+	logger *slog.Logger
+
+	expiring     chan struct{}
+	expiringOnce sync.Once
+}
+
+// issued は発行したリースとそのプロバイダーです。
+type issued struct {
+	spec     Spec
+	provider Provider
+	lease    *Lease
+}
+
+// Acquire は全てのシークレットを発行し、更新を開始します。
+// いずれかの発行に失敗した場合は、発行済みのリースを失効させてエラーを返します。
+func (m *Manager) Acquire(ctx context.Context) (*Leases, error) {
+	l := &Leases{env: make(map[string]string), logger: m.logger, expiring: make(chan struct{})}
+	for _, spec := range m.specs {
+		provider := m.providers[spec.Provider]
+		lease, err := provider.Issue(ctx, spec.Path)
+		if err != nil {
+			_ = l.revoke()
+			return nil, fmt.Errorf("issue secret %s: %w", spec.Path, err)
+		}
+		l.leases = append(l.leases, issued{spec: spec, provider: provider, lease: lease})
+		for key, envName := range spec.Env {
+			value, ok := lease.Data[key]
+			if !ok {
+				_ = l.revoke()
+				return nil, fmt.Errorf("secret %s has no %q", spec.Path, key)
+			}
+			l.env[envName] = value
+		}
+	}
+
+	renewCtx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	for _, is := range l.leases {
+		if is.lease.Duration <= 0 {
+			continue
+		}
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			if is.lease.ID == "" || !is.lease.Renewable {
+				l.expireAt(renewCtx, time.Now().Add(is.lease.Duration*2/3))
+				return
+			}
+			l.renew(renewCtx, is)
+		}()
+	}
+	return l, nil
+}
+
+// Env は発行した値を設定する環境変数を返します。
+func (l *Leases) Env() map[string]string {
+	return l.env
+}
+
+// Expiring はいずれかのリースが更新できなくなり、有効期間の残りが元の 1/3 を切った時にクローズされるチャネルを返します。
+// 更新できないリース・最大の有効期間に達したリース・更新に失敗したリースが対象です。
+// クローズされたら新しいシークレットでプロセスを起動し直すことで、期限切れの認証情報を使い続けることを防げます。
+func (l *Leases) Expiring() <-chan struct{} {
+	return l.expiring
+}
+
+// expireAt は at になった時点で Expiring のチャネルをクローズします。ctx が終了した場合は何もしません。
+func (l *Leases) expireAt(ctx context.Context, at time.Time) {
+	if wait := time.Until(at); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+	l.expiringOnce.Do(func() { close(l.expiring) })
+}
+
+// renew はリースの有効期間の 2/3 が過ぎるごとにリースを延長します。
+// 延長に失敗した場合は有効期間が残っている間だけ再試行します。
+// 延長に失敗した場合と最大の有効期間に達した場合は Expiring のチャネルをクローズします。
+func (l *Leases) renew(ctx context.Context, is issued) {
+	duration := is.lease.Duration
+	expires := time.Now().Add(duration)
+	wait := duration * 2 / 3
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		next, err := is.provider.Renew(ctx, is.lease)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// 残りは元の有効期間の 1/3 程度のため、再試行しつつ新しいシークレットへの切り替えを促す
+			l.expireAt(ctx, time.Now())
+			if !time.Now().Add(renewRetryInterval).Before(expires) {
+				l.logger.Error("Secret lease expired", "path", is.spec.Path, "error", err)
+				return
+			}
+			l.logger.Warn("Secret lease renewal failed", "path", is.spec.Path, "error", err)
+			wait = renewRetryInterval
+			continue
+		}
+		expires = time.Now().Add(next)
+		if next < duration {
+			// 最大の有効期間に達したため、これ以上は元の有効期間まで延長できない
+			l.logger.Info("Secret lease reached its max TTL", "path", is.spec.Path, "expires", expires)
+			l.expireAt(ctx, expires.Add(-duration/3))
+			return
+		}
+		wait = next * 2 / 3
+	}
+}
+
+// Release は更新を止め、全てのリースを失効させます。2回目以降の呼び出しは何もしません。
+func (l *Leases) Release() error {
+	var err error
+	l.once.Do(func() {
+		if l.cancel != nil {
+			l.cancel()
+		}
+		l.wg.Wait()
+		err = l.revoke()
+	})
+	return err
+}
+
+func (l *Leases) revoke() error {
+	ctx, cancel := context.WithTimeout(context.Background(), revokeTimeout)
+	defer cancel()
+	var errs []error
+	for _, is := range l.leases {
+		if is.lease.ID == "" {
+			continue
+		}
+		if err := is.provider.Revoke(ctx, is.lease); err != nil {
+			errs = append(errs, fmt.Errorf("revoke secret %s: %w", is.spec.Path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,220 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeProvider はリースの発行・更新・失効を記録するプロバイダーです。
+type fakeProvider struct {
+	duration     time.Duration
+	failPath     string
+	nonRenewable bool // 更新できないリースを発行する
+	capped       bool // 更新すると最大の有効期間に達して元の半分の有効期間を返す
+
+	mu      sync.Mutex
+	issued  int
+	renewed map[string]int
+	revoked []string
+}
+
+func (p *fakeProvider) Issue(_ context.Context, path string) (*Lease, error) {
+	if path == p.failPath {
+		return nil, errors.New("permission denied")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.issued++
+	return &Lease{
+		ID:        fmt.Sprintf("%s/%d", path, p.issued),
+		Data:      map[string]string{"username": fmt.Sprintf("user-%d", p.issued), "password": "secret"},
+		Duration:  p.duration,
+		Renewable: !p.nonRenewable,
+	}, nil
+}
+
+func (p *fakeProvider) Renew(_ context.Context, lease *Lease) (time.Duration, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.renewed == nil {
+		p.renewed = make(map[string]int)
+	}
+	p.renewed[lease.ID]++
+	if p.capped {
+		return p.duration / 2, nil
+	}
+	return p.duration, nil
+}
+
+func (p *fakeProvider) Revoke(_ context.Context, lease *Lease) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.revoked = append(p.revoked, lease.ID)
+	return nil
+}
+
+func (p *fakeProvider) renewCount(id string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.renewed[id]
+}
+
+func TestManager_Acquire(t *testing.T) {
+	provider := &fakeProvider{duration: 30 * time.Millisecond}
+	manager := newManager([]Spec{
+		{Provider: "fake", Path: "database/creds/readonly", Env: map[string]string{"username": "DB_USER", "password": "DB_PASSWORD"}},
+	}, map[string]Provider{"fake": provider}, nil)
+
+	first, err := manager.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	second, err := manager.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if got := first.Env(); got["DB_USER"] != "user-1" || got["DB_PASSWORD"] != "secret" {
+		t.Errorf("Env() = %v, want DB_USER=user-1 DB_PASSWORD=secret", got)
+	}
+	if got := second.Env()["DB_USER"]; got != "user-2" {
+		t.Errorf("second Env()[DB_USER] = %q, want user-2 (issued per process)", got)
+	}
+
+	// 有効期間が過ぎる前に更新し続ける
+	time.Sleep(100 * time.Millisecond)
+	if got := provider.renewCount("database/creds/readonly/1"); got < 2 {
+		t.Errorf("renewals = %d, want >= 2", got)
+	}
+
+	if err := first.Release(); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	renewed := provider.renewCount("database/creds/readonly/1")
+	time.Sleep(50 * time.Millisecond)
+	if got := provider.renewCount("database/creds/readonly/1"); got != renewed {
+		t.Errorf("renewals after Release = %d, want %d", got, renewed)
+	}
+	if err := first.Release(); err != nil {
+		t.Fatalf("second Release() error = %v", err)
+	}
+	_ = second.Release()
+
+	if want := []string{"database/creds/readonly/1", "database/creds/readonly/2"}; fmt.Sprint(provider.revoked) != fmt.Sprint(want) {
+		t.Errorf("revoked = %v, want %v", provider.revoked, want)
+	}
+}
+
+func TestLeases_Expiring(t *testing.T) {
+	tests := []struct {
+		name         string
+		provider     *fakeProvider
+		wantExpiring bool
+	}{
+		{name: "更新できるリース_期限切れにならない", provider: &fakeProvider{duration: 30 * time.Millisecond}},
+		{name: "更新できないリース_有効期間の2/3で通知", provider: &fakeProvider{duration: 30 * time.Millisecond, nonRenewable: true}, wantExpiring: true},
+		{name: "最大の有効期間に達したリース_通知", provider: &fakeProvider{duration: 30 * time.Millisecond, capped: true}, wantExpiring: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newManager([]Spec{{Provider: "fake", Path: "database/creds/readonly", Env: map[string]string{"username": "DB_USER"}}},
+				map[string]Provider{"fake": tt.provider}, nil)
+			leases, err := manager.Acquire(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = leases.Release() }()
+
+			select {
+			case <-leases.Expiring():
+				if !tt.wantExpiring {
+					t.Error("Expiring() is closed, want open")
+				}
+			case <-time.After(150 * time.Millisecond):
+				if tt.wantExpiring {
+					t.Error("Expiring() is not closed, want closed")
+				}
+			}
+		})
+	}
+}
+
+func TestManager_AcquireFailure(t *testing.T) {
+	tests := []struct {
+		name  string
+		specs []Spec
+	}{
+		{
+			name: "2つ目の発行に失敗_発行済みのリースを失効",
+			specs: []Spec{
+				{Provider: "fake", Path: "database/creds/readonly", Env: map[string]string{"username": "DB_USER"}},
+				{Provider: "fake", Path: "aws/sts/deploy", Env: map[string]string{"access_key": "AWS_ACCESS_KEY_ID"}},
+			},
+		},
+		{
+			name: "存在しないキー_発行したリースを失効",
+			specs: []Spec{
+				{Provider: "fake", Path: "database/creds/readonly", Env: map[string]string{"token": "TOKEN"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &fakeProvider{duration: time.Minute, failPath: "aws/sts/deploy"}
+			manager := newManager(tt.specs, map[string]Provider{"fake": provider}, nil)
+			if _, err := manager.Acquire(context.Background()); err == nil {
+				t.Fatal("Acquire() expected error but got none")
+			}
+			if want := []string{"database/creds/readonly/1"}; fmt.Sprint(provider.revoked) != fmt.Sprint(want) {
+				t.Errorf("revoked = %v, want %v", provider.revoked, want)
+			}
+		})
+	}
+}
+
+func TestNewManager_Validate(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "http://127.0.0.1:8200")
+	t.Setenv("VAULT_TOKEN", "root")
+
+	tests := []struct {
+		name    string
+		specs   []Spec
+		wantErr bool
+	}{
+		{name: "vaultのシークレット_成功", specs: []Spec{{Path: "database/creds/readonly", Env: map[string]string{"username": "DB_USER"}}}},
+		{name: "pathなし_エラー", specs: []Spec{{Env: map[string]string{"username": "DB_USER"}}}, wantErr: true},
+		{name: "envなし_エラー", specs: []Spec{{Path: "database/creds/readonly"}}, wantErr: true},
+		{name: "未知のプロバイダー_エラー", specs: []Spec{{Provider: "unknown", Path: "a", Env: map[string]string{"a": "A"}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewManager(tt.specs, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewManager() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	data := `[{"path":"database/creds/readonly","env":{"username":"DB_USER","password":"DB_PASSWORD"}}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	specs, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(specs) != 1 || specs[0].Path != "database/creds/readonly" || specs[0].Env["password"] != "DB_PASSWORD" {
+		t.Errorf("Load() = %+v", specs)
+	}
+}
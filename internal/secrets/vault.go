@@ -0,0 +1,158 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// vaultRequestTimeout は ctx に期限がない場合の1リクエストあたりのタイムアウトです。
+const vaultRequestTimeout = 10 * time.Second
+
+// Vault は HashiCorp Vault の動的シークレットを発行します。
+// 必要な API は読み取りとリースの更新・失効だけなので、SDK を使わずに HTTP API を直接呼び出します。
+type Vault struct {
+	addr      *url.URL
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+// NewVault は addr の Vault に token で接続する Vault を作成します。
+func NewVault(addr, token, namespace string) (*Vault, error) {
+	u, err := url.Parse(addr)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Vault address %q", addr)
+	}
+	if token == "" {
+		return nil, errors.New("vault token is not set")
+	}
+	return &Vault{addr: u, token: token, namespace: namespace, client: &http.Client{}}, nil
+}
+
+// NewVaultFromEnv は VAULT_ADDR・VAULT_TOKEN・VAULT_NAMESPACE から Vault を作成します。
+func NewVaultFromEnv() (*Vault, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil, errors.New("VAULT_ADDR is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return nil, errors.New("VAULT_TOKEN is not set")
+	}
+	return NewVault(addr, token, os.Getenv("VAULT_NAMESPACE"))
+}
+
+// vaultSecret は Vault のシークレットのレスポンスです。
+type vaultSecret struct {
+	LeaseID       string         `json:"lease_id"`
+	LeaseDuration int64          `json:"lease_duration"`
+	Renewable     bool           `json:"renewable"`
+	Data          map[string]any `json:"data"`
+}
+
+// Issue は path のシークレットを読み取ります。動的シークレットでは読み取るたびに新しい認証情報が発行されます。
+// KV バージョン 2 のシークレット（data と metadata を持つ data）は、内側の data の値を返します。
+// 文字列以外の値は JSON にエンコードした文字列にします。
+func (v *Vault) Issue(ctx context.Context, path string) (*Lease, error) {
+	var secret vaultSecret
+	if err := v.do(ctx, http.MethodGet, strings.Trim(path, "/"), nil, &secret); err != nil {
+		return nil, err
+	}
+	if inner, ok := secret.Data["data"].(map[string]any); ok {
+		if _, ok := secret.Data["metadata"].(map[string]any); ok {
+			secret.Data = inner
+		}
+	}
+	data := make(map[string]string, len(secret.Data))
+	for key, value := range secret.Data {
+		if s, ok := value.(string); ok {
+			data[key] = s
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		data[key] = string(encoded)
+	}
+	return &Lease{
+		ID:        secret.LeaseID,
+		Data:      data,
+		Duration:  time.Duration(secret.LeaseDuration) * time.Second,
+		Renewable: secret.Renewable,
+	}, nil
+}
+
+// Renew はリースを元の有効期間だけ延長します。
+func (v *Vault) Renew(ctx context.Context, lease *Lease) (time.Duration, error) {
+	body := map[string]any{"lease_id": lease.ID, "increment": int64(lease.Duration / time.Second)}
+	var secret vaultSecret
+	if err := v.do(ctx, http.MethodPut, "sys/leases/renew", body, &secret); err != nil {
+		return 0, err
+	}
+	return time.Duration(secret.LeaseDuration) * time.Second, nil
+}
+
+// Revoke はリースを失効させます。
+func (v *Vault) Revoke(ctx context.Context, lease *Lease) error {
+	return v.do(ctx, http.MethodPut, "sys/leases/revoke", map[string]any{"lease_id": lease.ID}, nil)
+}
+
+func (v *Vault) do(ctx context.Context, method, path string, body any, out any) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, vaultRequestTimeout)
+		defer cancel()
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	u := *v.addr
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/" + path
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return fmt.Errorf("create Vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	req.Header.Set("X-Vault-Request", "true")
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault %s %s: %w", method, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errBody struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&errBody)
+		return fmt.Errorf("vault %s %s: %s: %s", method, path, resp.Status, strings.Join(errBody.Errors, "; "))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode Vault response %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVault(t *testing.T) {
+	var renewed, revoked map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" || r.Header.Get("X-Vault-Namespace") != "team" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/database/creds/readonly":
+			_, _ = w.Write([]byte(`{"lease_id":"database/creds/readonly/abc","lease_duration":3600,"renewable":true,"data":{"username":"v-token-readonly","password":"pw","port":5432}}`))
+		case "GET /v1/secret/data/slack":
+			_, _ = w.Write([]byte(`{"lease_id":"","lease_duration":0,"renewable":false,"data":{"data":{"token":"xoxb-1"},"metadata":{"version":3}}}`))
+		case "PUT /v1/sys/leases/renew":
+			_ = json.NewDecoder(r.Body).Decode(&renewed)
+			_, _ = w.Write([]byte(`{"lease_id":"database/creds/readonly/abc","lease_duration":1800,"renewable":true}`))
+		case "PUT /v1/sys/leases/revoke":
+			_ = json.NewDecoder(r.Body).Decode(&revoked)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	vault, err := NewVault(server.URL, "root", "team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	lease, err := vault.Issue(ctx, "/database/creds/readonly")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if lease.ID != "database/creds/readonly/abc" || lease.Duration != time.Hour || !lease.Renewable {
+		t.Errorf("Issue() = %+v", lease)
+	}
+	if lease.Data["username"] != "v-token-readonly" || lease.Data["port"] != "5432" {
+		t.Errorf("Issue().Data = %v", lease.Data)
+	}
+
+	next, err := vault.Renew(ctx, lease)
+	if err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	if next != 30*time.Minute {
+		t.Errorf("Renew() = %v, want 30m", next)
+	}
+	if renewed["lease_id"] != lease.ID || renewed["increment"] != float64(3600) {
+		t.Errorf("renew body = %v", renewed)
+	}
+
+	if err := vault.Revoke(ctx, lease); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if revoked["lease_id"] != lease.ID {
+		t.Errorf("revoke body = %v", revoked)
+	}
+
+	// KV バージョン 2 は内側の data の値を返す
+	kv, err := vault.Issue(ctx, "secret/data/slack")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if kv.Data["token"] != "xoxb-1" || len(kv.Data) != 1 || kv.Duration != 0 {
+		t.Errorf("Issue() of KV v2 = %+v", kv)
+	}
+
+	if _, err := vault.Issue(ctx, "database/creds/missing"); err == nil {
+		t.Error("Issue() of missing path expected error but got none")
+	}
+	denied, _ := NewVault(server.URL, "wrong", "team")
+	if _, err := denied.Issue(ctx, "database/creds/readonly"); err == nil {
+		t.Error("Issue() with wrong token expected error but got none")
+	}
+}
+
+func TestNewVault_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		addr  string
+		token string
+	}{
+		{name: "アドレスが不正_エラー", addr: "127.0.0.1:8200", token: "root"},
+		{name: "トークンなし_エラー", addr: "http://127.0.0.1:8200"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewVault(tt.addr, tt.token, ""); err == nil {
+				t.Error("NewVault() expected error but got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package sessionstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/redis"
+)
+
+// DefaultRedisKeyPrefix はレコードのキーに付けるプレフィックスです。
+const DefaultRedisKeyPrefix = "tumiki:session:"
+
+// Redis はレコードを Redis に保持する Store です。
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedis は redis://[user:password@]host[:port][/db] 形式の URL から Redis を作成します。
+// rediss:// を指定した場合は TLS で接続します。接続は最初の操作時に確立します。
+func NewRedis(rawURL string) (*Redis, error) {
+	client, err := redis.NewClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Redis{client: client, prefix: DefaultRedisKeyPrefix}, nil
+}
+
+// Put はレコードを JSON として ttl 付きで保存します。
+func (r *Redis) Put(ctx context.Context, id string, rec Record, ttl time.Duration) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encode session record: %w", err)
+	}
+	_, _, err = r.client.Do(ctx, "SET", r.prefix+id, string(data), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// Get はレコードを取得します。
+func (r *Redis) Get(ctx context.Context, id string) (Record, bool, error) {
+	data, ok, err := r.client.Do(ctx, "GET", r.prefix+id)
+	if err != nil || !ok {
+		return Record{}, false, err
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return Record{}, false, fmt.Errorf("decode session record: %w", err)
+	}
+	return rec, true, nil
+}
+
+// Delete はレコードを削除します。
+func (r *Redis) Delete(ctx context.Context, id string) error {
+	_, _, err := r.client.Do(ctx, "DEL", r.prefix+id)
+	return err
+}
+
+// Close は Redis への接続を閉じます。
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,58 @@
+package sessionstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rayven122/tumiki-mcp-http-adapter/internal/redistest"
+)
+
+func TestRedis(t *testing.T) {
+	fake := redistest.Start(t, "")
+	r, err := NewRedis("redis://" + fake.Addr())
+	if err != nil {
+		t.Fatalf("NewRedis() error = %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	ctx := context.Background()
+
+	rec := Record{Owner: "http://10.0.0.1:8080", ProtocolVersion: "2025-06-18"}
+	if err := r.Put(ctx, "abc", rec, 90*time.Second); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	got, ok, err := r.Get(ctx, "abc")
+	if err != nil || !ok || got != rec {
+		t.Fatalf("Get() = %+v, %v, %v, want %+v", got, ok, err, rec)
+	}
+	if err := r.Delete(ctx, "abc"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, ok, err := r.Get(ctx, "abc"); ok || err != nil {
+		t.Errorf("Get() after Delete = %v, %v, want not found", ok, err)
+	}
+
+	want := []string{
+		`SET tumiki:session:abc {"owner":"http://10.0.0.1:8080","protocolVersion":"2025-06-18"} PX 90000`,
+		"GET tumiki:session:abc",
+		"DEL tumiki:session:abc",
+		"GET tumiki:session:abc",
+	}
+	if got := fake.Commands(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+}
+
+func TestRedis_Errors(t *testing.T) {
+	if _, err := NewRedis("memcached://localhost"); err == nil {
+		t.Error("NewRedis() with unsupported scheme expected error but got none")
+	}
+
+	fake := redistest.Start(t, "")
+	fake.Set("tumiki:session:abc", "not json")
+	r, _ := NewRedis("redis://" + fake.Addr())
+	if _, _, err := r.Get(context.Background(), "abc"); err == nil || !strings.Contains(err.Error(), "decode session record") {
+		t.Errorf("Get() error = %v, want decode error", err)
+	}
+}
@@ -0,0 +1,88 @@
+// Package sessionstore は複数のレプリカでセッションのメタデータを共有するためのストアを提供します。
+//
+// セッションの実体（stdio プロセス）は作成したレプリカにしか存在しないため、
+// ストアには Mcp-Session-Id ごとに所有レプリカとネゴシエーション済みの状態を記録し、
+// 別のレプリカに届いたリクエストを所有レプリカへ転送できるようにします。
+package sessionstore
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Record はセッションのメタデータです。
+type Record struct {
+	Owner           string `json:"owner"`                     // セッションを所有するレプリカのベース URL
+	ProtocolVersion string `json:"protocolVersion,omitempty"` // initialize でネゴシエーションされたプロトコルバージョン
+}
+
+// Store はセッション ID とメタデータの対応を保持します。
+type Store interface {
+	// Put はレコードを ttl の間保持します。既存のレコードは上書きされます。
+	Put(ctx context.Context, id string, rec Record, ttl time.Duration) error
+	// Get はレコードを取得します。存在しない場合は false を返します。
+	Get(ctx context.Context, id string) (Record, bool, error)
+	// Delete はレコードを削除します。存在しない場合もエラーにはなりません。
+	Delete(ctx context.Context, id string) error
+	// Close はストアが保持する接続を閉じます。
+	Close() error
+}
+
+// Memory はプロセス内でレコードを保持する Store です。
+// 単一プロセスで複数のサーバーを動かす場合やテストで使用します。
+type Memory struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	records map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	rec     Record
+	expires time.Time
+}
+
+// NewMemory は空の Memory を作成します。
+func NewMemory() *Memory {
+	return &Memory{
+		now:     time.Now,
+		records: make(map[string]memoryEntry),
+	}
+}
+
+// Put はレコードを ttl の間保持します。
+func (m *Memory) Put(_ context.Context, id string, rec Record, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[id] = memoryEntry{rec: rec, expires: m.now().Add(ttl)}
+	return nil
+}
+
+// Get は期限切れでないレコードを取得します。
+func (m *Memory) Get(_ context.Context, id string) (Record, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.records[id]
+	if !ok {
+		return Record{}, false, nil
+	}
+	if !m.now().Before(entry.expires) {
+		delete(m.records, id)
+		return Record{}, false, nil
+	}
+	return entry.rec, true, nil
+}
+
+// Delete はレコードを削除します。
+func (m *Memory) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, id)
+	return nil
+}
+
+// Close は何もしません。
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,46 @@
+package sessionstore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	rec := Record{Owner: "http://10.0.0.1:8080", ProtocolVersion: "2025-06-18"}
+	if err := m.Put(ctx, "a", rec, time.Minute); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	got, ok, err := m.Get(ctx, "a")
+	if err != nil || !ok || got != rec {
+		t.Fatalf("Get() = %+v, %v, %v, want %+v", got, ok, err, rec)
+	}
+	if _, ok, _ := m.Get(ctx, "missing"); ok {
+		t.Error("Get() of missing id should not be found")
+	}
+
+	// 期限切れのレコードは取得できない
+	now = now.Add(time.Minute)
+	if _, ok, _ := m.Get(ctx, "a"); ok {
+		t.Error("Get() of expired record should not be found")
+	}
+
+	if err := m.Put(ctx, "b", rec, time.Minute); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := m.Delete(ctx, "b"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, ok, _ := m.Get(ctx, "b"); ok {
+		t.Error("Get() of deleted record should not be found")
+	}
+	if err := m.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+// Package spiffe は SPIFFE Workload API から取得した X.509-SVID によるワークロードの識別を提供します。
+//
+// プロキシ自身の証明書として SVID を使って mTLS を終端し、接続してきたワークロードを SPIFFE ID のパターンで認可します。
+package spiffe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ErrNotAuthorized は接続元の SPIFFE ID が許可されていないことを表します。
+var ErrNotAuthorized = errors.New("spiffe id is not authorized")
+
+// Matcher は許可する SPIFFE ID のパターンです。
+// パターンは path.Match の形式で、"*" は "/" を含まない1つのセグメントに一致します。
+//
+//	spiffe://example.org/ns/prod/sa/*
+type Matcher struct {
+	patterns []string
+}
+
+// NewMatcher はパターンを検証して Matcher を作成します。パターンがない場合は全ての ID を許可します。
+func NewMatcher(patterns []string) (*Matcher, error) {
+	for _, p := range patterns {
+		if !strings.HasPrefix(p, "spiffe://") {
+			return nil, fmt.Errorf("invalid SPIFFE ID pattern %q: must start with spiffe://", p)
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid SPIFFE ID pattern %q: %w", p, err)
+		}
+	}
+	return &Matcher{patterns: patterns}, nil
+}
+
+// Authorize は id がいずれかのパターンに一致するか確かめます。
+func (m *Matcher) Authorize(id string) error {
+	if m == nil || len(m.patterns) == 0 {
+		return nil
+	}
+	for _, p := range m.patterns {
+		if ok, _ := path.Match(p, id); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrNotAuthorized, id)
+}
+
+// IDFromCert は X.509-SVID の URI SAN から SPIFFE ID を返します。
+// SVID は spiffe:// の URI SAN をちょうど1つ持ちます。
+func IDFromCert(cert *x509.Certificate) (string, error) {
+	if len(cert.URIs) != 1 || cert.URIs[0].Scheme != "spiffe" || cert.URIs[0].Host == "" {
+		return "", errors.New("certificate is not an X.509-SVID: want exactly one spiffe:// URI SAN")
+	}
+	return cert.URIs[0].String(), nil
+}
+
+// PeerID は検証済みの TLS 接続の相手の SPIFFE ID を返します。
+func PeerID(state *tls.ConnectionState) (string, bool) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return "", false
+	}
+	id, err := IDFromCert(state.PeerCertificates[0])
+	return id, err == nil
+}
@@ -0,0 +1,45 @@
+package spiffe
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		id       string
+		wantErr  bool
+	}{
+		{name: "パターンなし_全て許可", id: "spiffe://example.org/anything"},
+		{name: "完全一致_許可", patterns: []string{"spiffe://example.org/ns/prod/sa/web"}, id: "spiffe://example.org/ns/prod/sa/web"},
+		{name: "ワイルドカード_許可", patterns: []string{"spiffe://example.org/ns/prod/sa/*"}, id: "spiffe://example.org/ns/prod/sa/web"},
+		{name: "ワイルドカードはセグメントを越えない_拒否", patterns: []string{"spiffe://example.org/ns/*"}, id: "spiffe://example.org/ns/prod/sa/web", wantErr: true},
+		{name: "別のトラストドメイン_拒否", patterns: []string{"spiffe://example.org/*"}, id: "spiffe://evil.org/web", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMatcher(tt.patterns)
+			if err != nil {
+				t.Fatalf("NewMatcher() error = %v", err)
+			}
+			err = m.Authorize(tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Authorize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrNotAuthorized) {
+				t.Errorf("Authorize() error = %v, want ErrNotAuthorized", err)
+			}
+		})
+	}
+}
+
+func TestNewMatcher_InvalidPattern(t *testing.T) {
+	for _, p := range []string{"example.org/web", "spiffe://example.org/[web"} {
+		if _, err := NewMatcher([]string{p}); err == nil {
+			t.Errorf("NewMatcher(%q) error = nil", p)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package spiffe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+)
+
+// ServerTLSConfig は SVID を証明書として提示し、クライアントにも SVID を要求する mTLS の設定を返します。
+// クライアントの証明書はローテーションされた最新のバンドルで検証します。SPIFFE ID の認可は Matcher で行います。
+func (s *Source) ServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.RequireAnyClientCert,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return s.svid().certificate, nil
+		},
+		// バンドルが更新されるため ClientCAs ではなく接続ごとに検証する
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return s.verify(rawCerts, x509.ExtKeyUsageClientAuth)
+		},
+	}
+}
+
+// OptionalClientServerTLSConfig は ServerTLSConfig と同じですが、クライアント証明書を任意にします。
+// 証明書を提示しないクライアントは他の方式（JWT・API キーなど）で認証するため、提示した場合だけ検証します。
+func (s *Source) OptionalClientServerTLSConfig() *tls.Config {
+	cfg := s.ServerTLSConfig()
+	cfg.ClientAuth = tls.RequestClientCert
+	cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return nil
+		}
+		return s.verify(rawCerts, x509.ExtKeyUsageClientAuth)
+	}
+	return cfg
+}
+
+// verify は証明書チェーンを最新のバンドルで検証し、先頭の証明書が X.509-SVID であることを確かめます。
+func (s *Source) verify(rawCerts [][]byte, usage x509.ExtKeyUsage) error {
+	if len(rawCerts) == 0 {
+		return errors.New("no client certificate")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+	if _, err := IDFromCert(certs[0]); err != nil {
+		return err
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         s.svid().roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	})
+	return err
+}
+
+// ClientTLSConfig は SVID をクライアント証明書として提示し、接続先の SVID を最新のバンドルで検証する設定を返します。
+// SVID は DNS 名を持たないため、ホスト名ではなくバンドルと SPIFFE ID の形式で検証します。
+func (s *Source) ClientTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return s.svid().certificate, nil
+		},
+		InsecureSkipVerify: true, // 標準の検証の代わりに VerifyPeerCertificate で検証する
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return s.verify(rawCerts, x509.ExtKeyUsageServerAuth)
+		},
+	}
+}
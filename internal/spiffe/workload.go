@@ -0,0 +1,263 @@
+package spiffe
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// SocketEnv は Workload API のソケットのアドレスを指定する標準の環境変数です。
+const SocketEnv = "SPIFFE_ENDPOINT_SOCKET"
+
+// DefaultFetchTimeout は起動時に最初の SVID を受け取るまで待つデフォルトの時間です。
+const DefaultFetchTimeout = 30 * time.Second
+
+// Workload API の呼び出し設定です。
+const (
+	fetchX509SVIDMethod = "/SpiffeWorkloadAPI/FetchX509SVID"
+	workloadHeader      = "workload.spiffe.io" // Workload API が全ての呼び出しに要求するメタデータ
+	retryInterval       = time.Second          // ストリームが切れた場合の再接続の間隔
+)
+
+// svid は Workload API から受け取った X.509-SVID と信頼するバンドルです。
+type svid struct {
+	id          string
+	certificate *tls.Certificate
+	roots       *x509.CertPool
+}
+
+// Source は Workload API から X.509-SVID を受け取り続け、ローテーションされた最新の SVID を保持します。
+type Source struct {
+	conn   *grpc.ClientConn
+	cancel context.CancelFunc
+	done   chan struct{}
+	logger *slog.Logger
+
+	mu      sync.RWMutex
+	current *svid
+}
+
+// NewSource は addr（unix:///path/to/agent.sock など）の Workload API に接続し、最初の SVID を受け取るまで待ちます。
+// 受け取れないまま ctx が終了した場合はエラーを返します。
+func NewSource(ctx context.Context, addr string, logger *slog.Logger) (*Source, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("SPIFFE Workload API address is not set (set $%s)", SocketEnv)
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "unix://" + addr
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("connect to SPIFFE Workload API: %w", err)
+	}
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	s := &Source{conn: conn, cancel: cancel, done: make(chan struct{}), logger: logger}
+	ready := make(chan struct{})
+	go s.watch(watchCtx, ready)
+
+	select {
+	case <-ready:
+		return s, nil
+	case <-ctx.Done():
+		_ = s.Close()
+		return nil, fmt.Errorf("fetch X.509-SVID from %s: %w", addr, context.Cause(ctx))
+	}
+}
+
+// Close は Workload API との接続を閉じます。
+func (s *Source) Close() error {
+	s.cancel()
+	<-s.done
+	return s.conn.Close()
+}
+
+// ID はプロキシ自身の SPIFFE ID を返します。
+func (s *Source) ID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current.id
+}
+
+func (s *Source) svid() *svid {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// watch は SVID のストリームを受け取り続け、切れた場合は再接続します。最初の SVID を受け取ると ready を閉じます。
+func (s *Source) watch(ctx context.Context, ready chan struct{}) {
+	defer close(s.done)
+	var once sync.Once
+	for {
+		err := s.stream(ctx, func(update *svid) {
+			s.mu.Lock()
+			s.current = update
+			s.mu.Unlock()
+			once.Do(func() { close(ready) })
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		s.logger.Warn("SPIFFE Workload API stream failed", "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// stream は FetchX509SVID を呼び出し、受け取った SVID ごとに update を呼び出します。
+// protoc の生成コードを使わないよう、レスポンスは未知のフィールドとして受け取ってから protowire で解析します。
+func (s *Source) stream(ctx context.Context, update func(*svid)) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, workloadHeader, "true")
+	stream, err := s.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, fetchX509SVIDMethod)
+	if err != nil {
+		return err
+	}
+	// X509SVIDRequest はフィールドを持たないため Empty と同じ表現になる
+	if err := stream.SendMsg(&emptypb.Empty{}); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	for {
+		resp := new(emptypb.Empty)
+		if err := stream.RecvMsg(resp); err != nil {
+			return err
+		}
+		next, err := parseX509SVIDResponse(resp.ProtoReflect().GetUnknown())
+		if err != nil {
+			return err
+		}
+		update(next)
+	}
+}
+
+// parseX509SVIDResponse は X509SVIDResponse を解析し、最初の SVID（デフォルトの SVID）を返します。
+//
+//	message X509SVIDResponse { repeated X509SVID svids = 1; repeated bytes crl = 2; map<string, bytes> federated_bundles = 3; }
+//	message X509SVID { string spiffe_id = 1; bytes x509_svid = 2; bytes x509_svid_key = 3; bytes bundle = 4; string hint = 5; }
+func parseX509SVIDResponse(b []byte) (*svid, error) {
+	var first []byte
+	var federated [][]byte
+	err := rangeFields(b, func(num protowire.Number, v []byte) error {
+		switch num {
+		case 1:
+			if first == nil {
+				first = v
+			}
+		case 3:
+			return rangeFields(v, func(num protowire.Number, v []byte) error {
+				if num == 2 {
+					federated = append(federated, v)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if first == nil {
+		return nil, errors.New("X509SVIDResponse has no SVID")
+	}
+
+	var id string
+	var certDER, keyDER, bundleDER []byte
+	if err := rangeFields(first, func(num protowire.Number, v []byte) error {
+		switch num {
+		case 1:
+			id = string(v)
+		case 2:
+			certDER = v
+		case 3:
+			keyDER = v
+		case 4:
+			bundleDER = v
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	certs, err := x509.ParseCertificates(certDER)
+	if err != nil || len(certs) == 0 {
+		return nil, fmt.Errorf("parse X.509-SVID %s: %w", id, err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyDER)
+	if err != nil {
+		return nil, fmt.Errorf("parse X.509-SVID key %s: %w", id, err)
+	}
+	if _, ok := key.(crypto.Signer); !ok {
+		return nil, fmt.Errorf("X.509-SVID key %s is not a signer", id)
+	}
+	if certID, err := IDFromCert(certs[0]); err != nil || certID != id {
+		return nil, fmt.Errorf("X.509-SVID certificate does not match %s", id)
+	}
+
+	roots := x509.NewCertPool()
+	for _, der := range append([][]byte{bundleDER}, federated...) {
+		bundle, err := x509.ParseCertificates(der)
+		if err != nil {
+			return nil, fmt.Errorf("parse trust bundle: %w", err)
+		}
+		for _, c := range bundle {
+			roots.AddCert(c)
+		}
+	}
+
+	chain := make([][]byte, len(certs))
+	for i, c := range certs {
+		chain[i] = c.Raw
+	}
+	return &svid{
+		id:          id,
+		certificate: &tls.Certificate{Certificate: chain, PrivateKey: key, Leaf: certs[0]},
+		roots:       roots,
+	}, nil
+}
+
+// rangeFields は長さ付きのフィールド（文字列・バイト列・メッセージ）ごとに fn を呼び出します。その他のフィールドは読み飛ばします。
+func rangeFields(b []byte, fn func(num protowire.Number, v []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(num, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package spiffe
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// testCA は SVID を発行するテスト用の認証局です。
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue は id の X.509-SVID の証明書（DER）と PKCS#8 の鍵を発行します。id が空の場合は URI SAN を付けません。
+func (ca *testCA) issue(t *testing.T, id string) (certDER, keyDER []byte) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if id != "" {
+		u, _ := url.Parse(id)
+		tmpl.URIs = []*url.URL{u}
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ = x509.MarshalPKCS8PrivateKey(key)
+	return certDER, keyDER
+}
+
+// tlsCert は id の SVID を tls.Certificate として返します。
+func (ca *testCA) tlsCert(t *testing.T, id string) tls.Certificate {
+	t.Helper()
+	certDER, keyDER := ca.issue(t, id)
+	key, _ := x509.ParsePKCS8PrivateKey(keyDER)
+	return tls.Certificate{Certificate: [][]byte{certDER}, PrivateKey: key}
+}
+
+// x509SVIDResponse は X509SVIDResponse を protobuf でエンコードします。
+func (ca *testCA) x509SVIDResponse(t *testing.T, id string) []byte {
+	t.Helper()
+	certDER, keyDER := ca.issue(t, id)
+	var svid []byte
+	svid = protowire.AppendTag(svid, 1, protowire.BytesType)
+	svid = protowire.AppendString(svid, id)
+	svid = protowire.AppendTag(svid, 2, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, certDER)
+	svid = protowire.AppendTag(svid, 3, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, keyDER)
+	svid = protowire.AppendTag(svid, 4, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, ca.cert.Raw)
+
+	var resp []byte
+	resp = protowire.AppendTag(resp, 1, protowire.BytesType)
+	return protowire.AppendBytes(resp, svid)
+}
+
+// startWorkloadAPI は responses を順に返す Workload API をソケットで起動し、そのアドレスを返します。
+func startWorkloadAPI(t *testing.T, responses <-chan []byte) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "spiffe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "agent.sock")
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := grpc.NewServer()
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "SpiffeWorkloadAPI",
+		HandlerType: (*any)(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "FetchX509SVID",
+			ServerStreams: true,
+			Handler: func(_ any, stream grpc.ServerStream) error {
+				md, _ := metadata.FromIncomingContext(stream.Context())
+				if v := md.Get(workloadHeader); len(v) != 1 || v[0] != "true" {
+					return status.Error(codes.InvalidArgument, "security header missing")
+				}
+				if err := stream.RecvMsg(new(emptypb.Empty)); err != nil {
+					return err
+				}
+				for {
+					select {
+					case <-stream.Context().Done():
+						return nil
+					case raw := <-responses:
+						resp := new(emptypb.Empty)
+						resp.ProtoReflect().SetUnknown(raw)
+						if err := stream.SendMsg(resp); err != nil {
+							return err
+						}
+					}
+				}
+			},
+		}},
+	}, struct{}{})
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+	return "unix://" + socket
+}
+
+func newTestSource(t *testing.T, ca *testCA, id string) (*Source, chan []byte) {
+	t.Helper()
+	responses := make(chan []byte, 2)
+	responses <- ca.x509SVIDResponse(t, id)
+	addr := startWorkloadAPI(t, responses)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	source, err := NewSource(ctx, addr, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+	t.Cleanup(func() { _ = source.Close() })
+	return source, responses
+}
+
+func TestSource_FetchAndRotate(t *testing.T) {
+	ca := newTestCA(t)
+	source, responses := newTestSource(t, ca, "spiffe://example.org/adapter")
+	if got := source.ID(); got != "spiffe://example.org/adapter" {
+		t.Errorf("ID() = %q", got)
+	}
+
+	// ローテーションされた SVID に切り替わる
+	responses <- ca.x509SVIDResponse(t, "spiffe://example.org/adapter-v2")
+	deadline := time.Now().Add(5 * time.Second)
+	for source.ID() != "spiffe://example.org/adapter-v2" {
+		if time.Now().After(deadline) {
+			t.Fatalf("ID() = %q after rotation", source.ID())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewSource_Unavailable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := NewSource(ctx, filepath.Join(t.TempDir(), "missing.sock"), slog.New(slog.NewTextHandler(os.Stderr, nil))); err == nil {
+		t.Error("NewSource() error = nil")
+	}
+	if _, err := NewSource(ctx, "", nil); err == nil {
+		t.Error("NewSource(\"\") error = nil")
+	}
+}
+
+func TestSource_ServerTLSConfig(t *testing.T) {
+	ca := newTestCA(t)
+	source, _ := newTestSource(t, ca, "spiffe://example.org/adapter")
+
+	tests := []struct {
+		name    string
+		certs   []tls.Certificate
+		wantID  string
+		wantErr bool
+	}{
+		{name: "同じトラストドメインのSVID_接続できる", certs: []tls.Certificate{ca.tlsCert(t, "spiffe://example.org/client")}, wantID: "spiffe://example.org/client"},
+		{name: "別の認証局の証明書_拒否", certs: []tls.Certificate{newTestCA(t).tlsCert(t, "spiffe://example.org/client")}, wantErr: true},
+		{name: "URI SANのない証明書_拒否", certs: []tls.Certificate{ca.tlsCert(t, "")}, wantErr: true},
+		{name: "クライアント証明書なし_拒否", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConn, clientConn := net.Pipe()
+			defer func() { _ = clientConn.Close() }()
+			server := tls.Server(serverConn, source.ServerTLSConfig())
+			defer func() { _ = server.Close() }()
+
+			roots := x509.NewCertPool()
+			roots.AddCert(ca.cert)
+			client := tls.Client(clientConn, &tls.Config{
+				RootCAs:      roots,
+				Certificates: tt.certs,
+				// SVID は DNS 名を持たないため、サーバーの SPIFFE ID はテストで別途確認する
+				InsecureSkipVerify: true,
+			})
+			go func() {
+				_ = client.Handshake()
+				// TLS 1.3 ではサーバーの検証結果を受け取るまで読み取る
+				_, _ = client.Read(make([]byte, 1))
+			}()
+
+			err := server.Handshake()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Handshake() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			state := server.ConnectionState()
+			if id, ok := PeerID(&state); !ok || id != tt.wantID {
+				t.Errorf("PeerID() = %q, %v, want %q", id, ok, tt.wantID)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+// Package templatefunc は設定のテンプレート（--stdio・--env の値、--header-template、レスポンス変換の Set）で使える関数を提供します。
+//
+// パイプラインで値を最後の引数に渡せるよう、引数の順序は {{.Value | trimPrefix "v"}} のように書ける順にしています。
+package templatefunc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// FuncMap はテンプレートで使える関数を返します。
+//   - lower / upper: 小文字・大文字に変換
+//   - trimPrefix PREFIX S: S の先頭の PREFIX を取り除く
+//   - b64dec S: base64（パディングの有無を問わない）をデコード
+//   - sha256 S: SHA-256 の16進数のダイジェスト
+//   - default DEFAULT S: S が空の場合は DEFAULT
+func FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"trimPrefix": trimPrefix,
+		"b64dec":     b64dec,
+		"sha256":     sha256Hex,
+		"default":    defaultValue,
+	}
+}
+
+func trimPrefix(prefix, s string) string {
+	return strings.TrimPrefix(s, prefix)
+}
+
+func b64dec(s string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		if decoded, err = base64.RawStdEncoding.DecodeString(s); err != nil {
+			return "", fmt.Errorf("b64dec: %w", err)
+		}
+	}
+	return string(decoded), nil
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func defaultValue(def, s string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,45 @@
+package templatefunc
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestFuncMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "lower_小文字", input: `{{lower "MiXeD"}}`, want: "mixed"},
+		{name: "upper_大文字", input: `{{"MiXeD" | upper}}`, want: "MIXED"},
+		{name: "trimPrefix_先頭を取り除く", input: `{{"Bearer abc" | trimPrefix "Bearer "}}`, want: "abc"},
+		{name: "trimPrefix_一致しない_そのまま", input: `{{trimPrefix "v" "1.0"}}`, want: "1.0"},
+		{name: "b64dec_デコード", input: `{{b64dec "aGVsbG8="}}`, want: "hello"},
+		{name: "b64dec_パディングなし_デコード", input: `{{b64dec "aGVsbG8"}}`, want: "hello"},
+		{name: "b64dec_不正な値_エラー", input: `{{b64dec "%%%"}}`, wantErr: true},
+		{name: "sha256_16進数", input: `{{sha256 "abc"}}`, want: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{name: "default_空の場合", input: `{{"" | default "info"}}`, want: "info"},
+		{name: "default_値がある場合", input: `{{"debug" | default "info"}}`, want: "debug"},
+		{name: "組み合わせ_順に適用", input: `{{"V1.2" | lower | trimPrefix "v"}}`, want: "1.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := template.New("test").Funcs(FuncMap()).Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			var b strings.Builder
+			err = tmpl.Execute(&b, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && b.String() != tt.want {
+				t.Errorf("Execute() = %q, want %q", b.String(), tt.want)
+			}
+		})
+	}
+}
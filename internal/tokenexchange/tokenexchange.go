@@ -0,0 +1,216 @@
+// Package tokenexchange は OAuth 2.0 Token Exchange（RFC 8693）でクライアントのトークンを
+// 下流のサービス向けに権限を絞ったトークンに交換する機能を提供します。
+//
+// プロセスにはクライアントのトークンをそのまま渡さず、交換したトークンだけを渡すために使用します。
+// 必要なのはトークンエンドポイントへの POST だけなので、外部ライブラリを使わずに実装しています。
+package tokenexchange
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RFC 8693 のトークンの種類です。
+const (
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+	TokenTypeIDToken     = "urn:ietf:params:oauth:token-type:id_token"
+)
+
+// grantType は Token Exchange のグラントタイプです。
+const grantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// キャッシュと通信の設定です。
+const (
+	DefaultMaxEntries = 1000             // キャッシュする交換結果のデフォルトの最大数
+	requestTimeout    = 10 * time.Second // ctx に期限がない場合の1リクエストあたりのタイムアウト
+	expiryMargin      = 30 * time.Second // 期限切れの直前のトークンを渡さないよう、期限より早く破棄する時間
+	maxResponseBytes  = 1 << 20          // トークンエンドポイントのレスポンスの最大バイト数
+)
+
+// ErrRejected はトークンエンドポイントがクライアントのトークンを拒否したことを表します。
+var ErrRejected = errors.New("token exchange rejected")
+
+// Config はトークンエンドポイントと要求するトークンの設定です。
+type Config struct {
+	// Endpoint はトークンエンドポイントの URL です（必須）。
+	Endpoint string
+	// ClientID と ClientSecret はプロキシ自身のクライアント認証情報です（HTTP Basic 認証で送ります）。
+	ClientID     string
+	ClientSecret string
+	// Audience と Resource は交換したトークンを使う下流のサービスです。
+	Audience string
+	Resource string
+	// Scopes は交換したトークンに要求するスコープです。
+	Scopes []string
+	// SubjectTokenType はクライアントのトークンの種類です（空の場合は TokenTypeAccessToken）。
+	SubjectTokenType string
+	// RequestedTokenType は要求するトークンの種類です（空の場合はエンドポイントのデフォルト）。
+	RequestedTokenType string
+	// MaxEntries はキャッシュする交換結果の最大数です（0 以下でデフォルト）。
+	MaxEntries int
+}
+
+// Client はトークンを交換し、結果を期限まで再利用します。複数の goroutine から同時に使用できます。
+type Client struct {
+	cfg    Config
+	client *http.Client
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedToken
+}
+
+// cachedToken は交換したトークンとキャッシュの期限です。
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+// New は設定を検証して Client を作成します。
+func New(cfg Config) (*Client, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid token exchange endpoint %q", cfg.Endpoint)
+	}
+	if cfg.SubjectTokenType == "" {
+		cfg.SubjectTokenType = TokenTypeAccessToken
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = DefaultMaxEntries
+	}
+	return &Client{
+		cfg:    cfg,
+		client: &http.Client{},
+		now:    time.Now,
+		cache:  make(map[string]cachedToken),
+	}, nil
+}
+
+// tokenResponse はトークンエンドポイントのレスポンスです。
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange は subjectToken を下流のサービス向けのトークンに交換します。
+// エンドポイントがトークンを拒否した場合（400・401・403）は ErrRejected を返します。
+func (c *Client) Exchange(ctx context.Context, subjectToken string) (string, error) {
+	sum := sha256.Sum256([]byte(subjectToken))
+	key := hex.EncodeToString(sum[:])
+	if token, ok := c.lookup(key); ok {
+		return token, nil
+	}
+
+	form := url.Values{
+		"grant_type":         {grantType},
+		"subject_token":      {subjectToken},
+		"subject_token_type": {c.cfg.SubjectTokenType},
+	}
+	if c.cfg.Audience != "" {
+		form.Set("audience", c.cfg.Audience)
+	}
+	if c.cfg.Resource != "" {
+		form.Set("resource", c.cfg.Resource)
+	}
+	if len(c.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.cfg.Scopes, " "))
+	}
+	if c.cfg.RequestedTokenType != "" {
+		form.Set("requested_token_type", c.cfg.RequestedTokenType)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("create token exchange request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.cfg.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token exchange: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return "", fmt.Errorf("read token exchange response: %w", err)
+	}
+	var body tokenResponse
+	_ = json.Unmarshal(data, &body)
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		// invalid_client はプロキシ自身の設定の問題なので、クライアントのトークンの拒否として扱わない
+		if body.Error == "invalid_client" {
+			return "", fmt.Errorf("token exchange: %s: %s", body.Error, body.ErrorDescription)
+		}
+		return "", fmt.Errorf("%w: %s: %s", ErrRejected, body.Error, body.ErrorDescription)
+	default:
+		return "", fmt.Errorf("token exchange: %s", resp.Status)
+	}
+	if body.AccessToken == "" {
+		return "", errors.New("token exchange response has no access_token")
+	}
+
+	if body.ExpiresIn > 0 {
+		if ttl := time.Duration(body.ExpiresIn)*time.Second - expiryMargin; ttl > 0 {
+			c.store(key, body.AccessToken, ttl)
+		}
+	}
+	return body.AccessToken, nil
+}
+
+func (c *Client) lookup(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.cache[key]
+	if !ok {
+		return "", false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.cache, key)
+		return "", false
+	}
+	return entry.token, true
+}
+
+// store は交換したトークンを ttl の間キャッシュします。
+// 最大数を超える場合は期限切れのものを削除し、それでも超える場合は保存しません。
+func (c *Client) store(key, token string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if len(c.cache) >= c.cfg.MaxEntries {
+		for k, entry := range c.cache {
+			if !now.Before(entry.expires) {
+				delete(c.cache, k)
+			}
+		}
+		if len(c.cache) >= c.cfg.MaxEntries {
+			return
+		}
+	}
+	c.cache[key] = cachedToken{token: token, expires: now.Add(ttl)}
+}
@@ -0,0 +1,160 @@
+package tokenexchange
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTokenServer は subject_token が "user-token" の場合だけ交換するトークンエンドポイントを起動します。
+func newTokenServer(t *testing.T, calls *atomic.Int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if id, secret, _ := r.BasicAuth(); id != "proxy" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		want := map[string]string{
+			"grant_type":         grantType,
+			"subject_token_type": TokenTypeAccessToken,
+			"audience":           "downstream",
+			"scope":              "read write",
+		}
+		for name, value := range want {
+			if got := r.PostForm.Get(name); got != value {
+				t.Errorf("%s = %q, want %q", name, got, value)
+			}
+		}
+		switch r.PostForm.Get("subject_token") {
+		case "user-token":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"downstream-token","issued_token_type":"urn:ietf:params:oauth:token-type:access_token","token_type":"Bearer","expires_in":300}`))
+		case "unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant","error_description":"subject token is expired"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestExchange(t *testing.T) {
+	var calls atomic.Int32
+	server := newTokenServer(t, &calls)
+
+	tests := []struct {
+		name         string
+		clientSecret string
+		subject      string
+		want         string
+		wantRejected bool
+		wantErr      bool
+	}{
+		{
+			name:         "有効なトークン_交換したトークンを返す",
+			clientSecret: "secret",
+			subject:      "user-token",
+			want:         "downstream-token",
+		},
+		{
+			name:         "期限切れのトークン_ErrRejected",
+			clientSecret: "secret",
+			subject:      "expired-token",
+			wantRejected: true,
+			wantErr:      true,
+		},
+		{
+			name:         "プロキシの認証情報が不正_ErrRejectedではないエラー",
+			clientSecret: "wrong",
+			subject:      "user-token",
+			wantErr:      true,
+		},
+		{
+			name:         "エンドポイントが利用できない_ErrRejectedではないエラー",
+			clientSecret: "secret",
+			subject:      "unavailable",
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := New(Config{
+				Endpoint:     server.URL,
+				ClientID:     "proxy",
+				ClientSecret: tt.clientSecret,
+				Audience:     "downstream",
+				Scopes:       []string{"read", "write"},
+			})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			got, err := client.Exchange(context.Background(), tt.subject)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Exchange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrRejected) != tt.wantRejected {
+				t.Errorf("errors.Is(err, ErrRejected) = %v, want %v (err: %v)", !tt.wantRejected, tt.wantRejected, err)
+			}
+			if got != tt.want {
+				t.Errorf("Exchange() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchange_Cache(t *testing.T) {
+	var calls atomic.Int32
+	server := newTokenServer(t, &calls)
+	client, err := New(Config{Endpoint: server.URL, ClientID: "proxy", ClientSecret: "secret", Audience: "downstream", Scopes: []string{"read", "write"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	client.now = func() time.Time { return now }
+
+	for range 3 {
+		if _, err := client.Exchange(context.Background(), "user-token"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("calls = %d, want 1", got)
+	}
+
+	// expires_in から余裕を差し引いた期限を過ぎると再度交換する
+	now = now.Add(300*time.Second - expiryMargin)
+	if _, err := client.Exchange(context.Background(), "user-token"); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+
+	// 拒否された結果はキャッシュしない
+	for range 2 {
+		_, _ = client.Exchange(context.Background(), "expired-token")
+	}
+	if got := calls.Load(); got != 4 {
+		t.Errorf("calls = %d, want 4", got)
+	}
+}
+
+func TestNew_InvalidEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"", "ftp://sts.example.com/token", "https://"} {
+		if _, err := New(Config{Endpoint: endpoint}); err == nil {
+			t.Errorf("New(%q) expected error but got none", endpoint)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// レポートの形式です。
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// DefaultExportInterval はレポートを出力するデフォルトの間隔です。
+const DefaultExportInterval = time.Hour
+
+// webhookTimeout は Webhook への送信のタイムアウトです。
+const webhookTimeout = 10 * time.Second
+
+// ExportConfig はレポートの出力先の設定です。Path と WebhookURL の少なくとも一方を指定します。
+type ExportConfig struct {
+	Interval   time.Duration // 出力の間隔（0 でデフォルト）
+	Format     string        // FormatCSV または FormatJSON（空文字列で FormatJSON）
+	Path       string        // 追記するファイルのパス（CSV の列名はファイルが空の場合のみ書き込む）
+	WebhookURL string        // レポートを POST する URL
+}
+
+// Exporter は Recorder の利用量を定期的に出力します。
+type Exporter struct {
+	recorder *Recorder
+	cfg      ExportConfig
+	client   *http.Client
+	logger   *slog.Logger
+}
+
+// NewExporter は設定を検証して Exporter を作成します。
+func NewExporter(recorder *Recorder, cfg ExportConfig, logger *slog.Logger) (*Exporter, error) {
+	if cfg.Path == "" && cfg.WebhookURL == "" {
+		return nil, fmt.Errorf("usage export requires a file path or a webhook URL")
+	}
+	switch cfg.Format {
+	case "":
+		cfg.Format = FormatJSON
+	case FormatCSV, FormatJSON:
+	default:
+		return nil, fmt.Errorf("unknown usage report format %q (want %s or %s)", cfg.Format, FormatCSV, FormatJSON)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultExportInterval
+	}
+	return &Exporter{
+		recorder: recorder,
+		cfg:      cfg,
+		client:   &http.Client{Timeout: webhookTimeout},
+		logger:   logger,
+	}, nil
+}
+
+// Run は ctx が終了するまで一定間隔でレポートを出力し、終了時に残りの利用量を出力します。
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			finalCtx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+			e.export(finalCtx)
+			cancel()
+			return
+		case <-ticker.C:
+			e.export(ctx)
+		}
+	}
+}
+
+// export は集計をリセットしてレポートを出力します。利用がなかった期間は出力しません。
+func (e *Exporter) export(ctx context.Context) {
+	report := e.recorder.Flush()
+	if len(report.Entries) == 0 {
+		return
+	}
+	if err := e.Export(ctx, report); err != nil {
+		e.logger.Error("Usage export failed", "error", err)
+	}
+}
+
+// Export はレポートをファイルと Webhook に出力します。
+func (e *Exporter) Export(ctx context.Context, report Report) error {
+	if e.cfg.Path != "" {
+		if err := e.appendFile(report); err != nil {
+			return fmt.Errorf("write usage report: %w", err)
+		}
+	}
+	if e.cfg.WebhookURL != "" {
+		if err := e.post(ctx, report); err != nil {
+			return fmt.Errorf("send usage report: %w", err)
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) appendFile(report Report) error {
+	f, err := os.OpenFile(e.cfg.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if e.cfg.Format == FormatJSON {
+		return report.WriteJSON(f)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return report.WriteCSV(f, info.Size() == 0)
+}
+
+func (e *Exporter) post(ctx context.Context, report Report) error {
+	var body bytes.Buffer
+	contentType := "application/json"
+	if e.cfg.Format == FormatCSV {
+		contentType = "text/csv"
+		if err := report.WriteCSV(&body, true); err != nil {
+			return err
+		}
+	} else if err := report.WriteJSON(&body); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.WebhookURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package usage
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewExporter(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ExportConfig
+		wantErr bool
+	}{
+		{name: "ファイルを指定_成功", cfg: ExportConfig{Path: "usage.csv", Format: FormatCSV}},
+		{name: "Webhookを指定_成功", cfg: ExportConfig{WebhookURL: "https://example.com"}},
+		{name: "出力先なし_エラー", cfg: ExportConfig{Format: FormatJSON}, wantErr: true},
+		{name: "不明な形式_エラー", cfg: ExportConfig{Path: "usage.xml", Format: "xml"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewExporter(NewRecorder(), tt.cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewExporter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExporter_CSVFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.csv")
+	r := NewRecorder()
+	e, err := NewExporter(r, ExportConfig{Path: path, Format: FormatCSV}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := Dimensions{Server: "v1", Method: "ping"}
+	r.RecordRequest(d, 1)
+	e.export(context.Background())
+	e.export(context.Background()) // 利用がない期間は出力しない
+	r.RecordRequest(d, 1)
+	e.export(context.Background())
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "start,") {
+		t.Errorf("file = %q, want a header line followed by 2 rows", data)
+	}
+}
+
+func TestExporter_Webhook(t *testing.T) {
+	received := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r.Header.Get("Content-Type") + " " + string(body)
+	}))
+	defer srv.Close()
+
+	r := NewRecorder()
+	e, err := NewExporter(r, ExportConfig{WebhookURL: srv.URL, Interval: time.Hour}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.RecordRequest(Dimensions{Server: "v1", Method: "tools/call", Tool: "search"}, 3)
+
+	// 終了時に残りの利用量を出力する
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	e.Run(ctx)
+
+	select {
+	case got := <-received:
+		if !strings.HasPrefix(got, "application/json ") || !strings.Contains(got, `"tool":"search"`) {
+			t.Errorf("webhook received %q, want the JSON report", got)
+		}
+	default:
+		t.Fatal("webhook did not receive the report")
+	}
+}
@@ -0,0 +1,163 @@
+// Package usage は API キー・バックエンド・ツールごとの利用量を集計し、定期的にレポートとして出力する機能を提供します。
+//
+// 集計した利用量は課金の按分やキャパシティプランニングのために、CSV または JSON で
+// ファイルへの追記や Webhook への送信として出力します。
+package usage
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Dimensions は利用量を集計する単位です。
+type Dimensions struct {
+	Key    string `json:"key,omitempty"`    // API キーの ID（API キーを使わない場合は空）
+	Server string `json:"server"`           // バックエンドのバージョン
+	Method string `json:"method,omitempty"` // JSON-RPC のメソッド名
+	Tool   string `json:"tool,omitempty"`   // tools/call で呼び出したツール名
+	Labels string `json:"labels,omitempty"` // リクエストのラベル（"project=search,team=infra" のようにキーの順）
+}
+
+// Counters は集計単位ごとの利用量です。
+type Counters struct {
+	Calls         int64 `json:"calls"`
+	Errors        int64 `json:"errors"`
+	RequestBytes  int64 `json:"requestBytes"`
+	ResponseBytes int64 `json:"responseBytes"`
+}
+
+// Entry はレポートの1行です。
+type Entry struct {
+	Dimensions
+	Counters
+}
+
+// Report は期間内の利用量です。
+type Report struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Entries []Entry   `json:"entries"`
+}
+
+// Recorder は利用量を集計します。複数のゴルーチンから同時に使用できます。
+type Recorder struct {
+	mu     sync.Mutex
+	counts map[Dimensions]*Counters
+	start  time.Time
+	now    func() time.Time
+}
+
+// NewRecorder は Recorder を作成します。
+func NewRecorder() *Recorder {
+	r := &Recorder{counts: make(map[Dimensions]*Counters), now: time.Now}
+	r.start = r.now()
+	return r
+}
+
+// RecordRequest は呼び出しを1回数え、リクエストのバイト数を加算します。
+func (r *Recorder) RecordRequest(d Dimensions, bytes int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.counters(d)
+	c.Calls++
+	c.RequestBytes += int64(bytes)
+}
+
+// RecordResponse はレスポンスのバイト数を加算し、failed の場合はエラーを1回数えます。
+func (r *Recorder) RecordResponse(d Dimensions, bytes int, failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.counters(d)
+	c.ResponseBytes += int64(bytes)
+	if failed {
+		c.Errors++
+	}
+}
+
+func (r *Recorder) counters(d Dimensions) *Counters {
+	c, ok := r.counts[d]
+	if !ok {
+		c = &Counters{}
+		r.counts[d] = c
+	}
+	return c
+}
+
+// Snapshot は前回の Flush 以降の利用量を返します。集計はリセットしません。
+func (r *Recorder) Snapshot() Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.report()
+}
+
+// Flush は前回の Flush 以降の利用量を返し、集計をリセットします。
+func (r *Recorder) Flush() Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := r.report()
+	r.counts = make(map[Dimensions]*Counters)
+	r.start = report.End
+	return report
+}
+
+func (r *Recorder) report() Report {
+	report := Report{Start: r.start, End: r.now(), Entries: make([]Entry, 0, len(r.counts))}
+	for d, c := range r.counts {
+		report.Entries = append(report.Entries, Entry{Dimensions: d, Counters: *c})
+	}
+	slices.SortFunc(report.Entries, func(a, b Entry) int {
+		return cmp.Or(
+			cmp.Compare(a.Key, b.Key),
+			cmp.Compare(a.Server, b.Server),
+			cmp.Compare(a.Method, b.Method),
+			cmp.Compare(a.Tool, b.Tool),
+			cmp.Compare(a.Labels, b.Labels),
+		)
+	})
+	return report
+}
+
+// csvHeader は CSV の列名です。既存のファイルに追記しても列の位置が変わらないよう、後から加えた列は末尾に置きます。
+var csvHeader = []string{"start", "end", "key", "server", "method", "tool", "calls", "errors", "request_bytes", "response_bytes", "labels"}
+
+// WriteCSV はレポートを CSV の行として書き込みます。header が true の場合は列名の行を先頭に書き込みます。
+func (r Report) WriteCSV(w io.Writer, header bool) error {
+	cw := csv.NewWriter(w)
+	if header {
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	start, end := r.Start.UTC().Format(time.RFC3339), r.End.UTC().Format(time.RFC3339)
+	for _, e := range r.Entries {
+		record := []string{
+			start, end, e.Key, e.Server, e.Method, e.Tool,
+			strconv.FormatInt(e.Calls, 10),
+			strconv.FormatInt(e.Errors, 10),
+			strconv.FormatInt(e.RequestBytes, 10),
+			strconv.FormatInt(e.ResponseBytes, 10),
+			e.Labels,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON はレポートを1行の JSON として書き込みます。
+func (r Report) WriteJSON(w io.Writer) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
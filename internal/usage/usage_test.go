@@ -0,0 +1,111 @@
+package usage
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestRecorder は now を固定の時刻から1分ずつ進める Recorder を作成します。
+func newTestRecorder() *Recorder {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := NewRecorder()
+	r.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+	r.start = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	return r
+}
+
+func TestRecorder(t *testing.T) {
+	r := newTestRecorder()
+	search := Dimensions{Key: "k1", Server: "v1", Method: "tools/call", Tool: "search"}
+	list := Dimensions{Key: "k1", Server: "v1", Method: "tools/list"}
+
+	r.RecordRequest(search, 10)
+	r.RecordResponse(search, 100, false)
+	r.RecordRequest(search, 20)
+	r.RecordResponse(search, 0, true)
+	r.RecordRequest(list, 5)
+
+	want := []Entry{
+		{Dimensions: search, Counters: Counters{Calls: 2, Errors: 1, RequestBytes: 30, ResponseBytes: 100}},
+		{Dimensions: list, Counters: Counters{Calls: 1, RequestBytes: 5}},
+	}
+	if got := r.Snapshot().Entries; !reflect.DeepEqual(got, want) {
+		t.Errorf("Snapshot().Entries = %+v, want %+v", got, want)
+	}
+
+	report := r.Flush()
+	if !reflect.DeepEqual(report.Entries, want) {
+		t.Errorf("Flush().Entries = %+v, want %+v", report.Entries, want)
+	}
+	if got := r.Snapshot(); len(got.Entries) != 0 || !got.Start.Equal(report.End) {
+		t.Errorf("Snapshot() after Flush = %+v, want no entries starting at %v", got, report.End)
+	}
+}
+
+func TestReport_WriteCSV(t *testing.T) {
+	report := Report{
+		Start: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2026, 1, 1, 1, 0, 0, 0, time.UTC),
+		Entries: []Entry{
+			{Dimensions: Dimensions{Key: "k1", Server: "v1", Method: "tools/call", Tool: "search", Labels: "project=docs,team=infra"}, Counters: Counters{Calls: 2, Errors: 1, RequestBytes: 30, ResponseBytes: 100}},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		header bool
+		want   string
+	}{
+		{
+			name:   "列名あり_先頭に列名を書き込む",
+			header: true,
+			want: "start,end,key,server,method,tool,calls,errors,request_bytes,response_bytes,labels\n" +
+				"2026-01-01T00:00:00Z,2026-01-01T01:00:00Z,k1,v1,tools/call,search,2,1,30,100,\"project=docs,team=infra\"\n",
+		},
+		{
+			name: "列名なし_行のみ書き込む",
+			want: "2026-01-01T00:00:00Z,2026-01-01T01:00:00Z,k1,v1,tools/call,search,2,1,30,100,\"project=docs,team=infra\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := report.WriteCSV(&buf, tt.header); err != nil {
+				t.Fatalf("WriteCSV() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("WriteCSV() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReport_WriteJSON(t *testing.T) {
+	report := Report{
+		Start:   time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:     time.Date(2026, 1, 1, 1, 0, 0, 0, time.UTC),
+		Entries: []Entry{{Dimensions: Dimensions{Server: "v1", Method: "ping"}, Counters: Counters{Calls: 1}}},
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON() error = %v", err)
+	}
+	if bytes.Count(buf.Bytes(), []byte("\n")) != 1 {
+		t.Errorf("WriteJSON() = %q, want a single line", buf.String())
+	}
+	var got Report
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, report) {
+		t.Errorf("decoded report = %+v, want %+v", got, report)
+	}
+}
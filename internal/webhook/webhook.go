@@ -0,0 +1,229 @@
+// Package webhook はセッションのライフサイクルのイベントを外部のシステムに Webhook で通知します。
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// セッションのイベントの種類です。
+const (
+	EventSessionCreated    = "session.created"    // セッションを作成した
+	EventSessionExpired    = "session.expired"    // 保持期間を過ぎたため破棄した
+	EventSessionTerminated = "session.terminated" // クライアントの DELETE かサーバーの停止で終了させた
+	EventSessionError      = "session.error"      // セッションのプロセスが予期せず終了した
+)
+
+// EventTypes は通知できる全てのイベントの種類です。
+var EventTypes = []string{EventSessionCreated, EventSessionExpired, EventSessionTerminated, EventSessionError}
+
+// セッションを終了させた理由です。
+const (
+	ReasonClient   = "client"   // クライアントが DELETE で終了させた
+	ReasonShutdown = "shutdown" // サーバーの停止で終了させた
+	ReasonBudget   = "budget"   // セッションの実行の予算を超えたため終了させた
+)
+
+// Webhook のリクエストのヘッダーです。
+const (
+	HeaderTimestamp = "X-Tumiki-Timestamp" // 送信した時刻（Unix 秒）
+	HeaderSignature = "X-Tumiki-Signature" // "<timestamp>.<body>" の HMAC-SHA256 の署名（16進）
+)
+
+// 送信の設定のデフォルト値です。
+const (
+	DefaultRetries   = 3    // 失敗した場合に再送する回数
+	DefaultQueueSize = 1024 // 送信を待つイベントの最大数
+)
+
+// requestTimeout は1回の送信のタイムアウトです。
+const requestTimeout = 10 * time.Second
+
+// Session はイベントに含めるセッションのメタデータです。
+type Session struct {
+	ID              string    `json:"id"`
+	Transport       string    `json:"transport"` // セッションを作成したエンドポイント（"streamable-http" または "long-poll"）
+	ProtocolVersion string    `json:"protocolVersion,omitempty"`
+	Version         string    `json:"version,omitempty"`    // プロセスを起動したバックエンドのバージョン
+	Tenant          string    `json:"tenant,omitempty"`     // API キーのテナント
+	APIKeyID        string    `json:"apiKeyId,omitempty"`   // 認証に使った API キーの ID
+	AuthMethod      string    `json:"authMethod,omitempty"` // クライアントを認証した方式（jwt・apikey など）
+	Principal       string    `json:"principal,omitempty"`  // 認証したクライアント（JWT の subject など）
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// Event は Webhook で送る1つのイベントです。
+type Event struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Session Session   `json:"session"`
+	Reason  string    `json:"reason,omitempty"` // session.terminated の理由
+	Error   string    `json:"error,omitempty"`  // session.error の原因
+}
+
+// Config は Webhook の送信先の設定です。
+type Config struct {
+	URL       string   // イベントを POST する URL
+	Secret    []byte   // 署名の鍵（空で署名しない）
+	Events    []string // 送るイベントの種類（空で全て）
+	Retries   int      // 失敗した場合に再送する回数（0 でデフォルト、負の値で再送しない）
+	QueueSize int      // 送信を待つイベントの最大数（0 でデフォルト）
+}
+
+// Notifier はイベントを順に Webhook に送ります。
+// Notify は送信を待たずに戻り、送信を待つイベントが QueueSize を超えた場合は破棄します。
+// 停止で中断した送信は送り直すため、受信側は同じイベントを2回受け取ることがあります。
+type Notifier struct {
+	cfg     Config
+	client  *http.Client
+	logger  *slog.Logger
+	queue   chan Event
+	backoff time.Duration // 最初の再送までの待ち時間（再送ごとに2倍にする）
+	now     func() time.Time
+}
+
+// NewNotifier は設定を検証して Notifier を作成します。
+func NewNotifier(cfg Config, logger *slog.Logger) (*Notifier, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL %q", cfg.URL)
+	}
+	for _, event := range cfg.Events {
+		if !slices.Contains(EventTypes, event) {
+			return nil, fmt.Errorf("unknown webhook event %q (supported: %v)", event, EventTypes)
+		}
+	}
+	if cfg.Retries == 0 {
+		cfg.Retries = DefaultRetries
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	return &Notifier{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: requestTimeout},
+		logger:  logger,
+		queue:   make(chan Event, cfg.QueueSize),
+		backoff: time.Second,
+		now:     time.Now,
+	}, nil
+}
+
+// Notify はイベントを送信の待ち行列に追加します。Config.Events に含まれない種類のイベントは送りません。
+func (n *Notifier) Notify(event Event) {
+	if len(n.cfg.Events) > 0 && !slices.Contains(n.cfg.Events, event.Type) {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = n.now()
+	}
+	select {
+	case n.queue <- event:
+	default:
+		n.logger.Warn("Dropped webhook event because the queue is full", "type", event.Type, "session", event.Session.ID)
+	}
+}
+
+// Run は ctx が終了するまでイベントを送り、終了時に待ち行列に残っているイベントを送ります。
+// 終了によって送信を中断したイベントも、終了時に送り直します。
+func (n *Notifier) Run(ctx context.Context) {
+	var interrupted []Event
+	for ctx.Err() == nil {
+		select {
+		case event := <-n.queue:
+			if !n.deliver(ctx, event) {
+				interrupted = append(interrupted, event)
+			}
+		case <-ctx.Done():
+		}
+	}
+
+	finalCtx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	for _, event := range interrupted {
+		n.deliver(finalCtx, event)
+	}
+	for {
+		select {
+		case event := <-n.queue:
+			n.deliver(finalCtx, event)
+		default:
+			return
+		}
+	}
+}
+
+// deliver はイベントを送り、失敗した場合は待ち時間を倍にしながら Retries 回まで再送します。
+// ctx の終了で送信を中断した場合は false を返します。
+func (n *Notifier) deliver(ctx context.Context, event Event) bool {
+	body, err := json.Marshal(event)
+	if err != nil {
+		n.logger.Error("Failed to encode webhook event", "type", event.Type, "error", err)
+		return true
+	}
+
+	backoff := n.backoff
+	for attempt := 0; ; attempt++ {
+		err = n.post(ctx, body)
+		if err == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		if attempt >= n.cfg.Retries {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return false
+		}
+		backoff *= 2
+	}
+	n.logger.Error("Webhook delivery failed", "type", event.Type, "session", event.Session.ID, "error", err)
+	return true
+}
+
+// post はイベントを1回送ります。鍵が設定されている場合は送信した時刻とボディに署名します。
+func (n *Notifier) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(n.cfg.Secret) > 0 {
+		timestamp := strconv.FormatInt(n.now().Unix(), 10)
+		req.Header.Set(HeaderTimestamp, timestamp)
+		req.Header.Set(HeaderSignature, Sign(n.cfg.Secret, timestamp, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign は送信した時刻とボディの HMAC-SHA256 の署名を返します。受信側の検証に使えます。
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
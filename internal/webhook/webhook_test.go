@@ -0,0 +1,142 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestNewNotifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "URLを指定_成功", cfg: Config{URL: "https://example.com/hooks"}},
+		{name: "イベントを指定_成功", cfg: Config{URL: "https://example.com/hooks", Events: []string{EventSessionCreated, EventSessionError}}},
+		{name: "URLなし_エラー", cfg: Config{}, wantErr: true},
+		{name: "HTTP以外のURL_エラー", cfg: Config{URL: "ftp://example.com"}, wantErr: true},
+		{name: "不明なイベント_エラー", cfg: Config{URL: "https://example.com", Events: []string{"session.updated"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewNotifier(tt.cfg, discardLogger())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewNotifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNotifier_Deliver(t *testing.T) {
+	type request struct {
+		event     Event
+		timestamp string
+		signature string
+		body      []byte
+	}
+	received := make(chan request, 4)
+	var failures atomic.Int32
+	failures.Store(1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 最初の1回は失敗させ、再送されることを確かめる
+		if failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var event Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("body = %s: %v", body, err)
+		}
+		received <- request{event: event, timestamp: r.Header.Get(HeaderTimestamp), signature: r.Header.Get(HeaderSignature), body: body}
+	}))
+	defer srv.Close()
+
+	secret := []byte("secret")
+	n, err := NewNotifier(Config{URL: srv.URL, Secret: secret, Events: []string{EventSessionCreated, EventSessionTerminated}}, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.backoff = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		n.Run(ctx)
+		close(done)
+	}()
+
+	session := Session{ID: "abc", Transport: "streamable-http", Tenant: "acme", APIKeyID: "key1"}
+	n.Notify(Event{Type: EventSessionCreated, Session: session})
+	n.Notify(Event{Type: EventSessionExpired, Session: session}) // 送るイベントに含まれない
+	n.Notify(Event{Type: EventSessionTerminated, Session: session, Reason: ReasonClient})
+
+	for _, want := range []string{EventSessionCreated, EventSessionTerminated} {
+		select {
+		case got := <-received:
+			if got.event.Type != want || got.event.Session != session || got.event.Time.IsZero() {
+				t.Errorf("event = %+v, want %s of %+v", got.event, want, session)
+			}
+			if got.signature != Sign(secret, got.timestamp, got.body) {
+				t.Errorf("signature = %q, want the HMAC of the timestamp and body", got.signature)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s was not delivered", want)
+		}
+	}
+
+	cancel()
+	<-done
+}
+
+func TestNotifier_RunDrainsQueue(t *testing.T) {
+	received := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		received <- event.Type
+	}))
+	defer srv.Close()
+
+	n, err := NewNotifier(Config{URL: srv.URL}, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Notify(Event{Type: EventSessionTerminated, Reason: ReasonShutdown})
+
+	// 停止時に待ち行列に残っているイベントを送る
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n.Run(ctx)
+	select {
+	case got := <-received:
+		if got != EventSessionTerminated {
+			t.Errorf("type = %q, want %q", got, EventSessionTerminated)
+		}
+	default:
+		t.Error("queued event was not delivered on shutdown")
+	}
+}
+
+func TestNotifier_QueueFull(t *testing.T) {
+	n, err := NewNotifier(Config{URL: "https://example.com", QueueSize: 1}, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Notify(Event{Type: EventSessionCreated})
+	n.Notify(Event{Type: EventSessionCreated}) // 待ち行列があふれた分は破棄する
+	if got := len(n.queue); got != 1 {
+		t.Errorf("queue length = %d, want 1", got)
+	}
+}
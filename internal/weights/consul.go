@@ -0,0 +1,110 @@
+package weights
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// defaultConsulAddr は CONSUL_HTTP_ADDR が設定されていない場合の Consul エージェントのアドレスです。
+const defaultConsulAddr = "http://127.0.0.1:8500"
+
+// Consul は Consul エージェントにインスタンスをサービスとして登録し、サービスの重みで健全性を公開します。
+// 停止する時は登録を解除します。
+type Consul struct {
+	addr    string
+	token   string
+	service string
+	client  *http.Client
+}
+
+// NewConsulFromEnv は CONSUL_HTTP_ADDR（省略時は http://127.0.0.1:8500）と CONSUL_HTTP_TOKEN から Consul を作成します。
+func NewConsulFromEnv(service string) (*Consul, error) {
+	if service == "" {
+		return nil, fmt.Errorf("consul weight target requires a service name: use consul:SERVICE")
+	}
+	addr := os.Getenv("CONSUL_HTTP_ADDR")
+	if addr == "" {
+		addr = defaultConsulAddr
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	if _, err := url.Parse(addr); err != nil {
+		return nil, fmt.Errorf("invalid CONSUL_HTTP_ADDR %q: %w", addr, err)
+	}
+	return &Consul{
+		addr:    strings.TrimSuffix(addr, "/"),
+		token:   os.Getenv("CONSUL_HTTP_TOKEN"),
+		service: service,
+		client:  &http.Client{},
+	}, nil
+}
+
+// consulRegistration は Consul の /v1/agent/service/register の本文です。
+type consulRegistration struct {
+	ID      string            `json:"ID"`
+	Name    string            `json:"Name"`
+	Address string            `json:"Address"`
+	Port    int               `json:"Port"`
+	Meta    map[string]string `json:"Meta"`
+	Weights struct {
+		Passing int `json:"Passing"`
+		Warning int `json:"Warning"`
+	} `json:"Weights"`
+}
+
+// Publish はインスタンスを重み付きで登録します。Consul の重みは 1 以上のため、重み 0 は 1 として登録します。
+// StatusDown の場合は登録を解除します。
+func (c *Consul) Publish(ctx context.Context, report Report) error {
+	if report.Status == StatusDown {
+		return c.do(ctx, http.MethodPut, "/v1/agent/service/deregister/"+url.PathEscape(report.ID), nil)
+	}
+	host, port, err := hostPort(report.URL)
+	if err != nil {
+		return err
+	}
+	reg := consulRegistration{
+		ID:      report.ID,
+		Name:    c.service,
+		Address: host,
+		Port:    port,
+		Meta:    map[string]string{"url": report.URL, "status": report.Status},
+	}
+	reg.Weights.Passing = max(report.Weight, 1)
+	reg.Weights.Warning = 1
+	body, err := json.Marshal(reg)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPut, "/v1/agent/service/register", body)
+}
+
+func (c *Consul) do(ctx context.Context, method, path string, body []byte) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, c.addr+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("consul %s %s returned %s", method, path, resp.Status)
+	}
+	return nil
+}
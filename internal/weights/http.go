@@ -0,0 +1,51 @@
+package weights
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// httpPublisher は Report を JSON で URL に POST します。独自のロードバランサーやコントローラーと連携するために使います。
+type httpPublisher struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func newHTTPPublisher(rawURL, token string) (*httpPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid weight URL %q", rawURL)
+	}
+	return &httpPublisher{url: rawURL, token: token, client: &http.Client{}}, nil
+}
+
+func (p *httpPublisher) Publish(ctx context.Context, report Report) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("weight endpoint returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package weights
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const (
+	// route53Region は署名に使うリージョンです。Route 53 はグローバルサービスのため us-east-1 で署名します。
+	route53Region = "us-east-1"
+
+	// route53MaxWeight は Route 53 の加重レコードの重みの上限です。
+	route53MaxWeight = 255
+
+	// route53TTL は更新するレコードの TTL（秒）です。重みの変更をすぐに反映するため短くします。
+	route53TTL = 60
+)
+
+// Route53 はホストゾーンの加重レコードをインスタンスごとに UPSERT し、重みで健全性を公開します。
+// レコードの SetIdentifier はインスタンスの ID で、値は URL のホストです（IP アドレスの場合は A/AAAA、それ以外は CNAME）。
+// 停止する時はレコードを削除せず重みを 0 にします。
+type Route53 struct {
+	zoneID string
+	name   string
+	client *route53.Client
+}
+
+// NewRoute53FromEnv は AWS の SDK の既定の認証情報（環境変数・タスクロールなど）で、
+// ホストゾーン zoneID のレコード name を更新する Route53 を作成します。
+func NewRoute53FromEnv(zoneID, name string) (*Route53, error) {
+	zoneID = strings.TrimPrefix(zoneID, "/hostedzone/")
+	if zoneID == "" || name == "" {
+		return nil, fmt.Errorf("route53 weight target requires a hosted zone ID and a record name: use route53:ZONE_ID/NAME")
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(route53Region))
+	if err != nil {
+		return nil, fmt.Errorf("route53: load AWS config: %w", err)
+	}
+	return &Route53{
+		zoneID: zoneID,
+		name:   name,
+		client: route53.NewFromConfig(cfg),
+	}, nil
+}
+
+// Publish はインスタンスの加重レコードを UPSERT します。MaxWeight が 255 を超える場合は 0〜255 に換算します。
+func (r *Route53) Publish(ctx context.Context, report Report) error {
+	host, _, err := hostPort(report.URL)
+	if err != nil {
+		return err
+	}
+	weight := report.Weight
+	if report.Status == StatusDown {
+		weight = 0
+	}
+	if report.MaxWeight > route53MaxWeight {
+		weight = weight * route53MaxWeight / report.MaxWeight
+	}
+	weight = min(max(weight, 0), route53MaxWeight)
+
+	recordType := types.RRTypeCname
+	if isIP(host) {
+		recordType = types.RRTypeA
+		if strings.Contains(host, ":") {
+			recordType = types.RRTypeAaaa
+		}
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err = r.client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(r.zoneID),
+		ChangeBatch: &types.ChangeBatch{Changes: []types.Change{{
+			Action: types.ChangeActionUpsert,
+			ResourceRecordSet: &types.ResourceRecordSet{
+				Name:            aws.String(r.name),
+				Type:            recordType,
+				SetIdentifier:   aws.String(report.ID),
+				Weight:          aws.Int64(int64(weight)),
+				TTL:             aws.Int64(route53TTL),
+				ResourceRecords: []types.ResourceRecord{{Value: aws.String(host)}},
+			},
+		}}},
+	})
+	if err != nil {
+		return fmt.Errorf("route53: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Package weights は複製して動かすアダプターの各インスタンスの健全性と重みを、ロードバランサーが参照するエンドポイントに公開します。
+//
+// バックエンドの失敗が増えたインスタンスの重みを下げることで、DNS の加重レコードやサービスディスカバリーの重みを参照する
+// ロードバランサーが、正常なインスタンスにトラフィックを移せるようにします。
+package weights
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// インスタンスの状態です。
+const (
+	StatusHealthy  = "healthy"  // バックエンドの失敗がない
+	StatusDegraded = "degraded" // バックエンドの失敗があり、重みを下げている
+	StatusDown     = "down"     // 停止するため、トラフィックを受け付けない
+)
+
+// requestTimeout は ctx に期限がない場合の1リクエストあたりのタイムアウトです。
+const requestTimeout = 10 * time.Second
+
+// Report は公開するインスタンスの健全性と重みです。
+type Report struct {
+	ID        string    `json:"id"`  // インスタンスを識別する AdvertiseURL
+	URL       string    `json:"url"` // クライアントが接続するベース URL
+	Status    string    `json:"status"`
+	Weight    int       `json:"weight"`    // 0 から MaxWeight までの重み
+	MaxWeight int       `json:"maxWeight"` // 正常なインスタンスの重み
+	Requests  int64     `json:"requests"`  // 直前の間隔に処理したリクエストの数
+	Failures  int64     `json:"failures"`  // 直前の間隔にバックエンドの失敗で終わったリクエストの数
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Publisher はインスタンスの重みを外部のエンドポイントに公開します。
+type Publisher interface {
+	Publish(ctx context.Context, report Report) error
+}
+
+// New は target から Publisher を作成します。
+//
+//	https://lb.example.com/weights   JSON の Report を POST する（token は Authorization: Bearer で送る）
+//	consul:SERVICE                   Consul のサービスの重み（CONSUL_HTTP_ADDR・CONSUL_HTTP_TOKEN を使用）
+//	route53:ZONE_ID/NAME             Route 53 の加重レコード（AWS の SDK の既定の認証情報を使用）
+func New(target, token string) (Publisher, error) {
+	scheme, rest, _ := strings.Cut(target, ":")
+	switch scheme {
+	case "http", "https":
+		return newHTTPPublisher(target, token)
+	case "consul":
+		return NewConsulFromEnv(rest)
+	case "route53":
+		zone, name, ok := strings.Cut(rest, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid weight target %q: use route53:ZONE_ID/NAME", target)
+		}
+		return NewRoute53FromEnv(zone, name)
+	default:
+		return nil, fmt.Errorf("unsupported weight target %q (supported: http(s)://URL, consul:SERVICE, route53:ZONE_ID/NAME)", target)
+	}
+}
+
+// hostPort はインスタンスの URL のホストとポートを返します。ポートがない場合はスキームのデフォルトを返します。
+func hostPort(rawURL string) (string, int, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return "", 0, fmt.Errorf("invalid instance URL %q", rawURL)
+	}
+	port := 80
+	if u.Scheme == "https" {
+		port = 443
+	}
+	if p := u.Port(); p != "" {
+		if _, err := fmt.Sscan(p, &port); err != nil {
+			return "", 0, fmt.Errorf("invalid instance URL %q", rawURL)
+		}
+	}
+	return u.Hostname(), port, nil
+}
+
+// isIP は host が IP アドレスかを返します。
+func isIP(host string) bool {
+	return net.ParseIP(host) != nil
+}
+
+// withTimeout は ctx に期限がない場合に requestTimeout の期限を付けます。
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, requestTimeout)
+}
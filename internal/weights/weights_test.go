@@ -0,0 +1,190 @@
+package weights
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	tests := []struct {
+		name    string
+		target  string
+		wantErr bool
+	}{
+		{name: "HTTP", target: "https://lb.example.com/weights"},
+		{name: "Consul", target: "consul:tumiki"},
+		{name: "Route53", target: "route53:Z123/mcp.example.com"},
+		{name: "Consulのサービスなし_エラー", target: "consul:", wantErr: true},
+		{name: "Route53のレコード名なし_エラー", target: "route53:Z123", wantErr: true},
+		{name: "未対応_エラー", target: "etcd:tumiki", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.target, ""); (err != nil) != tt.wantErr {
+				t.Errorf("New(%q) error = %v, wantErr %v", tt.target, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTPPublisher(t *testing.T) {
+	var got Report
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	p, err := New(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := Report{ID: "http://10.0.0.1:8080", URL: "http://10.0.0.1:8080", Status: StatusDegraded, Weight: 60, MaxWeight: 100, Requests: 10, Failures: 4}
+	if err := p.Publish(context.Background(), report); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if got != report || auth != "Bearer token" {
+		t.Errorf("received %+v (Authorization %q), want %+v", got, auth, report)
+	}
+}
+
+func TestConsul(t *testing.T) {
+	var requests []string
+	var reg consulRegistration
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "acl" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+		if strings.HasSuffix(r.URL.Path, "/register") {
+			_ = json.NewDecoder(r.Body).Decode(&reg)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("CONSUL_HTTP_ADDR", server.URL)
+	t.Setenv("CONSUL_HTTP_TOKEN", "acl")
+
+	c, err := NewConsulFromEnv("tumiki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	report := Report{ID: "https://mcp-1.example.com", URL: "https://mcp-1.example.com", Status: StatusDegraded, Weight: 0, MaxWeight: 100}
+	if err := c.Publish(ctx, report); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if reg.ID != report.ID || reg.Name != "tumiki" || reg.Address != "mcp-1.example.com" || reg.Port != 443 {
+		t.Errorf("registration = %+v", reg)
+	}
+	// Consul の重みは 1 以上
+	if reg.Weights.Passing != 1 {
+		t.Errorf("Weights.Passing = %d, want 1", reg.Weights.Passing)
+	}
+
+	report.Status = StatusDown
+	if err := c.Publish(ctx, report); err != nil {
+		t.Fatalf("Publish(down) error = %v", err)
+	}
+	want := []string{
+		"PUT /v1/agent/service/register",
+		"PUT /v1/agent/service/deregister/https:%2F%2Fmcp-1.example.com",
+	}
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+}
+
+func TestRoute53(t *testing.T) {
+	tests := []struct {
+		name       string
+		report     Report
+		wantType   string
+		wantValue  string
+		wantWeight string
+	}{
+		{
+			name:       "IPv4_A",
+			report:     Report{ID: "http://10.0.0.1:8080", URL: "http://10.0.0.1:8080", Status: StatusHealthy, Weight: 100, MaxWeight: 100},
+			wantType:   "<Type>A</Type>",
+			wantValue:  "<Value>10.0.0.1</Value>",
+			wantWeight: "<Weight>100</Weight>",
+		},
+		{
+			name:       "ホスト名_CNAME",
+			report:     Report{ID: "https://mcp-1.example.com", URL: "https://mcp-1.example.com", Status: StatusDegraded, Weight: 500, MaxWeight: 1000},
+			wantType:   "<Type>CNAME</Type>",
+			wantValue:  "<Value>mcp-1.example.com</Value>",
+			wantWeight: "<Weight>127</Weight>",
+		},
+		{
+			name:       "停止_重み0",
+			report:     Report{ID: "http://[fd00::1]:8080", URL: "http://[fd00::1]:8080", Status: StatusDown, Weight: 100, MaxWeight: 100},
+			wantType:   "<Type>AAAA</Type>",
+			wantValue:  "<Value>fd00::1</Value>",
+			wantWeight: "<Weight>0</Weight>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path, auth, body string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				auth = r.Header.Get("Authorization")
+				b, _ := io.ReadAll(r.Body)
+				body = string(b)
+			}))
+			defer server.Close()
+			t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+			t.Setenv("AWS_ENDPOINT_URL_ROUTE_53", server.URL)
+
+			r, err := NewRoute53FromEnv("/hostedzone/Z123", "mcp.example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Publish(context.Background(), tt.report); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+			if path != "/2013-04-01/hostedzone/Z123/rrset" {
+				t.Errorf("path = %q", path)
+			}
+			if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/us-east-1/route53/aws4_request") {
+				t.Errorf("Authorization = %q", auth)
+			}
+			for _, want := range []string{"<Action>UPSERT</Action>", "<Name>mcp.example.com</Name>", "<SetIdentifier>" + tt.report.ID + "</SetIdentifier>", tt.wantType, tt.wantValue, tt.wantWeight} {
+				if !strings.Contains(body, want) {
+					t.Errorf("body does not contain %s: %s", want, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRoute53_エラー応答(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("<ErrorResponse><Error><Code>InvalidChangeBatch</Code></Error></ErrorResponse>"))
+	}))
+	defer server.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_ENDPOINT_URL_ROUTE_53", server.URL)
+
+	r, err := NewRoute53FromEnv("Z123", "mcp.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Publish(context.Background(), Report{ID: "a", URL: "http://10.0.0.1", Status: StatusHealthy, Weight: 1, MaxWeight: 1})
+	if err == nil || !strings.Contains(err.Error(), "InvalidChangeBatch") {
+		t.Errorf("Publish() error = %v, want InvalidChangeBatch", err)
+	}
+}